@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clfTimeFormat is the timestamp layout of the Common Log Format
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogger writes one line per request in the Common Log Format or as JSON
+type accessLogger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format string
+}
+
+// accessLog is nil while access logging is off
+var accessLog *accessLogger
+
+// configureAccessLog reads GO_SUBNET_CALCULATOR_ACCESS_LOG (stdout, stderr or a file
+// path; unset disables the access log) and GO_SUBNET_CALCULATOR_ACCESS_LOG_FORMAT
+// (clf, the default, or json)
+func configureAccessLog() error {
+	accessLog = nil
+	target := os.Getenv("GO_SUBNET_CALCULATOR_ACCESS_LOG")
+	format := strings.ToLower(os.Getenv("GO_SUBNET_CALCULATOR_ACCESS_LOG_FORMAT"))
+	switch format {
+	case "":
+		format = "clf"
+	case "clf", "json":
+	default:
+		return fmt.Errorf("GO_SUBNET_CALCULATOR_ACCESS_LOG_FORMAT must be clf or json, got %q", format)
+	}
+	if target == "" {
+		recordSystemAudit("config.access_log", "", "access log disabled")
+		return nil
+	}
+
+	var out io.Writer
+	switch target {
+	case "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_ACCESS_LOG: %v", err)
+		}
+		out = f
+	}
+	accessLog = &accessLogger{out: out, format: format}
+	recordSystemAudit("config.access_log", target, "access log in %s format", format)
+	return nil
+}
+
+// responseRecord collects the status, size and user of a response for the access log
+// and traces
+type responseRecord struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	user   string
+}
+
+type responseRecordKey struct{}
+
+func (a *responseRecord) WriteHeader(status int) {
+	if a.status == 0 {
+		a.status = status
+	}
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *responseRecord) Write(p []byte) (int, error) {
+	if a.status == 0 {
+		a.status = http.StatusOK
+	}
+	n, err := a.ResponseWriter.Write(p)
+	a.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController flush streamed responses through the record
+func (a *responseRecord) Unwrap() http.ResponseWriter {
+	return a.ResponseWriter
+}
+
+// setAccessUser names the authenticated user of a request in its access log line
+func setAccessUser(ctx context.Context, user string) {
+	if a, ok := ctx.Value(responseRecordKey{}).(*responseRecord); ok {
+		a.user = user
+	}
+}
+
+// AccessLogEntry is a line of the access log in JSON format
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	Remote     string    `json:"remote"`
+	User       string    `json:"user,omitempty"`
+	Method     string    `json:"method"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// line renders an entry in the configured format
+func (l *accessLogger) line(e *AccessLogEntry) []byte {
+	if l.format == "json" {
+		b, _ := json.Marshal(e)
+		return append(b, '\n')
+	}
+	user, size := e.User, strconv.FormatInt(e.Bytes, 10)
+	if user == "" {
+		user = "-"
+	}
+	if e.Bytes == 0 {
+		size = "-"
+	}
+	return fmt.Appendf(nil, "%s - %s [%s] %q %d %s\n", e.Remote, strings.ReplaceAll(user, " ", "_"),
+		e.Time.Format(clfTimeFormat), e.Method+" "+e.URI+" "+e.Proto, e.Status, size)
+}
+
+func (l *accessLogger) write(e *AccessLogEntry) {
+	line := l.line(e)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(line)
+}
+
+// logAccess writes a line to the access log for every request once it is served
+func logAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := accessLog
+		if logger == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		record := &responseRecord{ResponseWriter: w}
+		next.ServeHTTP(record, r.WithContext(context.WithValue(r.Context(), responseRecordKey{}, record)))
+		if record.status == 0 {
+			record.status = http.StatusOK
+		}
+		logger.write(&AccessLogEntry{
+			Time:       start,
+			Remote:     clientAddress(r),
+			User:       record.user,
+			Method:     r.Method,
+			URI:        r.RequestURI,
+			Proto:      r.Proto,
+			Status:     record.status,
+			Bytes:      record.bytes,
+			DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+			RequestID:  requestID(r.Context()),
+			Referer:    r.Referer(),
+			UserAgent:  r.UserAgent(),
+		})
+	})
+}
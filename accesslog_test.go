@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// withTestAccessLog collects access log lines in the given format
+func withTestAccessLog(t *testing.T, format string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := accessLog
+	accessLog = &accessLogger{out: &buf, format: format}
+	t.Cleanup(func() { accessLog = previous })
+	return &buf
+}
+
+func TestAccessLogCLF(t *testing.T) {
+	withTestAudit(t)
+	withTestAPIKeys(t, false, "")
+	buf := withTestAccessLog(t, "clf")
+	_, secret, _ := createAPIKey("ci pipeline", "", "")
+	h := withRequestID(logAccess(requireAPIKey(http.HandlerFunc(calculateHandler))))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=10.0.0.1&mask=/8", nil)
+	r.RemoteAddr = "192.0.2.7:51000"
+	r.Header.Set("Authorization", "Bearer "+secret)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	r = httptest.NewRequest(http.MethodDelete, "/api/v1/calculate", nil)
+	r.RemoteAddr = "192.0.2.8:51000"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []*regexp.Regexp{
+		regexp.MustCompile(`^192\.0\.2\.7 - apikey:ci_pipeline \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /api/v1/calculate\?ip=10\.0\.0\.1&mask=/8 HTTP/1\.1" 200 \d+$`),
+		regexp.MustCompile(`^192\.0\.2\.8 - - \[.*\] "DELETE /api/v1/calculate HTTP/1\.1" 405 \d+$`),
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("access log = %q", buf.String())
+	}
+	for i, re := range want {
+		if !re.MatchString(lines[i]) {
+			t.Errorf("line %d = %q, want %s", i, lines[i], re)
+		}
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	buf := withTestAccessLog(t, "json")
+	h := withRequestID(logAccess(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})))
+	r := httptest.NewRequest(http.MethodGet, "/health", nil)
+	r.Header.Set("X-Request-ID", "abc-123")
+	r.Header.Set("User-Agent", "probe/1.0")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	var e AccessLogEntry
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Fatalf("invalid JSON line %q: %v", buf.String(), err)
+	}
+	if e.Method != "GET" || e.URI != "/health" || e.Status != 200 || e.Bytes != 2 || e.RequestID != "abc-123" || e.UserAgent != "probe/1.0" || e.Remote != "192.0.2.1" {
+		t.Errorf("entry = %+v", e)
+	}
+}
+
+func TestConfigureAccessLog(t *testing.T) {
+	withTestAudit(t)
+	previous := accessLog
+	t.Cleanup(func() { accessLog = previous })
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	t.Setenv("GO_SUBNET_CALCULATOR_ACCESS_LOG", path)
+	t.Setenv("GO_SUBNET_CALCULATOR_ACCESS_LOG_FORMAT", "JSON")
+	if err := configureAccessLog(); err != nil || accessLog == nil || accessLog.format != "json" {
+		t.Fatalf("configureAccessLog() = %v, %+v", err, accessLog)
+	}
+	accessLog.write(&AccessLogEntry{Method: "GET", URI: "/", Status: 200})
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), `"uri":"/"`) {
+		t.Errorf("access log file = %q", data)
+	}
+
+	t.Setenv("GO_SUBNET_CALCULATOR_ACCESS_LOG_FORMAT", "combined")
+	if err := configureAccessLog(); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	t.Setenv("GO_SUBNET_CALCULATOR_ACCESS_LOG", "")
+	t.Setenv("GO_SUBNET_CALCULATOR_ACCESS_LOG_FORMAT", "")
+	if err := configureAccessLog(); err != nil || accessLog != nil {
+		t.Errorf("disabled access log = %v, %+v", err, accessLog)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ErrorResponse is the JSON body returned by API endpoints on failure. RequestID
+// identifies the request in the server logs
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeJSON encodes v as the response body with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("JSON encoding error: %v", err)
+	}
+}
+
+// writeJSONError writes an ErrorResponse with the given status code
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, ErrorResponse{Error: message, RequestID: w.Header().Get(requestIDHeader)})
+}
+
+// responseFormat picks the output format from the format query parameter,
+// falling back to the Accept header and finally to the given default
+func responseFormat(r *http.Request, fallback string) string {
+	if format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format"))); format != "" {
+		if format == "md" {
+			return "markdown"
+		}
+		return format
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/x-ndjson"):
+		return "ndjson"
+	case strings.Contains(accept, "application/json"):
+		return "json"
+	case strings.Contains(accept, "text/csv"):
+		return "csv"
+	case strings.Contains(accept, "text/markdown"):
+		return "markdown"
+	case strings.Contains(accept, "image/svg+xml"):
+		return "svg"
+	case strings.Contains(accept, "image/png"):
+		return "png"
+	case strings.Contains(accept, "text/html"):
+		return "html"
+	case strings.Contains(accept, "text/plain"):
+		return "text"
+	}
+
+	return fallback
+}
+
+// decodeOption adjusts how decodeJSONPost and decodeJSONBody read a body
+type decodeOption int
+
+const (
+	// allowUnknownFields accepts fields v does not have, for bodies that are the
+	// response of another endpoint, such as a split posted to /api/v1/plan
+	allowUnknownFields decodeOption = iota + 1
+)
+
+// decodeJSONPost decodes the JSON body of a POST request into v like decodeJSONBody.
+// On a wrong method it writes the error response and returns false
+func decodeJSONPost(w http.ResponseWriter, r *http.Request, v interface{}, opts ...decodeOption) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+	return decodeJSONBody(w, r, v, opts...)
+}
+
+// decodeJSONBody decodes the JSON request body into v, writing a 400 response and
+// returning false when it is malformed or, unless allowUnknownFields is given, has a
+// field v does not have, so a misspelt field is reported instead of silently ignored.
+// A body over its size limit gets a 413
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}, opts ...decodeOption) bool {
+	decoder := json.NewDecoder(r.Body)
+	if !slices.Contains(opts, allowUnknownFields) {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		if writeBodyTooLarge(w, err) {
+			return false
+		}
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// apiKeyPrefix marks the keys issued by this application so they are easy to spot in
+// configuration files and secret scanners
+const apiKeyPrefix = "gsc_"
+
+// APIKey is an API client credential with a role in one tenant, or in all of them
+// with Tenant "*". Only the SHA-256 hash of the key is stored; Prefix holds its first
+// characters so a key can be recognised in listings
+type APIKey struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Tenant    string    `json:"tenant"`
+	Role      Role      `json:"role"`
+	Prefix    string    `json:"prefix"`
+	Hash      string    `json:"-"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIKeyStore persists API keys. Get, Update and Delete return errIPAMNotFound for
+// unknown ids and FindByHash for unknown hashes
+type APIKeyStore interface {
+	ListKeys() ([]*APIKey, error)
+	GetKey(id int64) (*APIKey, error)
+	FindKeyByHash(hash string) (*APIKey, error)
+	CreateKey(k *APIKey) error
+	UpdateKey(k *APIKey) error
+	DeleteKey(id int64) error
+}
+
+// memoryAPIKeyStore keeps API keys in memory; they are lost on restart
+type memoryAPIKeyStore struct {
+	mu     sync.RWMutex
+	nextID int64
+	keys   map[int64]*APIKey
+}
+
+func newMemoryAPIKeyStore() *memoryAPIKeyStore {
+	return &memoryAPIKeyStore{keys: map[int64]*APIKey{}}
+}
+
+func (s *memoryAPIKeyStore) ListKeys() ([]*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		c := *k
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *memoryAPIKeyStore) GetKey(id int64) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, errIPAMNotFound
+	}
+	c := *k
+	return &c, nil
+}
+
+func (s *memoryAPIKeyStore) FindKeyByHash(hash string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.keys {
+		if k.Hash == hash {
+			c := *k
+			return &c, nil
+		}
+	}
+	return nil, errIPAMNotFound
+}
+
+func (s *memoryAPIKeyStore) CreateKey(k *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	k.ID, k.CreatedAt = s.nextID, time.Now().UTC()
+	c := *k
+	s.keys[k.ID] = &c
+	return nil
+}
+
+func (s *memoryAPIKeyStore) UpdateKey(k *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[k.ID]; !ok {
+		return errIPAMNotFound
+	}
+	c := *k
+	s.keys[k.ID] = &c
+	return nil
+}
+
+func (s *memoryAPIKeyStore) DeleteKey(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[id]; !ok {
+		return errIPAMNotFound
+	}
+	delete(s.keys, id)
+	return nil
+}
+
+// apiKeyStore holds the API keys checked by requireAPIKey
+var apiKeyStore APIKeyStore = newMemoryAPIKeyStore()
+
+// apiAuthRequired makes every /api/ request present a valid API key; set from
+// GO_SUBNET_CALCULATOR_API_AUTH by configureAPIAuth
+var apiAuthRequired bool
+
+// adminToken protects /api/v1/admin/; the admin API is disabled while it is empty
+var adminToken string
+
+// configureAPIAuth reads GO_SUBNET_CALCULATOR_API_AUTH (off or required) and the
+// GO_SUBNET_CALCULATOR_ADMIN_TOKEN secret
+func configureAPIAuth() error {
+	switch mode := strings.ToLower(os.Getenv("GO_SUBNET_CALCULATOR_API_AUTH")); mode {
+	case "", "off":
+		apiAuthRequired = false
+	case "required":
+		apiAuthRequired = true
+	default:
+		return fmt.Errorf("GO_SUBNET_CALCULATOR_API_AUTH must be off or required, got %q", mode)
+	}
+	token, err := loadSecret("GO_SUBNET_CALCULATOR_ADMIN_TOKEN")
+	if err != nil {
+		return err
+	}
+	adminToken = token
+	recordSystemAudit("config.api_auth", "", "api keys required: %t, admin api enabled: %t", apiAuthRequired, adminToken != "")
+	return nil
+}
+
+// hashAPIKey returns the stored form of a key. Keys are 256 random bits, so a plain
+// SHA-256 is enough; a slow password hash would only add latency to every request
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// setKeyGrant validates and sets the tenant and role of a key; empty values keep the
+// current ones
+func setKeyGrant(k *APIKey, tenant, role string) error {
+	if tenant != "" {
+		if err := validTenant(tenant, true); err != nil {
+			return err
+		}
+		k.Tenant = tenant
+	}
+	if role != "" {
+		r, err := parseRole(role)
+		if err != nil {
+			return err
+		}
+		k.Role = r
+	}
+	return nil
+}
+
+// createAPIKey issues a new enabled key and returns it with its secret, which is
+// shown once and never stored. Keys are viewers in the default tenant unless a
+// tenant and role are given
+func createAPIKey(name, tenant, role string) (*APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("key name is required")
+	}
+	key := &APIKey{Name: name, Tenant: defaultTenant, Role: RoleViewer, Enabled: true}
+	if err := setKeyGrant(key, tenant, role); err != nil {
+		return nil, "", err
+	}
+	token, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	secret := apiKeyPrefix + token
+	key.Prefix, key.Hash = secret[:len(apiKeyPrefix)+6], hashAPIKey(secret)
+	if err := apiKeyStore.CreateKey(key); err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// setAPIKeyEnabled enables or disables a key without deleting it
+func setAPIKeyEnabled(id int64, enabled bool) (*APIKey, error) {
+	key, err := apiKeyStore.GetKey(id)
+	if err != nil {
+		return nil, err
+	}
+	key.Enabled = enabled
+	return key, apiKeyStore.UpdateKey(key)
+}
+
+// authenticateAPIKey returns the enabled key matching a secret
+func authenticateAPIKey(secret string) (*APIKey, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return nil, fmt.Errorf("invalid API key")
+	}
+	key, err := apiKeyStore.FindKeyByHash(hashAPIKey(secret))
+	if err != nil {
+		return nil, fmt.Errorf("invalid API key")
+	}
+	if !key.Enabled {
+		return nil, fmt.Errorf("API key %q is disabled", key.Name)
+	}
+	return key, nil
+}
+
+// requestCredential returns the bearer token or X-API-Key header of a request
+func requestCredential(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// writeUnauthorized sends a 401 with a bearer challenge
+func writeUnauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="go-ip-subnet-calculator"`)
+	writeJSONError(w, http.StatusUnauthorized, message)
+}
+
+// requireAPIKey authenticates the JSON API. /api/v1/admin/ needs the admin token;
+// other /api/ paths need an enabled API key when GO_SUBNET_CALCULATOR_API_AUTH=required.
+// A key that is presented is always checked; its tenant and role apply to the request
+// and its name becomes the actor in the audit log
+func requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		credential := requestCredential(r)
+
+		if strings.HasPrefix(r.URL.Path, "/api/v1/admin/") {
+			if adminToken == "" {
+				writeJSONError(w, http.StatusForbidden, "admin API is disabled; set GO_SUBNET_CALCULATOR_ADMIN_TOKEN")
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(credential), []byte(adminToken)) != 1 {
+				writeUnauthorized(w, "admin token required")
+				return
+			}
+			next.ServeHTTP(w, withPrincipal(r, &Principal{Name: "admin", Tenant: allTenants, Role: RoleAdmin}))
+			return
+		}
+
+		if credential == "" {
+			if apiAuthRequired {
+				writeUnauthorized(w, "API key required")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		key, err := authenticateAPIKey(credential)
+		if err != nil {
+			writeUnauthorized(w, err.Error())
+			return
+		}
+		next.ServeHTTP(w, withPrincipal(r, &Principal{Name: "apikey:" + key.Name, Tenant: key.Tenant, Role: key.Role}))
+	})
+}
+
+// APIKeyRequest creates a key or changes its name, tenant, role or state
+type APIKeyRequest struct {
+	Name    string `json:"name"`
+	Tenant  string `json:"tenant,omitempty"`
+	Role    string `json:"role,omitempty"`
+	Enabled *bool  `json:"enabled,omitempty"`
+}
+
+// CreatedAPIKey is returned once when a key is issued; Key is the secret
+type CreatedAPIKey struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+// apiKeysHandler serves GET (list) and POST (create) /api/v1/admin/keys
+func apiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := apiKeyStore.ListKeys()
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, keys)
+	case http.MethodPost:
+		var req APIKeyRequest
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		key, secret, err := createAPIKey(req.Name, req.Tenant, req.Role)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		recordAudit(r, "apikey.create", apiKeyTarget(key), "%s in tenant %s", key.Role, key.Tenant)
+		writeJSON(w, http.StatusCreated, CreatedAPIKey{APIKey: key, Key: secret})
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// apiKeyHandler serves GET, PATCH and DELETE /api/v1/admin/keys/{id}
+func apiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		key, err := apiKeyStore.GetKey(id)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, key)
+	case http.MethodPatch:
+		var req APIKeyRequest
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		key, err := apiKeyStore.GetKey(id)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		if name := strings.TrimSpace(req.Name); name != "" {
+			key.Name = name
+		}
+		if req.Enabled != nil {
+			key.Enabled = *req.Enabled
+		}
+		if err := setKeyGrant(key, req.Tenant, req.Role); err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		if err := apiKeyStore.UpdateKey(key); err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		recordAudit(r, "apikey.update", apiKeyTarget(key), "enabled %t, %s in tenant %s", key.Enabled, key.Role, key.Tenant)
+		writeJSON(w, http.StatusOK, key)
+	case http.MethodDelete:
+		key, err := apiKeyStore.GetKey(id)
+		if err == nil {
+			err = apiKeyStore.DeleteKey(id)
+		}
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		recordAudit(r, "apikey.delete", apiKeyTarget(key), "")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PATCH, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func apiKeyTarget(k *APIKey) string {
+	return fmt.Sprintf("apikey/%d %s", k.ID, k.Name)
+}
+
+// runAPIKeyCommand implements the apikey subcommand:
+//
+//	apikey create [-tenant T] [-role R] <name> | list | enable <id> | disable <id> | delete <id>
+//
+// It works on the storage configured through the environment, so keys created here
+// are seen by the server
+func runAPIKeyCommand(args []string, output io.Writer) int {
+	usage := func() int {
+		fmt.Fprintln(output, "usage: apikey create [-tenant T] [-role R] <name> | list | enable <id> | disable <id> | delete <id>")
+		return 2
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+	if err := configureStorage(); err != nil {
+		fmt.Fprintf(output, "apikey: %v\n", err)
+		return 1
+	}
+	if storageDB == nil && args[0] != "list" {
+		log.Printf("Warning: in-memory storage, the change is lost when this command exits")
+	}
+	cliAudit := func(action string, key *APIKey) {
+		appendAudit(context.Background(), &AuditEntry{Actor: "cli", Action: action, Target: apiKeyTarget(key)})
+	}
+
+	var id int64
+	if len(args) == 2 && args[0] != "create" {
+		var err error
+		if id, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+			fmt.Fprintf(output, "apikey: invalid id %q\n", args[1])
+			return 2
+		}
+	}
+
+	switch {
+	case args[0] == "create":
+		fs := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		fs.SetOutput(output)
+		tenant := fs.String("tenant", defaultTenant, "tenant the key works in, or * for all tenants")
+		role := fs.String("role", string(RoleViewer), "viewer, operator or admin")
+		if err := fs.Parse(args[1:]); err != nil || fs.NArg() == 0 {
+			return usage()
+		}
+		key, secret, err := createAPIKey(strings.Join(fs.Args(), " "), *tenant, *role)
+		if err != nil {
+			fmt.Fprintf(output, "apikey: %v\n", err)
+			return 1
+		}
+		cliAudit("apikey.create", key)
+		fmt.Fprintf(output, "Created API key %d (%s, %s in tenant %s). Store it now, it cannot be shown again:\n%s\n", key.ID, key.Name, key.Role, key.Tenant, secret)
+	case args[0] == "list" && len(args) == 1:
+		keys, err := apiKeyStore.ListKeys()
+		if err != nil {
+			fmt.Fprintf(output, "apikey: %v\n", err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tTENANT\tROLE\tPREFIX\tENABLED\tCREATED")
+		for _, k := range keys {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s...\t%t\t%s\n", k.ID, k.Name, k.Tenant, k.Role, k.Prefix, k.Enabled, k.CreatedAt.Format(time.RFC3339))
+		}
+		tw.Flush()
+	case (args[0] == "enable" || args[0] == "disable") && len(args) == 2:
+		key, err := setAPIKeyEnabled(id, args[0] == "enable")
+		if err != nil {
+			fmt.Fprintf(output, "apikey: key %d: %v\n", id, err)
+			return 1
+		}
+		cliAudit("apikey.update", key)
+		fmt.Fprintf(output, "API key %d (%s) %sd\n", key.ID, key.Name, args[0])
+	case args[0] == "delete" && len(args) == 2:
+		key, err := apiKeyStore.GetKey(id)
+		if err == nil {
+			err = apiKeyStore.DeleteKey(id)
+		}
+		if err != nil {
+			fmt.Fprintf(output, "apikey: key %d: %v\n", id, err)
+			return 1
+		}
+		cliAudit("apikey.delete", key)
+		fmt.Fprintf(output, "API key %d (%s) deleted\n", key.ID, key.Name)
+	default:
+		return usage()
+	}
+	return 0
+}
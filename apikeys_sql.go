@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func init() {
+	registerMigration(sqlMigration{
+		Version: 4,
+		Name:    "create api keys",
+		Up: []string{
+			`CREATE TABLE api_keys (
+				id {{id}},
+				name TEXT NOT NULL,
+				prefix TEXT NOT NULL,
+				hash TEXT NOT NULL UNIQUE,
+				enabled INTEGER NOT NULL DEFAULT 1,
+				created_at TEXT NOT NULL
+			)`,
+		},
+	})
+	// keys from before roles existed keep their full access
+	registerMigration(sqlMigration{
+		Version: 6,
+		Name:    "add tenant and role to api keys",
+		Up: []string{
+			`ALTER TABLE api_keys ADD COLUMN tenant TEXT NOT NULL DEFAULT '*'`,
+			`ALTER TABLE api_keys ADD COLUMN role TEXT NOT NULL DEFAULT 'admin'`,
+		},
+	})
+}
+
+// sqlAPIKeyStore keeps API key hashes in a SQL database
+type sqlAPIKeyStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func newSQLAPIKeyStore(db *sql.DB, dialect sqlDialect) *sqlAPIKeyStore {
+	return &sqlAPIKeyStore{db: db, dialect: dialect}
+}
+
+const apiKeyColumns = "id, name, tenant, role, prefix, hash, enabled, created_at"
+
+func scanAPIKey(row scanner) (*APIKey, error) {
+	var k APIKey
+	var enabled int
+	var created string
+	if err := row.Scan(&k.ID, &k.Name, &k.Tenant, &k.Role, &k.Prefix, &k.Hash, &enabled, &created); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errIPAMNotFound
+		}
+		return nil, err
+	}
+	k.Enabled = enabled != 0
+	k.CreatedAt, _ = time.Parse(time.RFC3339Nano, created)
+	return &k, nil
+}
+
+// sqlBool stores a flag in the portable INTEGER column
+func sqlBool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (s *sqlAPIKeyStore) ListKeys() ([]*APIKey, error) {
+	rows, err := s.db.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []*APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, k)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlAPIKeyStore) GetKey(id int64) (*APIKey, error) {
+	return scanAPIKey(s.db.QueryRow(s.dialect.rebind("SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?"), id))
+}
+
+func (s *sqlAPIKeyStore) FindKeyByHash(hash string) (*APIKey, error) {
+	return scanAPIKey(s.db.QueryRow(s.dialect.rebind("SELECT "+apiKeyColumns+" FROM api_keys WHERE hash = ?"), hash))
+}
+
+func (s *sqlAPIKeyStore) CreateKey(k *APIKey) error {
+	k.CreatedAt = time.Now().UTC()
+	return s.db.QueryRow(s.dialect.rebind("INSERT INTO api_keys (name, tenant, role, prefix, hash, enabled, created_at) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id"),
+		k.Name, k.Tenant, k.Role, k.Prefix, k.Hash, sqlBool(k.Enabled), sqlTime(k.CreatedAt)).Scan(&k.ID)
+}
+
+func (s *sqlAPIKeyStore) UpdateKey(k *APIKey) error {
+	return execOne(s.db, s.dialect, "UPDATE api_keys SET name = ?, tenant = ?, role = ?, enabled = ? WHERE id = ?", k.Name, k.Tenant, k.Role, sqlBool(k.Enabled), k.ID)
+}
+
+func (s *sqlAPIKeyStore) DeleteKey(id int64) error {
+	return execOne(s.db, s.dialect, "DELETE FROM api_keys WHERE id = ?", id)
+}
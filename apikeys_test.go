@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// withTestAPIKeys gives a test an empty key store and restores the auth settings afterwards
+func withTestAPIKeys(t *testing.T, required bool, admin string) {
+	t.Helper()
+	previousStore, previousRequired, previousAdmin := apiKeyStore, apiAuthRequired, adminToken
+	apiKeyStore, apiAuthRequired, adminToken = newMemoryAPIKeyStore(), required, admin
+	t.Cleanup(func() { apiKeyStore, apiAuthRequired, adminToken = previousStore, previousRequired, previousAdmin })
+}
+
+func TestCreateAndAuthenticateAPIKey(t *testing.T) {
+	withTestAPIKeys(t, true, "")
+
+	key, secret, err := createAPIKey(" ci pipeline ", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Name != "ci pipeline" || !key.Enabled || !strings.HasPrefix(secret, apiKeyPrefix) || len(secret) != len(apiKeyPrefix)+43 {
+		t.Errorf("createAPIKey() = %+v, %q", key, secret)
+	}
+	if key.Hash == secret || key.Hash != hashAPIKey(secret) || !strings.HasPrefix(secret, key.Prefix) {
+		t.Errorf("key must store the hash and a short prefix only: %+v", key)
+	}
+	if _, other, _ := createAPIKey("other", "", ""); other == secret {
+		t.Error("keys must be random")
+	}
+
+	if got, err := authenticateAPIKey(secret); err != nil || got.ID != key.ID {
+		t.Errorf("authenticateAPIKey() = %+v, %v", got, err)
+	}
+	for _, bad := range []string{"", "gsc_wrong", secret[len(apiKeyPrefix):]} {
+		if _, err := authenticateAPIKey(bad); err == nil {
+			t.Errorf("authenticateAPIKey(%q) expected error", bad)
+		}
+	}
+
+	if _, err := setAPIKeyEnabled(key.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authenticateAPIKey(secret); err == nil || !strings.Contains(err.Error(), "disabled") {
+		t.Errorf("disabled key error = %v", err)
+	}
+	if _, _, err := createAPIKey("  ", "", ""); err == nil {
+		t.Error("createAPIKey() without a name should fail")
+	}
+}
+
+func TestConfigureAPIAuth(t *testing.T) {
+	withTestAPIKeys(t, false, "")
+	withTestAudit(t)
+
+	t.Setenv("GO_SUBNET_CALCULATOR_API_AUTH", "required")
+	t.Setenv("GO_SUBNET_CALCULATOR_ADMIN_TOKEN", "s3cret")
+	if err := configureAPIAuth(); err != nil || !apiAuthRequired || adminToken != "s3cret" {
+		t.Errorf("configureAPIAuth() = %v, required %t, admin %q", err, apiAuthRequired, adminToken)
+	}
+	t.Setenv("GO_SUBNET_CALCULATOR_API_AUTH", "sometimes")
+	if err := configureAPIAuth(); err == nil {
+		t.Error("configureAPIAuth() should reject an unknown mode")
+	}
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	var actor string
+	handler := requireAPIKey(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor = requestActor(r)
+	}))
+
+	tests := []struct {
+		name       string
+		required   bool
+		admin      string
+		path       string
+		header     string
+		value      string
+		wantStatus int
+		wantActor  string
+	}{
+		{"non-API path is open", true, "", "/", "", "", 200, "anonymous"},
+		{"API open by default", false, "", "/api/v1/calculate", "", "", 200, "anonymous"},
+		{"API key required", true, "", "/api/v1/calculate", "", "", 401, ""},
+		{"bearer key", true, "", "/api/v1/calculate", "Authorization", "Bearer KEY", 200, "apikey:ci"},
+		{"X-API-Key header", true, "", "/api/v1/calculate", "X-API-Key", "KEY", 200, "apikey:ci"},
+		{"presented key is checked when optional", false, "", "/api/v1/calculate", "X-API-Key", "gsc_nope", 401, ""},
+		{"presented key names the actor when optional", false, "", "/api/v1/calculate", "Authorization", "bearer KEY", 200, "apikey:ci"},
+		{"disabled key", true, "", "/api/v1/calculate", "X-API-Key", "DISABLED", 401, ""},
+		{"admin disabled", false, "", "/api/v1/admin/keys", "Authorization", "Bearer root", 403, ""},
+		{"admin token", false, "root", "/api/v1/admin/keys", "Authorization", "Bearer root", 200, "admin"},
+		{"API key is not an admin token", true, "root", "/api/v1/admin/keys", "Authorization", "Bearer KEY", 401, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTestAPIKeys(t, tt.required, tt.admin)
+			_, secret, _ := createAPIKey("ci", "", "")
+			disabled, disabledSecret, _ := createAPIKey("old", "", "")
+			setAPIKeyEnabled(disabled.ID, false)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				value := strings.Replace(tt.value, "DISABLED", disabledSecret, 1)
+				req.Header.Set(tt.header, strings.Replace(value, "KEY", secret, 1))
+			}
+			actor = ""
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus || actor != tt.wantActor {
+				t.Errorf("status %d actor %q, want %d %q: %s", rr.Code, actor, tt.wantStatus, tt.wantActor, rr.Body)
+			}
+			if rr.Code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestAPIKeyAdminEndpoints(t *testing.T) {
+	withTestAPIKeys(t, true, "root")
+	store := withTestAudit(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/admin/keys", apiKeysHandler)
+	mux.HandleFunc("/api/v1/admin/keys/{id}", apiKeyHandler)
+	mux.HandleFunc("/api/v1/calculate", calculateHandler)
+	server := requireAPIKey(mux)
+
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(http.MethodPost, "/api/v1/admin/keys", "root", `{"name": "monitoring"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", rr.Code, rr.Body)
+	}
+	var created CreatedAPIKey
+	json.NewDecoder(bytes.NewReader(rr.Body.Bytes())).Decode(&created)
+	stored, _ := apiKeyStore.GetKey(1)
+	if created.Key == "" || created.APIKey == nil || created.ID != 1 || strings.Contains(rr.Body.String(), stored.Hash) {
+		t.Fatalf("create response = %s", rr.Body)
+	}
+
+	if rr = do(http.MethodGet, "/api/v1/calculate?ip=10.0.0.1&mask=/24", created.Key, ""); rr.Code != http.StatusOK {
+		t.Errorf("calculate with the new key = %d", rr.Code)
+	}
+	rr = do(http.MethodGet, "/api/v1/admin/keys", "root", "")
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), created.Key) || !strings.Contains(rr.Body.String(), created.Prefix) {
+		t.Errorf("list = %d %s; the secret must never be listed", rr.Code, rr.Body)
+	}
+
+	if rr = do(http.MethodPatch, "/api/v1/admin/keys/1", "root", `{"enabled": false}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"enabled":false`) {
+		t.Errorf("disable = %d %s", rr.Code, rr.Body)
+	}
+	if rr = do(http.MethodGet, "/api/v1/calculate?ip=10.0.0.1&mask=/24", created.Key, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("calculate with a disabled key = %d, want 401", rr.Code)
+	}
+	if rr = do(http.MethodPatch, "/api/v1/admin/keys/1", "root", `{"name": "metrics", "enabled": true}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"metrics"`) {
+		t.Errorf("re-enable = %d %s", rr.Code, rr.Body)
+	}
+
+	if rr = do(http.MethodDelete, "/api/v1/admin/keys/1", "root", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("delete = %d", rr.Code)
+	}
+	if rr = do(http.MethodGet, "/api/v1/admin/keys/1", "root", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("get deleted key = %d, want 404", rr.Code)
+	}
+	if rr = do(http.MethodPost, "/api/v1/admin/keys", "root", `{"name": ""}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("create without a name = %d, want 400", rr.Code)
+	}
+	if rr = do(http.MethodPut, "/api/v1/admin/keys/1", "root", `{}`); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT = %d, want 405", rr.Code)
+	}
+
+	list, _ := store.List(AuditFilter{Action: "apikey", Limit: 10})
+	if len(list) != 4 || list[0].Action != "apikey.delete" || list[0].Actor != "admin" {
+		t.Errorf("api key audit = %+v", list)
+	}
+}
+
+func TestRunAPIKeyCommand(t *testing.T) {
+	withTestAPIKeys(t, false, "")
+	withTestAudit(t)
+	withTestIPAM(t)
+	t.Setenv("GO_SUBNET_CALCULATOR_DB_DRIVER", "memory")
+
+	run := func(args ...string) (int, string) {
+		var out bytes.Buffer
+		code := runAPIKeyCommand(args, &out)
+		return code, out.String()
+	}
+
+	code, out := run("create", "backup", "job")
+	if code != 0 || !strings.Contains(out, "Created API key 1 (backup job, viewer in tenant default)") || !strings.Contains(out, apiKeyPrefix) {
+		t.Fatalf("create = %d %q", code, out)
+	}
+	if code, out = run("create", "-tenant", "netops", "-role", "operator", "deploy"); code != 0 || !strings.Contains(out, "operator in tenant netops") {
+		t.Errorf("create with a grant = %d %q", code, out)
+	}
+	if code, out = run("create", "-role", "root", "deploy"); code != 1 {
+		t.Errorf("create with an unknown role = %d %q, want 1", code, out)
+	}
+	if code, out = run("disable", "1"); code != 0 || !strings.Contains(out, "disabled") {
+		t.Errorf("disable = %d %q", code, out)
+	}
+	code, out = run("list")
+	if code != 0 || !strings.Contains(out, "backup job") || !strings.Contains(out, "false") {
+		t.Errorf("list = %d %q", code, out)
+	}
+	if code, out = run("enable", "1"); code != 0 || !strings.Contains(out, "enabled") {
+		t.Errorf("enable = %d %q", code, out)
+	}
+	if code, _ = run("delete", "1"); code != 0 {
+		t.Errorf("delete = %d", code)
+	}
+	if code, _ = run("delete", "1"); code != 1 {
+		t.Errorf("delete of a missing key = %d, want 1", code)
+	}
+
+	for _, args := range [][]string{{}, {"create"}, {"create", "-tenant"}, {"rotate", "1"}, {"enable", "x"}, {"list", "extra"}} {
+		if code, _ := run(args...); code != 2 {
+			t.Errorf("runAPIKeyCommand(%v) = %d, want 2", args, code)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// asnTimeout bounds the DNS queries of one Team Cymru origin lookup
+const asnTimeout = 3 * time.Second
+
+// BGPOrigin is the autonomous system announcing a public address and the announced
+// prefix. MoreSpecific flags a calculated subnet that is only part of the
+// announcement, so it is not routed on its own on the internet
+type BGPOrigin struct {
+	ASN          uint32 `json:"asn"`
+	ASName       string `json:"as_name,omitempty"`
+	Prefix       string `json:"prefix"`
+	Country      string `json:"country,omitempty"`
+	Registry     string `json:"registry,omitempty"`
+	MoreSpecific bool   `json:"more_specific"`
+}
+
+// originSource finds the origin of an address, returning nil for unrouted addresses
+type originSource interface {
+	Origin(ctx context.Context, ip net.IP) (*BGPOrigin, error)
+}
+
+// txtResolver looks up TXT records; *net.Resolver implements it
+type txtResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// cymruOrigins queries the IP to ASN mapping of Team Cymru over DNS: the origin.asn
+// zone gives the AS and announced prefix, the asn zone the name of the AS
+type cymruOrigins struct {
+	resolver txtResolver
+}
+
+// cymruFields splits a Team Cymru answer such as "15169 | 8.8.8.0/24 | US | arin | 2014-03-14"
+func cymruFields(txt string) []string {
+	fields := strings.Split(txt, "|")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+func (c *cymruOrigins) Origin(ctx context.Context, ip net.IP) (*BGPOrigin, error) {
+	ctx, cancel := context.WithTimeout(ctx, asnTimeout)
+	defer cancel()
+	ip = ip.To4()
+	name := fmt.Sprintf("%d.%d.%d.%d.origin.asn.cymru.com", ip[3], ip[2], ip[1], ip[0])
+	records, err := c.resolver.LookupTXT(ctx, name)
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// an address announced in several prefixes is routed by the most specific one
+	var origin *BGPOrigin
+	bestLength := -1
+	for _, txt := range records {
+		fields := cymruFields(txt)
+		if len(fields) < 4 {
+			continue
+		}
+		network, err := parseIPv4Prefix(fields[1])
+		if err != nil {
+			continue
+		}
+		// several origin ASes of one prefix are separated by spaces; take the first
+		ases := strings.Fields(fields[0])
+		if len(ases) == 0 {
+			continue
+		}
+		asn, err := strconv.ParseUint(ases[0], 10, 32)
+		if err != nil {
+			continue
+		}
+		if ones, _ := network.Mask.Size(); ones > bestLength {
+			bestLength = ones
+			origin = &BGPOrigin{ASN: uint32(asn), Prefix: network.String(), Country: fields[2], Registry: fields[3]}
+		}
+	}
+	if origin == nil {
+		return nil, nil
+	}
+	if records, err := c.resolver.LookupTXT(ctx, fmt.Sprintf("AS%d.asn.cymru.com", origin.ASN)); err == nil && len(records) > 0 {
+		if fields := cymruFields(records[0]); len(fields) >= 5 {
+			origin.ASName = fields[4]
+		}
+	}
+	return origin, nil
+}
+
+// ip2asnEntry is one range of an ip2asn table
+type ip2asnEntry struct {
+	cidrset.Range
+	asn     uint32
+	country string
+	name    string
+}
+
+// ip2asnTable is a local ip2asn dump (https://iptoasn.com) held in memory, sorted by
+// range start. Ranges are not always single prefixes, so the announced prefix is the
+// prefix of the range that contains the address
+type ip2asnTable struct {
+	path    string
+	entries []ip2asnEntry
+}
+
+// loadIP2ASN reads an ip2asn-v4 file, tab-separated range_start, range_end, AS number,
+// country and AS description, optionally gzip-compressed. Ranges of AS 0 are not
+// routed and are left out
+func loadIP2ASN(path string) (*ip2asnTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	t := &ip2asnTable{path: path}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 5 || strings.TrimSpace(fields[0]) == "" {
+			continue
+		}
+		first, last := net.ParseIP(fields[0]).To4(), net.ParseIP(fields[1]).To4()
+		asn, err := strconv.ParseUint(fields[2], 10, 32)
+		if first == nil || last == nil || err != nil || ipToUint32(first) > ipToUint32(last) {
+			return nil, fmt.Errorf("%s line %d: invalid entry", path, line)
+		}
+		if asn == 0 {
+			continue
+		}
+		t.entries = append(t.entries, ip2asnEntry{
+			Range:   cidrset.Range{First: ipToUint32(first), Last: ipToUint32(last)},
+			asn:     uint32(asn),
+			country: fields[3],
+			name:    fields[4],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	sort.Slice(t.entries, func(i, j int) bool { return t.entries[i].First < t.entries[j].First })
+	return t, nil
+}
+
+func (t *ip2asnTable) Origin(ctx context.Context, ip net.IP) (*BGPOrigin, error) {
+	address := ipToUint32(ip)
+	i := sort.Search(len(t.entries), func(i int) bool { return t.entries[i].First > address }) - 1
+	if i < 0 || t.entries[i].Last < address {
+		return nil, nil
+	}
+	e := t.entries[i]
+	origin := &BGPOrigin{ASN: e.asn, ASName: e.name, Country: e.country}
+	for _, p := range cidrset.RangeToPrefixes(e.Range) {
+		if p.Contains(ip) {
+			origin.Prefix = p.String()
+			break
+		}
+	}
+	return origin, nil
+}
+
+// origins holds the origin source, nil unless GO_SUBNET_CALCULATOR_ASN_SOURCE is set.
+// A reload swaps it while requests are served, so it is read through loadOrigins
+var origins atomic.Pointer[originSource]
+
+// loadOrigins returns the current origin source, or nil
+func loadOrigins() originSource {
+	if source := origins.Load(); source != nil {
+		return *source
+	}
+	return nil
+}
+
+// storeOrigins replaces the origin source; nil disables origin lookups
+func storeOrigins(source originSource) {
+	if source == nil {
+		origins.Store(nil)
+		return
+	}
+	origins.Store(&source)
+}
+
+// configureASN reads GO_SUBNET_CALCULATOR_ASN_SOURCE: cymru for Team Cymru DNS lookups
+// or the path of a local ip2asn-v4 file. Origin lookups are off when it is not set.
+// DNS lookups go through the resolver of configurePTR, so it runs first
+func configureASN() error {
+	storeOrigins(nil)
+	switch source := os.Getenv("GO_SUBNET_CALCULATOR_ASN_SOURCE"); source {
+	case "":
+		recordSystemAudit("config.asn", "", "origin lookups disabled")
+	case "cymru":
+		resolver, ok := ptr.resolver.(txtResolver)
+		if !ok {
+			resolver = net.DefaultResolver
+		}
+		storeOrigins(&cymruOrigins{resolver: resolver})
+		recordSystemAudit("config.asn", source, "origin lookups through Team Cymru DNS")
+	default:
+		table, err := loadIP2ASN(source)
+		if err != nil {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_ASN_SOURCE: %v", err)
+		}
+		storeOrigins(table)
+		recordSystemAudit("config.asn", source, "origin lookups from %d ip2asn ranges", len(table.entries))
+	}
+	return nil
+}
+
+// lookupOrigin returns the BGP origin of a public address when origin lookups are
+// enabled, flagging a calculated network of ip and mask that is more specific than
+// the announcement. Failures are logged and return nil
+func lookupOrigin(ctx context.Context, address, mask string) *BGPOrigin {
+	ip := net.ParseIP(address)
+	source := loadOrigins()
+	if source == nil || !isPublicIPv4(ip) {
+		return nil
+	}
+	ctx, span := startSpan(ctx, "asn.lookup", spanKindClient)
+	origin, err := source.Origin(ctx, ip.To4())
+	span.End(err)
+	if err != nil {
+		logRequestf(ctx, "Origin lookup of %s failed: %v", address, err)
+		return nil
+	}
+	if origin == nil {
+		return nil
+	}
+	if subnetMask, err := parseSubnetMask(mask); err == nil {
+		announced, _ := parseIPv4Prefix(origin.Prefix)
+		ones, _ := subnetMask.Size()
+		announcedOnes, _ := announced.Mask.Size()
+		origin.MoreSpecific = ones > announcedOnes
+	}
+	return origin
+}
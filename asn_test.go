@@ -0,0 +1,106 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeTXTResolver answers TXT lookups from a map and reports other names as not found
+type fakeTXTResolver map[string][]string
+
+func (f fakeTXTResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if records, ok := f[name]; ok {
+		return records, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+// withTestOrigins looks origins up from source
+func withTestOrigins(t *testing.T, source originSource) {
+	t.Helper()
+	previous := loadOrigins()
+	storeOrigins(source)
+	t.Cleanup(func() { storeOrigins(previous) })
+}
+
+func TestCymruOrigins(t *testing.T) {
+	withTestOrigins(t, &cymruOrigins{resolver: fakeTXTResolver{
+		"8.8.8.8.origin.asn.cymru.com": {
+			"15169 | 8.8.0.0/16 | US | arin | 1992-12-01",
+			"15169 64512 | 8.8.8.0/24 | US | arin | 2023-12-28",
+		},
+		"AS15169.asn.cymru.com": {"15169 | US | arin | 2000-03-30 | GOOGLE, US"},
+	}})
+
+	want := BGPOrigin{ASN: 15169, ASName: "GOOGLE, US", Prefix: "8.8.8.0/24", Country: "US", Registry: "arin"}
+	if got := lookupOrigin(context.Background(), "8.8.8.8", "/24"); got == nil || *got != want {
+		t.Errorf("lookupOrigin(8.8.8.8/24) = %+v, want %+v", got, want)
+	}
+	if got := lookupOrigin(context.Background(), "8.8.8.8", "255.255.255.128"); got == nil || !got.MoreSpecific {
+		t.Errorf("lookupOrigin(8.8.8.8/25) = %+v, want more specific", got)
+	}
+	for _, address := range []string{"9.9.9.9", "10.0.0.1"} {
+		if got := lookupOrigin(context.Background(), address, "/24"); got != nil {
+			t.Errorf("lookupOrigin(%s) = %+v, want nil", address, got)
+		}
+	}
+}
+
+func TestIP2ASNTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ip2asn-v4.tsv.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte("1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+		"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n" +
+		"1.0.4.0\t1.0.7.255\t38803\tAU\tWPL-AS-AP Wirefreebroadband Pty Ltd\n" +
+		"1.0.8.0\t1.0.16.255\t64512\tCN\tODD-RANGE\n"))
+	gz.Close()
+	f.Close()
+	t.Setenv("GO_SUBNET_CALCULATOR_ASN_SOURCE", path)
+	withTestAudit(t)
+	withTestOrigins(t, nil)
+	if err := configureASN(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		address, mask string
+		want          *BGPOrigin
+	}{
+		{"1.0.0.1", "/24", &BGPOrigin{ASN: 13335, ASName: "CLOUDFLARENET", Prefix: "1.0.0.0/24", Country: "US"}},
+		{"1.0.5.9", "/24", &BGPOrigin{ASN: 38803, ASName: "WPL-AS-AP Wirefreebroadband Pty Ltd", Prefix: "1.0.4.0/22", Country: "AU", MoreSpecific: true}},
+		{"1.0.16.3", "/24", &BGPOrigin{ASN: 64512, ASName: "ODD-RANGE", Prefix: "1.0.16.0/24", Country: "CN"}},
+		{"1.0.2.1", "/24", nil},
+		{"1.0.17.1", "/24", nil},
+	}
+	for _, tt := range tests {
+		got := lookupOrigin(context.Background(), tt.address, tt.mask)
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("lookupOrigin(%s) = %+v, want %+v", tt.address, got, tt.want)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	calculateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=1.0.0.1&mask=/25", nil))
+	var result SubnetResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || result.Origin == nil || result.Origin.ASN != 13335 || !result.Origin.MoreSpecific {
+		t.Errorf("calculate origin = %+v, %v", result.Origin, err)
+	}
+
+	invalid := filepath.Join(t.TempDir(), "ip2asn-v4.tsv")
+	os.WriteFile(invalid, []byte("1.0.0.0\tnot-an-address\t13335\tUS\tX\n"), 0o644)
+	t.Setenv("GO_SUBNET_CALCULATOR_ASN_SOURCE", invalid)
+	if err := configureASN(); err == nil {
+		t.Error("expected an error for an invalid ip2asn entry")
+	}
+}
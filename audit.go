@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit limits for /api/v1/audit queries
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditEntry records who changed what and when. Entries are only ever appended
+type AuditEntry struct {
+	ID        int64     `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor"`
+	Source    string    `json:"source,omitempty"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target,omitempty"`
+	Details   string    `json:"details,omitempty"`
+}
+
+// AuditFilter selects audit entries. Action matches exactly or as a dotted prefix
+// ("pool" matches "pool.create"); Target matches as a substring
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Target string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+func (f AuditFilter) matches(e *AuditEntry) bool {
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action && !strings.HasPrefix(e.Action, f.Action+".") {
+		return false
+	}
+	if f.Target != "" && !strings.Contains(e.Target, f.Target) {
+		return false
+	}
+	if !f.Since.IsZero() && e.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Timestamp.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// AuditStore is an append-only store of audit entries. List returns the newest
+// entries first, at most filter.Limit of them
+type AuditStore interface {
+	Append(e *AuditEntry) error
+	List(filter AuditFilter) ([]*AuditEntry, error)
+}
+
+// memoryAuditStore keeps the audit log in memory; it is lost on restart
+type memoryAuditStore struct {
+	mu      sync.RWMutex
+	entries []AuditEntry
+}
+
+func newMemoryAuditStore() *memoryAuditStore {
+	return &memoryAuditStore{}
+}
+
+func (s *memoryAuditStore) Append(e *AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.ID = int64(len(s.entries)) + 1
+	s.entries = append(s.entries, *e)
+	return nil
+}
+
+func (s *memoryAuditStore) List(filter AuditFilter) ([]*AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*AuditEntry
+	for i := len(s.entries) - 1; i >= 0 && len(list) < filter.Limit; i-- {
+		if filter.matches(&s.entries[i]) {
+			e := s.entries[i]
+			list = append(list, &e)
+		}
+	}
+	return list, nil
+}
+
+// auditLog is the audit store behind /api/v1/audit
+var auditLog AuditStore = newMemoryAuditStore()
+
+// actorContextKey carries the authenticated identity of a request
+type actorContextKey struct{}
+
+// withActor returns a request carrying the given identity for the audit log
+func withActor(r *http.Request, actor string) *http.Request {
+	setAccessUser(r.Context(), actor)
+	return r.WithContext(context.WithValue(r.Context(), actorContextKey{}, actor))
+}
+
+// requestActor returns the identity attached to a request, or "anonymous"
+func requestActor(r *http.Request) string {
+	if actor, ok := r.Context().Value(actorContextKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return "anonymous"
+}
+
+// recordAudit appends an entry for a change made through a request. Failures are
+// logged; the change itself has already happened
+func recordAudit(r *http.Request, action, target, format string, args ...interface{}) {
+	appendAudit(r.Context(), &AuditEntry{Actor: requestActor(r), Source: clientAddress(r), Action: action, Target: target, Details: fmt.Sprintf(format, args...)})
+}
+
+// recordSystemAudit appends an entry for a change made by the application itself,
+// such as loading its configuration
+func recordSystemAudit(action, target, format string, args ...interface{}) {
+	appendAudit(context.Background(), &AuditEntry{Actor: "system", Action: action, Target: target, Details: fmt.Sprintf(format, args...)})
+}
+
+func appendAudit(ctx context.Context, e *AuditEntry) {
+	e.Timestamp = time.Now().UTC()
+	logInfof(ctx, "Audit: %s %s %s %s", e.Actor, e.Action, e.Target, e.Details)
+	if err := auditLog.Append(e); err != nil {
+		logRequestf(ctx, "Audit log write failed: %v", err)
+	}
+}
+
+// parseAuditFilter reads the actor, action, target, since, until and limit query parameters
+func parseAuditFilter(r *http.Request) (AuditFilter, error) {
+	q := r.URL.Query()
+	filter := AuditFilter{Actor: q.Get("actor"), Action: q.Get("action"), Target: q.Get("target"), Limit: defaultAuditLimit}
+	for name, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := q.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 timestamp such as 2024-01-31T00:00:00Z", name)
+			}
+			*dst = t
+		}
+	}
+	if value := q.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxAuditLimit)
+		}
+		filter.Limit = n
+	}
+	return filter, nil
+}
+
+// auditHandler serves GET /api/v1/audit, newest entries first. The log spans every
+// tenant, so only global admins may read it
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if err := requestPrincipal(r).checkGlobal(RoleAdmin); err != nil {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	entries, err := auditLog.List(filter)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []*AuditEntry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
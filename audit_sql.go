@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerMigration(sqlMigration{
+		Version: 3,
+		Name:    "create audit log",
+		Up: []string{
+			`CREATE TABLE audit_log (
+				id {{id}},
+				created_at TEXT NOT NULL,
+				actor TEXT NOT NULL,
+				source TEXT NOT NULL DEFAULT '',
+				action TEXT NOT NULL,
+				target TEXT NOT NULL DEFAULT '',
+				details TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE INDEX audit_log_action ON audit_log (action)`,
+		},
+	})
+}
+
+// sqlAuditStore appends audit entries to the audit_log table; it never updates or deletes rows
+type sqlAuditStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func newSQLAuditStore(db *sql.DB, dialect sqlDialect) *sqlAuditStore {
+	return &sqlAuditStore{db: db, dialect: dialect}
+}
+
+func (s *sqlAuditStore) Append(e *AuditEntry) error {
+	return s.db.QueryRow(s.dialect.rebind("INSERT INTO audit_log (created_at, actor, source, action, target, details) VALUES (?, ?, ?, ?, ?, ?) RETURNING id"),
+		sqlTime(e.Timestamp), e.Actor, e.Source, e.Action, e.Target, e.Details).Scan(&e.ID)
+}
+
+func (s *sqlAuditStore) List(filter AuditFilter) ([]*AuditEntry, error) {
+	var where []string
+	var args []interface{}
+	if filter.Actor != "" {
+		where = append(where, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		where = append(where, `(action = ? OR action LIKE ? ESCAPE '\')`)
+		args = append(args, filter.Action, escapeLike(filter.Action)+".%")
+	}
+	if filter.Target != "" {
+		where = append(where, `target LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(filter.Target)+"%")
+	}
+	// RFC 3339 timestamps in UTC sort lexically
+	if !filter.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, sqlTime(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, sqlTime(filter.Until))
+	}
+
+	query := "SELECT id, created_at, actor, source, action, target, details FROM audit_log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.Query(s.dialect.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []*AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var created string
+		if err := rows.Scan(&e.ID, &created, &e.Actor, &e.Source, &e.Action, &e.Target, &e.Details); err != nil {
+			return nil, err
+		}
+		e.Timestamp, _ = time.Parse(time.RFC3339Nano, created)
+		list = append(list, &e)
+	}
+	return list, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in a literal for LIKE ... ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
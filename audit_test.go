@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withTestAudit replaces the audit log with an empty in-memory store for the duration of a test
+func withTestAudit(t *testing.T) *memoryAuditStore {
+	t.Helper()
+	previous := auditLog
+	store := newMemoryAuditStore()
+	auditLog = store
+	t.Cleanup(func() { auditLog = previous })
+	return store
+}
+
+func TestMemoryAuditStore(t *testing.T) {
+	s := newMemoryAuditStore()
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	entries := []AuditEntry{
+		{Timestamp: base, Actor: "alice", Action: "pool.create", Target: "pool/1 10.0.0.0/16"},
+		{Timestamp: base.Add(time.Hour), Actor: "bob", Action: "allocation.create", Target: "allocation/2 10.0.1.0/24"},
+		{Timestamp: base.Add(2 * time.Hour), Actor: "alice", Action: "allocation.release", Target: "allocation/2 10.0.1.0/24"},
+		{Timestamp: base.Add(3 * time.Hour), Actor: "system", Action: "pools.rebuild"},
+	}
+	for i := range entries {
+		if err := s.Append(&entries[i]); err != nil || entries[i].ID != int64(i+1) {
+			t.Fatalf("Append() id = %d, %v", entries[i].ID, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   []int64
+	}{
+		{"all newest first", AuditFilter{}, []int64{4, 3, 2, 1}},
+		{"actor", AuditFilter{Actor: "alice"}, []int64{3, 1}},
+		{"action prefix", AuditFilter{Action: "allocation"}, []int64{3, 2}},
+		{"action prefix stops at a dot", AuditFilter{Action: "pool"}, []int64{1}},
+		{"exact action", AuditFilter{Action: "allocation.release"}, []int64{3}},
+		{"target", AuditFilter{Target: "10.0.1.0/24"}, []int64{3, 2}},
+		{"time window", AuditFilter{Since: base.Add(time.Hour), Until: base.Add(3 * time.Hour)}, []int64{3, 2}},
+		{"limit", AuditFilter{Limit: 1}, []int64{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.filter.Limit == 0 {
+				tt.filter.Limit = defaultAuditLimit
+			}
+			list, err := s.List(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int64
+			for _, e := range list {
+				got = append(got, e.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("List() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("List() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordAudit(t *testing.T) {
+	store := withTestAudit(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/ipam/pools", nil)
+	req.RemoteAddr = "192.0.2.10:51234"
+	recordAudit(req, "pool.create", "pool/1", "name %q", "dc1")
+	recordAudit(withActor(req, "alice"), "pool.delete", "pool/1", "")
+	recordSystemAudit("config.storage", "memory", "")
+
+	list, _ := store.List(AuditFilter{Limit: 10})
+	if len(list) != 3 {
+		t.Fatalf("recorded %d entries, want 3", len(list))
+	}
+	if e := list[2]; e.Actor != "anonymous" || e.Source != "192.0.2.10" || e.Details != `name "dc1"` || e.Timestamp.IsZero() {
+		t.Errorf("anonymous entry = %+v", e)
+	}
+	if list[1].Actor != "alice" {
+		t.Errorf("actor = %q, want alice", list[1].Actor)
+	}
+	if list[0].Actor != "system" || list[0].Source != "" {
+		t.Errorf("system entry = %+v", list[0])
+	}
+}
+
+func TestParseAuditFilter(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/audit?actor=bob&action=pool&target=10.0&since=2024-01-01T00:00:00Z&limit=5", nil)
+	f, err := parseAuditFilter(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Actor != "bob" || f.Action != "pool" || f.Target != "10.0" || f.Limit != 5 || f.Since.Year() != 2024 || !f.Until.IsZero() {
+		t.Errorf("parseAuditFilter() = %+v", f)
+	}
+
+	for _, query := range []string{"since=yesterday", "until=2024-13-01", "limit=0", "limit=5000", "limit=x"} {
+		if _, err := parseAuditFilter(httptest.NewRequest(http.MethodGet, "/api/v1/audit?"+query, nil)); err == nil {
+			t.Errorf("parseAuditFilter(%q) expected error", query)
+		}
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	withTestAudit(t)
+	withTestIPAM(t)
+
+	create := httptest.NewRequest(http.MethodPost, "/api/v1/ipam/pools", strings.NewReader(`{"name": "dc1", "prefix": "10.0.0.0/16"}`))
+	ipamPoolsHandler(httptest.NewRecorder(), withActor(create, "alice"))
+	allocate := httptest.NewRequest(http.MethodPost, "/api/v1/ipam/pools/1/allocations", strings.NewReader(`{"size": 24}`))
+	allocate.SetPathValue("id", "1")
+	ipamPoolAllocationsHandler(httptest.NewRecorder(), allocate)
+	release := httptest.NewRequest(http.MethodDelete, "/api/v1/ipam/allocations/2", nil)
+	release.SetPathValue("id", "2")
+	ipamAllocationHandler(httptest.NewRecorder(), release)
+	failed := httptest.NewRequest(http.MethodPost, "/api/v1/ipam/pools", strings.NewReader(`{"name": "dup", "prefix": "10.0.0.0/8"}`))
+	ipamPoolsHandler(httptest.NewRecorder(), failed)
+
+	get := func(query string) []AuditEntry {
+		rr := httptest.NewRecorder()
+		auditHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/audit"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d: %s", query, rr.Code, rr.Body)
+		}
+		var entries []AuditEntry
+		if err := json.NewDecoder(rr.Body).Decode(&entries); err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+
+	entries := get("")
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action+" "+e.Target)
+	}
+	want := "allocation.release allocation/2 10.0.0.0/24,allocation.create allocation/2 10.0.0.0/24,pool.create pool/1 10.0.0.0/16"
+	if strings.Join(actions, ",") != want {
+		t.Errorf("audit entries = %v, want %s (failed changes are not recorded)", actions, want)
+	}
+	if got := get("?actor=alice"); len(got) != 1 || got[0].Action != "pool.create" {
+		t.Errorf("filtered by actor = %+v", got)
+	}
+	if got := get("?action=allocation&limit=1"); len(got) != 1 || got[0].Action != "allocation.release" {
+		t.Errorf("filtered by action = %+v", got)
+	}
+	if got := get("?since=2999-01-01T00:00:00Z"); len(got) != 0 {
+		t.Errorf("future since = %+v, want an empty list", got)
+	}
+
+	rr := httptest.NewRecorder()
+	auditHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/audit?limit=-1", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid limit = %d, want 400", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	auditHandler(rr, httptest.NewRequest(http.MethodDelete, "/api/v1/audit", nil))
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "GET" {
+		t.Errorf("DELETE = %d, want 405; the audit log is append-only", rr.Code)
+	}
+}
+
+func TestIPAMImportAudit(t *testing.T) {
+	store := withTestAudit(t)
+	withTestIPAM(t)
+
+	post := func(target string) {
+		rr := httptest.NewRecorder()
+		ipamImportHandler(rr, httptest.NewRequest(http.MethodPost, target, strings.NewReader("prefix\n10.0.0.0/16\n10.0.1.0/24\n")))
+	}
+	post("/api/v1/ipam/import?dry_run=true")
+	if list, _ := store.List(AuditFilter{Limit: 10}); len(list) != 0 {
+		t.Fatalf("a dry run must not be audited: %+v", list)
+	}
+	post("/api/v1/ipam/import")
+	list, _ := store.List(AuditFilter{Limit: 10})
+	if len(list) != 3 || list[0].Action != "import.csv" || list[2].Action != "pool.create" || list[1].Action != "allocation.create" {
+		t.Errorf("import audit = %+v", list)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// basePath is the URL prefix the application is served under behind a path-routing
+// reverse proxy, such as /subnet-calc, without a trailing slash; empty at /
+var basePath string
+
+// templateFuncs are available to every page template; {{base}} prefixes links
+var templateFuncs = template.FuncMap{
+	"base": func() string { return basePath },
+}
+
+// configureBasePath reads GO_SUBNET_CALCULATOR_BASE_PATH, the URL prefix of every
+// route, link and form action
+func configureBasePath() error {
+	basePath = ""
+	value := os.Getenv("GO_SUBNET_CALCULATOR_BASE_PATH")
+	if value == "" {
+		return nil
+	}
+	if !strings.HasPrefix(value, "/") || strings.HasPrefix(value, "//") || strings.ContainsAny(value, "?#\\ ") {
+		return fmt.Errorf("GO_SUBNET_CALCULATOR_BASE_PATH must be a path such as /subnet-calc/, got %q", value)
+	}
+	basePath = strings.TrimRight(value, "/")
+	recordSystemAudit("config.base_path", basePath+"/", "serving under a URL prefix")
+	return nil
+}
+
+// sitePath returns the public URL path of a route of the application
+func sitePath(path string) string {
+	return basePath + path
+}
+
+// stripBasePath routes requests for the prefixed paths to the unprefixed routes.
+// Requests without the prefix, from proxies that strip it themselves, are served as
+// they are, and the bare prefix is redirected to the main page
+func stripBasePath(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := basePath
+		if prefix == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == prefix {
+			http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+			return
+		}
+		if rest, ok := strings.CutPrefix(r.URL.Path, prefix+"/"); ok {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = "/" + rest
+			r2.URL.RawPath, _ = strings.CutPrefix(r.URL.RawPath, prefix)
+			r = r2
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// withTestBasePath serves the application under prefix
+func withTestBasePath(t *testing.T, prefix string) {
+	t.Helper()
+	withTestAudit(t)
+	previous := basePath
+	t.Cleanup(func() { basePath = previous })
+	t.Setenv("GO_SUBNET_CALCULATOR_BASE_PATH", prefix)
+	if err := configureBasePath(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigureBasePath(t *testing.T) {
+	withTestBasePath(t, "/subnet-calc/")
+	if basePath != "/subnet-calc" || sitePath("/ipam") != "/subnet-calc/ipam" {
+		t.Errorf("basePath = %q", basePath)
+	}
+	for _, value := range []string{"subnet-calc", "//evil.example", "/a?b", "/a b"} {
+		t.Setenv("GO_SUBNET_CALCULATOR_BASE_PATH", value)
+		if err := configureBasePath(); err == nil {
+			t.Errorf("%q accepted", value)
+		}
+	}
+}
+
+func TestBasePathRoutesAndLinks(t *testing.T) {
+	withTestBasePath(t, "/subnet-calc")
+	withTestShareLinks(t)
+	originalReport := selfTestReport.Load()
+	defer selfTestReport.Store(originalReport)
+	selfTestReport.Store(&SelfTestReport{Passed: true})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler)
+	mux.HandleFunc("/api/v1/calculate", calculateHandler)
+	h := (&listener{}).handler(mux)
+	serve := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		if form != nil {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr
+	}
+
+	rr := serve(http.MethodGet, "/subnet-calc/", nil)
+	if body := rr.Body.String(); rr.Code != http.StatusOK || !strings.Contains(body, `action="/subnet-calc/"`) || strings.Contains(body, `action="/"`) {
+		t.Errorf("GET /subnet-calc/ = %d, links not prefixed", rr.Code)
+	}
+	if rr := serve(http.MethodGet, "/subnet-calc", nil); rr.Code != http.StatusMovedPermanently || rr.Header().Get("Location") != "/subnet-calc/" {
+		t.Errorf("GET /subnet-calc = %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr := serve(http.MethodGet, "/subnet-calc/api/v1/calculate?ip=10.0.0.1&mask=/8", nil); rr.Code != http.StatusOK {
+		t.Errorf("prefixed API call = %d", rr.Code)
+	}
+	if rr := serve(http.MethodGet, "/api/v1/calculate?ip=10.0.0.1&mask=/8", nil); rr.Code != http.StatusOK {
+		t.Errorf("API call with the prefix stripped by the proxy = %d", rr.Code)
+	}
+	rr = serve(http.MethodPost, "/subnet-calc/", url.Values{"action": {"share"}, "ip": {"10.0.0.1"}, "mask": {"/8"}})
+	if location := rr.Header().Get("Location"); rr.Code != http.StatusSeeOther || !strings.HasPrefix(location, "/subnet-calc/s/") {
+		t.Errorf("share redirect = %d %q", rr.Code, location)
+	}
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxBatchItems bounds the calculations of one batch request or upload
+	maxBatchItems = 10000
+	// maxBatchUploadBytes bounds the size of an uploaded CSV file
+	maxBatchUploadBytes = 1 << 20
+	// maxBatchBodyBytes bounds the JSON body of a batch request
+	maxBatchBodyBytes = 4 << 20
+	// maxNDJSONLineBytes bounds one line of NDJSON input; the number of lines is not limited
+	maxNDJSONLineBytes = 64 << 10
+	// ndjsonFlushEvery is how many items are calculated by one task of the worker pool,
+	// and how many streamed results are sent at a time
+	ndjsonFlushEvery = 100
+)
+
+// BatchItem is one calculation of a batch. Line is the line of an uploaded file it
+// came from, if any
+type BatchItem struct {
+	Line  int    `json:"line,omitempty"`
+	IP    string `json:"ip"`
+	Mask  string `json:"mask"`
+	Cloud string `json:"cloud,omitempty"`
+}
+
+// BatchResult is the outcome of one batch item: a result or the error that stopped it
+type BatchResult struct {
+	BatchItem
+	Result *SubnetResult `json:"result,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// BatchRequest is the JSON body of POST /api/v1/batch
+type BatchRequest struct {
+	Items []BatchItem `json:"items"`
+}
+
+// BatchResponse holds the results of a batch in the order of its items
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+	Count   int           `json:"count"`
+	Errors  int           `json:"errors"`
+}
+
+// calculateBatchItem calculates one item; a failing item never stops the batch
+func calculateBatchItem(item BatchItem) BatchResult {
+	var note string
+	item.IP, item.Mask, note = normalizeInput(item.IP, item.Mask)
+	item.Cloud = strings.TrimSpace(item.Cloud)
+	res := BatchResult{BatchItem: item}
+	if item.IP == "" || item.Mask == "" {
+		res.Error = "ip and mask are required"
+		return res
+	}
+	result, err := calculateCloudSubnet(item.IP, item.Mask, item.Cloud)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	result.IPAddress, result.SubnetMask, result.Normalization = item.IP, item.Mask, note
+	res.Result = result
+	return res
+}
+
+// calculateBatch calculates every item
+func calculateBatch(items []BatchItem) *BatchResponse {
+	resp, _ := calculateBatchJob(context.Background(), items, func(int, int) {})
+	return resp
+}
+
+// calculateBatchJob calculates every item on the batch worker pool, ndjsonFlushEvery
+// items per task, reporting progress as each task finishes and stopping when ctx is
+// canceled
+func calculateBatchJob(ctx context.Context, items []BatchItem, progress func(done, total int)) (*BatchResponse, error) {
+	resp := &BatchResponse{Results: make([]BatchResult, len(items)), Count: len(items)}
+	group := batchPool.group(ctx)
+	var mu sync.Mutex
+	done := 0
+	for start := 0; start < len(items); start += ndjsonFlushEvery {
+		end := min(start+ndjsonFlushEvery, len(items))
+		err := group.Go(func() {
+			errs := 0
+			for i := start; i < end; i++ {
+				if resp.Results[i] = calculateBatchItem(items[i]); resp.Results[i].Error != "" {
+					errs++
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Errors += errs
+			done += end - start
+			progress(done, len(items))
+		})
+		if err != nil {
+			break
+		}
+	}
+	group.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// parseBatchCSV reads ip,mask[,cloud] rows. A single column may hold a prefix such as
+// 10.0.0.1/24, a first row starting with "ip" is taken as a header, and blank lines
+// and lines starting with # are skipped. Malformed rows are kept so that their error
+// is reported with the other results
+func parseBatchCSV(r io.Reader) ([]BatchItem, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var items []BatchItem
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "ip") {
+			continue
+		}
+		if len(items) == maxBatchItems {
+			return nil, fmt.Errorf("more than %d rows", maxBatchItems)
+		}
+		line, _ := reader.FieldPos(0)
+		item := BatchItem{Line: line, IP: record[0]}
+		if len(record) > 1 {
+			item.Mask = record[1]
+		} else if ip, length, ok := strings.Cut(record[0], "/"); ok {
+			item.IP, item.Mask = ip, "/"+length
+		}
+		if len(record) > 2 {
+			item.Cloud = record[2]
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// batchColumns are the CSV columns of batch results: the input, the subnet in the
+// shared export schema and the error of rows that failed
+var batchColumns = append(append([]string{"line", "ip", "mask"}, subnetColumns...), "error")
+
+// batchCSVRecord returns a result in the order of batchColumns
+func batchCSVRecord(res BatchResult) []string {
+	record := []string{strconv.Itoa(res.Line), res.IP, res.Mask}
+	if res.Result != nil {
+		record = append(record, resultRow("", res.Result).fields()...)
+	} else {
+		record = append(record, make([]string, len(subnetColumns))...)
+	}
+	return append(record, res.Error)
+}
+
+// startBatchCSV sets the headers of a CSV download of batch results and writes its
+// header row
+func startBatchCSV(w http.ResponseWriter) *csv.Writer {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="batch-results.csv"`)
+	writer := csv.NewWriter(w)
+	writer.Write(batchColumns)
+	return writer
+}
+
+// writeBatchCSV sends batch results as a CSV download
+func writeBatchCSV(w http.ResponseWriter, results []BatchResult) {
+	writer := startBatchCSV(w)
+	for _, res := range results {
+		writer.Write(batchCSVRecord(res))
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("Batch CSV encoding error: %v", err)
+	}
+}
+
+// batchSource returns the items of a batch one at a time, then io.EOF. An item that
+// could not be read comes with the error to report in its place
+type batchSource func() (BatchItem, error)
+
+// ndjsonItems returns the items of an NDJSON body one line at a time, so the body is
+// never held in memory. Lines that are not a JSON item are reported as failed; the
+// item's line defaults to its line in the body
+func ndjsonItems(body io.Reader) batchSource {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), maxNDJSONLineBytes)
+	line, done := 0, false
+	return func() (BatchItem, error) {
+		for !done {
+			if !scanner.Scan() {
+				done = true
+				if err := scanner.Err(); err != nil {
+					return BatchItem{Line: line + 1}, fmt.Errorf("reading input: %v", err)
+				}
+				break
+			}
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			item, err := decodeBatchItem(text)
+			if err != nil {
+				return BatchItem{Line: line}, fmt.Errorf("invalid JSON: %v", err)
+			}
+			if item.Line == 0 {
+				item.Line = line
+			}
+			return item, nil
+		}
+		return BatchItem{}, io.EOF
+	}
+}
+
+// sliceItems returns items one at a time
+func sliceItems(items []BatchItem) batchSource {
+	return func() (BatchItem, error) {
+		if len(items) == 0 {
+			return BatchItem{}, io.EOF
+		}
+		item := items[0]
+		items = items[1:]
+		return item, nil
+	}
+}
+
+// batchChunk is a run of consecutive items of a streamed batch, with the error of
+// each item that could not be read, and once calculated their formatted results
+type batchChunk struct {
+	items []BatchItem
+	errs  []error
+	out   []byte
+	done  chan struct{}
+}
+
+// readBatchChunk refills chunk with up to ndjsonFlushEvery items of next and reports
+// whether it holds any
+func readBatchChunk(chunk *batchChunk, next batchSource) bool {
+	chunk.items, chunk.errs = chunk.items[:0], chunk.errs[:0]
+	for len(chunk.items) < ndjsonFlushEvery {
+		item, err := next()
+		if err == io.EOF {
+			break
+		}
+		chunk.items = append(chunk.items, item)
+		chunk.errs = append(chunk.errs, err)
+	}
+	return len(chunk.items) > 0
+}
+
+// appendBatchChunkNDJSON calculates the items of a chunk as NDJSON lines
+func appendBatchChunkNDJSON(dst []byte, chunk *batchChunk) []byte {
+	for i, item := range chunk.items {
+		if err := chunk.errs[i]; err != nil {
+			dst = appendBatchError(dst, item, err.Error())
+		} else {
+			dst = appendBatchLine(dst, item)
+		}
+	}
+	return dst
+}
+
+// appendBatchChunkCSV calculates the items of a chunk as CSV records
+func appendBatchChunkCSV(dst []byte, chunk *batchChunk) []byte {
+	buf := bytes.NewBuffer(dst)
+	writer := csv.NewWriter(buf)
+	for i, item := range chunk.items {
+		res := BatchResult{BatchItem: item}
+		if err := chunk.errs[i]; err != nil {
+			res.Error = err.Error()
+		} else {
+			res = calculateBatchItem(item)
+		}
+		writer.Write(batchCSVRecord(res))
+	}
+	writer.Flush()
+	return buf.Bytes()
+}
+
+// streamBatch calculates the items of next and writes the results as NDJSON or CSV.
+// Chunks of ndjsonFlushEvery items are calculated on the batch worker pool while
+// later ones are read, and written and flushed in order so clients see results as
+// they are computed. Reading waits while the job's share of the pool is busy and as
+// many chunks wait to be written, so memory stays bounded however slow the client.
+// It stops early when ctx is done or the client goes away
+func streamBatch(ctx context.Context, w http.ResponseWriter, format string, next batchSource) {
+	encode := appendBatchChunkNDJSON
+	if format == "csv" {
+		startBatchCSV(w).Flush()
+		encode = appendBatchChunkCSV
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	group := batchPool.group(ctx)
+	pending := make(chan *batchChunk, batchPool.perJob)
+	free := make(chan *batchChunk, 2*batchPool.perJob+1)
+	go func() {
+		defer close(pending)
+		for {
+			var chunk *batchChunk
+			select {
+			case chunk = <-free:
+			default:
+				chunk = &batchChunk{out: make([]byte, 0, 64<<10)}
+			}
+			if !readBatchChunk(chunk, next) {
+				return
+			}
+			chunk.done = make(chan struct{})
+			if group.Go(func() {
+				chunk.out = encode(chunk.out[:0], chunk)
+				close(chunk.done)
+			}) != nil {
+				return
+			}
+			pending <- chunk
+		}
+	}()
+
+	rc := http.NewResponseController(w)
+	failed := false
+	for chunk := range pending {
+		<-chunk.done
+		if !failed {
+			_, err := w.Write(chunk.out)
+			if err == nil {
+				if err = rc.Flush(); errors.Is(err, http.ErrNotSupported) {
+					err = nil
+				}
+			}
+			if err != nil {
+				failed = true
+				cancel()
+			}
+		}
+		select {
+		case free <- chunk:
+		default:
+		}
+	}
+	group.Wait()
+}
+
+// batchHandler serves POST /api/v1/batch. The body is a JSON BatchRequest, or with
+// Content-Type application/x-ndjson one item per line in any number. The results are
+// JSON, NDJSON or CSV; NDJSON and CSV are streamed as they are calculated, and are the
+// only outputs of NDJSON input, which defaults to NDJSON. With ?async=true a JSON batch
+// runs as a job and its BatchResponse is the job's result
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	async, ok := asyncRequested(w, r)
+	if !ok {
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/x-ndjson" {
+		if async {
+			writeJSONError(w, http.StatusBadRequest, "NDJSON input is streamed; send a JSON batch to run it as a job")
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		format := responseFormat(r, "ndjson")
+		if format != "ndjson" && format != "csv" {
+			writeJSONError(w, http.StatusBadRequest, "NDJSON input is answered with ndjson or csv")
+			return
+		}
+		streamBatch(r.Context(), w, format, ndjsonItems(r.Body))
+		return
+	}
+
+	var req BatchRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	if len(req.Items) > maxBatchItems {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d items per batch", maxBatchItems))
+		return
+	}
+	if async {
+		items := req.Items
+		submitJob(w, r, "batch", len(items), func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+			return calculateBatchJob(ctx, items, progress)
+		})
+		return
+	}
+	if format := responseFormat(r, "json"); format == "ndjson" || format == "csv" {
+		streamBatch(r.Context(), w, format, sliceItems(req.Items))
+		return
+	}
+	_, span := startSpan(r.Context(), "batch.calculate", spanKindInternal)
+	span.Set("batch.items", len(req.Items))
+	results := calculateBatch(req.Items)
+	span.End(nil)
+	writeJSON(w, http.StatusOK, results)
+}
+
+// BatchPage is the data behind the /batch upload page
+type BatchPage struct {
+	MaxItems int
+	MaxBytes int
+	Error    string
+}
+
+// readBatchUpload reads the items of the uploaded file, or of the pasted text when no
+// file was chosen
+func readBatchUpload(w http.ResponseWriter, r *http.Request) ([]BatchItem, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchUploadBytes+64<<10)
+	if err := r.ParseMultipartForm(maxBatchUploadBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, fmt.Errorf("the upload is larger than %d KiB", maxBatchUploadBytes>>10)
+		}
+		if err != http.ErrNotMultipart {
+			return nil, err
+		}
+	}
+
+	var input io.Reader = strings.NewReader(r.FormValue("csv"))
+	if file, header, err := r.FormFile("file"); err == nil {
+		defer file.Close()
+		if header.Size > maxBatchUploadBytes {
+			return nil, fmt.Errorf("the upload is larger than %d KiB", maxBatchUploadBytes>>10)
+		}
+		input = file
+	}
+	items, err := parseBatchCSV(input)
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV: %v", err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("the upload holds no rows")
+	}
+	return items, nil
+}
+
+// batchPageHandler serves the /batch page. A POST with a CSV file of ip,mask[,cloud]
+// rows returns a CSV of the results, reporting the error of every failing row
+func batchPageHandler(w http.ResponseWriter, r *http.Request) {
+	page := &BatchPage{MaxItems: maxBatchItems, MaxBytes: maxBatchUploadBytes >> 10}
+	if r.Method == http.MethodPost {
+		items, err := readBatchUpload(w, r)
+		if err == nil {
+			writeBatchCSV(w, calculateBatch(items).Results)
+			return
+		}
+		page.Error = err.Error()
+	}
+
+	tmpl, err := loadTemplate("batch.html")
+	if err != nil {
+		logRequestf(r.Context(), "Template loading error: %v", err)
+		http.Error(w, "Template loading error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if page.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := tmpl.Execute(w, page); err != nil {
+		logRequestf(r.Context(), "Template execution error: %v", err)
+	}
+}
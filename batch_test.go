@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseBatchCSV(t *testing.T) {
+	items, err := parseBatchCSV(strings.NewReader("ip,mask,cloud\n192.168.1.100,/24\n\n# comment\n10.0.1.77, 255.255.255.0, aws\n172.16.0.0/12\nbogus\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BatchItem{
+		{Line: 2, IP: "192.168.1.100", Mask: "/24"},
+		{Line: 5, IP: "10.0.1.77", Mask: "255.255.255.0", Cloud: "aws"},
+		{Line: 6, IP: "172.16.0.0", Mask: "/12"},
+		{Line: 7, IP: "bogus"},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("items = %+v, want %+v", items, want)
+	}
+	for i := range want {
+		if items[i] != want[i] {
+			t.Errorf("item %d = %+v, want %+v", i, items[i], want[i])
+		}
+	}
+
+	if _, err := parseBatchCSV(strings.NewReader(strings.Repeat("10.0.0.1,/24\n", maxBatchItems+1))); err == nil {
+		t.Error("expected an error for too many rows")
+	}
+}
+
+func TestCalculateBatch(t *testing.T) {
+	resp := calculateBatch([]BatchItem{
+		{IP: "192.168.1.100", Mask: "/24"},
+		{IP: "10.0.0.1", Mask: "/8", Cloud: "aws"},
+		{IP: "10.0.0.1"},
+	})
+	if resp.Count != 3 || resp.Errors != 2 {
+		t.Fatalf("count %d, errors %d", resp.Count, resp.Errors)
+	}
+	if resp.Results[0].Result == nil || resp.Results[0].Result.NetworkAddress != "192.168.1.0" {
+		t.Errorf("first result = %+v", resp.Results[0])
+	}
+	if !strings.Contains(resp.Results[1].Error, "between /16 and /28") || resp.Results[2].Error != "ip and mask are required" {
+		t.Errorf("errors = %q, %q", resp.Results[1].Error, resp.Results[2].Error)
+	}
+}
+
+func TestBatchHandler(t *testing.T) {
+	post := func(target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		batchHandler(rr, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		return rr
+	}
+
+	rr := post("/api/v1/batch", `{"items":[{"ip":"10.1.2.3","mask":"/16"},{"ip":"10.1.2.3","mask":"/40"}]}`)
+	var resp BatchResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("batch = %d %v", rr.Code, err)
+	}
+	if resp.Count != 2 || resp.Errors != 1 || resp.Results[0].Result.BroadcastAddress != "10.1.255.255" {
+		t.Errorf("response = %+v", resp)
+	}
+
+	rr = post("/api/v1/batch?format=csv", `{"items":[{"ip":"10.1.2.3","mask":"/16"},{"ip":"10.1.2.3","mask":"/40"}]}`)
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil || len(records) != 3 || len(records[1]) != len(batchColumns) {
+		t.Fatalf("csv = %v, %v", records, err)
+	}
+	if records[1][4] != "10.1.0.0/16" || records[2][len(batchColumns)-1] == "" {
+		t.Errorf("csv rows = %v", records[1:])
+	}
+
+	many := `{"items":[` + strings.TrimSuffix(strings.Repeat(`{"ip":"10.0.0.1","mask":"/24"},`, maxBatchItems+1), ",") + `]}`
+	if rr := post("/api/v1/batch", many); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized batch = %d, want 413", rr.Code)
+	}
+}
+
+func TestBatchPage(t *testing.T) {
+	upload := func(content string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "plan.csv")
+		fw.Write([]byte(content))
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/batch", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rr := httptest.NewRecorder()
+		batchPageHandler(rr, req)
+		return rr
+	}
+
+	rr := upload("ip,mask\n192.168.1.100,/24\n300.1.1.1,/24\n")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("upload = %d %s:\n%s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	records, _ := csv.NewReader(rr.Body).ReadAll()
+	if len(records) != 3 || records[1][0] != "2" || records[2][0] != "3" || !strings.Contains(records[2][len(batchColumns)-1], "invalid IP address") {
+		t.Errorf("results = %v", records)
+	}
+
+	if rr := upload(strings.Repeat("x", maxBatchUploadBytes+1)); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "larger than") {
+		t.Errorf("oversized upload = %d", rr.Code)
+	}
+	if rr := upload(""); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "no rows") {
+		t.Errorf("empty upload = %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(url.Values{"csv": {"10.0.0.0/30"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	batchPageHandler(rr, req)
+	if records, _ := csv.NewReader(rr.Body).ReadAll(); len(records) != 2 || records[1][4] != "10.0.0.0/30" {
+		t.Errorf("pasted rows = %v", records)
+	}
+
+	rr = httptest.NewRecorder()
+	batchPageHandler(rr, httptest.NewRequest(http.MethodGet, "/batch", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `type="file"`) {
+		t.Errorf("page = %d", rr.Code)
+	}
+}
+
+func TestBatchNDJSON(t *testing.T) {
+	post := func(target, contentType, accept, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		batchHandler(rr, req)
+		return rr
+	}
+	input := "{\"ip\":\"10.1.2.3\",\"mask\":\"/16\"}\n\n{not json}\n{\"ip\":\"10.1.2.3\",\"mask\":\"/40\",\"line\":99}\n{\"ip\":\"192.168.0.1\",\"mask\":\"/30\"}"
+
+	rr := post("/api/v1/batch", "application/x-ndjson; charset=utf-8", "", input)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("ndjson = %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var results []BatchResult
+	decoder := json.NewDecoder(rr.Body)
+	for decoder.More() {
+		var res BatchResult
+		if err := decoder.Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, res)
+	}
+	if len(results) != 4 {
+		t.Fatalf("results = %+v", results)
+	}
+	if results[0].Line != 1 || results[0].Result.NetworkAddress != "10.1.0.0" {
+		t.Errorf("first = %+v", results[0])
+	}
+	if results[1].Line != 3 || !strings.HasPrefix(results[1].Error, "invalid JSON") {
+		t.Errorf("malformed line = %+v", results[1])
+	}
+	if results[2].Line != 99 || results[2].Error == "" || results[3].Line != 5 || results[3].Result == nil {
+		t.Errorf("remaining = %+v", results[2:])
+	}
+
+	rr = post("/api/v1/batch?format=csv", "application/x-ndjson", "", input)
+	if records, err := csv.NewReader(rr.Body).ReadAll(); err != nil || len(records) != 5 || records[4][4] != "192.168.0.0/30" {
+		t.Errorf("ndjson to csv = %v, %v", records, err)
+	}
+	if rr := post("/api/v1/batch?format=json", "application/x-ndjson", "", input); rr.Code != http.StatusBadRequest {
+		t.Errorf("ndjson to json = %d, want 400", rr.Code)
+	}
+
+	rr = post("/api/v1/batch", "application/json", "application/x-ndjson", `{"items":[{"ip":"10.0.0.1","mask":"/8"},{"ip":"x","mask":"/8"}]}`)
+	if lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `"error"`) {
+		t.Errorf("json to ndjson = %q", lines)
+	}
+
+	rr = post("/api/v1/batch", "application/x-ndjson", "", `{"ip":"10.0.0.1","mask":"/8","cloud":"`+strings.Repeat("x", maxNDJSONLineBytes)+`"}`)
+	if !strings.Contains(rr.Body.String(), "reading input") {
+		t.Errorf("overlong line = %s", rr.Body.String())
+	}
+}
+
+// BenchmarkBatchNDJSON streams a large batch; memory per operation stays flat as the
+// batch grows because neither input nor output is buffered
+func BenchmarkBatchNDJSON(b *testing.B) {
+	input := strings.Repeat("{\"ip\":\"10.1.2.3\",\"mask\":\"/24\"}\n", 10000)
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/batch", strings.NewReader(input))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		batchHandler(httptest.NewRecorder(), req)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Streamed batches encode and decode their lines by hand: encoding/json costs several
+// allocations and most of the time of a calculation per line. Anything the fast paths
+// do not cover, such as escaped strings, unknown keys or cloud reservations, goes
+// through encoding/json, so the bytes read and written are the same either way
+
+// decodeBatchItem reads one NDJSON line. Flat objects of plain strings and a line
+// number are read with a single allocation for the line
+func decodeBatchItem(line []byte) (BatchItem, error) {
+	if item, ok := decodeBatchItemFast(line); ok {
+		return item, nil
+	}
+	var item BatchItem
+	err := json.Unmarshal(line, &item)
+	return item, err
+}
+
+// decodeBatchItemFast reads the keys of BatchItem from line, reporting false on any
+// input it does not handle
+func decodeBatchItemFast(line []byte) (item BatchItem, ok bool) {
+	s := string(line)
+	i := skipJSONSpace(s, 0)
+	if i == len(s) || s[i] != '{' {
+		return item, false
+	}
+	if i = skipJSONSpace(s, i+1); i < len(s) && s[i] == '}' {
+		return item, skipJSONSpace(s, i+1) == len(s)
+	}
+	for {
+		key, next, ok := plainJSONString(s, i)
+		if !ok {
+			return item, false
+		}
+		if i = skipJSONSpace(s, next); i == len(s) || s[i] != ':' {
+			return item, false
+		}
+		i = skipJSONSpace(s, i+1)
+		if key == "line" {
+			start := i
+			for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+				i++
+			}
+			// Leading zeros are invalid JSON and long numbers may overflow
+			if i == start || i-start > 9 || (s[start] == '0' && i-start > 1) {
+				return item, false
+			}
+			item.Line, _ = strconv.Atoi(s[start:i])
+		} else {
+			value, next, plain := plainJSONString(s, i)
+			if !plain {
+				return item, false
+			}
+			switch key {
+			case "ip":
+				item.IP = value
+			case "mask":
+				item.Mask = value
+			case "cloud":
+				item.Cloud = value
+			default:
+				return item, false
+			}
+			i = next
+		}
+		if i = skipJSONSpace(s, i); i == len(s) {
+			return item, false
+		}
+		switch s[i] {
+		case ',':
+			i = skipJSONSpace(s, i+1)
+		case '}':
+			return item, skipJSONSpace(s, i+1) == len(s)
+		default:
+			return item, false
+		}
+	}
+}
+
+// skipJSONSpace returns the index of the first byte at or after i that is not JSON
+// whitespace
+func skipJSONSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == '\r' || s[i] == '\n') {
+		i++
+	}
+	return i
+}
+
+// plainJSONString reads the string starting at s[i] when it holds only printable
+// ASCII without escapes, returning it and the index after its closing quote
+func plainJSONString(s string, i int) (string, int, bool) {
+	if i == len(s) || s[i] != '"' {
+		return "", 0, false
+	}
+	for j := i + 1; j < len(s); j++ {
+		switch c := s[j]; {
+		case c == '"':
+			return s[i+1 : j], j + 1, true
+		case c == '\\' || c < 0x20 || c >= 0x80:
+			return "", 0, false
+		}
+	}
+	return "", 0, false
+}
+
+// appendJSONString appends s as a JSON string, escaped as encoding/json does
+func appendJSONString(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x80 || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			quoted, _ := json.Marshal(s)
+			return append(dst, quoted...)
+		}
+	}
+	dst = append(dst, '"')
+	dst = append(dst, s...)
+	return append(dst, '"')
+}
+
+// appendBatchItem appends the fields of item that open a BatchResult object
+func appendBatchItem(dst []byte, item BatchItem) []byte {
+	dst = append(dst, '{')
+	if item.Line != 0 {
+		dst = append(dst, `"line":`...)
+		dst = strconv.AppendInt(dst, int64(item.Line), 10)
+		dst = append(dst, ',')
+	}
+	dst = append(dst, `"ip":`...)
+	dst = appendJSONString(dst, item.IP)
+	dst = append(dst, `,"mask":`...)
+	dst = appendJSONString(dst, item.Mask)
+	if item.Cloud != "" {
+		dst = append(dst, `,"cloud":`...)
+		dst = appendJSONString(dst, item.Cloud)
+	}
+	return dst
+}
+
+// appendBatchError appends a failed item as a line of NDJSON
+func appendBatchError(dst []byte, item BatchItem, message string) []byte {
+	dst = appendBatchItem(dst, item)
+	dst = append(dst, `,"error":`...)
+	dst = appendJSONString(dst, message)
+	return append(dst, "}\n"...)
+}
+
+// appendBatchLine calculates item and appends its result as a line of NDJSON, the
+// same bytes json.Encoder writes for calculateBatchItem(item). Items without a cloud
+// provider or shorthand address are calculated and formatted without allocating
+func appendBatchLine(dst []byte, item BatchItem) []byte {
+	entered := item
+	var note string
+	item.IP, item.Mask, note = normalizeInput(item.IP, item.Mask)
+	item.Cloud = strings.TrimSpace(item.Cloud)
+	if item.Cloud != "" || note != "" {
+		line, _ := json.Marshal(calculateBatchItem(entered))
+		return append(append(dst, line...), '\n')
+	}
+	if item.IP == "" || item.Mask == "" {
+		return appendBatchError(dst, item, "ip and mask are required")
+	}
+	b, err := computeSubnet(item.IP, item.Mask)
+	if err != nil {
+		return appendBatchError(dst, item, err.Error())
+	}
+
+	dst = appendBatchItem(dst, item)
+	dst = append(dst, `,"result":{"ip_address":`...)
+	dst = appendJSONString(dst, item.IP)
+	dst = append(dst, `,"subnet_mask":`...)
+	dst = appendJSONString(dst, item.Mask)
+	dst = append(dst, `,"network_address":"`...)
+	dst = b.network.AppendTo(dst)
+	dst = append(dst, `","broadcast_address":"`...)
+	dst = b.broadcast.AppendTo(dst)
+	if first, last, ok := b.hosts(); ok {
+		dst = append(dst, `","min_host_address":"`...)
+		dst = first.AppendTo(dst)
+		dst = append(dst, `","max_host_address":"`...)
+		dst = last.AppendTo(dst)
+	} else {
+		dst = append(dst, `","min_host_address":"N/A","max_host_address":"N/A`...)
+	}
+	dst = append(dst, `","usable_hosts":"`...)
+	dst = strconv.AppendUint(dst, usableHostCount(b.prefixLen), 10)
+	return append(dst, "\"}}\n"...)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeBatchItem(t *testing.T) {
+	for _, line := range []string{
+		`{"ip":"10.1.2.3","mask":"/24"}`,
+		` { "line" : 7 , "ip" : "10.1.2.3", "mask":"255.255.255.0","cloud":"aws" } `,
+		`{}`,
+		`{"line":0,"ip":"a","ip":"b"}`,
+		`{"IP":"10.1.2.3","Mask":"/24"}`,
+		`{"ip":"10.1.2.3","mask":"/24","comment":"ignored"}`,
+		`{"ip":"\u0031\u0030.1.2.3","mask":"/24"}`,
+		`{"ip":"é","mask":"/24"}`,
+		`{"ip":"10.1.2.3","mask":null}`,
+		`{"ip":"10.1.2.3","line":"5"}`,
+		`{"line":007}`,
+		`{"line":12345678901234567890}`,
+		`{"ip":"10.1.2.3",}`,
+		`{"ip":"10.1.2.3"} trailing`,
+		`not json`,
+	} {
+		var want BatchItem
+		wantErr := json.Unmarshal([]byte(line), &want)
+		got, err := decodeBatchItem([]byte(line))
+		if (err != nil) != (wantErr != nil) || got != want {
+			t.Errorf("decodeBatchItem(%s) = %+v, %v; encoding/json gives %+v, %v", line, got, err, want, wantErr)
+		}
+	}
+}
+
+func TestAppendBatchLine(t *testing.T) {
+	for _, item := range []BatchItem{
+		{Line: 3, IP: "192.168.1.100", Mask: "/24"},
+		{IP: " 10.0.0.1 ", Mask: "255.255.255.252"},
+		{IP: "10.0.0.1", Mask: "/31"},
+		{IP: "10.0.0.1", Mask: "/32"},
+		{IP: "0.0.0.0", Mask: "/0"},
+		{IP: "::ffff:10.1.2.3", Mask: "/30"},
+		{Line: 2, IP: "10.0.1.77", Mask: "/24", Cloud: "aws"},
+		{IP: "10.0.1.77", Mask: "/24", Cloud: "nope"},
+		{IP: "<script>", Mask: "/24"},
+		{IP: "10.0.0.1", Mask: "/33"},
+		{Line: 9, IP: "", Mask: "/24"},
+		{IP: "10.0.0.1\n\"é\"", Mask: "/24"},
+		{IP: "10/8"},
+		{IP: "172.16", Mask: "/12"},
+	} {
+		want, _ := json.Marshal(calculateBatchItem(item))
+		if got := appendBatchLine(nil, item); string(got) != string(want)+"\n" {
+			t.Errorf("appendBatchLine(%+v) =\n%s\nencoding/json gives\n%s", item, got, want)
+		}
+	}
+}
+
+func TestAppendBatchLineAllocations(t *testing.T) {
+	buf := make([]byte, 0, 512)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = appendBatchLine(buf[:0], BatchItem{Line: 1, IP: "10.1.2.3", Mask: "/24"})
+	})
+	if allocs != 0 {
+		t.Errorf("appendBatchLine allocates %v times per item", allocs)
+	}
+}
+
+func BenchmarkAppendBatchLine(b *testing.B) {
+	buf := make([]byte, 0, 512)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = appendBatchLine(buf[:0], BatchItem{Line: i + 1, IP: "10.1.2.3", Mask: "255.255.255.0"})
+	}
+}
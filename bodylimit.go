@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+const (
+	defaultMaxBodyBytes = 1 << 20
+	maxMaxBodyBytes     = 1 << 30
+)
+
+// maxBodyBytes bounds the body and the parsed form of a request
+var maxBodyBytes int64 = defaultMaxBodyBytes
+
+// ownBodyLimits are the routes that bound their bodies themselves: batch input and
+// address plan imports are larger than ordinary requests
+var ownBodyLimits = map[string]bool{
+	"/batch":              true,
+	"/api/v1/batch":       true,
+	"/api/v1/ipam/import": true,
+}
+
+// configureBodyLimit reads GO_SUBNET_CALCULATOR_MAX_BODY_BYTES, the largest request
+// body accepted (default 1 MiB)
+func configureBodyLimit() error {
+	maxBodyBytes = defaultMaxBodyBytes
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_MAX_BODY_BYTES"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 1 || n > maxMaxBodyBytes {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_MAX_BODY_BYTES must be a number of bytes from 1 to %d, got %q", maxMaxBodyBytes, value)
+		}
+		maxBodyBytes = n
+	}
+	recordSystemAudit("config.body_limit", "", "request bodies up to %d bytes", maxBodyBytes)
+	return nil
+}
+
+// writeBodyTooLarge answers 413 when err comes from a body over its limit
+func writeBodyTooLarge(w http.ResponseWriter, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d bytes", tooLarge.Limit))
+	return true
+}
+
+// limitBodies caps the body of every request routed by mux, except on the routes of
+// ownBodyLimits. Bodies announced as too large are refused right away; the body is
+// left unread, as JSON endpoints are often sent the form content type by curl -d
+func limitBodies(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); r.Body == nil || ownBodyLimits[pattern] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength > maxBodyBytes {
+			writeBodyTooLarge(w, &http.MaxBytesError{Limit: maxBodyBytes})
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parseFormBody parses the form of a page request, answering 413 and returning false
+// when the body is over its limit, so an oversized form is refused instead of read
+// as empty. Pages call it before reading their form
+func parseFormBody(w http.ResponseWriter, r *http.Request) bool {
+	return !writeBodyTooLarge(w, r.ParseForm())
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// withTestBodyLimit caps request bodies at limit bytes
+func withTestBodyLimit(t *testing.T, limit int64) {
+	t.Helper()
+	previous := maxBodyBytes
+	maxBodyBytes = limit
+	t.Cleanup(func() { maxBodyBytes = previous })
+}
+
+// chunked hides the length of body so that only reading it finds it too large
+type chunked struct{ io.Reader }
+
+func TestLimitBodies(t *testing.T) {
+	withTestBodyLimit(t, 64)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/deaggregate", deaggregateHandler)
+	mux.HandleFunc("/api/v1/calculate", calculateHandler)
+	mux.HandleFunc("/lpm", lpmPageHandler)
+	mux.HandleFunc("/api/v1/ipam/import", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		writeJSON(w, http.StatusOK, n)
+	})
+	h := limitBodies(mux, mux)
+
+	large := `{"prefix":"10.0.0.0/8","exclude":["` + strings.Repeat("10.1.0.0/16", 10) + `"]}`
+	form := url.Values{"table": {strings.Repeat("10.0.0.0/8 192.0.2.1\n", 10)}, "destination": {"10.1.1.1"}}.Encode()
+	tests := []struct {
+		name, path, contentType string
+		body                    io.Reader
+		status                  int
+	}{
+		{"small JSON", "/api/v1/deaggregate", "application/json", strings.NewReader(`{"prefix":"10.0.0.0/8","length":10}`), http.StatusOK},
+		{"announced JSON", "/api/v1/deaggregate", "application/json", strings.NewReader(large), http.StatusRequestEntityTooLarge},
+		{"streamed JSON", "/api/v1/deaggregate", "application/json", chunked{strings.NewReader(large)}, http.StatusRequestEntityTooLarge},
+		// curl -d sends JSON with the form content type
+		{"JSON as a form", "/api/v1/calculate", "application/x-www-form-urlencoded", strings.NewReader(`{"ip":"10.0.0.1","mask":"/24"}`), http.StatusOK},
+		{"streamed form", "/lpm", "application/x-www-form-urlencoded", chunked{strings.NewReader(form)}, http.StatusRequestEntityTooLarge},
+		{"own limit", "/api/v1/ipam/import", "text/csv", strings.NewReader(strings.Repeat("10.0.0.0/8\n", 100)), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, tt.body)
+			r.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.status, rr.Body.String())
+			}
+			if tt.status == http.StatusRequestEntityTooLarge {
+				var resp ErrorResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.Error != "request body is larger than 64 bytes" {
+					t.Errorf("error response = %q", rr.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestConfigureBodyLimit(t *testing.T) {
+	withTestAudit(t)
+	withTestBodyLimit(t, defaultMaxBodyBytes)
+	t.Setenv("GO_SUBNET_CALCULATOR_MAX_BODY_BYTES", "4096")
+	if err := configureBodyLimit(); err != nil || maxBodyBytes != 4096 {
+		t.Errorf("configureBodyLimit() = %v, limit %d", err, maxBodyBytes)
+	}
+	for _, value := range []string{"0", "-1", "1M", "2147483648"} {
+		t.Setenv("GO_SUBNET_CALCULATOR_MAX_BODY_BYTES", value)
+		if err := configureBodyLimit(); err == nil {
+			t.Errorf("%q accepted", value)
+		}
+	}
+}
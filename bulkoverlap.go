@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/bits"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// Relations between two overlapping prefixes; prefixes never overlap partially
+const (
+	relationEqual      = "equal"
+	relationAContainsB = "a_contains_b"
+	relationBContainsA = "b_contains_a"
+)
+
+// BulkOverlap is an overlap between a prefix of each input, with the line it came from
+type BulkOverlap struct {
+	ALine    int          `json:"a_line"`
+	A        netip.Prefix `json:"a"`
+	BLine    int          `json:"b_line"`
+	B        netip.Prefix `json:"b"`
+	Relation string       `json:"relation"`
+}
+
+// bulkOverlapHeader is the header of the CSV output. Its fields never need quoting,
+// so records are written without encoding/csv
+const bulkOverlapHeader = "a_line,a,b_line,b,relation\n"
+
+// appendBulkOverlapCSV appends o as a CSV record
+func appendBulkOverlapCSV(b []byte, o BulkOverlap) []byte {
+	b = strconv.AppendInt(b, int64(o.ALine), 10)
+	b = o.A.AppendTo(append(b, ','))
+	b = strconv.AppendInt(append(b, ','), int64(o.BLine), 10)
+	b = o.B.AppendTo(append(b, ','))
+	b = append(append(b, ','), o.Relation...)
+	return append(b, '\n')
+}
+
+// BulkOverlapStats summarizes a bulk overlap run
+type BulkOverlapStats struct {
+	APrefixes int
+	BPrefixes int
+	ASkipped  int
+	BSkipped  int
+	Matched   int // B prefixes that overlap at least one A prefix
+	Overlaps  int
+}
+
+// cidrLine is the line of the first occurrence of a prefix and whether it repeats
+type cidrLine struct {
+	line     int
+	repeated bool
+}
+
+// cidrLineIndex holds the prefixes of the indexed input by range; the lines of
+// repeated prefixes are kept aside
+type cidrLineIndex struct {
+	ranges *cidrset.Index[cidrLine]
+	repeat map[cidrset.Range][]int
+}
+
+// parseCIDRField reads the prefix at the start of a line of a CIDR list or export: the
+// first field up to a comma, semicolon or blank, optionally quoted. A bare address
+// stands for its /32. It reports false for lines without an IPv4 prefix, such as
+// comments, headers and IPv6 prefixes
+func parseCIDRField(line string) (cidrset.Range, bool) {
+	line = strings.TrimSpace(line)
+	if end := strings.IndexAny(line, ",; \t"); end >= 0 {
+		line = line[:end]
+	}
+	line = strings.Trim(line, `"'`)
+
+	var prefix netip.Prefix
+	var err error
+	if strings.Contains(line, "/") {
+		prefix, err = netip.ParsePrefix(line)
+	} else {
+		var addr netip.Addr
+		if addr, err = netip.ParseAddr(line); err == nil {
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+	}
+	if err != nil || !prefix.Addr().Is4() {
+		return cidrset.Range{}, false
+	}
+	first := addrToUint32(prefix.Masked().Addr())
+	return cidrset.Range{First: first, Last: first | uint32(uint64(1)<<(32-prefix.Bits())-1)}, true
+}
+
+// scanCIDRLines calls fn with the line number and range of every prefix in r and
+// returns the number of lines skipped for holding none. Blank lines are not counted
+func scanCIDRLines(r io.Reader, fn func(line int, rng cidrset.Range)) (int, error) {
+	scanner := bufio.NewScanner(r)
+	skipped := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		rng, ok := parseCIDRField(text)
+		if !ok {
+			skipped++
+			continue
+		}
+		fn(line, rng)
+	}
+	return skipped, scanner.Err()
+}
+
+// indexCIDRLines loads the prefixes of r into an interval index
+func indexCIDRLines(r io.Reader, stats *BulkOverlapStats) (*cidrLineIndex, error) {
+	index := &cidrLineIndex{ranges: cidrset.NewIndex[cidrLine](), repeat: map[cidrset.Range][]int{}}
+	skipped, err := scanCIDRLines(r, func(line int, rng cidrset.Range) {
+		stats.APrefixes++
+		if first, ok := index.ranges.Get(rng); ok {
+			if !first.repeated {
+				index.ranges.Insert(rng, cidrLine{line: first.line, repeated: true})
+			}
+			index.repeat[rng] = append(index.repeat[rng], line)
+			return
+		}
+		index.ranges.Insert(rng, cidrLine{line: line})
+	})
+	stats.ASkipped = skipped
+	return index, err
+}
+
+// rangePrefix returns the prefix of a range that is a single prefix
+func rangePrefix(r cidrset.Range) netip.Prefix {
+	return netip.PrefixFrom(uint32ToAddr(r.First), 32-bits.Len32(r.Last-r.First))
+}
+
+// bulkOverlaps indexes the prefixes of a and streams those of b against them, calling
+// emit for every overlapping pair as it is found. Memory grows with the size of a
+// only, so the smaller input should be a
+func bulkOverlaps(a, b io.Reader, emit func(BulkOverlap) error) (*BulkOverlapStats, error) {
+	stats := &BulkOverlapStats{}
+	index, err := indexCIDRLines(a, stats)
+	if err != nil {
+		return stats, err
+	}
+
+	var emitErr error
+	skipped, err := scanCIDRLines(b, func(line int, rng cidrset.Range) {
+		stats.BPrefixes++
+		if emitErr != nil {
+			return
+		}
+		found := index.ranges.Overlapping(rng)
+		if len(found) == 0 {
+			return
+		}
+		stats.Matched++
+		prefix := rangePrefix(rng)
+		for _, e := range found {
+			relation := relationBContainsA
+			switch {
+			case e.Range == rng:
+				relation = relationEqual
+			case e.Range.First <= rng.First && rng.Last <= e.Range.Last:
+				relation = relationAContainsB
+			}
+			o := BulkOverlap{A: rangePrefix(e.Range), B: prefix, BLine: line, Relation: relation}
+			o.ALine = e.Value.line
+			stats.Overlaps++
+			if emitErr = emit(o); emitErr != nil {
+				return
+			}
+			if !e.Value.repeated {
+				continue
+			}
+			for _, aLine := range index.repeat[e.Range] {
+				o.ALine = aLine
+				stats.Overlaps++
+				if emitErr = emit(o); emitErr != nil {
+					return
+				}
+			}
+		}
+	})
+	stats.BSkipped = skipped
+	if emitErr != nil {
+		return stats, emitErr
+	}
+	return stats, err
+}
+
+// openCIDRFile opens a CIDR list, with "-" standing for stdin
+func openCIDRFile(name string, stdin io.Reader) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(stdin), nil
+	}
+	return os.Open(name)
+}
+
+// runBulkOverlap implements the overlap subcommand, which reports every overlap between
+// the prefixes of two large CIDR lists as CSV or NDJSON, and a summary on stderr
+func runBulkOverlap(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("overlap", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "csv", "csv or ndjson")
+	output := fs.String("o", "-", "file to write the overlaps to, - for stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: overlap [-format csv|ndjson] [-o file] <a> <b>")
+		fmt.Fprintln(stderr, "Reports every pair of overlapping prefixes of a and b. a is held in memory and b is streamed, so pass the smaller list first; - reads stdin")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 || (*format != "csv" && *format != "ndjson") || (fs.Arg(0) == "-" && fs.Arg(1) == "-") {
+		fs.Usage()
+		return 2
+	}
+
+	a, err := openCIDRFile(fs.Arg(0), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "overlap: %v\n", err)
+		return 1
+	}
+	defer a.Close()
+	b, err := openCIDRFile(fs.Arg(1), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "overlap: %v\n", err)
+		return 1
+	}
+	defer b.Close()
+
+	out := stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(stderr, "overlap: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	buffered := bufio.NewWriterSize(out, 1<<16)
+
+	var emit func(BulkOverlap) error
+	if *format == "ndjson" {
+		encoder := json.NewEncoder(buffered)
+		emit = func(o BulkOverlap) error { return encoder.Encode(o) }
+	} else {
+		buffered.WriteString(bulkOverlapHeader)
+		var record []byte
+		emit = func(o BulkOverlap) error {
+			record = appendBulkOverlapCSV(record[:0], o)
+			_, err := buffered.Write(record)
+			return err
+		}
+	}
+
+	start := time.Now()
+	stats, err := bulkOverlaps(a, b, emit)
+	if flushErr := buffered.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "overlap: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stderr, "%d prefixes in %s, %d in %s: %d prefixes of %s overlap, %d overlapping pairs (%s)\n",
+		stats.APrefixes, fs.Arg(0), stats.BPrefixes, fs.Arg(1), stats.Matched, fs.Arg(1), stats.Overlaps, time.Since(start).Round(time.Millisecond))
+	if stats.ASkipped > 0 || stats.BSkipped > 0 {
+		fmt.Fprintf(stderr, "skipped lines without an IPv4 prefix: %d in %s, %d in %s\n", stats.ASkipped, fs.Arg(0), stats.BSkipped, fs.Arg(1))
+	}
+	return 0
+}
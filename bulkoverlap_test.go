@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+func TestParseCIDRField(t *testing.T) {
+	for line, want := range map[string]string{
+		"10.1.2.3/16":                         "10.1.0.0/16",
+		`"192.0.2.0/24",eu-west-1,vpc-1`:      "192.0.2.0/24",
+		"  198.51.100.7\tweb":                 "198.51.100.7/32",
+		"203.0.113.0/25; on-prem":             "203.0.113.0/25",
+		"0.0.0.0/0":                           "0.0.0.0/0",
+		"cidr,region":                         "",
+		"# comment":                           "",
+		"2001:db8::/32":                       "",
+		"10.0.0.0/33":                         "",
+		"::ffff:10.0.0.1":                     "",
+		"10.0.0.0/8 extra fields are ignored": "10.0.0.0/8",
+	} {
+		got := ""
+		if r, ok := parseCIDRField(line); ok {
+			got = rangePrefix(r).String()
+		}
+		if got != want {
+			t.Errorf("parseCIDRField(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestBulkOverlaps(t *testing.T) {
+	a := "cidr\n10.0.0.0/8\n192.168.1.0/24\n\n10.1.0.0/16\n10.0.0.0/8\n"
+	b := "10.1.2.0/24\n192.168.0.0/16\n172.16.0.0/12\nbogus\n10.1.0.0/16\n"
+
+	var got []string
+	stats, err := bulkOverlaps(strings.NewReader(a), strings.NewReader(b), func(o BulkOverlap) error {
+		got = append(got, fmt.Sprintf("%d %s %d %s %s", o.ALine, o.A, o.BLine, o.B, o.Relation))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("bulkOverlaps() unexpected error: %v", err)
+	}
+	want := []string{
+		"2 10.0.0.0/8 1 10.1.2.0/24 a_contains_b",
+		"6 10.0.0.0/8 1 10.1.2.0/24 a_contains_b",
+		"5 10.1.0.0/16 1 10.1.2.0/24 a_contains_b",
+		"3 192.168.1.0/24 2 192.168.0.0/16 b_contains_a",
+		"2 10.0.0.0/8 5 10.1.0.0/16 a_contains_b",
+		"6 10.0.0.0/8 5 10.1.0.0/16 a_contains_b",
+		"5 10.1.0.0/16 5 10.1.0.0/16 equal",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("bulkOverlaps() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if *stats != (BulkOverlapStats{APrefixes: 4, BPrefixes: 4, ASkipped: 1, BSkipped: 1, Matched: 3, Overlaps: 7}) {
+		t.Errorf("bulkOverlaps() stats = %+v", stats)
+	}
+}
+
+func TestBulkOverlapsMatchesPairwise(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	list := func(n int) ([]cidrset.Range, string) {
+		var ranges []cidrset.Range
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			p, _ := uint32ToAddr(0x0a000000 | rng.Uint32N(1<<24)).Prefix(12 + rng.IntN(21))
+			r, _ := parseCIDRField(p.String())
+			ranges = append(ranges, r)
+			fmt.Fprintln(&b, p)
+		}
+		return ranges, b.String()
+	}
+	aRanges, a := list(500)
+	bRanges, b := list(500)
+
+	want := 0
+	for _, ar := range aRanges {
+		for _, br := range bRanges {
+			if ar.First <= br.Last && br.First <= ar.Last {
+				want++
+			}
+		}
+	}
+	stats, err := bulkOverlaps(strings.NewReader(a), strings.NewReader(b), func(o BulkOverlap) error {
+		if !o.A.Overlaps(o.B) {
+			t.Errorf("reported %s and %s do not overlap", o.A, o.B)
+		}
+		return nil
+	})
+	if err != nil || stats.Overlaps != want {
+		t.Errorf("bulkOverlaps() = %d overlaps, %v; want %d", stats.Overlaps, err, want)
+	}
+}
+
+func TestRunBulkOverlap(t *testing.T) {
+	dir := t.TempDir()
+	aFile := filepath.Join(dir, "a.txt")
+	os.WriteFile(aFile, []byte("10.0.0.0/16\n"), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	code := runBulkOverlap([]string{aFile, "-"}, strings.NewReader("10.0.1.0/24\n192.0.2.0/24\n"), &stdout, &stderr)
+	if code != 0 || stdout.String() != "a_line,a,b_line,b,relation\n1,10.0.0.0/16,1,10.0.1.0/24,a_contains_b\n" {
+		t.Errorf("overlap csv: exit %d, %q (%s)", code, stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "1 prefixes of - overlap, 1 overlapping pairs") {
+		t.Errorf("overlap summary = %q", stderr.String())
+	}
+
+	out := filepath.Join(dir, "out.ndjson")
+	stdout.Reset()
+	code = runBulkOverlap([]string{"-format", "ndjson", "-o", out, "-", aFile}, strings.NewReader("10.0.0.0/8\n"), &stdout, &stderr)
+	data, _ := os.ReadFile(out)
+	if code != 0 || stdout.Len() != 0 || string(data) != `{"a_line":1,"a":"10.0.0.0/8","b_line":1,"b":"10.0.0.0/16","relation":"a_contains_b"}`+"\n" {
+		t.Errorf("overlap ndjson: exit %d, %q", code, data)
+	}
+
+	for _, args := range [][]string{{aFile}, {"-format", "xml", aFile, aFile}, {"-", "-"}} {
+		if code := runBulkOverlap(args, strings.NewReader(""), &stdout, &stderr); code != 2 {
+			t.Errorf("overlap %v: exit %d, want 2", args, code)
+		}
+	}
+	if code := runBulkOverlap([]string{aFile, filepath.Join(dir, "missing.txt")}, nil, &stdout, &stderr); code != 1 {
+		t.Errorf("overlap with a missing file: exit %d, want 1", code)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultCacheMaxAge = 5 * time.Minute
+
+// cacheMaxAge is how long clients and shared caches may reuse a deterministic result
+var cacheMaxAge = defaultCacheMaxAge
+
+// configureCache reads GO_SUBNET_CALCULATOR_CACHE_MAX_AGE, the max-age of GET
+// calculation responses (default 5m; 0 makes clients revalidate every time)
+func configureCache() error {
+	cacheMaxAge = defaultCacheMaxAge
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_CACHE_MAX_AGE"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 || d > 24*time.Hour {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_CACHE_MAX_AGE must be a duration of at most 24h, got %q", value)
+		}
+		cacheMaxAge = d
+	}
+	recordSystemAudit("config.cache", "", "calculation max-age %s", cacheMaxAge)
+	return nil
+}
+
+// bufferedResponse holds a response until its ETag is known
+type bufferedResponse struct {
+	w      http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.w.Header() }
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// etagMatches reports whether an If-None-Match header lists etag; weak validators
+// match too, as the comparison for GET is the weak one
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheable serves GET requests of handlers whose output depends only on the request:
+// successful responses get an ETag derived from their body and a Cache-Control
+// max-age, and a matching If-None-Match is answered with 304 Not Modified. Responses
+// to requests with credentials are only cached privately
+func cacheable(next http.HandlerFunc) http.HandlerFunc {
+	return withETag(next, false)
+}
+
+// revalidated is cacheable for handlers with side effects or output that changes over
+// time, such as calculations, which are recorded in the history and enriched with
+// RDAP, GeoIP, ASN and reputation data. Their responses are only cached privately and
+// must be revalidated, so the handler runs for every request and a client holding the
+// same body still gets 304 Not Modified
+func revalidated(next http.HandlerFunc) http.HandlerFunc {
+	return withETag(next, true)
+}
+
+// withETag implements cacheable and revalidated
+func withETag(next http.HandlerFunc, revalidate bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+		buf := &bufferedResponse{w: w}
+		next(buf, r)
+		if buf.status == 0 {
+			buf.status = http.StatusOK
+		}
+		if buf.status != http.StatusOK {
+			w.WriteHeader(buf.status)
+			w.Write(buf.body.Bytes())
+			return
+		}
+
+		sum := sha256.Sum256(buf.body.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Add("Vary", "Accept")
+		if w.Header().Get("Cache-Control") == "" {
+			scope := "public"
+			if revalidate || requestCredential(r) != "" {
+				scope = "private"
+			}
+			if revalidate {
+				w.Header().Set("Cache-Control", scope+", no-cache")
+			} else {
+				w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, int(cacheMaxAge.Seconds())))
+			}
+		}
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			for _, name := range []string{"Content-Type", "Content-Length", "Content-Disposition"} {
+				w.Header().Del(name)
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.body.Bytes())
+	}
+}
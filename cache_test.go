@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCacheable(t *testing.T) {
+	h := cacheable(normalizeHandler)
+	get := func(target, ifNoneMatch, apiKey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		if apiKey != "" {
+			r.Header.Set("X-API-Key", apiKey)
+		}
+		rr := httptest.NewRecorder()
+		h(rr, r)
+		return rr
+	}
+
+	first := get("/api/v1/ipv6/normalize?address=2001:db8::1", "", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || !strings.HasPrefix(etag, `"`) || first.Header().Get("Cache-Control") != "public, max-age=300" {
+		t.Fatalf("first response = %d %v", first.Code, first.Header())
+	}
+	if again := get("/api/v1/ipv6/normalize?address=2001:db8::1", "", ""); again.Header().Get("ETag") != etag || again.Body.String() != first.Body.String() {
+		t.Errorf("same calculation gave ETag %s, want %s", again.Header().Get("ETag"), etag)
+	}
+	if other := get("/api/v1/ipv6/normalize?address=2001:db8::2", "", ""); other.Header().Get("ETag") == etag {
+		t.Error("different calculations share an ETag")
+	}
+
+	for _, header := range []string{etag, `"other", W/` + etag, "*"} {
+		rr := get("/api/v1/ipv6/normalize?address=2001:db8::1", header, "")
+		if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 || rr.Header().Get("ETag") != etag || rr.Header().Get("Content-Type") != "" {
+			t.Errorf("If-None-Match %s = %d %v %q", header, rr.Code, rr.Header(), rr.Body.String())
+		}
+	}
+	if rr := get("/api/v1/ipv6/normalize?address=2001:db8::1", `"stale"`, ""); rr.Code != http.StatusOK || rr.Body.Len() == 0 {
+		t.Errorf("stale If-None-Match = %d", rr.Code)
+	}
+	if rr := get("/api/v1/ipv6/normalize?address=2001:db8::1", "", "gsc_key"); rr.Header().Get("Cache-Control") != "private, max-age=300" {
+		t.Errorf("Cache-Control with an API key = %q", rr.Header().Get("Cache-Control"))
+	}
+
+	rr := get("/api/v1/ipv6/normalize?address=2001:db8::g", "", "")
+	if rr.Code != http.StatusBadRequest || rr.Header().Get("ETag") != "" || rr.Header().Get("Cache-Control") != "" {
+		t.Errorf("error response = %d %v %s", rr.Code, rr.Header(), rr.Body.String())
+	}
+
+	post := httptest.NewRecorder()
+	h(post, httptest.NewRequest(http.MethodPost, "/api/v1/ipv6/normalize", strings.NewReader(`{"addresses":["2001:db8::1"]}`)))
+	if post.Code != http.StatusOK || post.Header().Get("ETag") != "" {
+		t.Errorf("POST = %d %v", post.Code, post.Header())
+	}
+}
+
+func TestRevalidated(t *testing.T) {
+	history := withTestHistory(t, 10)
+	h := revalidated(calculateHandler)
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=192.168.1.10&mask=/24", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		h(rr, r)
+		return rr
+	}
+
+	first := get("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Cache-Control") != "private, no-cache" {
+		t.Fatalf("first response = %d %v", first.Code, first.Header())
+	}
+	if rr := get(etag); rr.Code != http.StatusNotModified || rr.Header().Get("Cache-Control") != "private, no-cache" {
+		t.Errorf("revalidation = %d %v", rr.Code, rr.Header())
+	}
+	if got := history.List(10); len(got) != 2 {
+		t.Errorf("history has %d calculations, want one per request", len(got))
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// historySize is how many unnamed calculations are kept per owner; saved ones are kept
+// until deleted
+const historySize = 50
+
+// Calculation is a subnet calculation made by a signed-in user or an API key. History
+// entries have no name; saved calculations have one
+type Calculation struct {
+	ID        int64     `json:"id"`
+	Owner     string    `json:"-"`
+	Name      string    `json:"name,omitempty"`
+	IP        string    `json:"ip"`
+	Mask      string    `json:"mask"`
+	Cloud     string    `json:"cloud,omitempty"`
+	Network   string    `json:"network"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CalculationStore persists calculations. ListCalculations returns an owner's saved or
+// unnamed calculations, newest first; Get and Delete return errIPAMNotFound for unknown
+// ids. PruneHistory drops all but the newest keep unnamed calculations of an owner
+type CalculationStore interface {
+	ListCalculations(owner string, saved bool, limit int) ([]*Calculation, error)
+	GetCalculation(id int64) (*Calculation, error)
+	AddCalculation(c *Calculation) error
+	DeleteCalculation(id int64) error
+	PruneHistory(owner string, keep int) error
+}
+
+// memoryCalculationStore keeps calculations in memory; they are lost on restart
+type memoryCalculationStore struct {
+	mu           sync.RWMutex
+	nextID       int64
+	calculations map[int64]*Calculation
+}
+
+func newMemoryCalculationStore() *memoryCalculationStore {
+	return &memoryCalculationStore{calculations: map[int64]*Calculation{}}
+}
+
+// owned returns the saved or unnamed calculations of owner, newest first
+func (s *memoryCalculationStore) owned(owner string, saved bool) []*Calculation {
+	var list []*Calculation
+	for _, c := range s.calculations {
+		if c.Owner == owner && (c.Name != "") == saved {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list
+}
+
+func (s *memoryCalculationStore) ListCalculations(owner string, saved bool, limit int) ([]*Calculation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []*Calculation{}
+	for _, c := range s.owned(owner, saved) {
+		if len(list) == limit {
+			break
+		}
+		copied := *c
+		list = append(list, &copied)
+	}
+	return list, nil
+}
+
+func (s *memoryCalculationStore) GetCalculation(id int64) (*Calculation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.calculations[id]
+	if !ok {
+		return nil, errIPAMNotFound
+	}
+	copied := *c
+	return &copied, nil
+}
+
+func (s *memoryCalculationStore) AddCalculation(c *Calculation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	c.ID, c.CreatedAt = s.nextID, time.Now().UTC()
+	copied := *c
+	s.calculations[c.ID] = &copied
+	return nil
+}
+
+func (s *memoryCalculationStore) DeleteCalculation(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.calculations[id]; !ok {
+		return errIPAMNotFound
+	}
+	delete(s.calculations, id)
+	return nil
+}
+
+func (s *memoryCalculationStore) PruneHistory(owner string, keep int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	history := s.owned(owner, false)
+	for len(history) > keep {
+		delete(s.calculations, history[len(history)-1].ID)
+		history = history[:len(history)-1]
+	}
+	return nil
+}
+
+// calculationStore holds saved calculations and history; configureStorage switches it
+// to the database
+var calculationStore CalculationStore = newMemoryCalculationStore()
+
+// calculationOwner returns whom the calculations of a request belong to: the signed-in
+// user or the API key, or "" for anonymous requests, which keep no history
+func calculationOwner(r *http.Request) string {
+	if p, ok := r.Context().Value(principalContextKey{}).(*Principal); ok {
+		return p.Name
+	}
+	return ""
+}
+
+// recordCalculation stores a successful calculation in the owner's history, or under
+// a name when one is given, and trims the history to historySize entries
+func recordCalculation(owner, name string, result *SubnetResult) (*Calculation, error) {
+	c := &Calculation{
+		Owner:   owner,
+		Name:    strings.TrimSpace(name),
+		IP:      result.IPAddress,
+		Mask:    result.SubnetMask,
+		Cloud:   result.Cloud,
+		Network: result.NetworkAddress,
+	}
+	if len(c.Name) > 100 {
+		return nil, fmt.Errorf("name must be at most 100 characters")
+	}
+	if err := calculationStore.AddCalculation(c); err != nil {
+		return nil, err
+	}
+	if c.Name == "" {
+		return c, calculationStore.PruneHistory(owner, historySize)
+	}
+	return c, nil
+}
+
+// saveCalculation adds a result of the main page to the history of its owner and,
+// when the user gave a name, to the saved calculations
+func saveCalculation(result *SubnetResult, name string) {
+	if _, err := recordCalculation(result.Owner, "", result); err != nil {
+		log.Printf("Recording calculation for %s failed: %v", result.Owner, err)
+	}
+	if strings.TrimSpace(name) != "" {
+		if _, err := recordCalculation(result.Owner, name, result); err != nil {
+			log.Printf("Saving calculation for %s failed: %v", result.Owner, err)
+		}
+	}
+}
+
+// ownedCalculation returns a calculation of owner; those of others are not found
+func ownedCalculation(owner string, id int64) (*Calculation, error) {
+	c, err := calculationStore.GetCalculation(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Owner != owner {
+		return nil, errIPAMNotFound
+	}
+	return c, nil
+}
+
+// requireOwner writes a 401 for anonymous requests, which cannot keep calculations
+func requireOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	owner := calculationOwner(r)
+	if owner == "" {
+		writeUnauthorized(w, "sign in or use an API key to keep calculations")
+		return "", false
+	}
+	return owner, true
+}
+
+// SaveCalculationRequest saves a named calculation
+type SaveCalculationRequest struct {
+	Name  string `json:"name"`
+	IP    string `json:"ip"`
+	Mask  string `json:"mask"`
+	Cloud string `json:"cloud,omitempty"`
+}
+
+// calculationsHandler serves GET /api/v1/calculations, the saved calculations or with
+// ?history=true the recent ones, and POST to save a named calculation
+func calculationsHandler(w http.ResponseWriter, r *http.Request) {
+	owner, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		history, limit := false, historySize
+		if value := query.Get("history"); value != "" {
+			var err error
+			if history, err = strconv.ParseBool(value); err != nil {
+				writeJSONError(w, http.StatusBadRequest, "history must be true or false")
+				return
+			}
+		}
+		if value := query.Get("limit"); value != "" {
+			var err error
+			if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+				writeJSONError(w, http.StatusBadRequest, "limit must be a positive number")
+				return
+			}
+		}
+		list, err := calculationStore.ListCalculations(owner, !history, limit)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	case http.MethodPost:
+		var req SaveCalculationRequest
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			writeJSONError(w, http.StatusBadRequest, "name is required")
+			return
+		}
+		req.IP, req.Mask = strings.TrimSpace(req.IP), strings.TrimSpace(req.Mask)
+		result, err := calculateCloudSubnet(req.IP, req.Mask, req.Cloud)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		result.IPAddress, result.SubnetMask = req.IP, req.Mask
+		c, err := recordCalculation(owner, req.Name, result)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, c)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// calculationHandler serves GET and DELETE /api/v1/calculations/{id}
+func calculationHandler(w http.ResponseWriter, r *http.Request) {
+	owner, ok := requireOwner(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	c, err := ownedCalculation(owner, id)
+	if err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, c)
+	case http.MethodDelete:
+		if err := calculationStore.DeleteCalculation(id); err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
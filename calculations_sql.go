@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func init() {
+	registerMigration(sqlMigration{
+		Version: 7,
+		Name:    "create calculations",
+		Up: []string{
+			`CREATE TABLE calculations (
+				id {{id}},
+				owner TEXT NOT NULL,
+				name TEXT NOT NULL DEFAULT '',
+				ip TEXT NOT NULL,
+				mask TEXT NOT NULL,
+				cloud TEXT NOT NULL DEFAULT '',
+				network TEXT NOT NULL,
+				created_at TEXT NOT NULL
+			)`,
+			`CREATE INDEX calculations_owner ON calculations (owner)`,
+		},
+	})
+}
+
+// sqlCalculationStore keeps saved calculations and history in a SQL database
+type sqlCalculationStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func newSQLCalculationStore(db *sql.DB, dialect sqlDialect) *sqlCalculationStore {
+	return &sqlCalculationStore{db: db, dialect: dialect}
+}
+
+const calculationColumns = "id, owner, name, ip, mask, cloud, network, created_at"
+
+func scanCalculation(row scanner) (*Calculation, error) {
+	var c Calculation
+	var created string
+	if err := row.Scan(&c.ID, &c.Owner, &c.Name, &c.IP, &c.Mask, &c.Cloud, &c.Network, &created); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errIPAMNotFound
+		}
+		return nil, err
+	}
+	c.CreatedAt, _ = time.Parse(time.RFC3339Nano, created)
+	return &c, nil
+}
+
+func (s *sqlCalculationStore) ListCalculations(owner string, saved bool, limit int) ([]*Calculation, error) {
+	query := "SELECT " + calculationColumns + " FROM calculations WHERE owner = ? AND name = '' ORDER BY id DESC LIMIT ?"
+	if saved {
+		query = "SELECT " + calculationColumns + " FROM calculations WHERE owner = ? AND name <> '' ORDER BY id DESC LIMIT ?"
+	}
+	rows, err := s.db.Query(s.dialect.rebind(query), owner, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []*Calculation{}
+	for rows.Next() {
+		c, err := scanCalculation(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlCalculationStore) GetCalculation(id int64) (*Calculation, error) {
+	return scanCalculation(s.db.QueryRow(s.dialect.rebind("SELECT "+calculationColumns+" FROM calculations WHERE id = ?"), id))
+}
+
+func (s *sqlCalculationStore) AddCalculation(c *Calculation) error {
+	c.CreatedAt = time.Now().UTC()
+	return s.db.QueryRow(s.dialect.rebind("INSERT INTO calculations (owner, name, ip, mask, cloud, network, created_at) VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id"),
+		c.Owner, c.Name, c.IP, c.Mask, c.Cloud, c.Network, sqlTime(c.CreatedAt)).Scan(&c.ID)
+}
+
+func (s *sqlCalculationStore) DeleteCalculation(id int64) error {
+	return execOne(s.db, s.dialect, "DELETE FROM calculations WHERE id = ?", id)
+}
+
+func (s *sqlCalculationStore) PruneHistory(owner string, keep int) error {
+	_, err := s.db.Exec(s.dialect.rebind(`DELETE FROM calculations WHERE owner = ? AND name = '' AND id NOT IN (
+		SELECT id FROM calculations WHERE owner = ? AND name = '' ORDER BY id DESC LIMIT ?)`), owner, owner, keep)
+	return err
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// withTestCalculations gives a test an empty calculation store
+func withTestCalculations(t *testing.T) *memoryCalculationStore {
+	t.Helper()
+	previous := calculationStore
+	store := newMemoryCalculationStore()
+	calculationStore = store
+	t.Cleanup(func() { calculationStore = previous })
+	return store
+}
+
+func TestCalculationHistory(t *testing.T) {
+	withTestCalculations(t)
+
+	for i := 0; i < historySize+5; i++ {
+		result := &SubnetResult{IPAddress: fmt.Sprintf("10.0.%d.1", i), SubnetMask: "/24", NetworkAddress: fmt.Sprintf("10.0.%d.0", i)}
+		if _, err := recordCalculation("user:alice", "", result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result := &SubnetResult{IPAddress: "192.168.1.1", SubnetMask: "/24", NetworkAddress: "192.168.1.0"}
+	if _, err := recordCalculation("user:alice", " home lan ", result); err != nil {
+		t.Fatal(err)
+	}
+	recordCalculation("user:bob", "", result)
+
+	history, _ := calculationStore.ListCalculations("user:alice", false, 100)
+	if len(history) != historySize || history[0].IP != fmt.Sprintf("10.0.%d.1", historySize+4) || history[len(history)-1].IP != "10.0.5.1" {
+		t.Errorf("history has %d entries from %s to %s", len(history), history[0].IP, history[len(history)-1].IP)
+	}
+	if recent, _ := calculationStore.ListCalculations("user:alice", false, 3); len(recent) != 3 {
+		t.Errorf("limited history = %d entries", len(recent))
+	}
+	saved, _ := calculationStore.ListCalculations("user:alice", true, 100)
+	if len(saved) != 1 || saved[0].Name != "home lan" || saved[0].Network != "192.168.1.0" {
+		t.Errorf("saved = %+v", saved)
+	}
+
+	if _, err := ownedCalculation("user:bob", saved[0].ID); err != errIPAMNotFound {
+		t.Errorf("another user's calculation: %v, want not found", err)
+	}
+	if _, err := recordCalculation("user:alice", strings.Repeat("x", 101), result); err == nil {
+		t.Error("expected an error for an overlong name")
+	}
+}
+
+func TestCalculationsAPI(t *testing.T) {
+	withTestCalculations(t)
+	withTestAPIKeys(t, false, "")
+	withTestAudit(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/calculate", calculateHandler)
+	mux.HandleFunc("/api/v1/calculations", calculationsHandler)
+	mux.HandleFunc("/api/v1/calculations/{id}", calculationHandler)
+	h := requireAPIKey(mux)
+	_, alice, _ := createAPIKey("alice", "", "")
+	_, bob, _ := createAPIKey("bob", "", "")
+
+	if rr := apiCall(h, "", http.MethodGet, "/api/v1/calculations", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous list = %d, want 401", rr.Code)
+	}
+	apiCall(h, "", http.MethodGet, "/api/v1/calculate?ip=10.9.9.9&mask=/8", "")
+	apiCall(h, alice, http.MethodGet, "/api/v1/calculate?ip=10.1.2.3&mask=/16&cloud=aws", "")
+
+	rr := apiCall(h, alice, http.MethodPost, "/api/v1/calculations", `{"name":"office","ip":"172.16.5.4","mask":"255.255.255.0"}`)
+	var c Calculation
+	if err := json.NewDecoder(rr.Body).Decode(&c); err != nil || rr.Code != http.StatusCreated || c.Network != "172.16.5.0" {
+		t.Fatalf("save = %d %+v", rr.Code, c)
+	}
+	for _, body := range []string{`{"ip":"172.16.5.4","mask":"/24"}`, `{"name":"x","ip":"300.1.1.1","mask":"/24"}`} {
+		if rr := apiCall(h, alice, http.MethodPost, "/api/v1/calculations", body); rr.Code != http.StatusBadRequest {
+			t.Errorf("save %s = %d, want 400", body, rr.Code)
+		}
+	}
+
+	var list []Calculation
+	rr = apiCall(h, alice, http.MethodGet, "/api/v1/calculations", "")
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil || len(list) != 1 || list[0].Name != "office" {
+		t.Errorf("saved = %+v", list)
+	}
+	rr = apiCall(h, alice, http.MethodGet, "/api/v1/calculations?history=true", "")
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil || len(list) != 1 || list[0].IP != "10.1.2.3" || list[0].Cloud != "aws" {
+		t.Errorf("history = %+v", list)
+	}
+	if rr := apiCall(h, alice, http.MethodGet, "/api/v1/calculations?limit=0", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("limit=0 = %d, want 400", rr.Code)
+	}
+
+	path := "/api/v1/calculations/" + strconv.FormatInt(c.ID, 10)
+	if rr := apiCall(h, bob, http.MethodGet, path, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("other user's calculation = %d, want 404", rr.Code)
+	}
+	if rr := apiCall(h, bob, http.MethodDelete, path, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("deleting another user's calculation = %d, want 404", rr.Code)
+	}
+	if rr := apiCall(h, alice, http.MethodDelete, path, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("delete = %d, want 204", rr.Code)
+	}
+	if rr := apiCall(h, alice, http.MethodGet, path, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("deleted calculation = %d, want 404", rr.Code)
+	}
+}
+
+func TestMainPageCalculations(t *testing.T) {
+	withTestCalculations(t)
+	alice := &Principal{Name: "user:alice", Tenant: defaultTenant, Role: RoleViewer}
+
+	page := func(p *Principal, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if p != nil {
+			req = withPrincipal(req, p)
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	body := page(nil, url.Values{"ip": {"10.0.0.1"}, "mask": {"/24"}}).Body.String()
+	if strings.Contains(body, "save_as") || strings.Contains(body, "Recent Calculations") {
+		t.Error("anonymous visitors must not get a history")
+	}
+
+	body = page(alice, url.Values{"ip": {"10.0.0.1"}, "mask": {"/24"}, "save_as": {"lab"}}).Body.String()
+	if !strings.Contains(body, "save_as") || !strings.Contains(body, "Saved Calculations") || !strings.Contains(body, "Recent Calculations") {
+		t.Errorf("signed-in page must show saved and recent calculations:\n%s", body)
+	}
+	saved, _ := calculationStore.ListCalculations("user:alice", true, 10)
+	if recent, _ := calculationStore.ListCalculations("user:alice", false, 10); len(saved) != 1 || len(recent) != 1 {
+		t.Fatalf("saved = %d, recent = %d", len(saved), len(recent))
+	}
+
+	bob := &Principal{Name: "user:bob", Tenant: defaultTenant, Role: RoleViewer}
+	deleteForm := url.Values{"action": {"delete-calculation"}, "calculation": {strconv.FormatInt(saved[0].ID, 10)}}
+	page(bob, deleteForm)
+	if _, err := calculationStore.GetCalculation(saved[0].ID); err != nil {
+		t.Error("another user deleted a saved calculation")
+	}
+	if rr := page(alice, deleteForm); rr.Code != http.StatusSeeOther {
+		t.Errorf("delete = %d, want 303", rr.Code)
+	}
+	if _, err := calculationStore.GetCalculation(saved[0].ID); err == nil {
+		t.Error("saved calculation was not deleted")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// CheatsheetRow describes a single prefix length in the subnetting reference table
+type CheatsheetRow struct {
+	Prefix         int    `json:"prefix"`
+	SubnetMask     string `json:"subnet_mask"`
+	WildcardMask   string `json:"wildcard_mask"`
+	TotalAddresses uint64 `json:"total_addresses"`
+	UsableHosts    uint64 `json:"usable_hosts"`
+	SubnetsInA     uint64 `json:"subnets_in_class_a,omitempty"`
+	SubnetsInB     uint64 `json:"subnets_in_class_b,omitempty"`
+	SubnetsInC     uint64 `json:"subnets_in_class_c,omitempty"`
+}
+
+// classfulSubnets returns how many subnets of the given prefix length fit into
+// a classful network of the given boundary, or 0 if the prefix is shorter
+func classfulSubnets(prefixLen, boundary int) uint64 {
+	if prefixLen < boundary {
+		return 0
+	}
+	return uint64(1) << uint(prefixLen-boundary)
+}
+
+// buildCheatsheet generates the reference table for every prefix length from /0 to /32
+func buildCheatsheet() []CheatsheetRow {
+	rows := make([]CheatsheetRow, 0, 33)
+	for prefixLen := 0; prefixLen <= 32; prefixLen++ {
+		mask := net.CIDRMask(prefixLen, 32)
+
+		rows = append(rows, CheatsheetRow{
+			Prefix:         prefixLen,
+			SubnetMask:     net.IP(mask).String(),
+			WildcardMask:   wildcardMask(mask),
+			TotalAddresses: uint64(1) << uint(32-prefixLen),
+			UsableHosts:    usableHostCount(prefixLen),
+			SubnetsInA:     classfulSubnets(prefixLen, 8),
+			SubnetsInB:     classfulSubnets(prefixLen, 16),
+			SubnetsInC:     classfulSubnets(prefixLen, 24),
+		})
+	}
+	return rows
+}
+
+// cheatsheetColumns are the CSV and Markdown columns of the reference table
+var cheatsheetColumns = []string{"prefix", "subnet_mask", "wildcard_mask", "total_addresses", "usable_hosts",
+	"subnets_in_class_a", "subnets_in_class_b", "subnets_in_class_c"}
+
+// fields returns the row in the order of cheatsheetColumns
+func (row CheatsheetRow) fields() []string {
+	return []string{
+		"/" + strconv.Itoa(row.Prefix),
+		row.SubnetMask,
+		row.WildcardMask,
+		strconv.FormatUint(row.TotalAddresses, 10),
+		strconv.FormatUint(row.UsableHosts, 10),
+		strconv.FormatUint(row.SubnetsInA, 10),
+		strconv.FormatUint(row.SubnetsInB, 10),
+		strconv.FormatUint(row.SubnetsInC, 10),
+	}
+}
+
+// cheatsheetHandler serves the subnetting reference table as HTML, JSON, CSV or Markdown
+func cheatsheetHandler(w http.ResponseWriter, r *http.Request) {
+	rows := buildCheatsheet()
+
+	switch responseFormat(r, "html") {
+	case "json":
+		writeJSON(w, http.StatusOK, rows)
+
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="cheatsheet.csv"`)
+		writer := csv.NewWriter(w)
+		writer.Write(cheatsheetColumns)
+		for _, row := range rows {
+			writer.Write(row.fields())
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			log.Printf("Cheatsheet CSV encoding error: %v", err)
+		}
+
+	case "markdown":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		fields := make([][]string, 0, len(rows))
+		for _, row := range rows {
+			fields = append(fields, row.fields())
+		}
+		fmt.Fprint(w, "## Subnetting Cheatsheet\n\n")
+		writeMarkdownTable(w, cheatsheetColumns, fields)
+
+	case "html":
+		tmpl, err := loadTemplate("cheatsheet.html")
+		if err != nil {
+			logRequestf(r.Context(), "Template loading error: %v", err)
+			http.Error(w, "Template loading error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if err := tmpl.Execute(w, rows); err != nil {
+			logRequestf(r.Context(), "Template execution error: %v", err)
+			http.Error(w, "Template execution error", http.StatusInternalServerError)
+		}
+
+	default:
+		http.Error(w, "Unsupported format, use html, json, csv or markdown", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBuildCheatsheet(t *testing.T) {
+	rows := buildCheatsheet()
+	if len(rows) != 33 {
+		t.Fatalf("buildCheatsheet() returned %d rows, want 33", len(rows))
+	}
+
+	tests := []struct {
+		prefix   int
+		mask     string
+		wildcard string
+		total    uint64
+		usable   uint64
+		inA      uint64
+		inC      uint64
+	}{
+		{0, "0.0.0.0", "255.255.255.255", 4294967296, 4294967294, 0, 0},
+		{8, "255.0.0.0", "0.255.255.255", 16777216, 16777214, 1, 0},
+		{24, "255.255.255.0", "0.0.0.255", 256, 254, 65536, 1},
+		{30, "255.255.255.252", "0.0.0.3", 4, 2, 4194304, 64},
+		{31, "255.255.255.254", "0.0.0.1", 2, 0, 8388608, 128},
+		{32, "255.255.255.255", "0.0.0.0", 1, 0, 16777216, 256},
+	}
+
+	for _, tt := range tests {
+		row := rows[tt.prefix]
+		if row.SubnetMask != tt.mask || row.WildcardMask != tt.wildcard {
+			t.Errorf("/%d masks = %s/%s, want %s/%s", tt.prefix, row.SubnetMask, row.WildcardMask, tt.mask, tt.wildcard)
+		}
+		if row.TotalAddresses != tt.total || row.UsableHosts != tt.usable {
+			t.Errorf("/%d hosts = %d/%d, want %d/%d", tt.prefix, row.TotalAddresses, row.UsableHosts, tt.total, tt.usable)
+		}
+		if row.SubnetsInA != tt.inA || row.SubnetsInC != tt.inC {
+			t.Errorf("/%d classful subnets = %d/%d, want %d/%d", tt.prefix, row.SubnetsInA, row.SubnetsInC, tt.inA, tt.inC)
+		}
+	}
+}
+
+func TestCheatsheetMatchesCalculator(t *testing.T) {
+	for _, row := range buildCheatsheet() {
+		result, err := calculateSubnet("10.0.0.1", "/"+strconv.Itoa(row.Prefix))
+		if err != nil {
+			t.Fatalf("calculateSubnet() unexpected error: %v", err)
+		}
+		if result.UsableHosts != strconv.FormatUint(row.UsableHosts, 10) {
+			t.Errorf("/%d usable hosts = %s in calculator, %d in cheatsheet", row.Prefix, result.UsableHosts, row.UsableHosts)
+		}
+	}
+}
+
+func TestCheatsheetHandlerFormats(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		accept      string
+		contentType string
+		wantStatus  int
+	}{
+		{"html default", "/cheatsheet", "", "text/html", http.StatusOK},
+		{"json query", "/cheatsheet?format=json", "", "application/json", http.StatusOK},
+		{"json accept", "/cheatsheet", "application/json", "application/json", http.StatusOK},
+		{"csv query", "/cheatsheet?format=csv", "", "text/csv", http.StatusOK},
+		{"unknown format", "/cheatsheet?format=xml", "", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			cheatsheetHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if tt.contentType != "" && !strings.HasPrefix(rr.Header().Get("Content-Type"), tt.contentType) {
+				t.Errorf("Content-Type = %s, want %s", rr.Header().Get("Content-Type"), tt.contentType)
+			}
+		})
+	}
+}
+
+func TestCheatsheetHandlerBodies(t *testing.T) {
+	rr := httptest.NewRecorder()
+	cheatsheetHandler(rr, httptest.NewRequest(http.MethodGet, "/cheatsheet?format=json", nil))
+	var rows []CheatsheetRow
+	if err := json.Unmarshal(rr.Body.Bytes(), &rows); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(rows) != 33 {
+		t.Errorf("JSON rows = %d, want 33", len(rows))
+	}
+
+	rr = httptest.NewRecorder()
+	cheatsheetHandler(rr, httptest.NewRequest(http.MethodGet, "/cheatsheet?format=csv", nil))
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV: %v", err)
+	}
+	if len(records) != 34 {
+		t.Errorf("CSV records = %d, want 34 (header + 33 rows)", len(records))
+	}
+
+	rr = httptest.NewRecorder()
+	cheatsheetHandler(rr, httptest.NewRequest(http.MethodGet, "/cheatsheet", nil))
+	if !strings.Contains(rr.Body.String(), "255.255.255.252") {
+		t.Error("HTML cheatsheet should list the /30 mask")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// maxPrefixListLen caps the number of prefixes a single operation may return
+const maxPrefixListLen = 65536
+
+// ipToUint32 converts an IPv4 address to its 32-bit integer form
+func ipToUint32(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+// uint32ToIP converts a 32-bit integer to an IPv4 address
+func uint32ToIP(n uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
+
+// addrToUint32 converts an IPv4 netip.Addr to its 32-bit integer form
+func addrToUint32(addr netip.Addr) uint32 {
+	octets := addr.As4()
+	return binary.BigEndian.Uint32(octets[:])
+}
+
+// uint32ToAddr converts a 32-bit integer to an IPv4 netip.Addr
+func uint32ToAddr(n uint32) netip.Addr {
+	var octets [4]byte
+	binary.BigEndian.PutUint32(octets[:], n)
+	return netip.AddrFrom4(octets)
+}
+
+// netipPrefix converts a prefix from parseIPv4Prefix to a netip.Prefix
+func netipPrefix(p *net.IPNet) netip.Prefix {
+	ones, _ := p.Mask.Size()
+	return netip.PrefixFrom(uint32ToAddr(ipToUint32(p.IP)), ones)
+}
+
+// ipNet converts an IPv4 netip.Prefix to the *net.IPNet taken by cidrset and the
+// generators
+func ipNet(p netip.Prefix) *net.IPNet {
+	octets := p.Addr().As4()
+	return &net.IPNet{IP: net.IP(octets[:]), Mask: net.CIDRMask(p.Bits(), 32)}
+}
+
+// parseIPv4Prefix parses an IPv4 prefix in CIDR notation and normalizes it to its network address
+func parseIPv4Prefix(s string) (*net.IPNet, error) {
+	return cidrset.ParsePrefix(s)
+}
+
+// parsePrefixList parses every entry of list with parseIPv4Prefix
+func parsePrefixList(list []string) ([]*net.IPNet, error) {
+	prefixes := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		p, err := parseIPv4Prefix(s)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, p)
+	}
+	return prefixes, nil
+}
+
+// prefixContains reports whether inner lies entirely within outer
+func prefixContains(outer, inner *net.IPNet) bool {
+	o, i := cidrset.PrefixToRange(outer), cidrset.PrefixToRange(inner)
+	return o.First <= i.First && i.Last <= o.Last
+}
+
+// usableRange returns the first and last host address of a network as integers. The
+// network and broadcast addresses are excluded except in /31 and /32 networks
+func usableRange(network *net.IPNet) (uint32, uint32) {
+	r := cidrset.PrefixToRange(network)
+	if ones, _ := network.Mask.Size(); ones < 31 {
+		return r.First + 1, r.Last - 1
+	}
+	return r.First, r.Last
+}
+
+// splitPrefix divides a prefix into all of its subnets of the target length
+func splitPrefix(network *net.IPNet, targetLen int) ([]*net.IPNet, error) {
+	ones, _ := network.Mask.Size()
+	if targetLen < ones || targetLen > 32 {
+		return nil, fmt.Errorf("target length /%d must be between /%d and /32", targetLen, ones)
+	}
+	if targetLen-ones > 16 {
+		return nil, fmt.Errorf("splitting /%d into /%d would produce more than %d prefixes", ones, targetLen, maxPrefixListLen)
+	}
+
+	subnets := subnetsOf(netipPrefix(network), targetLen, maxPrefixListLen)
+	prefixes := make([]*net.IPNet, len(subnets))
+	for i, p := range subnets {
+		prefixes[i] = ipNet(p)
+	}
+	return prefixes, nil
+}
+
+// subnetsOf returns up to limit consecutive subnets of the given length from the
+// start of parent, which must be at most that long
+func subnetsOf(parent netip.Prefix, length, limit int) []netip.Prefix {
+	count := uint64(1) << uint(length-parent.Bits())
+	if uint64(limit) < count {
+		count = uint64(limit)
+	}
+	step := uint64(1) << uint(32-length)
+	start := uint64(addrToUint32(parent.Masked().Addr()))
+	subnets := make([]netip.Prefix, count)
+	for i := range subnets {
+		subnets[i] = netip.PrefixFrom(uint32ToAddr(uint32(start+uint64(i)*step)), length)
+	}
+	return subnets
+}
+
+// excludePrefixes expresses network minus every carve-out as a minimal CIDR list
+func excludePrefixes(network *net.IPNet, carveOuts []*net.IPNet) []*net.IPNet {
+	return cidrset.New(network).Difference(cidrset.New(carveOuts...)).Prefixes()
+}
+
+// prefixStrings formats a list of prefixes in CIDR notation
+func prefixStrings(prefixes []*net.IPNet) []string {
+	out := make([]string, len(prefixes))
+	for i, p := range prefixes {
+		out[i] = p.String()
+	}
+	return out
+}
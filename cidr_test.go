@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func mustParsePrefixes(t *testing.T, list ...string) []*net.IPNet {
+	t.Helper()
+	prefixes := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		p, err := parseIPv4Prefix(s)
+		if err != nil {
+			t.Fatalf("parseIPv4Prefix(%s) unexpected error: %v", s, err)
+		}
+		prefixes = append(prefixes, p)
+	}
+	return prefixes
+}
+
+func TestParseIPv4Prefix(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8", false},
+		{"192.168.1.77/24", "192.168.1.0/24", false},
+		{" 0.0.0.0/0 ", "0.0.0.0/0", false},
+		{"10.0.0.0", "", true},
+		{"10.0.0.0/33", "", true},
+		{"2001:db8::/32", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			p, err := parseIPv4Prefix(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseIPv4Prefix(%s) expected error, got nil", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseIPv4Prefix(%s) unexpected error: %v", tt.input, err)
+			}
+			if p.String() != tt.expected {
+				t.Errorf("parseIPv4Prefix(%s) = %s, want %s", tt.input, p, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSplitPrefix(t *testing.T) {
+	network := mustParsePrefixes(t, "10.0.0.0/22")[0]
+	got, err := splitPrefix(network, 24)
+	if err != nil {
+		t.Fatalf("splitPrefix() unexpected error: %v", err)
+	}
+	expected := []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24", "10.0.3.0/24"}
+	if !reflect.DeepEqual(prefixStrings(got), expected) {
+		t.Errorf("splitPrefix() = %v, want %v", prefixStrings(got), expected)
+	}
+
+	if _, err := splitPrefix(network, 20); err == nil {
+		t.Error("splitPrefix() to a shorter length expected error, got nil")
+	}
+	if _, err := splitPrefix(mustParsePrefixes(t, "10.0.0.0/8")[0], 32); err == nil {
+		t.Error("splitPrefix() beyond the result limit expected error, got nil")
+	}
+}
+
+func TestExcludePrefixes(t *testing.T) {
+	tests := []struct {
+		name      string
+		network   string
+		carveOuts []string
+		expected  []string
+	}{
+		{
+			name:      "10/8 minus 10.1/16",
+			network:   "10.0.0.0/8",
+			carveOuts: []string{"10.1.0.0/16"},
+			expected: []string{"10.0.0.0/16", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13",
+				"10.16.0.0/12", "10.32.0.0/11", "10.64.0.0/10", "10.128.0.0/9"},
+		},
+		{
+			name:      "overlapping carve-outs",
+			network:   "192.168.0.0/24",
+			carveOuts: []string{"192.168.0.0/26", "192.168.0.32/27", "192.168.0.128/25"},
+			expected:  []string{"192.168.0.64/26"},
+		},
+		{
+			name:      "carve-out outside network",
+			network:   "192.168.0.0/24",
+			carveOuts: []string{"10.0.0.0/8"},
+			expected:  []string{"192.168.0.0/24"},
+		},
+		{
+			name:      "carve-out covers network",
+			network:   "192.168.0.0/24",
+			carveOuts: []string{"192.168.0.0/16"},
+			expected:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network := mustParsePrefixes(t, tt.network)[0]
+			got := excludePrefixes(network, mustParsePrefixes(t, tt.carveOuts...))
+			if len(got) == 0 && len(tt.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(prefixStrings(got), tt.expected) {
+				t.Errorf("excludePrefixes() = %v, want %v", prefixStrings(got), tt.expected)
+			}
+		})
+	}
+}
+
+func TestUsableRange(t *testing.T) {
+	tests := []struct {
+		network     string
+		first, last string
+	}{
+		{"192.168.1.0/24", "192.168.1.1", "192.168.1.254"},
+		{"10.0.0.0/30", "10.0.0.1", "10.0.0.2"},
+		{"10.0.0.0/31", "10.0.0.0", "10.0.0.1"},
+		{"10.0.0.7/32", "10.0.0.7", "10.0.0.7"},
+	}
+	for _, tt := range tests {
+		first, last := usableRange(mustParsePrefixes(t, tt.network)[0])
+		if uint32ToIP(first).String() != tt.first || uint32ToIP(last).String() != tt.last {
+			t.Errorf("usableRange(%s) = %s - %s, want %s - %s", tt.network, uint32ToIP(first), uint32ToIP(last), tt.first, tt.last)
+		}
+	}
+}
+
+func TestSubnetsOf(t *testing.T) {
+	parent := netip.MustParsePrefix("10.0.0.0/22")
+	got := subnetsOf(parent, 24, 3)
+	want := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24"), netip.MustParsePrefix("10.0.1.0/24"), netip.MustParsePrefix("10.0.2.0/24")}
+	if !slices.Equal(got, want) {
+		t.Errorf("subnetsOf(%s, 24, 3) = %v, want %v", parent, got, want)
+	}
+	if got := subnetsOf(netip.MustParsePrefix("255.255.255.252/30"), 32, 10); len(got) != 4 || got[3].String() != "255.255.255.255/32" {
+		t.Errorf("subnetsOf at the top of the address space = %v", got)
+	}
+	if p := ipNet(netipPrefix(mustParsePrefixes(t, "172.16.0.0/12")[0])); p.String() != "172.16.0.0/12" {
+		t.Errorf("round trip = %s", p)
+	}
+}
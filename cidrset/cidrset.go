@@ -0,0 +1,250 @@
+// Package cidrset implements set semantics over collections of IPv4 prefixes.
+//
+// A Set is always kept normalized: its addresses are stored as sorted,
+// non-overlapping, non-adjacent ranges, so two sets holding the same
+// addresses are equal no matter how they were built. Sets are immutable;
+// every operation returns a new Set.
+//
+//	a, _ := cidrset.Parse("10.0.0.0/8")
+//	b, _ := cidrset.Parse("10.1.0.0/16")
+//	free := a.Difference(b).Prefixes() // 10.0.0.0/16, 10.2.0.0/15, ...
+package cidrset
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Range is an inclusive range of IPv4 addresses stored as integers
+type Range struct {
+	First uint32
+	Last  uint32
+}
+
+// Size returns the number of addresses in the range
+func (r Range) Size() uint64 {
+	return uint64(r.Last) - uint64(r.First) + 1
+}
+
+// Set is a normalized set of IPv4 addresses
+type Set struct {
+	ranges []Range
+}
+
+// New builds a set holding the addresses of every given prefix
+func New(prefixes ...*net.IPNet) *Set {
+	ranges := make([]Range, 0, len(prefixes))
+	for _, p := range prefixes {
+		ranges = append(ranges, PrefixToRange(p))
+	}
+	return FromRanges(ranges...)
+}
+
+// FromRanges builds a set holding the addresses of every given range
+func FromRanges(ranges ...Range) *Set {
+	return &Set{ranges: normalize(ranges)}
+}
+
+// Parse builds a set from prefixes in CIDR notation
+func Parse(cidrs ...string) (*Set, error) {
+	prefixes := make([]*net.IPNet, 0, len(cidrs))
+	for _, s := range cidrs {
+		p, err := ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, p)
+	}
+	return New(prefixes...), nil
+}
+
+// ParsePrefix parses an IPv4 prefix in CIDR notation and normalizes it to its network
+// address. IPv4-mapped IPv6 prefixes such as ::ffff:10.0.0.0/104 are refused, as their
+// mask is 128 bits long
+func ParsePrefix(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	ip, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prefix: %s", s)
+	}
+	if _, bits := network.Mask.Size(); ip.To4() == nil || bits != 32 {
+		return nil, fmt.Errorf("not a valid IPv4 prefix: %s", s)
+	}
+	network.IP = network.IP.To4()
+	return network, nil
+}
+
+// Ranges returns the normalized ranges of the set
+func (s *Set) Ranges() []Range {
+	out := make([]Range, len(s.ranges))
+	copy(out, s.ranges)
+	return out
+}
+
+// Prefixes returns the minimal list of prefixes covering exactly the set, in address order
+func (s *Set) Prefixes() []*net.IPNet {
+	var prefixes []*net.IPNet
+	for _, r := range s.ranges {
+		prefixes = append(prefixes, RangeToPrefixes(r)...)
+	}
+	return prefixes
+}
+
+// Size returns the number of addresses in the set
+func (s *Set) Size() uint64 {
+	var total uint64
+	for _, r := range s.ranges {
+		total += r.Size()
+	}
+	return total
+}
+
+// IsEmpty reports whether the set holds no addresses
+func (s *Set) IsEmpty() bool {
+	return len(s.ranges) == 0
+}
+
+// Equal reports whether both sets hold exactly the same addresses
+func (s *Set) Equal(o *Set) bool {
+	if len(s.ranges) != len(o.ranges) {
+		return false
+	}
+	for i := range s.ranges {
+		if s.ranges[i] != o.ranges[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Union returns the addresses that are in either set
+func (s *Set) Union(o *Set) *Set {
+	ranges := make([]Range, 0, len(s.ranges)+len(o.ranges))
+	ranges = append(ranges, s.ranges...)
+	ranges = append(ranges, o.ranges...)
+	return FromRanges(ranges...)
+}
+
+// Intersect returns the addresses that are in both sets
+func (s *Set) Intersect(o *Set) *Set {
+	var out []Range
+	i, j := 0, 0
+	for i < len(s.ranges) && j < len(o.ranges) {
+		a, b := s.ranges[i], o.ranges[j]
+		first, last := max(a.First, b.First), min(a.Last, b.Last)
+		if first <= last {
+			out = append(out, Range{First: first, Last: last})
+		}
+		if a.Last < b.Last {
+			i++
+		} else {
+			j++
+		}
+	}
+	return &Set{ranges: out}
+}
+
+// Difference returns the addresses of s that are not in o
+func (s *Set) Difference(o *Set) *Set {
+	var out []Range
+	j := 0
+	for _, r := range s.ranges {
+		next := uint64(r.First)
+		for j < len(o.ranges) && o.ranges[j].Last < r.First {
+			j++
+		}
+		for k := j; k < len(o.ranges) && o.ranges[k].First <= r.Last; k++ {
+			hole := o.ranges[k]
+			if uint64(hole.First) > next {
+				out = append(out, Range{First: uint32(next), Last: hole.First - 1})
+			}
+			if uint64(hole.Last)+1 > next {
+				next = uint64(hole.Last) + 1
+			}
+		}
+		if next <= uint64(r.Last) {
+			out = append(out, Range{First: uint32(next), Last: r.Last})
+		}
+	}
+	return &Set{ranges: out}
+}
+
+// Overlaps reports whether the sets share at least one address
+func (s *Set) Overlaps(o *Set) bool {
+	return !s.Intersect(o).IsEmpty()
+}
+
+// Contains reports whether the address is in the set
+func (s *Set) Contains(ip net.IP) bool {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return false
+	}
+	n := binary.BigEndian.Uint32(ip4)
+	i := sort.Search(len(s.ranges), func(i int) bool { return s.ranges[i].Last >= n })
+	return i < len(s.ranges) && s.ranges[i].First <= n
+}
+
+// ContainsPrefix reports whether every address of the prefix is in the set
+func (s *Set) ContainsPrefix(p *net.IPNet) bool {
+	r := PrefixToRange(p)
+	i := sort.Search(len(s.ranges), func(i int) bool { return s.ranges[i].Last >= r.First })
+	return i < len(s.ranges) && s.ranges[i].First <= r.First && r.Last <= s.ranges[i].Last
+}
+
+// PrefixToRange returns the first and last address covered by a prefix
+func PrefixToRange(p *net.IPNet) Range {
+	ones, _ := p.Mask.Size()
+	hostBits := uint(32 - ones)
+	first := binary.BigEndian.Uint32(p.IP.To4()) >> hostBits << hostBits
+	return Range{First: first, Last: first | uint32(uint64(1)<<hostBits-1)}
+}
+
+// RangeToPrefixes converts a range to the minimal list of prefixes covering it exactly
+func RangeToPrefixes(r Range) []*net.IPNet {
+	var prefixes []*net.IPNet
+	start := uint64(r.First)
+	end := uint64(r.Last)
+	for start <= end {
+		// Grow the block while it stays aligned and inside the range
+		size := 32
+		for size > 0 {
+			blockSize := uint64(1) << uint(32-size+1)
+			if start%blockSize != 0 || start+blockSize-1 > end {
+				break
+			}
+			size--
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, uint32(start))
+		prefixes = append(prefixes, &net.IPNet{IP: ip, Mask: net.CIDRMask(size, 32)})
+		start += uint64(1) << uint(32-size)
+	}
+	return prefixes
+}
+
+// normalize sorts ranges and joins those that overlap or are adjacent
+func normalize(ranges []Range) []Range {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sorted := make([]Range, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].First < sorted[j].First })
+
+	merged := []Range{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if uint64(r.First) <= uint64(last.Last)+1 {
+			if r.Last > last.Last {
+				last.Last = r.Last
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
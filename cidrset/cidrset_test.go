@@ -0,0 +1,160 @@
+package cidrset
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func mustParse(t *testing.T, cidrs ...string) *Set {
+	t.Helper()
+	s, err := Parse(cidrs...)
+	if err != nil {
+		t.Fatalf("Parse(%v) unexpected error: %v", cidrs, err)
+	}
+	return s
+}
+
+func prefixStrings(prefixes []*net.IPNet) []string {
+	out := []string{}
+	for _, p := range prefixes {
+		out = append(out, p.String())
+	}
+	return out
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse("10.0.0.0/8", "bogus"); err == nil {
+		t.Error("Parse() with invalid prefix expected error, got nil")
+	}
+	if _, err := Parse("2001:db8::/32"); err == nil {
+		t.Error("Parse() with IPv6 prefix expected error, got nil")
+	}
+	if p, err := ParsePrefix("::ffff:10.0.0.0/104"); err == nil {
+		t.Errorf("ParsePrefix() with IPv4-mapped prefix = %v, want error", p)
+	}
+	if got := prefixStrings(mustParse(t, "192.168.1.77/24").Prefixes()); !reflect.DeepEqual(got, []string{"192.168.1.0/24"}) {
+		t.Errorf("Parse() host bits not cleared: %v", got)
+	}
+}
+
+func TestNormalization(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		expected []string
+	}{
+		{"adjacent halves merge", []string{"10.0.1.0/24", "10.0.0.0/24"}, []string{"10.0.0.0/23"}},
+		{"contained prefix dropped", []string{"10.0.0.0/16", "10.0.5.0/24"}, []string{"10.0.0.0/16"}},
+		{"duplicates", []string{"10.0.0.0/24", "10.0.0.0/24"}, []string{"10.0.0.0/24"}},
+		{"unaligned adjacency", []string{"10.0.0.1/32", "10.0.0.2/31"}, []string{"10.0.0.1/32", "10.0.0.2/31"}},
+		{"whole space", []string{"0.0.0.0/1", "128.0.0.0/1"}, []string{"0.0.0.0/0"}},
+		{"empty", nil, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := prefixStrings(mustParse(t, tt.input...).Prefixes())
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Prefixes() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	a := mustParse(t, "10.0.0.0/24", "10.0.2.0/24")
+	b := mustParse(t, "10.0.0.128/25", "10.0.1.0/24", "10.0.2.0/26")
+
+	tests := []struct {
+		name     string
+		got      *Set
+		expected []string
+	}{
+		{"union", a.Union(b), []string{"10.0.0.0/23", "10.0.2.0/24"}},
+		{"intersect", a.Intersect(b), []string{"10.0.0.128/25", "10.0.2.0/26"}},
+		{"a minus b", a.Difference(b), []string{"10.0.0.0/25", "10.0.2.64/26", "10.0.2.128/25"}},
+		{"b minus a", b.Difference(a), []string{"10.0.1.0/24"}},
+		{"minus everything", a.Difference(mustParse(t, "0.0.0.0/0")), []string{}},
+		{"10/8 minus 10.1/16", mustParse(t, "10.0.0.0/8").Difference(mustParse(t, "10.1.0.0/16")),
+			[]string{"10.0.0.0/16", "10.2.0.0/15", "10.4.0.0/14", "10.8.0.0/13", "10.16.0.0/12", "10.32.0.0/11", "10.64.0.0/10", "10.128.0.0/9"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prefixStrings(tt.got.Prefixes()); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSetIdentities(t *testing.T) {
+	a := mustParse(t, "10.0.0.0/22", "172.16.0.0/30")
+	b := mustParse(t, "10.0.2.0/23", "192.168.0.0/24")
+
+	if !a.Union(b).Equal(b.Union(a)) {
+		t.Error("union should be commutative")
+	}
+	if !a.Intersect(b).Equal(b.Intersect(a)) {
+		t.Error("intersection should be commutative")
+	}
+	if !a.Difference(b).Union(a.Intersect(b)).Equal(a) {
+		t.Error("(a - b) | (a & b) should equal a")
+	}
+	if a.Difference(b).Overlaps(b) {
+		t.Error("a - b should not overlap b")
+	}
+	if got, want := a.Union(b).Size(), a.Size()+b.Size()-a.Intersect(b).Size(); got != want {
+		t.Errorf("|a | b| = %d, want %d", got, want)
+	}
+}
+
+func TestContains(t *testing.T) {
+	s := mustParse(t, "10.0.0.0/24", "192.168.0.0/16")
+
+	for ip, expected := range map[string]bool{"10.0.0.255": true, "10.0.1.0": false, "192.168.77.1": true, "8.8.8.8": false, "::1": false} {
+		if got := s.Contains(net.ParseIP(ip)); got != expected {
+			t.Errorf("Contains(%s) = %v, want %v", ip, got, expected)
+		}
+	}
+
+	for cidr, expected := range map[string]bool{"10.0.0.128/25": true, "10.0.0.0/23": false, "192.168.0.0/16": true} {
+		_, p, _ := net.ParseCIDR(cidr)
+		if got := s.ContainsPrefix(p); got != expected {
+			t.Errorf("ContainsPrefix(%s) = %v, want %v", cidr, got, expected)
+		}
+	}
+}
+
+func TestRangeToPrefixes(t *testing.T) {
+	tests := []struct {
+		name     string
+		r        Range
+		expected []string
+	}{
+		{"single /24", Range{0xC0A80100, 0xC0A801FF}, []string{"192.168.1.0/24"}},
+		{"unaligned", Range{0x0A000001, 0x0A000006}, []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{"whole space", Range{0, 0xFFFFFFFF}, []string{"0.0.0.0/0"}},
+		{"top address", Range{0xFFFFFFFF, 0xFFFFFFFF}, []string{"255.255.255.255/32"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prefixStrings(RangeToPrefixes(tt.r)); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("RangeToPrefixes() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPrefixToRange(t *testing.T) {
+	_, whole, _ := net.ParseCIDR("0.0.0.0/0")
+	if r := PrefixToRange(whole); r.First != 0 || r.Last != 0xFFFFFFFF || r.Size() != 1<<32 {
+		t.Errorf("PrefixToRange(/0) = %+v", r)
+	}
+	_, host, _ := net.ParseCIDR("10.0.0.7/32")
+	if r := PrefixToRange(host); r.First != 0x0A000007 || r.Last != 0x0A000007 {
+		t.Errorf("PrefixToRange(/32) = %+v", r)
+	}
+}
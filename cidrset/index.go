@@ -0,0 +1,247 @@
+package cidrset
+
+import (
+	"math/rand/v2"
+	"net"
+)
+
+// IndexEntry is a range stored in an Index together with its value
+type IndexEntry[V any] struct {
+	Range Range
+	Value V
+}
+
+// Index is an interval tree over address ranges, each carrying a value of type V.
+// Unlike a Set, an Index keeps every stored range as it is, so ranges may nest or
+// overlap, and it answers which of them overlap a query without scanning them all:
+// insertions, deletions and Overlap take O(log n) expected time and Overlapping
+// O(log n + k) for k results. The zero value is an empty index. An Index is not safe
+// for concurrent use while it is being modified.
+type Index[V any] struct {
+	root *indexNode[V]
+	size int
+}
+
+// indexNode is a node of a treap ordered by range, augmented with the highest last
+// address in its subtree
+type indexNode[V any] struct {
+	entry       IndexEntry[V]
+	priority    uint32
+	maxLast     uint32
+	left, right *indexNode[V]
+}
+
+// NewIndex returns an empty index
+func NewIndex[V any]() *Index[V] {
+	return &Index[V]{}
+}
+
+// Len returns the number of ranges in the index
+func (x *Index[V]) Len() int {
+	return x.size
+}
+
+// Insert stores value under r, replacing the value of an equal range. It reports
+// whether the range is new to the index
+func (x *Index[V]) Insert(r Range, value V) bool {
+	var added bool
+	x.root, added = x.root.insert(IndexEntry[V]{Range: r, Value: value}, rand.Uint32())
+	if added {
+		x.size++
+	}
+	return added
+}
+
+// InsertPrefix stores value under the range of a prefix
+func (x *Index[V]) InsertPrefix(p *net.IPNet, value V) bool {
+	return x.Insert(PrefixToRange(p), value)
+}
+
+// Delete removes the range r and reports whether it was present
+func (x *Index[V]) Delete(r Range) bool {
+	var removed bool
+	x.root, removed = x.root.remove(r)
+	if removed {
+		x.size--
+	}
+	return removed
+}
+
+// DeletePrefix removes the range of a prefix
+func (x *Index[V]) DeletePrefix(p *net.IPNet) bool {
+	return x.Delete(PrefixToRange(p))
+}
+
+// Get returns the value stored under exactly the range r
+func (x *Index[V]) Get(r Range) (V, bool) {
+	n := x.root
+	for n != nil {
+		switch c := compareRanges(r, n.entry.Range); {
+		case c == 0:
+			return n.entry.Value, true
+		case c < 0:
+			n = n.left
+		default:
+			n = n.right
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// Overlap returns a stored range that shares at least one address with r
+func (x *Index[V]) Overlap(r Range) (IndexEntry[V], bool) {
+	n := x.root
+	for n != nil {
+		if overlaps(n.entry.Range, r) {
+			return n.entry, true
+		}
+		// A left subtree reaching past r.First holds an overlap if any range does
+		if n.left != nil && n.left.maxLast >= r.First {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return IndexEntry[V]{}, false
+}
+
+// OverlapPrefix returns a stored range that shares at least one address with a prefix
+func (x *Index[V]) OverlapPrefix(p *net.IPNet) (IndexEntry[V], bool) {
+	return x.Overlap(PrefixToRange(p))
+}
+
+// Overlapping returns every stored range that shares at least one address with r,
+// ordered by first address and then by last address
+func (x *Index[V]) Overlapping(r Range) []IndexEntry[V] {
+	var found []IndexEntry[V]
+	x.root.collect(r, &found)
+	return found
+}
+
+// Entries returns every stored range in the order of Overlapping
+func (x *Index[V]) Entries() []IndexEntry[V] {
+	return x.Overlapping(Range{First: 0, Last: ^uint32(0)})
+}
+
+func overlaps(a, b Range) bool {
+	return a.First <= b.Last && b.First <= a.Last
+}
+
+// compareRanges orders ranges by first and then by last address
+func compareRanges(a, b Range) int {
+	switch {
+	case a.First != b.First:
+		if a.First < b.First {
+			return -1
+		}
+		return 1
+	case a.Last != b.Last:
+		if a.Last < b.Last {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+func (n *indexNode[V]) update() {
+	n.maxLast = n.entry.Range.Last
+	if n.left != nil && n.left.maxLast > n.maxLast {
+		n.maxLast = n.left.maxLast
+	}
+	if n.right != nil && n.right.maxLast > n.maxLast {
+		n.maxLast = n.right.maxLast
+	}
+}
+
+func (n *indexNode[V]) insert(e IndexEntry[V], priority uint32) (*indexNode[V], bool) {
+	if n == nil {
+		return &indexNode[V]{entry: e, priority: priority, maxLast: e.Range.Last}, true
+	}
+	var added bool
+	switch c := compareRanges(e.Range, n.entry.Range); {
+	case c == 0:
+		n.entry.Value = e.Value
+		return n, false
+	case c < 0:
+		n.left, added = n.left.insert(e, priority)
+		if n.left.priority > n.priority {
+			n = n.rotateRight()
+		}
+	default:
+		n.right, added = n.right.insert(e, priority)
+		if n.right.priority > n.priority {
+			n = n.rotateLeft()
+		}
+	}
+	n.update()
+	return n, added
+}
+
+func (n *indexNode[V]) remove(r Range) (*indexNode[V], bool) {
+	if n == nil {
+		return nil, false
+	}
+	var removed bool
+	switch c := compareRanges(r, n.entry.Range); {
+	case c == 0:
+		return merge(n.left, n.right), true
+	case c < 0:
+		n.left, removed = n.left.remove(r)
+	default:
+		n.right, removed = n.right.remove(r)
+	}
+	n.update()
+	return n, removed
+}
+
+// merge joins two treaps where every range of a sorts before every range of b
+func merge[V any](a, b *indexNode[V]) *indexNode[V] {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.priority > b.priority:
+		a.right = merge(a.right, b)
+		a.update()
+		return a
+	default:
+		b.left = merge(a, b.left)
+		b.update()
+		return b
+	}
+}
+
+func (n *indexNode[V]) rotateRight() *indexNode[V] {
+	l := n.left
+	n.left = l.right
+	n.update()
+	l.right = n
+	return l
+}
+
+func (n *indexNode[V]) rotateLeft() *indexNode[V] {
+	r := n.right
+	n.right = r.left
+	n.update()
+	r.left = n
+	return r
+}
+
+// collect appends the ranges of the subtree overlapping r in order, skipping subtrees
+// that end before r or start after it
+func (n *indexNode[V]) collect(r Range, found *[]IndexEntry[V]) {
+	if n == nil || n.maxLast < r.First {
+		return
+	}
+	n.left.collect(r, found)
+	if n.entry.Range.First > r.Last {
+		return
+	}
+	if n.entry.Range.Last >= r.First {
+		*found = append(*found, n.entry)
+	}
+	n.right.collect(r, found)
+}
@@ -0,0 +1,116 @@
+package cidrset
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	x := NewIndex[string]()
+	for _, p := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "192.168.0.0/16"} {
+		if !x.InsertPrefix(mustParse(t, p).Prefixes()[0], p) {
+			t.Errorf("InsertPrefix(%s) reported an existing range", p)
+		}
+	}
+	if x.InsertPrefix(mustParse(t, "10.1.0.0/16").Prefixes()[0], "replaced") || x.Len() != 4 {
+		t.Errorf("InsertPrefix() of an existing range added it, Len() = %d", x.Len())
+	}
+
+	values := func(entries []IndexEntry[string]) []string {
+		out := []string{}
+		for _, e := range entries {
+			out = append(out, e.Value)
+		}
+		return out
+	}
+	query := PrefixToRange(mustParse(t, "10.1.2.128/25").Prefixes()[0])
+	if got := values(x.Overlapping(query)); !reflect.DeepEqual(got, []string{"10.0.0.0/8", "replaced", "10.1.2.0/24"}) {
+		t.Errorf("Overlapping(10.1.2.128/25) = %v", got)
+	}
+	if e, ok := x.OverlapPrefix(mustParse(t, "192.168.7.0/24").Prefixes()[0]); !ok || e.Value != "192.168.0.0/16" {
+		t.Errorf("OverlapPrefix(192.168.7.0/24) = %v, %v", e, ok)
+	}
+	if _, ok := x.OverlapPrefix(mustParse(t, "172.16.0.0/12").Prefixes()[0]); ok {
+		t.Error("OverlapPrefix(172.16.0.0/12) found an overlap")
+	}
+
+	if v, ok := x.Get(PrefixToRange(mustParse(t, "10.1.2.0/24").Prefixes()[0])); !ok || v != "10.1.2.0/24" {
+		t.Errorf("Get(10.1.2.0/24) = %q, %v", v, ok)
+	}
+	if _, ok := x.Get(PrefixToRange(mustParse(t, "10.1.2.0/25").Prefixes()[0])); ok {
+		t.Error("Get() of a range that is not stored found a value")
+	}
+
+	if x.Delete(Range{First: 1, Last: 2}) {
+		t.Error("Delete() of a missing range reported success")
+	}
+	if !x.DeletePrefix(mustParse(t, "10.0.0.0/8").Prefixes()[0]) || x.Len() != 3 {
+		t.Errorf("DeletePrefix(10.0.0.0/8) failed, Len() = %d", x.Len())
+	}
+	if _, ok := x.OverlapPrefix(mustParse(t, "10.200.0.0/16").Prefixes()[0]); ok {
+		t.Error("OverlapPrefix() found a deleted range")
+	}
+	if got := values(x.Entries()); !reflect.DeepEqual(got, []string{"replaced", "10.1.2.0/24", "192.168.0.0/16"}) {
+		t.Errorf("Entries() = %v", got)
+	}
+}
+
+func TestIndexMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	randomRange := func() Range {
+		first := rng.Uint32N(1 << 16)
+		return Range{First: first, Last: first + rng.Uint32N(64)}
+	}
+
+	var x Index[int]
+	stored := map[Range]int{}
+	for i := 0; i < 5000; i++ {
+		r := randomRange()
+		if i%4 == 3 {
+			delete(stored, r)
+			x.Delete(r)
+			continue
+		}
+		stored[r] = i
+		x.Insert(r, i)
+	}
+	if x.Len() != len(stored) {
+		t.Fatalf("Len() = %d, want %d", x.Len(), len(stored))
+	}
+
+	for i := 0; i < 1000; i++ {
+		q := randomRange()
+		want := 0
+		for r := range stored {
+			if overlaps(r, q) {
+				want++
+			}
+		}
+		found := x.Overlapping(q)
+		if len(found) != want {
+			t.Fatalf("Overlapping(%v) = %d ranges, want %d", q, len(found), want)
+		}
+		for j, e := range found {
+			if stored[e.Range] != e.Value || !overlaps(e.Range, q) || (j > 0 && compareRanges(found[j-1].Range, e.Range) >= 0) {
+				t.Fatalf("Overlapping(%v) returned %v out of order or not stored", q, e)
+			}
+		}
+		if e, ok := x.Overlap(q); ok != (want > 0) || (ok && !overlaps(e.Range, q)) {
+			t.Fatalf("Overlap(%v) = %v, %v with %d overlapping ranges", q, e, ok, want)
+		}
+	}
+}
+
+func BenchmarkIndexOverlap(b *testing.B) {
+	// 262144 disjoint /30s, as a large IPAM pool's allocations
+	var x Index[int]
+	for i := uint32(0); i < 1<<18; i++ {
+		x.Insert(Range{First: 0x0a000000 + i*4, Last: 0x0a000000 + i*4 + 3}, int(i))
+	}
+	q := Range{First: 0x0a0f0000, Last: 0x0a0f0000}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x.Overlap(q)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// defaultClientMask is assumed for the network of a client when none is given
+const defaultClientMask = "/24"
+
+// trustedProxies are the reverse proxies whose X-Forwarded-For headers are believed;
+// nil trusts none, so the client is always the peer of the connection
+var trustedProxies *cidrset.Set
+
+// configureTrustedProxies reads GO_SUBNET_CALCULATOR_TRUSTED_PROXIES, a comma separated
+// list of the IPv4 prefixes of reverse proxies in front of the server
+func configureTrustedProxies() error {
+	trustedProxies = nil
+	value := os.Getenv("GO_SUBNET_CALCULATOR_TRUSTED_PROXIES")
+	if value == "" {
+		recordSystemAudit("config.proxies", "", "no trusted proxies")
+		return nil
+	}
+	set, err := cidrset.Parse(strings.Split(value, ",")...)
+	if err != nil {
+		return fmt.Errorf("GO_SUBNET_CALCULATOR_TRUSTED_PROXIES: %v", err)
+	}
+	trustedProxies = set
+	recordSystemAudit("config.proxies", "", "trusting X-Forwarded-For from %s", value)
+	return nil
+}
+
+// prefillSetting reads GO_SUBNET_CALCULATOR_PREFILL_CLIENT, as looked up by setting;
+// when true the calculator form opens with the visitor's address filled in
+func prefillSetting(setting func(string) string) (bool, error) {
+	value := setting("GO_SUBNET_CALCULATOR_PREFILL_CLIENT")
+	if value == "" {
+		return false, nil
+	}
+	prefill, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("GO_SUBNET_CALCULATOR_PREFILL_CLIENT must be true or false")
+	}
+	return prefill, nil
+}
+
+// prefillAddress returns the address to put into an empty IP field: the client's,
+// when prefilling is on and it is IPv4
+func prefillAddress(r *http.Request) string {
+	if !currentSettings().PrefillClient {
+		return ""
+	}
+	address := clientAddress(r)
+	if ip := net.ParseIP(address); ip == nil || ip.To4() == nil {
+		return ""
+	}
+	return address
+}
+
+// isTrustedProxy reports whether address is one of the trusted proxies
+func isTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	return trustedProxies != nil && ip != nil && trustedProxies.Contains(ip)
+}
+
+// clientAddress returns the address of the client that sent r. When the peer is a
+// trusted proxy, X-Forwarded-For is read from the right and the first hop that is not
+// a trusted proxy is the client; hops further left could be forged by anyone
+func clientAddress(r *http.Request) string {
+	address := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	if !isTrustedProxy(address) {
+		return address
+	}
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			// a malformed hop ends the chain; the proxy that forwarded it is the client
+			break
+		}
+		address = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return address
+}
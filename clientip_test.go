@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// withTestTrustedProxies trusts X-Forwarded-For from the given prefixes
+func withTestTrustedProxies(t *testing.T, value string) {
+	t.Helper()
+	previous := trustedProxies
+	t.Setenv("GO_SUBNET_CALCULATOR_TRUSTED_PROXIES", value)
+	if err := configureTrustedProxies(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { trustedProxies = previous })
+}
+
+func TestClientAddress(t *testing.T) {
+	withTestAudit(t)
+	request := func(remote string, forwarded ...string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/whoami", nil)
+		r.RemoteAddr = remote
+		for _, f := range forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		return r
+	}
+
+	withTestTrustedProxies(t, "")
+	if got := clientAddress(request("10.0.0.5:4321", "203.0.113.9")); got != "10.0.0.5" {
+		t.Errorf("untrusted forwarding = %s, want the peer", got)
+	}
+
+	withTestTrustedProxies(t, "10.0.0.0/24,192.0.2.1/32")
+	tests := []struct {
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"10.0.0.5:4321", []string{"203.0.113.9"}, "203.0.113.9"},
+		{"10.0.0.5:4321", nil, "10.0.0.5"},
+		// the client cannot smuggle an address in front of the one the proxy saw
+		{"10.0.0.5:4321", []string{"198.51.100.7, 203.0.113.9"}, "203.0.113.9"},
+		{"10.0.0.5:4321", []string{"203.0.113.9, 192.0.2.1"}, "203.0.113.9"},
+		{"10.0.0.5:4321", []string{"203.0.113.9", "192.0.2.1"}, "203.0.113.9"},
+		{"10.0.0.5:4321", []string{"192.0.2.1"}, "192.0.2.1"},
+		{"10.0.0.5:4321", []string{"unknown, 192.0.2.1"}, "192.0.2.1"},
+		{"172.16.0.9:4321", []string{"203.0.113.9"}, "172.16.0.9"},
+	}
+	for _, tt := range tests {
+		if got := clientAddress(request(tt.remote, tt.forwarded...)); got != tt.want {
+			t.Errorf("clientAddress(%s, %q) = %s, want %s", tt.remote, tt.forwarded, got, tt.want)
+		}
+	}
+
+	t.Setenv("GO_SUBNET_CALCULATOR_TRUSTED_PROXIES", "10.0.0.0/33")
+	if err := configureTrustedProxies(); err == nil {
+		t.Error("expected an error for an invalid prefix")
+	}
+}
+
+func TestWhoamiNetwork(t *testing.T) {
+	withTestAudit(t)
+	withTestTrustedProxies(t, "127.0.0.1/32")
+	whoami := func(target, remote, forwarded string) (*httptest.ResponseRecorder, WhoAmI) {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.RemoteAddr = remote
+		if forwarded != "" {
+			r.Header.Set("X-Forwarded-For", forwarded)
+		}
+		rr := httptest.NewRecorder()
+		whoamiHandler(rr, r)
+		var resp WhoAmI
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr, resp
+	}
+
+	_, resp := whoami("/api/v1/whoami", "127.0.0.1:5000", "10.20.30.40")
+	if resp.Address != "10.20.30.40" || resp.Principal == nil || resp.Role != RoleAdmin || resp.Network == nil ||
+		resp.Network.NetworkAddress != "10.20.30.0" || resp.Network.SubnetMask != "/24" {
+		t.Errorf("whoami = %+v, network %+v", resp, resp.Network)
+	}
+	_, resp = whoami("/api/v1/whoami?mask=255.255.240.0", "10.20.30.40:5000", "")
+	if resp.Network == nil || resp.Network.NetworkAddress != "10.20.16.0" || resp.Network.UsableHosts != "4094" {
+		t.Errorf("whoami with a mask = %+v", resp.Network)
+	}
+	if len(resp.Network.SpecialPurpose) == 0 || resp.Network.SpecialPurpose[0].Prefix != "10.0.0.0/8" {
+		t.Errorf("special purpose of a private client = %+v", resp.Network.SpecialPurpose)
+	}
+	_, resp = whoami("/api/v1/whoami", "[2001:db8::1]:5000", "")
+	if resp.Address != "2001:db8::1" || resp.Network != nil || resp.NetworkError == "" {
+		t.Errorf("whoami of an IPv6 client = %+v", resp)
+	}
+	if rr, _ := whoami("/api/v1/whoami?mask=/33", "10.20.30.40:5000", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid mask status = %d, want 400", rr.Code)
+	}
+}
+
+func TestHandlerPrefill(t *testing.T) {
+	withTestAudit(t)
+	withTestTrustedProxies(t, "127.0.0.1/32")
+	page := func(prefill bool, remote, forwarded string) string {
+		previous := settings.Swap(&Settings{LogLevel: "info", PrefillClient: prefill})
+		defer settings.Store(previous)
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remote
+		r.Header.Set("X-Forwarded-For", forwarded)
+		rr := httptest.NewRecorder()
+		handler(rr, r)
+		return rr.Body.String()
+	}
+
+	field := `name="ip" placeholder="192.168.1.1" value="198.51.100.23"`
+	if body := page(true, "127.0.0.1:5000", "198.51.100.23"); !strings.Contains(body, field) {
+		t.Error("form not prefilled with the forwarded client address")
+	}
+	if body := page(false, "127.0.0.1:5000", "198.51.100.23"); strings.Contains(body, "198.51.100.23") {
+		t.Error("form prefilled while prefilling is off")
+	}
+	if body := page(true, "[2001:db8::1]:5000", ""); !strings.Contains(body, `placeholder="192.168.1.1" value=""`) {
+		t.Error("form prefilled with an IPv6 address")
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ReservedAddress is an address a cloud provider keeps for itself in every subnet
+type ReservedAddress struct {
+	Address string `json:"address"`
+	Purpose string `json:"purpose"`
+}
+
+// CloudProvider describes the subnet rules of a cloud provider: the prefix lengths it
+// accepts and the addresses it reserves, given as offsets from the start of the subnet
+// (negative offsets count back from the broadcast address)
+type CloudProvider struct {
+	Name      string
+	Label     string
+	MinPrefix int
+	MaxPrefix int
+	Reserved  []cloudReservation
+	// Notes are provider-specific planning hints shown with every result
+	Notes []string
+}
+
+type cloudReservation struct {
+	offset  int
+	purpose string
+}
+
+var cloudProviders = []CloudProvider{
+	{
+		Name:      "aws",
+		Label:     "AWS VPC",
+		MinPrefix: 16,
+		MaxPrefix: 28,
+		Reserved: []cloudReservation{
+			{0, "network address"},
+			{1, "VPC router"},
+			{2, "Amazon-provided DNS"},
+			{3, "reserved for future use"},
+			{-1, "broadcast address (not supported in a VPC)"},
+		},
+		Notes: []string{
+			"AWS reserves the first four and the last address of every subnet.",
+			"A VPC CIDR block and its subnets must be between /16 and /28.",
+		},
+	},
+	{
+		Name:      "azure",
+		Label:     "Azure VNet",
+		MinPrefix: 2,
+		MaxPrefix: 29,
+		Reserved: []cloudReservation{
+			{0, "network address"},
+			{1, "default gateway"},
+			{2, "Azure DNS mapping"},
+			{3, "Azure DNS mapping"},
+			{-1, "broadcast address"},
+		},
+		Notes: []string{
+			"Azure reserves the first four and the last address of every subnet.",
+			"The smallest supported subnet is /29; a GatewaySubnet should be /27 or larger.",
+		},
+	},
+	{
+		Name:      "gcp",
+		Label:     "Google Cloud VPC",
+		MinPrefix: 4,
+		MaxPrefix: 29,
+		Reserved: []cloudReservation{
+			{0, "network address"},
+			{1, "default gateway"},
+			{-2, "reserved for future use"},
+			{-1, "broadcast address"},
+		},
+		Notes: []string{
+			"Google Cloud reserves the first two and the last two addresses of every primary subnet range.",
+			"The smallest supported subnet range is /29.",
+		},
+	},
+}
+
+// lookupCloudProvider returns the provider with the given name
+func lookupCloudProvider(name string) (CloudProvider, bool) {
+	for _, p := range cloudProviders {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return CloudProvider{}, false
+}
+
+// applyCloudProvider replaces the host range and usable host count of a calculated
+// subnet with the provider's, and lists the addresses the provider reserves
+func applyCloudProvider(result *SubnetResult, network *net.IPNet, provider CloudProvider) error {
+	ones, _ := network.Mask.Size()
+	if ones < provider.MinPrefix || ones > provider.MaxPrefix {
+		return fmt.Errorf("%s subnets must be between /%d and /%d, got /%d", provider.Label, provider.MinPrefix, provider.MaxPrefix, ones)
+	}
+
+	first := ipToUint32(network.IP)
+	last := first | ^ipToUint32(net.IP(network.Mask))
+	lowest, highest := 0, 0
+	result.Cloud = provider.Name
+	result.CloudNotes = provider.Notes
+	result.Reserved = nil
+	for _, r := range provider.Reserved {
+		var addr uint32
+		if r.offset < 0 {
+			addr = last + 1 - uint32(-r.offset)
+			highest++
+		} else {
+			addr = first + uint32(r.offset)
+			lowest = max(lowest, r.offset+1)
+		}
+		result.Reserved = append(result.Reserved, ReservedAddress{Address: uint32ToIP(addr).String(), Purpose: r.purpose})
+	}
+
+	result.MinHostAddress = uint32ToIP(first + uint32(lowest)).String()
+	result.MaxHostAddress = uint32ToIP(last - uint32(highest)).String()
+	result.UsableHosts = strconv.FormatUint((uint64(1)<<uint(32-ones))-uint64(len(provider.Reserved)), 10)
+	return nil
+}
+
+// calculateCloudSubnet calculates a subnet and, when cloud names a provider, applies
+// that provider's reservations and size limits. An empty cloud is a plain calculation
+func calculateCloudSubnet(ipStr, maskStr, cloud string) (*SubnetResult, error) {
+	result, err := calculateSubnet(ipStr, maskStr)
+	if err != nil || cloud == "" {
+		return result, err
+	}
+
+	provider, ok := lookupCloudProvider(strings.ToLower(cloud))
+	if !ok {
+		return nil, fmt.Errorf("unknown cloud provider: %s", cloud)
+	}
+	mask, _ := parseSubnetMask(maskStr)
+	network := &net.IPNet{IP: net.ParseIP(result.NetworkAddress).To4(), Mask: mask}
+	if err := applyCloudProvider(result, network, provider); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CalculateRequest is the JSON body of POST /api/v1/calculate
+type CalculateRequest struct {
+	IP      string `json:"ip"`
+	Mask    string `json:"mask"`
+	Cloud   string `json:"cloud,omitempty"`
+	Explain bool   `json:"explain,omitempty"`
+
+	// DHCP asks for a suggested gateway, static range and DHCP pool
+	DHCP *DHCPPoolOptions `json:"dhcp,omitempty"`
+}
+
+// calculateHandler serves /api/v1/calculate; POST takes a JSON body, GET takes ip, mask
+// and cloud query parameters. The result is JSON, or CSV, Markdown or a scan target
+// list with ?format=;
+// explain adds the worked solution and dhcp a suggested DHCP layout
+func calculateHandler(w http.ResponseWriter, r *http.Request) {
+	var req CalculateRequest
+	switch r.Method {
+	case http.MethodPost:
+		if !decodeJSONPost(w, r, &req) {
+			return
+		}
+	case http.MethodGet:
+		var ok bool
+		if req, ok = calculateQuery(w, r, r.URL.Query().Get("ip"), r.URL.Query().Get("mask")); !ok {
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	serveCalculation(w, r, req)
+}
+
+// subnetHandler serves GET /api/v1/subnet/{ip}/{mask}, which answers like
+// /api/v1/calculate so that the URL alone names the network, e.g.
+// /api/v1/subnet/192.168.1.0/24 or /api/v1/subnet/192.168.1.10/255.255.255.0. The
+// cloud, explain and dhcp query parameters apply as there
+func subnetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if req, ok := calculateQuery(w, r, r.PathValue("ip"), r.PathValue("mask")); ok {
+		serveCalculation(w, r, req)
+	}
+}
+
+// calculateQuery builds the calculation of a GET request from its address and mask and
+// the cloud, explain and dhcp query parameters. A bad explain or dhcp value is answered
+// with 400
+func calculateQuery(w http.ResponseWriter, r *http.Request, ip, mask string) (CalculateRequest, bool) {
+	query := r.URL.Query()
+	req := CalculateRequest{IP: ip, Mask: mask, Cloud: query.Get("cloud")}
+	if value := query.Get("explain"); value != "" {
+		var err error
+		if req.Explain, err = strconv.ParseBool(value); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "explain must be true or false")
+			return req, false
+		}
+	}
+	var err error
+	if req.DHCP, err = dhcpPoolQuery(query); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return req, false
+	}
+	return req, true
+}
+
+// serveCalculation answers a calculation request of the API in the requested format
+func serveCalculation(w http.ResponseWriter, r *http.Request, req CalculateRequest) {
+	var note string
+	req.IP, req.Mask, note = normalizeInput(req.IP, req.Mask)
+	if req.IP == "" || req.Mask == "" {
+		writeJSONError(w, http.StatusBadRequest, "ip and mask are required")
+		return
+	}
+	_, span := startSpan(r.Context(), "subnet.calculate", spanKindInternal)
+	span.Set("subnet.ip", req.IP)
+	span.Set("subnet.mask", req.Mask)
+	result, err := calculateCloudSubnet(req.IP, req.Mask, req.Cloud)
+	span.End(err)
+	recordRecent(r, "api", req.IP, req.Mask, req.Cloud, result, err)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	result.IPAddress = req.IP
+	result.SubnetMask = req.Mask
+	result.Normalization = note
+	if req.Explain {
+		result.Explanation, _ = explainSubnet(req.IP, req.Mask, result)
+	}
+	if req.DHCP != nil {
+		if result.DHCP, err = suggestDHCPPool(req.IP, req.Mask, req.Cloud, *req.DHCP); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	result.Integers = integerFormsOf(req.IP, req.Mask)
+	result.SpecialPurpose = specialPurposeOf(req.IP, req.Mask)
+	result.Registration = lookupRegistration(r.Context(), req.IP)
+	result.Location = lookupGeoLocation(req.IP)
+	result.Origin = lookupOrigin(r.Context(), req.IP, req.Mask)
+	result.Reputation = checkReputation(r.Context(), req.IP)
+	if owner := calculationOwner(r); owner != "" {
+		if _, err := recordCalculation(owner, "", result); err != nil {
+			logRequestf(r.Context(), "Recording calculation for %s failed: %v", owner, err)
+		}
+	}
+	switch format := responseFormat(r, "json"); format {
+	case "csv":
+		writeSubnetCSV(w, "subnet.csv", []SubnetRow{resultRow("", result)})
+	case "markdown":
+		writeResultMarkdown(w, result)
+	case targetsNmap, targetsMasscan:
+		writeResultTargets(w, r, r.URL.Query(), format, result)
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCalculateCloudSubnetAWS(t *testing.T) {
+	result, err := calculateCloudSubnet("10.0.1.77", "/24", "aws")
+	if err != nil {
+		t.Fatalf("calculateCloudSubnet() unexpected error: %v", err)
+	}
+	if result.MinHostAddress != "10.0.1.4" || result.MaxHostAddress != "10.0.1.254" || result.UsableHosts != "251" {
+		t.Errorf("got hosts %s - %s (%s), want 10.0.1.4 - 10.0.1.254 (251)", result.MinHostAddress, result.MaxHostAddress, result.UsableHosts)
+	}
+	wantReserved := []string{"10.0.1.0", "10.0.1.1", "10.0.1.2", "10.0.1.3", "10.0.1.255"}
+	if len(result.Reserved) != len(wantReserved) {
+		t.Fatalf("got %d reserved addresses, want %d", len(result.Reserved), len(wantReserved))
+	}
+	for i, want := range wantReserved {
+		if result.Reserved[i].Address != want {
+			t.Errorf("reserved[%d] = %s, want %s", i, result.Reserved[i].Address, want)
+		}
+	}
+
+	result, err = calculateCloudSubnet("10.0.0.16", "255.255.255.240", "AWS")
+	if err != nil || result.UsableHosts != "11" || result.MinHostAddress != "10.0.0.20" {
+		t.Errorf("/28 in AWS = %+v, %v; want 11 usable hosts from 10.0.0.20", result, err)
+	}
+}
+
+func TestCalculateCloudSubnetProviders(t *testing.T) {
+	tests := []struct {
+		cloud, mask       string
+		wantMin, wantMax  string
+		wantHosts         string
+		wantReservedAddrs []string
+	}{
+		{"azure", "/24", "172.16.5.4", "172.16.5.254", "251", []string{"172.16.5.0", "172.16.5.1", "172.16.5.2", "172.16.5.3", "172.16.5.255"}},
+		{"azure", "/29", "172.16.5.4", "172.16.5.6", "3", []string{"172.16.5.0", "172.16.5.1", "172.16.5.2", "172.16.5.3", "172.16.5.7"}},
+		{"gcp", "/24", "172.16.5.2", "172.16.5.253", "252", []string{"172.16.5.0", "172.16.5.1", "172.16.5.254", "172.16.5.255"}},
+		{"gcp", "/29", "172.16.5.2", "172.16.5.5", "4", []string{"172.16.5.0", "172.16.5.1", "172.16.5.6", "172.16.5.7"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cloud+tt.mask, func(t *testing.T) {
+			result, err := calculateCloudSubnet("172.16.5.0", tt.mask, tt.cloud)
+			if err != nil {
+				t.Fatalf("calculateCloudSubnet() unexpected error: %v", err)
+			}
+			if result.MinHostAddress != tt.wantMin || result.MaxHostAddress != tt.wantMax || result.UsableHosts != tt.wantHosts {
+				t.Errorf("got %s - %s (%s), want %s - %s (%s)", result.MinHostAddress, result.MaxHostAddress, result.UsableHosts, tt.wantMin, tt.wantMax, tt.wantHosts)
+			}
+			var reserved []string
+			for _, r := range result.Reserved {
+				reserved = append(reserved, r.Address)
+			}
+			if strings.Join(reserved, ",") != strings.Join(tt.wantReservedAddrs, ",") {
+				t.Errorf("reserved = %v, want %v", reserved, tt.wantReservedAddrs)
+			}
+			if len(result.CloudNotes) == 0 {
+				t.Error("expected provider notes in the result")
+			}
+		})
+	}
+}
+
+func TestCalculateCloudSubnetErrors(t *testing.T) {
+	tests := []struct{ ip, mask, cloud string }{
+		{"10.0.0.0", "/29", "aws"},
+		{"10.0.0.0", "/15", "aws"},
+		{"10.0.0.0", "/30", "azure"},
+		{"10.0.0.0", "/1", "azure"},
+		{"10.0.0.0", "/30", "gcp"},
+		{"10.0.0.0", "/3", "gcp"},
+		{"10.0.0.0", "/24", "oracle"},
+	}
+	for _, tt := range tests {
+		if _, err := calculateCloudSubnet(tt.ip, tt.mask, tt.cloud); err == nil {
+			t.Errorf("calculateCloudSubnet(%s, %s, %s) expected error, got nil", tt.ip, tt.mask, tt.cloud)
+		}
+	}
+
+	// Without a provider the standard calculation is unchanged
+	result, err := calculateCloudSubnet("10.0.0.0", "/29", "")
+	if err != nil || result.UsableHosts != "6" || result.Reserved != nil {
+		t.Errorf("plain /29 = %+v, %v", result, err)
+	}
+}
+
+func TestCalculateHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantHosts  string
+	}{
+		{"GET", http.MethodGet, "/api/v1/calculate?ip=192.168.1.10&mask=/24", "", http.StatusOK, "254"},
+		{"GET aws", http.MethodGet, "/api/v1/calculate?" + url.Values{"ip": {"10.0.0.0"}, "mask": {"/27"}, "cloud": {"aws"}}.Encode(), "", http.StatusOK, "27"},
+		{"POST", http.MethodPost, "/api/v1/calculate", `{"ip":"10.0.0.0","mask":"255.255.0.0","cloud":"aws"}`, http.StatusOK, "65531"},
+		{"too small for aws", http.MethodPost, "/api/v1/calculate", `{"ip":"10.0.0.0","mask":"/30","cloud":"aws"}`, http.StatusBadRequest, ""},
+		{"missing mask", http.MethodGet, "/api/v1/calculate?ip=10.0.0.1", "", http.StatusBadRequest, ""},
+		{"wrong method", http.MethodPut, "/api/v1/calculate", "", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			calculateHandler(rr, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantHosts == "" {
+				return
+			}
+			var result SubnetResult
+			if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+				t.Fatalf("invalid JSON response: %v", err)
+			}
+			if result.UsableHosts != tt.wantHosts {
+				t.Errorf("usable_hosts = %s, want %s", result.UsableHosts, tt.wantHosts)
+			}
+		})
+	}
+}
+
+func TestSubnetHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/subnet/{ip}/{mask}", revalidated(subnetHandler))
+	tests := []struct {
+		target      string
+		wantStatus  int
+		wantNetwork string
+	}{
+		{"/api/v1/subnet/192.168.1.0/24", http.StatusOK, "192.168.1.0"},
+		{"/api/v1/subnet/192.168.1.10/255.255.255.0", http.StatusOK, "192.168.1.0"},
+		{"/api/v1/subnet/10.0.1.77/0xffff0000", http.StatusOK, "10.0.0.0"},
+		{"/api/v1/subnet/3232235876/16", http.StatusOK, "192.168.0.0"},
+		{"/api/v1/subnet/10.0.0.0/27?cloud=aws", http.StatusOK, "10.0.0.0"},
+		{"/api/v1/subnet/10.0.0.0/33", http.StatusBadRequest, ""},
+		{"/api/v1/subnet/10.0.0.0/24?explain=maybe", http.StatusBadRequest, ""},
+		{"/api/v1/subnet/10.0.0.0", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d (body: %s)", tt.target, rr.Code, tt.wantStatus, rr.Body.String())
+			continue
+		}
+		if tt.wantNetwork == "" {
+			continue
+		}
+		var result SubnetResult
+		if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || result.NetworkAddress != tt.wantNetwork {
+			t.Errorf("%s: network_address = %q, want %s (%v)", tt.target, result.NetworkAddress, tt.wantNetwork, err)
+		}
+		if rr.Header().Get("ETag") == "" {
+			t.Errorf("%s: no ETag", tt.target)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/subnet/10.0.0.0/24", nil))
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "GET" {
+		t.Errorf("POST: status %d, Allow %q", rr.Code, rr.Header().Get("Allow"))
+	}
+}
+
+func TestHandlerPOSTCloud(t *testing.T) {
+	form := url.Values{"ip": {"10.0.0.0"}, "mask": {"/28"}, "cloud": {"aws"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	body := rr.Body.String()
+	for _, want := range []string{"10.0.0.4", ">11<", "VPC router", `<option value="aws" selected>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// Relationships between two compared networks. Two prefixes either nest or do not
+// overlap at all, so an overlap is always one of the containments or identical
+const (
+	relationIdentical = "identical"
+	relationAContains = "a_contains_b"
+	relationBContains = "b_contains_a"
+	relationDisjoint  = "disjoint"
+)
+
+// CompareRequest names the two networks to compare. Host bits are allowed and
+// cleared, so documented interface addresses such as 10.0.0.1/24 can be used
+type CompareRequest struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+// ComparedNetwork is one side of a comparison
+type ComparedNetwork struct {
+	Input     string `json:"input"`
+	Prefix    string `json:"prefix"`
+	First     string `json:"first_address"`
+	Last      string `json:"last_address"`
+	Addresses uint64 `json:"addresses"`
+}
+
+// CompareResponse reports how two networks relate. Supernet is the smallest prefix
+// covering both; Gap is the space strictly between disjoint networks, empty when
+// they are adjacent. SizeDifference is the addresses of A minus those of B
+type CompareResponse struct {
+	A                      ComparedNetwork `json:"a"`
+	B                      ComparedNetwork `json:"b"`
+	Relationship           string          `json:"relationship"`
+	Overlaps               bool            `json:"overlaps"`
+	Adjacent               bool            `json:"adjacent"`
+	Supernet               string          `json:"supernet"`
+	Gap                    []string        `json:"gap"`
+	GapAddresses           uint64          `json:"gap_addresses"`
+	SizeDifference         int64           `json:"size_difference"`
+	PrefixLengthDifference int             `json:"prefix_length_difference"`
+}
+
+func comparedNetwork(input string, network *net.IPNet) ComparedNetwork {
+	r := cidrset.PrefixToRange(network)
+	return ComparedNetwork{
+		Input:     input,
+		Prefix:    network.String(),
+		First:     uint32ToIP(r.First).String(),
+		Last:      uint32ToIP(r.Last).String(),
+		Addresses: r.Size(),
+	}
+}
+
+// compareNetworks works out the relationship, shared supernet, gap and size
+// difference of two networks
+func compareNetworks(req CompareRequest) (*CompareResponse, error) {
+	if req.A == "" || req.B == "" {
+		return nil, fmt.Errorf("a and b are required")
+	}
+	a, err := parseIPv4Prefix(req.A)
+	if err != nil {
+		return nil, fmt.Errorf("a: %v", err)
+	}
+	b, err := parseIPv4Prefix(req.B)
+	if err != nil {
+		return nil, fmt.Errorf("b: %v", err)
+	}
+	ra, rb := cidrset.PrefixToRange(a), cidrset.PrefixToRange(b)
+	onesA, _ := a.Mask.Size()
+	onesB, _ := b.Mask.Size()
+
+	resp := &CompareResponse{
+		A:                      comparedNetwork(req.A, a),
+		B:                      comparedNetwork(req.B, b),
+		Supernet:               coveringPrefix(min(ra.First, rb.First), max(ra.Last, rb.Last)).String(),
+		Gap:                    []string{},
+		SizeDifference:         int64(ra.Size()) - int64(rb.Size()),
+		PrefixLengthDifference: onesA - onesB,
+	}
+	switch {
+	case ra == rb:
+		resp.Relationship = relationIdentical
+	case prefixContains(a, b):
+		resp.Relationship = relationAContains
+	case prefixContains(b, a):
+		resp.Relationship = relationBContains
+	default:
+		resp.Relationship = relationDisjoint
+	}
+	resp.Overlaps = resp.Relationship != relationDisjoint
+	if !resp.Overlaps {
+		lower, upper := ra, rb
+		if rb.First < ra.First {
+			lower, upper = rb, ra
+		}
+		resp.Adjacent = lower.Last+1 == upper.First
+		if !resp.Adjacent {
+			gap := cidrset.Range{First: lower.Last + 1, Last: upper.First - 1}
+			resp.Gap = prefixStrings(cidrset.RangeToPrefixes(gap))
+			resp.GapAddresses = gap.Size()
+		}
+	}
+	return resp, nil
+}
+
+// compareHandler serves /api/v1/compare; POST takes a JSON body, GET takes the a and
+// b query parameters
+func compareHandler(w http.ResponseWriter, r *http.Request) {
+	var req CompareRequest
+
+	switch r.Method {
+	case http.MethodPost:
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+	case http.MethodGet:
+		req.A, req.B = r.URL.Query().Get("a"), r.URL.Query().Get("b")
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	resp, err := compareNetworks(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompareNetworks(t *testing.T) {
+	tests := []struct {
+		a, b         string
+		relationship string
+		supernet     string
+		gap          string
+		sizeDiff     int64
+		adjacent     bool
+	}{
+		{"10.0.0.1/24", "10.0.0.0/24", relationIdentical, "10.0.0.0/24", "", 0, false},
+		{"10.0.0.0/16", "10.0.5.0/24", relationAContains, "10.0.0.0/16", "", 65280, false},
+		{"10.0.5.0/24", "10.0.0.0/16", relationBContains, "10.0.0.0/16", "", -65280, false},
+		{"10.0.0.0/24", "10.0.1.0/24", relationDisjoint, "10.0.0.0/23", "", 0, true},
+		{"10.0.3.0/24", "10.0.0.0/24", relationDisjoint, "10.0.0.0/22", "10.0.1.0/24 10.0.2.0/24", 0, false},
+		{"192.168.0.0/30", "192.168.0.16/28", relationDisjoint, "192.168.0.0/27", "192.168.0.4/30 192.168.0.8/29", -12, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			resp, err := compareNetworks(CompareRequest{A: tt.a, B: tt.b})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Relationship != tt.relationship || resp.Supernet != tt.supernet || resp.SizeDifference != tt.sizeDiff || resp.Adjacent != tt.adjacent {
+				t.Errorf("compare = %+v", resp)
+			}
+			if gap := strings.Join(resp.Gap, " "); gap != tt.gap {
+				t.Errorf("gap = %q, want %q", gap, tt.gap)
+			}
+			if resp.Overlaps != (tt.relationship != relationDisjoint) {
+				t.Errorf("overlaps = %v for %s", resp.Overlaps, tt.relationship)
+			}
+		})
+	}
+
+	for _, req := range []CompareRequest{{A: "10.0.0.0/8"}, {A: "10.0.0.0/33", B: "10.0.0.0/8"}, {A: "10.0.0.0/8", B: "::/0"}} {
+		if _, err := compareNetworks(req); err == nil {
+			t.Errorf("compareNetworks(%+v) expected an error", req)
+		}
+	}
+}
+
+func TestCompareHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	compareHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/compare?a=172.16.0.0/12&b=172.20.1.0/24", nil))
+	var resp CompareResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if resp.Relationship != relationAContains || resp.PrefixLengthDifference != -12 || resp.B.Last != "172.20.1.255" {
+		t.Errorf("GET compare = %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	compareHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/compare", strings.NewReader(`{"a":"10.0.0.0/8"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("missing b status = %d, want 400", rr.Code)
+	}
+}
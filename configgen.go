@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// GenerateRequest is the common input to every config generator: the networks
+// to render and generator-specific options such as an ACL name or action
+type GenerateRequest struct {
+	Networks []string          `json:"networks"`
+	Options  map[string]string `json:"options,omitempty"`
+}
+
+// GenerateResponse is the JSON form of a generated configuration
+type GenerateResponse struct {
+	Generator string `json:"generator"`
+	Config    string `json:"config"`
+}
+
+// ConfigGenerator renders configuration text for a set of calculated networks
+type ConfigGenerator struct {
+	Name        string
+	Description string
+	// Filename is offered as the download name; empty means the text is shown inline
+	Filename string
+	Generate func(networks []*net.IPNet, opts generatorOptions) (string, error)
+}
+
+// generatorOptions gives typed access to the free-form options of a GenerateRequest
+type generatorOptions map[string]string
+
+// get returns the trimmed option value, or fallback when the option is unset
+func (o generatorOptions) get(name, fallback string) string {
+	if v := strings.TrimSpace(o[name]); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// oneOf returns the option value if it is one of the allowed values
+func (o generatorOptions) oneOf(name, fallback string, allowed ...string) (string, error) {
+	v := strings.ToLower(o.get(name, fallback))
+	for _, a := range allowed {
+		if v == a {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("invalid %s %q, must be one of: %s", name, v, strings.Join(allowed, ", "))
+}
+
+var (
+	configGeneratorsMu sync.RWMutex
+	configGenerators   = map[string]ConfigGenerator{}
+)
+
+// registerConfigGenerator makes a generator available under its name
+func registerConfigGenerator(g ConfigGenerator) {
+	configGeneratorsMu.Lock()
+	defer configGeneratorsMu.Unlock()
+	configGenerators[g.Name] = g
+}
+
+// lookupConfigGenerator returns the generator registered under name
+func lookupConfigGenerator(name string) (ConfigGenerator, bool) {
+	configGeneratorsMu.RLock()
+	defer configGeneratorsMu.RUnlock()
+	g, ok := configGenerators[name]
+	return g, ok
+}
+
+// listConfigGenerators returns every registered generator ordered by name
+func listConfigGenerators() []ConfigGenerator {
+	configGeneratorsMu.RLock()
+	defer configGeneratorsMu.RUnlock()
+	list := make([]ConfigGenerator, 0, len(configGenerators))
+	for _, g := range configGenerators {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// generateConfig validates the request and runs the named generator
+func generateConfig(name string, req GenerateRequest) (string, error) {
+	g, ok := lookupConfigGenerator(name)
+	if !ok {
+		return "", fmt.Errorf("unknown generator: %s", name)
+	}
+	if len(req.Networks) == 0 {
+		return "", fmt.Errorf("at least one network is required")
+	}
+	networks, err := parsePrefixList(req.Networks)
+	if err != nil {
+		return "", err
+	}
+	return g.Generate(networks, generatorOptions(req.Options))
+}
+
+// generateForSubnet runs a generator for the subnet of the calculator form. The entered
+// IP is passed as the address option unless it is the network or broadcast address, and
+// a requested DHCP layout as the gateway and percentage options
+func generateForSubnet(name, ipStr, maskStr string, dhcp *DHCPPoolOptions) (string, error) {
+	mask, err := parseSubnetMask(maskStr)
+	if err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(ipStr).To4()
+	if ip == nil {
+		return "", fmt.Errorf("not a valid IPv4 address: %s", ipStr)
+	}
+	network := &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+
+	opts := map[string]string{}
+	if dhcp != nil {
+		opts = dhcp.options()
+	}
+	if _, _, err := interfaceHostAddress(network, ip, "first"); err == nil {
+		opts["address"] = ip.String()
+	}
+	return generateConfig(name, GenerateRequest{Networks: []string{network.String()}, Options: opts})
+}
+
+// generateHandler serves /api/v1/generate/{generator}. POST takes a GenerateRequest
+// body; GET takes one or more network parameters with every other query parameter
+// passed as an option. The config is returned as text unless format=json is requested
+func generateHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("generator")
+	if name == "" {
+		name = r.URL.Query().Get("generator")
+	}
+
+	var req GenerateRequest
+	switch r.Method {
+	case http.MethodPost:
+		if !decodeJSONPost(w, r, &req) {
+			return
+		}
+	case http.MethodGet:
+		req.Options = map[string]string{}
+		for key, values := range r.URL.Query() {
+			switch key {
+			case "network":
+				for _, v := range values {
+					req.Networks = append(req.Networks, parsePrefixListQuery(v)...)
+				}
+			case "generator", "format":
+			default:
+				req.Options[key] = values[0]
+			}
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	config, err := generateConfig(name, req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if _, ok := lookupConfigGenerator(name); !ok {
+			status = http.StatusNotFound
+		}
+		writeJSONError(w, status, err.Error())
+		return
+	}
+
+	if responseFormat(r, "text") == "json" {
+		writeJSON(w, http.StatusOK, GenerateResponse{Generator: name, Config: config})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if g, _ := lookupConfigGenerator(name); g.Filename != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, g.Filename))
+	}
+	fmt.Fprint(w, config)
+}
+
+// generatorListHandler serves GET /api/v1/generate with the available generators
+func generatorListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("generator") != "" {
+		generateHandler(w, r)
+		return
+	}
+
+	type generatorInfo struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	list := []generatorInfo{}
+	for _, g := range listConfigGenerators() {
+		list = append(list, generatorInfo{Name: g.Name, Description: g.Description})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// wildcardMask returns the inverted subnet mask used by Cisco ACLs
+func wildcardMask(mask net.IPMask) string {
+	wildcard := make(net.IP, 4)
+	for i := 0; i < 4; i++ {
+		wildcard[i] = ^mask[i]
+	}
+	return wildcard.String()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGeneratorOptions(t *testing.T) {
+	opts := generatorOptions{"action": " Deny ", "empty": ""}
+	if got := opts.get("empty", "x"); got != "x" {
+		t.Errorf("get() of empty option = %q, want fallback", got)
+	}
+	if got, err := opts.oneOf("action", "permit", "permit", "deny"); err != nil || got != "deny" {
+		t.Errorf("oneOf() = %q, %v; want deny", got, err)
+	}
+	if _, err := (generatorOptions{"action": "drop"}).oneOf("action", "permit", "permit", "deny"); err == nil {
+		t.Error("oneOf() with invalid value expected error, got nil")
+	}
+}
+
+func TestRegisterConfigGenerator(t *testing.T) {
+	registerConfigGenerator(ConfigGenerator{
+		Name: "test-echo",
+		Generate: func(networks []*net.IPNet, opts generatorOptions) (string, error) {
+			return prefixStrings(networks)[0] + " " + opts.get("suffix", ""), nil
+		},
+	})
+	defer func() {
+		configGeneratorsMu.Lock()
+		delete(configGenerators, "test-echo")
+		configGeneratorsMu.Unlock()
+	}()
+
+	config, err := generateConfig("test-echo", GenerateRequest{Networks: []string{"10.0.0.1/24"}, Options: map[string]string{"suffix": "ok"}})
+	if err != nil || config != "10.0.0.0/24 ok" {
+		t.Errorf("generateConfig() = %q, %v", config, err)
+	}
+	if _, err := generateConfig("test-echo", GenerateRequest{}); err == nil {
+		t.Error("generateConfig() without networks expected error, got nil")
+	}
+	if _, err := generateConfig("nope", GenerateRequest{Networks: []string{"10.0.0.0/24"}}); err == nil {
+		t.Error("generateConfig() with unknown generator expected error, got nil")
+	}
+}
+
+func TestGenerateHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/generate", generatorListHandler)
+	mux.HandleFunc("/api/v1/generate/{generator}", generateHandler)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		body        string
+		wantStatus  int
+		wantContain string
+	}{
+		{"GET text", http.MethodGet, "/api/v1/generate/cisco-acl?network=192.168.1.0/24&action=deny", "", http.StatusOK, " deny ip 192.168.1.0 0.0.0.255 any"},
+		{"GET query generator", http.MethodGet, "/api/v1/generate?generator=cisco-acl&network=10.0.0.0/8", "", http.StatusOK, "10.0.0.0 0.255.255.255"},
+		{"POST json", http.MethodPost, "/api/v1/generate/cisco-acl?format=json", `{"networks":["10.0.0.0/30"]}`, http.StatusOK, `"generator":"cisco-acl"`},
+		{"list", http.MethodGet, "/api/v1/generate", "", http.StatusOK, `"name":"cisco-acl"`},
+		{"unknown generator", http.MethodGet, "/api/v1/generate/nope?network=10.0.0.0/8", "", http.StatusNotFound, "unknown generator"},
+		{"bad network", http.MethodGet, "/api/v1/generate/cisco-acl?network=10.0.0.0/99", "", http.StatusBadRequest, "invalid prefix"},
+		{"bad option", http.MethodGet, "/api/v1/generate/cisco-acl?network=10.0.0.0/8&action=drop", "", http.StatusBadRequest, "invalid action"},
+		{"wrong method", http.MethodDelete, "/api/v1/generate/cisco-acl", "", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantContain) {
+				t.Errorf("body %q does not contain %q", rr.Body.String(), tt.wantContain)
+			}
+		})
+	}
+}
+
+func TestGenerateHandlerJSONBody(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/generate/{generator}", generateHandler)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/generate/cisco-acl?format=json", strings.NewReader(`{"networks":["10.0.0.0/30"]}`)))
+	var resp GenerateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if !strings.Contains(resp.Config, "permit ip 10.0.0.0 0.0.0.3 any") {
+		t.Errorf("config = %q", resp.Config)
+	}
+}
+
+func TestGenerateForSubnet(t *testing.T) {
+	tests := []struct {
+		ip, mask string
+		want     string
+	}{
+		{"192.168.1.77", "255.255.255.0", " ip address 192.168.1.77 255.255.255.0\n"},
+		{"192.168.1.0", "/24", " ip address 192.168.1.1 255.255.255.0\n"},
+		{"192.168.1.255", "/24", " ip address 192.168.1.1 255.255.255.0\n"},
+	}
+	for _, tt := range tests {
+		got, err := generateForSubnet("cisco-interface", tt.ip, tt.mask, nil)
+		if err != nil {
+			t.Fatalf("generateForSubnet(%s, %s) unexpected error: %v", tt.ip, tt.mask, err)
+		}
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("generateForSubnet(%s, %s) = %q, want it to contain %q", tt.ip, tt.mask, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultCORSMethods = "GET, POST, PUT, PATCH, DELETE"
+	defaultCORSHeaders = "Authorization, Content-Type, X-API-Key, X-Request-ID"
+	// corsMaxAge is how long browsers may cache a preflight answer, in seconds
+	corsMaxAge = 600
+)
+
+// corsPolicy lists the origins that may call the JSON API from a browser and what
+// they may send
+type corsPolicy struct {
+	anyOrigin bool
+	origins   map[string]bool
+	methods   string
+	headers   string
+}
+
+// cors is nil while cross-origin requests are not allowed
+var cors *corsPolicy
+
+// configureCORS reads GO_SUBNET_CALCULATOR_CORS_ORIGINS, a comma separated list of
+// origins such as https://dashboard.example.com or *, and the optional
+// GO_SUBNET_CALCULATOR_CORS_METHODS and GO_SUBNET_CALCULATOR_CORS_HEADERS lists
+func configureCORS() error {
+	cors = nil
+	value := os.Getenv("GO_SUBNET_CALCULATOR_CORS_ORIGINS")
+	if value == "" {
+		recordSystemAudit("config.cors", "", "cross-origin requests disabled")
+		return nil
+	}
+	p := &corsPolicy{origins: map[string]bool{}, methods: defaultCORSMethods, headers: defaultCORSHeaders}
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_CORS_ORIGINS: invalid origin %q", origin)
+		}
+		p.origins[strings.ToLower(origin)] = true
+	}
+	var err error
+	if p.methods, err = corsList("GO_SUBNET_CALCULATOR_CORS_METHODS", p.methods, strings.ToUpper); err != nil {
+		return err
+	}
+	if p.headers, err = corsList("GO_SUBNET_CALCULATOR_CORS_HEADERS", p.headers, http.CanonicalHeaderKey); err != nil {
+		return err
+	}
+	cors = p
+	recordSystemAudit("config.cors", "", "allowed origins %s, methods %s, headers %s", value, p.methods, p.headers)
+	return nil
+}
+
+// corsList reads a comma separated list of tokens from an environment variable
+func corsList(name, fallback string, normalize func(string) string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" || strings.ContainsAny(item, " \t\"()/:;<=>?@[\\]{}") {
+			return "", fmt.Errorf("%s: invalid entry %q", name, item)
+		}
+		items = append(items, normalize(item))
+	}
+	return strings.Join(items, ", "), nil
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or "" when
+// the origin may not call the API
+func (p *corsPolicy) allowOrigin(origin string) string {
+	if p.anyOrigin {
+		return "*"
+	}
+	if p.origins[strings.ToLower(origin)] {
+		return origin
+	}
+	return ""
+}
+
+// allowCORS adds CORS headers to /api/ responses for allowed origins and answers their
+// preflight requests itself, before authentication, as browsers send them without
+// credentials. Requests from other origins pass through without CORS headers, so
+// browsers keep their responses from the calling page
+func allowCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if cors == nil || origin == "" || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowed := cors.allowOrigin(origin)
+		if allowed == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			w.Header().Set("Access-Control-Expose-Headers", requestIDHeader)
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", cors.methods)
+		w.Header().Set("Access-Control-Allow-Headers", cors.headers)
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
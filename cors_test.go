@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// withTestCORS configures CORS from origins and methods, restoring the policy afterwards
+func withTestCORS(t *testing.T, origins, methods string) {
+	t.Helper()
+	previous := cors
+	t.Setenv("GO_SUBNET_CALCULATOR_CORS_ORIGINS", origins)
+	t.Setenv("GO_SUBNET_CALCULATOR_CORS_METHODS", methods)
+	if err := configureCORS(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cors = previous })
+}
+
+func TestConfigureCORS(t *testing.T) {
+	withTestAudit(t)
+	previous := cors
+	t.Cleanup(func() { cors = previous })
+	for _, origins := range []string{"dashboard.example.com", "ftp://example.com", "https://example.com/app"} {
+		t.Setenv("GO_SUBNET_CALCULATOR_CORS_ORIGINS", origins)
+		if err := configureCORS(); err == nil {
+			t.Errorf("origins %q: expected an error", origins)
+		}
+	}
+	t.Setenv("GO_SUBNET_CALCULATOR_CORS_ORIGINS", "https://example.com")
+	t.Setenv("GO_SUBNET_CALCULATOR_CORS_HEADERS", "x-request-id, bad header")
+	if err := configureCORS(); err == nil {
+		t.Error("expected an error for a header with a space")
+	}
+	t.Setenv("GO_SUBNET_CALCULATOR_CORS_HEADERS", "x-request-id,content-type")
+	if err := configureCORS(); err != nil || cors.headers != "X-Request-Id, Content-Type" {
+		t.Errorf("headers = %v, %v", cors, err)
+	}
+}
+
+func TestAllowCORS(t *testing.T) {
+	withTestAudit(t)
+	withTestAPIKeys(t, true, "")
+	withTestCORS(t, "https://dashboard.example.com, http://localhost:3000/", "get,post")
+	h := allowCORS(requireAPIKey(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	call := func(method, path, origin string, preflight bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if preflight {
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			r.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		return rr
+	}
+
+	// preflights carry no API key and must not be refused by authentication
+	rr := call(http.MethodOptions, "/api/v1/calculate", "https://dashboard.example.com", true)
+	if rr.Code != http.StatusNoContent || rr.Header().Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" ||
+		rr.Header().Get("Access-Control-Allow-Methods") != "GET, POST" || rr.Header().Get("Access-Control-Allow-Headers") != defaultCORSHeaders {
+		t.Errorf("preflight = %d %v", rr.Code, rr.Header())
+	}
+	if rr := call(http.MethodOptions, "/api/v1/calculate", "http://localhost:3000", true); rr.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
+		t.Errorf("preflight from a configured origin with a trailing slash = %v", rr.Header())
+	}
+
+	rr = call(http.MethodOptions, "/api/v1/calculate", "https://evil.example.com", true)
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get("Access-Control-Allow-Origin") != "" || rr.Header().Get("Vary") != "Origin" {
+		t.Errorf("preflight from another origin = %d %v", rr.Code, rr.Header())
+	}
+
+	// the browser needs the CORS headers to read an error response too
+	rr = call(http.MethodGet, "/api/v1/calculate", "https://dashboard.example.com", false)
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" {
+		t.Errorf("cross-origin GET = %d %v", rr.Code, rr.Header())
+	}
+	if rr := call(http.MethodGet, "/", "https://dashboard.example.com", false); rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("web page got CORS headers: %v", rr.Header())
+	}
+
+	withTestCORS(t, "*", "")
+	rr = call(http.MethodOptions, "/api/v1/calculate", "https://anywhere.example.net", true)
+	if rr.Header().Get("Access-Control-Allow-Origin") != "*" || rr.Header().Get("Access-Control-Allow-Methods") != defaultCORSMethods {
+		t.Errorf("wildcard preflight = %v", rr.Header())
+	}
+}
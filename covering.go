@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// CoverRequest lists the addresses to cover and an optional cap on the number of prefixes
+type CoverRequest struct {
+	Addresses   []string `json:"addresses"`
+	MaxPrefixes int      `json:"max_prefixes,omitempty"`
+}
+
+// CoverResponse holds the single covering prefix and, if requested, the smallest covering set
+type CoverResponse struct {
+	Addresses        int      `json:"addresses"`
+	CoveringPrefix   string   `json:"covering_prefix"`
+	CoveredAddresses uint64   `json:"covered_addresses"`
+	Prefixes         []string `json:"prefixes,omitempty"`
+	SetAddresses     uint64   `json:"set_addresses,omitempty"`
+}
+
+// parseIPv4List parses addresses, skipping duplicates, and returns them sorted
+func parseIPv4List(list []string) ([]uint32, error) {
+	seen := make(map[uint32]bool, len(list))
+	addrs := make([]uint32, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		ip := net.ParseIP(s)
+		if ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf("invalid IPv4 address: %s", s)
+		}
+		n := ipToUint32(ip)
+		if !seen[n] {
+			seen[n] = true
+			addrs = append(addrs, n)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs, nil
+}
+
+// coveringPrefix returns the smallest single prefix containing both a and b
+func coveringPrefix(a, b uint32) *net.IPNet {
+	prefixLen := bits.LeadingZeros32(a ^ b)
+	mask := net.CIDRMask(prefixLen, 32)
+	return &net.IPNet{IP: uint32ToIP(a).Mask(mask), Mask: mask}
+}
+
+// maxCoverPrefixes bounds max_prefixes while it is below the number of addresses: the
+// covering set takes time in proportion to the addresses times max_prefixes
+const maxCoverPrefixes = 1024
+
+// coverNode is a branch of the binary trie of the addresses: the smallest prefix
+// holding some of them, split where their next bit differs
+type coverNode struct {
+	network     *net.IPNet
+	left, right *coverNode
+	// split[k] is how many of the best k prefixes go to left, 0 to use network itself
+	split []int
+}
+
+// coverTrie builds the trie of addrs, sorted and distinct, for sets of at most
+// maxPrefixes prefixes. cost[k] is the fewest addresses that at most k prefixes
+// covering addrs cover; index 0 is unused
+func coverTrie(addrs []uint32, maxPrefixes int) (node *coverNode, cost []uint64) {
+	network := coveringPrefix(addrs[0], addrs[len(addrs)-1])
+	node = &coverNode{network: network}
+	if len(addrs) == 1 {
+		return node, []uint64{math.MaxUint64, 1}
+	}
+	ones, _ := network.Mask.Size()
+	bit := uint32(1) << (31 - ones)
+	mid := sort.Search(len(addrs), func(i int) bool { return addrs[i]&bit != 0 })
+	var left, right []uint64
+	node.left, left = coverTrie(addrs[:mid], maxPrefixes)
+	node.right, right = coverTrie(addrs[mid:], maxPrefixes)
+
+	// One prefix is the branch itself; more are shared between both halves, which
+	// always covers less
+	n := min(len(left)+len(right)-2, maxPrefixes)
+	cost = make([]uint64, n+1)
+	node.split = make([]int, n+1)
+	cost[0], cost[1] = math.MaxUint64, uint64(1)<<(32-ones)
+	for k := 2; k <= n; k++ {
+		cost[k] = math.MaxUint64
+		for l := max(1, k-len(right)+1); l <= min(len(left)-1, k-1); l++ {
+			if c := left[l] + right[k-l]; c < cost[k] {
+				cost[k], node.split[k] = c, l
+			}
+		}
+	}
+	return node, cost
+}
+
+// prefixes appends the best k prefixes of node to out
+func (node *coverNode) prefixes(k int, out []*net.IPNet) []*net.IPNet {
+	if node.left == nil || node.split[k] == 0 {
+		return append(out, node.network)
+	}
+	out = node.left.prefixes(node.split[k], out)
+	return node.right.prefixes(k-node.split[k], out)
+}
+
+// coveringSet finds at most maxPrefixes prefixes that cover every address while
+// covering as few addresses as possible. Every prefix of an optimal set is a branch
+// of the binary trie of the sorted addresses, so a dynamic program over the trie
+// computes, for each branch and count, the least space that count of prefixes can
+// cover its addresses with: the branch itself, or the best split of the count
+// between its two halves
+func coveringSet(addrs []uint32, maxPrefixes int) []*net.IPNet {
+	if len(addrs) == 0 {
+		return nil
+	}
+	if maxPrefixes >= len(addrs) {
+		prefixes := make([]*net.IPNet, len(addrs))
+		for i, a := range addrs {
+			prefixes[i] = coveringPrefix(a, a)
+		}
+		return prefixes
+	}
+	root, cost := coverTrie(addrs, maxPrefixes)
+	return root.prefixes(len(cost)-1, nil)
+}
+
+// coverHandler serves POST /api/v1/cover
+func coverHandler(w http.ResponseWriter, r *http.Request) {
+	var req CoverRequest
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+
+	addrs, err := parseIPv4List(req.Addresses)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(addrs) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "at least one address is required")
+		return
+	}
+	if len(addrs) > maxPrefixListLen {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("at most %d addresses are supported", maxPrefixListLen))
+		return
+	}
+
+	covering := coveringPrefix(addrs[0], addrs[len(addrs)-1])
+	resp := CoverResponse{
+		Addresses:        len(addrs),
+		CoveringPrefix:   covering.String(),
+		CoveredAddresses: prefixAddressCount([]*net.IPNet{covering}),
+	}
+
+	if req.MaxPrefixes > maxCoverPrefixes && req.MaxPrefixes < len(addrs) {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("max_prefixes must be at most %d, or at least the number of addresses", maxCoverPrefixes))
+		return
+	}
+	if req.MaxPrefixes > 0 {
+		set := coveringSet(addrs, req.MaxPrefixes)
+		resp.Prefixes = prefixStrings(set)
+		resp.SetAddresses = prefixAddressCount(set)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCoveringPrefix(t *testing.T) {
+	tests := []struct {
+		addrs    []string
+		expected string
+	}{
+		{[]string{"192.168.1.10"}, "192.168.1.10/32"},
+		{[]string{"192.168.1.10", "192.168.1.11"}, "192.168.1.10/31"},
+		{[]string{"192.168.1.1", "192.168.1.200", "192.168.1.77"}, "192.168.1.0/24"},
+		{[]string{"10.0.0.1", "10.255.0.1"}, "10.0.0.0/8"},
+		{[]string{"1.1.1.1", "200.1.1.1"}, "0.0.0.0/0"},
+	}
+
+	for _, tt := range tests {
+		addrs, err := parseIPv4List(tt.addrs)
+		if err != nil {
+			t.Fatalf("parseIPv4List(%v) unexpected error: %v", tt.addrs, err)
+		}
+		if got := coveringPrefix(addrs[0], addrs[len(addrs)-1]).String(); got != tt.expected {
+			t.Errorf("coveringPrefix(%v) = %s, want %s", tt.addrs, got, tt.expected)
+		}
+	}
+}
+
+func TestCoveringSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		addrs    []string
+		max      int
+		expected []string
+	}{
+		{
+			name:     "two clusters",
+			addrs:    []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "192.168.5.20", "192.168.5.21"},
+			max:      2,
+			expected: []string{"10.0.0.0/30", "192.168.5.20/31"},
+		},
+		{
+			name:     "limit not reached",
+			addrs:    []string{"10.0.0.1", "10.0.0.9"},
+			max:      5,
+			expected: []string{"10.0.0.1/32", "10.0.0.9/32"},
+		},
+		{
+			name:     "single prefix",
+			addrs:    []string{"10.0.0.1", "10.0.0.9", "10.0.0.200"},
+			max:      1,
+			expected: []string{"10.0.0.0/24"},
+		},
+		{
+			name:     "merge absorbs neighbors",
+			addrs:    []string{"10.0.0.0", "10.0.0.3", "10.0.0.1", "10.0.0.7", "10.0.1.0"},
+			max:      2,
+			expected: []string{"10.0.0.0/29", "10.0.1.0/32"},
+		},
+		{
+			// Merging the closest pairs first would give 10.0.0.16/28, 10.0.0.48/30
+			// and 10.0.0.58/32, 21 addresses
+			name:     "closest pairs are not merged first",
+			addrs:    []string{"10.0.0.17", "10.0.0.30", "10.0.0.49", "10.0.0.50", "10.0.0.58"},
+			max:      3,
+			expected: []string{"10.0.0.17/32", "10.0.0.30/32", "10.0.0.48/28"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, err := parseIPv4List(tt.addrs)
+			if err != nil {
+				t.Fatalf("parseIPv4List() unexpected error: %v", err)
+			}
+			got := prefixStrings(coveringSet(addrs, tt.max))
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("coveringSet() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseIPv4ListDeduplicates(t *testing.T) {
+	addrs, err := parseIPv4List([]string{"10.0.0.2", " 10.0.0.1", "10.0.0.2"})
+	if err != nil {
+		t.Fatalf("parseIPv4List() unexpected error: %v", err)
+	}
+	if len(addrs) != 2 || addrs[0] > addrs[1] {
+		t.Errorf("parseIPv4List() = %v, want two sorted addresses", addrs)
+	}
+	if _, err := parseIPv4List([]string{"::1"}); err == nil {
+		t.Error("parseIPv4List() with IPv6 expected error, got nil")
+	}
+}
+
+func TestCoverHandler(t *testing.T) {
+	body := `{"addresses":["10.0.0.1","10.0.0.2","10.0.0.3","10.0.3.9"],"max_prefixes":2}`
+	rr := httptest.NewRecorder()
+	coverHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/cover", strings.NewReader(body)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body: %s)", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var resp CoverResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if resp.CoveringPrefix != "10.0.0.0/22" || resp.CoveredAddresses != 1024 {
+		t.Errorf("covering = %s (%d), want 10.0.0.0/22 (1024)", resp.CoveringPrefix, resp.CoveredAddresses)
+	}
+	if !reflect.DeepEqual(resp.Prefixes, []string{"10.0.0.0/30", "10.0.3.9/32"}) || resp.SetAddresses != 5 {
+		t.Errorf("prefixes = %v (%d), want [10.0.0.0/30 10.0.3.9/32] (5)", resp.Prefixes, resp.SetAddresses)
+	}
+
+	addrs := make([]string, 1100)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("10.0.%d.%d", i/256, i%256*7%256)
+	}
+	list, _ := json.Marshal(addrs)
+	tooMany := fmt.Sprintf(`{"addresses":%s,"max_prefixes":1050}`, list)
+	for _, body := range []string{`{"addresses":[]}`, `{"addresses":["x"]}`, `{`, tooMany} {
+		rr := httptest.NewRecorder()
+		coverHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/cover", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("body %s: status = %d, want %d", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
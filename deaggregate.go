@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DeaggregateRequest asks for a prefix to be split to a target length or to have carve-outs removed
+type DeaggregateRequest struct {
+	Prefix  string   `json:"prefix"`
+	Length  int      `json:"length,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// PrefixListResponse is the JSON body returned by operations that produce a list of prefixes
+type PrefixListResponse struct {
+	Prefix   string   `json:"prefix"`
+	Prefixes []string `json:"prefixes"`
+	Count    int      `json:"count"`
+}
+
+// deaggregate performs the split or exclusion described by the request
+func deaggregate(req DeaggregateRequest) ([]*net.IPNet, error) {
+	network, err := parseIPv4Prefix(req.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(req.Exclude) == 0 {
+		if req.Length == 0 {
+			return nil, fmt.Errorf("either a target length or a list of carve-outs is required")
+		}
+		return splitPrefix(network, req.Length)
+	}
+
+	carveOuts, err := parsePrefixList(req.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := excludePrefixes(network, carveOuts)
+	if req.Length == 0 {
+		return prefixes, nil
+	}
+
+	// Optionally break the remaining space down further to the target length
+	var split []*net.IPNet
+	for _, p := range prefixes {
+		ones, _ := p.Mask.Size()
+		if ones >= req.Length {
+			split = append(split, p)
+			continue
+		}
+		parts, err := splitPrefix(p, req.Length)
+		if err != nil {
+			return nil, err
+		}
+		split = append(split, parts...)
+		if len(split) > maxPrefixListLen {
+			return nil, fmt.Errorf("result would contain more than %d prefixes", maxPrefixListLen)
+		}
+	}
+	return split, nil
+}
+
+// parsePrefixListQuery reads a comma- or newline-separated list of prefixes from a form value
+func parsePrefixListQuery(value string) []string {
+	var list []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' || r == ' ' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// isPrefixListFormat reports whether writePrefixList renders format as something other
+// than its JSON response
+func isPrefixListFormat(format string) bool {
+	switch format {
+	case "text", "csv", "xlsx", "markdown", "svg", "dot", targetsNmap, targetsMasscan,
+		"terraform", "hcl", "ansible", "rpsl", "cisco-prefix-list", "juniper-prefix-list":
+		return true
+	}
+	return false
+}
+
+// writePrefixList writes a list of prefixes as JSON, as plain text one prefix per line,
+// as CSV, Excel workbook or Markdown table, as an SVG or DOT subnet tree, as an nmap or
+// masscan target list or through a config generator (terraform/hcl, ansible, rpsl or
+// a prefix-list)
+func writePrefixList(w http.ResponseWriter, r *http.Request, prefix string, prefixes []*net.IPNet) {
+	list := prefixStrings(prefixes)
+	switch responseFormat(r, "json") {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, p := range list {
+			fmt.Fprintln(w, p)
+		}
+		return
+	case "csv":
+		writeSubnetCSV(w, "prefixes.csv", prefixRows(prefixes))
+		return
+	case "xlsx":
+		writeXLSXDownload(w, "prefixes.xlsx", subnetSheets(prefixRows(prefixes)))
+		return
+	case "markdown":
+		title := "Prefixes"
+		if prefix != "" {
+			title = prefix
+		}
+		writeSubnetMarkdown(w, title, prefixRows(prefixes))
+		return
+	case "svg", "dot":
+		var parent *net.IPNet
+		if prefix != "" {
+			parent, _ = parseIPv4Prefix(prefix)
+		}
+		writeSubnetDiagram(w, responseFormat(r, "json"), parent, prefixRows(prefixes))
+		return
+	case targetsNmap, targetsMasscan:
+		writeScanTargets(w, r, r.URL.Query(), responseFormat(r, "json"), prefixes, nil)
+		return
+	case "terraform", "hcl":
+		writeGenerated(w, r, "terraform", prefixes)
+		return
+	case "ansible":
+		writeGenerated(w, r, "ansible-inventory", prefixes)
+		return
+	case "rpsl", "cisco-prefix-list", "juniper-prefix-list":
+		writeGenerated(w, r, responseFormat(r, "json"), prefixes)
+		return
+	}
+	writeJSON(w, http.StatusOK, PrefixListResponse{Prefix: prefix, Prefixes: list, Count: len(list)})
+}
+
+// writeGenerated renders a prefix list with the named config generator, passing
+// every query parameter as a generator option
+func writeGenerated(w http.ResponseWriter, r *http.Request, generator string, prefixes []*net.IPNet) {
+	g, _ := lookupConfigGenerator(generator)
+	opts := generatorOptions{}
+	for key, values := range r.URL.Query() {
+		opts[key] = values[0]
+	}
+	config, err := g.Generate(prefixes, opts)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, config)
+}
+
+// deaggregateHandler serves /api/v1/deaggregate; POST takes a JSON body, GET takes query parameters
+func deaggregateHandler(w http.ResponseWriter, r *http.Request) {
+	var req DeaggregateRequest
+
+	switch r.Method {
+	case http.MethodPost:
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Prefix = query.Get("prefix")
+		req.Exclude = parsePrefixListQuery(query.Get("exclude"))
+		if length := strings.TrimPrefix(query.Get("length"), "/"); length != "" {
+			n, err := strconv.Atoi(length)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid length: "+length)
+				return
+			}
+			req.Length = n
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	prefixes, err := deaggregate(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writePrefixList(w, r, req.Prefix, prefixes)
+}
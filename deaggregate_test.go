@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeaggregateHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantCount  int
+	}{
+		{"split via GET", http.MethodGet, "/api/v1/deaggregate?prefix=10.0.0.0/16&length=/18", "", http.StatusOK, 4},
+		{"exclude via POST", http.MethodPost, "/api/v1/deaggregate", `{"prefix":"10.0.0.0/8","exclude":["10.1.0.0/16"]}`, http.StatusOK, 8},
+		{"exclude then split", http.MethodPost, "/api/v1/deaggregate", `{"prefix":"10.0.0.0/22","exclude":["10.0.1.0/24"],"length":24}`, http.StatusOK, 3},
+		{"missing operation", http.MethodGet, "/api/v1/deaggregate?prefix=10.0.0.0/8", "", http.StatusBadRequest, 0},
+		{"invalid prefix", http.MethodPost, "/api/v1/deaggregate", `{"prefix":"10.0.0.300/8","length":9}`, http.StatusBadRequest, 0},
+		{"invalid JSON", http.MethodPost, "/api/v1/deaggregate", `{`, http.StatusBadRequest, 0},
+		{"wrong method", http.MethodDelete, "/api/v1/deaggregate", "", http.StatusMethodNotAllowed, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			deaggregateHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp PrefixListResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON response: %v", err)
+			}
+			if resp.Count != tt.wantCount || len(resp.Prefixes) != tt.wantCount {
+				t.Errorf("count = %d (%d prefixes), want %d", resp.Count, len(resp.Prefixes), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestDeaggregateHandlerTextFormat(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/deaggregate?prefix=192.168.0.0/23&length=24&format=text", nil)
+	rr := httptest.NewRecorder()
+	deaggregateHandler(rr, req)
+
+	if rr.Body.String() != "192.168.0.0/24\n192.168.1.0/24\n" {
+		t.Errorf("text output = %q", rr.Body.String())
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+// DHCPPoolOptions asks for a suggested DHCP layout of a calculated subnet: the gateway
+// on the first or last usable address, StaticPercent of the other addresses kept
+// beside it for static assignments and PoolPercent handed out by DHCP (default the
+// rest). They are the gateway, static_percent and pool_percent generator options
+type DHCPPoolOptions struct {
+	Gateway       string `json:"gateway,omitempty"`
+	StaticPercent int    `json:"static_percent,omitempty"`
+	PoolPercent   int    `json:"pool_percent,omitempty"`
+}
+
+// DHCPSuggestion is the suggested gateway, static range and DHCP pool of a subnet
+type DHCPSuggestion struct {
+	Gateway         string `json:"gateway"`
+	StaticStart     string `json:"static_start,omitempty"`
+	StaticEnd       string `json:"static_end,omitempty"`
+	StaticAddresses uint32 `json:"static_addresses"`
+	PoolStart       string `json:"pool_start"`
+	PoolEnd         string `json:"pool_end"`
+	PoolAddresses   uint32 `json:"pool_addresses"`
+}
+
+// options renders the layout as DHCP generator options
+func (o DHCPPoolOptions) options() map[string]string {
+	opts := map[string]string{"gateway": o.Gateway, "static_percent": strconv.Itoa(o.StaticPercent)}
+	if o.PoolPercent != 0 {
+		opts["pool_percent"] = strconv.Itoa(o.PoolPercent)
+	}
+	return opts
+}
+
+// dhcpPoolQuery reads the gateway, static_percent and pool_percent query parameters
+// of a request that asked for a suggestion with dhcp=true; it returns nil otherwise
+func dhcpPoolQuery(query url.Values) (*DHCPPoolOptions, error) {
+	if query.Get("dhcp") == "" {
+		return nil, nil
+	}
+	if suggest, err := strconv.ParseBool(query.Get("dhcp")); err != nil {
+		return nil, fmt.Errorf("dhcp must be true or false")
+	} else if !suggest {
+		return nil, nil
+	}
+	o := &DHCPPoolOptions{Gateway: query.Get("gateway")}
+	for name, field := range map[string]*int{"static_percent": &o.StaticPercent, "pool_percent": &o.PoolPercent} {
+		if v := query.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s", name, v)
+			}
+			*field = n
+		}
+	}
+	return o, nil
+}
+
+// suggestDHCPPool lays out the subnet of an address and mask the way the DHCP config
+// generators do with the same options. Cloud subnets are left out, as the provider
+// runs their gateway and DHCP
+func suggestDHCPPool(ipStr, maskStr, cloud string, o DHCPPoolOptions) (*DHCPSuggestion, error) {
+	if cloud != "" {
+		return nil, fmt.Errorf("DHCP suggestions are not available for %s subnets, the provider runs their gateway and DHCP", cloud)
+	}
+	mask, err := parseSubnetMask(maskStr)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(ipStr).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("not a valid IPv4 address: %s", ipStr)
+	}
+	subnets, err := planDHCPSubnets([]*net.IPNet{{IP: ip.Mask(mask), Mask: mask}}, o.options())
+	if err != nil {
+		return nil, err
+	}
+	s := subnets[0]
+	suggestion := &DHCPSuggestion{
+		Gateway:       s.router.String(),
+		PoolStart:     s.poolStart.String(),
+		PoolEnd:       s.poolEnd.String(),
+		PoolAddresses: ipToUint32(s.poolEnd) - ipToUint32(s.poolStart) + 1,
+	}
+	if s.staticStart != nil {
+		suggestion.StaticStart, suggestion.StaticEnd = s.staticStart.String(), s.staticEnd.String()
+		suggestion.StaticAddresses = ipToUint32(s.staticEnd) - ipToUint32(s.staticStart) + 1
+	}
+	return suggestion, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSuggestDHCPPool(t *testing.T) {
+	got, err := suggestDHCPPool("192.168.1.77", "/24", "", DHCPPoolOptions{StaticPercent: 20})
+	want := DHCPSuggestion{Gateway: "192.168.1.1", StaticStart: "192.168.1.2", StaticEnd: "192.168.1.51", StaticAddresses: 50, PoolStart: "192.168.1.52", PoolEnd: "192.168.1.254", PoolAddresses: 203}
+	if err != nil || *got != want {
+		t.Errorf("suggestDHCPPool() = %+v, %v, want %+v", got, err, want)
+	}
+
+	got, err = suggestDHCPPool("10.0.0.0", "255.255.255.0", "", DHCPPoolOptions{Gateway: "last", PoolPercent: 50})
+	want = DHCPSuggestion{Gateway: "10.0.0.254", PoolStart: "10.0.0.128", PoolEnd: "10.0.0.253", PoolAddresses: 126}
+	if err != nil || *got != want {
+		t.Errorf("suggestDHCPPool() = %+v, %v, want %+v", got, err, want)
+	}
+
+	for _, o := range []DHCPPoolOptions{{Gateway: "middle"}, {StaticPercent: 101}, {StaticPercent: 70, PoolPercent: 40}} {
+		if got, err := suggestDHCPPool("10.0.0.0", "/24", "", o); err == nil {
+			t.Errorf("suggestDHCPPool(%+v) = %+v, want an error", o, got)
+		}
+	}
+	if got, err := suggestDHCPPool("10.0.0.0", "/31", "", DHCPPoolOptions{}); err == nil {
+		t.Errorf("suggestDHCPPool(/31) = %+v, want an error", got)
+	}
+	if got, err := suggestDHCPPool("10.0.0.0", "/24", "aws", DHCPPoolOptions{}); err == nil {
+		t.Errorf("suggestDHCPPool() of a cloud subnet = %+v, want an error", got)
+	}
+}
+
+func TestCalculateHandlerDHCP(t *testing.T) {
+	rr := httptest.NewRecorder()
+	calculateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=10.1.0.0&mask=/28&dhcp=true&gateway=last&static_percent=50", nil))
+	var result SubnetResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || rr.Code != http.StatusOK || result.DHCP == nil || result.DHCP.StaticStart != "10.1.0.8" || result.DHCP.PoolEnd != "10.1.0.7" {
+		t.Errorf("GET: status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	calculateHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/calculate?format=markdown", strings.NewReader(`{"ip":"10.1.0.0","mask":"/24","dhcp":{"static_percent":10}}`)))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "| static | 10.1.0.2 | 10.1.0.26 | 25 |") {
+		t.Errorf("POST: status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	calculateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=10.1.0.0&mask=/24", nil))
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), `"dhcp"`) {
+		t.Errorf("GET without dhcp: status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	for _, query := range []string{"dhcp=maybe", "dhcp=true&static_percent=ten", "dhcp=true&pool_percent=101", "dhcp=true&cloud=aws"} {
+		rr = httptest.NewRecorder()
+		calculateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=10.1.0.0&mask=/24&"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("GET with %s: status %d", query, rr.Code)
+		}
+	}
+}
+
+func TestHandlerPOSTDHCP(t *testing.T) {
+	form := url.Values{"ip": {"192.168.1.0"}, "mask": {"/24"}, "dhcp": {"1"}, "gateway": {"last"}, "static_percent": {"10"}, "generator": {"isc-dhcpd"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	body := rr.Body.String()
+	for _, want := range []string{"192.168.1.229 - 192.168.1.253", "# static addresses 192.168.1.229 - 192.168.1.253", "range 192.168.1.1 192.168.1.228;", `<option value="last" selected>`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("handler should show %q, got:\n%s", want, body)
+		}
+	}
+}
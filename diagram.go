@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxDiagramSubnets bounds the subnets drawn in one diagram; larger plans are refused
+// rather than rendered unreadably
+const maxDiagramSubnets = 512
+
+// Box sizes and gaps of the SVG layout, in pixels
+const (
+	diagramBoxWidth  = 180
+	diagramBoxHeight = 40
+	diagramColumnGap = 40
+	diagramRowGap    = 10
+	diagramMargin    = 10
+)
+
+// subnetTreeNode is one prefix of a subnet tree. The planned subnets carry their row;
+// the other nodes are the parent and the supernets where the plan branches
+type subnetTreeNode struct {
+	Prefix   *net.IPNet
+	Row      *SubnetRow
+	Children []*subnetTreeNode
+
+	depth int
+	row   float64
+}
+
+// buildSubnetTree arranges rows under parent as a compressed binary tree: every inner
+// node is the smallest supernet of the subnets below it, so the diagram shows where
+// address space is split without drawing every intermediate prefix. A nil parent is
+// the smallest prefix covering every row
+func buildSubnetTree(parent *net.IPNet, rows []SubnetRow) (*subnetTreeNode, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no subnets to draw")
+	}
+	if len(rows) > maxDiagramSubnets {
+		return nil, fmt.Errorf("diagrams are limited to %d subnets, got %d", maxDiagramSubnets, len(rows))
+	}
+	items := make([]diagramItem, 0, len(rows))
+	for i := range rows {
+		network, err := parseIPv4Prefix(rows[i].Prefix)
+		if err != nil {
+			return nil, err
+		}
+		if parent != nil && !prefixContains(parent, network) {
+			return nil, fmt.Errorf("%s is not inside %s", network, parent)
+		}
+		items = append(items, diagramItem{network: network, row: &rows[i]})
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := ipToUint32(items[i].network.IP), ipToUint32(items[j].network.IP)
+		if a != b {
+			return a < b
+		}
+		oi, _ := items[i].network.Mask.Size()
+		oj, _ := items[j].network.Mask.Size()
+		return oi < oj
+	})
+	if parent == nil {
+		parent = coveringItems(items)
+	}
+	return subnetSubtree(parent, items), nil
+}
+
+type diagramItem struct {
+	network *net.IPNet
+	row     *SubnetRow
+}
+
+// coveringItems returns the smallest prefix containing every item, which are sorted
+func coveringItems(items []diagramItem) *net.IPNet {
+	first := ipToUint32(items[0].network.IP)
+	last := uint32(0)
+	for _, item := range items {
+		_, end := prefixBounds(item.network)
+		last = max(last, end)
+	}
+	return coveringPrefix(first, last)
+}
+
+// prefixBounds returns the first and last address of a prefix
+func prefixBounds(network *net.IPNet) (uint32, uint32) {
+	first := ipToUint32(network.IP)
+	return first, first | ^ipToUint32(net.IP(network.Mask))
+}
+
+// subnetSubtree builds the node of prefix with the items inside it. Repeated subnets
+// are drawn once
+func subnetSubtree(prefix *net.IPNet, items []diagramItem) *subnetTreeNode {
+	node := &subnetTreeNode{Prefix: prefix}
+	var rest []diagramItem
+	for _, item := range items {
+		switch {
+		case item.network.String() != prefix.String():
+			rest = append(rest, item)
+		case node.Row == nil:
+			node.Row = item.row
+		}
+	}
+	if len(rest) == 0 {
+		return node
+	}
+
+	// split the rest by the first host bit of prefix; each half becomes one child
+	ones, _ := prefix.Mask.Size()
+	var halves [2][]diagramItem
+	for _, item := range rest {
+		bit := 0
+		if ones < 32 && ipToUint32(item.network.IP)&(1<<uint(31-ones)) != 0 {
+			bit = 1
+		}
+		halves[bit] = append(halves[bit], item)
+	}
+	for _, half := range halves {
+		if len(half) > 0 {
+			node.Children = append(node.Children, subnetSubtree(coveringItems(half), half))
+		}
+	}
+	return node
+}
+
+// layout places leaves on consecutive rows and every inner node level with the middle
+// of its children, returning the number of rows and the deepest level
+func (n *subnetTreeNode) layout() (rows, depth int) {
+	var place func(n *subnetTreeNode, level int)
+	place = func(n *subnetTreeNode, level int) {
+		n.depth = level
+		depth = max(depth, level)
+		if len(n.Children) == 0 {
+			n.row = float64(rows)
+			rows++
+			return
+		}
+		for _, c := range n.Children {
+			place(c, level+1)
+		}
+		n.row = (n.Children[0].row + n.Children[len(n.Children)-1].row) / 2
+	}
+	place(n, 0)
+	return rows, depth
+}
+
+// walk calls fn for n and every node below it, parents first
+func (n *subnetTreeNode) walk(fn func(*subnetTreeNode)) {
+	fn(n)
+	for _, c := range n.Children {
+		c.walk(fn)
+	}
+}
+
+// labels returns the text of a node: its prefix, then the name and size of planned
+// subnets or the size of supernets
+func (n *subnetTreeNode) labels() (string, string) {
+	ones, _ := n.Prefix.Mask.Size()
+	size := strconv.FormatUint(uint64(1)<<uint(32-ones), 10) + " addresses"
+	if n.Row == nil {
+		return n.Prefix.String(), size
+	}
+	detail := strconv.FormatUint(n.Row.UsableHosts, 10) + " hosts"
+	if n.Row.Name != "" {
+		detail = n.Row.Name + ", " + detail
+	}
+	return n.Prefix.String(), detail
+}
+
+// writeTreeSVG draws the tree left to right: the parent on the left, planned subnets
+// in green and the supernets they branch from in grey
+func writeTreeSVG(w io.Writer, root *subnetTreeNode) {
+	rows, depth := root.layout()
+	width := diagramMargin*2 + (depth+1)*diagramBoxWidth + depth*diagramColumnGap
+	height := diagramMargin*2 + rows*diagramBoxHeight + (rows-1)*diagramRowGap
+	position := func(n *subnetTreeNode) (float64, float64) {
+		return float64(diagramMargin + n.depth*(diagramBoxWidth+diagramColumnGap)),
+			diagramMargin + n.row*(diagramBoxHeight+diagramRowGap)
+	}
+
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Arial, sans-serif" font-size="12">`+"\n",
+		width, height, width, height)
+	root.walk(func(n *subnetTreeNode) {
+		x, y := position(n)
+		for _, c := range n.Children {
+			cx, cy := position(c)
+			mid := x + diagramBoxWidth + diagramColumnGap/2
+			fmt.Fprintf(w, `<path d="M%.0f %.1f H%.0f V%.1f H%.0f" fill="none" stroke="#999"/>`+"\n",
+				x+diagramBoxWidth, y+diagramBoxHeight/2, mid, cy+diagramBoxHeight/2, cx)
+		}
+	})
+	root.walk(func(n *subnetTreeNode) {
+		x, y := position(n)
+		fill, stroke := "#f5f5f5", "#999"
+		if n.Row != nil {
+			fill, stroke = "#e8f5e9", "#4CAF50"
+		}
+		prefix, detail := n.labels()
+		fmt.Fprintf(w, `<rect x="%.0f" y="%.1f" width="%d" height="%d" rx="4" fill="%s" stroke="%s"/>`+"\n",
+			x, y, diagramBoxWidth, diagramBoxHeight, fill, stroke)
+		fmt.Fprintf(w, `<text x="%.0f" y="%.1f" font-weight="bold" font-family="monospace">%s</text>`+"\n", x+8, y+16, xlsxEscape(prefix))
+		fmt.Fprintf(w, `<text x="%.0f" y="%.1f" fill="#555">%s</text>`+"\n", x+8, y+32, xlsxEscape(detail))
+	})
+	fmt.Fprintln(w, "</svg>")
+}
+
+// writeTreeDOT writes the tree as a Graphviz digraph, for rendering with dot -Tpng
+func writeTreeDOT(w io.Writer, root *subnetTreeNode) {
+	quote := func(s string) string { return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"` }
+	fmt.Fprintln(w, "digraph subnets {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, `  node [shape=box, style="rounded,filled", fontname="Arial", fillcolor="#f5f5f5"];`)
+	root.walk(func(n *subnetTreeNode) {
+		prefix, detail := n.labels()
+		attrs := "label=" + quote(prefix+`\n`+detail)
+		if n.Row != nil {
+			attrs += `, fillcolor="#e8f5e9", color="#4CAF50"`
+		}
+		fmt.Fprintf(w, "  %s [%s];\n", quote(n.Prefix.String()), attrs)
+	})
+	root.walk(func(n *subnetTreeNode) {
+		for _, c := range n.Children {
+			fmt.Fprintf(w, "  %s -> %s;\n", quote(n.Prefix.String()), quote(c.Prefix.String()))
+		}
+	})
+	fmt.Fprintln(w, "}")
+}
+
+// writeSubnetDiagram answers with the tree of rows under parent as an SVG image or,
+// for format dot, a Graphviz source
+func writeSubnetDiagram(w http.ResponseWriter, format string, parent *net.IPNet, rows []SubnetRow) {
+	root, err := buildSubnetTree(parent, rows)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if format == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		writeTreeDOT(w, root)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	writeTreeSVG(w, root)
+}
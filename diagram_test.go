@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/xml"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBuildSubnetTree(t *testing.T) {
+	_, parent, _ := net.ParseCIDR("10.0.0.0/16")
+	rows := []SubnetRow{
+		{Name: "web", Prefix: "10.0.4.0/24", UsableHosts: 254},
+		{Name: "db", Prefix: "10.0.0.0/24", UsableHosts: 254},
+		{Name: "app", Prefix: "10.0.1.0/24", UsableHosts: 254},
+		{Name: "dup", Prefix: "10.0.1.0/24", UsableHosts: 254},
+	}
+	root, err := buildSubnetTree(parent, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	root.walk(func(n *subnetTreeNode) {
+		name := n.Prefix.String()
+		if n.Row != nil {
+			name += "=" + n.Row.Name
+		}
+		got = append(got, name)
+	})
+	want := "10.0.0.0/16 10.0.0.0/21 10.0.0.0/23 10.0.0.0/24=db 10.0.1.0/24=app 10.0.4.0/24=web"
+	if strings.Join(got, " ") != want {
+		t.Errorf("tree = %v, want %s", got, want)
+	}
+
+	if rows, depth := root.layout(); rows != 3 || depth != 3 {
+		t.Errorf("layout = %d rows, depth %d, want 3 rows, depth 3", rows, depth)
+	}
+
+	if _, err := buildSubnetTree(parent, []SubnetRow{{Prefix: "10.1.0.0/24"}}); err == nil {
+		t.Error("expected an error for a subnet outside the parent")
+	}
+	if _, err := buildSubnetTree(nil, nil); err == nil {
+		t.Error("expected an error for an empty plan")
+	}
+}
+
+func TestBuildSubnetTreeCovering(t *testing.T) {
+	root, err := buildSubnetTree(nil, []SubnetRow{{Prefix: "192.168.0.0/24"}, {Prefix: "192.168.3.0/24"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Prefix.String() != "192.168.0.0/22" || len(root.Children) != 2 {
+		t.Errorf("root = %s with %d children, want 192.168.0.0/22 with 2", root.Prefix, len(root.Children))
+	}
+}
+
+func TestDiagramFormats(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/deaggregate?prefix=10.0.0.0/22&length=24&format=svg", nil)
+	rr := httptest.NewRecorder()
+	deaggregateHandler(rr, req)
+	if ct := rr.Header().Get("Content-Type"); ct != "image/svg+xml" {
+		t.Fatalf("Content-Type = %q (body: %s)", ct, rr.Body.String())
+	}
+	if err := xml.Unmarshal(rr.Body.Bytes(), new(struct{})); err != nil {
+		t.Errorf("invalid SVG: %v", err)
+	}
+	if n := strings.Count(rr.Body.String(), "<rect"); n != 7 {
+		t.Errorf("%d boxes, want 7 (parent, two /23 and four /24)", n)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/docker/plan?format=dot",
+		strings.NewReader(`{"pool":"10.10.0.0/16","count":2,"size":24}`))
+	rr = httptest.NewRecorder()
+	dockerPlanHandler(rr, req)
+	body := rr.Body.String()
+	if !strings.HasPrefix(body, "digraph subnets {") || !strings.Contains(body, `"10.10.0.0/16" -> "10.10.0.0/23";`) {
+		t.Errorf("unexpected DOT output:\n%s", body)
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// OIDs of the IP-MIB address table and the interface names of IF-MIB
+const (
+	oidIPAdEntIfIndex = "1.3.6.1.2.1.4.20.1.2"
+	oidIPAdEntNetMask = "1.3.6.1.2.1.4.20.1.3"
+	oidIfDescr        = "1.3.6.1.2.1.2.2.1.2"
+	oidIfName         = "1.3.6.1.2.1.31.1.1.1.1"
+
+	defaultSNMPTimeout = 2 * time.Second
+	snmpRetries        = 1
+)
+
+// Reconciliation states of a discovered subnet
+const (
+	discoveryMatched   = "matched"
+	discoveryMissing   = "missing"
+	discoveryRecorded  = "recorded"
+	discoveryConflict  = "conflict"
+	discoveryUnmanaged = "unmanaged"
+	discoverySkipped   = "skipped"
+)
+
+// DiscoveryRequest names the device to query; Community defaults to the configured one
+type DiscoveryRequest struct {
+	Target    string `json:"target"`
+	Community string `json:"community,omitempty"`
+}
+
+// DiscoveredSubnet is an interface address of a device and how its subnet compares to
+// the IPAM: matched an allocation or pool, missing from a pool (recorded when the
+// discovery is applied), in conflict with an allocation, unmanaged outside every pool,
+// or skipped
+type DiscoveredSubnet struct {
+	Interface string `json:"interface"`
+	IfIndex   int64  `json:"if_index"`
+	Address   string `json:"address"`
+	Mask      string `json:"mask"`
+	Prefix    string `json:"prefix"`
+	Status    string `json:"status"`
+	Pool      string `json:"pool,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// DiscoveryResult reports the subnets of a device against the IPAM
+type DiscoveryResult struct {
+	Target    string              `json:"target"`
+	DryRun    bool                `json:"dry_run"`
+	Subnets   []*DiscoveredSubnet `json:"subnets"`
+	Matched   int                 `json:"matched"`
+	Missing   int                 `json:"missing"`
+	Recorded  int                 `json:"recorded"`
+	Conflicts int                 `json:"conflicts"`
+	Unmanaged int                 `json:"unmanaged"`
+	Skipped   int                 `json:"skipped"`
+}
+
+// snmpSettings are the defaults of discovery requests; allowed, when set, lists the
+// prefixes devices may be queried in, otherwise they must be in an IPAM pool
+type snmpSettings struct {
+	community string
+	timeout   time.Duration
+	allowed   *cidrset.Set
+}
+
+var snmpDefaults = snmpSettings{community: "public", timeout: defaultSNMPTimeout}
+
+// configureSNMP reads GO_SUBNET_CALCULATOR_SNMP_COMMUNITY (default public, or from the
+// file named by GO_SUBNET_CALCULATOR_SNMP_COMMUNITY_FILE), GO_SUBNET_CALCULATOR_SNMP_TIMEOUT
+// and GO_SUBNET_CALCULATOR_SNMP_ALLOWED, the prefixes devices may be queried in
+func configureSNMP() error {
+	settings := snmpSettings{community: "public", timeout: defaultSNMPTimeout}
+	community, err := loadSecret("GO_SUBNET_CALCULATOR_SNMP_COMMUNITY")
+	if err != nil {
+		return err
+	}
+	if community != "" {
+		settings.community = community
+	}
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_SNMP_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 || d > time.Minute {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_SNMP_TIMEOUT must be a duration of at most 1m, got %q", value)
+		}
+		settings.timeout = d
+	}
+	allowed := "IPAM pools"
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_SNMP_ALLOWED"); value != "" {
+		if settings.allowed, err = cidrset.Parse(strings.Split(value, ",")...); err != nil {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_SNMP_ALLOWED: %v", err)
+		}
+		allowed = value
+	}
+	snmpDefaults = settings
+	recordSystemAudit("config.snmp", allowed, "discovery timeout %s", settings.timeout)
+	return nil
+}
+
+// newSNMPClient returns a client for target (host or host:port, default port 161). The
+// host is resolved once and must be in the allowed prefixes or an IPAM pool, so the
+// endpoint cannot be pointed at arbitrary hosts
+func newSNMPClient(ctx context.Context, m *IPAM, req DiscoveryRequest) (*snmpClient, error) {
+	target := strings.TrimSpace(req.Target)
+	if target == "" {
+		return nil, fmt.Errorf("target is required")
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		host, port = target, "161"
+	}
+	ip, err := resolveSNMPHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSNMPTarget(m, ip); err != nil {
+		return nil, err
+	}
+	community := req.Community
+	if community == "" {
+		community = snmpDefaults.community
+	}
+	return &snmpClient{target: net.JoinHostPort(ip.String(), port), community: community, timeout: snmpDefaults.timeout, retries: snmpRetries}, nil
+}
+
+// resolveSNMPHost returns the IPv4 address of host, an address or a name
+func resolveSNMPHost(ctx context.Context, host string) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() == nil {
+			return nil, fmt.Errorf("target %s is not an IPv4 address", host)
+		}
+		return ip.To4(), nil
+	}
+	addrs, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil || len(addrs) == 0 {
+		return nil, fmt.Errorf("cannot resolve target %s", host)
+	}
+	return addrs[0].To4(), nil
+}
+
+// checkSNMPTarget refuses a device outside GO_SUBNET_CALCULATOR_SNMP_ALLOWED or, when
+// that is not set, outside every IPAM pool
+func checkSNMPTarget(m *IPAM, ip net.IP) error {
+	if allowed := snmpDefaults.allowed; allowed != nil {
+		if !allowed.Contains(ip) {
+			return fmt.Errorf("%w: %s is outside the prefixes allowed for discovery", errForbidden, ip)
+		}
+		return nil
+	}
+	poolNets, _, _, err := ipamPrefixIndexes(m)
+	if err != nil {
+		return err
+	}
+	if containingPrefix(poolNets, &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}) == nil {
+		return fmt.Errorf("%w: %s is not in an IPAM pool", errForbidden, ip)
+	}
+	return nil
+}
+
+// oidSuffix returns what follows root in oid
+func oidSuffix(oid, root string) string {
+	return strings.TrimPrefix(oid, root+".")
+}
+
+// discoverInterfaces reads the address table of a device: every interface address,
+// its mask and the name of its interface (ifName, or ifDescr when the agent has no
+// IF-MIB extensions)
+func discoverInterfaces(ctx context.Context, c *snmpClient) ([]*DiscoveredSubnet, error) {
+	byAddress := map[string]*DiscoveredSubnet{}
+	if err := c.walk(ctx, oidIPAdEntIfIndex, func(vb snmpVarBind) {
+		address := oidSuffix(vb.oid, oidIPAdEntIfIndex)
+		byAddress[address] = &DiscoveredSubnet{Address: address, IfIndex: vb.value.Int()}
+	}); err != nil {
+		return nil, err
+	}
+	if err := c.walk(ctx, oidIPAdEntNetMask, func(vb snmpVarBind) {
+		if s := byAddress[oidSuffix(vb.oid, oidIPAdEntNetMask)]; s != nil && vb.value.IP() != nil {
+			s.Mask = vb.value.IP().String()
+		}
+	}); err != nil {
+		return nil, err
+	}
+	names := map[string]string{}
+	for _, root := range []string{oidIfDescr, oidIfName} {
+		// interface names are a nicety; an agent without them still reports its subnets
+		c.walk(ctx, root, func(vb snmpVarBind) {
+			if vb.value.tag == berOctetString && len(vb.value.data) > 0 {
+				names[oidSuffix(vb.oid, root)] = string(vb.value.data)
+			}
+		})
+	}
+
+	subnets := make([]*DiscoveredSubnet, 0, len(byAddress))
+	for _, s := range byAddress {
+		s.Interface = names[strconv.FormatInt(s.IfIndex, 10)]
+		subnets = append(subnets, s)
+	}
+	sort.Slice(subnets, func(i, j int) bool {
+		return ipToUint32(net.ParseIP(subnets[i].Address)) < ipToUint32(net.ParseIP(subnets[j].Address))
+	})
+	return subnets, nil
+}
+
+// reconcileDiscovered compares discovered subnets to the IPAM and, unless dryRun,
+// records the subnets missing from a pool as allocations
+func reconcileDiscovered(m *IPAM, target string, subnets []*DiscoveredSubnet, dryRun bool) (*DiscoveryResult, error) {
+	result := &DiscoveryResult{Target: target, DryRun: dryRun, Subnets: subnets}
+	poolNets, poolIDs, allocated, err := ipamPrefixIndexes(m)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]string{}
+	for _, s := range subnets {
+		ip := net.ParseIP(s.Address).To4()
+		mask, err := parseSubnetMask(s.Mask)
+		if ip == nil || err != nil {
+			s.Status, s.Message = discoverySkipped, "no valid address and mask"
+			result.Skipped++
+			continue
+		}
+		network := &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+		s.Prefix = network.String()
+		if ones, _ := mask.Size(); ones == 32 || ip.IsLoopback() {
+			s.Status, s.Message = discoverySkipped, "loopback or host address"
+			result.Skipped++
+			continue
+		}
+		if other, ok := seen[s.Prefix]; ok {
+			s.Status, s.Message = discoverySkipped, "also on "+other
+			result.Skipped++
+			continue
+		}
+		seen[s.Prefix] = s.Interface
+
+		pool := containingPrefix(poolNets, network)
+		if pool == nil {
+			s.Status = discoveryUnmanaged
+			if other := overlappingPrefix(poolNets, network); other != nil {
+				s.Status, s.Message = discoveryConflict, "spans pool "+other.String()
+				result.Conflicts++
+			} else {
+				result.Unmanaged++
+			}
+			continue
+		}
+		s.Pool = pool.String()
+		if pool.String() == s.Prefix {
+			s.Status, s.Message = discoveryMatched, "is the pool itself"
+			result.Matched++
+			continue
+		}
+		siblings := allocated[pool.String()]
+		if other := overlappingPrefix(siblings, network); other != nil {
+			if other.String() == s.Prefix {
+				s.Status = discoveryMatched
+				result.Matched++
+			} else {
+				s.Status, s.Message = discoveryConflict, "overlaps allocation "+other.String()
+				result.Conflicts++
+			}
+			continue
+		}
+		if dryRun {
+			s.Status = discoveryMissing
+			result.Missing++
+		} else {
+			description := strings.TrimSpace(s.Interface + " on " + target)
+			if _, err := m.Allocate(poolIDs[pool.String()], AllocationRequest{Prefix: s.Prefix, Description: description}); err != nil {
+				s.Status, s.Message = discoveryConflict, err.Error()
+				result.Conflicts++
+				continue
+			}
+			s.Status = discoveryRecorded
+			result.Recorded++
+		}
+		siblings.InsertPrefix(network, network)
+	}
+	return result, nil
+}
+
+// discoverDevice queries a device and reconciles its subnets with the IPAM
+func discoverDevice(ctx context.Context, m *IPAM, req DiscoveryRequest, dryRun bool) (*DiscoveryResult, error) {
+	client, err := newSNMPClient(ctx, m, req)
+	if err != nil {
+		return nil, err
+	}
+	subnets, err := discoverInterfaces(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return reconcileDiscovered(m, client.target, subnets, dryRun)
+}
+
+// recordDiscoveryAudit records an applied discovery and every allocation it created
+func recordDiscoveryAudit(r *http.Request, result *DiscoveryResult) {
+	recordAudit(r, "discovery.snmp", result.Target, "%d recorded, %d matched, %d conflicts", result.Recorded, result.Matched, result.Conflicts)
+	for _, s := range result.Subnets {
+		if s.Status == discoveryRecorded {
+			recordAudit(r, "allocation.create", s.Prefix, "discovered on %s %s", result.Target, s.Interface)
+		}
+	}
+}
+
+// ipamDiscoverHandler serves POST /api/v1/ipam/discover, which queries a device over
+// SNMP and reconciles its interface subnets with the IPAM; ?dry_run=true reports
+// without recording the missing subnets
+func ipamDiscoverHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	// discovered subnets may land in any tenant's pool
+	if err := requestPrincipal(r).checkGlobal(RoleAdmin); err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "dry_run must be true or false")
+			return
+		}
+	}
+	var req DiscoveryRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	result, err := discoverDevice(r.Context(), ipamService, req, dryRun)
+	if errors.Is(err, errSNMP) {
+		writeJSONError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	if !dryRun {
+		recordDiscoveryAudit(r, result)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
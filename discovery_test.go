@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// withTestSNMP limits discovery to allowed, or to the IPAM pools when it is empty
+func withTestSNMP(t *testing.T, allowed string) {
+	t.Helper()
+	previous := snmpDefaults
+	snmpDefaults = snmpSettings{community: "public", timeout: time.Second}
+	if allowed != "" {
+		set, err := cidrset.Parse(allowed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snmpDefaults.allowed = set
+	}
+	t.Cleanup(func() { snmpDefaults = previous })
+}
+
+// testRouterObjects is the address table of a router with six interface addresses
+func testRouterObjects() map[string]snmpValue {
+	objects := map[string]snmpValue{}
+	iface := func(index int64, name, address, mask string) {
+		objects[oidIPAdEntIfIndex+"."+address] = snmpValue{tag: berInteger, data: []byte{byte(index)}}
+		objects[oidIPAdEntNetMask+"."+address] = snmpValue{tag: snmpIPAddress, data: net.ParseIP(mask).To4()}
+		objects[oidIfName+"."+string(rune('0'+index))] = snmpValue{tag: berOctetString, data: []byte(name)}
+	}
+	iface(1, "Gi0/1", "10.1.1.1", "255.255.255.0")
+	iface(2, "Gi0/2", "10.1.2.1", "255.255.255.128")
+	iface(3, "Gi0/3", "10.1.3.1", "255.255.254.0")
+	iface(4, "Gi0/4", "172.16.5.1", "255.255.255.252")
+	iface(5, "Lo0", "10.255.0.1", "255.255.255.255")
+	iface(6, "Gi0/1.2", "10.1.1.2", "255.255.255.0")
+	// an ICMP counter after the tables ends every walk
+	objects["1.3.6.1.2.1.5.1.0"] = snmpValue{tag: snmpCounter32, data: []byte{1}}
+	return objects
+}
+
+func TestDiscoverInterfaces(t *testing.T) {
+	agent := startFakeSNMPAgent(t, "secret", testRouterObjects())
+	client := &snmpClient{target: agent.target(), community: "secret", timeout: time.Second}
+	subnets, err := discoverInterfaces(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range subnets {
+		got = append(got, s.Interface+" "+s.Address+" "+s.Mask)
+	}
+	want := "Gi0/1 10.1.1.1 255.255.255.0,Gi0/1.2 10.1.1.2 255.255.255.0,Gi0/2 10.1.2.1 255.255.255.128,Gi0/3 10.1.3.1 255.255.254.0,Lo0 10.255.0.1 255.255.255.255,Gi0/4 172.16.5.1 255.255.255.252"
+	if strings.Join(got, ",") != want {
+		t.Errorf("discovered %s\nwant %s", strings.Join(got, ","), want)
+	}
+
+	client.community, client.timeout = "wrong", 20*time.Millisecond
+	if _, err := discoverInterfaces(context.Background(), client); err == nil || !strings.Contains(err.Error(), "no response") {
+		t.Errorf("wrong community error = %v", err)
+	}
+}
+
+func TestReconcileDiscovered(t *testing.T) {
+	m := newIPAM(newMemoryIPAMStore())
+	pool, _ := m.CreatePool(PoolRequest{Name: "campus", Prefix: "10.1.0.0/16"})
+	m.Allocate(pool.ID, AllocationRequest{Prefix: "10.1.1.0/24"})
+	m.Allocate(pool.ID, AllocationRequest{Prefix: "10.1.2.0/24"})
+	discovered := func() []*DiscoveredSubnet {
+		return []*DiscoveredSubnet{
+			{Interface: "Gi0/1", Address: "10.1.1.1", Mask: "255.255.255.0"},
+			{Interface: "Gi0/1.2", Address: "10.1.1.2", Mask: "255.255.255.0"},
+			{Interface: "Gi0/2", Address: "10.1.2.1", Mask: "255.255.255.128"},
+			{Interface: "Gi0/3", Address: "10.1.3.1", Mask: "255.255.254.0"},
+			{Interface: "Gi0/4", Address: "172.16.5.1", Mask: "255.255.255.252"},
+			{Interface: "Lo0", Address: "10.255.0.1", Mask: "255.255.255.255"},
+			{Interface: "Gi0/5", Address: "10.1.9.1"},
+		}
+	}
+
+	dry, err := reconcileDiscovered(m, "router", discovered(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []string
+	for _, s := range dry.Subnets {
+		statuses = append(statuses, s.Prefix+" "+s.Status)
+	}
+	want := "10.1.1.0/24 matched,10.1.1.0/24 skipped,10.1.2.0/25 conflict,10.1.2.0/23 conflict,172.16.5.0/30 unmanaged,10.255.0.1/32 skipped, skipped"
+	if strings.Join(statuses, ",") != want {
+		t.Errorf("dry run statuses = %s\nwant %s", strings.Join(statuses, ","), want)
+	}
+	if dry.Matched != 1 || dry.Conflicts != 2 || dry.Unmanaged != 1 || dry.Skipped != 3 || dry.Missing != 0 {
+		t.Errorf("dry run counts = %+v", dry)
+	}
+
+	subnets := []*DiscoveredSubnet{{Interface: "Gi0/7", Address: "10.1.7.1", Mask: "255.255.255.0"}}
+	if dry, _ := reconcileDiscovered(m, "router", subnets, true); dry.Missing != 1 || subnets[0].Status != discoveryMissing {
+		t.Errorf("dry run of a missing subnet = %+v", dry)
+	}
+	if allocations, _ := m.Allocations(pool.ID); len(allocations) != 2 {
+		t.Fatalf("dry run recorded allocations: %+v", allocations)
+	}
+	applied, err := reconcileDiscovered(m, "router", subnets, false)
+	if err != nil || applied.Recorded != 1 || subnets[0].Status != discoveryRecorded {
+		t.Fatalf("applied = %+v, %v", applied, err)
+	}
+	allocations, _ := m.Allocations(pool.ID)
+	if len(allocations) != 3 || allocations[2].Prefix != "10.1.7.0/24" || allocations[2].Description != "Gi0/7 on router" {
+		t.Errorf("allocations after apply = %+v", allocations)
+	}
+}
+
+func TestIPAMDiscoverHandler(t *testing.T) {
+	withTestAudit(t)
+	m := withTestIPAM(t)
+	pool, _ := m.CreatePool(PoolRequest{Name: "campus", Prefix: "10.1.0.0/16"})
+	agent := startFakeSNMPAgent(t, "public", testRouterObjects())
+	withTestSNMP(t, "127.0.0.0/8")
+
+	rr := httptest.NewRecorder()
+	ipamDiscoverHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ipam/discover?dry_run=true", strings.NewReader(`{"target":"`+agent.target()+`"}`)))
+	var result DiscoveryResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("invalid JSON response: %v (%s)", err, rr.Body.String())
+	}
+	// 10.1.3.0/23 overlaps the 10.1.2.0/25 planned before it
+	if !result.DryRun || result.Missing != 2 || result.Conflicts != 1 || result.Unmanaged != 1 {
+		t.Errorf("dry run = %+v", result)
+	}
+
+	rr = httptest.NewRecorder()
+	ipamDiscoverHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ipam/discover", strings.NewReader(`{"target":"`+agent.target()+`"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("discover status = %d (%s)", rr.Code, rr.Body.String())
+	}
+	if allocations, _ := m.Allocations(pool.ID); len(allocations) != 2 {
+		t.Errorf("allocations after discovery = %+v", allocations)
+	}
+
+	rr = httptest.NewRecorder()
+	ipamDiscoverHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ipam/discover", strings.NewReader(`{}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("missing target status = %d, want 400", rr.Code)
+	}
+}
+
+func TestSNMPTargets(t *testing.T) {
+	withTestAudit(t)
+	m := withTestIPAM(t)
+	m.CreatePool(PoolRequest{Name: "loopback", Prefix: "127.0.0.0/24"})
+	discover := func(target string) int {
+		rr := httptest.NewRecorder()
+		ipamDiscoverHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ipam/discover?dry_run=true", strings.NewReader(`{"target":"`+target+`"}`)))
+		return rr.Code
+	}
+	agent := startFakeSNMPAgent(t, "public", testRouterObjects())
+	_, port, _ := net.SplitHostPort(agent.target())
+
+	withTestSNMP(t, "")
+	if code := discover(agent.target()); code != http.StatusOK {
+		t.Errorf("device in a pool status = %d, want 200", code)
+	}
+	for _, target := range []string{"127.0.1.1:" + port, "169.254.169.254", "::1"} {
+		if code := discover(target); code != http.StatusForbidden && code != http.StatusBadRequest {
+			t.Errorf("device %s outside the pools status = %d, want refused", target, code)
+		}
+	}
+	if code := discover("169.254.169.254"); code != http.StatusForbidden {
+		t.Errorf("metadata address status = %d, want 403", code)
+	}
+
+	withTestSNMP(t, "10.0.0.0/8")
+	if code := discover(agent.target()); code != http.StatusForbidden {
+		t.Errorf("device in a pool but outside the allowlist status = %d, want 403", code)
+	}
+}
+
+func TestConfigureSNMP(t *testing.T) {
+	withTestAudit(t)
+	withTestSNMP(t, "")
+	path := filepath.Join(t.TempDir(), "community")
+	os.WriteFile(path, []byte("s3cret\n"), 0o600)
+	t.Setenv("GO_SUBNET_CALCULATOR_SNMP_COMMUNITY", "")
+	t.Setenv("GO_SUBNET_CALCULATOR_SNMP_COMMUNITY_FILE", path)
+	t.Setenv("GO_SUBNET_CALCULATOR_SNMP_ALLOWED", "10.0.0.0/8,192.168.0.0/16")
+	if err := configureSNMP(); err != nil {
+		t.Fatal(err)
+	}
+	if snmpDefaults.community != "s3cret" || !snmpDefaults.allowed.Contains(net.ParseIP("192.168.1.1")) || snmpDefaults.allowed.Contains(net.ParseIP("172.16.0.1")) {
+		t.Errorf("settings = %+v", snmpDefaults)
+	}
+
+	t.Setenv("GO_SUBNET_CALCULATOR_SNMP_ALLOWED", "10.0.0.0/33")
+	if err := configureSNMP(); err == nil {
+		t.Error("invalid allowed prefix accepted")
+	}
+}
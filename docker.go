@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+const (
+	defaultDockerPool = "172.16.0.0/12"
+	defaultDockerSize = 24
+)
+
+// DockerPlanRequest asks for Count bridge network subnets of prefix length Size carved
+// out of Pool, skipping anything that overlaps the existing host routes in Avoid
+type DockerPlanRequest struct {
+	Pool  string   `json:"pool,omitempty"`
+	Count int      `json:"count"`
+	Size  int      `json:"size,omitempty"`
+	Avoid []string `json:"avoid,omitempty"`
+	Names []string `json:"names,omitempty"`
+}
+
+// DockerNetwork is one planned bridge network
+type DockerNetwork struct {
+	Name    string `json:"name"`
+	Subnet  string `json:"subnet"`
+	Gateway string `json:"gateway"`
+}
+
+// DockerAddressPool is an entry of the daemon.json default-address-pools list
+type DockerAddressPool struct {
+	Base string `json:"base"`
+	Size int    `json:"size"`
+}
+
+// DockerPlanResponse holds the planned networks and ready-to-paste configuration
+type DockerPlanResponse struct {
+	Pool       string                         `json:"pool"`
+	Networks   []DockerNetwork                `json:"networks"`
+	DaemonJSON map[string][]DockerAddressPool `json:"daemon_json"`
+	Compose    string                         `json:"compose"`
+}
+
+// errPoolExhausted reports that the pool has too little non-conflicting space
+var errPoolExhausted = errors.New("not enough free space in the pool for the requested networks")
+
+// planDockerNetworks carves the lowest non-conflicting subnets out of the pool. The
+// daemon.json pools are the planned subnets aggregated, so Docker's own allocator stays
+// inside the conflict-free space
+func planDockerNetworks(req DockerPlanRequest) (*DockerPlanResponse, error) {
+	if req.Pool == "" {
+		req.Pool = defaultDockerPool
+	}
+	if req.Size == 0 {
+		req.Size = defaultDockerSize
+	}
+	pool, err := parseIPv4Prefix(req.Pool)
+	if err != nil {
+		return nil, err
+	}
+	poolLen, _ := pool.Mask.Size()
+	if req.Size < poolLen || req.Size > 30 {
+		return nil, fmt.Errorf("size must be between the pool length /%d and /30", poolLen)
+	}
+	if req.Count < 1 || req.Count > maxPrefixListLen {
+		return nil, fmt.Errorf("count must be between 1 and %d", maxPrefixListLen)
+	}
+	if len(req.Names) > 0 && len(req.Names) != req.Count {
+		return nil, fmt.Errorf("got %d names for %d networks", len(req.Names), req.Count)
+	}
+	for _, name := range req.Names {
+		if !dnsmasqTag.MatchString(name) {
+			return nil, fmt.Errorf("invalid network name: %s", name)
+		}
+	}
+	avoid, err := parsePrefixList(req.Avoid)
+	if err != nil {
+		return nil, err
+	}
+
+	free := cidrset.New(pool).Difference(cidrset.New(avoid...)).Prefixes()
+	subnets := make([]netip.Prefix, 0, req.Count)
+	for _, block := range free {
+		if p := netipPrefix(block); p.Bits() <= req.Size && len(subnets) < req.Count {
+			subnets = append(subnets, subnetsOf(p, req.Size, req.Count-len(subnets))...)
+		}
+	}
+	if len(subnets) < req.Count {
+		return nil, errPoolExhausted
+	}
+
+	resp := &DockerPlanResponse{Pool: pool.String(), DaemonJSON: map[string][]DockerAddressPool{}}
+	var compose strings.Builder
+	compose.WriteString("networks:\n")
+	for i, subnet := range subnets {
+		name := fmt.Sprintf("net%d", i+1)
+		if len(req.Names) > 0 {
+			name = req.Names[i]
+		}
+		network := DockerNetwork{Name: name, Subnet: subnet.String(), Gateway: subnet.Addr().Next().String()}
+		resp.Networks = append(resp.Networks, network)
+		fmt.Fprintf(&compose, "  %s:\n    ipam:\n      config:\n        - subnet: %s\n          gateway: %s\n", name, network.Subnet, network.Gateway)
+	}
+	planned := make([]*net.IPNet, len(subnets))
+	for i, subnet := range subnets {
+		planned[i] = ipNet(subnet)
+	}
+	for _, base := range cidrset.New(planned...).Prefixes() {
+		resp.DaemonJSON["default-address-pools"] = append(resp.DaemonJSON["default-address-pools"], DockerAddressPool{Base: base.String(), Size: req.Size})
+	}
+	resp.Compose = compose.String()
+	return resp, nil
+}
+
+// dockerRows converts the planned networks to export rows named after the networks
+func dockerRows(resp *DockerPlanResponse) []SubnetRow {
+	rows := make([]SubnetRow, 0, len(resp.Networks))
+	for _, n := range resp.Networks {
+		_, subnet, _ := net.ParseCIDR(n.Subnet)
+		rows = append(rows, prefixRow(n.Name, subnet))
+	}
+	return rows
+}
+
+// dockerPlanHandler serves POST /api/v1/docker/plan as JSON or, with ?format=csv,
+// xlsx, markdown, svg or dot, the planned networks as a download, report or diagram
+func dockerPlanHandler(w http.ResponseWriter, r *http.Request) {
+	var req DockerPlanRequest
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	resp, err := planDockerNetworks(req)
+	switch {
+	case err == errPoolExhausted:
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case responseFormat(r, "json") == "csv":
+		writeSubnetCSV(w, "docker-networks.csv", dockerRows(resp))
+	case responseFormat(r, "json") == "xlsx":
+		writeXLSXDownload(w, "docker-networks.xlsx", subnetSheets(dockerRows(resp)))
+	case responseFormat(r, "json") == "markdown":
+		writeSubnetMarkdown(w, "Docker networks in "+resp.Pool, dockerRows(resp))
+	case responseFormat(r, "json") == "svg", responseFormat(r, "json") == "dot":
+		_, pool, _ := net.ParseCIDR(resp.Pool)
+		writeSubnetDiagram(w, responseFormat(r, "json"), pool, dockerRows(resp))
+	default:
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
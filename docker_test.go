@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPlanDockerNetworks(t *testing.T) {
+	resp, err := planDockerNetworks(DockerPlanRequest{
+		Pool:  "10.10.0.0/16",
+		Count: 3,
+		Size:  24,
+		Avoid: []string{"10.10.1.0/24", "10.10.2.128/25", "192.168.0.0/16"},
+		Names: []string{"frontend", "backend", "db"},
+	})
+	if err != nil {
+		t.Fatalf("planDockerNetworks() unexpected error: %v", err)
+	}
+
+	want := []DockerNetwork{
+		{"frontend", "10.10.0.0/24", "10.10.0.1"},
+		{"backend", "10.10.3.0/24", "10.10.3.1"},
+		{"db", "10.10.4.0/24", "10.10.4.1"},
+	}
+	if len(resp.Networks) != len(want) {
+		t.Fatalf("got %d networks, want %d", len(resp.Networks), len(want))
+	}
+	for i := range want {
+		if resp.Networks[i] != want[i] {
+			t.Errorf("network %d = %+v, want %+v", i, resp.Networks[i], want[i])
+		}
+	}
+
+	pools := resp.DaemonJSON["default-address-pools"]
+	wantPools := []DockerAddressPool{{"10.10.0.0/24", 24}, {"10.10.3.0/24", 24}, {"10.10.4.0/24", 24}}
+	if len(pools) != len(wantPools) {
+		t.Fatalf("default-address-pools = %+v, want %+v", pools, wantPools)
+	}
+	for i := range wantPools {
+		if pools[i] != wantPools[i] {
+			t.Errorf("pool %d = %+v, want %+v", i, pools[i], wantPools[i])
+		}
+	}
+	if !strings.Contains(resp.Compose, "  backend:\n    ipam:\n      config:\n        - subnet: 10.10.3.0/24\n          gateway: 10.10.3.1\n") {
+		t.Errorf("unexpected compose snippet:\n%s", resp.Compose)
+	}
+}
+
+func TestPlanDockerNetworksDefaults(t *testing.T) {
+	resp, err := planDockerNetworks(DockerPlanRequest{Count: 4, Avoid: []string{"172.17.0.0/16"}})
+	if err != nil {
+		t.Fatalf("planDockerNetworks() unexpected error: %v", err)
+	}
+	if resp.Pool != "172.16.0.0/12" || resp.Networks[0].Subnet != "172.16.0.0/24" || resp.Networks[3].Name != "net4" {
+		t.Errorf("unexpected default plan: %+v", resp)
+	}
+	if pools := resp.DaemonJSON["default-address-pools"]; len(pools) != 1 || pools[0].Base != "172.16.0.0/22" {
+		t.Errorf("aggregated pools = %+v, want 172.16.0.0/22", pools)
+	}
+
+	// The whole pool is covered by a host route
+	if _, err := planDockerNetworks(DockerPlanRequest{Pool: "10.10.0.0/16", Count: 1, Avoid: []string{"10.0.0.0/8"}}); err != errPoolExhausted {
+		t.Errorf("planDockerNetworks() with covered pool error = %v, want errPoolExhausted", err)
+	}
+}
+
+func TestPlanDockerNetworksErrors(t *testing.T) {
+	tests := []DockerPlanRequest{
+		{Count: 0},
+		{Count: 1, Pool: "bogus"},
+		{Count: 1, Pool: "10.0.0.0/24", Size: 16},
+		{Count: 1, Size: 31},
+		{Count: 2, Names: []string{"only-one"}},
+		{Count: 1, Names: []string{"bad name"}},
+		{Count: 1, Avoid: []string{"10.0.0.0/33"}},
+	}
+	for _, req := range tests {
+		if _, err := planDockerNetworks(req); err == nil || err == errPoolExhausted {
+			t.Errorf("planDockerNetworks(%+v) expected validation error, got %v", req, err)
+		}
+	}
+}
+
+func TestDockerPlanHandler(t *testing.T) {
+	tests := []struct {
+		body       string
+		wantStatus int
+	}{
+		{`{"pool":"10.20.0.0/22","count":2,"size":23}`, http.StatusOK},
+		{`{"pool":"10.20.0.0/22","count":5,"size":24}`, http.StatusConflict},
+		{`{"count":0}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		dockerPlanHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/docker/plan", strings.NewReader(tt.body)))
+		if rr.Code != tt.wantStatus {
+			t.Errorf("POST %s status = %d, want %d (body: %s)", tt.body, rr.Code, tt.wantStatus, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// BinaryRow is one line of a worked bitwise operation: an address in dotted decimal
+// and in dotted binary
+type BinaryRow struct {
+	Label   string `json:"label"`
+	Decimal string `json:"decimal"`
+	Binary  string `json:"binary"`
+}
+
+// ExplanationStep is one step of a worked solution
+type ExplanationStep struct {
+	Title string      `json:"title"`
+	Text  string      `json:"text"`
+	Rows  []BinaryRow `json:"rows,omitempty"`
+}
+
+// Explanation is the worked solution of a calculation, for teaching and for checking
+// a result by hand
+type Explanation struct {
+	PrefixLength int               `json:"prefix_length"`
+	Steps        []ExplanationStep `json:"steps"`
+}
+
+// dottedBinary writes an IPv4 address as four groups of eight bits
+func dottedBinary(ip net.IP) string {
+	ip = ip.To4()
+	groups := make([]string, 4)
+	for i, b := range ip {
+		groups[i] = fmt.Sprintf("%08b", b)
+	}
+	return strings.Join(groups, ".")
+}
+
+func binaryRow(label string, ip net.IP) BinaryRow {
+	return BinaryRow{Label: label, Decimal: ip.String(), Binary: dottedBinary(ip)}
+}
+
+// explainSubnet works out a calculated result step by step: the inputs in binary, the
+// AND that gives the network, the OR with the wildcard that gives the broadcast, the
+// host range and the host count. result supplies the host range and count, so cloud
+// reservations are explained as well
+func explainSubnet(ipStr, maskStr string, result *SubnetResult) (*Explanation, error) {
+	ip := net.ParseIP(ipStr).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", ipStr)
+	}
+	mask, err := parseSubnetMask(maskStr)
+	if err != nil {
+		return nil, err
+	}
+	ones, _ := mask.Size()
+	hostBits := 32 - ones
+	maskIP := net.IP(mask).To4()
+	network := ip.Mask(mask)
+	wildcard := uint32ToIP(^ipToUint32(maskIP))
+	broadcast := uint32ToIP(ipToUint32(network) | ipToUint32(wildcard))
+	total := uint64(1) << uint(hostBits)
+
+	e := &Explanation{PrefixLength: ones}
+	e.Steps = append(e.Steps, ExplanationStep{
+		Title: "Write the address and the mask in binary",
+		Text: fmt.Sprintf("The mask has %d one bits, so the prefix is /%d: the first %d bits name the network and the last %d bits number the hosts in it.",
+			ones, ones, ones, hostBits),
+		Rows: []BinaryRow{binaryRow("IP", ip), binaryRow("Mask", maskIP)},
+	}, ExplanationStep{
+		Title: "Network address: IP AND mask",
+		Text:  "A bit of the network address is 1 only where the IP and the mask both have a 1, which clears every host bit.",
+		Rows:  []BinaryRow{binaryRow("IP", ip), binaryRow("AND mask", maskIP), binaryRow("Network", network)},
+	}, ExplanationStep{
+		Title: "Broadcast address: network OR wildcard",
+		Text:  "The wildcard is the mask with every bit inverted. ORing it into the network address sets every host bit to 1.",
+		Rows:  []BinaryRow{binaryRow("Network", network), binaryRow("OR wildcard", wildcard), binaryRow("Broadcast", broadcast)},
+	})
+
+	var rangeText, countText string
+	switch {
+	case result.Cloud != "":
+		rangeText = fmt.Sprintf("The provider reserves %d addresses of the subnet, listed with the result, so hosts run from %s to %s.",
+			len(result.Reserved), result.MinHostAddress, result.MaxHostAddress)
+		countText = fmt.Sprintf("2^%d = %d addresses, minus the %d the provider reserves, leaves %s usable hosts.",
+			hostBits, total, len(result.Reserved), result.UsableHosts)
+	case ones == 32:
+		rangeText = "A /32 is a single address, such as a loopback or a host route; it has no separate network, broadcast or host range."
+		countText = "2^0 = 1 address, which is the host itself, so no further hosts can be assigned."
+	case ones == 31:
+		rangeText = "A /31 has only two addresses. RFC 3021 lets point-to-point links use both, so there is no network or broadcast address to set aside."
+		countText = "2^1 = 2 addresses, one for each end of the link; they are not counted as usable hosts."
+	default:
+		rangeText = fmt.Sprintf("The first address is the network and the last the broadcast, so hosts run from network + 1 = %s to broadcast - 1 = %s.",
+			result.MinHostAddress, result.MaxHostAddress)
+		countText = fmt.Sprintf("2^%d = %d addresses, minus the network and broadcast addresses, leaves %d - 2 = %s usable hosts.",
+			hostBits, total, total, result.UsableHosts)
+	}
+	e.Steps = append(e.Steps, ExplanationStep{
+		Title: "Host range",
+		Text:  rangeText,
+	}, ExplanationStep{
+		Title: "Number of hosts",
+		Text:  fmt.Sprintf("%d host bits give %s", hostBits, countText),
+	})
+	return e, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestExplainSubnet(t *testing.T) {
+	result, _ := calculateSubnet("192.168.1.100", "/26")
+	e, err := explainSubnet("192.168.1.100", "/26", result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.PrefixLength != 26 || len(e.Steps) != 5 {
+		t.Fatalf("explanation = %+v", e)
+	}
+	and := e.Steps[1].Rows
+	if and[0].Binary != "11000000.10101000.00000001.01100100" || and[1].Binary != "11111111.11111111.11111111.11000000" ||
+		and[2] != (BinaryRow{Label: "Network", Decimal: "192.168.1.64", Binary: "11000000.10101000.00000001.01000000"}) {
+		t.Errorf("AND step = %+v", and)
+	}
+	or := e.Steps[2].Rows
+	if or[1].Decimal != "0.0.0.63" || or[2].Decimal != "192.168.1.127" || or[2].Binary != "11000000.10101000.00000001.01111111" {
+		t.Errorf("OR step = %+v", or)
+	}
+	if !strings.Contains(e.Steps[3].Text, "192.168.1.65") || !strings.Contains(e.Steps[4].Text, "2^6 = 64 addresses") || !strings.Contains(e.Steps[4].Text, "64 - 2 = 62") {
+		t.Errorf("host steps = %q, %q", e.Steps[3].Text, e.Steps[4].Text)
+	}
+
+	for mask, want := range map[string]string{"/31": "RFC 3021", "/32": "single address"} {
+		result, _ := calculateSubnet("10.0.0.1", mask)
+		if e, _ := explainSubnet("10.0.0.1", mask, result); !strings.Contains(e.Steps[3].Text, want) {
+			t.Errorf("%s host range = %q", mask, e.Steps[3].Text)
+		}
+	}
+
+	result, _ = calculateCloudSubnet("10.0.1.77", "/24", "aws")
+	if e, _ := explainSubnet("10.0.1.77", "/24", result); !strings.Contains(e.Steps[4].Text, "minus the 5 the provider reserves, leaves 251") {
+		t.Errorf("cloud host count = %q", e.Steps[4].Text)
+	}
+}
+
+func TestExplainRequests(t *testing.T) {
+	rr := httptest.NewRecorder()
+	calculateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=10.1.2.3&mask=255.255.0.0&explain=true", nil))
+	var result SubnetResult
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil || result.Explanation == nil || result.Explanation.PrefixLength != 16 {
+		t.Fatalf("explained result = %d %+v %v", rr.Code, result, err)
+	}
+
+	rr = httptest.NewRecorder()
+	calculateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=10.1.2.3&mask=/16", nil))
+	if strings.Contains(rr.Body.String(), "explanation") {
+		t.Errorf("explanation without explain: %s", rr.Body)
+	}
+	rr = httptest.NewRecorder()
+	calculateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=10.1.2.3&mask=/16&explain=maybe", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid explain = %d, want 400", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	calculateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=10.1.2.3&mask=/16&explain=1&format=md", nil))
+	if body := rr.Body.String(); !strings.Contains(body, "### Step by Step") || !strings.Contains(body, "00001010.00000001.00000000.00000000") {
+		t.Errorf("markdown explanation:\n%s", body)
+	}
+
+	form := url.Values{"ip": {"10.1.2.3"}, "mask": {"/16"}, "explain": {"1"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if body := rr.Body.String(); !strings.Contains(body, "Network address: IP AND mask") || !strings.Contains(body, `name="explain" value="1" checked`) {
+		t.Errorf("page explanation:\n%s", body)
+	}
+}
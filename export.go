@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// subnetColumns is the column schema shared by every CSV export: one row per subnet,
+// so single results, prefix lists and plans can be pasted into the same spreadsheet
+var subnetColumns = []string{
+	"name", "prefix", "network_address", "broadcast_address", "subnet_mask",
+	"min_host_address", "max_host_address", "usable_hosts", "total_addresses", "cloud",
+}
+
+// SubnetRow is one subnet of an export. Name labels planned subnets and is empty
+// for plain prefixes
+type SubnetRow struct {
+	Name           string
+	Prefix         string
+	Network        string
+	Broadcast      string
+	Mask           string
+	MinHost        string
+	MaxHost        string
+	UsableHosts    uint64
+	TotalAddresses uint64
+	Cloud          string
+}
+
+// resultRow converts a calculation result, keeping its cloud-adjusted host range
+func resultRow(name string, result *SubnetResult) SubnetRow {
+	mask, _ := parseSubnetMask(result.SubnetMask)
+	ones, _ := mask.Size()
+	usable, _ := strconv.ParseUint(result.UsableHosts, 10, 64)
+	return SubnetRow{
+		Name:           name,
+		Prefix:         result.NetworkAddress + "/" + strconv.Itoa(ones),
+		Network:        result.NetworkAddress,
+		Broadcast:      result.BroadcastAddress,
+		Mask:           net.IP(mask).String(),
+		MinHost:        result.MinHostAddress,
+		MaxHost:        result.MaxHostAddress,
+		UsableHosts:    usable,
+		TotalAddresses: uint64(1) << uint(32-ones),
+		Cloud:          result.Cloud,
+	}
+}
+
+// prefixRow calculates the row of a prefix
+func prefixRow(name string, prefix *net.IPNet) SubnetRow {
+	ones, _ := prefix.Mask.Size()
+	result, _ := calculateSubnet(prefix.IP.String(), "/"+strconv.Itoa(ones))
+	result.SubnetMask = "/" + strconv.Itoa(ones)
+	return resultRow(name, result)
+}
+
+// prefixRows calculates the rows of a prefix list
+func prefixRows(prefixes []*net.IPNet) []SubnetRow {
+	rows := make([]SubnetRow, 0, len(prefixes))
+	for _, p := range prefixes {
+		rows = append(rows, prefixRow("", p))
+	}
+	return rows
+}
+
+// fields returns the row in the order of subnetColumns
+func (row SubnetRow) fields() []string {
+	return []string{
+		row.Name,
+		row.Prefix,
+		row.Network,
+		row.Broadcast,
+		row.Mask,
+		row.MinHost,
+		row.MaxHost,
+		strconv.FormatUint(row.UsableHosts, 10),
+		strconv.FormatUint(row.TotalAddresses, 10),
+		row.Cloud,
+	}
+}
+
+// writeSubnetCSV sends rows as a CSV download with the given file name
+func writeSubnetCSV(w http.ResponseWriter, filename string, rows []SubnetRow) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	writer := csv.NewWriter(w)
+	writer.Write(subnetColumns)
+	for _, row := range rows {
+		writer.Write(row.fields())
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("CSV encoding error: %v", err)
+	}
+}
+
+// values returns the row in the order of subnetColumns, keeping numbers numeric
+func (row SubnetRow) values() []interface{} {
+	return []interface{}{
+		row.Name, row.Prefix, row.Network, row.Broadcast, row.Mask,
+		row.MinHost, row.MaxHost, row.UsableHosts, row.TotalAddresses, row.Cloud,
+	}
+}
+
+// subnetSheets lays out rows as a workbook: a summary sheet with every subnet, then
+// one sheet per subnet with its details, up to maxXLSXSheets of them
+func subnetSheets(rows []SubnetRow) []xlsxSheet {
+	summary := xlsxSheet{Name: "Summary", Header: subnetColumns}
+	for _, row := range rows {
+		summary.Rows = append(summary.Rows, row.values())
+	}
+	sheets := []xlsxSheet{summary}
+	if len(rows) > maxXLSXSheets {
+		return sheets
+	}
+	for _, row := range rows {
+		sheet := xlsxSheet{Name: row.Name, Header: []string{"field", "value"}}
+		if sheet.Name == "" {
+			sheet.Name = row.Prefix
+		}
+		for i, value := range row.values() {
+			sheet.Rows = append(sheet.Rows, []interface{}{subnetColumns[i], value})
+		}
+		sheets = append(sheets, sheet)
+	}
+	return sheets
+}
+
+// markdownCell escapes a value for a Markdown table cell
+func markdownCell(value string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(value)
+}
+
+// writeMarkdownTable writes a Markdown table with a header row
+func writeMarkdownTable(w io.Writer, header []string, rows [][]string) {
+	separator := make([]string, len(header))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	for _, row := range append([][]string{header, separator}, rows...) {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = markdownCell(cell)
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+	}
+}
+
+// writeSubnetMarkdown sends rows as a Markdown report under a heading, ready to paste
+// into a wiki page or pull request
+func writeSubnetMarkdown(w http.ResponseWriter, title string, rows []SubnetRow) {
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	fmt.Fprintf(w, "## %s\n\n", title)
+	fields := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		fields = append(fields, row.fields())
+	}
+	writeMarkdownTable(w, subnetColumns, fields)
+}
+
+// writeResultMarkdown sends a calculation result as a Markdown report, followed by the
+// addresses and notes of its cloud provider and the worked solution, if any
+func writeResultMarkdown(w http.ResponseWriter, result *SubnetResult) {
+	writeSubnetMarkdown(w, result.IPAddress+" "+result.SubnetMask, []SubnetRow{resultRow("", result)})
+	if len(result.Reserved) > 0 {
+		reserved := make([][]string, 0, len(result.Reserved))
+		for _, r := range result.Reserved {
+			reserved = append(reserved, []string{r.Address, r.Purpose})
+		}
+		fmt.Fprint(w, "\n### Reserved Addresses\n\n")
+		writeMarkdownTable(w, []string{"address", "purpose"}, reserved)
+	}
+	if i := result.Integers; i != nil {
+		row := func(name string, a AddressInteger) []string {
+			return []string{name, strconv.FormatUint(uint64(a.Decimal), 10), a.Hex, a.Octal}
+		}
+		fmt.Fprint(w, "\n### Integer Forms\n\n")
+		writeMarkdownTable(w, []string{"address", "decimal", "hex", "octal"}, [][]string{
+			row("ip_address", i.IPAddress), row("network_address", i.NetworkAddress), row("broadcast_address", i.BroadcastAddress),
+		})
+	}
+	if d := result.DHCP; d != nil {
+		rows := [][]string{{"gateway", d.Gateway, d.Gateway, "1"}}
+		if d.StaticStart != "" {
+			rows = append(rows, []string{"static", d.StaticStart, d.StaticEnd, strconv.FormatUint(uint64(d.StaticAddresses), 10)})
+		}
+		rows = append(rows, []string{"pool", d.PoolStart, d.PoolEnd, strconv.FormatUint(uint64(d.PoolAddresses), 10)})
+		fmt.Fprint(w, "\n### DHCP\n\n")
+		writeMarkdownTable(w, []string{"range", "start", "end", "addresses"}, rows)
+	}
+	if len(result.CloudNotes) > 0 {
+		fmt.Fprintln(w)
+		for _, note := range result.CloudNotes {
+			fmt.Fprintf(w, "- %s\n", note)
+		}
+	}
+	if result.Explanation != nil {
+		fmt.Fprint(w, "\n### Step by Step\n")
+		for i, step := range result.Explanation.Steps {
+			fmt.Fprintf(w, "\n%d. **%s** %s\n", i+1, step.Title, step.Text)
+			if len(step.Rows) > 0 {
+				fmt.Fprint(w, "\n   ```\n")
+				for _, row := range step.Rows {
+					fmt.Fprintf(w, "   %-12s %-16s %s\n", row.Label, row.Decimal, row.Binary)
+				}
+				fmt.Fprint(w, "   ```\n")
+			}
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readCSV parses a CSV response, checking its content type and header row
+func readCSV(t *testing.T, rr *httptest.ResponseRecorder) [][]string {
+	t.Helper()
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("got %d %s, want a CSV download:\n%s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 || !reflect.DeepEqual(records[0], subnetColumns) {
+		t.Fatalf("header = %v, want %v", records, subnetColumns)
+	}
+	return records[1:]
+}
+
+func TestResultRow(t *testing.T) {
+	result, _ := calculateCloudSubnet("10.0.1.77", "255.255.255.0", "aws")
+	result.SubnetMask = "255.255.255.0"
+	got := resultRow("web", result).fields()
+	want := []string{"web", "10.0.1.0/24", "10.0.1.0", "10.0.1.255", "255.255.255.0", "10.0.1.4", "10.0.1.254", "251", "256", "aws"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("row = %v, want %v", got, want)
+	}
+
+	p31, _ := parseIPv4Prefix("192.168.0.0/31")
+	got = prefixRow("", p31).fields()
+	want = []string{"", "192.168.0.0/31", "192.168.0.0", "192.168.0.1", "255.255.255.254", "N/A", "N/A", "0", "2", ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("/31 row = %v, want %v", got, want)
+	}
+}
+
+func TestCSVExports(t *testing.T) {
+	call := func(h http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		return rr
+	}
+
+	rows := readCSV(t, call(calculateHandler, http.MethodGet, "/api/v1/calculate?ip=192.168.1.100&mask=/24&format=csv", ""))
+	if len(rows) != 1 || rows[0][1] != "192.168.1.0/24" || rows[0][7] != "254" {
+		t.Errorf("calculate rows = %v", rows)
+	}
+
+	rows = readCSV(t, call(deaggregateHandler, http.MethodGet, "/api/v1/deaggregate?prefix=10.0.0.0/24&length=26&format=csv", ""))
+	if len(rows) != 4 || rows[3][1] != "10.0.0.192/26" || rows[3][6] != "10.0.0.254" {
+		t.Errorf("deaggregate rows = %v", rows)
+	}
+
+	rows = readCSV(t, call(subtractHandler, http.MethodPost, "/api/v1/subtract?format=csv", `{"network":"10.0.0.0/24","used":["10.0.0.0/25"]}`))
+	if len(rows) != 1 || rows[0][1] != "10.0.0.128/25" {
+		t.Errorf("subtract rows = %v", rows)
+	}
+
+	rows = readCSV(t, call(aggregateHandler, http.MethodPost, "/api/v1/aggregate?format=csv", `{"prefixes":["10.0.0.0/25","10.0.0.128/25"]}`))
+	if len(rows) != 1 || rows[0][1] != "10.0.0.0/24" {
+		t.Errorf("aggregate rows = %v", rows)
+	}
+
+	rows = readCSV(t, call(dockerPlanHandler, http.MethodPost, "/api/v1/docker/plan?format=csv", `{"count":2,"names":["front","back"]}`))
+	if len(rows) != 2 || rows[0][0] != "front" || rows[1][0] != "back" || rows[0][8] != "256" {
+		t.Errorf("docker rows = %v", rows)
+	}
+}
+
+func TestMainPageCSV(t *testing.T) {
+	form := url.Values{"format": {"csv"}, "ip": {"10.0.1.77"}, "mask": {"/24"}, "cloud": {"azure"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	rows := readCSV(t, rr)
+	if len(rows) != 1 || rows[0][9] != "azure" || rows[0][5] != "10.0.1.4" {
+		t.Errorf("rows = %v", rows)
+	}
+	if !strings.Contains(rr.Header().Get("Content-Disposition"), "subnet.csv") {
+		t.Errorf("Content-Disposition = %q", rr.Header().Get("Content-Disposition"))
+	}
+}
+
+func TestMarkdownExports(t *testing.T) {
+	call := func(h http.HandlerFunc, method, target, body string) string {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/markdown") {
+			t.Fatalf("%s = %d %s", target, rr.Code, rr.Header().Get("Content-Type"))
+		}
+		return rr.Body.String()
+	}
+
+	body := call(calculateHandler, http.MethodGet, "/api/v1/calculate?ip=10.0.1.77&mask=/24&cloud=aws&format=md", "")
+	for _, want := range []string{
+		"## 10.0.1.77 /24\n",
+		"| name | prefix | network_address |",
+		"| --- | --- |",
+		"|  | 10.0.1.0/24 | 10.0.1.0 | 10.0.1.255 | 255.255.255.0 | 10.0.1.4 | 10.0.1.254 | 251 | 256 | aws |",
+		"### Reserved Addresses",
+		"| 10.0.1.1 | VPC router |",
+		"### Integer Forms",
+		"| network_address | 167772416 | 0x0a000100 | 01200000400 |",
+		"- AWS reserves",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("calculate report is missing %q:\n%s", want, body)
+		}
+	}
+
+	body = call(deaggregateHandler, http.MethodGet, "/api/v1/deaggregate?prefix=10.0.0.0/24&length=25&format=markdown", "")
+	if !strings.HasPrefix(body, "## 10.0.0.0/24\n") || strings.Count(body, "\n| ") != 4 {
+		t.Errorf("deaggregate report:\n%s", body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/cheatsheet", nil)
+	req.Header.Set("Accept", "text/markdown")
+	rr := httptest.NewRecorder()
+	cheatsheetHandler(rr, req)
+	if body := rr.Body.String(); !strings.Contains(body, "| /24 | 255.255.255.0 | 0.0.0.255 | 256 | 254 |") {
+		t.Errorf("cheatsheet report:\n%s", body)
+	}
+
+	if got := markdownCell("a|b\nc"); got != `a\|b c` {
+		t.Errorf("markdownCell = %q", got)
+	}
+}
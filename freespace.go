@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sort"
+)
+
+// defaultLargestFreeBlocks is how many free blocks are listed when no limit is requested
+const defaultLargestFreeBlocks = 10
+
+// FreeSubnetRequest describes a supernet, its allocations and an optional block size to place
+type FreeSubnetRequest struct {
+	Supernet  string   `json:"supernet"`
+	Allocated []string `json:"allocated"`
+	Size      int      `json:"size,omitempty"`
+	Limit     int      `json:"limit,omitempty"`
+}
+
+// FreeSubnetResponse reports the largest free blocks and, if a size was requested, the first fit
+type FreeSubnetResponse struct {
+	Supernet      string   `json:"supernet"`
+	LargestFree   []string `json:"largest_free"`
+	FreeAddresses uint64   `json:"free_addresses"`
+	FirstFree     string   `json:"first_free,omitempty"`
+}
+
+// largestFreeBlocks orders free prefixes by size, largest first, keeping address order for ties
+func largestFreeBlocks(free []*net.IPNet, limit int) []*net.IPNet {
+	sorted := make([]*net.IPNet, len(free))
+	copy(sorted, free)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, _ := sorted[i].Mask.Size()
+		b, _ := sorted[j].Mask.Size()
+		return a < b
+	})
+	if limit > 0 && len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+	return sorted
+}
+
+// firstFreeBlock returns the lowest-addressed free block of the given prefix length, or nil if none fits
+func firstFreeBlock(free []*net.IPNet, prefixLen int) *net.IPNet {
+	for _, p := range free {
+		if ones, _ := p.Mask.Size(); ones <= prefixLen {
+			return &net.IPNet{IP: p.IP, Mask: net.CIDRMask(prefixLen, 32)}
+		}
+	}
+	return nil
+}
+
+// freeSubnetHandler serves POST /api/v1/free
+func freeSubnetHandler(w http.ResponseWriter, r *http.Request) {
+	var req FreeSubnetRequest
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+
+	supernet, free, err := subtractPrefixes(req.Supernet, req.Allocated)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultLargestFreeBlocks
+	}
+	resp := FreeSubnetResponse{
+		Supernet:      supernet.String(),
+		LargestFree:   prefixStrings(largestFreeBlocks(free, limit)),
+		FreeAddresses: prefixAddressCount(free),
+	}
+
+	if req.Size != 0 {
+		ones, _ := supernet.Mask.Size()
+		if req.Size < ones || req.Size > 32 {
+			writeJSONError(w, http.StatusBadRequest, "requested size must be between the supernet length and /32")
+			return
+		}
+		block := firstFreeBlock(free, req.Size)
+		if block == nil {
+			writeJSONError(w, http.StatusConflict, "no free block of the requested size")
+			return
+		}
+		resp.FirstFree = block.String()
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLargestFreeBlocks(t *testing.T) {
+	free := mustParsePrefixes(t, "10.0.0.0/26", "10.0.0.64/27", "10.0.1.0/24", "10.0.2.0/26")
+	got := prefixStrings(largestFreeBlocks(free, 3))
+	expected := []string{"10.0.1.0/24", "10.0.0.0/26", "10.0.2.0/26"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("largestFreeBlocks() = %v, want %v", got, expected)
+	}
+}
+
+func TestFirstFreeBlock(t *testing.T) {
+	free := mustParsePrefixes(t, "10.0.0.96/27", "10.0.0.128/25")
+
+	if got := firstFreeBlock(free, 28); got == nil || got.String() != "10.0.0.96/28" {
+		t.Errorf("firstFreeBlock(/28) = %v, want 10.0.0.96/28", got)
+	}
+	if got := firstFreeBlock(free, 26); got == nil || got.String() != "10.0.0.128/26" {
+		t.Errorf("firstFreeBlock(/26) = %v, want 10.0.0.128/26", got)
+	}
+	if got := firstFreeBlock(free, 24); got != nil {
+		t.Errorf("firstFreeBlock(/24) = %v, want nil", got)
+	}
+}
+
+func TestFreeSubnetHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantFirst  string
+		wantLarge  string
+	}{
+		{
+			name:       "largest and first fit",
+			body:       `{"supernet":"10.0.0.0/24","allocated":["10.0.0.0/26","10.0.0.64/28"],"size":27}`,
+			wantStatus: http.StatusOK,
+			wantFirst:  "10.0.0.96/27",
+			wantLarge:  "10.0.0.128/25",
+		},
+		{
+			name:       "no fit",
+			body:       `{"supernet":"10.0.0.0/24","allocated":["10.0.0.0/25","10.0.0.128/26"],"size":25}`,
+			wantStatus: http.StatusConflict,
+		},
+		{
+			name:       "size shorter than supernet",
+			body:       `{"supernet":"10.0.0.0/24","size":16}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "allocation outside supernet",
+			body:       `{"supernet":"10.0.0.0/24","allocated":["10.1.0.0/24"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "misspelt field",
+			body:       `{"supernet":"10.0.0.0/24","allocations":["10.0.0.0/25"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/free", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			freeSubnetHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body: %s)", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp FreeSubnetResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON response: %v", err)
+			}
+			if resp.FirstFree != tt.wantFirst {
+				t.Errorf("first_free = %s, want %s", resp.FirstFree, tt.wantFirst)
+			}
+			if len(resp.LargestFree) == 0 || resp.LargestFree[0] != tt.wantLarge {
+				t.Errorf("largest_free = %v, want %s first", resp.LargestFree, tt.wantLarge)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerConfigGenerator(ConfigGenerator{
+		Name:        "ansible-inventory",
+		Description: "Ansible YAML inventory with a group per subnet",
+		Filename:    "inventory.yml",
+		Generate:    generateAnsibleInventory,
+	})
+}
+
+// ansibleGroupName derives a group name such as net_10_0_1_0_24 from a network
+func ansibleGroupName(prefix string, network *net.IPNet) string {
+	ones, _ := network.Mask.Size()
+	return fmt.Sprintf("%s_%s_%d", prefix, strings.ReplaceAll(network.IP.String(), ".", "_"), ones)
+}
+
+// generateAnsibleInventory renders a YAML inventory with one child group per network,
+// holding the subnet, netmask, gateway and VLAN as group vars and a host per usable
+// address with ansible_host set. Options: group (group name prefix, default "net"),
+// hostname (template as for reverse-zone, default "host-{ip}"), count (hosts per
+// subnet, default every usable host), vlan and vlan_name
+func generateAnsibleInventory(networks []*net.IPNet, opts generatorOptions) (string, error) {
+	prefix := opts.get("group", "net")
+	if !hclIdentifier.MatchString(prefix) {
+		return "", fmt.Errorf("invalid group %q, must start with a letter and contain only letters, digits, '-' and '_'", prefix)
+	}
+	tmpl := opts.get("hostname", "host-{ip}")
+	if !hostnameTmpl.MatchString(tmpl) {
+		return "", fmt.Errorf("invalid hostname template: %s", tmpl)
+	}
+	limit := -1
+	if count := opts.get("count", ""); count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("invalid count %q, must be a non-negative number", count)
+		}
+		limit = n
+	}
+	vlans, err := opts.vlans(networks)
+	if err != nil {
+		return "", err
+	}
+
+	total := uint64(0)
+	for _, network := range networks {
+		first, last := usableRange(network)
+		hosts := uint64(last-first) + 1
+		if limit >= 0 && uint64(limit) < hosts {
+			hosts = uint64(limit)
+		}
+		total += hosts
+	}
+	if total > maxPrefixListLen {
+		return "", fmt.Errorf("inventory would have %d hosts, at most %d are allowed; use count to limit hosts per subnet", total, maxPrefixListLen)
+	}
+
+	var b strings.Builder
+	b.WriteString("all:\n  children:\n")
+	seen := map[string]bool{}
+	for i, network := range networks {
+		group := ansibleGroupName(prefix, network)
+		if seen[group] {
+			continue
+		}
+		seen[group] = true
+
+		first, last := usableRange(network)
+		fmt.Fprintf(&b, "    %s:\n      vars:\n", group)
+		fmt.Fprintf(&b, "        subnet: %s\n", network)
+		fmt.Fprintf(&b, "        netmask: %s\n", net.IP(network.Mask))
+		fmt.Fprintf(&b, "        gateway: %s\n", uint32ToIP(first))
+		if vlan := vlanAt(vlans, i); vlan.ID != 0 {
+			fmt.Fprintf(&b, "        vlan_id: %d\n", vlan.ID)
+			if vlan.Name != "" {
+				fmt.Fprintf(&b, "        vlan_name: %s\n", vlan.Name)
+			}
+		}
+
+		if limit == 0 {
+			continue
+		}
+		b.WriteString("      hosts:\n")
+		for n, i := uint64(first), 0; n <= uint64(last) && (limit < 0 || i < limit); n, i = n+1, i+1 {
+			ip := uint32ToIP(uint32(n))
+			fmt.Fprintf(&b, "        %s:\n          ansible_host: %s\n", expandHostname(tmpl, ip), ip)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGenerateAnsibleInventory(t *testing.T) {
+	config, err := generateAnsibleInventory(mustParsePrefixes(t, "192.168.1.0/29", "10.0.0.0/31"), generatorOptions{"hostname": "web{4}", "count": "2"})
+	if err != nil {
+		t.Fatalf("generateAnsibleInventory() unexpected error: %v", err)
+	}
+	want := `all:
+  children:
+    net_192_168_1_0_29:
+      vars:
+        subnet: 192.168.1.0/29
+        netmask: 255.255.255.248
+        gateway: 192.168.1.1
+      hosts:
+        web1:
+          ansible_host: 192.168.1.1
+        web2:
+          ansible_host: 192.168.1.2
+    net_10_0_0_0_31:
+      vars:
+        subnet: 10.0.0.0/31
+        netmask: 255.255.255.254
+        gateway: 10.0.0.0
+      hosts:
+        web0:
+          ansible_host: 10.0.0.0
+        web1:
+          ansible_host: 10.0.0.1
+`
+	if config != want {
+		t.Errorf("generateAnsibleInventory() =\n%s\nwant\n%s", config, want)
+	}
+}
+
+func TestGenerateAnsibleInventoryOptions(t *testing.T) {
+	networks := mustParsePrefixes(t, "10.1.0.0/24", "10.1.0.0/24")
+
+	config, err := generateAnsibleInventory(networks, generatorOptions{"group": "lab", "count": "0"})
+	if err != nil {
+		t.Fatalf("generateAnsibleInventory() unexpected error: %v", err)
+	}
+	if strings.Count(config, "lab_10_1_0_0_24:") != 1 || strings.Contains(config, "hosts:") {
+		t.Errorf("expected one group without hosts:\n%s", config)
+	}
+
+	config, _ = generateAnsibleInventory(mustParsePrefixes(t, "10.1.0.0/24"), nil)
+	if got := strings.Count(config, "ansible_host:"); got != 254 {
+		t.Errorf("got %d hosts, want 254", got)
+	}
+
+	for _, opts := range []generatorOptions{{"group": "bad group"}, {"hostname": "a:b"}, {"count": "-1"}} {
+		if _, err := generateAnsibleInventory(networks, opts); err == nil {
+			t.Errorf("generateAnsibleInventory(%v) expected error, got nil", opts)
+		}
+	}
+	if _, err := generateAnsibleInventory(mustParsePrefixes(t, "10.0.0.0/8"), nil); err == nil {
+		t.Error("generateAnsibleInventory(/8) expected host limit error, got nil")
+	}
+}
+
+func TestWritePrefixListAnsible(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/deaggregate?prefix=10.0.0.0/29&length=30&format=ansible&count=1", nil)
+	rr := httptest.NewRecorder()
+	deaggregateHandler(rr, req)
+
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, "net_10_0_0_0_30:") || !strings.Contains(body, "host-10-0-0-5:\n          ansible_host: 10.0.0.5\n") {
+		t.Errorf("deaggregate ansible output = %d\n%s", rr.Code, body)
+	}
+}
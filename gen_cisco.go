@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	registerConfigGenerator(ConfigGenerator{
+		Name:        "cisco-acl",
+		Description: "Cisco IOS extended ACL and object-group using wildcard masks",
+		Generate:    generateCiscoACL,
+	})
+}
+
+var (
+	ciscoACLName  = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	portNumber    = regexp.MustCompile(`^\d{1,5}$`)
+	portRangeExpr = regexp.MustCompile(`^(\d{1,5})-(\d{1,5})$`)
+)
+
+// ciscoWildcardSpec renders a network as an ACL address: "any", "host a.b.c.d" or "net wildcard"
+func ciscoWildcardSpec(network *net.IPNet) string {
+	switch ones, _ := network.Mask.Size(); ones {
+	case 0:
+		return "any"
+	case 32:
+		return "host " + network.IP.String()
+	default:
+		return network.IP.String() + " " + wildcardMask(network.Mask)
+	}
+}
+
+// ciscoPortSpec turns "443" into "eq 443" and "1000-2000" into "range 1000 2000";
+// anything else (e.g. "gt 1023" or a "<port>" placeholder) is passed through
+func ciscoPortSpec(port string) string {
+	switch {
+	case port == "":
+		return ""
+	case portNumber.MatchString(port):
+		return " eq " + port
+	case portRangeExpr.MatchString(port):
+		m := portRangeExpr.FindStringSubmatch(port)
+		return " range " + m[1] + " " + m[2]
+	default:
+		return " " + port
+	}
+}
+
+// generateCiscoACL renders extended ACL entries with wildcard masks and an equivalent
+// object-group based ACL, with a remark before the entry of each network with a VLAN.
+// Options: name, object_group, action (permit|deny), protocol, port, direction
+// (source|destination), peer (default "any"), vlan and vlan_name
+func generateCiscoACL(networks []*net.IPNet, opts generatorOptions) (string, error) {
+	action, err := opts.oneOf("action", "permit", "permit", "deny")
+	if err != nil {
+		return "", err
+	}
+	direction, err := opts.oneOf("direction", "source", "source", "destination")
+	if err != nil {
+		return "", err
+	}
+	name := opts.get("name", "SUBNET-ACL")
+	group := opts.get("object_group", "SUBNET-NETS")
+	if !ciscoACLName.MatchString(name) || !ciscoACLName.MatchString(group) {
+		return "", fmt.Errorf("ACL and object-group names may only contain letters, digits, '-' and '_'")
+	}
+	vlans, err := opts.vlans(networks)
+	if err != nil {
+		return "", err
+	}
+	protocol := strings.ToLower(opts.get("protocol", "ip"))
+	peer := opts.get("peer", "any")
+	port := ""
+	if protocol == "tcp" || protocol == "udp" {
+		port = ciscoPortSpec(opts.get("port", ""))
+	}
+
+	entry := func(spec string) string {
+		if direction == "source" {
+			return fmt.Sprintf(" %s %s %s %s%s\n", action, protocol, spec, peer, port)
+		}
+		return fmt.Sprintf(" %s %s %s %s%s\n", action, protocol, peer, spec, port)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "ip access-list extended %s\n", name)
+	for i, network := range networks {
+		if vlan := vlanAt(vlans, i); vlan.ID != 0 {
+			fmt.Fprintf(&b, " remark %s\n", vlan.label())
+		}
+		b.WriteString(entry(ciscoWildcardSpec(network)))
+	}
+	b.WriteString("!\n")
+
+	fmt.Fprintf(&b, "object-group network %s\n", group)
+	for _, network := range networks {
+		if ones, _ := network.Mask.Size(); ones == 32 {
+			fmt.Fprintf(&b, " host %s\n", network.IP)
+		} else {
+			fmt.Fprintf(&b, " %s %s\n", network.IP, net.IP(network.Mask))
+		}
+	}
+	b.WriteString("!\n")
+
+	fmt.Fprintf(&b, "ip access-list extended %s-OG\n", name)
+	b.WriteString(entry("object-group " + group))
+	b.WriteString("!\n")
+	return b.String(), nil
+}
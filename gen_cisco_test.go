@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateCiscoACL(t *testing.T) {
+	networks := mustParsePrefixes(t, "192.168.1.0/24", "10.0.0.5/32", "0.0.0.0/0")
+
+	config, err := generateCiscoACL(networks, generatorOptions{"protocol": "tcp", "port": "1000-2000", "name": "WEB"})
+	if err != nil {
+		t.Fatalf("generateCiscoACL() unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"ip access-list extended WEB\n",
+		" permit tcp 192.168.1.0 0.0.0.255 any range 1000 2000\n",
+		" permit tcp host 10.0.0.5 any range 1000 2000\n",
+		" permit tcp any any range 1000 2000\n",
+		"object-group network SUBNET-NETS\n 192.168.1.0 255.255.255.0\n host 10.0.0.5\n 0.0.0.0 0.0.0.0\n",
+		"ip access-list extended WEB-OG\n permit tcp object-group SUBNET-NETS any range 1000 2000\n",
+	} {
+		if !strings.Contains(config, want) {
+			t.Errorf("config missing %q:\n%s", want, config)
+		}
+	}
+}
+
+func TestGenerateCiscoACLOptions(t *testing.T) {
+	networks := mustParsePrefixes(t, "172.16.0.0/12")
+
+	config, err := generateCiscoACL(networks, generatorOptions{"action": "deny", "direction": "destination", "peer": "host 192.0.2.1", "protocol": "udp", "port": "53"})
+	if err != nil {
+		t.Fatalf("generateCiscoACL() unexpected error: %v", err)
+	}
+	if !strings.Contains(config, " deny udp host 192.0.2.1 172.16.0.0 0.15.255.255 eq 53\n") {
+		t.Errorf("destination entry missing:\n%s", config)
+	}
+
+	// Ports are ignored for protocols without them, placeholders pass through
+	config, _ = generateCiscoACL(networks, generatorOptions{"protocol": "icmp", "port": "53"})
+	if strings.Contains(config, "eq 53") {
+		t.Errorf("icmp entry should not carry a port:\n%s", config)
+	}
+	config, _ = generateCiscoACL(networks, generatorOptions{"protocol": "tcp", "port": "eq <PORT>"})
+	if !strings.Contains(config, "any eq <PORT>\n") {
+		t.Errorf("port placeholder should pass through:\n%s", config)
+	}
+
+	for _, opts := range []generatorOptions{{"action": "allow"}, {"direction": "both"}, {"name": "bad name"}} {
+		if _, err := generateCiscoACL(networks, opts); err == nil {
+			t.Errorf("generateCiscoACL(%v) expected error, got nil", opts)
+		}
+	}
+}
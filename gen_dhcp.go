@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerConfigGenerator(ConfigGenerator{
+		Name:        "isc-dhcpd",
+		Description: "ISC dhcpd subnet declarations with pool, router and broadcast options",
+		Filename:    "dhcpd.conf",
+		Generate:    generateISCDHCPD,
+	})
+	registerConfigGenerator(ConfigGenerator{
+		Name:        "kea",
+		Description: "Kea DHCPv4 subnet4 definitions with pool, router and broadcast options",
+		Filename:    "kea-subnet4.json",
+		Generate:    generateKea,
+	})
+}
+
+var (
+	dhcpDomainName = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+	leaseTimeExpr  = regexp.MustCompile(`^(\d{1,9})([smhdw]?)$`)
+	leaseTimeUnits = map[string]int{"": 1, "s": 1, "m": 60, "h": 3600, "d": 86400, "w": 604800}
+)
+
+// dhcpSubnet is a calculated subnet together with its router, address pool and the
+// range kept for static addresses, which is nil when none is reserved
+type dhcpSubnet struct {
+	network     *net.IPNet
+	calc        *SubnetResult
+	router      net.IP
+	poolStart   net.IP
+	poolEnd     net.IP
+	staticStart net.IP
+	staticEnd   net.IP
+}
+
+// dhcpSettings holds the options shared by every subnet of a DHCP generator
+type dhcpSettings struct {
+	dns       []string
+	domain    string
+	leaseTime int
+}
+
+// optionIP parses an IPv4 address option, returning nil when the option is unset
+func optionIP(opts generatorOptions, name string) (net.IP, error) {
+	v := opts.get(name, "")
+	if v == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(v).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("invalid %s: %s", name, v)
+	}
+	return ip, nil
+}
+
+// optionPercent parses a percentage option from 0 to 100
+func optionPercent(opts generatorOptions, name string, fallback int) (int, error) {
+	v := opts.get(name, strconv.Itoa(fallback))
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > 100 {
+		return 0, fmt.Errorf("invalid %s %q, must be a percentage from 0 to 100", name, v)
+	}
+	return n, nil
+}
+
+// planDHCPSubnets calculates each network and places its router and pool. The router,
+// pool_start and pool_end options apply to the network that contains them; otherwise the
+// router is the first or last usable address (gateway option) and the addresses beside
+// it are split by percentage: static_percent next to the router is kept for static
+// addresses (default 0), then pool_percent is the pool (default the rest)
+func planDHCPSubnets(networks []*net.IPNet, opts generatorOptions) ([]dhcpSubnet, error) {
+	gateway, err := opts.oneOf("gateway", "first", "first", "last")
+	if err != nil {
+		return nil, err
+	}
+	staticPercent, err := optionPercent(opts, "static_percent", 0)
+	if err != nil {
+		return nil, err
+	}
+	poolPercent, err := optionPercent(opts, "pool_percent", 100-staticPercent)
+	if err != nil {
+		return nil, err
+	}
+	if staticPercent+poolPercent > 100 {
+		return nil, fmt.Errorf("static_percent and pool_percent add up to more than 100")
+	}
+	router, err := optionIP(opts, "router")
+	if err != nil {
+		return nil, err
+	}
+	poolStart, err := optionIP(opts, "pool_start")
+	if err != nil {
+		return nil, err
+	}
+	poolEnd, err := optionIP(opts, "pool_end")
+	if err != nil {
+		return nil, err
+	}
+	if (poolStart == nil) != (poolEnd == nil) {
+		return nil, fmt.Errorf("pool_start and pool_end must be given together")
+	}
+
+	var subnets []dhcpSubnet
+	routerUsed, poolUsed := router == nil, poolStart == nil
+	for _, network := range networks {
+		calc, err := calculateSubnet(network.IP.String(), net.IP(network.Mask).String())
+		if err != nil {
+			return nil, err
+		}
+		if calc.UsableHosts == "0" {
+			return nil, fmt.Errorf("network %s has no usable host addresses for a DHCP pool", network)
+		}
+		first := ipToUint32(net.ParseIP(calc.MinHostAddress))
+		last := ipToUint32(net.ParseIP(calc.MaxHostAddress))
+		usable := func(ip net.IP) bool {
+			n := ipToUint32(ip)
+			return n >= first && n <= last
+		}
+
+		subnet := dhcpSubnet{network: network, calc: calc, router: uint32ToIP(first)}
+		if gateway == "last" {
+			subnet.router = uint32ToIP(last)
+		}
+		if router != nil && network.Contains(router) {
+			if !usable(router) {
+				return nil, fmt.Errorf("router %s is not a usable host address of %s", router, network)
+			}
+			subnet.router, routerUsed = router, true
+		}
+
+		if poolStart != nil && network.Contains(poolStart) {
+			if !usable(poolStart) || !usable(poolEnd) || ipToUint32(poolStart) > ipToUint32(poolEnd) {
+				return nil, fmt.Errorf("pool %s - %s must be an ascending range of usable addresses in %s", poolStart, poolEnd, network)
+			}
+			subnet.poolStart, subnet.poolEnd, poolUsed = poolStart, poolEnd, true
+		} else {
+			r := ipToUint32(subnet.router)
+			if first == last {
+				return nil, fmt.Errorf("network %s has no addresses left for a pool after the router", network)
+			}
+			lo, hi := r+1, last
+			if r == last {
+				lo, hi = first, last-1
+			}
+			size := uint64(hi-lo) + 1
+			static, pool := uint32(size*uint64(staticPercent)/100), uint32(size*uint64(poolPercent)/100)
+			if opts.get("pool_percent", "") == "" {
+				pool = uint32(size) - static
+			}
+			if pool == 0 {
+				return nil, fmt.Errorf("network %s has no addresses left for a pool of %d%%", network, poolPercent)
+			}
+			if r == last {
+				if static > 0 {
+					subnet.staticStart, subnet.staticEnd = uint32ToIP(hi-static+1), uint32ToIP(hi)
+				}
+				subnet.poolStart, subnet.poolEnd = uint32ToIP(hi-static-pool+1), uint32ToIP(hi-static)
+			} else {
+				if static > 0 {
+					subnet.staticStart, subnet.staticEnd = uint32ToIP(lo), uint32ToIP(lo+static-1)
+				}
+				subnet.poolStart, subnet.poolEnd = uint32ToIP(lo+static), uint32ToIP(lo+static+pool-1)
+			}
+		}
+
+		r := ipToUint32(subnet.router)
+		if r >= ipToUint32(subnet.poolStart) && r <= ipToUint32(subnet.poolEnd) {
+			return nil, fmt.Errorf("pool %s - %s includes the router address %s", subnet.poolStart, subnet.poolEnd, subnet.router)
+		}
+		subnets = append(subnets, subnet)
+	}
+
+	if !routerUsed {
+		return nil, fmt.Errorf("router %s is not inside any of the networks", router)
+	}
+	if !poolUsed {
+		return nil, fmt.Errorf("pool %s - %s is not inside any of the networks", poolStart, poolEnd)
+	}
+	return subnets, nil
+}
+
+// parseDHCPSettings validates the dns, domain and lease_time options
+func parseDHCPSettings(opts generatorOptions) (*dhcpSettings, error) {
+	settings := &dhcpSettings{domain: opts.get("domain", "")}
+	if dns := opts.get("dns", ""); dns != "" {
+		for _, s := range strings.Split(dns, ",") {
+			ip := net.ParseIP(strings.TrimSpace(s)).To4()
+			if ip == nil {
+				return nil, fmt.Errorf("invalid dns server: %s", strings.TrimSpace(s))
+			}
+			settings.dns = append(settings.dns, ip.String())
+		}
+	}
+	if settings.domain != "" && !dhcpDomainName.MatchString(settings.domain) {
+		return nil, fmt.Errorf("invalid domain: %s", settings.domain)
+	}
+	if lease := opts.get("lease_time", ""); lease != "" {
+		m := leaseTimeExpr.FindStringSubmatch(strings.ToLower(lease))
+		n := 0
+		if m != nil {
+			n, _ = strconv.Atoi(m[1])
+		}
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid lease_time %q, must be a positive number of seconds or a duration like 12h", lease)
+		}
+		settings.leaseTime = n * leaseTimeUnits[m[2]]
+	}
+	return settings, nil
+}
+
+// generateISCDHCPD renders one subnet {} block per network, preceded by a comment
+// naming its VLAN, with the static range as a comment. Options: gateway (first|last),
+// router, pool_start, pool_end, static_percent, pool_percent, dns (comma-separated),
+// domain, lease_time (seconds, or a duration such as 12h), vlan and vlan_name
+func generateISCDHCPD(networks []*net.IPNet, opts generatorOptions) (string, error) {
+	subnets, err := planDHCPSubnets(networks, opts)
+	if err != nil {
+		return "", err
+	}
+	settings, err := parseDHCPSettings(opts)
+	if err != nil {
+		return "", err
+	}
+	vlans, err := opts.vlans(networks)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i, s := range subnets {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		mask := net.IP(s.network.Mask).String()
+		if vlan := vlanAt(vlans, i); vlan.ID != 0 {
+			fmt.Fprintf(&b, "# %s\n", vlan.label())
+		}
+		fmt.Fprintf(&b, "subnet %s netmask %s {\n", s.calc.NetworkAddress, mask)
+		if s.staticStart != nil {
+			fmt.Fprintf(&b, "  # static addresses %s - %s\n", s.staticStart, s.staticEnd)
+		}
+		fmt.Fprintf(&b, "  range %s %s;\n", s.poolStart, s.poolEnd)
+		fmt.Fprintf(&b, "  option routers %s;\n", s.router)
+		fmt.Fprintf(&b, "  option subnet-mask %s;\n", mask)
+		fmt.Fprintf(&b, "  option broadcast-address %s;\n", s.calc.BroadcastAddress)
+		if len(settings.dns) > 0 {
+			fmt.Fprintf(&b, "  option domain-name-servers %s;\n", strings.Join(settings.dns, ", "))
+		}
+		if settings.domain != "" {
+			fmt.Fprintf(&b, "  option domain-name %q;\n", settings.domain)
+		}
+		if settings.leaseTime > 0 {
+			fmt.Fprintf(&b, "  default-lease-time %d;\n", settings.leaseTime)
+			fmt.Fprintf(&b, "  max-lease-time %d;\n", 2*settings.leaseTime)
+		}
+		b.WriteString("}\n")
+	}
+	return b.String(), nil
+}
+
+type keaOptionData struct {
+	Name string `json:"name"`
+	Data string `json:"data"`
+}
+
+type keaPool struct {
+	Pool string `json:"pool"`
+}
+
+// keaUserContext records the VLAN and static range of a subnet in the free-form
+// user-context Kea keeps for hooks and the configuration backend
+type keaUserContext struct {
+	VLAN        int    `json:"vlan,omitempty"`
+	VLANName    string `json:"vlan-name,omitempty"`
+	StaticRange string `json:"static-range,omitempty"`
+}
+
+type keaSubnet4 struct {
+	ID            int             `json:"id"`
+	Subnet        string          `json:"subnet"`
+	Pools         []keaPool       `json:"pools"`
+	OptionData    []keaOptionData `json:"option-data"`
+	ValidLifetime int             `json:"valid-lifetime,omitempty"`
+	UserContext   *keaUserContext `json:"user-context,omitempty"`
+}
+
+// generateKea renders a Kea "subnet4" list with one entry per network. Takes the
+// same options as isc-dhcpd plus id, the subnet id of the first network (default 1);
+// VLANs and static ranges are recorded in the user-context of their subnets
+func generateKea(networks []*net.IPNet, opts generatorOptions) (string, error) {
+	subnets, err := planDHCPSubnets(networks, opts)
+	if err != nil {
+		return "", err
+	}
+	settings, err := parseDHCPSettings(opts)
+	if err != nil {
+		return "", err
+	}
+	firstID, err := strconv.Atoi(opts.get("id", "1"))
+	if err != nil || firstID <= 0 {
+		return "", fmt.Errorf("invalid id %q, must be a positive number", opts.get("id", "1"))
+	}
+	vlans, err := opts.vlans(networks)
+	if err != nil {
+		return "", err
+	}
+
+	list := make([]keaSubnet4, 0, len(subnets))
+	for i, s := range subnets {
+		subnet := keaSubnet4{
+			ID:     firstID + i,
+			Subnet: s.network.String(),
+			Pools:  []keaPool{{Pool: fmt.Sprintf("%s - %s", s.poolStart, s.poolEnd)}},
+			OptionData: []keaOptionData{
+				{Name: "routers", Data: s.router.String()},
+				{Name: "broadcast-address", Data: s.calc.BroadcastAddress},
+			},
+			ValidLifetime: settings.leaseTime,
+		}
+		if len(settings.dns) > 0 {
+			subnet.OptionData = append(subnet.OptionData, keaOptionData{Name: "domain-name-servers", Data: strings.Join(settings.dns, ", ")})
+		}
+		if settings.domain != "" {
+			subnet.OptionData = append(subnet.OptionData, keaOptionData{Name: "domain-name", Data: settings.domain})
+		}
+		context := keaUserContext{VLAN: vlanAt(vlans, i).ID, VLANName: vlanAt(vlans, i).Name}
+		if s.staticStart != nil {
+			context.StaticRange = fmt.Sprintf("%s - %s", s.staticStart, s.staticEnd)
+		}
+		if context != (keaUserContext{}) {
+			subnet.UserContext = &context
+		}
+		list = append(list, subnet)
+	}
+
+	out, err := json.MarshalIndent(map[string][]keaSubnet4{"subnet4": list}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out) + "\n", nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPlanDHCPSubnets(t *testing.T) {
+	tests := []struct {
+		name      string
+		networks  []string
+		opts      generatorOptions
+		wantPools []string
+		wantErr   bool
+	}{
+		{"default router and pool", []string{"192.168.1.0/24"}, nil, []string{"192.168.1.1 192.168.1.2-192.168.1.254"}, false},
+		{"router at end of range", []string{"192.168.1.0/24"}, generatorOptions{"router": "192.168.1.254"}, []string{"192.168.1.254 192.168.1.1-192.168.1.253"}, false},
+		{"/30 leaves one pool address", []string{"10.0.0.0/30"}, nil, []string{"10.0.0.1 10.0.0.2-10.0.0.2"}, false},
+		{"pool applies to containing network", []string{"10.0.0.0/24", "10.0.1.0/24"}, generatorOptions{"pool_start": "10.0.1.100", "pool_end": "10.0.1.200"},
+			[]string{"10.0.0.1 10.0.0.2-10.0.0.254", "10.0.1.1 10.0.1.100-10.0.1.200"}, false},
+		{"static range after first router", []string{"192.168.1.0/24"}, generatorOptions{"static_percent": "10"}, []string{"192.168.1.1 192.168.1.27-192.168.1.254"}, false},
+		{"percentages leave a reserve", []string{"192.168.1.0/24"}, generatorOptions{"static_percent": "20", "pool_percent": "50"}, []string{"192.168.1.1 192.168.1.52-192.168.1.177"}, false},
+		{"static range before last router", []string{"10.0.0.0/28"}, generatorOptions{"gateway": "last", "static_percent": "50", "pool_percent": "40"}, []string{"10.0.0.14 10.0.0.3-10.0.0.7"}, false},
+		{"/31 has no pool", []string{"10.0.0.0/31"}, nil, nil, true},
+		{"no pool left", []string{"10.0.0.0/29"}, generatorOptions{"static_percent": "100"}, nil, true},
+		{"percentages over 100", []string{"10.0.0.0/24"}, generatorOptions{"static_percent": "60", "pool_percent": "50"}, nil, true},
+		{"invalid percentage", []string{"10.0.0.0/24"}, generatorOptions{"static_percent": "ten"}, nil, true},
+		{"router outside networks", []string{"10.0.0.0/24"}, generatorOptions{"router": "10.0.1.1"}, nil, true},
+		{"router is broadcast", []string{"10.0.0.0/24"}, generatorOptions{"router": "10.0.0.255"}, nil, true},
+		{"pool without end", []string{"10.0.0.0/24"}, generatorOptions{"pool_start": "10.0.0.10"}, nil, true},
+		{"descending pool", []string{"10.0.0.0/24"}, generatorOptions{"pool_start": "10.0.0.20", "pool_end": "10.0.0.10"}, nil, true},
+		{"pool includes router", []string{"10.0.0.0/24"}, generatorOptions{"pool_start": "10.0.0.1", "pool_end": "10.0.0.10"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subnets, err := planDHCPSubnets(mustParsePrefixes(t, tt.networks...), tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("planDHCPSubnets() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planDHCPSubnets() unexpected error: %v", err)
+			}
+			var got []string
+			for _, s := range subnets {
+				got = append(got, s.router.String()+" "+s.poolStart.String()+"-"+s.poolEnd.String())
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantPools, ",") {
+				t.Errorf("planDHCPSubnets() = %v, want %v", got, tt.wantPools)
+			}
+		})
+	}
+}
+
+func TestGenerateISCDHCPD(t *testing.T) {
+	config, err := generateISCDHCPD(mustParsePrefixes(t, "192.168.1.0/24"), generatorOptions{"dns": "1.1.1.1, 8.8.8.8", "domain": "lan.example", "lease_time": "3600"})
+	if err != nil {
+		t.Fatalf("generateISCDHCPD() unexpected error: %v", err)
+	}
+	want := `subnet 192.168.1.0 netmask 255.255.255.0 {
+  range 192.168.1.2 192.168.1.254;
+  option routers 192.168.1.1;
+  option subnet-mask 255.255.255.0;
+  option broadcast-address 192.168.1.255;
+  option domain-name-servers 1.1.1.1, 8.8.8.8;
+  option domain-name "lan.example";
+  default-lease-time 3600;
+  max-lease-time 7200;
+}
+`
+	if config != want {
+		t.Errorf("generateISCDHCPD() =\n%s\nwant\n%s", config, want)
+	}
+
+	config, err = generateISCDHCPD(mustParsePrefixes(t, "10.0.0.0/28"), generatorOptions{"gateway": "last", "static_percent": "50"})
+	if err != nil || !strings.Contains(config, "  # static addresses 10.0.0.8 - 10.0.0.13\n  range 10.0.0.1 10.0.0.7;\n  option routers 10.0.0.14;\n") {
+		t.Errorf("generateISCDHCPD() with a static range = %q, %v", config, err)
+	}
+
+	for _, opts := range []generatorOptions{{"dns": "dns.example"}, {"domain": "bad\"name"}, {"lease_time": "-1"}} {
+		if _, err := generateISCDHCPD(mustParsePrefixes(t, "192.168.1.0/24"), opts); err == nil {
+			t.Errorf("generateISCDHCPD(%v) expected error, got nil", opts)
+		}
+	}
+}
+
+func TestGenerateKea(t *testing.T) {
+	config, err := generateKea(mustParsePrefixes(t, "10.0.0.0/24", "10.0.1.0/25"), generatorOptions{"id": "10", "dns": "10.0.0.53", "lease_time": "600"})
+	if err != nil {
+		t.Fatalf("generateKea() unexpected error: %v", err)
+	}
+
+	var parsed struct {
+		Subnet4 []keaSubnet4 `json:"subnet4"`
+	}
+	if err := json.Unmarshal([]byte(config), &parsed); err != nil {
+		t.Fatalf("generateKea() produced invalid JSON: %v\n%s", err, config)
+	}
+	if len(parsed.Subnet4) != 2 {
+		t.Fatalf("got %d subnets, want 2", len(parsed.Subnet4))
+	}
+	second := parsed.Subnet4[1]
+	if second.ID != 11 || second.Subnet != "10.0.1.0/25" || second.Pools[0].Pool != "10.0.1.2 - 10.0.1.126" || second.ValidLifetime != 600 {
+		t.Errorf("unexpected second subnet: %+v", second)
+	}
+	wantOptions := []keaOptionData{{"routers", "10.0.1.1"}, {"broadcast-address", "10.0.1.127"}, {"domain-name-servers", "10.0.0.53"}}
+	if len(second.OptionData) != len(wantOptions) {
+		t.Fatalf("option-data = %+v, want %+v", second.OptionData, wantOptions)
+	}
+	for i, want := range wantOptions {
+		if second.OptionData[i] != want {
+			t.Errorf("option-data[%d] = %+v, want %+v", i, second.OptionData[i], want)
+		}
+	}
+
+	if _, err := generateKea(mustParsePrefixes(t, "10.0.0.0/24"), generatorOptions{"id": "zero"}); err == nil {
+		t.Error("generateKea() with invalid id expected error, got nil")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerConfigGenerator(ConfigGenerator{
+		Name:        "dnsmasq",
+		Description: "dnsmasq dhcp-range and dhcp-option lines",
+		Filename:    "dnsmasq.conf",
+		Generate:    generateDnsmasq,
+	})
+}
+
+var dnsmasqTag = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// dnsmasqLeaseTime renders seconds in the largest whole unit dnsmasq understands
+func dnsmasqLeaseTime(seconds int) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int
+	}{{"h", 3600}, {"m", 60}} {
+		if seconds%unit.size == 0 {
+			return strconv.Itoa(seconds/unit.size) + unit.suffix
+		}
+	}
+	return strconv.Itoa(seconds)
+}
+
+// generateDnsmasq renders a tagged dhcp-range per network with router, DNS and domain
+// dhcp-option lines, commented with its VLAN and static range. Takes the isc-dhcpd options plus tag
+// (default "lan"); the lease time defaults to dnsmasq's 12h
+func generateDnsmasq(networks []*net.IPNet, opts generatorOptions) (string, error) {
+	subnets, err := planDHCPSubnets(networks, opts)
+	if err != nil {
+		return "", err
+	}
+	settings, err := parseDHCPSettings(opts)
+	if err != nil {
+		return "", err
+	}
+	tagPrefix := opts.get("tag", "lan")
+	if !dnsmasqTag.MatchString(tagPrefix) {
+		return "", fmt.Errorf("invalid tag: %s", tagPrefix)
+	}
+	lease := "12h"
+	if settings.leaseTime > 0 {
+		lease = dnsmasqLeaseTime(settings.leaseTime)
+	}
+	vlans, err := opts.vlans(networks)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i, s := range subnets {
+		tag := tagPrefix
+		if len(subnets) > 1 {
+			tag = fmt.Sprintf("%s%d", tagPrefix, i)
+		}
+		if vlan := vlanAt(vlans, i); vlan.ID != 0 {
+			fmt.Fprintf(&b, "# %s\n", vlan.label())
+		}
+		if s.staticStart != nil {
+			fmt.Fprintf(&b, "# static addresses %s - %s\n", s.staticStart, s.staticEnd)
+		}
+		fmt.Fprintf(&b, "dhcp-range=set:%s,%s,%s,%s,%s,%s\n", tag, s.poolStart, s.poolEnd, net.IP(s.network.Mask), s.calc.BroadcastAddress, lease)
+		fmt.Fprintf(&b, "dhcp-option=tag:%s,option:router,%s\n", tag, s.router)
+		if len(settings.dns) > 0 {
+			fmt.Fprintf(&b, "dhcp-option=tag:%s,option:dns-server,%s\n", tag, strings.Join(settings.dns, ","))
+		}
+		if settings.domain != "" {
+			fmt.Fprintf(&b, "dhcp-option=tag:%s,option:domain-name,%s\n", tag, settings.domain)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestDnsmasqLeaseTime(t *testing.T) {
+	tests := map[int]string{43200: "12h", 5400: "90m", 150: "150", 604800: "168h"}
+	for seconds, want := range tests {
+		if got := dnsmasqLeaseTime(seconds); got != want {
+			t.Errorf("dnsmasqLeaseTime(%d) = %q, want %q", seconds, got, want)
+		}
+	}
+}
+
+func TestGenerateDnsmasq(t *testing.T) {
+	tests := []struct {
+		name     string
+		networks []string
+		opts     generatorOptions
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "defaults",
+			networks: []string{"192.168.1.0/24"},
+			want: "dhcp-range=set:lan,192.168.1.2,192.168.1.254,255.255.255.0,192.168.1.255,12h\n" +
+				"dhcp-option=tag:lan,option:router,192.168.1.1\n",
+		},
+		{
+			name:     "last host gateway with dns, domain and lease",
+			networks: []string{"10.0.0.0/28"},
+			opts:     generatorOptions{"gateway": "last", "dns": "10.0.0.14,9.9.9.9", "domain": "office.lan", "lease_time": "2d"},
+			want: "dhcp-range=set:lan,10.0.0.1,10.0.0.13,255.255.255.240,10.0.0.15,48h\n" +
+				"dhcp-option=tag:lan,option:router,10.0.0.14\n" +
+				"dhcp-option=tag:lan,option:dns-server,10.0.0.14,9.9.9.9\n" +
+				"dhcp-option=tag:lan,option:domain-name,office.lan\n",
+		},
+		{
+			name:     "multiple networks get numbered tags",
+			networks: []string{"10.0.0.0/30", "10.0.1.0/30"},
+			opts:     generatorOptions{"tag": "vlan", "lease_time": "3600"},
+			want: "dhcp-range=set:vlan0,10.0.0.2,10.0.0.2,255.255.255.252,10.0.0.3,1h\n" +
+				"dhcp-option=tag:vlan0,option:router,10.0.0.1\n" +
+				"dhcp-range=set:vlan1,10.0.1.2,10.0.1.2,255.255.255.252,10.0.1.3,1h\n" +
+				"dhcp-option=tag:vlan1,option:router,10.0.1.1\n",
+		},
+		{name: "invalid gateway", networks: []string{"10.0.0.0/24"}, opts: generatorOptions{"gateway": "middle"}, wantErr: true},
+		{name: "invalid tag", networks: []string{"10.0.0.0/24"}, opts: generatorOptions{"tag": "a,b"}, wantErr: true},
+		{name: "invalid lease", networks: []string{"10.0.0.0/24"}, opts: generatorOptions{"lease_time": "12y"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generateDnsmasq(mustParsePrefixes(t, tt.networks...), tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("generateDnsmasq() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("generateDnsmasq() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("generateDnsmasq() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
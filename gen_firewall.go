@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	registerConfigGenerator(ConfigGenerator{
+		Name:        "iptables",
+		Description: "iptables rules accepting or dropping traffic for the networks",
+		Filename:    "rules.sh",
+		Generate:    generateIptables,
+	})
+	registerConfigGenerator(ConfigGenerator{
+		Name:        "nftables",
+		Description: "nftables rule matching the networks as an anonymous set",
+		Filename:    "rules.nft",
+		Generate:    generateNftables,
+	})
+}
+
+var firewallName = regexp.MustCompile(`^[A-Za-z0-9_.+*-]+$`)
+
+// firewallRule holds the options shared by the iptables and nftables generators
+type firewallRule struct {
+	chain     string
+	iface     string
+	action    string
+	direction string
+	protocol  string
+	port      string
+}
+
+// parseFirewallRule validates the chain, interface, action, direction, protocol and port options
+func parseFirewallRule(opts generatorOptions, defaultChain string) (*firewallRule, error) {
+	rule := &firewallRule{
+		chain: opts.get("chain", defaultChain),
+		iface: opts.get("interface", ""),
+	}
+	var err error
+	if rule.action, err = opts.oneOf("action", "accept", "accept", "drop", "reject"); err != nil {
+		return nil, err
+	}
+	if rule.direction, err = opts.oneOf("direction", "source", "source", "destination"); err != nil {
+		return nil, err
+	}
+	if rule.protocol, err = opts.oneOf("protocol", "all", "all", "tcp", "udp", "icmp"); err != nil {
+		return nil, err
+	}
+	if !firewallName.MatchString(rule.chain) {
+		return nil, fmt.Errorf("invalid chain name: %s", rule.chain)
+	}
+	if rule.iface != "" && !firewallName.MatchString(rule.iface) {
+		return nil, fmt.Errorf("invalid interface name: %s", rule.iface)
+	}
+
+	port := opts.get("port", "")
+	if port != "" {
+		if rule.protocol != "tcp" && rule.protocol != "udp" {
+			return nil, fmt.Errorf("port requires protocol tcp or udp")
+		}
+		if !portNumber.MatchString(port) && !portRangeExpr.MatchString(port) {
+			return nil, fmt.Errorf("invalid port %q, must be a number or a range like 1000-2000", port)
+		}
+		rule.port = port
+	}
+	return rule, nil
+}
+
+// outbound reports whether the chain only sees traffic leaving an interface
+func (rule *firewallRule) outbound() bool {
+	chain := strings.ToLower(rule.chain)
+	return chain == "output" || chain == "postrouting"
+}
+
+// generateIptables renders one iptables append command per network, with a comment
+// match naming its VLAN. Options: chain (INPUT), interface, action (accept|drop|reject),
+// direction (source|destination), protocol (all|tcp|udp|icmp), port, vlan and vlan_name
+func generateIptables(networks []*net.IPNet, opts generatorOptions) (string, error) {
+	rule, err := parseFirewallRule(opts, "INPUT")
+	if err != nil {
+		return "", err
+	}
+	vlans, err := opts.vlans(networks)
+	if err != nil {
+		return "", err
+	}
+
+	var match strings.Builder
+	if rule.iface != "" {
+		if rule.outbound() {
+			fmt.Fprintf(&match, " -o %s", rule.iface)
+		} else {
+			fmt.Fprintf(&match, " -i %s", rule.iface)
+		}
+	}
+	addrFlag := "-s"
+	if rule.direction == "destination" {
+		addrFlag = "-d"
+	}
+	var suffix strings.Builder
+	if rule.protocol != "all" {
+		fmt.Fprintf(&suffix, " -p %s", rule.protocol)
+	}
+	if rule.port != "" {
+		fmt.Fprintf(&suffix, " --dport %s", strings.Replace(rule.port, "-", ":", 1))
+	}
+	fmt.Fprintf(&suffix, " -j %s", strings.ToUpper(rule.action))
+
+	var b strings.Builder
+	for i, network := range networks {
+		comment := ""
+		if vlan := vlanAt(vlans, i); vlan.ID != 0 {
+			comment = fmt.Sprintf(" -m comment --comment \"%s\"", vlan.label())
+		}
+		fmt.Fprintf(&b, "iptables -A %s%s %s %s%s%s\n", rule.chain, match.String(), addrFlag, network, comment, suffix.String())
+	}
+	return b.String(), nil
+}
+
+// generateNftables renders a single nft rule matching all networks as an anonymous set,
+// after a comment line per network with a VLAN. Options: table (inet filter), chain
+// (input) and the same rule options as iptables
+func generateNftables(networks []*net.IPNet, opts generatorOptions) (string, error) {
+	rule, err := parseFirewallRule(opts, "input")
+	if err != nil {
+		return "", err
+	}
+	table := opts.get("table", "inet filter")
+	for _, field := range strings.Fields(table) {
+		if !firewallName.MatchString(field) {
+			return "", fmt.Errorf("invalid table: %s", table)
+		}
+	}
+	vlans, err := opts.vlans(networks)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i, network := range networks {
+		if vlan := vlanAt(vlans, i); vlan.ID != 0 {
+			fmt.Fprintf(&b, "# %s: %s\n", network, vlan.label())
+		}
+	}
+	fmt.Fprintf(&b, "add rule %s %s", table, rule.chain)
+	if rule.iface != "" {
+		if rule.outbound() {
+			fmt.Fprintf(&b, " oifname %q", rule.iface)
+		} else {
+			fmt.Fprintf(&b, " iifname %q", rule.iface)
+		}
+	}
+
+	addrMatch := "saddr"
+	if rule.direction == "destination" {
+		addrMatch = "daddr"
+	}
+	if len(networks) == 1 {
+		fmt.Fprintf(&b, " ip %s %s", addrMatch, networks[0])
+	} else {
+		fmt.Fprintf(&b, " ip %s { %s }", addrMatch, strings.Join(prefixStrings(networks), ", "))
+	}
+
+	switch {
+	case rule.port != "":
+		fmt.Fprintf(&b, " %s dport %s", rule.protocol, rule.port)
+	case rule.protocol != "all":
+		fmt.Fprintf(&b, " meta l4proto %s", rule.protocol)
+	}
+	fmt.Fprintf(&b, " %s\n", rule.action)
+	return b.String(), nil
+}
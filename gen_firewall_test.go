@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateIptables(t *testing.T) {
+	networks := mustParsePrefixes(t, "10.0.0.0/24", "192.168.1.5/32")
+
+	tests := []struct {
+		name string
+		opts generatorOptions
+		want string
+	}{
+		{"defaults", nil, "iptables -A INPUT -s 10.0.0.0/24 -j ACCEPT\niptables -A INPUT -s 192.168.1.5/32 -j ACCEPT\n"},
+		{"inbound interface and port range", generatorOptions{"interface": "eth0", "action": "drop", "protocol": "tcp", "port": "1000-2000"},
+			"iptables -A INPUT -i eth0 -s 10.0.0.0/24 -p tcp --dport 1000:2000 -j DROP\n"},
+		{"outbound destination", generatorOptions{"chain": "OUTPUT", "interface": "wg0", "direction": "destination", "protocol": "udp", "port": "53", "action": "reject"},
+			"iptables -A OUTPUT -o wg0 -d 10.0.0.0/24 -p udp --dport 53 -j REJECT\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generateIptables(networks, tt.opts)
+			if err != nil {
+				t.Fatalf("generateIptables() unexpected error: %v", err)
+			}
+			if !strings.HasPrefix(got, tt.want) {
+				t.Errorf("generateIptables() =\n%s\nwant prefix\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateNftables(t *testing.T) {
+	tests := []struct {
+		name     string
+		networks []string
+		opts     generatorOptions
+		want     string
+	}{
+		{"single network", []string{"10.0.0.0/8"}, nil, "add rule inet filter input ip saddr 10.0.0.0/8 accept\n"},
+		{"set with port", []string{"10.0.0.0/24", "10.0.2.0/24"}, generatorOptions{"interface": "eth1", "protocol": "tcp", "port": "22", "action": "drop"},
+			"add rule inet filter input iifname \"eth1\" ip saddr { 10.0.0.0/24, 10.0.2.0/24 } tcp dport 22 drop\n"},
+		{"custom table and chain", []string{"172.16.0.0/12"}, generatorOptions{"table": "ip nat", "chain": "postrouting", "interface": "ppp0", "direction": "destination", "protocol": "icmp"},
+			"add rule ip nat postrouting oifname \"ppp0\" ip daddr 172.16.0.0/12 meta l4proto icmp accept\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generateNftables(mustParsePrefixes(t, tt.networks...), tt.opts)
+			if err != nil {
+				t.Fatalf("generateNftables() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("generateNftables() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirewallOptionValidation(t *testing.T) {
+	networks := mustParsePrefixes(t, "10.0.0.0/24")
+	for _, opts := range []generatorOptions{
+		{"action": "allow"},
+		{"chain": "INPUT; rm -rf /"},
+		{"interface": "eth0 -j ACCEPT"},
+		{"port": "22"},
+		{"protocol": "tcp", "port": "ssh"},
+		{"table": "inet filter;"},
+	} {
+		if _, err := generateNftables(networks, opts); err == nil {
+			t.Errorf("generateNftables(%v) expected error, got nil", opts)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// interfaceVendor describes how one vendor configures interface addresses
+type interfaceVendor struct {
+	name             string
+	label            string
+	defaultInterface string
+	render           func(b *strings.Builder, iface, description string, addrs []interfaceAddress)
+	renderVLAN       func(b *strings.Builder, iface, description string, vlan subnetVLAN, addr interfaceAddress)
+}
+
+// interfaceAddress is a host address assigned to an interface within its network
+type interfaceAddress struct {
+	ip      net.IP
+	network *net.IPNet
+}
+
+func (a interfaceAddress) cidr() string {
+	ones, _ := a.network.Mask.Size()
+	return fmt.Sprintf("%s/%d", a.ip, ones)
+}
+
+var interfaceVendors = []interfaceVendor{
+	{"cisco", "Cisco IOS", "GigabitEthernet0/0", renderCiscoInterface, renderCiscoVLAN},
+	{"juniper", "Juniper Junos", "ge-0/0/0", renderJuniperInterface, renderJuniperVLAN},
+	{"mikrotik", "MikroTik RouterOS", "ether1", renderMikroTikInterface, renderMikroTikVLAN},
+}
+
+func init() {
+	for _, vendor := range interfaceVendors {
+		vendor := vendor
+		registerConfigGenerator(ConfigGenerator{
+			Name:        vendor.name + "-interface",
+			Description: vendor.label + " interface address configuration",
+			Generate: func(networks []*net.IPNet, opts generatorOptions) (string, error) {
+				return generateInterfaceConfig(vendor, networks, opts)
+			},
+		})
+	}
+}
+
+var (
+	interfaceName        = regexp.MustCompile(`^[A-Za-z0-9/._:-]+$`)
+	interfaceDescription = regexp.MustCompile(`^[^"\\\r\n]*$`)
+)
+
+// interfaceHostAddress picks the address to configure in network: address when the
+// network contains it, otherwise the first or last usable host. /31 and /32 networks
+// use their first address
+func interfaceHostAddress(network *net.IPNet, address net.IP, gateway string) (net.IP, bool, error) {
+	first := ipToUint32(network.IP)
+	ones, _ := network.Mask.Size()
+	last := first | ^ipToUint32(net.IP(network.Mask))
+
+	if address != nil && network.Contains(address) {
+		n := ipToUint32(address)
+		if ones < 31 && (n == first || n == last) {
+			return nil, false, fmt.Errorf("address %s is the network or broadcast address of %s", address, network)
+		}
+		return address, true, nil
+	}
+	switch {
+	case ones >= 31:
+		return uint32ToIP(first), false, nil
+	case gateway == "last":
+		return uint32ToIP(last - 1), false, nil
+	default:
+		return uint32ToIP(first + 1), false, nil
+	}
+}
+
+// generateInterfaceConfig assigns one address per network to an interface. The first
+// network is the primary address and the rest are secondaries; a network with a VLAN
+// gets a VLAN interface of its own instead, described by the VLAN name. Options:
+// interface, description, address (applies to the network containing it), gateway
+// (first|last), vlan and vlan_name
+func generateInterfaceConfig(vendor interfaceVendor, networks []*net.IPNet, opts generatorOptions) (string, error) {
+	iface := opts.get("interface", vendor.defaultInterface)
+	if !interfaceName.MatchString(iface) {
+		return "", fmt.Errorf("invalid interface name: %s", iface)
+	}
+	description := opts.get("description", "")
+	if !interfaceDescription.MatchString(description) {
+		return "", fmt.Errorf("description may not contain quotes, backslashes or line breaks")
+	}
+	gateway, err := opts.oneOf("gateway", "first", "first", "last")
+	if err != nil {
+		return "", err
+	}
+	address, err := optionIP(opts, "address")
+	if err != nil {
+		return "", err
+	}
+
+	vlans, err := opts.vlans(networks)
+	if err != nil {
+		return "", err
+	}
+
+	addrs := make([]interfaceAddress, 0, len(networks))
+	addressUsed := address == nil
+	for _, network := range networks {
+		ip, used, err := interfaceHostAddress(network, address, gateway)
+		if err != nil {
+			return "", err
+		}
+		addressUsed = addressUsed || used
+		addrs = append(addrs, interfaceAddress{ip: ip, network: network})
+	}
+	if !addressUsed {
+		return "", fmt.Errorf("address %s is not inside any of the networks", address)
+	}
+
+	var untagged []interfaceAddress
+	for i, a := range addrs {
+		if vlanAt(vlans, i).ID == 0 {
+			untagged = append(untagged, a)
+		}
+	}
+	var b strings.Builder
+	if len(untagged) > 0 {
+		vendor.render(&b, iface, description, untagged)
+	}
+	for i, a := range addrs {
+		if vlan := vlanAt(vlans, i); vlan.ID != 0 {
+			vlanDescription := vlan.Name
+			if vlanDescription == "" {
+				vlanDescription = description
+			}
+			vendor.renderVLAN(&b, iface, vlanDescription, vlan, a)
+		}
+	}
+	return b.String(), nil
+}
+
+// vlanInterfaceName names the VLAN interface of platforms that need one: the VLAN
+// name, or vlanN
+func vlanInterfaceName(vlan subnetVLAN) string {
+	if vlan.Name != "" {
+		return vlan.Name
+	}
+	return fmt.Sprintf("vlan%d", vlan.ID)
+}
+
+func renderCiscoInterface(b *strings.Builder, iface, description string, addrs []interfaceAddress) {
+	fmt.Fprintf(b, "interface %s\n", iface)
+	if description != "" {
+		fmt.Fprintf(b, " description %s\n", description)
+	}
+	for i, a := range addrs {
+		secondary := ""
+		if i > 0 {
+			secondary = " secondary"
+		}
+		fmt.Fprintf(b, " ip address %s %s%s\n", a.ip, net.IP(a.network.Mask), secondary)
+	}
+	b.WriteString(" no shutdown\n!\n")
+}
+
+// renderCiscoVLAN declares the VLAN and configures the address on its SVI
+func renderCiscoVLAN(b *strings.Builder, _, description string, vlan subnetVLAN, a interfaceAddress) {
+	fmt.Fprintf(b, "vlan %d\n", vlan.ID)
+	if vlan.Name != "" {
+		fmt.Fprintf(b, " name %s\n", vlan.Name)
+	}
+	fmt.Fprintf(b, "!\ninterface Vlan%d\n", vlan.ID)
+	if description != "" {
+		fmt.Fprintf(b, " description %s\n", description)
+	}
+	fmt.Fprintf(b, " ip address %s %s\n no shutdown\n!\n", a.ip, net.IP(a.network.Mask))
+}
+
+// renderJuniperInterface treats a ".N" suffix on the interface name as the logical unit
+func renderJuniperInterface(b *strings.Builder, iface, description string, addrs []interfaceAddress) {
+	unit := "0"
+	if i := strings.LastIndex(iface, "."); i > 0 {
+		iface, unit = iface[:i], iface[i+1:]
+	}
+	if description != "" {
+		fmt.Fprintf(b, "set interfaces %s unit %s description \"%s\"\n", iface, unit, description)
+	}
+	for _, a := range addrs {
+		fmt.Fprintf(b, "set interfaces %s unit %s family inet address %s\n", iface, unit, a.cidr())
+	}
+}
+
+// renderJuniperVLAN declares the VLAN with an irb unit of the same number as its
+// layer 3 interface
+func renderJuniperVLAN(b *strings.Builder, _, description string, vlan subnetVLAN, a interfaceAddress) {
+	name := vlanInterfaceName(vlan)
+	fmt.Fprintf(b, "set vlans %s vlan-id %d\n", name, vlan.ID)
+	fmt.Fprintf(b, "set vlans %s l3-interface irb.%d\n", name, vlan.ID)
+	if description != "" {
+		fmt.Fprintf(b, "set interfaces irb unit %d description \"%s\"\n", vlan.ID, description)
+	}
+	fmt.Fprintf(b, "set interfaces irb unit %d family inet address %s\n", vlan.ID, a.cidr())
+}
+
+// renderMikroTikVLAN adds a VLAN interface on top of the interface and the address on it
+func renderMikroTikVLAN(b *strings.Builder, iface, description string, vlan subnetVLAN, a interfaceAddress) {
+	name := vlanInterfaceName(vlan)
+	fmt.Fprintf(b, "/interface vlan add name=%s vlan-id=%d interface=%s\n", name, vlan.ID, iface)
+	comment := ""
+	if description != "" {
+		comment = fmt.Sprintf(" comment=\"%s\"", description)
+	}
+	fmt.Fprintf(b, "/ip address add address=%s network=%s interface=%s%s\n", a.cidr(), a.network.IP, name, comment)
+}
+
+func renderMikroTikInterface(b *strings.Builder, iface, description string, addrs []interfaceAddress) {
+	for _, a := range addrs {
+		comment := ""
+		if description != "" {
+			comment = fmt.Sprintf(" comment=\"%s\"", description)
+		}
+		fmt.Fprintf(b, "/ip address add address=%s network=%s interface=%s%s\n", a.cidr(), a.network.IP, iface, comment)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInterfaceHostAddress(t *testing.T) {
+	tests := []struct {
+		network  string
+		address  string
+		gateway  string
+		want     string
+		wantUsed bool
+		wantErr  bool
+	}{
+		{"192.168.1.0/24", "", "first", "192.168.1.1", false, false},
+		{"192.168.1.0/24", "", "last", "192.168.1.254", false, false},
+		{"192.168.1.0/24", "192.168.1.77", "first", "192.168.1.77", true, false},
+		{"192.168.1.0/24", "10.0.0.1", "last", "192.168.1.254", false, false},
+		{"192.168.1.0/24", "192.168.1.255", "first", "", false, true},
+		{"10.0.0.0/31", "10.0.0.1", "first", "10.0.0.1", true, false},
+		{"10.0.0.0/31", "", "last", "10.0.0.0", false, false},
+		{"10.9.9.9/32", "", "first", "10.9.9.9", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.network+" "+tt.address+" "+tt.gateway, func(t *testing.T) {
+			address, _ := optionIP(generatorOptions{"address": tt.address}, "address")
+			got, used, err := interfaceHostAddress(mustParsePrefixes(t, tt.network)[0], address, tt.gateway)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("interfaceHostAddress() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("interfaceHostAddress() unexpected error: %v", err)
+			}
+			if got.String() != tt.want || used != tt.wantUsed {
+				t.Errorf("interfaceHostAddress() = %s, %v; want %s, %v", got, used, tt.want, tt.wantUsed)
+			}
+		})
+	}
+}
+
+func TestGenerateInterfaceConfig(t *testing.T) {
+	networks := []string{"192.168.1.0/24", "10.0.0.0/30"}
+	opts := generatorOptions{"address": "192.168.1.254", "description": "LAN uplink"}
+
+	tests := []struct {
+		generator string
+		opts      generatorOptions
+		want      string
+	}{
+		{"cisco-interface", opts, "interface GigabitEthernet0/0\n description LAN uplink\n ip address 192.168.1.254 255.255.255.0\n ip address 10.0.0.1 255.255.255.252 secondary\n no shutdown\n!\n"},
+		{"juniper-interface", opts, "set interfaces ge-0/0/0 unit 0 description \"LAN uplink\"\nset interfaces ge-0/0/0 unit 0 family inet address 192.168.1.254/24\nset interfaces ge-0/0/0 unit 0 family inet address 10.0.0.1/30\n"},
+		{"juniper-interface", generatorOptions{"interface": "xe-1/0/0.100"}, "set interfaces xe-1/0/0 unit 100 family inet address 192.168.1.1/24\nset interfaces xe-1/0/0 unit 100 family inet address 10.0.0.1/30\n"},
+		{"mikrotik-interface", generatorOptions{"interface": "bridge", "gateway": "last"}, "/ip address add address=192.168.1.254/24 network=192.168.1.0 interface=bridge\n/ip address add address=10.0.0.2/30 network=10.0.0.0 interface=bridge\n"},
+		{"cisco-interface", generatorOptions{"vlan": "10,", "vlan_name": "users,"}, "interface GigabitEthernet0/0\n ip address 10.0.0.1 255.255.255.252\n no shutdown\n!\nvlan 10\n name users\n!\ninterface Vlan10\n description users\n ip address 192.168.1.1 255.255.255.0\n no shutdown\n!\n"},
+		{"juniper-interface", generatorOptions{"vlan": "10,20", "vlan_name": "users,"}, "set vlans users vlan-id 10\nset vlans users l3-interface irb.10\nset interfaces irb unit 10 description \"users\"\nset interfaces irb unit 10 family inet address 192.168.1.1/24\nset vlans vlan20 vlan-id 20\nset vlans vlan20 l3-interface irb.20\nset interfaces irb unit 20 family inet address 10.0.0.1/30\n"},
+		{"mikrotik-interface", generatorOptions{"interface": "bridge", "vlan": ",30"}, "/ip address add address=192.168.1.1/24 network=192.168.1.0 interface=bridge\n/interface vlan add name=vlan30 vlan-id=30 interface=bridge\n/ip address add address=10.0.0.1/30 network=10.0.0.0 interface=vlan30\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.generator, func(t *testing.T) {
+			got, err := generateConfig(tt.generator, GenerateRequest{Networks: networks, Options: tt.opts})
+			if err != nil {
+				t.Fatalf("generateConfig(%s) unexpected error: %v", tt.generator, err)
+			}
+			if got != tt.want {
+				t.Errorf("generateConfig(%s) =\n%s\nwant\n%s", tt.generator, got, tt.want)
+			}
+		})
+	}
+
+	for _, bad := range []map[string]string{
+		{"interface": "eth0; reload"},
+		{"description": "say \"hi\""},
+		{"address": "172.16.0.1"},
+		{"gateway": "middle"},
+	} {
+		if _, err := generateConfig("cisco-interface", GenerateRequest{Networks: networks, Options: bad}); err == nil || strings.Contains(err.Error(), "unknown generator") {
+			t.Errorf("generateConfig(cisco-interface, %v) expected option error, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerConfigGenerator(ConfigGenerator{
+		Name:        "reverse-zone",
+		Description: "BIND reverse DNS zone with SOA/NS placeholders and PTR records",
+		Filename:    "reverse.zone",
+		Generate:    generateReverseZone,
+	})
+	registerConfigGenerator(ConfigGenerator{
+		Name:        "rfc2317",
+		Description: "RFC 2317 classless reverse delegation: parent zone CNAMEs and child zone skeleton",
+		Filename:    "rfc2317.zone",
+		Generate:    generateRFC2317,
+	})
+}
+
+var (
+	dnsName        = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?\.?$`)
+	hostnameTmpl   = regexp.MustCompile(`^[A-Za-z0-9{}.-]+$`)
+	zoneSerialExpr = regexp.MustCompile(`^\d{1,10}$`)
+)
+
+// reverseZoneName returns the in-addr.arpa zone for a network and the number of leading
+// octets it fixes. Networks on an octet boundary get their natural zone, shorter ones
+// the enclosing octet-aligned zone, and longer than /24 an RFC 2317 classless zone
+// such as 64/26.2.0.192.in-addr.arpa
+func reverseZoneName(network *net.IPNet) (string, int) {
+	return classlessZoneName(network, "/")
+}
+
+// classlessZoneName is reverseZoneName with sep between the first address and the
+// prefix length of a classless zone; RFC 2317 uses "/", many operators prefer "-"
+func classlessZoneName(network *net.IPNet, sep string) (string, int) {
+	ones, _ := network.Mask.Size()
+	ip := network.IP.To4()
+
+	octets := ones / 8
+	if ones > 24 {
+		octets = 3
+	}
+	labels := make([]string, 0, 5)
+	if ones > 24 {
+		labels = append(labels, fmt.Sprintf("%d%s%d", ip[3], sep, ones))
+	}
+	for i := octets - 1; i >= 0; i-- {
+		labels = append(labels, strconv.Itoa(int(ip[i])))
+	}
+	labels = append(labels, "in-addr.arpa")
+	return strings.Join(labels, "."), octets
+}
+
+// fqdn appends the trailing dot of an absolute DNS name
+func fqdn(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
+
+// expandHostname fills {ip} (dashed address) and {1}..{4} (octets) in a hostname template
+func expandHostname(tmpl string, ip net.IP) string {
+	ip = ip.To4()
+	r := strings.NewReplacer(
+		"{ip}", strings.ReplaceAll(ip.String(), ".", "-"),
+		"{1}", strconv.Itoa(int(ip[0])), "{2}", strconv.Itoa(int(ip[1])),
+		"{3}", strconv.Itoa(int(ip[2])), "{4}", strconv.Itoa(int(ip[3])),
+	)
+	return r.Replace(tmpl)
+}
+
+// zoneSettings holds the zone file options shared by the reverse DNS generators
+type zoneSettings struct {
+	domain   string
+	ns       []string
+	admin    string
+	hostname string
+	serial   string
+	ttl      string
+}
+
+// parseZoneSettings validates the domain, ns (comma-separated), admin, hostname,
+// serial and ttl options
+func parseZoneSettings(opts generatorOptions) (*zoneSettings, error) {
+	z := &zoneSettings{domain: strings.TrimSuffix(opts.get("domain", "example.com"), ".")}
+	for _, ns := range strings.Split(opts.get("ns", "ns1."+z.domain), ",") {
+		z.ns = append(z.ns, strings.TrimSpace(ns))
+	}
+	z.admin = opts.get("admin", "hostmaster."+z.domain)
+	for _, name := range append([]string{z.domain, z.admin}, z.ns...) {
+		if !dnsName.MatchString(name) {
+			return nil, fmt.Errorf("invalid DNS name: %s", name)
+		}
+	}
+	z.hostname = opts.get("hostname", "host-{ip}")
+	if !hostnameTmpl.MatchString(z.hostname) {
+		return nil, fmt.Errorf("invalid hostname template: %s", z.hostname)
+	}
+	z.serial = opts.get("serial", time.Now().UTC().Format("20060102")+"01")
+	if !zoneSerialExpr.MatchString(z.serial) {
+		return nil, fmt.Errorf("invalid serial %q, must be a number", z.serial)
+	}
+	z.ttl = opts.get("ttl", "3600")
+	if n, err := strconv.Atoi(z.ttl); err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid ttl %q, must be a positive number of seconds", z.ttl)
+	}
+	return z, nil
+}
+
+// writeZoneHeader writes the $ORIGIN, $TTL, SOA and NS records of a zone
+func writeZoneHeader(b *strings.Builder, zone string, z *zoneSettings) {
+	fmt.Fprintf(b, "$ORIGIN %s.\n", zone)
+	fmt.Fprintf(b, "$TTL %s\n", z.ttl)
+	fmt.Fprintf(b, "@\tIN\tSOA\t%s %s (\n", fqdn(z.ns[0]), fqdn(z.admin))
+	fmt.Fprintf(b, "\t\t\t%s\t; serial\n\t\t\t3600\t\t; refresh\n\t\t\t900\t\t; retry\n\t\t\t1209600\t\t; expire\n\t\t\t3600 )\t\t; negative cache ttl\n", z.serial)
+	for _, ns := range z.ns {
+		fmt.Fprintf(b, "@\tIN\tNS\t%s\n", fqdn(ns))
+	}
+	b.WriteString("\n")
+}
+
+// writePTRRecords writes a PTR record for every address from first to last, named
+// relative to a zone that fixes the given number of leading octets
+func writePTRRecords(b *strings.Builder, first, last uint32, octets int, z *zoneSettings) {
+	for n := uint64(first); n <= uint64(last); n++ {
+		ip := uint32ToIP(uint32(n))
+		labels := make([]string, 0, 4-octets)
+		for i := 3; i >= octets; i-- {
+			labels = append(labels, strconv.Itoa(int(ip[i])))
+		}
+		fmt.Fprintf(b, "%s\tIN\tPTR\t%s\n", strings.Join(labels, "."), fqdn(expandHostname(z.hostname, ip)+"."+z.domain))
+	}
+}
+
+// generateReverseZone renders a BIND zone file for a single network with a PTR record
+// per host. Options: domain (example.com), hostname (host-{ip}), ns (comma-separated),
+// admin, serial, ttl, start/end to limit the records to a range (by default every
+// usable host), and vlan and vlan_name, noted in the header
+func generateReverseZone(networks []*net.IPNet, opts generatorOptions) (string, error) {
+	if len(networks) != 1 {
+		return "", fmt.Errorf("reverse zone generation takes a single network")
+	}
+	network := networks[0]
+
+	z, err := parseZoneSettings(opts)
+	if err != nil {
+		return "", err
+	}
+
+	vlans, err := opts.vlans(networks)
+	if err != nil {
+		return "", err
+	}
+
+	ones, _ := network.Mask.Size()
+	first, last := usableRange(network)
+	start, err := optionIP(opts, "start")
+	if err != nil {
+		return "", err
+	}
+	end, err := optionIP(opts, "end")
+	if err != nil {
+		return "", err
+	}
+	if start != nil {
+		first = ipToUint32(start)
+	}
+	if end != nil {
+		last = ipToUint32(end)
+	}
+	if !network.Contains(uint32ToIP(first)) || !network.Contains(uint32ToIP(last)) || first > last {
+		return "", fmt.Errorf("range %s - %s must be an ascending range inside %s", uint32ToIP(first), uint32ToIP(last), network)
+	}
+	if uint64(last-first)+1 > maxPrefixListLen {
+		return "", fmt.Errorf("range has %d addresses, at most %d PTR records can be generated", uint64(last-first)+1, maxPrefixListLen)
+	}
+
+	zone, octets := reverseZoneName(network)
+	var b strings.Builder
+	fmt.Fprintf(&b, "; reverse zone for %s\n", network)
+	if vlan := vlanAt(vlans, 0); vlan.ID != 0 {
+		fmt.Fprintf(&b, "; %s\n", vlan.label())
+	}
+	if ones > 24 {
+		fmt.Fprintf(&b, "; classless delegation (RFC 2317): the parent zone needs CNAMEs into %s (see the rfc2317 generator)\n", zone)
+	}
+	writeZoneHeader(&b, zone, z)
+	writePTRRecords(&b, first, last, octets, z)
+	return b.String(), nil
+}
+
+// generateRFC2317 renders the RFC 2317 delegation of networks longer than /24: for each
+// parent /24 zone the NS records of every sub-block and a CNAME per host into the
+// classless zone of its sub-block, followed by the skeleton of each classless child
+// zone with its SOA, NS and PTR records. Takes the reverse-zone options, where ns
+// names the delegated name servers, plus separator ("/" or "-" between the first
+// address and the prefix length in the child zone name) and cnames ("list", or
+// "generate" for one BIND $GENERATE line per sub-block)
+func generateRFC2317(networks []*net.IPNet, opts generatorOptions) (string, error) {
+	z, err := parseZoneSettings(opts)
+	if err != nil {
+		return "", err
+	}
+	sep, err := opts.oneOf("separator", "/", "/", "-")
+	if err != nil {
+		return "", err
+	}
+	cnames, err := opts.oneOf("cnames", "list", "list", "generate")
+	if err != nil {
+		return "", err
+	}
+
+	sorted := append([]*net.IPNet(nil), networks...)
+	sort.Slice(sorted, func(i, j int) bool { return ipToUint32(sorted[i].IP) < ipToUint32(sorted[j].IP) })
+	for i, network := range sorted {
+		if ones, _ := network.Mask.Size(); ones <= 24 {
+			return "", fmt.Errorf("%s needs no classless delegation, delegate its octet-aligned zone instead", network)
+		}
+		if i > 0 && sorted[i-1].Contains(network.IP) {
+			return "", fmt.Errorf("%s overlaps %s", network, sorted[i-1])
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(sorted); {
+		parent := &net.IPNet{IP: sorted[i].IP.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+		group := []*net.IPNet{}
+		for ; i < len(sorted) && parent.Contains(sorted[i].IP); i++ {
+			group = append(group, sorted[i])
+		}
+		parentZone, _ := reverseZoneName(parent)
+
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "; RFC 2317 delegation of %s\n", prefixStrings(group)[0])
+		for _, network := range group[1:] {
+			fmt.Fprintf(&b, ";   and %s\n", network)
+		}
+		fmt.Fprintf(&b, "; parent zone %s: add to the zone of the /24\n", parentZone)
+		fmt.Fprintf(&b, "$ORIGIN %s.\n", parentZone)
+		for _, network := range group {
+			zone, _ := classlessZoneName(network, sep)
+			label := strings.TrimSuffix(zone, "."+parentZone)
+			for _, ns := range z.ns {
+				fmt.Fprintf(&b, "%s\tIN\tNS\t%s\n", label, fqdn(ns))
+			}
+			first, last := usableRange(network)
+			if cnames == "generate" {
+				fmt.Fprintf(&b, "$GENERATE %d-%d $\tIN\tCNAME\t$.%s.\n", first&0xff, last&0xff, zone)
+				continue
+			}
+			for n := uint64(first); n <= uint64(last); n++ {
+				fmt.Fprintf(&b, "%d\tIN\tCNAME\t%d.%s.\n", n&0xff, n&0xff, zone)
+			}
+		}
+
+		for _, network := range group {
+			zone, _ := classlessZoneName(network, sep)
+			first, last := usableRange(network)
+			fmt.Fprintf(&b, "\n; child zone %s: served by the delegated name servers\n", zone)
+			writeZoneHeader(&b, zone, z)
+			writePTRRecords(&b, first, last, 3, z)
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReverseZoneName(t *testing.T) {
+	tests := []struct {
+		network    string
+		want       string
+		wantOctets int
+	}{
+		{"10.0.0.0/8", "10.in-addr.arpa", 1},
+		{"172.16.0.0/12", "172.in-addr.arpa", 1},
+		{"10.1.0.0/20", "1.10.in-addr.arpa", 2},
+		{"192.168.1.0/24", "1.168.192.in-addr.arpa", 3},
+		{"192.0.2.64/26", "64/26.2.0.192.in-addr.arpa", 3},
+		{"192.0.2.7/32", "7/32.2.0.192.in-addr.arpa", 3},
+	}
+	for _, tt := range tests {
+		got, octets := reverseZoneName(mustParsePrefixes(t, tt.network)[0])
+		if got != tt.want || octets != tt.wantOctets {
+			t.Errorf("reverseZoneName(%s) = %s, %d; want %s, %d", tt.network, got, octets, tt.want, tt.wantOctets)
+		}
+	}
+}
+
+func TestExpandHostname(t *testing.T) {
+	ip := net.ParseIP("10.20.30.40")
+	if got := expandHostname("host-{ip}", ip); got != "host-10-20-30-40" {
+		t.Errorf("expandHostname({ip}) = %s", got)
+	}
+	if got := expandHostname("srv{4}.rack{3}", ip); got != "srv40.rack30" {
+		t.Errorf("expandHostname({4}.{3}) = %s", got)
+	}
+}
+
+func TestGenerateReverseZone(t *testing.T) {
+	config, err := generateReverseZone(mustParsePrefixes(t, "192.168.1.0/24"), generatorOptions{"domain": "lan.example", "serial": "2024010101", "ttl": "600"})
+	if err != nil {
+		t.Fatalf("generateReverseZone() unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"$ORIGIN 1.168.192.in-addr.arpa.\n",
+		"$TTL 600\n",
+		"@\tIN\tSOA\tns1.lan.example. hostmaster.lan.example. (\n",
+		"2024010101\t; serial",
+		"@\tIN\tNS\tns1.lan.example.\n",
+		"1\tIN\tPTR\thost-192-168-1-1.lan.example.\n",
+		"254\tIN\tPTR\thost-192-168-1-254.lan.example.\n",
+	} {
+		if !strings.Contains(config, want) {
+			t.Errorf("zone missing %q:\n%s", want, config)
+		}
+	}
+	if strings.Contains(config, "\n0\tIN\tPTR") || strings.Contains(config, "\n255\tIN\tPTR") {
+		t.Error("zone should not contain network or broadcast PTR records")
+	}
+	if got := strings.Count(config, "\tPTR\t"); got != 254 {
+		t.Errorf("got %d PTR records, want 254", got)
+	}
+
+	// A range across a /24 boundary in a /20 uses two-label owner names
+	config, err = generateReverseZone(mustParsePrefixes(t, "10.1.0.0/20"), generatorOptions{"start": "10.1.3.255", "end": "10.1.4.0", "hostname": "n{3}-{4}"})
+	if err != nil {
+		t.Fatalf("generateReverseZone() unexpected error: %v", err)
+	}
+	if !strings.Contains(config, "255.3\tIN\tPTR\tn3-255.example.com.\n0.4\tIN\tPTR\tn4-0.example.com.\n") {
+		t.Errorf("unexpected /20 records:\n%s", config)
+	}
+
+	// Classless zones carry an RFC 2317 note
+	config, _ = generateReverseZone(mustParsePrefixes(t, "192.0.2.64/30"), nil)
+	if !strings.Contains(config, "RFC 2317") || !strings.Contains(config, "$ORIGIN 64/30.2.0.192.in-addr.arpa.\n") {
+		t.Errorf("unexpected classless zone:\n%s", config)
+	}
+}
+
+func TestGenerateReverseZoneErrors(t *testing.T) {
+	tests := []struct {
+		networks []string
+		opts     generatorOptions
+	}{
+		{[]string{"10.0.0.0/24", "10.0.1.0/24"}, nil},
+		{[]string{"10.0.0.0/8"}, nil},
+		{[]string{"10.0.0.0/24"}, generatorOptions{"start": "10.0.1.1"}},
+		{[]string{"10.0.0.0/24"}, generatorOptions{"start": "10.0.0.20", "end": "10.0.0.10"}},
+		{[]string{"10.0.0.0/24"}, generatorOptions{"domain": "bad domain"}},
+		{[]string{"10.0.0.0/24"}, generatorOptions{"hostname": "a b"}},
+		{[]string{"10.0.0.0/24"}, generatorOptions{"serial": "today"}},
+		{[]string{"10.0.0.0/24"}, generatorOptions{"ttl": "0"}},
+	}
+	for _, tt := range tests {
+		if _, err := generateReverseZone(mustParsePrefixes(t, tt.networks...), tt.opts); err == nil {
+			t.Errorf("generateReverseZone(%v, %v) expected error, got nil", tt.networks, tt.opts)
+		}
+	}
+}
+
+func TestGenerateRFC2317(t *testing.T) {
+	config, err := generateRFC2317(mustParsePrefixes(t, "192.0.2.128/30", "192.0.2.64/29", "198.51.100.0/31"), generatorOptions{"ns": "ns1.cust.example, ns2.cust.example", "domain": "cust.example", "serial": "1"})
+	if err != nil {
+		t.Fatalf("generateRFC2317() unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"; parent zone 2.0.192.in-addr.arpa: add to the zone of the /24\n$ORIGIN 2.0.192.in-addr.arpa.\n64/29\tIN\tNS\tns1.cust.example.\n64/29\tIN\tNS\tns2.cust.example.\n65\tIN\tCNAME\t65.64/29.2.0.192.in-addr.arpa.\n",
+		"70\tIN\tCNAME\t70.64/29.2.0.192.in-addr.arpa.\n128/30\tIN\tNS\tns1.cust.example.\n",
+		"$ORIGIN 64/29.2.0.192.in-addr.arpa.\n$TTL 3600\n@\tIN\tSOA\tns1.cust.example. hostmaster.cust.example. (\n",
+		"@\tIN\tNS\tns2.cust.example.\n\n65\tIN\tPTR\thost-192-0-2-65.cust.example.\n",
+		"$ORIGIN 100.51.198.in-addr.arpa.\n0/31\tIN\tNS\tns1.cust.example.\n",
+		"1\tIN\tPTR\thost-198-51-100-1.cust.example.\n",
+	} {
+		if !strings.Contains(config, want) {
+			t.Errorf("delegation missing %q:\n%s", want, config)
+		}
+	}
+	if strings.Contains(config, "\n64\tIN\tCNAME") || strings.Contains(config, "\n71\tIN\tCNAME") {
+		t.Error("delegation should not contain network or broadcast CNAMEs")
+	}
+
+	config, err = generateRFC2317(mustParsePrefixes(t, "192.0.2.64/26"), generatorOptions{"separator": "-", "cnames": "generate"})
+	if err != nil || !strings.Contains(config, "64-26\tIN\tNS\tns1.example.com.\n$GENERATE 65-126 $\tIN\tCNAME\t$.64-26.2.0.192.in-addr.arpa.\n") {
+		t.Errorf("generateRFC2317() with $GENERATE = %v:\n%s", err, config)
+	}
+
+	for _, tt := range []struct {
+		networks []string
+		opts     generatorOptions
+	}{
+		{[]string{"192.0.2.0/24"}, nil},
+		{[]string{"192.0.2.0/25", "192.0.2.64/26"}, nil},
+		{[]string{"192.0.2.0/25"}, generatorOptions{"separator": "_"}},
+		{[]string{"192.0.2.0/25"}, generatorOptions{"cnames": "none"}},
+		{[]string{"192.0.2.0/25"}, generatorOptions{"ns": "ns1.example.com,bad name"}},
+	} {
+		if _, err := generateRFC2317(mustParsePrefixes(t, tt.networks...), tt.opts); err == nil {
+			t.Errorf("generateRFC2317(%v, %v) expected error, got nil", tt.networks, tt.opts)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerConfigGenerator(ConfigGenerator{
+		Name:        "rpsl",
+		Description: "RPSL route objects for IRR registration",
+		Filename:    "route.rpsl",
+		Generate:    generateRPSL,
+	})
+	registerConfigGenerator(ConfigGenerator{
+		Name:        "cisco-prefix-list",
+		Description: "Cisco IOS prefix-list in bgpq3 style",
+		Generate:    generateCiscoPrefixList,
+	})
+	registerConfigGenerator(ConfigGenerator{
+		Name:        "juniper-prefix-list",
+		Description: "Junos prefix-list or route-filter-list in bgpq3 style",
+		Generate:    generateJuniperPrefixList,
+	})
+}
+
+var (
+	rpslName   = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+	rpslSource = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+	rpslText   = regexp.MustCompile(`^[^\r\n#]+$`)
+)
+
+// parseASN parses an AS number written as 64500 or AS64500
+func parseASN(s string) (uint32, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(s), "AS"), 10, 32)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid AS number: %s", s)
+	}
+	return uint32(n), nil
+}
+
+// rpslAttribute pads an attribute name to the value column used by the IRR databases
+func rpslAttribute(b *strings.Builder, name, value string) {
+	fmt.Fprintf(b, "%-16s%s\n", name+":", value)
+}
+
+// generateRPSL renders a route object per network. Options: origin (the AS number,
+// required), mnt_by (default MAINT-AS<origin>), descr and source (default RIPE)
+func generateRPSL(networks []*net.IPNet, opts generatorOptions) (string, error) {
+	origin := opts.get("origin", "")
+	if origin == "" {
+		return "", fmt.Errorf("origin, the AS number announcing the routes, is required")
+	}
+	asn, err := parseASN(origin)
+	if err != nil {
+		return "", err
+	}
+	mntBy := opts.get("mnt_by", fmt.Sprintf("MAINT-AS%d", asn))
+	if !rpslName.MatchString(mntBy) {
+		return "", fmt.Errorf("invalid mnt_by: %s", mntBy)
+	}
+	source := strings.ToUpper(opts.get("source", "RIPE"))
+	if !rpslSource.MatchString(source) {
+		return "", fmt.Errorf("invalid source: %s", source)
+	}
+	descr := opts.get("descr", "")
+	if descr != "" && !rpslText.MatchString(descr) {
+		return "", fmt.Errorf("descr must be a single line without '#'")
+	}
+
+	var b strings.Builder
+	for i, network := range networks {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		rpslAttribute(&b, "route", network.String())
+		if descr != "" {
+			rpslAttribute(&b, "descr", descr)
+		}
+		rpslAttribute(&b, "origin", fmt.Sprintf("AS%d", asn))
+		rpslAttribute(&b, "mnt-by", mntBy)
+		rpslAttribute(&b, "source", source)
+	}
+	return b.String(), nil
+}
+
+// prefixListOptions reads the name and max_length options of the prefix-list
+// generators; a max_length of 0 means exact matches only
+func prefixListOptions(opts generatorOptions) (string, int, error) {
+	name := opts.get("name", "NN")
+	if !ciscoACLName.MatchString(name) {
+		return "", 0, fmt.Errorf("prefix-list names may only contain letters, digits, '-' and '_'")
+	}
+	maxLength := 0
+	if v := opts.get("max_length", ""); v != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(v, "/"))
+		if err != nil || n < 1 || n > 32 {
+			return "", 0, fmt.Errorf("invalid max_length %q, must be a prefix length from 1 to 32", v)
+		}
+		maxLength = n
+	}
+	return name, maxLength, nil
+}
+
+// generateCiscoPrefixList renders an ip prefix-list the way bgpq3 does, replacing any
+// list of the same name. Options: name (default NN) and max_length, which also permits
+// more specifics of each prefix up to that length with le
+func generateCiscoPrefixList(networks []*net.IPNet, opts generatorOptions) (string, error) {
+	name, maxLength, err := prefixListOptions(opts)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "no ip prefix-list %s\n", name)
+	for _, network := range networks {
+		fmt.Fprintf(&b, "ip prefix-list %s permit %s", name, network)
+		if ones, _ := network.Mask.Size(); maxLength > ones {
+			fmt.Fprintf(&b, " le %d", maxLength)
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// generateJuniperPrefixList renders a policy-options prefix-list the way bgpq3 does,
+// replacing any list of the same name. With max_length, which permits more specifics,
+// it renders a route-filter-list with upto and exact entries instead. Options as for
+// cisco-prefix-list
+func generateJuniperPrefixList(networks []*net.IPNet, opts generatorOptions) (string, error) {
+	name, maxLength, err := prefixListOptions(opts)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("policy-options {\nreplace:\n")
+	if maxLength == 0 {
+		fmt.Fprintf(&b, " prefix-list %s {\n", name)
+		for _, network := range networks {
+			fmt.Fprintf(&b, "    %s;\n", network)
+		}
+	} else {
+		fmt.Fprintf(&b, " route-filter-list %s {\n", name)
+		for _, network := range networks {
+			if ones, _ := network.Mask.Size(); maxLength > ones {
+				fmt.Fprintf(&b, "    %s upto /%d;\n", network, maxLength)
+			} else {
+				fmt.Fprintf(&b, "    %s exact;\n", network)
+			}
+		}
+	}
+	b.WriteString(" }\n}\n")
+	return b.String(), nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGenerateRPSL(t *testing.T) {
+	config, err := generateRPSL(mustParsePrefixes(t, "192.0.2.0/24", "198.51.100.0/23"), generatorOptions{"origin": "as64500", "descr": "Example customer"})
+	if err != nil {
+		t.Fatalf("generateRPSL() unexpected error: %v", err)
+	}
+	want := `route:          192.0.2.0/24
+descr:          Example customer
+origin:         AS64500
+mnt-by:         MAINT-AS64500
+source:         RIPE
+
+route:          198.51.100.0/23
+descr:          Example customer
+origin:         AS64500
+mnt-by:         MAINT-AS64500
+source:         RIPE
+`
+	if config != want {
+		t.Errorf("generateRPSL() =\n%s\nwant\n%s", config, want)
+	}
+
+	for _, opts := range []generatorOptions{
+		{},
+		{"origin": "AS0"},
+		{"origin": "AS4294967296"},
+		{"origin": "64500", "mnt_by": "bad maint"},
+		{"origin": "64500", "source": "R!PE"},
+		{"origin": "64500", "descr": "# comment"},
+	} {
+		if _, err := generateRPSL(mustParsePrefixes(t, "192.0.2.0/24"), opts); err == nil {
+			t.Errorf("generateRPSL(%v) expected error, got nil", opts)
+		}
+	}
+}
+
+func TestGeneratePrefixLists(t *testing.T) {
+	networks := mustParsePrefixes(t, "10.0.0.0/16", "192.0.2.0/24")
+
+	config, err := generateCiscoPrefixList(networks, generatorOptions{"name": "AS64500-IN"})
+	if err != nil || config != "no ip prefix-list AS64500-IN\nip prefix-list AS64500-IN permit 10.0.0.0/16\nip prefix-list AS64500-IN permit 192.0.2.0/24\n" {
+		t.Errorf("generateCiscoPrefixList() = %v:\n%s", err, config)
+	}
+	config, err = generateCiscoPrefixList(networks, generatorOptions{"max_length": "/24"})
+	if err != nil || !strings.Contains(config, "permit 10.0.0.0/16 le 24\nip prefix-list NN permit 192.0.2.0/24\n") {
+		t.Errorf("generateCiscoPrefixList() with max_length = %v:\n%s", err, config)
+	}
+
+	config, err = generateJuniperPrefixList(networks, nil)
+	if err != nil || config != "policy-options {\nreplace:\n prefix-list NN {\n    10.0.0.0/16;\n    192.0.2.0/24;\n }\n}\n" {
+		t.Errorf("generateJuniperPrefixList() = %v:\n%s", err, config)
+	}
+	config, err = generateJuniperPrefixList(networks, generatorOptions{"max_length": "24"})
+	if err != nil || !strings.Contains(config, " route-filter-list NN {\n    10.0.0.0/16 upto /24;\n    192.0.2.0/24 exact;\n }\n") {
+		t.Errorf("generateJuniperPrefixList() with max_length = %v:\n%s", err, config)
+	}
+
+	for _, opts := range []generatorOptions{{"name": "bad name"}, {"max_length": "33"}, {"max_length": "long"}} {
+		if _, err := generateCiscoPrefixList(networks, opts); err == nil {
+			t.Errorf("generateCiscoPrefixList(%v) expected error, got nil", opts)
+		}
+	}
+
+	// The aggregation result feeds straight into the prefix-list
+	rr := httptest.NewRecorder()
+	aggregateHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/aggregate?format=cisco-prefix-list&name=CUST", strings.NewReader(`{"prefixes":["192.0.2.0/25","192.0.2.128/25"]}`)))
+	if rr.Code != http.StatusOK || rr.Body.String() != "no ip prefix-list CUST\nip prefix-list CUST permit 192.0.2.0/24\n" {
+		t.Errorf("aggregate prefix-list: status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	subtractHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/subtract?format=rpsl&origin=64500", strings.NewReader(`{"network":"192.0.2.0/24","used":["192.0.2.0/25"]}`)))
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "route:          192.0.2.128/25\n") {
+		t.Errorf("subtract rpsl: status %d: %s", rr.Code, rr.Body.String())
+	}
+}
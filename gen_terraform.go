@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	registerConfigGenerator(ConfigGenerator{
+		Name:        "terraform",
+		Description: "Terraform locals, variable or aws_subnet resource stubs",
+		Filename:    "subnets.tf",
+		Generate:    generateTerraform,
+	})
+}
+
+var (
+	hclIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+	hclReference  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*(\.[A-Za-z0-9_-]+)+$`)
+	awsResourceID = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+)
+
+// hclValue quotes a value unless it is a reference such as aws_vpc.main.id
+func hclValue(v string) (string, error) {
+	switch {
+	case hclReference.MatchString(v):
+		return v, nil
+	case awsResourceID.MatchString(v):
+		return `"` + v + `"`, nil
+	default:
+		return "", fmt.Errorf("invalid value %q, must be a resource id or a reference like aws_vpc.main.id", v)
+	}
+}
+
+// hclAddress renders a calculated address, or null when the calculator reports N/A
+func hclAddress(addr string) string {
+	if addr == "N/A" {
+		return "null"
+	}
+	return `"` + addr + `"`
+}
+
+// generateTerraform renders the networks as Terraform code. Options: style
+// (locals|variable|aws_subnet), name (default "subnets") used for the local or variable
+// and as the resource name prefix, vpc_id (default aws_vpc.main.id),
+// availability_zones, a comma-separated list assigned to the subnets round-robin, and
+// vlan and vlan_name, kept as attributes, comments or tags
+func generateTerraform(networks []*net.IPNet, opts generatorOptions) (string, error) {
+	style, err := opts.oneOf("style", "locals", "locals", "variable", "aws_subnet")
+	if err != nil {
+		return "", err
+	}
+	name := opts.get("name", "subnets")
+	if !hclIdentifier.MatchString(name) {
+		return "", fmt.Errorf("invalid name %q, must be a Terraform identifier", name)
+	}
+	vlans, err := opts.vlans(networks)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	switch style {
+	case "variable":
+		fmt.Fprintf(&b, "variable %q {\n  type    = list(string)\n  default = [\n", name)
+		for i, network := range networks {
+			fmt.Fprintf(&b, "    %q,", network.String())
+			if vlan := vlanAt(vlans, i); vlan.ID != 0 {
+				fmt.Fprintf(&b, " # %s", vlan.label())
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("  ]\n}\n")
+
+	case "locals":
+		fmt.Fprintf(&b, "locals {\n  %s = {\n", name)
+		for i, network := range networks {
+			calc, err := calculateSubnet(network.IP.String(), net.IP(network.Mask).String())
+			if err != nil {
+				return "", err
+			}
+			ones, _ := network.Mask.Size()
+			fmt.Fprintf(&b, "    %s_%d = {\n", name, i+1)
+			fmt.Fprintf(&b, "      cidr_block   = %q\n", network.String())
+			fmt.Fprintf(&b, "      network      = %q\n", calc.NetworkAddress)
+			fmt.Fprintf(&b, "      broadcast    = %q\n", calc.BroadcastAddress)
+			fmt.Fprintf(&b, "      netmask      = %q\n", net.IP(network.Mask).String())
+			fmt.Fprintf(&b, "      first_host   = %s\n", hclAddress(calc.MinHostAddress))
+			fmt.Fprintf(&b, "      last_host    = %s\n", hclAddress(calc.MaxHostAddress))
+			fmt.Fprintf(&b, "      usable_hosts = %d\n", usableHostCount(ones))
+			if vlan := vlanAt(vlans, i); vlan.ID != 0 {
+				fmt.Fprintf(&b, "      vlan_id      = %d\n", vlan.ID)
+				if vlan.Name != "" {
+					fmt.Fprintf(&b, "      vlan_name    = %q\n", vlan.Name)
+				}
+			}
+			b.WriteString("    }\n")
+		}
+		b.WriteString("  }\n}\n")
+
+	case "aws_subnet":
+		vpcID, err := hclValue(opts.get("vpc_id", "aws_vpc.main.id"))
+		if err != nil {
+			return "", err
+		}
+		var zones []string
+		if list := opts.get("availability_zones", ""); list != "" {
+			for _, zone := range strings.Split(list, ",") {
+				zone = strings.TrimSpace(zone)
+				if !awsResourceID.MatchString(zone) {
+					return "", fmt.Errorf("invalid availability zone: %s", zone)
+				}
+				zones = append(zones, zone)
+			}
+		}
+		for i, network := range networks {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			// Align the attributes the way terraform fmt does
+			width := len("cidr_block")
+			if len(zones) > 0 {
+				width = len("availability_zone")
+			}
+			fmt.Fprintf(&b, "resource \"aws_subnet\" \"%s_%d\" {\n", name, i+1)
+			fmt.Fprintf(&b, "  %-*s = %s\n", width, "vpc_id", vpcID)
+			fmt.Fprintf(&b, "  %-*s = %q\n", width, "cidr_block", network.String())
+			if len(zones) > 0 {
+				fmt.Fprintf(&b, "  %-*s = %q\n", width, "availability_zone", zones[i%len(zones)])
+			}
+			fmt.Fprintf(&b, "\n  tags = {\n")
+			if vlan := vlanAt(vlans, i); vlan.ID != 0 && vlan.Name != "" {
+				fmt.Fprintf(&b, "    Name     = \"%s-%d\"\n    VLAN     = \"%d\"\n    VLANName = %q\n", name, i+1, vlan.ID, vlan.Name)
+			} else if vlan.ID != 0 {
+				fmt.Fprintf(&b, "    Name = \"%s-%d\"\n    VLAN = \"%d\"\n", name, i+1, vlan.ID)
+			} else {
+				fmt.Fprintf(&b, "    Name = \"%s-%d\"\n", name, i+1)
+			}
+			b.WriteString("  }\n}\n")
+		}
+	}
+	return b.String(), nil
+}
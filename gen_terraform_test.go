@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGenerateTerraform(t *testing.T) {
+	networks := mustParsePrefixes(t, "10.0.0.0/24", "10.0.1.0/31")
+
+	tests := []struct {
+		name string
+		opts generatorOptions
+		want []string
+	}{
+		{"locals", nil, []string{
+			"locals {\n  subnets = {\n    subnets_1 = {\n      cidr_block   = \"10.0.0.0/24\"\n",
+			"      broadcast    = \"10.0.0.255\"\n      netmask      = \"255.255.255.0\"\n      first_host   = \"10.0.0.1\"\n      last_host    = \"10.0.0.254\"\n      usable_hosts = 254\n",
+			"    subnets_2 = {\n      cidr_block   = \"10.0.1.0/31\"\n",
+			"      first_host   = null\n      last_host    = null\n      usable_hosts = 0\n",
+		}},
+		{"variable", generatorOptions{"style": "variable", "name": "app_subnets"}, []string{
+			"variable \"app_subnets\" {\n  type    = list(string)\n  default = [\n    \"10.0.0.0/24\",\n    \"10.0.1.0/31\",\n  ]\n}\n",
+		}},
+		{"aws_subnet", generatorOptions{"style": "aws_subnet", "name": "private", "vpc_id": "vpc-0abc123", "availability_zones": "eu-west-1a"}, []string{
+			"resource \"aws_subnet\" \"private_1\" {\n  vpc_id            = \"vpc-0abc123\"\n  cidr_block        = \"10.0.0.0/24\"\n  availability_zone = \"eu-west-1a\"\n",
+			"resource \"aws_subnet\" \"private_2\" {",
+			"    Name = \"private-2\"\n",
+		}},
+		{"aws_subnet reference", generatorOptions{"style": "aws_subnet"}, []string{"  vpc_id     = aws_vpc.main.id\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generateTerraform(networks, tt.opts)
+			if err != nil {
+				t.Fatalf("generateTerraform() unexpected error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("generateTerraform() missing %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+
+	for _, opts := range []generatorOptions{
+		{"style": "module"},
+		{"name": "1bad"},
+		{"style": "aws_subnet", "vpc_id": "${file(\"x\")}"},
+		{"style": "aws_subnet", "availability_zones": "eu west"},
+	} {
+		if _, err := generateTerraform(networks, opts); err == nil {
+			t.Errorf("generateTerraform(%v) expected error, got nil", opts)
+		}
+	}
+}
+
+func TestWritePrefixListTerraform(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/deaggregate?prefix=10.0.0.0/23&length=24&format=terraform&style=variable", nil)
+	rr := httptest.NewRecorder()
+	deaggregateHandler(rr, req)
+
+	want := "variable \"subnets\" {\n  type    = list(string)\n  default = [\n    \"10.0.0.0/24\",\n    \"10.0.1.0/24\",\n  ]\n}\n"
+	if rr.Code != http.StatusOK || rr.Body.String() != want {
+		t.Errorf("deaggregate terraform output = %d %q, want %q", rr.Code, rr.Body.String(), want)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/deaggregate?prefix=10.0.0.0/23&length=24&format=hcl&style=bogus", nil)
+	rr = httptest.NewRecorder()
+	deaggregateHandler(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid terraform style status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// geoIPReloadInterval is how often a database file is checked for a newer version,
+// such as one written by geoipupdate
+const geoIPReloadInterval = time.Minute
+
+// GeoLocation annotates a public address with the GeoLite2 country, city and
+// autonomous system it belongs to. Network is the block the location applies to
+type GeoLocation struct {
+	Network     string `json:"network,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+	Country     string `json:"country,omitempty"`
+	City        string `json:"city,omitempty"`
+	ASN         uint64 `json:"asn,omitempty"`
+	ASOrg       string `json:"as_org,omitempty"`
+}
+
+// geoDatabase is a MaxMind DB file loaded into memory. It is reloaded when the file
+// changes, and the loaded version is kept when a reload fails
+type geoDatabase struct {
+	path string
+
+	mu      sync.Mutex
+	reader  *mmdbReader
+	modTime time.Time
+	checked time.Time
+}
+
+// openGeoDatabase loads the database at path
+func openGeoDatabase(path string) (*geoDatabase, error) {
+	g := &geoDatabase{path: path}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.load(info.ModTime()); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// load reads and parses the file; the caller holds g.mu or has not shared g yet
+func (g *geoDatabase) load(modTime time.Time) error {
+	data, err := os.ReadFile(g.path)
+	if err != nil {
+		return err
+	}
+	reader, err := newMMDBReader(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", g.path, err)
+	}
+	g.reader, g.modTime, g.checked = reader, modTime, time.Now()
+	return nil
+}
+
+// reload reads the file again whether or not it has changed, keeping the loaded
+// version when it fails
+func (g *geoDatabase) reload() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	info, err := os.Stat(g.path)
+	if err != nil {
+		return err
+	}
+	return g.load(info.ModTime())
+}
+
+// current returns the loaded database, reloading it first when the file has changed
+// since the last check
+func (g *geoDatabase) current() *mmdbReader {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if time.Since(g.checked) < geoIPReloadInterval {
+		return g.reader
+	}
+	g.checked = time.Now()
+	if info, err := os.Stat(g.path); err == nil && !info.ModTime().Equal(g.modTime) {
+		if err := g.load(info.ModTime()); err != nil {
+			log.Printf("GeoIP database reload failed, keeping the loaded version: %v", err)
+		} else {
+			log.Printf("GeoIP database %s reloaded (%s)", g.path, g.reader.databaseType)
+		}
+	}
+	return g.reader
+}
+
+// geoIPDatabases are the loaded location (GeoLite2 City or Country) and ASN databases;
+// either may be nil
+type geoIPDatabases struct {
+	location *geoDatabase
+	asn      *geoDatabase
+}
+
+// geoIP is nil unless a GeoIP database is configured
+var geoIP *geoIPDatabases
+
+// configureGeoIP loads the databases named by GO_SUBNET_CALCULATOR_GEOIP_DB (a
+// GeoLite2 City or Country file) and GO_SUBNET_CALCULATOR_GEOIP_ASN_DB (a GeoLite2
+// ASN file). GeoIP annotations are off when neither is set
+func configureGeoIP() error {
+	geoIP = nil
+	dbs := &geoIPDatabases{}
+	for _, setting := range []struct {
+		env string
+		db  **geoDatabase
+	}{
+		{"GO_SUBNET_CALCULATOR_GEOIP_DB", &dbs.location},
+		{"GO_SUBNET_CALCULATOR_GEOIP_ASN_DB", &dbs.asn},
+	} {
+		path := os.Getenv(setting.env)
+		if path == "" {
+			continue
+		}
+		db, err := openGeoDatabase(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", setting.env, err)
+		}
+		*setting.db = db
+		recordSystemAudit("config.geoip", path, "loaded %s database", db.reader.databaseType)
+	}
+	if dbs.location == nil && dbs.asn == nil {
+		recordSystemAudit("config.geoip", "", "GeoIP annotations disabled")
+		return nil
+	}
+	geoIP = dbs
+	return nil
+}
+
+// mmdbPath returns the value at the given map keys of a decoded record
+func mmdbPath(record interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		m, ok := record.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		record = m[key]
+	}
+	return record
+}
+
+// mmdbText returns the string at the given map keys of a decoded record
+func mmdbText(record interface{}, keys ...string) string {
+	s, _ := mmdbPath(record, keys...).(string)
+	return s
+}
+
+// Lookup annotates ip from the configured databases. It returns nil when no database
+// has a record for the address
+func (dbs *geoIPDatabases) Lookup(ip net.IP) (*GeoLocation, error) {
+	loc := &GeoLocation{}
+	found := false
+	if dbs.location != nil {
+		record, network, err := dbs.location.current().Lookup(ip)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			found = true
+			loc.Network = network.String()
+			country := "country"
+			if mmdbPath(record, country) == nil {
+				country = "registered_country"
+			}
+			loc.CountryCode = mmdbText(record, country, "iso_code")
+			loc.Country = mmdbText(record, country, "names", "en")
+			loc.City = mmdbText(record, "city", "names", "en")
+		}
+	}
+	if dbs.asn != nil {
+		record, network, err := dbs.asn.current().Lookup(ip)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			found = true
+			if loc.Network == "" {
+				loc.Network = network.String()
+			}
+			loc.ASN, _ = mmdbPath(record, "autonomous_system_number").(uint64)
+			loc.ASOrg = mmdbText(record, "autonomous_system_organization")
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	return loc, nil
+}
+
+// lookupGeoLocation returns the GeoIP annotation of a public address, or nil when
+// GeoIP is not configured, the address is not public or it is not in the databases
+func lookupGeoLocation(address string) *GeoLocation {
+	ip := net.ParseIP(address)
+	if geoIP == nil || !isPublicIPv4(ip) {
+		return nil
+	}
+	loc, err := geoIP.Lookup(ip)
+	if err != nil {
+		log.Printf("GeoIP lookup of %s failed: %v", address, err)
+		return nil
+	}
+	return loc
+}
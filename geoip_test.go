@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// encodeMMDB appends v in the MMDB data format. It supports what the tests need:
+// maps, strings shorter than 285 bytes and unsigned integers
+func encodeMMDB(buf *bytes.Buffer, v interface{}) {
+	control := func(kind, size int) {
+		sizeBits, extra := size, []byte(nil)
+		if size >= 29 {
+			sizeBits, extra = 29, []byte{byte(size - 29)}
+		}
+		if kind > 7 {
+			buf.WriteByte(byte(sizeBits))
+			buf.WriteByte(byte(kind - 7))
+		} else {
+			buf.WriteByte(byte(kind<<5 | sizeBits))
+		}
+		buf.Write(extra)
+	}
+	switch v := v.(type) {
+	case string:
+		control(mmdbString, len(v))
+		buf.WriteString(v)
+	case int:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(v))
+		trimmed := bytes.TrimLeft(b[:], "\x00")
+		control(mmdbUint64, len(trimmed))
+		buf.Write(trimmed)
+	case map[string]interface{}:
+		control(mmdbMap, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encodeMMDB(buf, k)
+			encodeMMDB(buf, v[k])
+		}
+	}
+}
+
+// buildTestMMDB writes a database with 24-bit records mapping IPv4 prefixes to
+// records. An IPv6 database stores them under ::/96 like the GeoLite2 files
+func buildTestMMDB(t *testing.T, ipVersion int, records map[string]map[string]interface{}) []byte {
+	t.Helper()
+	type node struct {
+		child [2]*node
+		data  int
+	}
+	root := &node{data: -1}
+	var data bytes.Buffer
+	for prefix, record := range records {
+		network, err := parseIPv4Prefix(prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := network.Mask.Size()
+		bits := make([]uint32, 0, 128)
+		if ipVersion == 6 {
+			bits = append(bits, make([]uint32, 96)...)
+		}
+		for i := 0; i < ones; i++ {
+			bits = append(bits, ipToUint32(network.IP)>>uint(31-i)&1)
+		}
+		n := root
+		for i, bit := range bits {
+			if n.child[bit] == nil {
+				n.child[bit] = &node{data: -1}
+			}
+			n = n.child[bit]
+			if i == len(bits)-1 {
+				n.data = data.Len()
+				encodeMMDB(&data, record)
+			}
+		}
+	}
+
+	// number the inner nodes breadth first; leaves point into the data section
+	var inner []*node
+	numbers := map[*node]int{}
+	for queue := []*node{root}; len(queue) > 0; queue = queue[1:] {
+		n := queue[0]
+		numbers[n] = len(inner)
+		inner = append(inner, n)
+		for _, c := range n.child {
+			if c != nil && c.data < 0 {
+				queue = append(queue, c)
+			}
+		}
+	}
+	var file bytes.Buffer
+	for _, n := range inner {
+		for _, c := range n.child {
+			value := len(inner)
+			switch {
+			case c == nil:
+			case c.data >= 0:
+				value = len(inner) + 16 + c.data
+			default:
+				value = numbers[c]
+			}
+			file.Write([]byte{byte(value >> 16), byte(value >> 8), byte(value)})
+		}
+	}
+	file.Write(make([]byte, 16))
+	file.Write(data.Bytes())
+	file.Write(mmdbMetadataMarker)
+	encodeMMDB(&file, map[string]interface{}{
+		"node_count":    len(inner),
+		"record_size":   24,
+		"ip_version":    ipVersion,
+		"database_type": "Test-DB",
+	})
+	return file.Bytes()
+}
+
+var testCityRecords = map[string]map[string]interface{}{
+	"8.8.8.0/24": {
+		"country": map[string]interface{}{"iso_code": "US", "names": map[string]interface{}{"en": "United States", "de": "USA"}},
+		"city":    map[string]interface{}{"names": map[string]interface{}{"en": "Mountain View"}},
+	},
+	"81.2.68.0/23": {
+		"registered_country": map[string]interface{}{"iso_code": "GB", "names": map[string]interface{}{"en": "United Kingdom"}},
+	},
+}
+
+func TestMMDBReader(t *testing.T) {
+	for _, version := range []int{4, 6} {
+		r, err := newMMDBReader(buildTestMMDB(t, version, testCityRecords))
+		if err != nil {
+			t.Fatalf("IPv%d: %v", version, err)
+		}
+		if r.databaseType != "Test-DB" {
+			t.Errorf("IPv%d: database type = %q", version, r.databaseType)
+		}
+		record, network, err := r.Lookup(net.ParseIP("8.8.8.8"))
+		if err != nil || network.String() != "8.8.8.0/24" || mmdbText(record, "city", "names", "en") != "Mountain View" {
+			t.Errorf("IPv%d: Lookup(8.8.8.8) = %v, %v, %v", version, record, network, err)
+		}
+		if record, _, err := r.Lookup(net.ParseIP("9.9.9.9")); record != nil || err != nil {
+			t.Errorf("IPv%d: Lookup(9.9.9.9) = %v, %v; want no record", version, record, err)
+		}
+	}
+
+	if _, err := newMMDBReader([]byte("not a database")); err == nil {
+		t.Error("expected an error for a file without metadata")
+	}
+	// a pointer to itself
+	if _, _, err := (&mmdbDecoder{buf: []byte{0x20, 0x00}}).decode(0); err == nil {
+		t.Error("expected an error for a pointer cycle")
+	}
+}
+
+// withTestGeoIP writes the test databases to files and loads them
+func withTestGeoIP(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	city := filepath.Join(dir, "city.mmdb")
+	asn := filepath.Join(dir, "asn.mmdb")
+	os.WriteFile(city, buildTestMMDB(t, 6, testCityRecords), 0o644)
+	os.WriteFile(asn, buildTestMMDB(t, 4, map[string]map[string]interface{}{
+		"8.8.8.0/23": {"autonomous_system_number": 15169, "autonomous_system_organization": "GOOGLE"},
+	}), 0o644)
+	t.Setenv("GO_SUBNET_CALCULATOR_GEOIP_DB", city)
+	t.Setenv("GO_SUBNET_CALCULATOR_GEOIP_ASN_DB", asn)
+	previous := geoIP
+	t.Cleanup(func() { geoIP = previous })
+	if err := configureGeoIP(); err != nil {
+		t.Fatal(err)
+	}
+	return city
+}
+
+func TestGeoIPLookup(t *testing.T) {
+	withTestAudit(t)
+	withTestGeoIP(t)
+
+	loc := lookupGeoLocation("8.8.8.8")
+	want := GeoLocation{Network: "8.8.8.0/24", CountryCode: "US", Country: "United States", City: "Mountain View", ASN: 15169, ASOrg: "GOOGLE"}
+	if loc == nil || *loc != want {
+		t.Errorf("lookupGeoLocation(8.8.8.8) = %+v, want %+v", loc, want)
+	}
+	if loc := lookupGeoLocation("81.2.69.1"); loc == nil || loc.CountryCode != "GB" || loc.ASN != 0 {
+		t.Errorf("lookupGeoLocation(81.2.69.1) = %+v, want the registered country", loc)
+	}
+	for _, address := range []string{"9.9.9.9", "10.0.0.1"} {
+		if loc := lookupGeoLocation(address); loc != nil {
+			t.Errorf("lookupGeoLocation(%s) = %+v, want nil", address, loc)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	calculateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=8.8.8.8&mask=/24", nil))
+	var result SubnetResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || result.Location == nil || result.Location.City != "Mountain View" {
+		t.Errorf("calculate location = %+v, %v", result.Location, err)
+	}
+}
+
+func TestGeoIPReload(t *testing.T) {
+	withTestAudit(t)
+	city := withTestGeoIP(t)
+
+	os.WriteFile(city, buildTestMMDB(t, 4, map[string]map[string]interface{}{
+		"8.8.0.0/16": {"country": map[string]interface{}{"iso_code": "CA"}},
+	}), 0o644)
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(city, later, later)
+	geoIP.location.checked = time.Time{}
+	if loc := lookupGeoLocation("8.8.8.8"); loc == nil || loc.CountryCode != "CA" || loc.Network != "8.8.0.0/16" {
+		t.Errorf("after reload = %+v, want CA in 8.8.0.0/16", loc)
+	}
+
+	// a broken file keeps the loaded version
+	os.WriteFile(city, []byte("truncated"), 0o644)
+	os.Chtimes(city, later.Add(time.Hour), later.Add(time.Hour))
+	geoIP.location.checked = time.Time{}
+	if loc := lookupGeoLocation("8.8.8.8"); loc == nil || loc.CountryCode != "CA" {
+		t.Errorf("after a failed reload = %+v, want the previous database", loc)
+	}
+
+	t.Setenv("GO_SUBNET_CALCULATOR_GEOIP_DB", filepath.Join(t.TempDir(), "missing.mmdb"))
+	if err := configureGeoIP(); err == nil {
+		t.Error("expected an error for a missing database file")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// healthStorageTimeout bounds the storage ping of a health check
+const healthStorageTimeout = 2 * time.Second
+
+// Component states of a health check
+const (
+	componentOK       = "ok"
+	componentFailed   = "failed"
+	componentDisabled = "disabled"
+)
+
+// ComponentHealth is the state of one dependency in the health response
+type ComponentHealth struct {
+	Status  string `json:"status"`
+	Details string `json:"details,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// pageTemplates are the templates rendered by the web pages, checked by the health
+// endpoint and rendered by the self-test; themes are checked on top
+var pageTemplates = []string{"index.html", "cheatsheet.html", "lpm.html", "batch.html", "quiz.html", "login.html", "ipam.html", "plan.html", "sites.html"}
+
+// checkTemplates parses every page and theme template
+func checkTemplates() ComponentHealth {
+	for _, file := range pageTemplates {
+		if _, err := loadTemplate(file); err != nil {
+			return ComponentHealth{Status: componentFailed, Error: err.Error()}
+		}
+	}
+	for _, theme := range themes {
+		if _, _, err := loadTheme(theme); err != nil {
+			return ComponentHealth{Status: componentFailed, Error: err.Error()}
+		}
+	}
+	return ComponentHealth{Status: componentOK, Details: fmt.Sprintf("%d pages, %d themes", len(pageTemplates), len(themes))}
+}
+
+// checkStorage pings the database; the in-memory store is always up
+func checkStorage(ctx context.Context) ComponentHealth {
+	db := storageDB
+	if db == nil {
+		return ComponentHealth{Status: componentOK, Details: "in-memory"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthStorageTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		return ComponentHealth{Status: componentFailed, Error: err.Error()}
+	}
+	return ComponentHealth{Status: componentOK, Details: "sql"}
+}
+
+// checkGeoIP reports the loaded GeoIP databases
+func checkGeoIP() ComponentHealth {
+	dbs := geoIP
+	if dbs == nil {
+		return ComponentHealth{Status: componentDisabled}
+	}
+	var loaded []string
+	for _, db := range []*geoDatabase{dbs.location, dbs.asn} {
+		if db == nil {
+			continue
+		}
+		reader := db.current()
+		if reader == nil {
+			return ComponentHealth{Status: componentFailed, Error: db.path + " is not loaded"}
+		}
+		loaded = append(loaded, reader.databaseType)
+	}
+	return ComponentHealth{Status: componentOK, Details: strings.Join(loaded, ", ")}
+}
+
+// checkRDAP reports the RDAP service and the size of its cache
+func checkRDAP() ComponentHealth {
+	client := rdap
+	if client == nil {
+		return ComponentHealth{Status: componentDisabled}
+	}
+	client.mu.Lock()
+	cached := len(client.cache)
+	client.mu.Unlock()
+	return ComponentHealth{Status: componentOK, Details: fmt.Sprintf("%s, %d cached netblocks", client.baseURL, cached)}
+}
+
+// checkASN reports the BGP origin source
+func checkASN() ComponentHealth {
+	switch source := loadOrigins().(type) {
+	case nil:
+		return ComponentHealth{Status: componentDisabled}
+	case *ip2asnTable:
+		if len(source.entries) == 0 {
+			return ComponentHealth{Status: componentFailed, Error: "ip2asn table is empty"}
+		}
+		return ComponentHealth{Status: componentOK, Details: fmt.Sprintf("ip2asn, %d ranges", len(source.entries))}
+	default:
+		return ComponentHealth{Status: componentOK, Details: "cymru"}
+	}
+}
+
+// checkComponents runs every dependency check. The instance is unhealthy when a
+// template or the storage fails, and degraded when an optional dataset does
+func checkComponents(ctx context.Context) (string, map[string]ComponentHealth) {
+	components := map[string]ComponentHealth{
+		"templates": checkTemplates(),
+		"storage":   checkStorage(ctx),
+		"geoip":     checkGeoIP(),
+		"rdap":      checkRDAP(),
+		"asn":       checkASN(),
+	}
+	status := "healthy"
+	for name, c := range components {
+		if c.Status != componentFailed {
+			continue
+		}
+		if name == "templates" || name == "storage" {
+			return "unhealthy", components
+		}
+		status = "degraded"
+	}
+	return status, components
+}
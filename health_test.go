@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveHealth(t *testing.T) (int, HealthResponse) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var resp HealthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid health response %q: %v", rr.Body.String(), err)
+	}
+	return rr.Code, resp
+}
+
+func TestHealthComponents(t *testing.T) {
+	withTestOrigins(t, nil)
+	code, resp := serveHealth(t)
+	if code != http.StatusOK || resp.Status != "healthy" {
+		t.Fatalf("health = %d %+v", code, resp)
+	}
+	want := map[string]string{"templates": componentOK, "storage": componentOK, "geoip": componentDisabled, "rdap": componentDisabled, "asn": componentDisabled}
+	for name, status := range want {
+		if c := resp.Components[name]; c.Status != status {
+			t.Errorf("%s = %+v, want %s", name, c, status)
+		}
+	}
+	if resp.Components["storage"].Details != "in-memory" {
+		t.Errorf("storage = %+v", resp.Components["storage"])
+	}
+}
+
+func TestHealthDatasets(t *testing.T) {
+	withTestAudit(t)
+	withTestGeoIP(t)
+	withTestRDAP(t, time.Second, "{}")
+	withTestOrigins(t, &ip2asnTable{})
+
+	code, resp := serveHealth(t)
+	if code != http.StatusOK || resp.Status != "degraded" {
+		t.Errorf("health with an empty ip2asn table = %d %s, want 200 degraded", code, resp.Status)
+	}
+	if c := resp.Components["geoip"]; c.Status != componentOK || !strings.Contains(c.Details, "Test-DB") {
+		t.Errorf("geoip = %+v", c)
+	}
+	if c := resp.Components["rdap"]; c.Status != componentOK || !strings.Contains(c.Details, "0 cached netblocks") {
+		t.Errorf("rdap = %+v", c)
+	}
+	if c := resp.Components["asn"]; c.Status != componentFailed {
+		t.Errorf("asn = %+v", c)
+	}
+}
+
+func TestHealthMissingTemplates(t *testing.T) {
+	t.Chdir(t.TempDir())
+	code, resp := serveHealth(t)
+	if code != http.StatusServiceUnavailable || resp.Status != "unhealthy" {
+		t.Errorf("health without templates = %d %s, want 503 unhealthy", code, resp.Status)
+	}
+	if c := resp.Components["templates"]; c.Status != componentFailed || !strings.Contains(c.Error, "index.html") {
+		t.Errorf("templates = %+v", c)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRecentSize is how many calculations the service-wide history keeps when
+// GO_SUBNET_CALCULATOR_HISTORY_SIZE is not set
+const defaultRecentSize = 100
+
+// maxRecentSize bounds GO_SUBNET_CALCULATOR_HISTORY_SIZE
+const maxRecentSize = 100000
+
+// RecentCalculation is a calculation asked of the service, successful or not
+type RecentCalculation struct {
+	Timestamp time.Time `json:"timestamp"`
+	Source    string    `json:"source"`
+	Actor     string    `json:"actor"`
+	IP        string    `json:"ip"`
+	Mask      string    `json:"mask"`
+	Cloud     string    `json:"cloud,omitempty"`
+	Network   string    `json:"network,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// recentCalculations is a ring buffer of the latest calculations from every caller,
+// kept in memory only. A size of zero disables it
+type recentCalculations struct {
+	mu      sync.Mutex
+	entries []RecentCalculation
+	next    int
+	full    bool
+}
+
+func newRecentCalculations(size int) *recentCalculations {
+	return &recentCalculations{entries: make([]RecentCalculation, size)}
+}
+
+// Enabled reports whether calculations are kept
+func (h *recentCalculations) Enabled() bool {
+	return len(h.entries) > 0
+}
+
+// Add keeps a calculation, overwriting the oldest one once the buffer is full
+func (h *recentCalculations) Add(c RecentCalculation) {
+	if !h.Enabled() {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries[h.next] = c
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// List returns up to limit calculations, newest first
+func (h *recentCalculations) List(limit int) []RecentCalculation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	count := h.next
+	if h.full {
+		count = len(h.entries)
+	}
+	count = min(count, limit)
+	list := make([]RecentCalculation, 0, count)
+	for i := 1; i <= count; i++ {
+		list = append(list, h.entries[(h.next-i+len(h.entries))%len(h.entries)])
+	}
+	return list
+}
+
+// recentHistory holds the calculations behind /api/v1/history
+var recentHistory = newRecentCalculations(defaultRecentSize)
+
+// configureHistory sizes the history from GO_SUBNET_CALCULATOR_HISTORY_SIZE; 0 disables it
+func configureHistory() error {
+	size := defaultRecentSize
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_HISTORY_SIZE"); value != "" {
+		var err error
+		if size, err = strconv.Atoi(value); err != nil || size < 0 || size > maxRecentSize {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_HISTORY_SIZE must be between 0 and %d", maxRecentSize)
+		}
+	}
+	recentHistory = newRecentCalculations(size)
+	if size == 0 {
+		log.Printf("Calculation history: disabled")
+	}
+	recordSystemAudit("config.history", "", "keeping the last %d calculations", size)
+	return nil
+}
+
+// recordRecent adds a calculation made through a request to the history. source tells
+// where it came from, such as "api" or "web"
+func recordRecent(r *http.Request, source, ip, mask, cloud string, result *SubnetResult, err error) {
+	c := RecentCalculation{
+		Timestamp: time.Now().UTC(),
+		Source:    source,
+		Actor:     requestActor(r),
+		IP:        ip,
+		Mask:      mask,
+		Cloud:     cloud,
+	}
+	if err != nil {
+		c.Error = err.Error()
+	} else if result != nil {
+		c.Network = result.NetworkAddress
+	}
+	recentHistory.Add(c)
+}
+
+// historyHandler serves GET /api/v1/history, the latest calculations of every caller,
+// newest first. It shows what others asked, so it needs admin in every tenant
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if err := requestPrincipal(r).checkGlobal(RoleAdmin); err != nil {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if !recentHistory.Enabled() {
+		writeJSONError(w, http.StatusNotFound, "calculation history is disabled")
+		return
+	}
+	limit := len(recentHistory.entries)
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, recentHistory.List(limit))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// withTestHistory gives a test an empty history of the given size
+func withTestHistory(t *testing.T, size int) *recentCalculations {
+	t.Helper()
+	previous := recentHistory
+	recentHistory = newRecentCalculations(size)
+	t.Cleanup(func() { recentHistory = previous })
+	return recentHistory
+}
+
+func TestRecentCalculationsRing(t *testing.T) {
+	h := newRecentCalculations(3)
+	if got := h.List(10); len(got) != 0 {
+		t.Errorf("empty history = %v", got)
+	}
+	for i := 1; i <= 5; i++ {
+		h.Add(RecentCalculation{IP: fmt.Sprintf("10.0.0.%d", i)})
+	}
+	got := h.List(10)
+	if len(got) != 3 || got[0].IP != "10.0.0.5" || got[2].IP != "10.0.0.3" {
+		t.Errorf("history = %+v, want 10.0.0.5 down to 10.0.0.3", got)
+	}
+	if got := h.List(1); len(got) != 1 || got[0].IP != "10.0.0.5" {
+		t.Errorf("limited history = %+v", got)
+	}
+
+	disabled := newRecentCalculations(0)
+	disabled.Add(RecentCalculation{IP: "10.0.0.1"})
+	if disabled.Enabled() || len(disabled.List(10)) != 0 {
+		t.Error("a zero-size history must keep nothing")
+	}
+}
+
+func TestConfigureHistory(t *testing.T) {
+	withTestHistory(t, defaultRecentSize)
+	withTestAudit(t)
+	for value, want := range map[string]int{"": defaultRecentSize, "0": 0, "25": 25} {
+		t.Setenv("GO_SUBNET_CALCULATOR_HISTORY_SIZE", value)
+		if err := configureHistory(); err != nil || len(recentHistory.entries) != want {
+			t.Errorf("%q: size %d, %v; want %d", value, len(recentHistory.entries), err, want)
+		}
+	}
+	for _, value := range []string{"-1", "many", "1000001"} {
+		t.Setenv("GO_SUBNET_CALCULATOR_HISTORY_SIZE", value)
+		if err := configureHistory(); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	withTestHistory(t, 10)
+	withTestCalculations(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/calculate", calculateHandler)
+	mux.HandleFunc("/api/v1/history", historyHandler)
+	get := func(target string, p *Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if p != nil {
+			req = withPrincipal(req, p)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	get("/api/v1/calculate?ip=10.1.2.3&mask=/16", nil)
+	get("/api/v1/calculate?ip=10.1.2.3&mask=/33", nil)
+
+	rr := get("/api/v1/history", nil)
+	var list []RecentCalculation
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("history = %d %v", rr.Code, err)
+	}
+	if len(list) != 2 || list[0].Error == "" || list[1].Network != "10.1.0.0" || list[1].Source != "api" || list[1].Actor != "anonymous" {
+		t.Errorf("history = %+v", list)
+	}
+	if rr := get("/api/v1/history?limit=1", nil); rr.Code != http.StatusOK {
+		t.Errorf("limit=1 = %d", rr.Code)
+	}
+	if rr := get("/api/v1/history?limit=0", nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("limit=0 = %d, want 400", rr.Code)
+	}
+
+	viewer := &Principal{Name: "user:bob", Tenant: defaultTenant, Role: RoleViewer}
+	if rr := get("/api/v1/history", viewer); rr.Code != http.StatusForbidden {
+		t.Errorf("viewer = %d, want 403", rr.Code)
+	}
+
+	withTestHistory(t, 0)
+	if rr := get("/api/v1/history", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("disabled history = %d, want 404", rr.Code)
+	}
+}
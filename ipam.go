@@ -0,0 +1,1013 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+var (
+	errIPAMNotFound = errors.New("not found")
+	errIPAMConflict = errors.New("conflict")
+)
+
+// IPAMPool is a managed supernet that allocations are carved from. It belongs to one
+// tenant, and so do its allocations. Size, Allocated, Allocations and Utilization are
+// computed when the pool is read and are not stored
+type IPAMPool struct {
+	ID          int64     `json:"id"`
+	Tenant      string    `json:"tenant"`
+	Name        string    `json:"name"`
+	Prefix      string    `json:"prefix"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	Size        uint64  `json:"size"`
+	Allocated   uint64  `json:"allocated"`
+	Allocations int     `json:"allocations"`
+	Utilization float64 `json:"utilization"`
+}
+
+// IPAMAllocation is a block handed out from a pool
+type IPAMAllocation struct {
+	ID          int64     `json:"id"`
+	PoolID      int64     `json:"pool_id"`
+	Prefix      string    `json:"prefix"`
+	Description string    `json:"description,omitempty"`
+	VLAN        int       `json:"vlan,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// IPAMStore persists pools and allocations. Get, Update and Delete return
+// errIPAMNotFound for unknown ids; Create assigns the id and creation time
+type IPAMStore interface {
+	ListPools() ([]*IPAMPool, error)
+	GetPool(id int64) (*IPAMPool, error)
+	CreatePool(p *IPAMPool) error
+	UpdatePool(p *IPAMPool) error
+	DeletePool(id int64) error
+
+	ListAllocations(poolID int64) ([]*IPAMAllocation, error)
+	GetAllocation(id int64) (*IPAMAllocation, error)
+	CreateAllocation(a *IPAMAllocation) error
+	UpdateAllocation(a *IPAMAllocation) error
+	DeleteAllocation(id int64) error
+}
+
+// memoryIPAMStore keeps pools and allocations in memory; they are lost on restart
+type memoryIPAMStore struct {
+	mu          sync.RWMutex
+	nextID      int64
+	pools       map[int64]*IPAMPool
+	allocations map[int64]*IPAMAllocation
+}
+
+func newMemoryIPAMStore() *memoryIPAMStore {
+	return &memoryIPAMStore{pools: map[int64]*IPAMPool{}, allocations: map[int64]*IPAMAllocation{}}
+}
+
+func (s *memoryIPAMStore) ListPools() ([]*IPAMPool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*IPAMPool, 0, len(s.pools))
+	for _, p := range s.pools {
+		c := *p
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *memoryIPAMStore) GetPool(id int64) (*IPAMPool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.pools[id]
+	if !ok {
+		return nil, errIPAMNotFound
+	}
+	c := *p
+	return &c, nil
+}
+
+func (s *memoryIPAMStore) CreatePool(p *IPAMPool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	p.ID, p.CreatedAt = s.nextID, time.Now().UTC()
+	c := *p
+	s.pools[p.ID] = &c
+	return nil
+}
+
+func (s *memoryIPAMStore) UpdatePool(p *IPAMPool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pools[p.ID]; !ok {
+		return errIPAMNotFound
+	}
+	c := *p
+	s.pools[p.ID] = &c
+	return nil
+}
+
+func (s *memoryIPAMStore) DeletePool(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pools[id]; !ok {
+		return errIPAMNotFound
+	}
+	delete(s.pools, id)
+	return nil
+}
+
+func (s *memoryIPAMStore) ListAllocations(poolID int64) ([]*IPAMAllocation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*IPAMAllocation
+	for _, a := range s.allocations {
+		if a.PoolID == poolID {
+			c := *a
+			list = append(list, &c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *memoryIPAMStore) GetAllocation(id int64) (*IPAMAllocation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.allocations[id]
+	if !ok {
+		return nil, errIPAMNotFound
+	}
+	c := *a
+	return &c, nil
+}
+
+func (s *memoryIPAMStore) CreateAllocation(a *IPAMAllocation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	a.ID, a.CreatedAt = s.nextID, time.Now().UTC()
+	c := *a
+	s.allocations[a.ID] = &c
+	return nil
+}
+
+func (s *memoryIPAMStore) UpdateAllocation(a *IPAMAllocation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.allocations[a.ID]; !ok {
+		return errIPAMNotFound
+	}
+	c := *a
+	s.allocations[a.ID] = &c
+	return nil
+}
+
+func (s *memoryIPAMStore) DeleteAllocation(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.allocations[id]; !ok {
+		return errIPAMNotFound
+	}
+	delete(s.allocations, id)
+	return nil
+}
+
+// IPAM enforces the address-management rules on top of a store: pools never overlap,
+// not even across tenants, allocations lie inside their pool and never overlap each other
+type IPAM struct {
+	mu    sync.Mutex
+	store IPAMStore
+
+	// Interval indexes of the pool prefixes and of the allocations of each pool,
+	// loaded from the store on first use, so overlap checks need not scan them all
+	pools       *cidrset.Index[int64]
+	allocations map[int64]*cidrset.Index[int64]
+}
+
+func newIPAM(store IPAMStore) *IPAM {
+	return &IPAM{store: store, allocations: map[int64]*cidrset.Index[int64]{}}
+}
+
+// poolIndex returns the index of pool prefixes to pool ids. Callers hold m.mu
+func (m *IPAM) poolIndex() (*cidrset.Index[int64], error) {
+	if m.pools != nil {
+		return m.pools, nil
+	}
+	pools, err := m.store.ListPools()
+	if err != nil {
+		return nil, err
+	}
+	index := cidrset.NewIndex[int64]()
+	for _, p := range pools {
+		if network, err := parseIPv4Prefix(p.Prefix); err == nil {
+			index.InsertPrefix(network, p.ID)
+		}
+	}
+	m.pools = index
+	return index, nil
+}
+
+// allocationIndex returns the index of the allocations of a pool to allocation ids.
+// Callers hold m.mu
+func (m *IPAM) allocationIndex(poolID int64) (*cidrset.Index[int64], error) {
+	if index, ok := m.allocations[poolID]; ok {
+		return index, nil
+	}
+	allocations, err := m.store.ListAllocations(poolID)
+	if err != nil {
+		return nil, err
+	}
+	index := cidrset.NewIndex[int64]()
+	for _, a := range allocations {
+		if network, err := parseIPv4Prefix(a.Prefix); err == nil {
+			index.InsertPrefix(network, a.ID)
+		}
+	}
+	m.allocations[poolID] = index
+	return index, nil
+}
+
+// ipamService is the IPAM instance behind the API and the management page
+var ipamService = newIPAM(newMemoryIPAMStore())
+
+// PoolRequest creates or updates a pool; Prefix cannot be changed after creation.
+// Tenant defaults to "default" on creation and moves the pool when updated
+type PoolRequest struct {
+	Tenant      string `json:"tenant,omitempty"`
+	Name        string `json:"name"`
+	Prefix      string `json:"prefix"`
+	Description string `json:"description,omitempty"`
+}
+
+// AllocationRequest asks for the first free block of prefix length Size, or for a
+// specific Prefix. VLAN is an optional 802.1Q VLAN ID
+type AllocationRequest struct {
+	Size        int    `json:"size,omitempty"`
+	Prefix      string `json:"prefix,omitempty"`
+	Description string `json:"description,omitempty"`
+	VLAN        int    `json:"vlan,omitempty"`
+}
+
+// validVLAN accepts 0 (no VLAN) and the usable 802.1Q IDs 1-4094
+func validVLAN(vlan int) error {
+	if vlan < 0 || vlan > 4094 {
+		return fmt.Errorf("vlan must be between 1 and 4094")
+	}
+	return nil
+}
+
+// withUsage fills in the computed size and utilization of a pool
+func (m *IPAM) withUsage(p *IPAMPool) (*IPAMPool, error) {
+	network, err := parseIPv4Prefix(p.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	allocations, err := m.store.ListAllocations(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	p.Size = cidrset.PrefixToRange(network).Size()
+	p.Allocated = 0
+	p.Allocations = len(allocations)
+	for _, a := range allocations {
+		if n, err := parseIPv4Prefix(a.Prefix); err == nil {
+			p.Allocated += cidrset.PrefixToRange(n).Size()
+		}
+	}
+	p.Utilization = float64(p.Allocated) * 100 / float64(p.Size)
+	return p, nil
+}
+
+// checkUtilization re-reads the usage of a pool after a change and raises the
+// threshold alerts crossed since the utilization was before
+func (m *IPAM) checkUtilization(pool *IPAMPool, before float64) {
+	if _, err := m.withUsage(pool); err != nil {
+		log.Printf("IPAM utilization check for pool %d failed: %v", pool.ID, err)
+		return
+	}
+	ipamAlerts.Check(before, pool)
+}
+
+// Pools lists every pool with its utilization
+func (m *IPAM) Pools() ([]*IPAMPool, error) {
+	pools, err := m.store.ListPools()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pools {
+		if _, err := m.withUsage(p); err != nil {
+			return nil, err
+		}
+	}
+	return pools, nil
+}
+
+// Pool returns a pool with its utilization
+func (m *IPAM) Pool(id int64) (*IPAMPool, error) {
+	p, err := m.store.GetPool(id)
+	if err != nil {
+		return nil, err
+	}
+	return m.withUsage(p)
+}
+
+// CreatePool adds a pool that must not overlap any existing pool
+func (m *IPAM) CreatePool(req PoolRequest) (*IPAMPool, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("pool name is required")
+	}
+	tenant := req.Tenant
+	if tenant == "" {
+		tenant = defaultTenant
+	}
+	if err := validTenant(tenant, false); err != nil {
+		return nil, err
+	}
+	network, err := parseIPv4Prefix(req.Prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pools, err := m.poolIndex()
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := pools.OverlapPrefix(network); ok {
+		p, err := m.store.GetPool(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %s overlaps pool %q (%s)", errIPAMConflict, network, p.Name, p.Prefix)
+	}
+
+	pool := &IPAMPool{Tenant: tenant, Name: name, Prefix: network.String(), Description: strings.TrimSpace(req.Description)}
+	if err := m.store.CreatePool(pool); err != nil {
+		return nil, err
+	}
+	pools.InsertPrefix(network, pool.ID)
+	return m.withUsage(pool)
+}
+
+// UpdatePool changes the name, description and tenant of a pool
+func (m *IPAM) UpdatePool(id int64, req PoolRequest) (*IPAMPool, error) {
+	if req.Tenant != "" {
+		if err := validTenant(req.Tenant, false); err != nil {
+			return nil, err
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pool, err := m.store.GetPool(id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Prefix != "" {
+		if network, err := parseIPv4Prefix(req.Prefix); err != nil || network.String() != pool.Prefix {
+			return nil, fmt.Errorf("the prefix of a pool cannot be changed")
+		}
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		pool.Name = name
+	}
+	if req.Tenant != "" {
+		pool.Tenant = req.Tenant
+	}
+	pool.Description = strings.TrimSpace(req.Description)
+	if err := m.store.UpdatePool(pool); err != nil {
+		return nil, err
+	}
+	return m.withUsage(pool)
+}
+
+// DeletePool removes a pool that has no allocations left
+func (m *IPAM) DeletePool(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pool, err := m.store.GetPool(id)
+	if err != nil {
+		return err
+	}
+	allocations, err := m.store.ListAllocations(id)
+	if err != nil {
+		return err
+	}
+	if len(allocations) > 0 {
+		return fmt.Errorf("%w: pool still has %d allocations", errIPAMConflict, len(allocations))
+	}
+	if err := m.store.DeletePool(id); err != nil {
+		return err
+	}
+	if network, err := parseIPv4Prefix(pool.Prefix); err == nil && m.pools != nil {
+		m.pools.DeletePrefix(network)
+	}
+	delete(m.allocations, id)
+	return nil
+}
+
+// Allocations lists the allocations of a pool
+func (m *IPAM) Allocations(poolID int64) ([]*IPAMAllocation, error) {
+	if _, err := m.store.GetPool(poolID); err != nil {
+		return nil, err
+	}
+	return m.store.ListAllocations(poolID)
+}
+
+// Allocate records the requested block, or the lowest free block of the requested size
+func (m *IPAM) Allocate(poolID int64, req AllocationRequest) (*IPAMAllocation, error) {
+	if err := validVLAN(req.VLAN); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pool, err := m.store.GetPool(poolID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.withUsage(pool); err != nil {
+		return nil, err
+	}
+	network, err := parseIPv4Prefix(pool.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	allocated, err := m.allocationIndex(poolID)
+	if err != nil {
+		return nil, err
+	}
+
+	var block *net.IPNet
+	switch {
+	case req.Prefix != "":
+		if block, err = parseIPv4Prefix(req.Prefix); err != nil {
+			return nil, err
+		}
+		if !prefixContains(network, block) {
+			return nil, fmt.Errorf("%s is not inside pool %s", block, network)
+		}
+		if _, ok := allocated.OverlapPrefix(block); ok {
+			return nil, fmt.Errorf("%w: %s overlaps an existing allocation", errIPAMConflict, block)
+		}
+	case req.Size != 0:
+		ones, _ := network.Mask.Size()
+		if req.Size < ones || req.Size > 32 {
+			return nil, fmt.Errorf("size must be between /%d and /32", ones)
+		}
+		used := make([]cidrset.Range, 0, allocated.Len())
+		for _, e := range allocated.Entries() {
+			used = append(used, e.Range)
+		}
+		free := cidrset.New(network).Difference(cidrset.FromRanges(used...))
+		if block = firstFreeBlock(free.Prefixes(), req.Size); block == nil {
+			return nil, fmt.Errorf("%w: no free /%d block left in %s", errIPAMConflict, req.Size, network)
+		}
+	default:
+		return nil, fmt.Errorf("size or prefix is required")
+	}
+
+	allocation := &IPAMAllocation{PoolID: poolID, Prefix: block.String(), Description: strings.TrimSpace(req.Description), VLAN: req.VLAN}
+	if err := m.store.CreateAllocation(allocation); err != nil {
+		return nil, err
+	}
+	allocated.InsertPrefix(block, allocation.ID)
+	m.checkUtilization(pool, pool.Utilization)
+	return allocation, nil
+}
+
+// Allocation returns a single allocation
+func (m *IPAM) Allocation(id int64) (*IPAMAllocation, error) {
+	return m.store.GetAllocation(id)
+}
+
+// UpdateAllocation changes the description and VLAN of an allocation
+func (m *IPAM) UpdateAllocation(id int64, req AllocationRequest) (*IPAMAllocation, error) {
+	if err := validVLAN(req.VLAN); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	allocation, err := m.store.GetAllocation(id)
+	if err != nil {
+		return nil, err
+	}
+	allocation.Description = strings.TrimSpace(req.Description)
+	allocation.VLAN = req.VLAN
+	if err := m.store.UpdateAllocation(allocation); err != nil {
+		return nil, err
+	}
+	return allocation, nil
+}
+
+// Release returns an allocation to its pool
+func (m *IPAM) Release(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	allocation, err := m.store.GetAllocation(id)
+	if err != nil {
+		return err
+	}
+	pool, err := m.store.GetPool(allocation.PoolID)
+	if err != nil {
+		return err
+	}
+	if _, err := m.withUsage(pool); err != nil {
+		return err
+	}
+	if err := m.store.DeleteAllocation(id); err != nil {
+		return err
+	}
+	if index, ok := m.allocations[pool.ID]; ok {
+		if network, err := parseIPv4Prefix(allocation.Prefix); err == nil {
+			index.DeletePrefix(network)
+		}
+	}
+	m.checkUtilization(pool, pool.Utilization)
+	return nil
+}
+
+// writeIPAMError maps IPAM errors to 404, 403, 409 or 400 responses
+func writeIPAMError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errIPAMNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errForbidden):
+		writeJSONError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, errIPAMConflict):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	default:
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+// pathID parses the {id} path value, writing a 404 when it is not a number
+func pathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, errIPAMNotFound.Error())
+		return 0, false
+	}
+	return id, true
+}
+
+// authorizePool checks the principal of a request against the tenant of a pool
+func authorizePool(r *http.Request, poolID int64, role Role) error {
+	pool, err := ipamService.store.GetPool(poolID)
+	if err != nil {
+		return err
+	}
+	return requestPrincipal(r).check(pool.Tenant, role)
+}
+
+// authorizeAllocation checks the principal of a request against the tenant of the
+// pool an allocation belongs to
+func authorizeAllocation(r *http.Request, id int64, role Role) error {
+	allocation, err := ipamService.Allocation(id)
+	if err != nil {
+		return err
+	}
+	return authorizePool(r, allocation.PoolID, role)
+}
+
+// visiblePools keeps the pools of the tenants a principal can see, narrowed to one
+// tenant when tenant is set
+func visiblePools(p *Principal, pools []*IPAMPool, tenant string) []*IPAMPool {
+	list := []*IPAMPool{}
+	for _, pool := range pools {
+		if p.sees(pool.Tenant) && (tenant == "" || pool.Tenant == tenant) {
+			list = append(list, pool)
+		}
+	}
+	return list
+}
+
+// poolTarget and allocationTarget name IPAM objects in the audit log
+func poolTarget(p *IPAMPool) string {
+	return fmt.Sprintf("pool/%d %s", p.ID, p.Prefix)
+}
+
+func allocationTarget(a *IPAMAllocation) string {
+	return fmt.Sprintf("allocation/%d %s", a.ID, a.Prefix)
+}
+
+// auditPoolTarget and auditAllocationTarget look up an object before it is deleted
+// so its prefix ends up in the audit log
+func auditPoolTarget(id int64) string {
+	if p, err := ipamService.Pool(id); err == nil {
+		return poolTarget(p)
+	}
+	return fmt.Sprintf("pool/%d", id)
+}
+
+func auditAllocationTarget(id int64) string {
+	if a, err := ipamService.Allocation(id); err == nil {
+		return allocationTarget(a)
+	}
+	return fmt.Sprintf("allocation/%d", id)
+}
+
+// ipamPoolsHandler serves GET (list) and POST (create) /api/v1/ipam/pools. The list is
+// JSON or, with ?format=xlsx, an Excel report of the pools and their allocations
+func ipamPoolsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		pools, err := ipamService.Pools()
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		pools = visiblePools(requestPrincipal(r), pools, r.URL.Query().Get("tenant"))
+		if responseFormat(r, "json") == "xlsx" {
+			writeIPAMReport(w, pools)
+			return
+		}
+		writeJSON(w, http.StatusOK, pools)
+	case http.MethodPost:
+		var req PoolRequest
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		principal := requestPrincipal(r)
+		if req.Tenant == "" {
+			req.Tenant = principal.homeTenant()
+		}
+		if err := principal.checkTarget(req.Tenant, RoleAdmin); err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		_, span := startSpan(r.Context(), "ipam.create_pool", spanKindInternal)
+		span.Set("ipam.prefix", req.Prefix)
+		pool, err := ipamService.CreatePool(req)
+		span.End(err)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		recordAudit(r, "pool.create", poolTarget(pool), "name %q, tenant %s", pool.Name, pool.Tenant)
+		writeJSON(w, http.StatusCreated, pool)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// ipamPoolHandler serves GET, PUT and DELETE /api/v1/ipam/pools/{id}
+func ipamPoolHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	role := RoleAdmin
+	if r.Method == http.MethodGet {
+		role = RoleViewer
+	}
+	if err := authorizePool(r, id, role); err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		pool, err := ipamService.Pool(id)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, pool)
+	case http.MethodPut:
+		var req PoolRequest
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if req.Tenant != "" {
+			if err := requestPrincipal(r).checkTarget(req.Tenant, RoleAdmin); err != nil {
+				writeIPAMError(w, err)
+				return
+			}
+		}
+		_, span := startSpan(r.Context(), "ipam.update_pool", spanKindInternal)
+		span.Set("ipam.pool_id", id)
+		pool, err := ipamService.UpdatePool(id, req)
+		span.End(err)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		recordAudit(r, "pool.update", poolTarget(pool), "name %q, description %q, tenant %s", pool.Name, pool.Description, pool.Tenant)
+		writeJSON(w, http.StatusOK, pool)
+	case http.MethodDelete:
+		target := auditPoolTarget(id)
+		_, span := startSpan(r.Context(), "ipam.delete_pool", spanKindInternal)
+		span.Set("ipam.pool_id", id)
+		err := ipamService.DeletePool(id)
+		span.End(err)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		recordAudit(r, "pool.delete", target, "")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// ipamPoolAllocationsHandler serves GET (list) and POST (allocate) /api/v1/ipam/pools/{id}/allocations
+func ipamPoolAllocationsHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	role := RoleOperator
+	if r.Method == http.MethodGet {
+		role = RoleViewer
+	}
+	if err := authorizePool(r, id, role); err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		allocations, err := ipamService.Allocations(id)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		if allocations == nil {
+			allocations = []*IPAMAllocation{}
+		}
+		writeJSON(w, http.StatusOK, allocations)
+	case http.MethodPost:
+		var req AllocationRequest
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		_, span := startSpan(r.Context(), "ipam.allocate", spanKindInternal)
+		span.Set("ipam.pool_id", id)
+		allocation, err := ipamService.Allocate(id, req)
+		if err == nil {
+			span.Set("ipam.prefix", allocation.Prefix)
+		}
+		span.End(err)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		recordAudit(r, "allocation.create", allocationTarget(allocation), "pool %d, description %q", allocation.PoolID, allocation.Description)
+		writeJSON(w, http.StatusCreated, allocation)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// ipamAllocationHandler serves GET, PUT and DELETE /api/v1/ipam/allocations/{id}
+func ipamAllocationHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	role := RoleOperator
+	if r.Method == http.MethodGet {
+		role = RoleViewer
+	}
+	if err := authorizeAllocation(r, id, role); err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		allocation, err := ipamService.Allocation(id)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, allocation)
+	case http.MethodPut:
+		var req AllocationRequest
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		_, span := startSpan(r.Context(), "ipam.update_allocation", spanKindInternal)
+		span.Set("ipam.allocation_id", id)
+		allocation, err := ipamService.UpdateAllocation(id, req)
+		span.End(err)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		recordAudit(r, "allocation.update", allocationTarget(allocation), "description %q, vlan %d", allocation.Description, allocation.VLAN)
+		writeJSON(w, http.StatusOK, allocation)
+	case http.MethodDelete:
+		target := auditAllocationTarget(id)
+		_, span := startSpan(r.Context(), "ipam.release", spanKindInternal)
+		span.Set("ipam.allocation_id", id)
+		err := ipamService.Release(id)
+		span.End(err)
+		if err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		recordAudit(r, "allocation.release", target, "")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// pageTenant is the tenant chosen in a page form; users bound to one tenant always
+// act in it
+func pageTenant(r *http.Request, p *Principal) string {
+	if tenant := strings.TrimSpace(r.FormValue("tenant")); tenant != "" && p.global() {
+		return tenant
+	}
+	return p.homeTenant()
+}
+
+// IPAMPage is the data behind the /ipam management page
+type IPAMPage struct {
+	Pools       []*IPAMPool
+	Thresholds  []float64
+	Alerts      []UtilizationAlert
+	Import      *ImportResult
+	ImportCSV   string
+	Discovery   *DiscoveryResult
+	DiscoverReq DiscoveryRequest
+	Selected    *IPAMPool
+	Allocations []*IPAMAllocation
+	Error       string
+	User        string
+	Tenant      string
+	Global      bool
+	CanOperate  bool
+	CanAdmin    bool
+}
+
+// ipamPageHandler serves the /ipam management page. POST forms carry an action of
+// create-pool, delete-pool, allocate or release and redirect back on success; imports
+// and SNMP discoveries show their preview or result instead. Only
+// the pools of the user's tenant are shown and the actions follow the user's role
+func ipamPageHandler(w http.ResponseWriter, r *http.Request) {
+	if !parseFormBody(w, r) {
+		return
+	}
+	tmpl, err := loadTemplate("ipam.html")
+	if err != nil {
+		logRequestf(r.Context(), "Template loading error: %v", err)
+		http.Error(w, "Template loading error", http.StatusInternalServerError)
+		return
+	}
+
+	principal := requestPrincipal(r)
+	if r.Method == http.MethodGet && r.URL.Query().Get("format") == "xlsx" {
+		pools, err := ipamService.Pools()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeIPAMReport(w, visiblePools(principal, pools, ""))
+		return
+	}
+	if format := r.URL.Query().Get("format"); r.Method == http.MethodGet && (format == "svg" || format == "png") {
+		id, _ := strconv.ParseInt(r.FormValue("pool"), 10, 64)
+		writeUtilizationMap(w, r, id)
+		return
+	}
+	page := &IPAMPage{
+		User:       currentUser(r),
+		Tenant:     principal.homeTenant(),
+		Global:     principal.global(),
+		CanOperate: principal.Role.includes(RoleOperator),
+		CanAdmin:   principal.Role.includes(RoleAdmin),
+	}
+	selected, _ := strconv.ParseInt(r.FormValue("pool"), 10, 64)
+
+	if r.Method == http.MethodPost {
+		var actionErr error
+		switch r.FormValue("action") {
+		case "create-pool":
+			req := PoolRequest{Tenant: pageTenant(r, principal), Name: r.FormValue("name"), Prefix: r.FormValue("prefix"), Description: r.FormValue("description")}
+			var pool *IPAMPool
+			if actionErr = principal.checkTarget(req.Tenant, RoleAdmin); actionErr == nil {
+				pool, actionErr = ipamService.CreatePool(req)
+			}
+			if actionErr == nil {
+				selected = pool.ID
+				recordAudit(r, "pool.create", poolTarget(pool), "name %q, tenant %s", pool.Name, pool.Tenant)
+			}
+		case "delete-pool":
+			target := auditPoolTarget(selected)
+			if actionErr = authorizePool(r, selected, RoleAdmin); actionErr == nil {
+				actionErr = ipamService.DeletePool(selected)
+			}
+			if actionErr == nil {
+				selected = 0
+				recordAudit(r, "pool.delete", target, "")
+			}
+		case "allocate":
+			req := AllocationRequest{Description: r.FormValue("description")}
+			target := strings.TrimSpace(r.FormValue("target"))
+			if n, err := strconv.Atoi(strings.TrimPrefix(target, "/")); err == nil {
+				req.Size = n
+			} else if strings.Contains(target, ".") {
+				req.Prefix = target
+			} else {
+				actionErr = fmt.Errorf("enter a prefix length such as /24 or a prefix such as 10.0.1.0/24")
+			}
+			if vlan := strings.TrimSpace(r.FormValue("vlan")); vlan != "" && actionErr == nil {
+				if req.VLAN, actionErr = strconv.Atoi(vlan); actionErr != nil {
+					actionErr = fmt.Errorf("vlan must be a number")
+				}
+			}
+			if actionErr == nil {
+				actionErr = authorizePool(r, selected, RoleOperator)
+			}
+			if actionErr == nil {
+				var allocation *IPAMAllocation
+				if allocation, actionErr = ipamService.Allocate(selected, req); actionErr == nil {
+					recordAudit(r, "allocation.create", allocationTarget(allocation), "pool %d, description %q", allocation.PoolID, allocation.Description)
+				}
+			}
+		case "release":
+			id, _ := strconv.ParseInt(r.FormValue("allocation"), 10, 64)
+			target := auditAllocationTarget(id)
+			if actionErr = authorizeAllocation(r, id, RoleOperator); actionErr == nil {
+				actionErr = ipamService.Release(id)
+			}
+			if actionErr == nil {
+				recordAudit(r, "allocation.release", target, "")
+			}
+		case "import-preview", "import":
+			// the result is shown on the page instead of redirecting
+			page.ImportCSV = r.FormValue("csv")
+			tenant := pageTenant(r, principal)
+			page.Tenant = tenant
+			if actionErr = principal.checkTarget(tenant, RoleAdmin); actionErr == nil {
+				page.Import, actionErr = importAddressPlan(ipamService, strings.NewReader(page.ImportCSV), tenant, r.FormValue("action") == "import-preview")
+			}
+			if actionErr == nil && !page.Import.DryRun {
+				recordImportAudit(r, page.Import)
+			}
+		case "discover-preview", "discover":
+			page.DiscoverReq = DiscoveryRequest{Target: r.FormValue("target"), Community: r.FormValue("community")}
+			if actionErr = principal.checkGlobal(RoleAdmin); actionErr == nil {
+				page.Discovery, actionErr = discoverDevice(r.Context(), ipamService, page.DiscoverReq, r.FormValue("action") == "discover-preview")
+			}
+			if actionErr == nil && !page.Discovery.DryRun {
+				recordDiscoveryAudit(r, page.Discovery)
+			}
+		default:
+			actionErr = fmt.Errorf("unknown action")
+		}
+
+		if actionErr == nil && page.Import == nil && page.Discovery == nil {
+			target := sitePath("/ipam")
+			if selected != 0 {
+				target += "?pool=" + strconv.FormatInt(selected, 10)
+			}
+			http.Redirect(w, r, target, http.StatusSeeOther)
+			return
+		}
+		if actionErr != nil {
+			page.Error = actionErr.Error()
+		}
+	}
+
+	page.Thresholds = ipamAlerts.Thresholds()
+	page.Alerts = visibleAlerts(principal, ipamAlerts.Recent())
+	if len(page.Alerts) > 10 {
+		page.Alerts = page.Alerts[:10]
+	}
+	pools, err := ipamService.Pools()
+	if err != nil {
+		page.Error = err.Error()
+	}
+	page.Pools = visiblePools(principal, pools, "")
+	for _, p := range page.Pools {
+		if p.ID == selected {
+			page.Selected = p
+			page.Allocations, _ = ipamService.Allocations(p.ID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, page); err != nil {
+		logRequestf(r.Context(), "Template execution error: %v", err)
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultUtilizationThresholds are the pool utilization percentages that raise an alert
+// when GO_SUBNET_CALCULATOR_IPAM_THRESHOLDS is not set
+var defaultUtilizationThresholds = []float64{80, 90, 100}
+
+// maxRecentAlerts bounds the alert history kept for /api/v1/ipam/alerts and the IPAM page
+const maxRecentAlerts = 100
+
+// webhookTimeout bounds every alert webhook delivery
+const webhookTimeout = 5 * time.Second
+
+// UtilizationAlert is raised when an allocation or release moves a pool across a threshold.
+// State is "raised" when utilization climbs to or above the threshold and "cleared" when it
+// drops back below it
+type UtilizationAlert struct {
+	PoolID      int64     `json:"pool_id"`
+	Tenant      string    `json:"tenant"`
+	Pool        string    `json:"pool"`
+	Prefix      string    `json:"prefix"`
+	Threshold   float64   `json:"threshold"`
+	State       string    `json:"state"`
+	Utilization float64   `json:"utilization"`
+	Allocated   uint64    `json:"allocated"`
+	Size        uint64    `json:"size"`
+	Allocations int       `json:"allocations"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+func (a UtilizationAlert) String() string {
+	return fmt.Sprintf("pool %q (%s) %s %.0f%% threshold: %.1f%% used, %d of %d addresses in %d allocations",
+		a.Pool, a.Prefix, a.State, a.Threshold, a.Utilization, a.Allocated, a.Size, a.Allocations)
+}
+
+// UtilizationAlerts checks pools against the configured thresholds, logs every crossing,
+// posts it to the optional webhook and keeps the most recent alerts
+type UtilizationAlerts struct {
+	mu         sync.Mutex
+	thresholds []float64
+	webhook    string
+	client     *http.Client
+	recent     []UtilizationAlert
+}
+
+func newUtilizationAlerts(thresholds []float64, webhook string) *UtilizationAlerts {
+	return &UtilizationAlerts{
+		thresholds: thresholds,
+		webhook:    webhook,
+		client:     &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// ipamAlerts receives the utilization changes of ipamService
+var ipamAlerts = newUtilizationAlerts(defaultUtilizationThresholds, "")
+
+// parseThresholds reads a comma-separated list of percentages such as "75,90,100"
+func parseThresholds(value string) ([]float64, error) {
+	var thresholds []float64
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSuffix(strings.TrimSpace(field), "%")
+		if field == "" {
+			continue
+		}
+		t, err := strconv.ParseFloat(field, 64)
+		if err != nil || t <= 0 || t > 100 {
+			return nil, fmt.Errorf("invalid utilization threshold %q, must be a percentage between 0 and 100", field)
+		}
+		thresholds = append(thresholds, t)
+	}
+	sort.Float64s(thresholds)
+	return thresholds, nil
+}
+
+// configureIPAMAlerts reads the thresholds from GO_SUBNET_CALCULATOR_IPAM_THRESHOLDS and
+// the webhook URL from the GO_SUBNET_CALCULATOR_IPAM_WEBHOOK secret
+func configureIPAMAlerts() error {
+	thresholds := defaultUtilizationThresholds
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_IPAM_THRESHOLDS"); value != "" {
+		var err error
+		if thresholds, err = parseThresholds(value); err != nil {
+			return err
+		}
+	}
+	webhook, err := loadSecret("GO_SUBNET_CALCULATOR_IPAM_WEBHOOK")
+	if err != nil {
+		return err
+	}
+	if webhook != "" && !strings.HasPrefix(webhook, "http://") && !strings.HasPrefix(webhook, "https://") {
+		return fmt.Errorf("GO_SUBNET_CALCULATOR_IPAM_WEBHOOK must be an http or https URL")
+	}
+	ipamAlerts = newUtilizationAlerts(thresholds, webhook)
+	recordSystemAudit("config.ipam_alerts", "", "thresholds %v, webhook configured: %t", thresholds, webhook != "")
+	return nil
+}
+
+// Thresholds returns the configured thresholds in ascending order
+func (u *UtilizationAlerts) Thresholds() []float64 {
+	return append([]float64(nil), u.thresholds...)
+}
+
+// Recent returns the latest alerts, newest first
+func (u *UtilizationAlerts) Recent() []UtilizationAlert {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	alerts := make([]UtilizationAlert, len(u.recent))
+	for i, a := range u.recent {
+		alerts[len(u.recent)-1-i] = a
+	}
+	return alerts
+}
+
+// Check compares the utilization of a pool before and after a change and raises an
+// alert for every threshold crossed in either direction
+func (u *UtilizationAlerts) Check(before float64, after *IPAMPool) []UtilizationAlert {
+	var alerts []UtilizationAlert
+	for _, t := range u.thresholds {
+		state := ""
+		switch {
+		case before < t && after.Utilization >= t:
+			state = "raised"
+		case before >= t && after.Utilization < t:
+			state = "cleared"
+		default:
+			continue
+		}
+		alerts = append(alerts, UtilizationAlert{
+			PoolID:      after.ID,
+			Tenant:      after.Tenant,
+			Pool:        after.Name,
+			Prefix:      after.Prefix,
+			Threshold:   t,
+			State:       state,
+			Utilization: after.Utilization,
+			Allocated:   after.Allocated,
+			Size:        after.Size,
+			Allocations: after.Allocations,
+			Timestamp:   time.Now().UTC(),
+		})
+	}
+
+	for _, alert := range alerts {
+		u.record(alert)
+	}
+	return alerts
+}
+
+// record logs an alert, keeps it in the history and delivers it to the webhook
+func (u *UtilizationAlerts) record(alert UtilizationAlert) {
+	log.Printf("IPAM utilization alert: %s", alert)
+
+	u.mu.Lock()
+	u.recent = append(u.recent, alert)
+	if len(u.recent) > maxRecentAlerts {
+		u.recent = u.recent[len(u.recent)-maxRecentAlerts:]
+	}
+	u.mu.Unlock()
+
+	if u.webhook != "" {
+		go func() {
+			if err := u.deliver(alert); err != nil {
+				log.Printf("IPAM alert webhook failed: %v", err)
+			}
+		}()
+	}
+}
+
+// deliver posts an alert to the webhook as JSON
+func (u *UtilizationAlerts) deliver(alert UtilizationAlert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	resp, err := u.client.Post(u.webhook, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// IPAMAlertsResponse lists the configured thresholds and the recent alerts
+type IPAMAlertsResponse struct {
+	Thresholds []float64          `json:"thresholds"`
+	Webhook    bool               `json:"webhook"`
+	Alerts     []UtilizationAlert `json:"alerts"`
+}
+
+// visibleAlerts keeps the alerts of pools in the tenants a principal can see
+func visibleAlerts(p *Principal, alerts []UtilizationAlert) []UtilizationAlert {
+	list := []UtilizationAlert{}
+	for _, alert := range alerts {
+		if p.sees(alert.Tenant) {
+			list = append(list, alert)
+		}
+	}
+	return list
+}
+
+// ipamAlertsHandler serves GET /api/v1/ipam/alerts
+func ipamAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, IPAMAlertsResponse{
+		Thresholds: ipamAlerts.Thresholds(),
+		Webhook:    ipamAlerts.webhook != "",
+		Alerts:     visibleAlerts(requestPrincipal(r), ipamAlerts.Recent()),
+	})
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withTestAlerts replaces the global alert configuration for the duration of a test
+func withTestAlerts(t *testing.T, thresholds []float64, webhook string) *UtilizationAlerts {
+	t.Helper()
+	previous := ipamAlerts
+	ipamAlerts = newUtilizationAlerts(thresholds, webhook)
+	t.Cleanup(func() { ipamAlerts = previous })
+	return ipamAlerts
+}
+
+func TestParseThresholds(t *testing.T) {
+	got, err := parseThresholds("90, 75%,100,")
+	if err != nil {
+		t.Fatalf("parseThresholds() unexpected error: %v", err)
+	}
+	if want := []float64{75, 90, 100}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseThresholds() = %v, want %v", got, want)
+	}
+
+	for _, value := range []string{"0", "101", "eighty", "-5"} {
+		if _, err := parseThresholds(value); err == nil {
+			t.Errorf("parseThresholds(%q) expected error", value)
+		}
+	}
+}
+
+func TestConfigureIPAMAlerts(t *testing.T) {
+	withTestAlerts(t, nil, "")
+	t.Setenv("GO_SUBNET_CALCULATOR_IPAM_THRESHOLDS", "50,95")
+	t.Setenv("GO_SUBNET_CALCULATOR_IPAM_WEBHOOK", "https://hooks.example.com/ipam")
+	if err := configureIPAMAlerts(); err != nil {
+		t.Fatalf("configureIPAMAlerts() unexpected error: %v", err)
+	}
+	if got := ipamAlerts.Thresholds(); !reflect.DeepEqual(got, []float64{50, 95}) {
+		t.Errorf("thresholds = %v, want [50 95]", got)
+	}
+	if ipamAlerts.webhook != "https://hooks.example.com/ipam" {
+		t.Errorf("webhook = %q", ipamAlerts.webhook)
+	}
+
+	t.Setenv("GO_SUBNET_CALCULATOR_IPAM_WEBHOOK", "ftp://example.com")
+	if err := configureIPAMAlerts(); err == nil {
+		t.Error("configureIPAMAlerts() should reject a non-HTTP webhook")
+	}
+}
+
+func TestUtilizationAlertsCheck(t *testing.T) {
+	alerts := newUtilizationAlerts([]float64{50, 75, 100}, "")
+	pool := &IPAMPool{ID: 1, Name: "dc1", Prefix: "10.0.0.0/24", Size: 256, Allocated: 192, Allocations: 2, Utilization: 75}
+
+	raised := alerts.Check(25, pool)
+	if len(raised) != 2 || raised[0].Threshold != 50 || raised[1].Threshold != 75 || raised[0].State != "raised" {
+		t.Fatalf("Check(25 -> 75) = %+v, want 50%% and 75%% raised", raised)
+	}
+	if raised[1].Allocations != 2 || raised[1].Allocated != 192 {
+		t.Errorf("alert usage = %+v", raised[1])
+	}
+
+	pool.Utilization = 60
+	cleared := alerts.Check(75, pool)
+	if len(cleared) != 1 || cleared[0].Threshold != 75 || cleared[0].State != "cleared" {
+		t.Errorf("Check(75 -> 60) = %+v, want 75%% cleared", cleared)
+	}
+
+	if got := alerts.Check(60, pool); len(got) != 0 {
+		t.Errorf("Check() without a crossing = %+v, want none", got)
+	}
+
+	recent := alerts.Recent()
+	if len(recent) != 3 || recent[0].State != "cleared" {
+		t.Errorf("Recent() = %+v, want newest first", recent)
+	}
+}
+
+func TestUtilizationAlertsHistoryLimit(t *testing.T) {
+	alerts := newUtilizationAlerts([]float64{50}, "")
+	pool := &IPAMPool{Name: "dc1"}
+	for i := 0; i < maxRecentAlerts+10; i++ {
+		pool.Utilization = 100
+		alerts.Check(0, pool)
+	}
+	if got := len(alerts.Recent()); got != maxRecentAlerts {
+		t.Errorf("len(Recent()) = %d, want %d", got, maxRecentAlerts)
+	}
+}
+
+func TestUtilizationAlertWebhook(t *testing.T) {
+	received := make(chan UtilizationAlert, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert UtilizationAlert
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("invalid webhook payload: %v", err)
+		}
+		received <- alert
+	}))
+	defer server.Close()
+
+	alerts := newUtilizationAlerts([]float64{90}, server.URL)
+	alerts.Check(80, &IPAMPool{ID: 7, Name: "edge", Prefix: "192.0.2.0/24", Utilization: 95})
+
+	select {
+	case alert := <-received:
+		if alert.PoolID != 7 || alert.Threshold != 90 || alert.State != "raised" {
+			t.Errorf("webhook received %+v", alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	alerts = newUtilizationAlerts([]float64{90}, failing.URL)
+	if err := alerts.deliver(UtilizationAlert{}); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("deliver() error = %v, want the webhook status", err)
+	}
+}
+
+func TestIPAMUtilizationAlerts(t *testing.T) {
+	alerts := withTestAlerts(t, []float64{50, 100}, "")
+	m := newIPAM(newMemoryIPAMStore())
+	pool, err := m.CreatePool(PoolRequest{Name: "lab", Prefix: "10.0.0.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := m.Allocate(pool.ID, AllocationRequest{Size: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := alerts.Recent(); len(got) != 1 || got[0].Threshold != 50 || got[0].State != "raised" {
+		t.Fatalf("alerts after the first /25 = %+v", got)
+	}
+	if _, err := m.Allocate(pool.ID, AllocationRequest{Size: 25}); err != nil {
+		t.Fatal(err)
+	}
+	if got := alerts.Recent(); len(got) != 2 || got[0].Threshold != 100 || got[0].Allocations != 2 {
+		t.Fatalf("alerts after the second /25 = %+v", got)
+	}
+
+	if err := m.Release(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	got := alerts.Recent()
+	if len(got) != 3 || got[0].Threshold != 100 || got[0].State != "cleared" || got[0].Utilization != 50 {
+		t.Errorf("alerts after releasing a /25 = %+v", got)
+	}
+
+	if err := m.Release(first.ID); err != errIPAMNotFound {
+		t.Errorf("Release() of an unknown allocation = %v, want errIPAMNotFound", err)
+	}
+
+	p, _ := m.Pool(pool.ID)
+	if p.Allocations != 1 {
+		t.Errorf("pool allocations = %d, want 1", p.Allocations)
+	}
+}
+
+func TestIPAMAlertsHandler(t *testing.T) {
+	alerts := withTestAlerts(t, []float64{80}, "")
+	alerts.Check(0, &IPAMPool{ID: 1, Name: "dc1", Utilization: 90})
+
+	rr := httptest.NewRecorder()
+	ipamAlertsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ipam/alerts", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rr.Code)
+	}
+	var resp IPAMAlertsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp.Thresholds, []float64{80}) || resp.Webhook || len(resp.Alerts) != 1 || resp.Alerts[0].Pool != "dc1" {
+		t.Errorf("response = %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	ipamAlertsHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ipam/alerts", nil))
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "GET" {
+		t.Errorf("POST status = %d, Allow = %q", rr.Code, rr.Header().Get("Allow"))
+	}
+}
@@ -0,0 +1,646 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+const (
+	// maxImportSize bounds the address plan of an asynchronous import, whose result
+	// stays in memory with the job
+	maxImportSize = 10 << 20
+	// defaultImportMaxBytes bounds the streamed synchronous import when
+	// GO_SUBNET_CALCULATOR_IMPORT_MAX_BYTES is not set
+	defaultImportMaxBytes = 1 << 30
+	// importSpillMemory is how much of each spill file of an import is kept in memory
+	importSpillMemory = 64 << 10
+)
+
+// importMaxBytes bounds the address plan of a synchronous import
+var importMaxBytes int64 = defaultImportMaxBytes
+
+// importColumns maps the accepted header names, including the phpIPAM export
+// headers, to the fields of an import row
+var importColumns = map[string]string{
+	"prefix":        "prefix",
+	"cidr":          "prefix",
+	"network":       "prefix",
+	"subnet":        "prefix",
+	"mask":          "mask",
+	"netmask":       "mask",
+	"bits":          "mask",
+	"description":   "description",
+	"descr":         "description",
+	"name":          "description",
+	"vlan":          "vlan",
+	"vlan id":       "vlan",
+	"vlanid":        "vlan",
+	"vlan number":   "vlan",
+	"pool":          "pool",
+	"master subnet": "pool",
+	"parent":        "pool",
+}
+
+// ImportRow is one line of an address plan and what the import does with it. Kind is
+// pool or allocation; Action is create, skip or error
+type ImportRow struct {
+	Line        int    `json:"line"`
+	Prefix      string `json:"prefix,omitempty"`
+	Kind        string `json:"kind,omitempty"`
+	Pool        string `json:"pool,omitempty"`
+	Description string `json:"description,omitempty"`
+	VLAN        int    `json:"vlan,omitempty"`
+	Action      string `json:"action"`
+	Message     string `json:"message,omitempty"`
+
+	network  *net.IPNet
+	poolName string
+}
+
+// ImportResult is the preview, or the outcome, of an address plan import
+type ImportResult struct {
+	DryRun  bool        `json:"dry_run"`
+	Rows    []ImportRow `json:"rows"`
+	Created int         `json:"created"`
+	Skipped int         `json:"skipped"`
+	Errors  int         `json:"errors"`
+}
+
+// readImportCSV parses a CSV address plan with a header row. Prefixes are given as
+// CIDR or as separate subnet and mask columns (the phpIPAM layout); the delimiter is
+// a comma or, as in many phpIPAM exports, a semicolon
+func readImportCSV(r io.Reader) ([]*ImportRow, error) {
+	var rows []*ImportRow
+	if err := scanImportCSV(r, func(row *ImportRow) error {
+		rows = append(rows, row)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// scanImportCSV reads an address plan like readImportCSV one record at a time,
+// calling fn with each row in the order of the plan
+func scanImportCSV(r io.Reader, fn func(*ImportRow) error) error {
+	buffered := bufio.NewReader(r)
+	peek, _ := buffered.Peek(buffered.Size())
+	if bytes.HasPrefix(peek, []byte("\ufeff")) {
+		buffered.Discard(len("\ufeff"))
+		peek = peek[len("\ufeff"):]
+	}
+	header, _, _ := bytes.Cut(peek, []byte("\n"))
+
+	reader := csv.NewReader(buffered)
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	names, err := reader.Read()
+	if err == io.EOF {
+		return fmt.Errorf("the address plan is empty")
+	}
+	if err != nil {
+		return fmt.Errorf("invalid CSV: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range names {
+		if field, ok := importColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			if _, seen := columns[field]; !seen {
+				columns[field] = i
+			}
+		}
+	}
+	if _, ok := columns["prefix"]; !ok {
+		return fmt.Errorf("no prefix column found; expected one of prefix, cidr, network or subnet")
+	}
+	value := func(record []string, field string) string {
+		if i, ok := columns[field]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid CSV: %w", err)
+		}
+		prefix := value(record, "prefix")
+		if prefix == "" && len(strings.Join(record, "")) == 0 {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		row := &ImportRow{Line: line, Description: value(record, "description"), poolName: value(record, "pool")}
+		row.Prefix = prefix
+		parseImportRow(row, prefix, value(record, "mask"), value(record, "vlan"))
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// parseImportRow fills in the network of a row from its prefix and optional mask,
+// and its VLAN, failing the row when they are invalid
+func parseImportRow(row *ImportRow, prefix, mask, vlan string) {
+	if mask = strings.TrimPrefix(mask, "/"); mask != "" && !strings.Contains(prefix, "/") {
+		if strings.Contains(mask, ".") {
+			m, err := parseSubnetMask(mask)
+			if err != nil {
+				row.fail("%v", err)
+				return
+			}
+			ones, _ := m.Size()
+			mask = strconv.Itoa(ones)
+		}
+		prefix += "/" + mask
+		row.Prefix = prefix
+	}
+
+	network, err := parseIPv4Prefix(prefix)
+	if err != nil {
+		row.fail("%v", err)
+		return
+	}
+	row.network = network
+	if network.String() != prefix {
+		row.Message = fmt.Sprintf("normalized from %s", prefix)
+		row.Prefix = network.String()
+	}
+	if vlan != "" && vlan != "0" {
+		if row.VLAN, err = strconv.Atoi(vlan); err != nil || validVLAN(row.VLAN) != nil {
+			row.fail("invalid VLAN %q", vlan)
+		}
+	}
+}
+
+func (r *ImportRow) fail(format string, args ...interface{}) {
+	r.Action = "error"
+	r.Message = fmt.Sprintf(format, args...)
+}
+
+func (r *ImportRow) skip(format string, args ...interface{}) {
+	r.Action = "skip"
+	r.Message = fmt.Sprintf(format, args...)
+}
+
+// importAddressPlan loads a CSV address plan into the IPAM. Rows not inside an existing
+// or imported pool become pools and the rows inside them allocations; a pool column
+// (phpIPAM "Master Subnet") names the pool explicitly by prefix or name. Prefixes
+// already in the IPAM are skipped, duplicates and overlaps are errors. New pools go to
+// tenant; rows inside another tenant's pool are errors. With dryRun the plan is only
+// previewed
+func importAddressPlan(m *IPAM, r io.Reader, tenant string, dryRun bool) (*ImportResult, error) {
+	rows := []ImportRow{}
+	result, err := streamImport(m, r, tenant, dryRun, func(row *ImportRow) error {
+		rows = append(rows, *row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Rows = rows
+	return result, nil
+}
+
+// spilledImportRow is a row of an import waiting in a spill file, with its position
+// in the plan
+type spilledImportRow struct {
+	N        int       `json:"n"`
+	Row      ImportRow `json:"row"`
+	PoolName string    `json:"pool_name,omitempty"`
+}
+
+// spillImportRow appends the nth row of a plan to a spill file
+func spillImportRow(s *spool, n int, row *ImportRow) error {
+	line, err := json.Marshal(spilledImportRow{N: n, Row: *row, PoolName: row.poolName})
+	if err != nil {
+		return err
+	}
+	_, err = s.Write(append(line, '\n'))
+	return err
+}
+
+// spilledRows reads the rows of a spill file back in the order they were written
+type spilledRows struct {
+	decoder *json.Decoder
+	next    spilledImportRow
+	ok      bool
+	err     error
+}
+
+func newSpilledRows(s *spool) *spilledRows {
+	rows := &spilledRows{decoder: json.NewDecoder(s.Reader())}
+	rows.advance()
+	return rows
+}
+
+// advance reads the next row; ok is false at the end or after an error
+func (rows *spilledRows) advance() {
+	rows.next = spilledImportRow{}
+	rows.err = rows.decoder.Decode(&rows.next)
+	rows.ok = rows.err == nil
+	if rows.err == io.EOF {
+		rows.err = nil
+	}
+	if rows.ok {
+		rows.next.Row.poolName = rows.next.PoolName
+		if rows.next.Row.Action == "" {
+			rows.next.Row.network, _ = parseIPv4Prefix(rows.next.Row.Prefix)
+		}
+	}
+}
+
+// streamImport runs an import like importAddressPlan but calls emit with every row,
+// in the order of the plan, instead of collecting them; the result has no Rows. The
+// plan is read once into spill files, one per prefix length so pools are planned
+// before the allocations inside them, and the decided rows are merged back in order,
+// so memory holds the pools and allocations of the plan but none of its rows. Errors
+// in the plan are returned before emit is first called
+func streamImport(m *IPAM, r io.Reader, tenant string, dryRun bool, emit func(*ImportRow) error) (*ImportResult, error) {
+	if err := validTenant(tenant, false); err != nil {
+		return nil, err
+	}
+	// byLength[l] holds the valid rows of prefix length l, failed the rows that are not
+	// valid, each in the order of the plan
+	var byLength [33]*spool
+	failed := &spool{limit: importSpillMemory}
+	defer func() {
+		failed.Close()
+		for _, s := range byLength {
+			if s != nil {
+				s.Close()
+			}
+		}
+	}()
+	n := 0
+	if err := scanImportCSV(r, func(row *ImportRow) error {
+		n++
+		if row.Action != "" {
+			return spillImportRow(failed, n, row)
+		}
+		ones, _ := row.network.Mask.Size()
+		if byLength[ones] == nil {
+			byLength[ones] = &spool{limit: importSpillMemory}
+		}
+		return spillImportRow(byLength[ones], n, row)
+	}); err != nil {
+		return nil, err
+	}
+
+	pools, err := m.Pools()
+	if err != nil {
+		return nil, err
+	}
+	type plannedPool struct {
+		network   *net.IPNet
+		id        int64
+		name      string
+		tenant    string
+		allocated *prefixIndex
+	}
+	var planned []*plannedPool
+	plannedNets := cidrset.NewIndex[*plannedPool]()
+	for _, pool := range pools {
+		network, err := parseIPv4Prefix(pool.Prefix)
+		if err != nil {
+			continue
+		}
+		p := &plannedPool{network: network, id: pool.ID, name: pool.Name, tenant: pool.Tenant, allocated: newPrefixIndex()}
+		allocations, err := m.Allocations(pool.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range allocations {
+			if n, err := parseIPv4Prefix(a.Prefix); err == nil {
+				p.allocated.InsertPrefix(n, n)
+			}
+		}
+		planned = append(planned, p)
+		plannedNets.InsertPrefix(network, p)
+	}
+	findPool := func(key string) *plannedPool {
+		for _, p := range planned {
+			if p.tenant == tenant && (p.network.String() == key || strings.EqualFold(p.name, key)) {
+				return p
+			}
+		}
+		if n, err := parseIPv4Prefix(key); err == nil {
+			for _, p := range planned {
+				if p.tenant == tenant && p.network.String() == n.String() {
+					return p
+				}
+			}
+		}
+		return nil
+	}
+
+	seen := map[cidrset.Range]int{}
+	decide := func(row *ImportRow) {
+		if line, ok := seen[cidrset.PrefixToRange(row.network)]; ok {
+			row.fail("duplicate of line %d", line)
+			return
+		}
+		seen[cidrset.PrefixToRange(row.network)] = row.Line
+
+		var pool *plannedPool
+		if row.poolName != "" {
+			if pool = findPool(row.poolName); pool == nil {
+				row.fail("unknown pool %q", row.poolName)
+				return
+			}
+			if !prefixContains(pool.network, row.network) {
+				row.fail("%s is not inside pool %s", row.Prefix, pool.network)
+				return
+			}
+		}
+		// Pools never overlap, so a row overlaps at most the one pool containing it
+		// or the pools inside it
+		overlap, overlaps := plannedNets.OverlapPrefix(row.network)
+		if pool == nil && overlaps && prefixContains(overlap.Value.network, row.network) {
+			pool = overlap.Value
+		}
+
+		if pool == nil {
+			row.Kind = "pool"
+			if row.VLAN != 0 {
+				row.Message = "VLAN ignored for pools"
+			}
+			if overlaps {
+				row.fail("overlaps pool %s", overlap.Value.network)
+				return
+			}
+			name := row.Description
+			if name == "" {
+				name = row.Prefix
+			}
+			p := &plannedPool{network: row.network, name: name, tenant: tenant, allocated: newPrefixIndex()}
+			if !dryRun {
+				created, err := m.CreatePool(PoolRequest{Tenant: tenant, Name: name, Prefix: row.Prefix, Description: row.Description})
+				if err != nil {
+					row.fail("%v", err)
+					return
+				}
+				p.id = created.ID
+			}
+			planned = append(planned, p)
+			plannedNets.InsertPrefix(row.network, p)
+			row.Action = "create"
+			return
+		}
+
+		if pool.tenant != tenant {
+			row.fail("inside a pool of another tenant")
+			return
+		}
+		row.Kind = "allocation"
+		row.Pool = pool.network.String()
+		if pool.network.String() == row.Prefix {
+			row.Kind = "pool"
+			row.skip("pool already exists")
+			return
+		}
+		if other := overlappingPrefix(pool.allocated, row.network); other != nil {
+			if other.String() == row.Prefix {
+				row.skip("already allocated")
+			} else {
+				row.fail("overlaps allocation %s", other)
+			}
+			return
+		}
+		if !dryRun {
+			if _, err := m.Allocate(pool.id, AllocationRequest{Prefix: row.Prefix, Description: row.Description, VLAN: row.VLAN}); err != nil {
+				row.fail("%v", err)
+				return
+			}
+		}
+		pool.allocated.InsertPrefix(row.network, row.network)
+		row.Action = "create"
+	}
+
+	// Shorter prefixes first, so pools are planned before the allocations inside them
+	streams := []*spilledRows{newSpilledRows(failed)}
+	for ones, s := range byLength {
+		if s == nil {
+			continue
+		}
+		decided := &spool{limit: importSpillMemory}
+		defer decided.Close()
+		for rows := newSpilledRows(s); rows.ok || rows.err != nil; rows.advance() {
+			if rows.err != nil {
+				return nil, rows.err
+			}
+			decide(&rows.next.Row)
+			if err := spillImportRow(decided, rows.next.N, &rows.next.Row); err != nil {
+				return nil, err
+			}
+		}
+		s.Close()
+		byLength[ones] = nil
+		streams = append(streams, newSpilledRows(decided))
+	}
+
+	result := &ImportResult{DryRun: dryRun}
+	for {
+		var first *spilledRows
+		for _, rows := range streams {
+			if rows.err != nil {
+				return nil, rows.err
+			}
+			if rows.ok && (first == nil || rows.next.N < first.next.N) {
+				first = rows
+			}
+		}
+		if first == nil {
+			return result, nil
+		}
+		row := &first.next.Row
+		switch row.Action {
+		case "create":
+			result.Created++
+		case "skip":
+			result.Skipped++
+		default:
+			result.Errors++
+		}
+		if err := emit(row); err != nil {
+			return nil, err
+		}
+		first.advance()
+	}
+}
+
+// ipamImportHandler serves POST /api/v1/ipam/import with a CSV address plan as the body.
+// ?dry_run=true returns the preview without changing anything; ?tenant= picks the
+// tenant of new pools. With ?async=true the import runs as a job
+func ipamImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "dry_run must be true or false")
+			return
+		}
+	}
+
+	principal := requestPrincipal(r)
+	tenant := r.URL.Query().Get("tenant")
+	if tenant == "" {
+		tenant = principal.homeTenant()
+	}
+	if err := principal.checkTarget(tenant, RoleAdmin); err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	async, ok := asyncRequested(w, r)
+	if !ok {
+		return
+	}
+	if async {
+		plan, err := newSpool(http.MaxBytesReader(w, r.Body, maxImportSize))
+		if err != nil {
+			writeImportReadError(w, err)
+			return
+		}
+		queued := submitJob(w, r, "import", 0, func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+			defer plan.Close()
+			var result *ImportResult
+			var err error
+			if poolErr := batchPool.run(ctx, func() {
+				result, err = importAddressPlan(ipamService, plan.Reader(), tenant, dryRun)
+			}); poolErr != nil {
+				return nil, poolErr
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !result.DryRun {
+				recordImportAudit(r, result)
+			}
+			return result, nil
+		})
+		if !queued {
+			plan.Close()
+		}
+		return
+	}
+	// The rows are written as they are decided, so the response holds the plan's rows
+	// in the shape of an ImportResult without keeping them in memory
+	body := io.Reader(r.Body)
+	if importMaxBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, importMaxBytes)
+	}
+	started := false
+	var result *ImportResult
+	var err error
+	if poolErr := batchPool.run(r.Context(), func() {
+		result, err = streamImport(ipamService, body, tenant, dryRun, func(row *ImportRow) error {
+			line, err := json.Marshal(row)
+			if err != nil {
+				return err
+			}
+			if !started {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintf(w, `{"dry_run":%t,"rows":[`, dryRun)
+				started = true
+			} else {
+				io.WriteString(w, ",")
+			}
+			if !dryRun && row.Action == "create" {
+				recordImportRowAudit(r, row)
+			}
+			_, err = w.Write(line)
+			return err
+		})
+	}); poolErr != nil {
+		err = poolErr
+	}
+	if err != nil {
+		if started {
+			log.Printf("import stopped after the response started: %v", err)
+			return
+		}
+		writeImportReadError(w, err)
+		return
+	}
+	if !result.DryRun {
+		recordAudit(r, "import.csv", "", "%d created, %d skipped, %d errors", result.Created, result.Skipped, result.Errors)
+	}
+	if !started {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"dry_run":%t,"rows":[`, dryRun)
+	}
+	fmt.Fprintf(w, "],\"created\":%d,\"skipped\":%d,\"errors\":%d}\n", result.Created, result.Skipped, result.Errors)
+}
+
+// writeImportReadError answers a failed import, telling oversized plans apart
+func writeImportReadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("address plan is larger than %d bytes", tooLarge.Limit))
+		return
+	}
+	writeIPAMError(w, err)
+}
+
+// recordImportAudit records every prefix an applied import created, then the import
+func recordImportAudit(r *http.Request, result *ImportResult) {
+	for i := range result.Rows {
+		if result.Rows[i].Action == "create" {
+			recordImportRowAudit(r, &result.Rows[i])
+		}
+	}
+	recordAudit(r, "import.csv", "", "%d created, %d skipped, %d errors", result.Created, result.Skipped, result.Errors)
+}
+
+// recordImportRowAudit records a prefix created by an import
+func recordImportRowAudit(r *http.Request, row *ImportRow) {
+	recordAudit(r, row.Kind+".create", row.Prefix, "imported from line %d", row.Line)
+}
+
+// configureImport reads GO_SUBNET_CALCULATOR_IMPORT_MAX_BYTES, the largest address
+// plan a synchronous import accepts (default 1 GiB, 0 for no limit). Asynchronous
+// imports keep their result with the job and stay limited to 10 MB
+func configureImport() error {
+	importMaxBytes = defaultImportMaxBytes
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_IMPORT_MAX_BYTES"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_IMPORT_MAX_BYTES must be a number of bytes, or 0 for no limit, got %q", value)
+		}
+		importMaxBytes = n
+	}
+	if importMaxBytes == 0 {
+		recordSystemAudit("config.import_limit", "", "synchronous address plans of any size")
+	} else {
+		recordSystemAudit("config.import_limit", "", "synchronous address plans up to %d bytes", importMaxBytes)
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestReadImportCSV(t *testing.T) {
+	tests := []struct {
+		name       string
+		csv        string
+		wantPrefix []string
+		wantErrors int
+	}{
+		{
+			name:       "generic",
+			csv:        "prefix,description,vlan\n10.0.0.0/16,dc1,\n10.0.1.0/24,web,110\n",
+			wantPrefix: []string{"10.0.0.0/16", "10.0.1.0/24"},
+		},
+		{
+			name:       "phpipam semicolon export with separate mask",
+			csv:        "\ufeffSection;Subnet;Mask;Description;VLAN;Master Subnet\nDC;10.0.0.0;16;dc1;;\nDC;10.0.1.0;255.255.255.0;web;110;10.0.0.0/16\n",
+			wantPrefix: []string{"10.0.0.0/16", "10.0.1.0/24"},
+		},
+		{
+			name:       "host bits are normalized",
+			csv:        "cidr\n10.0.1.7/24\n",
+			wantPrefix: []string{"10.0.1.0/24"},
+		},
+		{
+			name:       "invalid rows are kept with an error",
+			csv:        "subnet,mask,vlan\nnot-an-ip,24,\n10.0.0.0,255.0.255.0,\n10.0.0.0,24,5000\n\n",
+			wantPrefix: []string{"not-an-ip/24", "10.0.0.0", "10.0.0.0/24"},
+			wantErrors: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readImportCSV(strings.NewReader(tt.csv))
+			if err != nil {
+				t.Fatalf("readImportCSV() unexpected error: %v", err)
+			}
+			var prefixes []string
+			errors := 0
+			for _, r := range rows {
+				prefixes = append(prefixes, r.Prefix)
+				if r.Action == "error" {
+					errors++
+				}
+			}
+			if strings.Join(prefixes, " ") != strings.Join(tt.wantPrefix, " ") || errors != tt.wantErrors {
+				t.Errorf("readImportCSV() = %v with %d errors, want %v with %d", prefixes, errors, tt.wantPrefix, tt.wantErrors)
+			}
+		})
+	}
+
+	// Rows keep their line in the file across blank lines
+	rows, err := readImportCSV(strings.NewReader("prefix\n10.0.0.0/16\n\n\n10.0.1.0/24\n"))
+	if err != nil || len(rows) != 2 || rows[0].Line != 2 || rows[1].Line != 5 {
+		t.Errorf("readImportCSV() with blank lines = %v, %v", rows, err)
+	}
+
+	for _, bad := range []string{"", "description,vlan\nweb,10\n", "prefix\n\"unterminated\n"} {
+		if _, err := readImportCSV(strings.NewReader(bad)); err == nil {
+			t.Errorf("readImportCSV(%q) expected error", bad)
+		}
+	}
+}
+
+func TestImportAddressPlan(t *testing.T) {
+	m := newIPAM(newMemoryIPAMStore())
+	existing, _ := m.CreatePool(PoolRequest{Name: "legacy", Prefix: "192.168.0.0/16"})
+	m.Allocate(existing.ID, AllocationRequest{Prefix: "192.168.1.0/24"})
+
+	plan := strings.Join([]string{
+		"prefix,description,vlan,pool",
+		"10.0.1.0/24,web,110,",    // 2: allocation in the imported pool
+		"10.0.0.0/16,dc1,,",       // 3: new pool
+		"10.0.1.0/24,web again,,", // 4: duplicate
+		"192.168.1.0/24,,,",       // 5: already allocated
+		"192.168.2.0/24,lab,,",    // 6: allocation in the existing pool
+		"10.0.1.128/25,nested,,",  // 7: overlaps line 2
+		"192.0.0.0/8,too big,,",   // 8: overlaps the existing pool
+		"10.0.2.0/24,db,,legacy",  // 9: not inside the named pool
+		"10.0.3.0/24,,,nowhere",   // 10: unknown pool
+		"10.0.4.0/24,mgmt,,dc1",   // 11: pool named by its imported name
+		"192.168.0.0/16,legacy,,", // 12: existing pool
+		"172.16.0.0/12,,300,",     // 13: new pool, VLAN ignored
+		"bogus,,,",                // 14: invalid
+	}, "\n")
+
+	preview, err := importAddressPlan(m, strings.NewReader(plan), defaultTenant, true)
+	if err != nil {
+		t.Fatalf("importAddressPlan() unexpected error: %v", err)
+	}
+	want := map[int]string{
+		2: "create allocation", 3: "create pool", 4: "error", 5: "skip allocation", 6: "create allocation",
+		7: "error allocation", 8: "error pool", 9: "error", 10: "error", 11: "create allocation",
+		12: "skip pool", 13: "create pool", 14: "error",
+	}
+	for _, row := range preview.Rows {
+		got := strings.TrimSpace(row.Action + " " + row.Kind)
+		if got != want[row.Line] {
+			t.Errorf("line %d: %s %s (%s), want %s", row.Line, row.Action, row.Kind, row.Message, want[row.Line])
+		}
+	}
+	if preview.Created != 5 || preview.Skipped != 2 || preview.Errors != 6 || !preview.DryRun {
+		t.Errorf("preview totals = %d/%d/%d", preview.Created, preview.Skipped, preview.Errors)
+	}
+	if pools, _ := m.Pools(); len(pools) != 1 {
+		t.Fatalf("preview must not change the IPAM, got %d pools", len(pools))
+	}
+
+	result, err := importAddressPlan(m, strings.NewReader(plan), defaultTenant, false)
+	if err != nil || result.Created != 5 {
+		t.Fatalf("importAddressPlan() = %+v, %v", result, err)
+	}
+	pools, _ := m.Pools()
+	// shorter prefixes are imported first
+	if len(pools) != 3 || pools[1].Name != "172.16.0.0/12" || pools[2].Name != "dc1" {
+		t.Fatalf("pools after import = %v, %v, %v", pools[0].Name, pools[1].Name, pools[2].Name)
+	}
+	allocations, _ := m.Allocations(pools[2].ID)
+	if len(allocations) != 2 || allocations[0].Prefix != "10.0.1.0/24" || allocations[0].VLAN != 110 || allocations[1].Description != "mgmt" {
+		t.Errorf("dc1 allocations = %+v", allocations)
+	}
+
+	again, _ := importAddressPlan(m, strings.NewReader(plan), defaultTenant, false)
+	if again.Created != 0 {
+		t.Errorf("re-import created %d prefixes, want 0", again.Created)
+	}
+}
+
+func TestIPAMImportHandler(t *testing.T) {
+	withTestIPAM(t)
+
+	post := func(target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		ipamImportHandler(rr, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		return rr
+	}
+
+	rr := post("/api/v1/ipam/import?dry_run=true", "prefix\n10.0.0.0/8\n")
+	var result ImportResult
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil || rr.Code != http.StatusOK || !result.DryRun || result.Created != 1 {
+		t.Fatalf("dry run = %d %+v", rr.Code, result)
+	}
+	if rr = post("/api/v1/ipam/import", "prefix\n10.0.0.0/8\n"); rr.Code != http.StatusOK {
+		t.Fatalf("import = %d: %s", rr.Code, rr.Body)
+	}
+	if pools, _ := ipamService.Pools(); len(pools) != 1 {
+		t.Errorf("pools after import = %+v", pools)
+	}
+
+	if rr = post("/api/v1/ipam/import", "name\nx\n"); rr.Code != http.StatusBadRequest {
+		t.Errorf("import without a prefix column = %d, want 400", rr.Code)
+	}
+	if rr = post("/api/v1/ipam/import?dry_run=perhaps", "prefix\n"); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid dry_run = %d, want 400", rr.Code)
+	}
+	previous := importMaxBytes
+	importMaxBytes = 64
+	t.Cleanup(func() { importMaxBytes = previous })
+	if rr = post("/api/v1/ipam/import", strings.Repeat("x", 65)); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized import = %d, want 413", rr.Code)
+	}
+	if rr = post("/api/v1/ipam/import?async=true", strings.Repeat("x", maxImportSize+1)); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized asynchronous import = %d, want 413", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	ipamImportHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ipam/import", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET = %d, want 405", rr.Code)
+	}
+}
+
+func TestIPAMImportStreaming(t *testing.T) {
+	withTestIPAM(t)
+	withTestAudit(t)
+
+	// Enough rows to spill to disk; the pool comes last but is planned first
+	var plan strings.Builder
+	plan.WriteString("prefix\n")
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&plan, "10.%d.%d.0/24\n", i/256, i%256)
+	}
+	plan.WriteString("10.0.0.1/33\n10.0.0.0/8\n")
+
+	rr := httptest.NewRecorder()
+	ipamImportHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ipam/import", strings.NewReader(plan.String())))
+	var result ImportResult
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("import = %d, %v", rr.Code, err)
+	}
+	if len(result.Rows) != 5002 || result.Created != 5001 || result.Errors != 1 {
+		t.Fatalf("import = %d rows, %d created, %d errors", len(result.Rows), result.Created, result.Errors)
+	}
+	for i, row := range result.Rows[:5000] {
+		if row.Line != i+2 || row.Action != "create" || row.Pool != "10.0.0.0/8" {
+			t.Fatalf("row %d = %+v", i, row)
+		}
+	}
+	if result.Rows[5000].Action != "error" || result.Rows[5001].Kind != "pool" {
+		t.Errorf("last rows = %+v", result.Rows[5000:])
+	}
+	if pools, _ := ipamService.Pools(); len(pools) != 1 {
+		t.Fatalf("pools after import = %+v", pools)
+	}
+	if allocations, _ := ipamService.Allocations(1); len(allocations) != 5000 {
+		t.Errorf("%d allocations, want 5000", len(allocations))
+	}
+}
+
+func TestConfigureImport(t *testing.T) {
+	withTestAudit(t)
+	previous := importMaxBytes
+	t.Cleanup(func() { importMaxBytes = previous })
+
+	t.Setenv("GO_SUBNET_CALCULATOR_IMPORT_MAX_BYTES", "0")
+	if err := configureImport(); err != nil || importMaxBytes != 0 {
+		t.Errorf("configureImport() = %v, limit %d", err, importMaxBytes)
+	}
+	t.Setenv("GO_SUBNET_CALCULATOR_IMPORT_MAX_BYTES", "-1")
+	if err := configureImport(); err == nil {
+		t.Error("a negative limit must be refused")
+	}
+}
+
+func TestIPAMPageImport(t *testing.T) {
+	withTestIPAM(t)
+	plan := "prefix,description\n10.8.0.0/16,branch\n10.8.1.0/24,users\n"
+
+	post := func(action string) string {
+		form := url.Values{"action": {action}, "csv": {plan}}
+		req := httptest.NewRequest(http.MethodPost, "/ipam", strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		ipamPageHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s = %d", action, rr.Code)
+		}
+		return rr.Body.String()
+	}
+
+	body := post("import-preview")
+	for _, want := range []string{"Import Preview", "2 to create", "Import 2 Prefixes", "allocation in 10.8.0.0/16"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("preview missing %q", want)
+		}
+	}
+	if pools, _ := ipamService.Pools(); len(pools) != 0 {
+		t.Fatal("preview must not import")
+	}
+
+	if body = post("import"); !strings.Contains(body, "Import Result") {
+		t.Error("import should show the result")
+	}
+	if pools, _ := ipamService.Pools(); len(pools) != 1 || pools[0].Allocations != 1 {
+		t.Errorf("pools after import = %+v", pools)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultMapBits splits a pool into 2^8 = 256 cells; maxMapBits allows up to 4096
+	defaultMapBits = 8
+	maxMapBits     = 12
+	// mapCellPixels is the size of one cell of the map, and mapHeaderPixels the space
+	// above the grid for the title and legend
+	mapCellPixels   = 16
+	mapHeaderPixels = 40
+)
+
+// Heat map colors: free cells are pale green, used cells go from amber to red as they fill
+var (
+	mapFreeColor = color.RGBA{0xe8, 0xf5, 0xe9, 0xff}
+	mapLowColor  = color.RGBA{0xff, 0xe0, 0x82, 0xff}
+	mapFullColor = color.RGBA{0xc6, 0x28, 0x28, 0xff}
+)
+
+// MapCell is one equally sized block of a pool and how much of it is allocated
+type MapCell struct {
+	Prefix      string   `json:"prefix"`
+	Size        uint64   `json:"size"`
+	Allocated   uint64   `json:"allocated"`
+	Allocations []string `json:"allocations,omitempty"`
+}
+
+// UtilizationMap splits a pool into 2^Bits cells laid out as a grid of Columns, in
+// address order from the top left
+type UtilizationMap struct {
+	Pool    *IPAMPool `json:"pool"`
+	Bits    int       `json:"bits"`
+	Columns int       `json:"columns"`
+	Rows    int       `json:"rows"`
+	Cells   []MapCell `json:"cells"`
+}
+
+// buildUtilizationMap splits pool into 2^bits cells, fewer when the pool is too small,
+// and adds the overlap of every allocation to the cells it covers
+func buildUtilizationMap(pool *IPAMPool, allocations []*IPAMAllocation, bits int) (*UtilizationMap, error) {
+	network, err := parseIPv4Prefix(pool.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	ones, _ := network.Mask.Size()
+	bits = min(bits, 32-ones)
+	cellBits := uint(32 - ones - bits)
+	base := ipToUint32(network.IP)
+
+	m := &UtilizationMap{Pool: pool, Bits: bits, Columns: 1 << uint((bits+1)/2), Rows: 1 << uint(bits/2)}
+	m.Cells = make([]MapCell, 1<<uint(bits))
+	for i := range m.Cells {
+		start := base + uint32(i)<<cellBits
+		m.Cells[i].Prefix = uint32ToIP(start).String() + "/" + strconv.Itoa(ones+bits)
+		m.Cells[i].Size = uint64(1) << cellBits
+	}
+	for _, a := range allocations {
+		n, err := parseIPv4Prefix(a.Prefix)
+		if err != nil || !prefixContains(network, n) {
+			continue
+		}
+		first, last := prefixBounds(n)
+		label := a.Prefix
+		if a.Description != "" {
+			label += " " + a.Description
+		}
+		for i := (first - base) >> cellBits; i <= (last-base)>>cellBits; i++ {
+			cellFirst := base + i<<cellBits
+			cellLast := cellFirst + uint32(m.Cells[i].Size-1)
+			m.Cells[i].Allocated += uint64(min(last, cellLast)-max(first, cellFirst)) + 1
+			m.Cells[i].Allocations = append(m.Cells[i].Allocations, label)
+		}
+	}
+	return m, nil
+}
+
+// heatColor is the color of a cell with the given fraction allocated
+func heatColor(fraction float64) color.RGBA {
+	if fraction <= 0 {
+		return mapFreeColor
+	}
+	mix := func(a, b uint8) uint8 { return uint8(float64(a) + (float64(b)-float64(a))*fraction) }
+	return color.RGBA{mix(mapLowColor.R, mapFullColor.R), mix(mapLowColor.G, mapFullColor.G), mix(mapLowColor.B, mapFullColor.B), 0xff}
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// fraction returns how much of a cell is allocated, from 0 to 1
+func (c MapCell) fraction() float64 {
+	return float64(c.Allocated) / float64(c.Size)
+}
+
+// writeMapSVG draws the map with the pool and its utilization on top and a tooltip
+// per cell listing its prefix and allocations
+func writeMapSVG(w io.Writer, m *UtilizationMap) {
+	width := max(m.Columns*mapCellPixels, 360)
+	height := mapHeaderPixels + m.Rows*mapCellPixels
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Arial, sans-serif" font-size="12">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(w, `<text x="0" y="14" font-weight="bold">%s (%s): %.1f%% allocated</text>`+"\n",
+		xlsxEscape(m.Pool.Name), xlsxEscape(m.Pool.Prefix), m.Pool.Utilization)
+	legend := []struct {
+		label string
+		color color.RGBA
+	}{{"free", mapFreeColor}, {"partly used", heatColor(0.5)}, {"full", mapFullColor}}
+	for i, l := range legend {
+		x := i * 100
+		fmt.Fprintf(w, `<rect x="%d" y="22" width="12" height="12" fill="%s" stroke="#999"/><text x="%d" y="32">%s</text>`+"\n",
+			x, hexColor(l.color), x+16, l.label)
+	}
+	for i, c := range m.Cells {
+		x, y := (i%m.Columns)*mapCellPixels, mapHeaderPixels+(i/m.Columns)*mapCellPixels
+		title := fmt.Sprintf("%s: %.0f%% allocated", c.Prefix, c.fraction()*100)
+		if len(c.Allocations) > 0 {
+			title += "\n" + strings.Join(c.Allocations, "\n")
+		}
+		fmt.Fprintf(w, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="#fff"><title>%s</title></rect>`+"\n",
+			x, y, mapCellPixels, mapCellPixels, hexColor(heatColor(c.fraction())), xlsxEscape(title))
+	}
+	fmt.Fprintln(w, "</svg>")
+}
+
+// writeMapPNG draws the cells of the map as a PNG image, without text
+func writeMapPNG(w io.Writer, m *UtilizationMap) error {
+	img := image.NewRGBA(image.Rect(0, 0, m.Columns*mapCellPixels, m.Rows*mapCellPixels))
+	for i, c := range m.Cells {
+		x, y := (i%m.Columns)*mapCellPixels, (i/m.Columns)*mapCellPixels
+		fill := heatColor(c.fraction())
+		for dy := 0; dy < mapCellPixels; dy++ {
+			for dx := 0; dx < mapCellPixels; dx++ {
+				if dx == mapCellPixels-1 || dy == mapCellPixels-1 {
+					img.SetRGBA(x+dx, y+dy, color.RGBA{0xff, 0xff, 0xff, 0xff})
+				} else {
+					img.SetRGBA(x+dx, y+dy, fill)
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// poolUtilizationMap loads the map of a pool the request may view. The bits
+// parameter sets the number of cells
+func poolUtilizationMap(r *http.Request, id int64) (*UtilizationMap, error) {
+	bits := defaultMapBits
+	if value := r.URL.Query().Get("bits"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > maxMapBits {
+			return nil, fmt.Errorf("bits must be a number from 0 to %d", maxMapBits)
+		}
+		bits = n
+	}
+	if err := authorizePool(r, id, RoleViewer); err != nil {
+		return nil, err
+	}
+	pool, err := ipamService.Pool(id)
+	if err != nil {
+		return nil, err
+	}
+	allocations, err := ipamService.Allocations(id)
+	if err != nil {
+		return nil, err
+	}
+	return buildUtilizationMap(pool, allocations, bits)
+}
+
+// writeUtilizationMap answers with the map of a pool as an SVG or PNG image or as JSON
+func writeUtilizationMap(w http.ResponseWriter, r *http.Request, id int64) {
+	m, err := poolUtilizationMap(r, id)
+	if err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	switch responseFormat(r, "svg") {
+	case "json":
+		writeJSON(w, http.StatusOK, m)
+	case "png":
+		w.Header().Set("Content-Type", "image/png")
+		writeMapPNG(w, m)
+	default:
+		w.Header().Set("Content-Type", "image/svg+xml")
+		writeMapSVG(w, m)
+	}
+}
+
+// ipamPoolMapHandler serves GET /api/v1/ipam/pools/{id}/map, a heat map of the
+// allocated and free space of a pool
+func ipamPoolMapHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	writeUtilizationMap(w, r, id)
+}
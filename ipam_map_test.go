@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBuildUtilizationMap(t *testing.T) {
+	pool := &IPAMPool{Name: "lab", Prefix: "192.168.0.0/22"}
+	allocations := []*IPAMAllocation{
+		{Prefix: "192.168.0.0/23", Description: "servers"},
+		{Prefix: "192.168.2.0/25"},
+		{Prefix: "10.0.0.0/24"},
+	}
+	m, err := buildUtilizationMap(pool, allocations, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Columns != 2 || m.Rows != 2 || len(m.Cells) != 4 {
+		t.Fatalf("grid = %dx%d with %d cells, want 2x2 with 4", m.Columns, m.Rows, len(m.Cells))
+	}
+	want := []struct {
+		prefix    string
+		allocated uint64
+	}{{"192.168.0.0/24", 256}, {"192.168.1.0/24", 256}, {"192.168.2.0/24", 128}, {"192.168.3.0/24", 0}}
+	for i, w := range want {
+		if c := m.Cells[i]; c.Prefix != w.prefix || c.Allocated != w.allocated {
+			t.Errorf("cell %d = %s with %d allocated, want %s with %d", i, c.Prefix, c.Allocated, w.prefix, w.allocated)
+		}
+	}
+	if got := m.Cells[1].Allocations; len(got) != 1 || got[0] != "192.168.0.0/23 servers" {
+		t.Errorf("cell 1 allocations = %v", got)
+	}
+
+	// a /30 has only four addresses, so it is not split further than that
+	if m, _ = buildUtilizationMap(&IPAMPool{Prefix: "10.0.0.0/30"}, nil, 8); m.Bits != 2 || len(m.Cells) != 4 {
+		t.Errorf("/30 map = %d bits with %d cells, want 2 and 4", m.Bits, len(m.Cells))
+	}
+}
+
+func TestHeatColor(t *testing.T) {
+	if heatColor(0) != mapFreeColor || heatColor(1) != mapFullColor {
+		t.Errorf("heatColor(0), heatColor(1) = %v, %v", heatColor(0), heatColor(1))
+	}
+	if c := heatColor(0.5); c.G >= mapLowColor.G || c.G <= mapFullColor.G {
+		t.Errorf("heatColor(0.5) = %v, want between amber and red", c)
+	}
+}
+
+func TestIPAMPoolMapHandler(t *testing.T) {
+	m := withTestIPAM(t)
+	pool, _ := m.CreatePool(PoolRequest{Name: "campus", Prefix: "10.20.0.0/16"})
+	m.Allocate(pool.ID, AllocationRequest{Size: 18})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/ipam/pools/{id}/map", ipamPoolMapHandler)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/ipam/pools/%d/map%s", pool.ID, query), nil))
+		return rr
+	}
+
+	rr := get("")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("SVG status = %d, Content-Type %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if err := xml.Unmarshal(rr.Body.Bytes(), new(struct{})); err != nil {
+		t.Errorf("invalid SVG: %v", err)
+	}
+	if !strings.Contains(rr.Body.String(), "25.0% allocated") {
+		t.Errorf("SVG does not show the utilization:\n%s", rr.Body.String()[:200])
+	}
+
+	rr = get("?format=png&bits=4")
+	img, err := png.Decode(rr.Body)
+	if err != nil {
+		t.Fatalf("invalid PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 4*mapCellPixels || b.Dy() != 4*mapCellPixels {
+		t.Errorf("PNG size = %v, want a 4x4 grid", b)
+	}
+
+	var resp UtilizationMap
+	if err := json.Unmarshal(get("?format=json&bits=2").Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Cells) != 4 || resp.Cells[0].Allocated != 16384 || resp.Cells[1].Allocated != 0 {
+		t.Errorf("JSON cells = %+v", resp.Cells)
+	}
+
+	if rr := get("?bits=13"); rr.Code != http.StatusBadRequest {
+		t.Errorf("bits=13 status = %d, want 400", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ipam/pools/999/map", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown pool status = %d, want 404", rr.Code)
+	}
+}
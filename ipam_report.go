@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// ipamReportSheets lays out pools as a workbook: a summary sheet with the utilization
+// of every pool, then one sheet per pool listing its allocations
+func ipamReportSheets(pools []*IPAMPool) ([]xlsxSheet, error) {
+	summary := xlsxSheet{
+		Name:   "Summary",
+		Header: []string{"tenant", "pool", "prefix", "description", "size", "allocated", "allocations", "utilization_percent"},
+	}
+	var poolSheets []xlsxSheet
+	for _, p := range pools {
+		summary.Rows = append(summary.Rows, []interface{}{p.Tenant, p.Name, p.Prefix, p.Description, p.Size, p.Allocated, p.Allocations, p.Utilization})
+		allocations, err := ipamService.Allocations(p.ID)
+		if err != nil {
+			return nil, err
+		}
+		sheet := xlsxSheet{
+			Name:   p.Name,
+			Header: []string{"prefix", "description", "vlan", "min_host_address", "max_host_address", "usable_hosts", "total_addresses", "created_at"},
+		}
+		for _, a := range allocations {
+			vlan := ""
+			if a.VLAN != 0 {
+				vlan = strconv.Itoa(a.VLAN)
+			}
+			row := SubnetRow{Prefix: a.Prefix}
+			if _, network, err := net.ParseCIDR(a.Prefix); err == nil {
+				row = prefixRow("", network)
+			}
+			sheet.Rows = append(sheet.Rows, []interface{}{a.Prefix, a.Description, vlan, row.MinHost, row.MaxHost, row.UsableHosts, row.TotalAddresses, a.CreatedAt})
+		}
+		if len(poolSheets) < maxXLSXSheets {
+			poolSheets = append(poolSheets, sheet)
+		}
+	}
+	return append([]xlsxSheet{summary}, poolSheets...), nil
+}
+
+// writeIPAMReport sends the report of pools as an Excel download
+func writeIPAMReport(w http.ResponseWriter, pools []*IPAMPool) {
+	sheets, err := ipamReportSheets(pools)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeXLSXDownload(w, "ipam-report.xlsx", sheets)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func init() {
+	registerMigration(sqlMigration{
+		Version: 1,
+		Name:    "create ipam pools and allocations",
+		Up: []string{
+			`CREATE TABLE ipam_pools (
+				id {{id}},
+				name TEXT NOT NULL,
+				prefix TEXT NOT NULL UNIQUE,
+				description TEXT NOT NULL DEFAULT '',
+				created_at TEXT NOT NULL
+			)`,
+			`CREATE TABLE ipam_allocations (
+				id {{id}},
+				pool_id BIGINT NOT NULL REFERENCES ipam_pools (id),
+				prefix TEXT NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				created_at TEXT NOT NULL
+			)`,
+			`CREATE INDEX ipam_allocations_pool ON ipam_allocations (pool_id)`,
+		},
+	})
+	registerMigration(sqlMigration{
+		Version: 2,
+		Name:    "add vlan to ipam allocations",
+		Up:      []string{`ALTER TABLE ipam_allocations ADD COLUMN vlan INTEGER NOT NULL DEFAULT 0`},
+	})
+	registerMigration(sqlMigration{
+		Version: 5,
+		Name:    "add tenant to ipam pools",
+		Up: []string{
+			`ALTER TABLE ipam_pools ADD COLUMN tenant TEXT NOT NULL DEFAULT 'default'`,
+			`CREATE INDEX ipam_pools_tenant ON ipam_pools (tenant)`,
+		},
+	})
+}
+
+// sqlIPAMStore keeps pools and allocations in a SQL database
+type sqlIPAMStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func newSQLIPAMStore(db *sql.DB, dialect sqlDialect) *sqlIPAMStore {
+	return &sqlIPAMStore{db: db, dialect: dialect}
+}
+
+// scanner is the Scan method shared by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// sqlTime formats a timestamp for the TEXT created_at columns
+func sqlTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func scanPool(row scanner) (*IPAMPool, error) {
+	var p IPAMPool
+	var created string
+	if err := row.Scan(&p.ID, &p.Tenant, &p.Name, &p.Prefix, &p.Description, &created); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errIPAMNotFound
+		}
+		return nil, err
+	}
+	p.CreatedAt, _ = time.Parse(time.RFC3339Nano, created)
+	return &p, nil
+}
+
+func scanAllocation(row scanner) (*IPAMAllocation, error) {
+	var a IPAMAllocation
+	var created string
+	if err := row.Scan(&a.ID, &a.PoolID, &a.Prefix, &a.Description, &a.VLAN, &created); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errIPAMNotFound
+		}
+		return nil, err
+	}
+	a.CreatedAt, _ = time.Parse(time.RFC3339Nano, created)
+	return &a, nil
+}
+
+func (s *sqlIPAMStore) ListPools() ([]*IPAMPool, error) {
+	rows, err := s.db.Query("SELECT id, tenant, name, prefix, description, created_at FROM ipam_pools ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []*IPAMPool
+	for rows.Next() {
+		p, err := scanPool(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlIPAMStore) GetPool(id int64) (*IPAMPool, error) {
+	return scanPool(s.db.QueryRow(s.dialect.rebind("SELECT id, tenant, name, prefix, description, created_at FROM ipam_pools WHERE id = ?"), id))
+}
+
+func (s *sqlIPAMStore) CreatePool(p *IPAMPool) error {
+	p.CreatedAt = time.Now().UTC()
+	return s.db.QueryRow(s.dialect.rebind("INSERT INTO ipam_pools (tenant, name, prefix, description, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id"),
+		p.Tenant, p.Name, p.Prefix, p.Description, sqlTime(p.CreatedAt)).Scan(&p.ID)
+}
+
+func (s *sqlIPAMStore) UpdatePool(p *IPAMPool) error {
+	return execOne(s.db, s.dialect, "UPDATE ipam_pools SET tenant = ?, name = ?, description = ? WHERE id = ?", p.Tenant, p.Name, p.Description, p.ID)
+}
+
+func (s *sqlIPAMStore) DeletePool(id int64) error {
+	return execOne(s.db, s.dialect, "DELETE FROM ipam_pools WHERE id = ?", id)
+}
+
+func (s *sqlIPAMStore) ListAllocations(poolID int64) ([]*IPAMAllocation, error) {
+	rows, err := s.db.Query(s.dialect.rebind("SELECT id, pool_id, prefix, description, vlan, created_at FROM ipam_allocations WHERE pool_id = ? ORDER BY id"), poolID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []*IPAMAllocation
+	for rows.Next() {
+		a, err := scanAllocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlIPAMStore) GetAllocation(id int64) (*IPAMAllocation, error) {
+	return scanAllocation(s.db.QueryRow(s.dialect.rebind("SELECT id, pool_id, prefix, description, vlan, created_at FROM ipam_allocations WHERE id = ?"), id))
+}
+
+func (s *sqlIPAMStore) CreateAllocation(a *IPAMAllocation) error {
+	a.CreatedAt = time.Now().UTC()
+	return s.db.QueryRow(s.dialect.rebind("INSERT INTO ipam_allocations (pool_id, prefix, description, vlan, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id"),
+		a.PoolID, a.Prefix, a.Description, a.VLAN, sqlTime(a.CreatedAt)).Scan(&a.ID)
+}
+
+func (s *sqlIPAMStore) UpdateAllocation(a *IPAMAllocation) error {
+	return execOne(s.db, s.dialect, "UPDATE ipam_allocations SET description = ?, vlan = ? WHERE id = ?", a.Description, a.VLAN, a.ID)
+}
+
+func (s *sqlIPAMStore) DeleteAllocation(id int64) error {
+	return execOne(s.db, s.dialect, "DELETE FROM ipam_allocations WHERE id = ?", id)
+}
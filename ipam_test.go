@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// withTestIPAM swaps in an empty in-memory IPAM for the duration of a test
+func withTestIPAM(t *testing.T) *IPAM {
+	t.Helper()
+	previous := ipamService
+	ipamService = newIPAM(newMemoryIPAMStore())
+	t.Cleanup(func() { ipamService = previous })
+	return ipamService
+}
+
+func TestIPAMPools(t *testing.T) {
+	m := newIPAM(newMemoryIPAMStore())
+
+	pool, err := m.CreatePool(PoolRequest{Name: " dc1 ", Prefix: "10.1.2.3/16", Description: "first"})
+	if err != nil {
+		t.Fatalf("CreatePool() unexpected error: %v", err)
+	}
+	if pool.ID == 0 || pool.Name != "dc1" || pool.Prefix != "10.1.0.0/16" || pool.Size != 65536 {
+		t.Errorf("CreatePool() = %+v", pool)
+	}
+
+	for _, req := range []PoolRequest{
+		{Name: "inner", Prefix: "10.1.128.0/17"},
+		{Name: "outer", Prefix: "10.0.0.0/8"},
+	} {
+		if _, err := m.CreatePool(req); !errors.Is(err, errIPAMConflict) {
+			t.Errorf("CreatePool(%s) error = %v, want conflict", req.Prefix, err)
+		}
+	}
+	for _, req := range []PoolRequest{{Prefix: "10.2.0.0/16"}, {Name: "bad", Prefix: "10.2.0.0/33"}} {
+		if _, err := m.CreatePool(req); err == nil || errors.Is(err, errIPAMConflict) {
+			t.Errorf("CreatePool(%+v) expected validation error, got %v", req, err)
+		}
+	}
+
+	updated, err := m.UpdatePool(pool.ID, PoolRequest{Name: "dc-1", Description: "renamed"})
+	if err != nil || updated.Name != "dc-1" || updated.Description != "renamed" {
+		t.Errorf("UpdatePool() = %+v, %v", updated, err)
+	}
+	if _, err := m.UpdatePool(pool.ID, PoolRequest{Prefix: "10.9.0.0/16"}); err == nil {
+		t.Error("UpdatePool() changing the prefix expected error, got nil")
+	}
+	if _, err := m.UpdatePool(999, PoolRequest{Name: "x"}); !errors.Is(err, errIPAMNotFound) {
+		t.Errorf("UpdatePool(999) error = %v, want not found", err)
+	}
+}
+
+func TestIPAMAllocate(t *testing.T) {
+	m := newIPAM(newMemoryIPAMStore())
+	pool, _ := m.CreatePool(PoolRequest{Name: "lab", Prefix: "192.168.0.0/22"})
+
+	first, err := m.Allocate(pool.ID, AllocationRequest{Size: 24, Description: "servers"})
+	if err != nil || first.Prefix != "192.168.0.0/24" {
+		t.Fatalf("Allocate(/24) = %+v, %v", first, err)
+	}
+	explicit, err := m.Allocate(pool.ID, AllocationRequest{Prefix: "192.168.2.0/24"})
+	if err != nil || explicit.Prefix != "192.168.2.0/24" {
+		t.Fatalf("Allocate(192.168.2.0/24) = %+v, %v", explicit, err)
+	}
+	next, err := m.Allocate(pool.ID, AllocationRequest{Size: 23})
+	if !errors.Is(err, errIPAMConflict) {
+		t.Errorf("Allocate(/23) = %+v, %v; want conflict (only two /24s left)", next, err)
+	}
+	if next, err = m.Allocate(pool.ID, AllocationRequest{Size: 25}); err != nil || next.Prefix != "192.168.1.0/25" {
+		t.Errorf("Allocate(/25) = %+v, %v; want 192.168.1.0/25", next, err)
+	}
+
+	tests := []struct {
+		req          AllocationRequest
+		wantConflict bool
+	}{
+		{AllocationRequest{Prefix: "192.168.2.128/25"}, true},
+		{AllocationRequest{Prefix: "192.168.0.0/22"}, true},
+		{AllocationRequest{Prefix: "10.0.0.0/24"}, false},
+		{AllocationRequest{Size: 21}, false},
+		{AllocationRequest{}, false},
+	}
+	for _, tt := range tests {
+		_, err := m.Allocate(pool.ID, tt.req)
+		if err == nil || errors.Is(err, errIPAMConflict) != tt.wantConflict {
+			t.Errorf("Allocate(%+v) error = %v, want conflict=%v", tt.req, err, tt.wantConflict)
+		}
+	}
+
+	got, _ := m.Pool(pool.ID)
+	if got.Allocated != 640 || got.Utilization != 62.5 {
+		t.Errorf("pool usage = %d (%.1f%%), want 640 (62.5%%)", got.Allocated, got.Utilization)
+	}
+
+	if err := m.DeletePool(pool.ID); !errors.Is(err, errIPAMConflict) {
+		t.Errorf("DeletePool() with allocations error = %v, want conflict", err)
+	}
+	if err := m.Release(explicit.ID); err != nil {
+		t.Fatalf("Release() unexpected error: %v", err)
+	}
+	if again, err := m.Allocate(pool.ID, AllocationRequest{Size: 24}); err != nil || again.Prefix != "192.168.2.0/24" {
+		t.Errorf("Allocate(/24) after release = %+v, %v; want 192.168.2.0/24", again, err)
+	}
+	if err := m.Release(explicit.ID); !errors.Is(err, errIPAMNotFound) {
+		t.Errorf("second Release() error = %v, want not found", err)
+	}
+}
+
+func TestIPAMIndexes(t *testing.T) {
+	store := newMemoryIPAMStore()
+	m := newIPAM(store)
+	pool, _ := m.CreatePool(PoolRequest{Name: "lab", Prefix: "10.0.0.0/16"})
+	m.Allocate(pool.ID, AllocationRequest{Prefix: "10.0.1.0/24"})
+
+	// A new instance on the same store loads its indexes from the store
+	m = newIPAM(store)
+	if _, err := m.CreatePool(PoolRequest{Name: "inner", Prefix: "10.0.128.0/17"}); !errors.Is(err, errIPAMConflict) {
+		t.Errorf("CreatePool() inside a stored pool error = %v, want conflict", err)
+	}
+	if _, err := m.Allocate(pool.ID, AllocationRequest{Prefix: "10.0.0.0/23"}); !errors.Is(err, errIPAMConflict) {
+		t.Errorf("Allocate() over a stored allocation error = %v, want conflict", err)
+	}
+
+	allocations, _ := m.Allocations(pool.ID)
+	for _, a := range allocations {
+		if err := m.Release(a.ID); err != nil {
+			t.Fatalf("Release() unexpected error: %v", err)
+		}
+	}
+	if err := m.DeletePool(pool.ID); err != nil {
+		t.Fatalf("DeletePool() unexpected error: %v", err)
+	}
+	inner, err := m.CreatePool(PoolRequest{Name: "inner", Prefix: "10.0.0.0/17"})
+	if err != nil {
+		t.Fatalf("CreatePool() after deleting the outer pool: %v", err)
+	}
+	if a, err := m.Allocate(inner.ID, AllocationRequest{Prefix: "10.0.0.0/23"}); err != nil {
+		t.Errorf("Allocate() after the overlapping allocation was released = %+v, %v", a, err)
+	}
+}
+
+func TestIPAMAPI(t *testing.T) {
+	withTestIPAM(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/ipam/pools", ipamPoolsHandler)
+	mux.HandleFunc("/api/v1/ipam/pools/{id}", ipamPoolHandler)
+	mux.HandleFunc("/api/v1/ipam/pools/{id}/allocations", ipamPoolAllocationsHandler)
+	mux.HandleFunc("/api/v1/ipam/allocations/{id}", ipamAllocationHandler)
+
+	do := func(method, target, body string, wantStatus int, v interface{}) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+		if rr.Code != wantStatus {
+			t.Fatalf("%s %s status = %d, want %d (body: %s)", method, target, rr.Code, wantStatus, rr.Body.String())
+		}
+		if v != nil {
+			if err := json.Unmarshal(rr.Body.Bytes(), v); err != nil {
+				t.Fatalf("%s %s: invalid JSON: %v", method, target, err)
+			}
+		}
+	}
+
+	var pool IPAMPool
+	do(http.MethodPost, "/api/v1/ipam/pools", `{"name":"campus","prefix":"10.20.0.0/16"}`, http.StatusCreated, &pool)
+	do(http.MethodPost, "/api/v1/ipam/pools", `{"name":"dup","prefix":"10.20.5.0/24"}`, http.StatusConflict, nil)
+
+	var pools []IPAMPool
+	do(http.MethodGet, "/api/v1/ipam/pools", "", http.StatusOK, &pools)
+	if len(pools) != 1 || pools[0].Name != "campus" {
+		t.Errorf("pools = %+v", pools)
+	}
+
+	base := "/api/v1/ipam/pools/" + strconv.FormatInt(pool.ID, 10)
+	var allocation IPAMAllocation
+	do(http.MethodPost, base+"/allocations", `{"size":24,"description":"wifi"}`, http.StatusCreated, &allocation)
+	if allocation.Prefix != "10.20.0.0/24" || allocation.PoolID != pool.ID {
+		t.Errorf("allocation = %+v", allocation)
+	}
+	do(http.MethodPost, base+"/allocations", `{"prefix":"10.20.0.128/25"}`, http.StatusConflict, nil)
+	do(http.MethodPost, "/api/v1/ipam/pools/999/allocations", `{"size":24}`, http.StatusNotFound, nil)
+
+	var allocations []IPAMAllocation
+	do(http.MethodGet, base+"/allocations", "", http.StatusOK, &allocations)
+	if len(allocations) != 1 {
+		t.Errorf("allocations = %+v", allocations)
+	}
+
+	allocURL := "/api/v1/ipam/allocations/" + strconv.FormatInt(allocation.ID, 10)
+	do(http.MethodPut, allocURL, `{"description":"guest wifi"}`, http.StatusOK, &allocation)
+	if allocation.Description != "guest wifi" {
+		t.Errorf("updated allocation = %+v", allocation)
+	}
+	do(http.MethodGet, base, "", http.StatusOK, &pool)
+	if pool.Allocated != 256 {
+		t.Errorf("pool allocated = %d, want 256", pool.Allocated)
+	}
+
+	do(http.MethodDelete, base, "", http.StatusConflict, nil)
+	do(http.MethodDelete, allocURL, "", http.StatusNoContent, nil)
+	do(http.MethodGet, allocURL, "", http.StatusNotFound, nil)
+	do(http.MethodPut, base, `{"name":"campus-2"}`, http.StatusOK, &pool)
+	do(http.MethodDelete, base, "", http.StatusNoContent, nil)
+	do(http.MethodGet, base, "", http.StatusNotFound, nil)
+	do(http.MethodGet, "/api/v1/ipam/pools/abc", "", http.StatusNotFound, nil)
+	do(http.MethodPatch, "/api/v1/ipam/pools", "", http.StatusMethodNotAllowed, nil)
+}
+
+func TestIPAMPage(t *testing.T) {
+	m := withTestIPAM(t)
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/ipam", strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		ipamPageHandler(rr, req)
+		return rr
+	}
+
+	rr := post(url.Values{"action": {"create-pool"}, "name": {"office"}, "prefix": {"172.16.0.0/20"}})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/ipam?pool=1" {
+		t.Fatalf("create-pool = %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr = post(url.Values{"action": {"allocate"}, "pool": {"1"}, "target": {"/22"}, "vlan": {"x"}}); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "vlan must be a number") {
+		t.Errorf("allocate with a bad VLAN should re-render with the error, got %d", rr.Code)
+	}
+	if rr = post(url.Values{"action": {"allocate"}, "pool": {"1"}, "target": {"/22"}, "vlan": {"1234"}, "description": {"floor 1"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("allocate = %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = post(url.Values{"action": {"allocate"}, "pool": {"1"}, "target": {"172.16.0.0/24"}})
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "overlaps an existing allocation") {
+		t.Errorf("overlapping allocate should re-render with the error, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	ipamPageHandler(rr, httptest.NewRequest(http.MethodGet, "/ipam?pool=1", nil))
+	body := rr.Body.String()
+	for _, want := range []string{"office", "172.16.0.0/20", "172.16.0.0/22", "floor 1", "25.0%", "<td>1234</td>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page missing %q", want)
+		}
+	}
+
+	allocations, _ := m.Allocations(1)
+	rr = post(url.Values{"action": {"release"}, "pool": {"1"}, "allocation": {strconv.FormatInt(allocations[0].ID, 10)}})
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("release = %d", rr.Code)
+	}
+	if rr = post(url.Values{"action": {"delete-pool"}, "pool": {"1"}}); rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/ipam" {
+		t.Errorf("delete-pool = %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+}
+
+func TestIPAMAllocationVLAN(t *testing.T) {
+	m := newIPAM(newMemoryIPAMStore())
+	pool, _ := m.CreatePool(PoolRequest{Name: "dc1", Prefix: "10.0.0.0/16"})
+
+	if _, err := m.Allocate(pool.ID, AllocationRequest{Size: 24, VLAN: 4095}); err == nil {
+		t.Error("Allocate() with VLAN 4095 should fail")
+	}
+	a, err := m.Allocate(pool.ID, AllocationRequest{Size: 24, VLAN: 100})
+	if err != nil || a.VLAN != 100 {
+		t.Fatalf("Allocate() = %+v, %v", a, err)
+	}
+	if a, err = m.UpdateAllocation(a.ID, AllocationRequest{Description: "servers", VLAN: 200}); err != nil || a.VLAN != 200 {
+		t.Errorf("UpdateAllocation() = %+v, %v", a, err)
+	}
+	if got, _ := m.Allocation(a.ID); got.VLAN != 200 || got.Description != "servers" {
+		t.Errorf("stored allocation = %+v", got)
+	}
+	if _, err := m.UpdateAllocation(a.ID, AllocationRequest{VLAN: -1}); err == nil {
+		t.Error("UpdateAllocation() with VLAN -1 should fail")
+	}
+}
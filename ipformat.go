@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// AddressInteger is an IPv4 address as the 32-bit unsigned integer databases store
+// and packet captures show, in decimal, hex and octal
+type AddressInteger struct {
+	Decimal uint32 `json:"decimal"`
+	Hex     string `json:"hex"`
+	Octal   string `json:"octal"`
+}
+
+// IntegerForms are the integer forms of the address, network and broadcast of a result
+type IntegerForms struct {
+	IPAddress        AddressInteger `json:"ip_address"`
+	NetworkAddress   AddressInteger `json:"network_address"`
+	BroadcastAddress AddressInteger `json:"broadcast_address"`
+}
+
+// canonicalIP rewrites an IPv4 address written as a 32-bit integer (3232235876), in
+// hex (0xC0A80164) or in dotted hex (0xC0.0xA8.0x01.0x64) in dotted decimal, as log
+// analysis tools often print them that way. Any other input is returned unchanged, to
+// be parsed or rejected as before
+func canonicalIP(s string) string {
+	if addr, ok := parseNumericIPv4(s); ok {
+		return addr.String()
+	}
+	return s
+}
+
+// normalizeInput trims the address and mask of a calculation and reads them the way
+// common network tooling does: a prefix length after the address fills an empty mask,
+// and an address of one to three octets is zero-filled, so 10/8 is 10.0.0.0/8 and
+// 172.16 with /12 is 172.16.0.0/12. A bare number without a dot or a prefix length
+// stays an integer address, so 10 is 0.0.0.10 like 256 is 0.0.1.0; it, larger numbers
+// and hex go through canonicalIP. note says how zero-filled input was read, to show
+// with the result
+func normalizeInput(ip, mask string) (string, string, string) {
+	ip, mask = strings.TrimSpace(ip), strings.TrimSpace(mask)
+	entered, slashed := ip, false
+	if mask == "" {
+		if address, length, ok := strings.Cut(ip, "/"); ok {
+			ip, mask, slashed = address, "/"+length, true
+		}
+	}
+	if (!slashed && !strings.Contains(ip, ".")) || !isShorthandIP(ip) {
+		return canonicalIP(ip), mask, ""
+	}
+	ip += strings.Repeat(".0", 3-strings.Count(ip, "."))
+	if slashed {
+		return ip, mask, fmt.Sprintf("%s was read as %s%s", entered, ip, mask)
+	}
+	return ip, mask, fmt.Sprintf("%s was read as %s", entered, ip)
+}
+
+// isShorthandIP reports whether s is one to three decimal octets, which
+// normalizeInput zero-fills
+func isShorthandIP(s string) bool {
+	if strings.Count(s, ".") > 2 {
+		return false
+	}
+	for {
+		octet, rest, found := strings.Cut(s, ".")
+		if _, err := strconv.ParseUint(octet, 10, 8); err != nil || (len(octet) > 1 && octet[0] == '0') {
+			return false
+		}
+		if !found {
+			return true
+		}
+		s = rest
+	}
+}
+
+// parseNumericIPv4 parses the integer, hex and dotted hex forms of canonicalIP
+func parseNumericIPv4(s string) (netip.Addr, bool) {
+	if !strings.Contains(s, ".") {
+		n, ok := parseIPv4Number(s, 32)
+		return uint32ToAddr(uint32(n)), ok
+	}
+	// Plain dotted decimal is left to netip
+	if !strings.ContainsAny(s, "xX") {
+		return netip.Addr{}, false
+	}
+
+	var octets [4]byte
+	for i := range octets {
+		part, rest, found := strings.Cut(s, ".")
+		if found == (i == 3) {
+			return netip.Addr{}, false
+		}
+		n, ok := parseIPv4Number(part, 8)
+		if !ok || (len(part) > 1 && part[0] == '0' && !isHexNumber(part)) {
+			return netip.Addr{}, false
+		}
+		octets[i] = byte(n)
+		s = rest
+	}
+	return netip.AddrFrom4(octets), true
+}
+
+// parseIPv4Number parses a decimal or 0x-prefixed hex number of at most bitSize bits
+func parseIPv4Number(s string, bitSize int) (uint64, bool) {
+	if isHexNumber(s) {
+		s = s[2:]
+		if s == "" {
+			return 0, false
+		}
+		n, err := strconv.ParseUint(s, 16, bitSize)
+		return n, err == nil
+	}
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s, 10, bitSize)
+	return n, err == nil
+}
+
+// isHexNumber reports whether s starts with 0x or 0X
+func isHexNumber(s string) bool {
+	return len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X')
+}
+
+// integerFormsOf returns the integer forms of a calculation, or nil when the address or
+// mask does not parse
+func integerFormsOf(address, mask string) *IntegerForms {
+	b, err := computeSubnet(address, mask)
+	if err != nil {
+		return nil
+	}
+	addr, _ := netip.ParseAddr(address)
+	return &IntegerForms{
+		IPAddress:        addressInteger(addrToUint32(addr.Unmap())),
+		NetworkAddress:   addressInteger(addrToUint32(b.network)),
+		BroadcastAddress: addressInteger(addrToUint32(b.broadcast)),
+	}
+}
+
+// addressInteger formats n with the 0x and 0 prefixes inet_aton reads, the hex form
+// padded to 8 digits like packet captures show it
+func addressInteger(n uint32) AddressInteger {
+	return AddressInteger{Decimal: n, Hex: fmt.Sprintf("0x%08x", n), Octal: fmt.Sprintf("%#o", n)}
+}
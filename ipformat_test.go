@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalIP(t *testing.T) {
+	tests := map[string]string{
+		"3232235876":          "192.168.1.100",
+		"0":                   "0.0.0.0",
+		"4294967295":          "255.255.255.255",
+		"0xC0A80164":          "192.168.1.100",
+		"0Xc0a80164":          "192.168.1.100",
+		"0xa":                 "0.0.0.10",
+		"0xC0.0xA8.0x01.0x64": "192.168.1.100",
+		"0xc0.168.1.0x64":     "192.168.1.100",
+		// Left for the calculation to accept or reject
+		"192.168.1.100":           "192.168.1.100",
+		"4294967296":              "4294967296",
+		"0x100000000":             "0x100000000",
+		"0x":                      "0x",
+		"-1":                      "-1",
+		"+1":                      "+1",
+		"1_000":                   "1_000",
+		"0xC0.0xA8.0x01":          "0xC0.0xA8.0x01",
+		"0xC0.0xA8.0x01.0x64.0x1": "0xC0.0xA8.0x01.0x64.0x1",
+		"0x100.0.0.1":             "0x100.0.0.1",
+		"0xC0.010.1.1":            "0xC0.010.1.1",
+		"0xC0..1.1":               "0xC0..1.1",
+		"::ffff:c0a8:164":         "::ffff:c0a8:164",
+		"":                        "",
+	}
+	for input, want := range tests {
+		if got := canonicalIP(input); got != want {
+			t.Errorf("canonicalIP(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestCalculateHandlerNumericIP(t *testing.T) {
+	for _, ip := range []string{"3232235876", "0xC0A80164", "0xC0.0xA8.0x01.0x64"} {
+		rr := httptest.NewRecorder()
+		calculateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/calculate?mask=/24&ip="+ip, nil))
+		var result SubnetResult
+		if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || rr.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", ip, rr.Code, rr.Body.String())
+		}
+		if result.IPAddress != "192.168.1.100" || result.NetworkAddress != "192.168.1.0" || result.Integers == nil || result.Integers.IPAddress.Decimal != 3232235876 {
+			t.Errorf("%s: ip_address %s, network %s", ip, result.IPAddress, result.NetworkAddress)
+		}
+	}
+}
+
+func TestIntegerFormsOf(t *testing.T) {
+	forms := integerFormsOf("192.168.1.100", "/24")
+	want := IntegerForms{
+		IPAddress:        AddressInteger{Decimal: 3232235876, Hex: "0xc0a80164", Octal: "030052000544"},
+		NetworkAddress:   AddressInteger{Decimal: 3232235776, Hex: "0xc0a80100", Octal: "030052000400"},
+		BroadcastAddress: AddressInteger{Decimal: 3232236031, Hex: "0xc0a801ff", Octal: "030052000777"},
+	}
+	if forms == nil || *forms != want {
+		t.Errorf("integerFormsOf(192.168.1.100, /24) = %+v, want %+v", forms, want)
+	}
+	if forms := integerFormsOf("10.0.0.1", "/8"); forms == nil || forms.NetworkAddress.Hex != "0x0a000000" || forms.BroadcastAddress.Octal != "01277777777" {
+		t.Errorf("integerFormsOf(10.0.0.1, /8) = %+v", forms)
+	}
+	if forms := integerFormsOf("0.0.0.0", "/0"); forms == nil || forms.IPAddress.Octal != "0" || forms.BroadcastAddress.Decimal != 4294967295 {
+		t.Errorf("integerFormsOf(0.0.0.0, /0) = %+v", forms)
+	}
+	if forms := integerFormsOf("bogus", "/24"); forms != nil {
+		t.Errorf("integerFormsOf(bogus) = %+v, want nil", forms)
+	}
+}
+
+func TestNormalizeInput(t *testing.T) {
+	tests := []struct {
+		ip, mask                   string
+		wantIP, wantMask, wantNote string
+	}{
+		{"10/8", "", "10.0.0.0", "/8", "10/8 was read as 10.0.0.0/8"},
+		{" 172.16/12 ", "", "172.16.0.0", "/12", "172.16/12 was read as 172.16.0.0/12"},
+		{"192.168.1/24", "", "192.168.1.0", "/24", "192.168.1/24 was read as 192.168.1.0/24"},
+		{"172.16", "255.240.0.0", "172.16.0.0", "255.240.0.0", "172.16 was read as 172.16.0.0"},
+		// A bare number is an integer address, whatever its size
+		{"10", "/8", "0.0.0.10", "/8", ""},
+		{"256", "/24", "0.0.1.0", "/24", ""},
+		{"10.0.0.0/8", "", "10.0.0.0", "/8", ""},
+		{"192.168.1.100", " /24 ", "192.168.1.100", "/24", ""},
+		{"3232235876", "/24", "192.168.1.100", "/24", ""},
+		{"0xC0A80164/24", "", "192.168.1.100", "/24", ""},
+		{"256/8", "", "0.0.1.0", "/8", ""},
+		// Not shorthand: left for the calculation to reject
+		{"010.1", "/16", "010.1", "/16", ""},
+		{"10..1", "/16", "10..1", "/16", ""},
+		{"10.", "/8", "10.", "/8", ""},
+		{"10/8", "/16", "10/8", "/16", ""},
+	}
+	for _, tt := range tests {
+		ip, mask, note := normalizeInput(tt.ip, tt.mask)
+		if ip != tt.wantIP || mask != tt.wantMask || note != tt.wantNote {
+			t.Errorf("normalizeInput(%q, %q) = %q, %q, %q, want %q, %q, %q", tt.ip, tt.mask, ip, mask, note, tt.wantIP, tt.wantMask, tt.wantNote)
+		}
+	}
+}
+
+func TestCalculateHandlerShorthand(t *testing.T) {
+	rr := httptest.NewRecorder()
+	calculateHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/calculate", strings.NewReader(`{"ip":"172.16/12"}`)))
+	var result SubnetResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rr.Code, rr.Body.String())
+	}
+	if result.IPAddress != "172.16.0.0" || result.SubnetMask != "/12" || result.BroadcastAddress != "172.31.255.255" || result.Normalization != "172.16/12 was read as 172.16.0.0/12" {
+		t.Errorf("result = %+v", result)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Kinds of address a mapped address conversion starts from
+const (
+	addressKindIPv4       = "ipv4"
+	addressKindMapped     = "ipv4-mapped"
+	addressKindCompatible = "ipv4-compatible"
+)
+
+// MappedAddress is an IPv4 address in the IPv6 notations dual-stack systems log it
+// in: IPv4-mapped (::ffff:192.0.2.1, RFC 4291 section 2.5.5.2) and the deprecated
+// IPv4-compatible (::192.0.2.1), each with the IPv4 part in dotted decimal and in hex
+type MappedAddress struct {
+	Input         string `json:"input"`
+	Kind          string `json:"kind,omitempty"`
+	IPv4          string `json:"ipv4,omitempty"`
+	Mapped        string `json:"mapped,omitempty"`
+	MappedHex     string `json:"mapped_hex,omitempty"`
+	Compatible    string `json:"compatible,omitempty"`
+	CompatibleHex string `json:"compatible_hex,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// MappedRequest is the JSON body of POST /api/v1/ipv6/mapped
+type MappedRequest struct {
+	Addresses []string `json:"addresses"`
+}
+
+// MappedResponse holds the conversions of a MappedRequest in the order of its
+// addresses
+type MappedResponse struct {
+	Results []MappedAddress `json:"results"`
+	Errors  int             `json:"errors"`
+}
+
+// convertMapped reads an IPv4 address, or an IPv4-mapped or IPv4-compatible IPv6
+// address, and writes the IPv4 address it carries in every notation. :: and ::1 are
+// the unspecified and loopback addresses, not IPv4-compatible ones
+func convertMapped(input string) (MappedAddress, error) {
+	s := strings.TrimSpace(input)
+	if s == "" {
+		return MappedAddress{}, fmt.Errorf("address is required")
+	}
+	addr, err := netip.ParseAddr(canonicalIP(s))
+	if err != nil || addr.Zone() != "" {
+		return MappedAddress{}, fmt.Errorf("invalid IP address: %s", s)
+	}
+
+	var kind string
+	var v4 [4]byte
+	switch {
+	case addr.Is4():
+		kind, v4 = addressKindIPv4, addr.As4()
+	case addr.Is4In6():
+		kind, v4 = addressKindMapped, addr.Unmap().As4()
+	case netip.PrefixFrom(netip.IPv6Unspecified(), 96).Contains(addr) && addr != netip.IPv6Unspecified() && addr != netip.IPv6Loopback():
+		b := addr.As16()
+		kind, v4 = addressKindCompatible, [4]byte(b[12:])
+	default:
+		return MappedAddress{}, fmt.Errorf("%s is not an IPv4, IPv4-mapped or IPv4-compatible address", s)
+	}
+
+	ipv4 := netip.AddrFrom4(v4).String()
+	var compatible [16]byte
+	copy(compatible[12:], v4[:])
+	return MappedAddress{
+		Input:         s,
+		Kind:          kind,
+		IPv4:          ipv4,
+		Mapped:        "::ffff:" + ipv4,
+		MappedHex:     fmt.Sprintf("::ffff:%x:%x", uint16(v4[0])<<8|uint16(v4[1]), uint16(v4[2])<<8|uint16(v4[3])),
+		Compatible:    "::" + ipv4,
+		CompatibleHex: netip.AddrFrom16(compatible).String(),
+	}, nil
+}
+
+// mappedHandler serves /api/v1/ipv6/mapped: GET converts the address query parameter,
+// POST the addresses of a JSON body, such as the client addresses of a log, reporting
+// the ones that fail next to the others
+func mappedHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		resp, err := convertMapped(r.URL.Query().Get("address"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case http.MethodPost:
+		var req MappedRequest
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if len(req.Addresses) > maxPrefixListLen {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("at most %d addresses are allowed", maxPrefixListLen))
+			return
+		}
+		resp := MappedResponse{Results: make([]MappedAddress, len(req.Addresses))}
+		for i, address := range req.Addresses {
+			result, err := convertMapped(address)
+			if err != nil {
+				result = MappedAddress{Input: address, Error: err.Error()}
+				resp.Errors++
+			}
+			resp.Results[i] = result
+		}
+		writeJSON(w, http.StatusOK, resp)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
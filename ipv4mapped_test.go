@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConvertMapped(t *testing.T) {
+	want := MappedAddress{
+		IPv4:          "192.0.2.1",
+		Mapped:        "::ffff:192.0.2.1",
+		MappedHex:     "::ffff:c000:201",
+		Compatible:    "::192.0.2.1",
+		CompatibleHex: "::c000:201",
+	}
+	for input, kind := range map[string]string{
+		"192.0.2.1":                addressKindIPv4,
+		"3221225985":               addressKindIPv4,
+		"::ffff:192.0.2.1":         addressKindMapped,
+		" ::FFFF:c000:0201 ":       addressKindMapped,
+		"0:0:0:0:0:ffff:192.0.2.1": addressKindMapped,
+		"::192.0.2.1":              addressKindCompatible,
+		"0000:0000:0000:0000:0000:0000:c000:0201": addressKindCompatible,
+	} {
+		got, err := convertMapped(input)
+		w := want
+		w.Input, w.Kind = strings.TrimSpace(input), kind
+		if err != nil || got != w {
+			t.Errorf("convertMapped(%q) = %+v, %v, want %+v", input, got, err, w)
+		}
+	}
+	if got, err := convertMapped("::ffff:0.0.0.2"); err != nil || got.CompatibleHex != "::2" || got.MappedHex != "::ffff:0:2" {
+		t.Errorf("convertMapped(::ffff:0.0.0.2) = %+v, %v", got, err)
+	}
+
+	for _, input := range []string{"", "bogus", "::", "::1", "2001:db8::c000:201", "::ffff:192.0.2.1%eth0", "::1:c000:201"} {
+		if got, err := convertMapped(input); err == nil {
+			t.Errorf("convertMapped(%q) = %+v, want an error", input, got)
+		}
+	}
+}
+
+func TestMappedHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	mappedHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ipv6/mapped?address=::ffff:10.1.2.3", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"ipv4":"10.1.2.3"`) {
+		t.Errorf("GET: status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	mappedHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ipv6/mapped", strings.NewReader(`{"addresses":["::ffff:10.1.2.3","10.1.2.4","2001:db8::1"]}`)))
+	var resp MappedResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("POST: status %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(resp.Results) != 3 || resp.Errors != 1 || resp.Results[1].Mapped != "::ffff:10.1.2.4" || resp.Results[2].Input != "2001:db8::1" || resp.Results[2].Error == "" {
+		t.Errorf("POST = %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	mappedHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ipv6/mapped?address=2001:db8::1", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("GET of a plain IPv6 address: status %d", rr.Code)
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// The IPv6 toolbox works out the addresses IPv6 hosts derive for themselves, which
+// otherwise take a MAC address, a prefix and a fair amount of bit twiddling by hand
+
+// EUI64Request names the prefix and MAC address of an EUI-64 derivation. A prefix
+// without a length is read as a /64
+type EUI64Request struct {
+	Prefix string `json:"prefix"`
+	MAC    string `json:"mac"`
+}
+
+// EUI64Response is the EUI-64 of a MAC address, the interface identifier derived
+// from it by flipping the universal/local bit (RFC 4291 appendix A) and the address
+// the identifier forms with the prefix
+type EUI64Response struct {
+	Prefix      string `json:"prefix"`
+	MAC         string `json:"mac"`
+	EUI64       string `json:"eui64"`
+	InterfaceID string `json:"interface_id"`
+	Address     string `json:"address"`
+	Expanded    string `json:"address_expanded"`
+}
+
+// parseMAC parses an EUI-48 MAC address with colons, hyphens, Cisco dots or no
+// separators at all, or an EUI-64 written with colons or hyphens
+func parseMAC(s string) (net.HardwareAddr, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 12 {
+		if b, err := hex.DecodeString(s); err == nil {
+			return net.HardwareAddr(b), nil
+		}
+	}
+	mac, err := net.ParseMAC(s)
+	if err != nil || (len(mac) != 6 && len(mac) != 8) {
+		return nil, fmt.Errorf("invalid MAC address: %s", s)
+	}
+	return mac, nil
+}
+
+// eui64 returns the EUI-64 of a MAC address: an EUI-48 gets ff:fe inserted in the
+// middle, an EUI-64 is returned as it is
+func eui64(mac net.HardwareAddr) [8]byte {
+	var id [8]byte
+	if len(mac) == 6 {
+		copy(id[:3], mac[:3])
+		id[3], id[4] = 0xff, 0xfe
+		copy(id[5:], mac[3:])
+	} else {
+		copy(id[:], mac)
+	}
+	return id
+}
+
+// interfaceID returns the modified EUI-64 interface identifier of a MAC address,
+// which has the universal/local bit of the EUI-64 flipped
+func interfaceID(mac net.HardwareAddr) [8]byte {
+	id := eui64(mac)
+	id[0] ^= 0x02
+	return id
+}
+
+// formatInterfaceID writes a 64-bit interface identifier as four groups of an IPv6
+// address, such as 211:22ff:fe33:4455
+func formatInterfaceID(id [8]byte) string {
+	return fmt.Sprintf("%x:%x:%x:%x", uint16(id[0])<<8|uint16(id[1]), uint16(id[2])<<8|uint16(id[3]),
+		uint16(id[4])<<8|uint16(id[5]), uint16(id[6])<<8|uint16(id[7]))
+}
+
+// parseIPv6Prefix parses an IPv6 prefix, or an address read as a prefix of the given
+// length, and clears its host bits
+func parseIPv6Prefix(s string, length int) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	var prefix netip.Prefix
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid IPv6 prefix: %s", s)
+		}
+		prefix = p
+	} else if addr, err := netip.ParseAddr(s); err == nil && addr.Zone() == "" {
+		prefix = netip.PrefixFrom(addr, length)
+	} else {
+		return netip.Prefix{}, fmt.Errorf("invalid IPv6 prefix: %s", s)
+	}
+	if !prefix.Addr().Is6() || prefix.Addr().Is4In6() {
+		return netip.Prefix{}, fmt.Errorf("not an IPv6 prefix: %s", s)
+	}
+	return prefix.Masked(), nil
+}
+
+// parseIPv6Address parses an IPv6 address, which may carry a zone
+func parseIPv6Address(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid IPv6 address: %s", s)
+	}
+	if !addr.Is6() || addr.Is4In6() {
+		return netip.Addr{}, fmt.Errorf("not an IPv6 address: %s", s)
+	}
+	return addr, nil
+}
+
+// deriveEUI64 combines a prefix of at most 64 bits with the interface identifier of a
+// MAC address, as SLAAC does
+func deriveEUI64(req EUI64Request) (*EUI64Response, error) {
+	if strings.TrimSpace(req.Prefix) == "" || strings.TrimSpace(req.MAC) == "" {
+		return nil, fmt.Errorf("prefix and mac are required")
+	}
+	prefix, err := parseIPv6Prefix(req.Prefix, 64)
+	if err != nil {
+		return nil, err
+	}
+	if prefix.Bits() > 64 {
+		return nil, fmt.Errorf("prefix %s is longer than /64 and leaves no room for a 64-bit interface identifier", prefix)
+	}
+	mac, err := parseMAC(req.MAC)
+	if err != nil {
+		return nil, err
+	}
+
+	id, ext := interfaceID(mac), eui64(mac)
+	b := prefix.Addr().As16()
+	copy(b[8:], id[:])
+	addr := netip.AddrFrom16(b)
+	return &EUI64Response{
+		Prefix:      prefix.String(),
+		MAC:         mac.String(),
+		EUI64:       net.HardwareAddr(ext[:]).String(),
+		InterfaceID: formatInterfaceID(id),
+		Address:     addr.String(),
+		Expanded:    addr.StringExpanded(),
+	}, nil
+}
+
+// eui64Handler serves /api/v1/ipv6/eui64; POST takes a JSON body, GET takes the
+// prefix and mac query parameters
+func eui64Handler(w http.ResponseWriter, r *http.Request) {
+	var req EUI64Request
+
+	switch r.Method {
+	case http.MethodPost:
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+	case http.MethodGet:
+		req.Prefix, req.MAC = r.URL.Query().Get("prefix"), r.URL.Query().Get("mac")
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	resp, err := deriveEUI64(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// SolicitedNodeResponse is the solicited-node multicast group of an address (RFC 4291
+// section 2.7.1), which Neighbor Discovery sends its solicitations to, and the
+// Ethernet multicast MAC address the group is sent to (RFC 2464 section 7)
+type SolicitedNodeResponse struct {
+	Address       string `json:"address"`
+	SolicitedNode string `json:"solicited_node"`
+	MulticastMAC  string `json:"multicast_mac"`
+}
+
+// solicitedNode returns the solicited-node multicast group of an address: ff02::1:ff
+// followed by the low 24 bits of the address. On Ethernet its frames go to 33:33
+// followed by the low 32 bits of the group
+func solicitedNode(address string) (*SolicitedNodeResponse, error) {
+	if strings.TrimSpace(address) == "" {
+		return nil, fmt.Errorf("address is required")
+	}
+	addr, err := parseIPv6Address(address)
+	if err != nil {
+		return nil, err
+	}
+	b := addr.As16()
+	group := [16]byte{0: 0xff, 1: 0x02, 11: 0x01, 12: 0xff, 13: b[13], 14: b[14], 15: b[15]}
+	mac := net.HardwareAddr{0x33, 0x33, group[12], group[13], group[14], group[15]}
+	return &SolicitedNodeResponse{
+		Address:       addr.String(),
+		SolicitedNode: netip.AddrFrom16(group).String(),
+		MulticastMAC:  mac.String(),
+	}, nil
+}
+
+// solicitedNodeHandler serves GET /api/v1/ipv6/solicited-node with the address query
+// parameter
+func solicitedNodeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	resp, err := solicitedNode(r.URL.Query().Get("address"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// linkLocalPrefix is the prefix link-local addresses are formed in (RFC 4291 section
+// 2.5.6)
+var linkLocalPrefix = netip.MustParsePrefix("fe80::/64")
+
+// defaultZone is the sample zone link-local addresses are shown with
+const defaultZone = "eth0"
+
+// LinkLocalRequest names the MAC address or the interface identifier a link-local
+// address is formed from, and the zone to show it with
+type LinkLocalRequest struct {
+	MAC         string `json:"mac,omitempty"`
+	InterfaceID string `json:"interface_id,omitempty"`
+	Zone        string `json:"zone,omitempty"`
+}
+
+// LinkLocalResponse is the link-local address of an interface, without a zone and
+// with one, as it must be given to reach a neighbor on hosts with several interfaces
+type LinkLocalResponse struct {
+	MAC         string `json:"mac,omitempty"`
+	InterfaceID string `json:"interface_id"`
+	Address     string `json:"address"`
+	WithZone    string `json:"address_with_zone"`
+	Expanded    string `json:"address_expanded"`
+}
+
+// parseInterfaceID parses a 64-bit interface identifier written as the last four
+// groups of an IPv6 address, such as 211:22ff:fe33:4455 or ::211:22ff:fe33:4455
+func parseInterfaceID(s string) ([8]byte, error) {
+	s = strings.TrimSpace(s)
+	text := s
+	if !strings.Contains(text, "::") {
+		text = "::" + text
+	}
+	addr, err := netip.ParseAddr(text)
+	b := addr.As16()
+	if err != nil || !addr.Is6() || addr.Zone() != "" || [8]byte(b[:8]) != [8]byte{} {
+		return [8]byte{}, fmt.Errorf("invalid interface identifier: %s (must be at most four groups, such as 211:22ff:fe33:4455)", s)
+	}
+	return [8]byte(b[8:]), nil
+}
+
+// linkLocal forms the fe80::/64 address of a MAC address, whose interface identifier
+// has the universal/local bit flipped, or of an interface identifier as it is
+func linkLocal(req LinkLocalRequest) (*LinkLocalResponse, error) {
+	req.MAC, req.InterfaceID, req.Zone = strings.TrimSpace(req.MAC), strings.TrimSpace(req.InterfaceID), strings.TrimSpace(req.Zone)
+	if (req.MAC == "") == (req.InterfaceID == "") {
+		return nil, fmt.Errorf("exactly one of mac and interface_id is required")
+	}
+	if req.Zone == "" {
+		req.Zone = defaultZone
+	}
+	if err := checkZone(req.Zone); err != nil {
+		return nil, err
+	}
+
+	resp := &LinkLocalResponse{}
+	var id [8]byte
+	if req.MAC != "" {
+		mac, err := parseMAC(req.MAC)
+		if err != nil {
+			return nil, err
+		}
+		id, resp.MAC = interfaceID(mac), mac.String()
+	} else {
+		var err error
+		if id, err = parseInterfaceID(req.InterfaceID); err != nil {
+			return nil, err
+		}
+	}
+
+	b := linkLocalPrefix.Addr().As16()
+	copy(b[8:], id[:])
+	addr := netip.AddrFrom16(b)
+	resp.InterfaceID = formatInterfaceID(id)
+	resp.Address = addr.String()
+	resp.WithZone = addr.WithZone(req.Zone).String()
+	resp.Expanded = addr.StringExpanded()
+	return resp, nil
+}
+
+// linkLocalHandler serves /api/v1/ipv6/link-local; POST takes a JSON body, GET takes
+// the mac, interface_id and zone query parameters
+func linkLocalHandler(w http.ResponseWriter, r *http.Request) {
+	var req LinkLocalRequest
+
+	switch r.Method {
+	case http.MethodPost:
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+	case http.MethodGet:
+		query := r.URL.Query()
+		req = LinkLocalRequest{MAC: query.Get("mac"), InterfaceID: query.Get("interface_id"), Zone: query.Get("zone")}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	resp, err := linkLocal(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// checkZone reports a zone ID that cannot name an interface: it must be printable
+// text without spaces, % or /, such as eth0 or 12
+func checkZone(zone string) error {
+	if zone == "" || strings.ContainsAny(zone, "%/") || strings.IndexFunc(zone, func(r rune) bool { return r <= ' ' || r == 0x7f }) >= 0 {
+		return fmt.Errorf("invalid zone: %q", zone)
+	}
+	return nil
+}
+
+// NormalizedIPv6 is an IPv6 address or prefix in its canonical form (RFC 5952) and
+// fully expanded. EmbeddedIPv4 is the dotted-decimal part of input written in mixed
+// notation, such as 64:ff9b::192.0.2.1, and Changed tells whether the canonical form
+// differs from the input
+type NormalizedIPv6 struct {
+	Input        string `json:"input"`
+	Canonical    string `json:"canonical,omitempty"`
+	Expanded     string `json:"expanded,omitempty"`
+	Zone         string `json:"zone,omitempty"`
+	EmbeddedIPv4 string `json:"embedded_ipv4,omitempty"`
+	Changed      bool   `json:"changed"`
+	Error        string `json:"error,omitempty"`
+}
+
+// NormalizeRequest is the JSON body of POST /api/v1/ipv6/normalize
+type NormalizeRequest struct {
+	Addresses []string `json:"addresses"`
+}
+
+// NormalizeResponse holds the results of a NormalizeRequest in the order of its
+// addresses
+type NormalizeResponse struct {
+	Results []NormalizedIPv6 `json:"results"`
+	Errors  int              `json:"errors"`
+}
+
+// normalizeIPv6 writes an IPv6 address, or a prefix, in canonical and expanded form.
+// A zone is only allowed on link-local unicast and link-local or interface-local
+// multicast addresses, which are the ones it scopes (RFC 4007)
+func normalizeIPv6(input string) (NormalizedIPv6, error) {
+	s := strings.TrimSpace(input)
+	if s == "" {
+		return NormalizedIPv6{}, fmt.Errorf("address is required")
+	}
+	text, length, hasLength := strings.Cut(s, "/")
+	if hasLength && strings.Contains(text, "%") {
+		return NormalizedIPv6{}, fmt.Errorf("%s: prefixes cannot have a zone", s)
+	}
+	addr, err := netip.ParseAddr(text)
+	if err != nil || !addr.Is6() {
+		return NormalizedIPv6{}, fmt.Errorf("invalid IPv6 address: %s", s)
+	}
+
+	result := NormalizedIPv6{Input: s, Zone: addr.Zone()}
+	if result.Zone != "" {
+		if err := checkZone(result.Zone); err != nil {
+			return NormalizedIPv6{}, err
+		}
+		if !addr.IsLinkLocalUnicast() && !addr.IsLinkLocalMulticast() && !addr.IsInterfaceLocalMulticast() {
+			return NormalizedIPv6{}, fmt.Errorf("%s: a zone only applies to link-local addresses", s)
+		}
+	}
+	host, _, _ := strings.Cut(text, "%")
+	if last := host[strings.LastIndexByte(host, ':')+1:]; strings.Contains(last, ".") {
+		result.EmbeddedIPv4 = last
+	}
+
+	result.Canonical, result.Expanded = addr.String(), addr.StringExpanded()
+	if hasLength {
+		prefix, err := netip.ParsePrefix(addr.String() + "/" + length)
+		if err != nil {
+			return NormalizedIPv6{}, fmt.Errorf("invalid IPv6 prefix: %s", s)
+		}
+		result.Canonical += "/" + strconv.Itoa(prefix.Bits())
+		result.Expanded += "/" + strconv.Itoa(prefix.Bits())
+	}
+	result.Changed = result.Canonical != s
+	return result, nil
+}
+
+// normalizeHandler serves /api/v1/ipv6/normalize: GET normalizes the address query
+// parameter, POST the addresses of a JSON body, such as those of a config file,
+// reporting the ones that fail next to the others
+func normalizeHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		resp, err := normalizeIPv6(r.URL.Query().Get("address"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case http.MethodPost:
+		var req NormalizeRequest
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+		if len(req.Addresses) > maxPrefixListLen {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("at most %d addresses are allowed", maxPrefixListLen))
+			return
+		}
+		resp := NormalizeResponse{Results: make([]NormalizedIPv6, len(req.Addresses))}
+		for i, address := range req.Addresses {
+			result, err := normalizeIPv6(address)
+			if err != nil {
+				result = NormalizedIPv6{Input: address, Error: err.Error()}
+				resp.Errors++
+			}
+			resp.Results[i] = result
+		}
+		writeJSON(w, http.StatusOK, resp)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeriveEUI64(t *testing.T) {
+	for _, mac := range []string{"00:11:22:33:44:55", "00-11-22-33-44-55", "0011.2233.4455", "001122334455"} {
+		resp, err := deriveEUI64(EUI64Request{Prefix: "2001:db8:1:2::/64", MAC: mac})
+		if err != nil {
+			t.Fatalf("%s: %v", mac, err)
+		}
+		want := EUI64Response{
+			Prefix:      "2001:db8:1:2::/64",
+			MAC:         "00:11:22:33:44:55",
+			EUI64:       "00:11:22:ff:fe:33:44:55",
+			InterfaceID: "211:22ff:fe33:4455",
+			Address:     "2001:db8:1:2:211:22ff:fe33:4455",
+			Expanded:    "2001:0db8:0001:0002:0211:22ff:fe33:4455",
+		}
+		if *resp != want {
+			t.Errorf("%s: got %+v, want %+v", mac, *resp, want)
+		}
+	}
+
+	tests := []struct {
+		req         EUI64Request
+		wantAddress string
+	}{
+		// The universal/local bit is flipped both ways, and host bits of the prefix cleared
+		{EUI64Request{Prefix: "2001:db8::1/64", MAC: "02:00:5e:10:00:01"}, "2001:db8::5eff:fe10:1"},
+		{EUI64Request{Prefix: "fd00:1:2:3::", MAC: "aa:bb:cc:dd:ee:ff"}, "fd00:1:2:3:a8bb:ccff:fedd:eeff"},
+		{EUI64Request{Prefix: "2001:db8::/48", MAC: "00:00:00:00:00:01"}, "2001:db8::200:ff:fe00:1"},
+		{EUI64Request{Prefix: "2001:db8::/64", MAC: "00:11:22:33:44:55:66:77"}, "2001:db8::211:2233:4455:6677"},
+	}
+	for _, tt := range tests {
+		resp, err := deriveEUI64(tt.req)
+		if err != nil || resp.Address != tt.wantAddress {
+			t.Errorf("deriveEUI64(%+v) = %+v, %v, want %s", tt.req, resp, err, tt.wantAddress)
+		}
+	}
+
+	for _, req := range []EUI64Request{
+		{Prefix: "2001:db8::/64"},
+		{Prefix: "2001:db8::/80", MAC: "00:11:22:33:44:55"},
+		{Prefix: "10.0.0.0/8", MAC: "00:11:22:33:44:55"},
+		{Prefix: "fe80::%eth0", MAC: "00:11:22:33:44:55"},
+		{Prefix: "2001:db8::/64", MAC: "00:11:22:33:44"},
+		{Prefix: "2001:db8::/64", MAC: "00112233445g"},
+	} {
+		if resp, err := deriveEUI64(req); err == nil {
+			t.Errorf("deriveEUI64(%+v) = %+v, want an error", req, resp)
+		}
+	}
+}
+
+func TestEUI64Handler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	eui64Handler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ipv6/eui64?prefix=2001:db8::/64&mac=00:11:22:33:44:55", nil))
+	var resp EUI64Response
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK || resp.Address != "2001:db8::211:22ff:fe33:4455" {
+		t.Errorf("GET: status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	eui64Handler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ipv6/eui64", strings.NewReader(`{"prefix":"2001:db8::/64","mac":"bogus"}`)))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid MAC address") {
+		t.Errorf("POST bad MAC: status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	eui64Handler(rr, httptest.NewRequest(http.MethodDelete, "/api/v1/ipv6/eui64", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE: status %d", rr.Code)
+	}
+}
+
+func TestSolicitedNode(t *testing.T) {
+	tests := []struct {
+		address string
+		want    SolicitedNodeResponse
+	}{
+		{"2001:db8::211:22ff:fe33:4455", SolicitedNodeResponse{"2001:db8::211:22ff:fe33:4455", "ff02::1:ff33:4455", "33:33:ff:33:44:55"}},
+		{" fe80::1%eth0 ", SolicitedNodeResponse{"fe80::1%eth0", "ff02::1:ff00:1", "33:33:ff:00:00:01"}},
+		{"2001:DB8::ABCD:EF01", SolicitedNodeResponse{"2001:db8::abcd:ef01", "ff02::1:ffcd:ef01", "33:33:ff:cd:ef:01"}},
+		{"::", SolicitedNodeResponse{"::", "ff02::1:ff00:0", "33:33:ff:00:00:00"}},
+	}
+	for _, tt := range tests {
+		resp, err := solicitedNode(tt.address)
+		if err != nil || *resp != tt.want {
+			t.Errorf("solicitedNode(%q) = %+v, %v, want %+v", tt.address, resp, err, tt.want)
+		}
+	}
+	for _, address := range []string{"", "192.0.2.1", "::ffff:192.0.2.1", "2001:db8::/64", "bogus"} {
+		if resp, err := solicitedNode(address); err == nil {
+			t.Errorf("solicitedNode(%q) = %+v, want an error", address, resp)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	solicitedNodeHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ipv6/solicited-node?address=2001:db8::1", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"solicited_node":"ff02::1:ff00:1"`) {
+		t.Errorf("GET: status %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestLinkLocal(t *testing.T) {
+	resp, err := linkLocal(LinkLocalRequest{MAC: "00:11:22:33:44:55"})
+	want := LinkLocalResponse{
+		MAC:         "00:11:22:33:44:55",
+		InterfaceID: "211:22ff:fe33:4455",
+		Address:     "fe80::211:22ff:fe33:4455",
+		WithZone:    "fe80::211:22ff:fe33:4455%eth0",
+		Expanded:    "fe80:0000:0000:0000:0211:22ff:fe33:4455",
+	}
+	if err != nil || *resp != want {
+		t.Errorf("linkLocal(mac) = %+v, %v, want %+v", resp, err, want)
+	}
+
+	tests := []struct {
+		req      LinkLocalRequest
+		wantZone string
+	}{
+		{LinkLocalRequest{MAC: "0211.2233.4455", Zone: "en0"}, "fe80::11:22ff:fe33:4455%en0"},
+		{LinkLocalRequest{InterfaceID: "211:22ff:fe33:4455", Zone: "Ethernet"}, "fe80::211:22ff:fe33:4455%Ethernet"},
+		{LinkLocalRequest{InterfaceID: "::1", Zone: "12"}, "fe80::1%12"},
+		{LinkLocalRequest{InterfaceID: "0:0:0:1"}, "fe80::1%eth0"},
+	}
+	for _, tt := range tests {
+		resp, err := linkLocal(tt.req)
+		if err != nil || resp.WithZone != tt.wantZone {
+			t.Errorf("linkLocal(%+v) = %+v, %v, want %s", tt.req, resp, err, tt.wantZone)
+		}
+	}
+
+	for _, req := range []LinkLocalRequest{
+		{},
+		{MAC: "00:11:22:33:44:55", InterfaceID: "::1"},
+		{MAC: "bogus"},
+		{InterfaceID: "2001:db8::1"},
+		{InterfaceID: "1:2:3:4:5"},
+		{InterfaceID: "::1%eth0"},
+		{MAC: "00:11:22:33:44:55", Zone: "eth0%1"},
+		{MAC: "00:11:22:33:44:55", Zone: "Ethernet 2"},
+	} {
+		if resp, err := linkLocal(req); err == nil {
+			t.Errorf("linkLocal(%+v) = %+v, want an error", req, resp)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	linkLocalHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ipv6/link-local?mac=00:11:22:33:44:55&zone=wlan0", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"address_with_zone":"fe80::211:22ff:fe33:4455%wlan0"`) {
+		t.Errorf("GET: status %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestNormalizeIPv6(t *testing.T) {
+	tests := []struct {
+		input string
+		want  NormalizedIPv6
+	}{
+		{"2001:DB8:0:0:0:0:0:1", NormalizedIPv6{Canonical: "2001:db8::1", Expanded: "2001:0db8:0000:0000:0000:0000:0000:0001", Changed: true}},
+		{"2001:db8::1", NormalizedIPv6{Canonical: "2001:db8::1", Expanded: "2001:0db8:0000:0000:0000:0000:0000:0001"}},
+		// RFC 5952 section 4.2: the longest run of zeros is compressed, the first of equal ones,
+		// and a single zero group is not compressed
+		{"2001:0:0:1:0:0:0:1", NormalizedIPv6{Canonical: "2001:0:0:1::1", Expanded: "2001:0000:0000:0001:0000:0000:0000:0001", Changed: true}},
+		{"2001:db8:0:0:1:0:0:1", NormalizedIPv6{Canonical: "2001:db8::1:0:0:1", Expanded: "2001:0db8:0000:0000:0001:0000:0000:0001", Changed: true}},
+		{"2001:db8:0:1:1:1:1:1", NormalizedIPv6{Canonical: "2001:db8:0:1:1:1:1:1", Expanded: "2001:0db8:0000:0001:0001:0001:0001:0001"}},
+		{"FE80::1%eth0", NormalizedIPv6{Canonical: "fe80::1%eth0", Expanded: "fe80:0000:0000:0000:0000:0000:0000:0001%eth0", Zone: "eth0", Changed: true}},
+		{"ff02::1%2", NormalizedIPv6{Canonical: "ff02::1%2", Expanded: "ff02:0000:0000:0000:0000:0000:0000:0001%2", Zone: "2"}},
+		{"64:ff9b::192.0.2.33", NormalizedIPv6{Canonical: "64:ff9b::c000:221", Expanded: "0064:ff9b:0000:0000:0000:0000:c000:0221", EmbeddedIPv4: "192.0.2.33", Changed: true}},
+		{"::ffff:192.0.2.1", NormalizedIPv6{Canonical: "::ffff:192.0.2.1", Expanded: "0000:0000:0000:0000:0000:ffff:c000:0201", EmbeddedIPv4: "192.0.2.1"}},
+		{" 2001:DB8:0::/48 ", NormalizedIPv6{Canonical: "2001:db8::/48", Expanded: "2001:0db8:0000:0000:0000:0000:0000:0000/48", Changed: true}},
+	}
+	for _, tt := range tests {
+		got, err := normalizeIPv6(tt.input)
+		tt.want.Input = strings.TrimSpace(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeIPv6(%q) = %+v, %v, want %+v", tt.input, got, err, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "192.0.2.1", "2001:db8::g", "2001:db8::1%eth0", "fe80::1%eth 0", "fe80::1%", "fe80::1%eth0/64", "2001:db8::/129", "1:2:3:4:5:6:7:8:9"} {
+		if got, err := normalizeIPv6(input); err == nil {
+			t.Errorf("normalizeIPv6(%q) = %+v, want an error", input, got)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	normalizeHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ipv6/normalize", strings.NewReader(`{"addresses":["2001:DB8::1","bogus"]}`)))
+	var resp NormalizeResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK || len(resp.Results) != 2 || resp.Errors != 1 ||
+		resp.Results[0].Canonical != "2001:db8::1" || resp.Results[1].Error == "" {
+		t.Errorf("POST: status %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultJobWorkers is how many jobs run at once when GO_SUBNET_CALCULATOR_JOB_WORKERS
+	// is not set
+	defaultJobWorkers = 2
+	// maxJobWorkers bounds GO_SUBNET_CALCULATOR_JOB_WORKERS
+	maxJobWorkers = 64
+	// jobQueueSize is how many jobs may wait for a worker before new ones are refused
+	jobQueueSize = 100
+	// defaultJobRetention is how long finished jobs and their results are kept
+	defaultJobRetention = time.Hour
+	// jobEventInterval is the shortest time between two progress events of a job
+	jobEventInterval = 100 * time.Millisecond
+	// jobKeepAlive is how often an idle event stream sends a comment so proxies keep it open
+	jobKeepAlive = 15 * time.Second
+)
+
+// errJobQueueFull is returned when every worker is busy and the queue is full
+var errJobQueueFull = errors.New("too many jobs are waiting; try again later")
+
+// Job is a long-running operation started with ?async=true. Status is queued, running,
+// succeeded, failed or canceled; Done and Total report the progress of running jobs
+// and Result holds what the synchronous endpoint would have returned
+type Job struct {
+	ID         int64       `json:"id"`
+	Kind       string      `json:"kind"`
+	Owner      string      `json:"-"`
+	Status     string      `json:"status"`
+	Done       int         `json:"done"`
+	Total      int         `json:"total"`
+	Result     interface{} `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  *time.Time  `json:"started_at,omitempty"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+}
+
+// finished reports whether the job will not change any more
+func (j *Job) finished() bool {
+	return j.Status == "succeeded" || j.Status == "failed" || j.Status == "canceled"
+}
+
+// jobFunc does the work of a job, calling progress as it goes. It should return soon
+// after ctx is canceled
+type jobFunc func(ctx context.Context, progress func(done, total int)) (interface{}, error)
+
+type queuedJob struct {
+	id     int64
+	ctx    context.Context
+	run    jobFunc
+	cancel context.CancelFunc
+}
+
+// jobQueue runs jobs on a fixed number of workers and keeps them, in memory only,
+// until retention after they finish. Watchers of a job wait on a channel that is
+// closed at its next change
+type jobQueue struct {
+	mu        sync.Mutex
+	nextID    int64
+	jobs      map[int64]*Job
+	cancels   map[int64]context.CancelFunc
+	changed   map[int64]chan struct{}
+	queue     chan *queuedJob
+	retention time.Duration
+}
+
+func newJobQueue(workers int, retention time.Duration) *jobQueue {
+	q := &jobQueue{
+		jobs:      map[int64]*Job{},
+		cancels:   map[int64]context.CancelFunc{},
+		changed:   map[int64]chan struct{}{},
+		queue:     make(chan *queuedJob, jobQueueSize),
+		retention: retention,
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// Close stops the workers once the queued jobs are done
+func (q *jobQueue) Close() {
+	close(q.queue)
+}
+
+func (q *jobQueue) work() {
+	for job := range q.queue {
+		q.runJob(job)
+	}
+}
+
+func (q *jobQueue) runJob(job *queuedJob) {
+	defer job.cancel()
+	q.mu.Lock()
+	j := q.jobs[job.id]
+	if j == nil || j.finished() {
+		q.mu.Unlock()
+		return
+	}
+	now := time.Now().UTC()
+	j.Status, j.StartedAt = "running", &now
+	q.notify(j.ID)
+	q.mu.Unlock()
+
+	result, err := job.run(job.ctx, func(done, total int) {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		j.Done, j.Total = done, total
+		q.notify(j.ID)
+	})
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	finished := time.Now().UTC()
+	j.FinishedAt = &finished
+	delete(q.cancels, j.ID)
+	switch {
+	case job.ctx.Err() != nil:
+		j.Status = "canceled"
+	case err != nil:
+		j.Status, j.Error = "failed", err.Error()
+	default:
+		j.Status, j.Result = "succeeded", result
+	}
+	q.notify(j.ID)
+}
+
+// notify wakes the watchers of a job; the caller holds q.mu
+func (q *jobQueue) notify(id int64) {
+	if ch, ok := q.changed[id]; ok {
+		close(ch)
+		delete(q.changed, id)
+	}
+}
+
+// prune drops jobs that finished longer than retention ago; the caller holds q.mu
+func (q *jobQueue) prune() {
+	cutoff := time.Now().Add(-q.retention)
+	for id, j := range q.jobs {
+		if j.FinishedAt != nil && j.FinishedAt.Before(cutoff) {
+			delete(q.jobs, id)
+			q.notify(id)
+		}
+	}
+}
+
+// Submit queues a job of kind for owner. total is the expected amount of work, if known
+func (q *jobQueue) Submit(kind, owner string, total int, run jobFunc) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.prune()
+	ctx, cancel := context.WithCancel(context.Background())
+	q.nextID++
+	j := &Job{ID: q.nextID, Kind: kind, Owner: owner, Status: "queued", Total: total, CreatedAt: time.Now().UTC()}
+	select {
+	case q.queue <- &queuedJob{id: j.ID, ctx: ctx, run: run, cancel: cancel}:
+	default:
+		cancel()
+		q.nextID--
+		return nil, errJobQueueFull
+	}
+	q.jobs[j.ID] = j
+	q.cancels[j.ID] = cancel
+	copied := *j
+	return &copied, nil
+}
+
+// Get returns a copy of a job, or errIPAMNotFound
+func (q *jobQueue) Get(id int64) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.prune()
+	j, ok := q.jobs[id]
+	if !ok {
+		return nil, errIPAMNotFound
+	}
+	copied := *j
+	return &copied, nil
+}
+
+// Watch returns a copy of a job and a channel that is closed when it next changes or
+// is removed
+func (q *jobQueue) Watch(id int64) (*Job, <-chan struct{}, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.prune()
+	j, ok := q.jobs[id]
+	if !ok {
+		return nil, nil, errIPAMNotFound
+	}
+	ch, ok := q.changed[id]
+	if !ok {
+		ch = make(chan struct{})
+		q.changed[id] = ch
+	}
+	copied := *j
+	return &copied, ch, nil
+}
+
+// List returns the jobs of owner, or of everyone when owner is empty, newest first
+func (q *jobQueue) List(owner string) []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.prune()
+	list := []*Job{}
+	for _, j := range q.jobs {
+		if owner == "" || j.Owner == owner {
+			copied := *j
+			list = append(list, &copied)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list
+}
+
+// Cancel stops a queued or running job. A finished job is removed instead
+func (q *jobQueue) Cancel(id int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return errIPAMNotFound
+	}
+	defer q.notify(id)
+	if j.finished() {
+		delete(q.jobs, id)
+		return nil
+	}
+	q.cancels[id]()
+	delete(q.cancels, id)
+	if j.Status == "queued" {
+		now := time.Now().UTC()
+		j.Status, j.FinishedAt = "canceled", &now
+	}
+	return nil
+}
+
+// jobs runs the asynchronous operations behind /api/v1/jobs
+var jobs = newJobQueue(defaultJobWorkers, defaultJobRetention)
+
+// configureJobs reads GO_SUBNET_CALCULATOR_JOB_WORKERS and
+// GO_SUBNET_CALCULATOR_JOB_RETENTION
+func configureJobs() error {
+	workers, retention := defaultJobWorkers, defaultJobRetention
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_JOB_WORKERS"); value != "" {
+		var err error
+		if workers, err = strconv.Atoi(value); err != nil || workers < 1 || workers > maxJobWorkers {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_JOB_WORKERS must be between 1 and %d", maxJobWorkers)
+		}
+	}
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_JOB_RETENTION"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Minute {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_JOB_RETENTION must be a duration of at least 1m, got %q", value)
+		}
+		retention = d
+	}
+	jobs.Close()
+	jobs = newJobQueue(workers, retention)
+	recordSystemAudit("config.jobs", "", "%d workers, results kept for %s", workers, retention)
+	return nil
+}
+
+// asyncRequested reads the ?async= parameter of an endpoint that can run as a job,
+// writing a 400 when it is not a boolean
+func asyncRequested(w http.ResponseWriter, r *http.Request) (async, ok bool) {
+	value := r.URL.Query().Get("async")
+	if value == "" {
+		return false, true
+	}
+	async, err := strconv.ParseBool(value)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "async must be true or false")
+		return false, false
+	}
+	return async, true
+}
+
+// submitJob queues a job for the caller and answers 202 Accepted with the job and
+// its URL. The request body must have been read already. It reports whether the job
+// was queued
+func submitJob(w http.ResponseWriter, r *http.Request, kind string, total int, run jobFunc) bool {
+	parent := r.Context()
+	traced := func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+		ctx, span := startSpan(withSpanOf(ctx, parent), "job."+kind, spanKindInternal)
+		span.Set("job.total", total)
+		result, err := run(ctx, progress)
+		span.End(err)
+		return result, err
+	}
+	j, err := jobs.Submit(kind, requestActor(r), total, traced)
+	if err != nil {
+		w.Header().Set("Retry-After", "30")
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return false
+	}
+	w.Header().Set("Location", sitePath("/api/v1/jobs/"+strconv.FormatInt(j.ID, 10)))
+	writeJSON(w, http.StatusAccepted, j)
+	return true
+}
+
+// visibleJob returns a job the caller started; global admins see every job
+func visibleJob(r *http.Request, id int64) (*Job, error) {
+	j, err := jobs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if j.Owner != requestActor(r) && requestPrincipal(r).checkGlobal(RoleAdmin) != nil {
+		return nil, errIPAMNotFound
+	}
+	return j, nil
+}
+
+// jobsHandler serves GET /api/v1/jobs, the jobs of the caller, or of everyone for
+// global admins, newest first
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	owner := requestActor(r)
+	if requestPrincipal(r).checkGlobal(RoleAdmin) == nil {
+		owner = ""
+	}
+	writeJSON(w, http.StatusOK, jobs.List(owner))
+}
+
+// jobHandler serves GET /api/v1/jobs/{id}, the status and, once it succeeded, the
+// result of a job, and DELETE to cancel it or drop a finished one
+func jobHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	j, err := visibleJob(r, id)
+	if err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, j)
+	case http.MethodDelete:
+		if err := jobs.Cancel(id); err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// writeJobEvent sends the state of a job, without its result, as a server-sent event
+func writeJobEvent(w io.Writer, j *Job) {
+	event := "progress"
+	if j.finished() {
+		event = "done"
+	}
+	j.Result = nil
+	data, _ := json.Marshal(j)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
+
+// jobEventsHandler serves GET /api/v1/jobs/{id}/events, a Server-Sent Events stream of
+// the job's progress. Every change sends a progress event, at most one per
+// jobEventInterval; the stream ends with a done event once the job has finished, after
+// which the result is read from /api/v1/jobs/{id}
+func jobEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if _, err := visibleJob(r, id); err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	rc := http.NewResponseController(w)
+	keepAlive := time.NewTicker(jobKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		j, changed, err := jobs.Watch(id)
+		if err != nil {
+			return
+		}
+		writeJobEvent(w, j)
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return
+		}
+		if j.finished() {
+			return
+		}
+
+	wait:
+		for {
+			select {
+			case <-changed:
+				break wait
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				rc.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+		select {
+		case <-time.After(jobEventInterval):
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
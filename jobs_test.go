@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withTestJobs gives a test an empty job queue with the given number of workers
+func withTestJobs(t *testing.T, workers int) *jobQueue {
+	t.Helper()
+	previous := jobs
+	jobs = newJobQueue(workers, defaultJobRetention)
+	t.Cleanup(func() {
+		jobs.Close()
+		jobs = previous
+	})
+	return jobs
+}
+
+// waitForJob polls a job until it has finished
+func waitForJob(t *testing.T, id int64) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		j, err := jobs.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.finished() {
+			return j
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d is still %s", id, j.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestJobQueue(t *testing.T) {
+	q := withTestJobs(t, 1)
+
+	release := make(chan struct{})
+	blocking, err := q.Submit("test", "alice", 2, func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+		progress(1, 2)
+		<-release
+		return "done", nil
+	})
+	if err != nil || blocking.Status != "queued" {
+		t.Fatalf("Submit() = %+v, %v", blocking, err)
+	}
+	waiting, _ := q.Submit("test", "bob", 0, func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+		t.Error("a canceled job ran")
+		return nil, nil
+	})
+	if err := q.Cancel(waiting.ID); err != nil {
+		t.Fatal(err)
+	}
+	if j, _ := q.Get(waiting.ID); j.Status != "canceled" {
+		t.Errorf("canceled job = %+v", j)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if j, _ := q.Get(blocking.ID); j.Done == 1 || time.Now().After(deadline) {
+			if j.Status != "running" || j.Done != 1 || j.Total != 2 || j.StartedAt == nil {
+				t.Errorf("running job = %+v", j)
+			}
+			break
+		}
+	}
+	close(release)
+	if j := waitForJob(t, blocking.ID); j.Status != "succeeded" || j.Result != "done" || j.FinishedAt == nil {
+		t.Errorf("finished job = %+v", j)
+	}
+
+	if list := q.List("alice"); len(list) != 1 || list[0].ID != blocking.ID {
+		t.Errorf("List(alice) = %+v", list)
+	}
+	if list := q.List(""); len(list) != 2 || list[0].ID != waiting.ID {
+		t.Errorf("List() = %+v", list)
+	}
+	if err := q.Cancel(blocking.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Get(blocking.ID); err != errIPAMNotFound {
+		t.Errorf("removed job: %v", err)
+	}
+}
+
+func TestJobQueueFull(t *testing.T) {
+	q := withTestJobs(t, 1)
+	release := make(chan struct{})
+	defer close(release)
+	block := func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+		return nil, ctx.Err()
+	}
+
+	var err error
+	for i := 0; i <= jobQueueSize+1 && err == nil; i++ {
+		_, err = q.Submit("test", "alice", 0, block)
+	}
+	if err != errJobQueueFull {
+		t.Errorf("Submit() past the queue size = %v", err)
+	}
+}
+
+func TestJobRetention(t *testing.T) {
+	q := withTestJobs(t, 1)
+	j, _ := q.Submit("test", "alice", 0, func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+		return nil, nil
+	})
+	waitForJob(t, j.ID)
+	q.retention = 0
+	if _, err := q.Get(j.ID); err != errIPAMNotFound {
+		t.Errorf("expired job: %v", err)
+	}
+}
+
+func TestAsyncBatch(t *testing.T) {
+	withTestJobs(t, 1)
+
+	call := func(h http.HandlerFunc, method, target, actor, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if actor != "" {
+			req = withPrincipal(req, &Principal{Name: actor, Tenant: defaultTenant, Role: RoleOperator})
+		}
+		req.SetPathValue("id", strings.TrimPrefix(target, "/api/v1/jobs/"))
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		return rr
+	}
+
+	rr := call(batchHandler, http.MethodPost, "/api/v1/batch?async=true", "alice", `{"items":[{"ip":"10.1.2.3","mask":"/16"},{"ip":"x","mask":"/16"}]}`)
+	var job Job
+	if err := json.NewDecoder(rr.Body).Decode(&job); err != nil || rr.Code != http.StatusAccepted || job.Kind != "batch" || job.Total != 2 {
+		t.Fatalf("async batch = %d %+v %v", rr.Code, job, err)
+	}
+	if location := rr.Header().Get("Location"); location != "/api/v1/jobs/1" {
+		t.Errorf("Location = %q", location)
+	}
+	waitForJob(t, job.ID)
+
+	rr = call(jobHandler, http.MethodGet, "/api/v1/jobs/1", "alice", "")
+	var finished struct {
+		Status string
+		Done   int
+		Result BatchResponse
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&finished); err != nil || finished.Status != "succeeded" || finished.Done != 2 {
+		t.Fatalf("job = %d %+v %v", rr.Code, finished, err)
+	}
+	if finished.Result.Count != 2 || finished.Result.Errors != 1 || finished.Result.Results[0].Result.NetworkAddress != "10.1.0.0" {
+		t.Errorf("result = %+v", finished.Result)
+	}
+
+	if rr := call(jobHandler, http.MethodGet, "/api/v1/jobs/1", "bob", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("job of another user = %d, want 404", rr.Code)
+	}
+	if rr := call(jobHandler, http.MethodGet, "/api/v1/jobs/1", "", ""); rr.Code != http.StatusOK {
+		t.Errorf("job seen by an admin = %d, want 200", rr.Code)
+	}
+	var list []Job
+	json.NewDecoder(call(jobsHandler, http.MethodGet, "/api/v1/jobs", "bob", "").Body).Decode(&list)
+	if len(list) != 0 {
+		t.Errorf("jobs of bob = %+v", list)
+	}
+	if rr := call(jobHandler, http.MethodDelete, "/api/v1/jobs/1", "alice", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("DELETE = %d", rr.Code)
+	}
+	if rr := call(jobHandler, http.MethodGet, "/api/v1/jobs/1", "alice", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("deleted job = %d, want 404", rr.Code)
+	}
+
+	if rr := call(batchHandler, http.MethodPost, "/api/v1/batch?async=maybe", "", `{"items":[]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid async = %d, want 400", rr.Code)
+	}
+}
+
+func TestAsyncImportAndRoutes(t *testing.T) {
+	withTestJobs(t, 1)
+	withTestIPAM(t)
+	withTestAudit(t)
+
+	post := func(h http.HandlerFunc, target, body string) *Job {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		var job Job
+		if err := json.NewDecoder(rr.Body).Decode(&job); err != nil || rr.Code != http.StatusAccepted {
+			t.Fatalf("%s = %d %v", target, rr.Code, err)
+		}
+		return waitForJob(t, job.ID)
+	}
+
+	j := post(ipamImportHandler, "/api/v1/ipam/import?async=true", "prefix\n10.0.0.0/8\n10.1.0.0/16\n")
+	if result, ok := j.Result.(*ImportResult); j.Status != "succeeded" || !ok || result.Created != 2 {
+		t.Fatalf("import job = %+v", j)
+	}
+	if pools, _ := ipamService.Pools(); len(pools) != 1 {
+		t.Errorf("pools after import = %+v", pools)
+	}
+	if j := post(ipamImportHandler, "/api/v1/ipam/import?async=true", "name\nx\n"); j.Status != "failed" || j.Error == "" {
+		t.Errorf("failing import job = %+v", j)
+	}
+
+	j = post(routeAnalysisHandler, "/api/v1/routes/analyze?async=true", `{"table":"10.0.0.0/25 via 192.0.2.1\n10.0.0.128/25 via 192.0.2.1\n"}`)
+	if report, ok := j.Result.(*RouteReport); j.Status != "succeeded" || !ok || len(report.Summaries) != 1 {
+		t.Errorf("route job = %+v", j)
+	}
+}
+
+func TestConfigureJobs(t *testing.T) {
+	withTestJobs(t, 1)
+	withTestAudit(t)
+
+	t.Setenv("GO_SUBNET_CALCULATOR_JOB_WORKERS", "4")
+	t.Setenv("GO_SUBNET_CALCULATOR_JOB_RETENTION", "10m")
+	if err := configureJobs(); err != nil || jobs.retention != 10*time.Minute {
+		t.Errorf("configureJobs() = %v, retention %s", err, jobs.retention)
+	}
+	for name, value := range map[string]string{"GO_SUBNET_CALCULATOR_JOB_WORKERS": "0", "GO_SUBNET_CALCULATOR_JOB_RETENTION": "1s"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if err := configureJobs(); err == nil {
+				t.Errorf("%s=%s: expected an error", name, value)
+			}
+		})
+	}
+}
+
+func TestJobEvents(t *testing.T) {
+	q := withTestJobs(t, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/jobs/{id}/events", jobEventsHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	step := make(chan int)
+	j, _ := q.Submit("test", "anonymous", 3, func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+		for done := range step {
+			progress(done, 3)
+		}
+		return "finished", nil
+	})
+
+	resp, err := http.Get(server.URL + "/api/v1/jobs/1/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	next := func() (string, Job) {
+		t.Helper()
+		var event string
+		var job Job
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading events: %v", err)
+			}
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &job); err != nil {
+					t.Fatal(err)
+				}
+			case line == "\n" && event != "":
+				return event, job
+			}
+		}
+	}
+
+	for {
+		if event, job := next(); event != "progress" || job.ID != j.ID {
+			t.Fatalf("event %s %+v", event, job)
+		} else if job.Status == "running" {
+			break
+		}
+	}
+	step <- 2
+	if event, job := next(); event != "progress" || job.Done != 2 || job.Total != 3 {
+		t.Errorf("progress event %s %+v", event, job)
+	}
+	close(step)
+	event, job := next()
+	for event == "progress" {
+		event, job = next()
+	}
+	if event != "done" || job.Status != "succeeded" || job.Result != nil {
+		t.Errorf("last event %s %+v", event, job)
+	}
+
+	if resp, err := http.Get(server.URL + "/api/v1/jobs/9/events"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown job = %v %v", resp.StatusCode, err)
+	}
+}
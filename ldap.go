@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// ldapTimeout bounds the connection to and the bind against the directory server
+const ldapTimeout = 10 * time.Second
+
+// LDAP result codes the login checks for
+const (
+	ldapSuccess            = 0
+	ldapInvalidCredentials = 49
+)
+
+// errLoginFailed is returned for a wrong user name or password
+var errLoginFailed = errors.New("invalid username or password")
+
+// ldapDirectory signs users in with an LDAP simple bind as the user; the password is
+// checked by the directory server and never stored
+type ldapDirectory struct {
+	address   string
+	useTLS    bool
+	tlsConfig *tls.Config
+	userDN    string
+}
+
+// newLDAPDirectory reads GO_SUBNET_CALCULATOR_LDAP_URL (ldap:// or ldaps://) and
+// GO_SUBNET_CALCULATOR_LDAP_USER_DN, the bind name with a {username} placeholder such as
+// uid={username},ou=people,dc=example,dc=org or {username}@example.org
+func newLDAPDirectory() (*ldapDirectory, error) {
+	raw := os.Getenv("GO_SUBNET_CALCULATOR_LDAP_URL")
+	userDN := os.Getenv("GO_SUBNET_CALCULATOR_LDAP_USER_DN")
+	if raw == "" || userDN == "" {
+		return nil, fmt.Errorf("GO_SUBNET_CALCULATOR_LDAP_URL and GO_SUBNET_CALCULATOR_LDAP_USER_DN are required for LDAP login")
+	}
+	if !strings.Contains(userDN, "{username}") {
+		return nil, fmt.Errorf("GO_SUBNET_CALCULATOR_LDAP_USER_DN must contain {username}, got %q", userDN)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid LDAP URL %q", raw)
+	}
+	d := &ldapDirectory{userDN: userDN}
+	port := u.Port()
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+		d.useTLS = true
+		d.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	default:
+		return nil, fmt.Errorf("LDAP URL must use ldap:// or ldaps://, got %q", raw)
+	}
+	d.address = net.JoinHostPort(u.Hostname(), port)
+	return d, nil
+}
+
+// escapeDN escapes a value for use in a distinguished name (RFC 4514)
+func escapeDN(value string) string {
+	var b strings.Builder
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(`\,+"<>;=`, r),
+			r == '#' && i == 0,
+			r == ' ' && (i == 0 || i == len(value)-1):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// authenticate binds as the user. An empty password is refused because LDAP treats
+// it as an unauthenticated bind, which most servers accept for any name
+func (d *ldapDirectory) authenticate(username, password string) error {
+	if username == "" || password == "" {
+		return errLoginFailed
+	}
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+	var conn net.Conn
+	var err error
+	if d.useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", d.address, d.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", d.address)
+	}
+	if err != nil {
+		return fmt.Errorf("LDAP connection: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ldapTimeout))
+
+	dn := strings.ReplaceAll(d.userDN, "{username}", escapeDN(username))
+	if _, err := conn.Write(ldapBindRequest(1, dn, password)); err != nil {
+		return fmt.Errorf("LDAP bind: %w", err)
+	}
+	code, message, err := readLDAPBindResponse(conn)
+	// unbind is a courtesy; the connection is closed either way
+	conn.Write(berTLV(0x30, append(berTLV(0x02, []byte{2}), berTLV(0x42, nil)...)))
+	switch {
+	case err != nil:
+		return fmt.Errorf("LDAP bind: %w", err)
+	case code == ldapSuccess:
+		return nil
+	case code == ldapInvalidCredentials:
+		return errLoginFailed
+	default:
+		return fmt.Errorf("LDAP bind failed with result code %d: %s", code, message)
+	}
+}
+
+// berTLV encodes one BER element with a definite length
+func berTLV(tag byte, content []byte) []byte {
+	n := len(content)
+	out := []byte{tag}
+	switch {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n < 0x100:
+		out = append(out, 0x81, byte(n))
+	case n < 0x10000:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
+
+// readBER reads one BER element; lengths are limited to 1MB
+func readBER(r io.Reader) (byte, []byte, error) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, nil, err
+	}
+	length := int(head[1])
+	if head[1]&0x80 != 0 {
+		size := int(head[1] & 0x7f)
+		if size == 0 || size > 3 {
+			return 0, nil, fmt.Errorf("unsupported BER length")
+		}
+		raw := make([]byte, size)
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return 0, nil, err
+		}
+		length = 0
+		for _, b := range raw {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > 1<<20 {
+		return 0, nil, fmt.Errorf("LDAP message too large")
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return 0, nil, err
+	}
+	return head[0], content, nil
+}
+
+// ldapBindRequest encodes a simple BindRequest (LDAPv3) with a message id below 128
+func ldapBindRequest(id byte, dn, password string) []byte {
+	bind := append(berTLV(0x02, []byte{3}), berTLV(0x04, []byte(dn))...)
+	bind = append(bind, berTLV(0x80, []byte(password))...)
+	message := append(berTLV(0x02, []byte{id}), berTLV(0x60, bind)...)
+	return berTLV(0x30, message)
+}
+
+// readLDAPBindResponse reads a BindResponse and returns its result code and
+// diagnostic message
+func readLDAPBindResponse(r io.Reader) (int, string, error) {
+	tag, message, err := readBER(r)
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != 0x30 {
+		return 0, "", fmt.Errorf("unexpected LDAP message tag %#x", tag)
+	}
+	body := bytes.NewReader(message)
+	if tag, _, err = readBER(body); err != nil || tag != 0x02 {
+		return 0, "", fmt.Errorf("malformed LDAP message id")
+	}
+	tag, response, err := readBER(body)
+	if err != nil || tag != 0x61 {
+		return 0, "", fmt.Errorf("unexpected LDAP response (tag %#x)", tag)
+	}
+
+	fields := bytes.NewReader(response)
+	tag, code, err := readBER(fields)
+	if err != nil || tag != 0x0a || len(code) == 0 {
+		return 0, "", fmt.Errorf("malformed LDAP result code")
+	}
+	result := 0
+	for _, b := range code {
+		result = result<<8 | int(b)
+	}
+	var diagnostic []byte
+	if _, _, err := readBER(fields); err == nil {
+		_, diagnostic, _ = readBER(fields)
+	}
+	return result, string(diagnostic), nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeLDAP accepts simple binds and answers with the result code returned by check
+func fakeLDAP(t *testing.T, check func(dn, password string) int) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, message, err := readBER(conn)
+				if err != nil {
+					return
+				}
+				body := bytes.NewReader(message)
+				readBER(body)
+				_, bind, _ := readBER(body)
+				fields := bytes.NewReader(bind)
+				readBER(fields)
+				_, dn, _ := readBER(fields)
+				_, password, _ := readBER(fields)
+
+				result := berTLV(0x0a, []byte{byte(check(string(dn), string(password)))})
+				result = append(result, berTLV(0x04, nil)...)
+				result = append(result, berTLV(0x04, []byte("diagnostic"))...)
+				conn.Write(berTLV(0x30, append(berTLV(0x02, []byte{1}), berTLV(0x61, result)...)))
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	var gotDN string
+	address := fakeLDAP(t, func(dn, password string) int {
+		gotDN = dn
+		switch password {
+		case "correct":
+			return ldapSuccess
+		case "busy":
+			return 51
+		}
+		return ldapInvalidCredentials
+	})
+	d := &ldapDirectory{address: address, userDN: "uid={username},ou=people,dc=example,dc=org"}
+
+	if err := d.authenticate("alice", "correct"); err != nil {
+		t.Errorf("authenticate() unexpected error: %v", err)
+	}
+	if gotDN != "uid=alice,ou=people,dc=example,dc=org" {
+		t.Errorf("bind DN = %q", gotDN)
+	}
+	if err := d.authenticate("alice", "wrong"); !errors.Is(err, errLoginFailed) {
+		t.Errorf("wrong password error = %v", err)
+	}
+	if err := d.authenticate("alice", "busy"); err == nil || errors.Is(err, errLoginFailed) || !strings.Contains(err.Error(), "51") {
+		t.Errorf("server error = %v", err)
+	}
+	if err := d.authenticate("a,dmin", "correct"); err != nil || gotDN != `uid=a\,dmin,ou=people,dc=example,dc=org` {
+		t.Errorf("escaped bind DN = %q, %v", gotDN, err)
+	}
+
+	gotDN = ""
+	if err := d.authenticate("alice", ""); !errors.Is(err, errLoginFailed) || gotDN != "" {
+		t.Error("an empty password must be refused without an anonymous bind")
+	}
+
+	unreachable := &ldapDirectory{address: "127.0.0.1:1", userDN: "{username}"}
+	if err := unreachable.authenticate("alice", "correct"); err == nil || errors.Is(err, errLoginFailed) {
+		t.Errorf("unreachable server error = %v", err)
+	}
+}
+
+func TestEscapeDN(t *testing.T) {
+	tests := map[string]string{
+		"alice":        "alice",
+		"smith, john":  `smith\, john`,
+		"#admin":       `\#admin`,
+		" padded ":     `\ padded\ `,
+		`a+b="c"<d>;e`: `a\+b\=\"c\"\<d\>\;e`,
+		`back\slash`:   `back\\slash`,
+	}
+	for in, want := range tests {
+		if got := escapeDN(in); got != want {
+			t.Errorf("escapeDN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNewLDAPDirectory(t *testing.T) {
+	tests := []struct {
+		url, userDN string
+		address     string
+		tls         bool
+	}{
+		{"ldap://ldap.example.org", "uid={username},dc=example,dc=org", "ldap.example.org:389", false},
+		{"ldaps://ldap.example.org", "{username}@example.org", "ldap.example.org:636", true},
+		{"ldap://10.0.0.5:3389", "uid={username}", "10.0.0.5:3389", false},
+		{"http://ldap.example.org", "uid={username}", "", false},
+		{"ldap://ldap.example.org", "uid=admin", "", false},
+		{"", "uid={username}", "", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("GO_SUBNET_CALCULATOR_LDAP_URL", tt.url)
+		t.Setenv("GO_SUBNET_CALCULATOR_LDAP_USER_DN", tt.userDN)
+		d, err := newLDAPDirectory()
+		if tt.address == "" {
+			if err == nil {
+				t.Errorf("newLDAPDirectory(%q, %q) expected error", tt.url, tt.userDN)
+			}
+			continue
+		}
+		if err != nil || d.address != tt.address || d.useTLS != tt.tls {
+			t.Errorf("newLDAPDirectory(%q) = %+v, %v", tt.url, d, err)
+		}
+	}
+}
+
+func TestReadLDAPBindResponse(t *testing.T) {
+	// a notice of disconnection is an extended response, not a bind result
+	notice := berTLV(0x30, append(berTLV(0x02, []byte{0}), berTLV(0x78, berTLV(0x0a, []byte{2}))...))
+	if _, _, err := readLDAPBindResponse(bytes.NewReader(notice)); err == nil {
+		t.Error("expected an error for an extended response")
+	}
+	if _, _, err := readLDAPBindResponse(bytes.NewReader([]byte{0x30, 0x85, 1, 2, 3, 4, 5})); err == nil {
+		t.Error("expected an error for an oversized length")
+	}
+	long := bytes.Repeat([]byte("x"), 300)
+	if tag, content, err := readBER(bytes.NewReader(berTLV(0x04, long))); err != nil || tag != 0x04 || !bytes.Equal(content, long) {
+		t.Errorf("readBER() long form = %#x %d bytes, %v", tag, len(content), err)
+	}
+}
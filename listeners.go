@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Listener scopes: everything, only the JSON API, or only the web pages
+const (
+	scopeAll = ""
+	scopeAPI = "api"
+	scopeUI  = "ui"
+)
+
+// listener is one address the server accepts connections on
+type listener struct {
+	address string
+	tls     bool
+	scope   string
+}
+
+// URL returns the base URL of the listener for the startup message
+func (l *listener) URL() string {
+	host, port, _ := net.SplitHostPort(l.address)
+	if host == "" {
+		host = "localhost"
+	}
+	scheme := "http"
+	if l.tls {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, port)
+}
+
+var (
+	// listeners are the addresses to serve, from GO_SUBNET_CALCULATOR_LISTEN or
+	// GO_SUBNET_CALCULATOR_PORT
+	listeners []*listener
+
+	// tlsCertificate is served by the https listeners
+	tlsCertificate *tls.Certificate
+)
+
+// parseListener reads one entry of GO_SUBNET_CALCULATOR_LISTEN:
+// http:// or https://, host:port and an optional /api or /ui scope
+func parseListener(value string) (*listener, error) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("%q is not an http:// or https:// address", value)
+	}
+	if _, port, err := net.SplitHostPort(u.Host); err != nil || port == "" {
+		return nil, fmt.Errorf("%q needs a host:port, e.g. http://:8080", value)
+	}
+	l := &listener{address: u.Host, tls: u.Scheme == "https"}
+	switch strings.TrimSuffix(u.Path, "/") {
+	case "":
+	case "/api":
+		l.scope = scopeAPI
+	case "/ui":
+		l.scope = scopeUI
+	default:
+		return nil, fmt.Errorf("%q: the path must be empty, /api or /ui", value)
+	}
+	return l, nil
+}
+
+// configureListeners reads GO_SUBNET_CALCULATOR_LISTEN, a comma-separated list of
+// addresses such as "http://:8080, https://:8443, http://127.0.0.1:9090/api", and
+// GO_SUBNET_CALCULATOR_TLS_CERT and GO_SUBNET_CALCULATOR_TLS_KEY for the https ones.
+// Without it the server listens on GO_SUBNET_CALCULATOR_PORT (default 8080)
+func configureListeners() error {
+	listeners, tlsCertificate = nil, nil
+	value := os.Getenv("GO_SUBNET_CALCULATOR_LISTEN")
+	if value == "" {
+		port := os.Getenv("GO_SUBNET_CALCULATOR_PORT")
+		if port == "" {
+			port = "8080"
+		}
+		if _, err := strconv.Atoi(port); err != nil {
+			return fmt.Errorf("Invalid port number: %s", port)
+		}
+		value = "http://:" + port
+	}
+
+	seen := map[string]bool{}
+	needTLS := false
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		l, err := parseListener(entry)
+		if err != nil {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_LISTEN: %v", err)
+		}
+		if seen[l.address] {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_LISTEN: %s is listed twice", l.address)
+		}
+		seen[l.address] = true
+		needTLS = needTLS || l.tls
+		listeners = append(listeners, l)
+	}
+	if len(listeners) == 0 {
+		return fmt.Errorf("GO_SUBNET_CALCULATOR_LISTEN has no addresses")
+	}
+
+	certFile, keyFile := os.Getenv("GO_SUBNET_CALCULATOR_TLS_CERT"), os.Getenv("GO_SUBNET_CALCULATOR_TLS_KEY")
+	if needTLS {
+		if certFile == "" || keyFile == "" {
+			return fmt.Errorf("https listeners need GO_SUBNET_CALCULATOR_TLS_CERT and GO_SUBNET_CALCULATOR_TLS_KEY")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("loading the TLS certificate: %v", err)
+		}
+		tlsCertificate = &cert
+	}
+	for _, l := range listeners {
+		scope := l.scope
+		if scope == scopeAll {
+			scope = "all routes"
+		}
+		recordSystemAudit("config.listen", l.URL(), "serving %s", scope)
+	}
+	return nil
+}
+
+// inScope reports whether a listener of the given scope serves path. The probes are
+// served everywhere
+func inScope(scope, path string) bool {
+	if scope == scopeAll || path == "/health" || path == "/ready" || path == "/version" {
+		return true
+	}
+	return strings.HasPrefix(path, "/api/") == (scope == scopeAPI)
+}
+
+// handler builds the middleware chain of the listener around mux. API listeners
+// skip the web login and UI listeners the API key check and CORS, since they never
+// see the paths those act on
+func (l *listener) handler(mux *http.ServeMux) http.Handler {
+	var h http.Handler = mux
+	if l.scope != scopeUI {
+		h = allowCORS(requireAPIKey(h))
+	}
+	if l.scope != scopeAPI {
+		h = requireLogin(h)
+	}
+	h = traceRequests(mux, logAccess(limitBodies(mux, requireReady(h))))
+	scope := l.scope
+	return withRequestID(stripBasePath(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !inScope(scope, r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})))
+}
+
+// server returns the HTTP server of the listener
+func (l *listener) server(mux *http.ServeMux) *http.Server {
+	srv := &http.Server{Addr: l.address, Handler: l.handler(mux)}
+	if l.tls {
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{*tlsCertificate}, MinVersion: tls.VersionTLS12}
+	}
+	return srv
+}
+
+// serveListeners serves mux on every listener and returns when one of them fails
+func serveListeners(mux *http.ServeMux) error {
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		srv := l.server(mux)
+		go func() {
+			var err error
+			if l.tls {
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				err = srv.ListenAndServe()
+			}
+			errs <- fmt.Errorf("%s: %v", l.URL(), err)
+		}()
+	}
+	return <-errs
+}
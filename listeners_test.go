@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withTestListeners restores the listener settings after a test
+func withTestListeners(t *testing.T) {
+	t.Helper()
+	withTestAudit(t)
+	previous, previousCert := listeners, tlsCertificate
+	t.Cleanup(func() { listeners, tlsCertificate = previous, previousCert })
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 and its key
+func writeTestCertificate(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestParseListener(t *testing.T) {
+	tests := []struct {
+		value string
+		want  listener
+	}{
+		{"http://:8080", listener{address: ":8080"}},
+		{"https://0.0.0.0:8443", listener{address: "0.0.0.0:8443", tls: true}},
+		{"http://127.0.0.1:9090/api", listener{address: "127.0.0.1:9090", scope: scopeAPI}},
+		{"http://[::1]:8081/ui/", listener{address: "[::1]:8081", scope: scopeUI}},
+	}
+	for _, tt := range tests {
+		if l, err := parseListener(tt.value); err != nil || *l != tt.want {
+			t.Errorf("parseListener(%q) = %+v, %v", tt.value, l, err)
+		}
+	}
+	for _, value := range []string{":8080", "ftp://:21", "http://localhost", "http://:8080/admin", "http://:8080?x=1", "http://user@:8080"} {
+		if _, err := parseListener(value); err == nil {
+			t.Errorf("parseListener(%q) accepted", value)
+		}
+	}
+}
+
+func TestConfigureListeners(t *testing.T) {
+	withTestListeners(t)
+	t.Setenv("GO_SUBNET_CALCULATOR_PORT", "3000")
+	t.Setenv("GO_SUBNET_CALCULATOR_LISTEN", "")
+	if err := configureListeners(); err != nil || len(listeners) != 1 || listeners[0].URL() != "http://localhost:3000" {
+		t.Fatalf("port fallback = %v, %+v", err, listeners)
+	}
+	t.Setenv("GO_SUBNET_CALCULATOR_PORT", "http")
+	if err := configureListeners(); err == nil {
+		t.Error("expected an error for a non-numeric port")
+	}
+
+	t.Setenv("GO_SUBNET_CALCULATOR_LISTEN", "http://:8080, https://:8443")
+	if err := configureListeners(); err == nil {
+		t.Error("expected an error for https without a certificate")
+	}
+	certFile, keyFile := writeTestCertificate(t)
+	t.Setenv("GO_SUBNET_CALCULATOR_TLS_CERT", certFile)
+	t.Setenv("GO_SUBNET_CALCULATOR_TLS_KEY", keyFile)
+	if err := configureListeners(); err != nil || len(listeners) != 2 || tlsCertificate == nil {
+		t.Fatalf("configureListeners() = %v, %+v", err, listeners)
+	}
+	t.Setenv("GO_SUBNET_CALCULATOR_LISTEN", "http://:8080,http://:8080/api")
+	if err := configureListeners(); err == nil {
+		t.Error("expected an error for an address listed twice")
+	}
+}
+
+func TestListenerScopes(t *testing.T) {
+	originalReport := selfTestReport.Load()
+	defer selfTestReport.Store(originalReport)
+	selfTestReport.Store(&SelfTestReport{Passed: true})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler)
+	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/api/v1/calculate", calculateHandler)
+	status := func(l *listener, path string) int {
+		rr := httptest.NewRecorder()
+		l.handler(mux).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Code
+	}
+	api, ui, all := &listener{scope: scopeAPI}, &listener{scope: scopeUI}, &listener{}
+	for _, tt := range []struct {
+		l    *listener
+		path string
+		want int
+	}{
+		{api, "/api/v1/calculate?ip=10.0.0.1&mask=/8", http.StatusOK},
+		{api, "/", http.StatusNotFound},
+		{api, "/health", http.StatusOK},
+		{ui, "/", http.StatusOK},
+		{ui, "/api/v1/calculate?ip=10.0.0.1&mask=/8", http.StatusNotFound},
+		{ui, "/health", http.StatusOK},
+		{all, "/", http.StatusOK},
+		{all, "/api/v1/calculate?ip=10.0.0.1&mask=/8", http.StatusOK},
+	} {
+		if got := status(tt.l, tt.path); got != tt.want {
+			t.Errorf("%q listener, GET %s = %d, want %d", tt.l.scope, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestTLSListener(t *testing.T) {
+	withTestListeners(t)
+	certFile, keyFile := writeTestCertificate(t)
+	t.Setenv("GO_SUBNET_CALCULATOR_LISTEN", "https://127.0.0.1:0/api")
+	t.Setenv("GO_SUBNET_CALCULATOR_TLS_CERT", certFile)
+	t.Setenv("GO_SUBNET_CALCULATOR_TLS_KEY", keyFile)
+	if err := configureListeners(); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", healthHandler)
+	srv := listeners[0].server(mux)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + ln.Addr().String() + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil || resp.Header.Get("X-Request-ID") == "" {
+		t.Errorf("GET /health over TLS = %d, TLS %v", resp.StatusCode, resp.TLS != nil)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loadTestScenario is one kind of request the load tester can send
+type loadTestScenario struct {
+	Name   string
+	Method string
+	Path   string
+	Body   string
+	Type   string
+}
+
+// loadTestScenarios are the endpoints that can be mixed with -mix name=weight
+var loadTestScenarios = map[string]loadTestScenario{
+	"ui":          {Name: "ui", Method: http.MethodGet, Path: "/"},
+	"calculate":   {Name: "calculate", Method: http.MethodPost, Path: "/", Body: url.Values{"ip": {"192.168.1.100"}, "mask": {"/24"}}.Encode(), Type: "application/x-www-form-urlencoded"},
+	"health":      {Name: "health", Method: http.MethodGet, Path: "/health"},
+	"cheatsheet":  {Name: "cheatsheet", Method: http.MethodGet, Path: "/cheatsheet?format=json"},
+	"deaggregate": {Name: "deaggregate", Method: http.MethodGet, Path: "/api/v1/deaggregate?prefix=10.0.0.0/16&length=24"},
+	"subtract":    {Name: "subtract", Method: http.MethodPost, Path: "/api/v1/subtract", Body: `{"network":"10.0.0.0/8","used":["10.1.0.0/16","10.200.0.0/14"]}`, Type: "application/json"},
+	"free":        {Name: "free", Method: http.MethodPost, Path: "/api/v1/free", Body: `{"supernet":"10.0.0.0/16","allocated":["10.0.0.0/20","10.0.32.0/19"],"size":22}`, Type: "application/json"},
+	"cover":       {Name: "cover", Method: http.MethodPost, Path: "/api/v1/cover", Body: `{"addresses":["10.0.0.1","10.0.0.77","10.0.9.1","172.16.4.4"],"max_prefixes":2}`, Type: "application/json"},
+}
+
+// loadTestConfig holds the parsed command-line options of the loadtest subcommand
+type loadTestConfig struct {
+	Target      string
+	Duration    time.Duration
+	Concurrency int
+	Ramp        time.Duration
+	Timeout     time.Duration
+	MaxErrors   float64
+	Mix         []weightedScenario
+}
+
+type weightedScenario struct {
+	scenario loadTestScenario
+	weight   int
+}
+
+// loadTestSample is the outcome of one request
+type loadTestSample struct {
+	scenario string
+	latency  time.Duration
+	failed   bool
+}
+
+// parseLoadTestMix parses "name=weight,name=weight" into weighted scenarios
+func parseLoadTestMix(mix string) ([]weightedScenario, error) {
+	var weighted []weightedScenario
+	for _, item := range strings.Split(mix, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, weightStr, hasWeight := strings.Cut(item, "=")
+		weight := 1
+		if hasWeight {
+			w, err := strconv.Atoi(weightStr)
+			if err != nil || w < 1 {
+				return nil, fmt.Errorf("invalid weight for %s: %s", name, weightStr)
+			}
+			weight = w
+		}
+		scenario, ok := loadTestScenarios[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown scenario: %s", name)
+		}
+		weighted = append(weighted, weightedScenario{scenario: scenario, weight: weight})
+	}
+	if len(weighted) == 0 {
+		return nil, fmt.Errorf("mix must name at least one scenario")
+	}
+	return weighted, nil
+}
+
+// pickScenario selects a scenario at random according to the mix weights
+func pickScenario(mix []weightedScenario, rng *rand.Rand) loadTestScenario {
+	total := 0
+	for _, w := range mix {
+		total += w.weight
+	}
+	n := rng.IntN(total)
+	for _, w := range mix {
+		if n < w.weight {
+			return w.scenario
+		}
+		n -= w.weight
+	}
+	return mix[len(mix)-1].scenario
+}
+
+// parseLoadTestFlags parses the loadtest subcommand arguments
+func parseLoadTestFlags(args []string, output io.Writer) (*loadTestConfig, error) {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	var names []string
+	for name := range loadTestScenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cfg := &loadTestConfig{}
+	var mix string
+	fs.StringVar(&cfg.Target, "target", "http://localhost:8080", "base URL of the instance under test")
+	fs.DurationVar(&cfg.Duration, "duration", 30*time.Second, "total test duration")
+	fs.IntVar(&cfg.Concurrency, "concurrency", 10, "maximum number of concurrent workers")
+	fs.DurationVar(&cfg.Ramp, "ramp", 0, "time over which workers are started, from 1 up to -concurrency")
+	fs.DurationVar(&cfg.Timeout, "timeout", 5*time.Second, "per-request timeout")
+	fs.Float64Var(&cfg.MaxErrors, "max-error-rate", 1, "error rate in percent above which the command exits non-zero")
+	fs.StringVar(&mix, "mix", "calculate=5,ui=2,health=1", "weighted scenarios: "+strings.Join(names, ", "))
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if cfg.Concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1")
+	}
+	if cfg.Duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+	if cfg.Ramp < 0 || cfg.Ramp > cfg.Duration {
+		return nil, fmt.Errorf("ramp must be between 0 and the duration")
+	}
+	if _, err := url.ParseRequestURI(cfg.Target); err != nil {
+		return nil, fmt.Errorf("invalid target: %s", cfg.Target)
+	}
+	cfg.Target = strings.TrimRight(cfg.Target, "/")
+
+	weighted, err := parseLoadTestMix(mix)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Mix = weighted
+	return cfg, nil
+}
+
+// runLoadTestWorkers drives the target until the deadline and collects every sample
+func runLoadTestWorkers(cfg *loadTestConfig) ([]loadTestSample, time.Duration) {
+	client := &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: &http.Transport{MaxIdleConnsPerHost: cfg.Concurrency},
+	}
+
+	start := time.Now()
+	deadline := start.Add(cfg.Duration)
+	samples := make(chan loadTestSample, cfg.Concurrency*4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		// Spread worker start times evenly across the ramp period
+		var delay time.Duration
+		if cfg.Ramp > 0 && cfg.Concurrency > 1 {
+			delay = cfg.Ramp * time.Duration(i) / time.Duration(cfg.Concurrency-1)
+		}
+
+		wg.Add(1)
+		go func(worker int, delay time.Duration) {
+			defer wg.Done()
+			time.Sleep(delay)
+			rng := rand.New(rand.NewPCG(uint64(start.UnixNano()), uint64(worker)))
+			for time.Now().Before(deadline) {
+				samples <- sendLoadTestRequest(client, cfg.Target, pickScenario(cfg.Mix, rng))
+			}
+		}(i, delay)
+	}
+
+	go func() {
+		wg.Wait()
+		close(samples)
+	}()
+
+	var collected []loadTestSample
+	for s := range samples {
+		collected = append(collected, s)
+	}
+	return collected, time.Since(start)
+}
+
+// sendLoadTestRequest performs one request and measures it
+func sendLoadTestRequest(client *http.Client, target string, scenario loadTestScenario) loadTestSample {
+	sample := loadTestSample{scenario: scenario.Name}
+
+	req, err := http.NewRequest(scenario.Method, target+scenario.Path, strings.NewReader(scenario.Body))
+	if err != nil {
+		sample.failed = true
+		return sample
+	}
+	if scenario.Type != "" {
+		req.Header.Set("Content-Type", scenario.Type)
+	}
+
+	begin := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		sample.latency = time.Since(begin)
+		sample.failed = true
+		return sample
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	sample.latency = time.Since(begin)
+	sample.failed = resp.StatusCode >= 400
+	return sample
+}
+
+// percentile returns the p-th percentile of sorted latencies using nearest-rank
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// writeLoadTestReport prints overall and per-scenario statistics
+func writeLoadTestReport(w io.Writer, samples []loadTestSample, elapsed time.Duration) {
+	groups := map[string][]loadTestSample{"total": samples}
+	var names []string
+	for _, s := range samples {
+		if _, ok := groups[s.scenario]; !ok {
+			names = append(names, s.scenario)
+		}
+		groups[s.scenario] = append(groups[s.scenario], s)
+	}
+	sort.Strings(names)
+	names = append(names, "total")
+
+	fmt.Fprintf(w, "Duration: %s, requests: %d, throughput: %.1f req/s\n\n", elapsed.Round(time.Millisecond), len(samples), float64(len(samples))/elapsed.Seconds())
+	fmt.Fprintf(w, "%-12s %9s %8s %8s %10s %10s %10s %10s\n", "scenario", "requests", "errors", "err%", "p50", "p90", "p99", "max")
+	for _, name := range names {
+		group := groups[name]
+		latencies := make([]time.Duration, len(group))
+		errors := 0
+		for i, s := range group {
+			latencies[i] = s.latency
+			if s.failed {
+				errors++
+			}
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+		errorRate := 0.0
+		if len(group) > 0 {
+			errorRate = float64(errors) * 100 / float64(len(group))
+		}
+		fmt.Fprintf(w, "%-12s %9d %8d %7.2f%% %10s %10s %10s %10s\n", name, len(group), errors, errorRate,
+			percentile(latencies, 50).Round(time.Microsecond),
+			percentile(latencies, 90).Round(time.Microsecond),
+			percentile(latencies, 99).Round(time.Microsecond),
+			percentile(latencies, 100).Round(time.Microsecond))
+	}
+}
+
+// runLoadTest implements the "loadtest" subcommand and returns the process exit code
+func runLoadTest(args []string, output io.Writer) int {
+	cfg, err := parseLoadTestFlags(args, output)
+	if err != nil {
+		if err != flag.ErrHelp {
+			fmt.Fprintf(output, "loadtest: %v\n", err)
+		}
+		return 2
+	}
+
+	fmt.Fprintf(output, "Load testing %s for %s with up to %d workers (ramp %s)\n", cfg.Target, cfg.Duration, cfg.Concurrency, cfg.Ramp)
+	samples, elapsed := runLoadTestWorkers(cfg)
+	writeLoadTestReport(output, samples, elapsed)
+
+	errors := 0
+	for _, s := range samples {
+		if s.failed {
+			errors++
+		}
+	}
+	if len(samples) == 0 || float64(errors)*100/float64(len(samples)) > cfg.MaxErrors {
+		return 1
+	}
+	return 0
+}
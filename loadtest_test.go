@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLoadTestMix(t *testing.T) {
+	mix, err := parseLoadTestMix("calculate=3, health")
+	if err != nil {
+		t.Fatalf("parseLoadTestMix() unexpected error: %v", err)
+	}
+	if len(mix) != 2 || mix[0].weight != 3 || mix[1].weight != 1 || mix[1].scenario.Path != "/health" {
+		t.Errorf("parseLoadTestMix() = %+v", mix)
+	}
+
+	for _, bad := range []string{"", "nope=1", "health=0", "health=x"} {
+		if _, err := parseLoadTestMix(bad); err == nil {
+			t.Errorf("parseLoadTestMix(%q) expected error, got nil", bad)
+		}
+	}
+}
+
+func TestPickScenarioHonorsWeights(t *testing.T) {
+	mix, _ := parseLoadTestMix("calculate=9,health=1")
+	rng := rand.New(rand.NewPCG(1, 2))
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		counts[pickScenario(mix, rng).Name]++
+	}
+	if counts["calculate"] < 8500 || counts["health"] < 500 {
+		t.Errorf("pickScenario() distribution = %v, want roughly 9:1", counts)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	tests := map[float64]time.Duration{50: 50 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond}
+	for p, expected := range tests {
+		if got := percentile(latencies, p); got != expected {
+			t.Errorf("percentile(%v) = %s, want %s", p, got, expected)
+		}
+	}
+	if percentile(nil, 50) != 0 {
+		t.Error("percentile() of no samples should be 0")
+	}
+}
+
+func TestParseLoadTestFlagsValidation(t *testing.T) {
+	var out bytes.Buffer
+	for _, args := range [][]string{
+		{"-concurrency", "0"},
+		{"-duration", "0s"},
+		{"-duration", "1s", "-ramp", "2s"},
+		{"-target", "not a url"},
+		{"-mix", "bogus"},
+	} {
+		if _, err := parseLoadTestFlags(args, &out); err == nil {
+			t.Errorf("parseLoadTestFlags(%v) expected error, got nil", args)
+		}
+	}
+}
+
+func TestRunLoadTestAgainstServer(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler)
+	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/api/v1/subtract", subtractHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	var out bytes.Buffer
+	code := runLoadTest([]string{
+		"-target", server.URL,
+		"-duration", "300ms",
+		"-concurrency", "4",
+		"-ramp", "100ms",
+		"-mix", "calculate=2,health=1,subtract=1",
+	}, &out)
+
+	if code != 0 {
+		t.Errorf("runLoadTest() exit code = %d, want 0\n%s", code, out.String())
+	}
+	for _, want := range []string{"calculate", "health", "subtract", "total", "p99"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunLoadTestReportsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	code := runLoadTest([]string{"-target", server.URL, "-duration", "100ms", "-concurrency", "2", "-mix", "health"}, &out)
+	if code != 1 {
+		t.Errorf("runLoadTest() exit code = %d, want 1", code)
+	}
+	if !strings.Contains(out.String(), "100.00%") {
+		t.Errorf("report should show a 100%% error rate:\n%s", out.String())
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/prefixtrie"
+)
+
+// Route is a single routing table entry
+type Route struct {
+	Prefix   string `json:"prefix"`
+	NextHop  string `json:"next_hop"`
+	Protocol string `json:"protocol,omitempty"`
+	Line     int    `json:"line"`
+}
+
+// routeTrie indexes routes by prefix for longest-prefix matching
+type routeTrie = prefixtrie.Trie[*Route]
+
+// matchingRoutes returns every route whose prefix contains ip, from least to most specific
+func matchingRoutes(trie *routeTrie, ip net.IP) []*Route {
+	var found []*Route
+	for _, e := range trie.Matches(ip) {
+		found = append(found, e.Value)
+	}
+	return found
+}
+
+// lookupRoute returns the longest-prefix match for ip, or nil if no route matches
+func lookupRoute(trie *routeTrie, ip net.IP) *Route {
+	if e, ok := trie.Lookup(ip); ok {
+		return e.Value
+	}
+	return nil
+}
+
+// buildRouteTrie indexes routes by prefix. Later duplicates replace earlier ones
+func buildRouteTrie(routes []*Route) (*routeTrie, error) {
+	trie := prefixtrie.New[*Route]()
+	for _, route := range routes {
+		network, err := parseIPv4Prefix(route.Prefix)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", route.Line, err)
+		}
+		trie.Insert(network, route)
+	}
+	return trie, nil
+}
+
+// parseRoutingTable parses a routing table in any supported format into a trie
+func parseRoutingTable(table, format string) (*routeTrie, error) {
+	routes, _, err := parseRoutes(table, format)
+	if err != nil {
+		return nil, err
+	}
+	return buildRouteTrie(routes)
+}
+
+// LPMRequest holds a pasted routing table and the destination to look up.
+// Format is one of the routeParsers names; it is detected when empty
+type LPMRequest struct {
+	Table       string `json:"table"`
+	Format      string `json:"format,omitempty"`
+	Destination string `json:"destination"`
+}
+
+// LPMResult lists every candidate route for a destination and the winning route
+type LPMResult struct {
+	Table       string   `json:"-"`
+	Destination string   `json:"destination"`
+	Routes      int      `json:"routes"`
+	Candidates  []*Route `json:"candidates"`
+	Match       *Route   `json:"match"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// longestPrefixMatch parses the table and looks up the destination in it
+func longestPrefixMatch(req LPMRequest) (*LPMResult, error) {
+	result := &LPMResult{Table: req.Table, Destination: strings.TrimSpace(req.Destination)}
+
+	ip := net.ParseIP(result.Destination)
+	if ip == nil || ip.To4() == nil {
+		return result, fmt.Errorf("invalid IPv4 destination: %s", result.Destination)
+	}
+	trie, err := parseRoutingTable(req.Table, req.Format)
+	if err != nil {
+		return result, err
+	}
+
+	result.Routes = trie.Len()
+	result.Candidates = matchingRoutes(trie, ip)
+	result.Match = lookupRoute(trie, ip)
+	return result, nil
+}
+
+// lpmHandler serves POST /api/v1/lpm
+func lpmHandler(w http.ResponseWriter, r *http.Request) {
+	var req LPMRequest
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+
+	result, err := longestPrefixMatch(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// lpmPageHandler serves the /lpm page where a routing table can be pasted and queried
+func lpmPageHandler(w http.ResponseWriter, r *http.Request) {
+	if !parseFormBody(w, r) {
+		return
+	}
+	tmpl, err := loadTemplate("lpm.html")
+	if err != nil {
+		logRequestf(r.Context(), "Template loading error: %v", err)
+		http.Error(w, "Template loading error", http.StatusInternalServerError)
+		return
+	}
+
+	result := &LPMResult{}
+	if r.Method == http.MethodPost {
+		req := LPMRequest{Table: r.FormValue("table"), Destination: r.FormValue("destination")}
+		if result, err = longestPrefixMatch(req); err != nil {
+			result.Error = err.Error()
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, result); err != nil {
+		logRequestf(r.Context(), "Template execution error: %v", err)
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+	}
+}
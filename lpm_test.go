@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testRoutingTable = `# sample table
+0.0.0.0/0 via 192.0.2.1
+10.0.0.0/8 via 192.0.2.2
+10.1.0.0/16 192.0.2.3
+10.1.2.0/24 via 192.0.2.4 dev eth1
+
+10.1.2.3/32 via 192.0.2.5
+`
+
+func TestPrefixTrieLookup(t *testing.T) {
+	trie, err := parseRoutingTable(testRoutingTable, "")
+	if err != nil {
+		t.Fatalf("parseRoutingTable() unexpected error: %v", err)
+	}
+	if trie.Len() != 5 {
+		t.Errorf("trie size = %d, want 5", trie.Len())
+	}
+
+	tests := []struct {
+		destination string
+		winner      string
+		nextHop     string
+		candidates  int
+	}{
+		{"10.1.2.3", "10.1.2.3/32", "192.0.2.5", 5},
+		{"10.1.2.4", "10.1.2.0/24", "192.0.2.4 dev eth1", 4},
+		{"10.1.9.9", "10.1.0.0/16", "192.0.2.3", 3},
+		{"10.200.0.1", "10.0.0.0/8", "192.0.2.2", 2},
+		{"8.8.8.8", "0.0.0.0/0", "192.0.2.1", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.destination, func(t *testing.T) {
+			ip := net.ParseIP(tt.destination)
+			route := lookupRoute(trie, ip)
+			if route == nil || route.Prefix != tt.winner || route.NextHop != tt.nextHop {
+				t.Errorf("lookup(%s) = %+v, want %s via %s", tt.destination, route, tt.winner, tt.nextHop)
+			}
+			if got := len(matchingRoutes(trie, ip)); got != tt.candidates {
+				t.Errorf("matches(%s) = %d candidates, want %d", tt.destination, got, tt.candidates)
+			}
+		})
+	}
+}
+
+func TestPrefixTrieNoMatchAndReplace(t *testing.T) {
+	trie, err := parseRoutingTable("10.0.0.0/8 via a\n10.0.0.0/8 via b", "flat")
+	if err != nil {
+		t.Fatalf("parseRoutingTable() unexpected error: %v", err)
+	}
+	if trie.Len() != 1 {
+		t.Errorf("duplicate prefix should replace, size = %d", trie.Len())
+	}
+	if route := lookupRoute(trie, net.ParseIP("10.0.0.1")); route == nil || route.NextHop != "b" {
+		t.Errorf("lookup() = %+v, want next hop b", route)
+	}
+	if route := lookupRoute(trie, net.ParseIP("11.0.0.1")); route != nil {
+		t.Errorf("lookup() outside table = %+v, want nil", route)
+	}
+}
+
+func TestParseRoutingTableErrors(t *testing.T) {
+	_, err := parseRoutingTable("10.0.0.0/8 via a\nnot-a-prefix via b", "flat")
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("parseRoutingTable() error = %v, want line 2 error", err)
+	}
+}
+
+func TestLPMHandler(t *testing.T) {
+	body, _ := json.Marshal(LPMRequest{Table: testRoutingTable, Destination: "10.1.2.9"})
+	rr := httptest.NewRecorder()
+	lpmHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/lpm", strings.NewReader(string(body))))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body: %s)", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var resp LPMResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if resp.Match == nil || resp.Match.Prefix != "10.1.2.0/24" || len(resp.Candidates) != 4 {
+		t.Errorf("response = %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	lpmHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/lpm", strings.NewReader(`{"table":"","destination":"nope"}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid destination status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestLPMPageHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	lpmPageHandler(rr, httptest.NewRequest(http.MethodGet, "/lpm", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Longest-Prefix-Match Tester") {
+		t.Fatalf("GET /lpm = %d", rr.Code)
+	}
+
+	form := url.Values{"table": {testRoutingTable}, "destination": {"10.1.2.3"}}
+	req := httptest.NewRequest(http.MethodPost, "/lpm", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	lpmPageHandler(rr, req)
+
+	body := rr.Body.String()
+	if !strings.Contains(body, "10.1.2.3/32") || !strings.Contains(body, "best match") {
+		t.Errorf("POST /lpm should show the winning route, got: %s", body)
+	}
+}
@@ -1,27 +1,85 @@
 package main
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
+	"math/bits"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type SubnetResult struct {
-	IPAddress        string
-	SubnetMask       string
-	NetworkAddress   string
-	BroadcastAddress string
-	MinHostAddress   string
-	MaxHostAddress   string
-	UsableHosts      string
-	Error            string
+	IPAddress        string `json:"ip_address"`
+	SubnetMask       string `json:"subnet_mask"`
+	NetworkAddress   string `json:"network_address"`
+	BroadcastAddress string `json:"broadcast_address"`
+	MinHostAddress   string `json:"min_host_address"`
+	MaxHostAddress   string `json:"max_host_address"`
+	UsableHosts      string `json:"usable_hosts"`
+	Error            string `json:"error,omitempty"`
+
+	// Cloud provider whose reservations were applied, if any
+	Cloud      string            `json:"cloud,omitempty"`
+	Reserved   []ReservedAddress `json:"reserved,omitempty"`
+	CloudNotes []string          `json:"notes,omitempty"`
+	Providers  []CloudProvider   `json:"-"`
+
+	// Config generator selected in the form and its rendered output
+	Generator   string            `json:"-"`
+	Generators  []ConfigGenerator `json:"-"`
+	Config      string            `json:"-"`
+	ConfigError string            `json:"-"`
+
+	// Saved and recent calculations of a signed-in user
+	Owner  string         `json:"-"`
+	Saved  []*Calculation `json:"-"`
+	Recent []*Calculation `json:"-"`
+
+	// Short link the result is shown under
+	Share string `json:"-"`
+
+	// Worked solution, when asked for with explain
+	Explain     bool         `json:"-"`
+	Explanation *Explanation `json:"explanation,omitempty"`
+
+	// Suggested gateway, static range and DHCP pool, when asked for with dhcp
+	DHCPOptions *DHCPPoolOptions `json:"-"`
+	DHCP        *DHCPSuggestion  `json:"dhcp,omitempty"`
+	DHCPError   string           `json:"-"`
+
+	// How shorthand input such as 10/8 was read
+	Normalization string `json:"normalization,omitempty"`
+
+	// Address, network and broadcast as 32-bit integers
+	Integers *IntegerForms `json:"integers,omitempty"`
+
+	// Special-purpose and bogon blocks the network falls into or spans
+	SpecialPurpose []SpecialPurposeMatch `json:"special_purpose,omitempty"`
+
+	// RDAP registration of a public address, when lookups are enabled
+	Registration *Registration `json:"registration,omitempty"`
+
+	// GeoIP country, city and ASN of a public address, when a database is loaded
+	Location *GeoLocation `json:"location,omitempty"`
+
+	// Blocklists the address is listed on, when reputation checks are configured
+	Reputation *Reputation `json:"reputation,omitempty"`
+
+	// BGP origin AS and announced prefix of a public address, when lookups are enabled
+	Origin *BGPOrigin `json:"origin,omitempty"`
+
+	// Theme the page is rendered with and the themes to pick from
+	Theme  string  `json:"-"`
+	Themes []Theme `json:"-"`
 }
 
 type HealthResponse struct {
@@ -29,6 +87,8 @@ type HealthResponse struct {
 	Timestamp time.Time `json:"timestamp"`
 	Version   string    `json:"version,omitempty"`
 	Uptime    string    `json:"uptime,omitempty"`
+
+	Components map[string]ComponentHealth `json:"components,omitempty"`
 }
 
 // required for health-check
@@ -45,16 +105,24 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	// Calculate uptime
 	uptime := time.Since(startTime)
 
+	// Check the templates, the storage and the external datasets
+	status, components := checkComponents(r.Context())
+
 	// Create health response
 	health := HealthResponse{
-		Status:    "healthy",
-		Timestamp: time.Now(),
-		Version:   "1.0.0", // You can make this dynamic if needed
-		Uptime:    uptime.String(),
+		Status:     status,
+		Timestamp:  time.Now(),
+		Version:    version,
+		Uptime:     uptime.String(),
+		Components: components,
 	}
 
-	// Return HTTP 200 OK with health status
-	w.WriteHeader(http.StatusOK)
+	// Return HTTP 200 OK unless a critical component failed
+	if status == "unhealthy" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
 
 	// Encode and send JSON response
 	if err := json.NewEncoder(w).Encode(health); err != nil {
@@ -76,7 +144,7 @@ func loadTemplate(filename ...string) (*template.Template, error) {
 		return nil, fmt.Errorf("failed to read %s: %v", file, err)
 	}
 
-	tmpl, err := template.New("subnet").Parse(string(templateData))
+	tmpl, err := template.New("subnet").Funcs(templateFuncs).Parse(string(templateData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse template: %v", err)
 	}
@@ -86,179 +154,230 @@ func loadTemplate(filename ...string) (*template.Template, error) {
 
 // isValidSubnetMask validates that the IP mask has contiguous 1s followed by contiguous 0s
 func isValidSubnetMask(mask net.IPMask) bool {
-	// Convert mask to 32-bit integer
-	maskInt := uint32(mask[0])<<24 | uint32(mask[1])<<16 | uint32(mask[2])<<8 | uint32(mask[3])
-
-	// Find the number of leading 1s
-	leadingOnes := 0
-	for i := 31; i >= 0; i-- {
-		if maskInt&(1<<uint(i)) != 0 {
-			leadingOnes++
-		} else {
-			break
+	return contiguousMask(binary.BigEndian.Uint32(mask))
+}
+
+// contiguousMask reports whether a 32-bit mask is a run of 1s followed by 0s
+func contiguousMask(mask uint32) bool {
+	// The host part of a valid mask is a run of 1s from the lowest bit, so adding one
+	// to it leaves no bit in common with it
+	hostBits := ^mask
+	return hostBits&(hostBits+1) == 0
+}
+
+// binaryMask parses a mask written as 32 binary digits, in four dotted groups of
+// eight (11111111.11111111.11111111.00000000) or in one run
+func binaryMask(mask string) (uint32, bool) {
+	digits := strings.ReplaceAll(mask, ".", "")
+	if len(digits) != 32 || (digits != mask && len(mask) != 35) {
+		return 0, false
+	}
+	var value uint32
+	for i := 0; i < len(mask); i++ {
+		switch c := mask[i]; {
+		case c == '.' && i%9 == 8:
+		case c == '0' || c == '1':
+			value = value<<1 | uint32(c-'0')
+		default:
+			return 0, false
 		}
 	}
+	return value, true
+}
 
-	// Check if remaining bits are all 0s
-	expectedMask := uint32(0xFFFFFFFF) << uint(32-leadingOnes)
-	return maskInt == expectedMask
+// formatBinaryMask writes a mask as four dotted groups of eight binary digits
+func formatBinaryMask(mask uint32) string {
+	return fmt.Sprintf("%08b.%08b.%08b.%08b", mask>>24, mask>>16&0xff, mask>>8&0xff, mask&0xff)
 }
 
-// parseSubnetMask parses subnet mask in either dotted decimal or CIDR notation
-func parseSubnetMask(mask string) (net.IPMask, error) {
+// isBarePrefixLength reports whether mask is a prefix length written without the
+// slash: one or two digits, as the 32 digits of a binary mask are not
+func isBarePrefixLength(mask string) bool {
+	return mask != "" && len(mask) <= 2 && strings.Trim(mask, "0123456789") == ""
+}
+
+// parseMaskLength parses a subnet mask in CIDR notation (/24, or 24 without the
+// slash), dotted decimal (255.255.255.0), hex (0xffffff00) or binary
+// (11111111.11111111.11111111.00000000) and returns its prefix length
+func parseMaskLength(mask string) (int, error) {
 	mask = strings.TrimSpace(mask)
 
-	// Handle CIDR notation (e.g., /24)
-	if strings.HasPrefix(mask, "/") {
-		cidr, err := strconv.Atoi(mask[1:])
+	// Handle CIDR notation (e.g., /24 or 24)
+	if length, ok := strings.CutPrefix(mask, "/"); ok || isBarePrefixLength(mask) {
+		cidr, err := strconv.Atoi(length)
 		if err != nil || cidr < 0 || cidr > 32 {
-			return nil, fmt.Errorf("invalid CIDR notation: %s", mask)
+			return 0, fmt.Errorf("invalid CIDR notation: %s", mask)
 		}
-		return net.CIDRMask(cidr, 32), nil
+		return cidr, nil
 	}
 
-	// Handle dotted decimal notation (e.g., 255.255.255.0)
-	ip := net.ParseIP(mask)
-	if ip == nil {
-		return nil, fmt.Errorf("invalid subnet mask format: %s", mask)
+	var value uint32
+	if isHexNumber(mask) {
+		// Handle hex notation (e.g., 0xffffff00)
+		n, err := strconv.ParseUint(mask[2:], 16, 32)
+		if err != nil || len(mask) != 10 {
+			return 0, fmt.Errorf("invalid hex subnet mask: %s (must be 0x followed by 8 hex digits)", mask)
+		}
+		value = uint32(n)
+	} else if n, ok := binaryMask(mask); ok {
+		// Handle binary notation (e.g., 11111111.11111111.11111111.00000000)
+		value = n
+	} else {
+		// Handle dotted decimal notation (e.g., 255.255.255.0)
+		addr, err := netip.ParseAddr(mask)
+		if err != nil || addr.Zone() != "" {
+			return 0, fmt.Errorf("invalid subnet mask format: %s", mask)
+		}
+		addr = addr.Unmap()
+		if !addr.Is4() {
+			return 0, fmt.Errorf("not a valid IPv4 mask: %s", mask)
+		}
+		value = addrToUint32(addr)
 	}
 
-	ipv4 := ip.To4()
-	if ipv4 == nil {
-		return nil, fmt.Errorf("not a valid IPv4 mask: %s", mask)
+	// Validate that it's a proper subnet mask (contiguous 1s followed by 0s)
+	if !contiguousMask(value) {
+		ones := bits.LeadingZeros32(^value)
+		stray := ones + bits.LeadingZeros32(value<<uint(ones)) + 1
+		return 0, fmt.Errorf("invalid subnet mask: %s (must have contiguous 1s followed by 0s, but in %s bit %d is 1 after a 0)", mask, formatBinaryMask(value), stray)
 	}
 
-	subnetMask := net.IPMask(ipv4)
+	return bits.OnesCount32(value), nil
+}
 
-	// Validate that it's a proper subnet mask (contiguous 1s followed by 0s)
-	if !isValidSubnetMask(subnetMask) {
-		return nil, fmt.Errorf("invalid subnet mask: %s (must have contiguous 1s followed by 0s)", mask)
+// parseSubnetMask parses subnet mask in either dotted decimal or CIDR notation
+func parseSubnetMask(mask string) (net.IPMask, error) {
+	ones, err := parseMaskLength(mask)
+	if err != nil {
+		return nil, err
 	}
+	return net.CIDRMask(ones, 32), nil
+}
 
-	return subnetMask, nil
+// subnetBounds is a calculated subnet before its addresses are formatted: the network
+// address, the broadcast address and the prefix length. For a /32 the network and
+// broadcast address are both the entered address
+type subnetBounds struct {
+	network   netip.Addr
+	broadcast netip.Addr
+	prefixLen int
 }
 
-// calculateSubnet performs the subnet calculations
-func calculateSubnet(ipStr, maskStr string) (*SubnetResult, error) {
-	// Parse IP address
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return nil, fmt.Errorf("invalid IP address: %s", ipStr)
+// computeSubnet parses the address and mask of a calculation and works out its subnet
+// without allocating
+func computeSubnet(ipStr, maskStr string) (subnetBounds, error) {
+	// Parse IP address; IPv4-mapped IPv6 addresses count as IPv4
+	addr, err := netip.ParseAddr(ipStr)
+	if err != nil || addr.Zone() != "" {
+		return subnetBounds{}, fmt.Errorf("invalid IP address: %s", ipStr)
 	}
-
-	ipv4 := ip.To4()
-	if ipv4 == nil {
-		return nil, fmt.Errorf("not a valid IPv4 address: %s", ipStr)
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return subnetBounds{}, fmt.Errorf("not a valid IPv4 address: %s", ipStr)
 	}
 
 	// Parse subnet mask
-	mask, err := parseSubnetMask(maskStr)
+	prefixLen, err := parseMaskLength(maskStr)
 	if err != nil {
-		return nil, err
+		return subnetBounds{}, err
 	}
 
-	// Get CIDR prefix length for corner case handling
-	prefixLen, _ := mask.Size()
+	// Network address is the first address of the prefix, the broadcast address the
+	// last one
+	network := netip.PrefixFrom(addr, prefixLen).Masked().Addr()
+	broadcast := uint32ToAddr(addrToUint32(network) | uint32(uint64(1)<<uint(32-prefixLen)-1))
+	return subnetBounds{network: network, broadcast: broadcast, prefixLen: prefixLen}, nil
+}
 
-	// Create network
-	network := &net.IPNet{
-		IP:   ipv4.Mask(mask),
-		Mask: mask,
+// hosts returns the first and last usable host address. /31 point-to-point links
+// (RFC 3021) and /32 single hosts have no usable hosts in the traditional sense
+func (b subnetBounds) hosts() (first, last netip.Addr, ok bool) {
+	if b.prefixLen >= 31 {
+		return netip.Addr{}, netip.Addr{}, false
 	}
+	// Normal subnets: the hosts lie between the network and broadcast addresses
+	return b.network.Next(), b.broadcast.Prev(), true
+}
 
-	// Calculate network address (first IP in subnet)
-	networkAddr := network.IP
-
-	// Calculate broadcast address (last IP in subnet)
-	broadcastAddr := make(net.IP, 4)
-	for i := 0; i < 4; i++ {
-		broadcastAddr[i] = networkAddr[i] | ^mask[i]
+// calculateSubnet performs the subnet calculations
+func calculateSubnet(ipStr, maskStr string) (*SubnetResult, error) {
+	b, err := computeSubnet(ipStr, maskStr)
+	if err != nil {
+		return nil, err
 	}
-
 	result := &SubnetResult{
-		NetworkAddress:   networkAddr.String(),
-		BroadcastAddress: broadcastAddr.String(),
-	}
-
-	// Handle corner cases based on prefix length
-	switch prefixLen {
-	case 32:
-		// /32: Single host, network = broadcast = entered IP
-		// No usable host addresses
-		result.NetworkAddress = ipv4.String()
-		result.BroadcastAddress = ipv4.String()
-		result.MinHostAddress = "N/A"
-		result.MaxHostAddress = "N/A"
-		result.UsableHosts = "0"
-
-	case 31:
-		// /31: Point-to-point link (RFC 3021)
-		// No usable host addresses in traditional sense
-		result.MinHostAddress = "N/A"
-		result.MaxHostAddress = "N/A"
-		result.UsableHosts = "0"
-
-	default:
-		// Normal subnets: calculate min/max host addresses
-		// Calculate min host address (network + 1)
-		minHostAddr := make(net.IP, 4)
-		copy(minHostAddr, networkAddr)
-		// Add 1 to the network address
-		for i := 3; i >= 0; i-- {
-			if minHostAddr[i] < 255 {
-				minHostAddr[i]++
-				break
-			}
-			minHostAddr[i] = 0
-		}
-
-		// Calculate max host address (broadcast - 1)
-		maxHostAddr := make(net.IP, 4)
-		copy(maxHostAddr, broadcastAddr)
-		// Subtract 1 from the broadcast address
-		for i := 3; i >= 0; i-- {
-			if maxHostAddr[i] > 0 {
-				maxHostAddr[i]--
-				break
-			}
-			maxHostAddr[i] = 255
-		}
-
-		result.MinHostAddress = minHostAddr.String()
-		result.MaxHostAddress = maxHostAddr.String()
-
-		// Calculate number of usable hosts
-		// Total hosts in subnet = 2^(32-prefix) - 2 (network and broadcast)
-		totalHosts := 1 << uint(32-prefixLen)
-		usableHosts := totalHosts - 2
-		if usableHosts < 0 {
-			usableHosts = 0
-		}
-		result.UsableHosts = fmt.Sprintf("%d", usableHosts)
+		NetworkAddress:   b.network.String(),
+		BroadcastAddress: b.broadcast.String(),
+		MinHostAddress:   "N/A",
+		MaxHostAddress:   "N/A",
+		UsableHosts:      strconv.FormatUint(usableHostCount(b.prefixLen), 10),
+	}
+	if first, last, ok := b.hosts(); ok {
+		result.MinHostAddress = first.String()
+		result.MaxHostAddress = last.String()
 	}
-
 	return result, nil
 }
 
+// usableHostCount returns the number of assignable host addresses for a prefix length.
+// Total hosts in subnet = 2^(32-prefix) - 2 (network and broadcast); /31 and /32 have none
+func usableHostCount(prefixLen int) uint64 {
+	if prefixLen >= 31 {
+		return 0
+	}
+	return (uint64(1) << uint(32-prefixLen)) - 2
+}
+
 func handler(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := loadTemplate()
-	if err != nil {
-		log.Printf("Template loading error: %v", err)
-		http.Error(w, "Template loading error", http.StatusInternalServerError)
+	if !parseFormBody(w, r) {
 		return
 	}
+	result := &SubnetResult{Generators: listConfigGenerators(), Providers: cloudProviders, Owner: calculationOwner(r)}
 
-	result := &SubnetResult{}
+	if r.Method == http.MethodPost && r.FormValue("action") == "delete-calculation" {
+		id, _ := strconv.ParseInt(r.FormValue("calculation"), 10, 64)
+		if _, err := ownedCalculation(result.Owner, id); err == nil {
+			calculationStore.DeleteCalculation(id)
+		}
+		http.Redirect(w, r, sitePath("/"), http.StatusSeeOther)
+		return
+	}
+
+	if r.Method == http.MethodPost && r.FormValue("action") == "share" {
+		link, err := createShareLink(r.FormValue("ip"), r.FormValue("mask"), r.FormValue("cloud"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, link.URL, http.StatusSeeOther)
+		return
+	}
 
 	if r.Method == http.MethodPost {
-		ip := strings.TrimSpace(r.FormValue("ip"))
-		mask := strings.TrimSpace(r.FormValue("mask"))
+		ip, mask, note := normalizeInput(r.FormValue("ip"), r.FormValue("mask"))
 
 		result.IPAddress = ip
 		result.SubnetMask = mask
+		result.Generator = r.FormValue("generator")
+		result.Cloud = r.FormValue("cloud")
+		result.Explain = r.FormValue("explain") != ""
+		if r.FormValue("dhcp") != "" {
+			result.DHCPOptions = &DHCPPoolOptions{Gateway: r.FormValue("gateway")}
+			result.DHCPOptions.StaticPercent, _ = strconv.Atoi(r.FormValue("static_percent"))
+			result.DHCPOptions.PoolPercent, _ = strconv.Atoi(r.FormValue("pool_percent"))
+		}
+
+		if ip != "" && mask == "" {
+			result.Error = "a subnet mask is required, in the mask field or after the address like 10.0.0.0/8"
+		}
 
 		if ip != "" && mask != "" {
-			calcResult, err := calculateSubnet(ip, mask)
+			_, span := startSpan(r.Context(), "subnet.calculate", spanKindInternal)
+			span.Set("subnet.ip", ip)
+			span.Set("subnet.mask", mask)
+			calcResult, err := calculateCloudSubnet(ip, mask, result.Cloud)
+			span.End(err)
+			recordRecent(r, "web", ip, mask, result.Cloud, calcResult, err)
 			if err != nil {
 				result.Error = err.Error()
 			} else {
@@ -267,36 +386,250 @@ func handler(w http.ResponseWriter, r *http.Request) {
 				result.MinHostAddress = calcResult.MinHostAddress
 				result.MaxHostAddress = calcResult.MaxHostAddress
 				result.UsableHosts = calcResult.UsableHosts
+				result.Reserved = calcResult.Reserved
+				result.CloudNotes = calcResult.CloudNotes
+				if result.Explain {
+					result.Explanation, _ = explainSubnet(ip, mask, result)
+				}
+				if result.DHCPOptions != nil {
+					if result.DHCP, err = suggestDHCPPool(ip, mask, result.Cloud, *result.DHCPOptions); err != nil {
+						result.DHCPError = err.Error()
+					}
+				}
+				result.Normalization = note
+				result.Integers = integerFormsOf(ip, mask)
+				result.SpecialPurpose = specialPurposeOf(ip, mask)
+				result.Registration = lookupRegistration(r.Context(), ip)
+				result.Location = lookupGeoLocation(ip)
+				result.Origin = lookupOrigin(r.Context(), ip, mask)
+				result.Reputation = checkReputation(r.Context(), ip)
+				switch r.FormValue("format") {
+				case "csv":
+					writeSubnetCSV(w, "subnet.csv", []SubnetRow{resultRow("", result)})
+					return
+				case "markdown":
+					writeResultMarkdown(w, result)
+					return
+				case targetsNmap, targetsMasscan:
+					writeResultTargets(w, r, r.Form, r.FormValue("format"), result)
+					return
+				}
+				if result.Generator != "" {
+					if result.Config, err = generateForSubnet(result.Generator, ip, mask, result.DHCPOptions); err != nil {
+						result.ConfigError = err.Error()
+					}
+				}
+				if result.Owner != "" {
+					saveCalculation(result, r.FormValue("save_as"))
+				}
 			}
 		}
+	} else if r.Method == http.MethodGet {
+		result.IPAddress = prefillAddress(r)
 	}
+	if result.Owner != "" {
+		result.Saved, _ = calculationStore.ListCalculations(result.Owner, true, historySize)
+		result.Recent, _ = calculationStore.ListCalculations(result.Owner, false, 10)
+	}
+
+	renderMainPage(w, r, result)
+}
 
-	w.Header().Set("Content-Type", "text/html")
-	if err := tmpl.Execute(w, result); err != nil {
-		log.Printf("Template execution error: %v", err)
-		http.Error(w, "Template execution error", http.StatusInternalServerError)
+// partialRequested reports whether a page should render only its results block: for
+// htmx requests, which send HX-Request, or with partial=1 for other scripts
+func partialRequested(r *http.Request) bool {
+	if r.Header.Get("HX-Request") == "true" {
+		return true
 	}
+	partial, _ := strconv.ParseBool(r.FormValue("partial"))
+	return partial
 }
 
 func main() {
+	// The WebAssembly build only hands the calculation engine to JavaScript
+	if runtime.GOOS == "js" {
+		serveJS()
+		return
+	}
+
+	// Subcommands
+	if len(os.Args) > 1 && os.Args[1] == "loadtest" {
+		os.Exit(runLoadTest(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		os.Exit(runAPIKeyCommand(os.Args[2:], os.Stdout))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "mcp" {
+		os.Exit(runMCP(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "overlap" {
+		os.Exit(runBulkOverlap(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
 	http.HandleFunc("/", handler)
 	http.HandleFunc("/health", healthHandler)
-
-	// Get port from environment variable, default to 8080
-	port := os.Getenv("GO_SUBNET_CALCULATOR_PORT")
-	if port == "" {
-		port = "8080"
+	http.HandleFunc("/ready", readyHandler)
+	http.HandleFunc("/version", versionHandler)
+	http.HandleFunc("/cheatsheet", cheatsheetHandler)
+	http.HandleFunc("/lpm", lpmPageHandler)
+	http.HandleFunc("/batch", batchPageHandler)
+	http.HandleFunc("/quiz", quizPageHandler)
+	http.HandleFunc("/ipam", ipamPageHandler)
+	http.HandleFunc("/plan", planPageHandler)
+	http.HandleFunc("/sites", sitesPageHandler)
+	http.HandleFunc("/login", loginHandler)
+	http.HandleFunc("/logout", logoutHandler)
+	http.HandleFunc("/auth/callback", oidcCallbackHandler)
+	http.HandleFunc("/s/{code}", sharedPageHandler)
+	http.HandleFunc("/wasm/{file}", wasmHandler)
+	http.HandleFunc("/api/v1/calculate", revalidated(calculateHandler))
+	http.HandleFunc("/api/v1/subnet/{ip}/{mask}", revalidated(subnetHandler))
+	http.HandleFunc("/api/v1/share", shareHandler)
+	http.HandleFunc("/api/v1/batch", batchHandler)
+	http.HandleFunc("/api/v1/quiz", quizHandler)
+	http.HandleFunc("/api/v1/quiz/{id}", quizAnswerHandler)
+	http.HandleFunc("/api/v1/deaggregate", cacheable(deaggregateHandler))
+	http.HandleFunc("/api/v1/subtract", subtractHandler)
+	http.HandleFunc("/api/v1/free", freeSubnetHandler)
+	http.HandleFunc("/api/v1/cover", coverHandler)
+	http.HandleFunc("/api/v1/aggregate", aggregateHandler)
+	http.HandleFunc("/api/v1/overlap", overlapHandler)
+	http.HandleFunc("/api/v1/summary/check", summaryCheckHandler)
+	http.HandleFunc("/api/v1/mcp/sse", mcpSSEHandler)
+	http.HandleFunc("/api/v1/mcp/messages", mcpMessagesHandler)
+	http.HandleFunc("/api/v1/compare", cacheable(compareHandler))
+	http.HandleFunc("/api/v1/ptr", ptrHandler)
+	http.HandleFunc("/api/v1/ipv6/eui64", cacheable(eui64Handler))
+	http.HandleFunc("/api/v1/ipv6/link-local", cacheable(linkLocalHandler))
+	http.HandleFunc("/api/v1/ipv6/solicited-node", cacheable(solicitedNodeHandler))
+	http.HandleFunc("/api/v1/ipv6/nat64", cacheable(nat64Handler))
+	http.HandleFunc("/api/v1/ipv6/6to4", cacheable(sixToFourHandler))
+	http.HandleFunc("/api/v1/ipv6/teredo", cacheable(teredoHandler))
+	http.HandleFunc("/api/v1/ipv6/mapped", cacheable(mappedHandler))
+	http.HandleFunc("/api/v1/ipv6/normalize", cacheable(normalizeHandler))
+	http.HandleFunc("/api/v1/special-purpose", cacheable(specialPurposeHandler))
+	http.HandleFunc("/api/v1/scan", scanHandler)
+	http.HandleFunc("/api/v1/lpm", lpmHandler)
+	http.HandleFunc("/api/v1/routes/analyze", routeAnalysisHandler)
+	http.HandleFunc("/api/v1/docker/plan", dockerPlanHandler)
+	http.HandleFunc("/api/v1/plan", planHandler)
+	http.HandleFunc("/api/v1/sites/plan", sitePlanHandler)
+	http.HandleFunc("/api/v1/ipam/pools", ipamPoolsHandler)
+	http.HandleFunc("/api/v1/ipam/pools/{id}", ipamPoolHandler)
+	http.HandleFunc("/api/v1/ipam/pools/{id}/allocations", ipamPoolAllocationsHandler)
+	http.HandleFunc("/api/v1/ipam/pools/{id}/map", ipamPoolMapHandler)
+	http.HandleFunc("/api/v1/ipam/allocations/{id}", ipamAllocationHandler)
+	http.HandleFunc("/api/v1/ipam/import", ipamImportHandler)
+	http.HandleFunc("/api/v1/ipam/alerts", ipamAlertsHandler)
+	http.HandleFunc("/api/v1/audit", auditHandler)
+	http.HandleFunc("/api/v1/whoami", whoamiHandler)
+	http.HandleFunc("/api/v1/history", historyHandler)
+	http.HandleFunc("/api/v1/jobs", jobsHandler)
+	http.HandleFunc("/api/v1/jobs/{id}", jobHandler)
+	http.HandleFunc("/api/v1/jobs/{id}/events", jobEventsHandler)
+	http.HandleFunc("/api/v1/calculations", calculationsHandler)
+	http.HandleFunc("/api/v1/calculations/{id}", calculationHandler)
+	http.HandleFunc("/api/v1/admin/keys", apiKeysHandler)
+	http.HandleFunc("/api/v1/admin/keys/{id}", apiKeyHandler)
+	http.HandleFunc("/api/v1/admin/reload", reloadHandler)
+	http.HandleFunc("/api/v1/ipam/netbox/{direction}", ipamNetBoxHandler)
+	http.HandleFunc("/api/v1/ipam/discover", ipamDiscoverHandler)
+	http.HandleFunc("/api/v1/generate", cacheable(generatorListHandler))
+	http.HandleFunc("/api/v1/generate/{generator}", cacheable(generateHandler))
+
+	if err := configureStorage(); err != nil {
+		log.Fatalf("Storage setup failed: %v", err)
+	}
+	if err := configureIPAMAlerts(); err != nil {
+		log.Fatalf("IPAM alert setup failed: %v", err)
+	}
+	if err := configureHistory(); err != nil {
+		log.Fatalf("Calculation history setup failed: %v", err)
+	}
+	if err := configureJobs(); err != nil {
+		log.Fatalf("Job queue setup failed: %v", err)
+	}
+	if err := configureWorkPool(); err != nil {
+		log.Fatalf("Batch worker setup failed: %v", err)
+	}
+	if err := configureTheme(); err != nil {
+		log.Fatalf("Theme setup failed: %v", err)
+	}
+	if err := configureRDAP(); err != nil {
+		log.Fatalf("RDAP setup failed: %v", err)
+	}
+	if err := configureGeoIP(); err != nil {
+		log.Fatalf("GeoIP setup failed: %v", err)
+	}
+	if err := configurePTR(); err != nil {
+		log.Fatalf("PTR lookup setup failed: %v", err)
+	}
+	if err := configureASN(); err != nil {
+		log.Fatalf("ASN lookup setup failed: %v", err)
+	}
+	if err := configureReputation(); err != nil {
+		log.Fatalf("Reputation check setup failed: %v", err)
+	}
+	if err := configureSettings(); err != nil {
+		log.Fatalf("Settings setup failed: %v", err)
+	}
+	if err := configureSNMP(); err != nil {
+		log.Fatalf("SNMP discovery setup failed: %v", err)
+	}
+	if err := configureNAT64(); err != nil {
+		log.Fatalf("NAT64 setup failed: %v", err)
+	}
+	if err := configureTrustedProxies(); err != nil {
+		log.Fatalf("Trusted proxy setup failed: %v", err)
+	}
+	if err := configureTracing(); err != nil {
+		log.Fatalf("Tracing setup failed: %v", err)
+	}
+	if err := configureAccessLog(); err != nil {
+		log.Fatalf("Access log setup failed: %v", err)
+	}
+	if err := configureCache(); err != nil {
+		log.Fatalf("Cache setup failed: %v", err)
+	}
+	if err := configureCORS(); err != nil {
+		log.Fatalf("CORS setup failed: %v", err)
+	}
+	if err := configureImport(); err != nil {
+		log.Fatalf("Import setup failed: %v", err)
+	}
+	if err := configureBodyLimit(); err != nil {
+		log.Fatalf("Body limit setup failed: %v", err)
+	}
+	if err := configureAPIAuth(); err != nil {
+		log.Fatalf("API authentication setup failed: %v", err)
+	}
+	if err := configureWebAuth(); err != nil {
+		log.Fatalf("Web login setup failed: %v", err)
+	}
+	if err := configureRBAC(); err != nil {
+		log.Fatalf("Role setup failed: %v", err)
+	}
+	if err := configureBasePath(); err != nil {
+		log.Fatalf("Base path setup failed: %v", err)
 	}
 
-	// Validate port is numeric
-	if _, err := strconv.Atoi(port); err != nil {
-		log.Fatalf("Invalid port number: %s", port)
+	// Listen on GO_SUBNET_CALCULATOR_LISTEN, or on GO_SUBNET_CALCULATOR_PORT (default 8080)
+	if err := configureListeners(); err != nil {
+		log.Fatalf("Listener setup failed: %v", err)
 	}
+	for _, l := range listeners {
+		fmt.Printf("IPv4 Subnet Calculator starting on %s%s\n", l.URL(), sitePath("/"))
+		fmt.Printf("Health check available at %s%s\n", l.URL(), sitePath("/health"))
+	}
+
+	// Run the startup self-test; on failure the server still starts so the
+	// report can be inspected at /ready, but all other traffic is refused
+	runSelfTest()
+
+	// Re-read the data files on SIGHUP, as POST /api/v1/admin/reload does
+	reloadOnHangup()
 
-	address := ":" + port
-	fmt.Printf("IPv4 Subnet Calculator starting on http://localhost:%s\n", port)
-	fmt.Printf("Health check available at http://localhost:%s/health\n", port)
-	if err := http.ListenAndServe(address, nil); err != nil {
+	if err := serveListeners(http.DefaultServeMux); err != nil {
 		log.Fatal("Server failed to start:", err)
 	}
 }
@@ -43,6 +43,18 @@ func TestParseSubnetMask(t *testing.T) {
 			wantErr:  false,
 			expected: "ffffffff",
 		},
+		{
+			name:     "Valid bare prefix length 24",
+			input:    "24",
+			wantErr:  false,
+			expected: "ffffff00",
+		},
+		{
+			name:     "Valid bare prefix length 0",
+			input:    " 0 ",
+			wantErr:  false,
+			expected: "00000000",
+		},
 		{
 			name:     "Valid dotted decimal 255.255.255.0",
 			input:    "255.255.255.0",
@@ -79,6 +91,50 @@ func TestParseSubnetMask(t *testing.T) {
 			wantErr:  false,
 			expected: "ffffffff",
 		},
+		{
+			name:     "Valid hex 0xffffff00",
+			input:    "0xffffff00",
+			wantErr:  false,
+			expected: "ffffff00",
+		},
+		{
+			name:     "Valid hex uppercase 0XFFFFFFFC",
+			input:    "0XFFFFFFFC",
+			wantErr:  false,
+			expected: "fffffffc",
+		},
+		{
+			name:     "Valid binary dotted",
+			input:    "11111111.11111111.11111111.00000000",
+			wantErr:  false,
+			expected: "ffffff00",
+		},
+		{
+			name:     "Valid binary undotted",
+			input:    "11111111111111111111000000000000",
+			wantErr:  false,
+			expected: "fffff000",
+		},
+		{
+			name:    "Invalid hex - too short",
+			input:   "0xffff",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid hex - non-contiguous mask",
+			input:   "0xffff00ff",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid binary - non-contiguous mask",
+			input:   "11111111.11111111.11111111.00000001",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid binary - misplaced dots",
+			input:   "1111111.111111111.11111111.00000000",
+			wantErr: true,
+		},
 		{
 			name:    "Invalid CIDR negative",
 			input:   "/-1",
@@ -89,6 +145,21 @@ func TestParseSubnetMask(t *testing.T) {
 			input:   "/33",
 			wantErr: true,
 		},
+		{
+			name:    "Invalid bare prefix length too large",
+			input:   "33",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid bare prefix length with sign",
+			input:   "+8",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid bare prefix length of three digits",
+			input:   "024",
+			wantErr: true,
+		},
 		{
 			name:    "Invalid dotted decimal - out of range",
 			input:   "256.255.255.0",
@@ -146,6 +217,14 @@ func TestParseSubnetMask(t *testing.T) {
 	}
 }
 
+func TestParseSubnetMaskNonContiguousError(t *testing.T) {
+	_, err := parseSubnetMask("0xffff00ff")
+	want := "invalid subnet mask: 0xffff00ff (must have contiguous 1s followed by 0s, but in 11111111.11111111.00000000.11111111 bit 25 is 1 after a 0)"
+	if err == nil || err.Error() != want {
+		t.Errorf("parseSubnetMask(0xffff00ff) error = %v, want %q", err, want)
+	}
+}
+
 func TestIsValidSubnetMask(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -322,6 +401,28 @@ func TestCalculateSubnet(t *testing.T) {
 			mask:    "/24",
 			wantErr: true,
 		},
+		{
+			name:              "IPv4-mapped IPv6 address",
+			ip:                "::ffff:10.1.2.3",
+			mask:              "255.255.255.252",
+			expectedNetwork:   "10.1.2.0",
+			expectedBroadcast: "10.1.2.3",
+			expectedMinHost:   "10.1.2.1",
+			expectedMaxHost:   "10.1.2.2",
+			expectedUsable:    "2",
+		},
+		{
+			name:    "IPv6 address",
+			ip:      "2001:db8::1",
+			mask:    "/64",
+			wantErr: true,
+		},
+		{
+			name:    "IPv6 address with zone",
+			ip:      "fe80::1%eth0",
+			mask:    "/24",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -501,6 +602,58 @@ func ipEqual(ip1, ip2 string) bool {
 	return parsedIP1.Equal(parsedIP2)
 }
 
+func TestHandlerPOSTGenerator(t *testing.T) {
+	form := url.Values{}
+	form.Add("ip", "192.168.1.10")
+	form.Add("mask", "/24")
+	form.Add("generator", "juniper-interface")
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(handler).ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	if !strings.Contains(body, "set interfaces ge-0/0/0 unit 0 family inet address 192.168.1.10/24") {
+		t.Errorf("handler should render the selected generator output, got:\n%s", body)
+	}
+	if !strings.Contains(body, `<option value="juniper-interface" selected>`) {
+		t.Error("handler should keep the selected generator in the dropdown")
+	}
+}
+
+func TestHandlerPartial(t *testing.T) {
+	post := func(form url.Values, htmx bool) string {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		if htmx {
+			req.Header.Set("HX-Request", "true")
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(handler).ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK || rr.Header().Get("Vary") != "HX-Request" {
+			t.Fatalf("handler = %d, Vary %q", rr.Code, rr.Header().Get("Vary"))
+		}
+		return rr.Body.String()
+	}
+
+	full := post(url.Values{"ip": {"192.168.1.10"}, "mask": {"/24"}}, false)
+	if !strings.Contains(full, "<html") || !strings.Contains(full, `<div id="results">`) || !strings.Contains(full, "192.168.1.255") {
+		t.Errorf("full page:\n%s", full)
+	}
+	for _, body := range []string{
+		post(url.Values{"ip": {"192.168.1.10"}, "mask": {"/24"}}, true),
+		post(url.Values{"ip": {"192.168.1.10"}, "mask": {"/24"}, "partial": {"1"}}, false),
+	} {
+		if strings.Contains(body, "<html") || strings.Contains(body, "<form method=\"POST\" action=\"/\" hx-post") || !strings.Contains(body, "192.168.1.255") {
+			t.Errorf("partial page:\n%s", body)
+		}
+	}
+	if body := post(url.Values{"ip": {"300.1.1.1"}, "mask": {"/24"}}, true); !strings.Contains(body, "Error:") || strings.Contains(body, "<html") {
+		t.Errorf("partial error:\n%s", body)
+	}
+}
+
 func TestIPEqual(t *testing.T) {
 	tests := []struct {
 		ip1      string
@@ -572,8 +725,8 @@ func TestHealthHandler_Success(t *testing.T) {
 		t.Errorf("Expected status 'healthy', got '%s'", health.Status)
 	}
 
-	if health.Version != "1.0.0" {
-		t.Errorf("Expected version '1.0.0', got '%s'", health.Version)
+	if health.Version != version {
+		t.Errorf("Expected version '%s', got '%s'", version, health.Version)
 	}
 
 	// Verify timestamp is recent (within last 2 seconds)
@@ -841,7 +994,7 @@ func TestMain_ServerStartup(t *testing.T) {
 
 			// Parent process - start subprocess
 			cmd := exec.Command(os.Args[0], "-test.run="+t.Name())
-			cmd.Env = append(os.Environ(), "TEST_MAIN_PROCESS=1")
+			cmd.Env = append(os.Environ(), "TEST_MAIN_PROCESS=1", "GO_SUBNET_CALCULATOR_DB_DRIVER=memory")
 			if tt.envPort != "" {
 				cmd.Env = append(cmd.Env, "GO_SUBNET_CALCULATOR_PORT="+tt.envPort)
 			}
@@ -915,6 +1068,7 @@ func TestMain_InvalidPort(t *testing.T) {
 	cmd.Env = append(os.Environ(),
 		"TEST_INVALID_PORT=1",
 		"GO_SUBNET_CALCULATOR_PORT=invalid",
+		"GO_SUBNET_CALCULATOR_DB_DRIVER=memory",
 	)
 
 	stderr, err := cmd.StderrPipe()
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// The calculator speaks the Model Context Protocol, so AI assistants can call its
+// operations as tools with typed arguments and results: over stdin and stdout with
+// the mcp subcommand, and over Server-Sent Events at /api/v1/mcp/sse. Only the pure
+// calculations are offered; nothing is stored and nothing is looked up on the network
+
+// mcpProtocolVersions are the protocol revisions understood, newest first
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes
+const (
+	mcpParseError     = -32700
+	mcpInvalidRequest = -32600
+	mcpMethodNotFound = -32601
+	mcpInvalidParams  = -32602
+)
+
+// mcpRequest is a JSON-RPC 2.0 request, or a notification when it has no ID
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// mcpResponse is a JSON-RPC 2.0 response carrying a result or an error
+type mcpResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpTool is a calculator operation offered to MCP clients. Call gets the arguments
+// of the client and returns the structured result
+type mcpTool struct {
+	Name         string                 `json:"name"`
+	Title        string                 `json:"title"`
+	Description  string                 `json:"description"`
+	InputSchema  map[string]interface{} `json:"inputSchema"`
+	OutputSchema map[string]interface{} `json:"outputSchema,omitempty"`
+	call         func(args json.RawMessage) (interface{}, error)
+}
+
+// mcpToolContent is one content block of a tool result
+type mcpToolContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// mcpToolResult is the result of tools/call. Failed calculations are results with
+// IsError set, so the model sees the error, rather than protocol errors
+type mcpToolResult struct {
+	Content           []mcpToolContent `json:"content"`
+	StructuredContent interface{}      `json:"structuredContent,omitempty"`
+	IsError           bool             `json:"isError,omitempty"`
+}
+
+// mcpInput returns the JSON schema of tool arguments with the given properties
+func mcpInput(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// mcpOutput returns the JSON schema of a tool result; results may hold more fields
+// than the ones described
+func mcpOutput(properties map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// mcpString and mcpStrings describe string and string list properties
+func mcpString(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "description": description}
+}
+
+func mcpStrings(description string) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": description}
+}
+
+// decodeMCPArguments reads the arguments of a tool call, refusing unknown ones
+func decodeMCPArguments(args json.RawMessage, v interface{}) error {
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(args))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	return nil
+}
+
+// mcpTools are the tools offered, in the order tools/list returns them
+var mcpTools = []mcpTool{
+	{
+		Name:        "calculate",
+		Title:       "Calculate subnet",
+		Description: "Calculate the IPv4 subnet of an address and mask: network and broadcast address, host range, usable hosts and the special-purpose blocks it falls into. A cloud provider applies its reserved addresses.",
+		InputSchema: mcpInput(map[string]interface{}{
+			"ip":      mcpString("IPv4 address, e.g. 192.168.1.100; integer (3232235876) and hex (0xC0A80164) forms are accepted"),
+			"mask":    mcpString("Subnet mask in CIDR notation (/24 or 24), dotted decimal (255.255.255.0), hex (0xffffff00) or binary (11111111.11111111.11111111.00000000)"),
+			"cloud":   map[string]interface{}{"type": "string", "description": "Cloud provider whose reservations apply", "enum": cloudProviderNames()},
+			"explain": map[string]interface{}{"type": "boolean", "description": "Add a step-by-step worked solution"},
+		}, "ip", "mask"),
+		OutputSchema: mcpOutput(map[string]interface{}{
+			"network_address":   mcpString("First address of the subnet"),
+			"broadcast_address": mcpString("Last address of the subnet"),
+			"min_host_address":  mcpString("First usable host, or N/A"),
+			"max_host_address":  mcpString("Last usable host, or N/A"),
+			"usable_hosts":      mcpString("Number of usable hosts"),
+		}),
+		call: func(args json.RawMessage) (interface{}, error) {
+			var req CalculateRequest
+			if err := decodeMCPArguments(args, &req); err != nil {
+				return nil, err
+			}
+			var note string
+			req.IP, req.Mask, note = normalizeInput(req.IP, req.Mask)
+			req.Cloud = strings.TrimSpace(req.Cloud)
+			result, err := calculateCloudSubnet(req.IP, req.Mask, req.Cloud)
+			if err != nil {
+				return nil, err
+			}
+			result.IPAddress, result.SubnetMask, result.Normalization = req.IP, req.Mask, note
+			if req.Explain {
+				result.Explanation, _ = explainSubnet(req.IP, req.Mask, result)
+			}
+			result.Integers = integerFormsOf(req.IP, req.Mask)
+			result.SpecialPurpose = specialPurposeOf(req.IP, req.Mask)
+			return result, nil
+		},
+	},
+	{
+		Name:        "split",
+		Title:       "Split prefix",
+		Description: fmt.Sprintf("Split an IPv4 prefix into all of its subnets of a target length, at most %d of them, optionally removing carve-outs first.", maxPrefixListLen),
+		InputSchema: mcpInput(map[string]interface{}{
+			"prefix":  mcpString("Prefix to split in CIDR notation, e.g. 10.0.0.0/16"),
+			"length":  map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 32, "description": "Prefix length of the subnets"},
+			"exclude": mcpStrings("Prefixes to remove before splitting"),
+		}, "prefix"),
+		OutputSchema: mcpOutput(map[string]interface{}{
+			"prefix":   mcpString("The prefix that was split"),
+			"prefixes": mcpStrings("The subnets"),
+			"count":    map[string]interface{}{"type": "integer"},
+		}),
+		call: func(args json.RawMessage) (interface{}, error) {
+			var req DeaggregateRequest
+			if err := decodeMCPArguments(args, &req); err != nil {
+				return nil, err
+			}
+			prefixes, err := deaggregate(req)
+			if err != nil {
+				return nil, err
+			}
+			list := prefixStrings(prefixes)
+			return PrefixListResponse{Prefix: req.Prefix, Prefixes: list, Count: len(list)}, nil
+		},
+	},
+	{
+		Name:        "aggregate",
+		Title:       "Aggregate prefixes",
+		Description: "Summarize IPv4 prefixes into the smallest list of prefixes covering exactly the same addresses.",
+		InputSchema: mcpInput(map[string]interface{}{
+			"prefixes": mcpStrings("Prefixes in CIDR notation"),
+		}, "prefixes"),
+		OutputSchema: mcpOutput(map[string]interface{}{
+			"input_count": map[string]interface{}{"type": "integer"},
+			"prefixes":    mcpStrings("The summarized prefixes"),
+			"count":       map[string]interface{}{"type": "integer"},
+			"addresses":   map[string]interface{}{"type": "integer"},
+		}),
+		call: func(args json.RawMessage) (interface{}, error) {
+			var req AggregateRequest
+			if err := decodeMCPArguments(args, &req); err != nil {
+				return nil, err
+			}
+			set, err := cidrset.Parse(req.Prefixes...)
+			if err != nil {
+				return nil, err
+			}
+			return newAggregateResponse(len(req.Prefixes), set), nil
+		},
+	},
+	{
+		Name:        "check_overlap",
+		Title:       "Check overlap",
+		Description: "Compare two collections of IPv4 prefixes: whether they overlap, their intersection, the parts only in either and their union.",
+		InputSchema: mcpInput(map[string]interface{}{
+			"a": mcpStrings("First collection of prefixes"),
+			"b": mcpStrings("Second collection of prefixes"),
+		}, "a", "b"),
+		OutputSchema: mcpOutput(map[string]interface{}{
+			"overlaps":     map[string]interface{}{"type": "boolean"},
+			"intersection": mcpStrings("Addresses in both"),
+			"a_only":       mcpStrings("Addresses only in a"),
+			"b_only":       mcpStrings("Addresses only in b"),
+			"union":        mcpStrings("Addresses in either"),
+		}),
+		call: func(args json.RawMessage) (interface{}, error) {
+			var req OverlapRequest
+			if err := decodeMCPArguments(args, &req); err != nil {
+				return nil, err
+			}
+			return compareOverlap(req)
+		},
+	},
+}
+
+// cloudProviderNames lists the names accepted as a cloud provider
+func cloudProviderNames() []string {
+	names := make([]string, len(cloudProviders))
+	for i, p := range cloudProviders {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// lookupMCPTool returns the tool of the given name
+func lookupMCPTool(name string) (*mcpTool, bool) {
+	for i := range mcpTools {
+		if mcpTools[i].Name == name {
+			return &mcpTools[i], true
+		}
+	}
+	return nil, false
+}
+
+// callMCPTool runs a tool and wraps its outcome as a tool result
+func callMCPTool(tool *mcpTool, args json.RawMessage) mcpToolResult {
+	result, err := tool.call(args)
+	if err != nil {
+		return mcpToolResult{Content: []mcpToolContent{{Type: "text", Text: err.Error()}}, IsError: true}
+	}
+	text, _ := json.Marshal(result)
+	return mcpToolResult{Content: []mcpToolContent{{Type: "text", Text: string(text)}}, StructuredContent: result}
+}
+
+// handleMCP answers one JSON-RPC message. It returns nil for notifications, which
+// get no response
+func handleMCP(data []byte) *mcpResponse {
+	var req mcpRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return &mcpResponse{JSONRPC: "2.0", Error: &mcpError{Code: mcpParseError, Message: "parse error: " + err.Error()}}
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return &mcpResponse{JSONRPC: "2.0", ID: req.ID, Error: &mcpError{Code: mcpInvalidRequest, Message: "not a JSON-RPC 2.0 request"}}
+	}
+	if len(req.ID) == 0 {
+		return nil
+	}
+
+	resp := &mcpResponse{JSONRPC: "2.0", ID: req.ID}
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		version := mcpProtocolVersions[0]
+		if slices.Contains(mcpProtocolVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		resp.Result = map[string]interface{}{
+			"protocolVersion": version,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "go-ip-subnet-calculator", "title": "IPv4 Subnet Calculator", "version": buildInfo().Version},
+			"instructions":    "IPv4 subnet calculations. Addresses and prefixes are IPv4 only; masks may be dotted decimal or /length.",
+		}
+	case "ping":
+		resp.Result = map[string]interface{}{}
+	case "tools/list":
+		resp.Result = map[string]interface{}{"tools": mcpTools}
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			resp.Error = &mcpError{Code: mcpInvalidParams, Message: "invalid params: " + err.Error()}
+			break
+		}
+		tool, ok := lookupMCPTool(params.Name)
+		if !ok {
+			resp.Error = &mcpError{Code: mcpInvalidParams, Message: "unknown tool: " + params.Name}
+			break
+		}
+		resp.Result = callMCPTool(tool, params.Arguments)
+	default:
+		resp.Error = &mcpError{Code: mcpMethodNotFound, Message: "method not found: " + req.Method}
+	}
+	return resp
+}
+
+// serveMCP answers newline-delimited JSON-RPC messages from in on out until in ends
+func serveMCP(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 4096), int(maxBodyBytes))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		resp := handleMCP(line)
+		if resp == nil {
+			continue
+		}
+		data, _ := json.Marshal(resp)
+		if _, err := out.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// runMCP is the mcp subcommand: an MCP server on stdin and stdout for assistants that
+// start the calculator as a local tool
+func runMCP(args []string, in io.Reader, out, errOut io.Writer) int {
+	if len(args) > 0 {
+		fmt.Fprintln(errOut, "usage: go-ip-subnet-calculator mcp")
+		return 2
+	}
+	if err := serveMCP(in, out); err != nil {
+		fmt.Fprintf(errOut, "mcp: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// mcpSession is an open SSE stream. Responses to the messages posted for it are
+// sent on messages until done is closed
+type mcpSession struct {
+	messages chan []byte
+	done     chan struct{}
+}
+
+// mcpSessions are the open sessions by ID
+var mcpSessions = struct {
+	sync.Mutex
+	byID map[string]*mcpSession
+}{byID: map[string]*mcpSession{}}
+
+// mcpSSEHandler serves GET /api/v1/mcp/sse, the stream of an MCP session over HTTP.
+// Its first event names the endpoint the client posts its messages to
+func mcpSSEHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	id := newRequestID()
+	session := &mcpSession{messages: make(chan []byte, 16), done: make(chan struct{})}
+	mcpSessions.Lock()
+	mcpSessions.byID[id] = session
+	mcpSessions.Unlock()
+	defer func() {
+		mcpSessions.Lock()
+		delete(mcpSessions.byID, id)
+		mcpSessions.Unlock()
+		close(session.done)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	rc := http.NewResponseController(w)
+	fmt.Fprintf(w, "event: endpoint\ndata: %s?session=%s\n\n", sitePath("/api/v1/mcp/messages"), id)
+	if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return
+	}
+	keepAlive := time.NewTicker(jobKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case data := <-session.messages:
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return
+		}
+	}
+}
+
+// mcpMessagesHandler serves POST /api/v1/mcp/messages?session=, a JSON-RPC message of
+// an open session. The message is accepted with 202 and answered on the stream
+func mcpMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	mcpSessions.Lock()
+	session, ok := mcpSessions.byID[r.URL.Query().Get("session")]
+	mcpSessions.Unlock()
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "unknown MCP session")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		if !writeBodyTooLarge(w, err) {
+			writeJSONError(w, http.StatusBadRequest, "reading the message: "+err.Error())
+		}
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	if resp := handleMCP(body); resp != nil {
+		data, _ := json.Marshal(resp)
+		select {
+		case session.messages <- data:
+		case <-session.done:
+		case <-r.Context().Done():
+		}
+	}
+}
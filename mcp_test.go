@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// mcpCall sends one message to handleMCP and decodes the response
+func mcpCall(t *testing.T, message string) map[string]interface{} {
+	t.Helper()
+	resp := handleMCP([]byte(message))
+	if resp == nil {
+		t.Fatalf("%s got no response", message)
+	}
+	data, _ := json.Marshal(resp)
+	var out map[string]interface{}
+	json.Unmarshal(data, &out)
+	return out
+}
+
+func TestHandleMCP(t *testing.T) {
+	initialize := mcpCall(t, `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"test","version":"1"}}}`)
+	result, _ := initialize["result"].(map[string]interface{})
+	if result["protocolVersion"] != "2024-11-05" || result["capabilities"].(map[string]interface{})["tools"] == nil {
+		t.Errorf("initialize = %v", initialize)
+	}
+	if resp := mcpCall(t, `{"jsonrpc":"2.0","id":2,"method":"initialize","params":{"protocolVersion":"1999-01-01"}}`); resp["result"].(map[string]interface{})["protocolVersion"] != mcpProtocolVersions[0] {
+		t.Errorf("unknown version answered with %v", resp["result"])
+	}
+	if resp := handleMCP([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); resp != nil {
+		t.Errorf("notification answered with %+v", resp)
+	}
+
+	list := mcpCall(t, `{"jsonrpc":"2.0","id":"list","method":"tools/list"}`)
+	var names []string
+	for _, tool := range list["result"].(map[string]interface{})["tools"].([]interface{}) {
+		names = append(names, tool.(map[string]interface{})["name"].(string))
+	}
+	if strings.Join(names, ",") != "calculate,split,aggregate,check_overlap" || list["id"] != "list" {
+		t.Errorf("tools/list = %v", list)
+	}
+
+	for message, code := range map[string]float64{
+		`not json`:                 mcpParseError,
+		`{"id":1,"method":"ping"}`: mcpInvalidRequest,
+		`{"jsonrpc":"2.0","id":1,"method":"resources/list"}`:                             mcpMethodNotFound,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"shutdown"}}`:    mcpInvalidParams,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":["calculate"]}}`: mcpInvalidParams,
+	} {
+		resp := mcpCall(t, message)
+		if err, _ := resp["error"].(map[string]interface{}); err == nil || err["code"] != code {
+			t.Errorf("%s = %v, want error %v", message, resp, code)
+		}
+	}
+}
+
+func TestMCPTools(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    string
+		want    string
+		isError bool
+	}{
+		{"calculate", `{"ip":"192.168.1.100","mask":"/24"}`, `"network_address":"192.168.1.0"`, false},
+		{"calculate", `{"ip":"10.0.1.77","mask":"255.255.255.0","cloud":"aws"}`, `"min_host_address":"10.0.1.4"`, false},
+		{"calculate", `{"ip":"bogus","mask":"/24"}`, "invalid IP address", true},
+		{"calculate", `{"ip":"10.0.0.1","mask":"/24","verbose":true}`, "unknown field", true},
+		{"split", `{"prefix":"10.0.0.0/22","length":24}`, `"prefixes":["10.0.0.0/24","10.0.1.0/24","10.0.2.0/24","10.0.3.0/24"]`, false},
+		{"split", `{"prefix":"10.0.0.0/22"}`, "target length", true},
+		{"aggregate", `{"prefixes":["10.0.0.0/24","10.0.1.0/24"]}`, `"prefixes":["10.0.0.0/23"]`, false},
+		{"check_overlap", `{"a":["10.0.0.0/16"],"b":["10.0.128.0/17","192.168.0.0/24"]}`, `"overlaps":true,"intersection":["10.0.128.0/17"]`, false},
+		{"check_overlap", `{"a":["10.0.0.0/33"],"b":[]}`, "10.0.0.0/33", true},
+	}
+	for _, tt := range tests {
+		tool, _ := lookupMCPTool(tt.name)
+		result := callMCPTool(tool, json.RawMessage(tt.args))
+		if result.IsError != tt.isError || len(result.Content) != 1 || !strings.Contains(result.Content[0].Text, tt.want) {
+			t.Errorf("%s(%s) = %+v, want %q", tt.name, tt.args, result, tt.want)
+		}
+		if !tt.isError && result.StructuredContent == nil {
+			t.Errorf("%s(%s) has no structured content", tt.name, tt.args)
+		}
+	}
+}
+
+func TestServeMCP(t *testing.T) {
+	in := strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}
+
+{"jsonrpc":"2.0","method":"notifications/initialized"}
+{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"calculate","arguments":{"ip":"10.1.2.3","mask":"/30"}}}
+`)
+	var out bytes.Buffer
+	if code := runMCP(nil, in, &out, &out); code != 0 {
+		t.Fatalf("runMCP = %d: %s", code, out.String())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"id":1`) || !strings.Contains(lines[1], `"id":2`) || !strings.Contains(lines[1], `"broadcast_address":"10.1.2.3"`) {
+		t.Errorf("responses:\n%s", out.String())
+	}
+}
+
+func TestMCPOverSSE(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/mcp/sse", mcpSSEHandler)
+	mux.HandleFunc("/api/v1/mcp/messages", mcpMessagesHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/v1/mcp/sse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(resp.Body)
+	next := func() (string, string) {
+		t.Helper()
+		var event string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading events: %v", err)
+			}
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+			case strings.HasPrefix(line, "data: "):
+				return event, strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+			}
+		}
+	}
+
+	event, endpoint := next()
+	if event != "endpoint" || !strings.HasPrefix(endpoint, "/api/v1/mcp/messages?session=") {
+		t.Fatalf("first event %s: %s", event, endpoint)
+	}
+	post, err := http.Post(server.URL+endpoint, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"aggregate","arguments":{"prefixes":["10.0.0.0/25","10.0.0.128/25"]}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.Body.Close()
+	if post.StatusCode != http.StatusAccepted {
+		t.Errorf("POST message: status %d", post.StatusCode)
+	}
+	if event, data := next(); event != "message" || !strings.Contains(data, `"id":7`) || !strings.Contains(data, `10.0.0.0/24`) {
+		t.Errorf("response event %s: %s", event, data)
+	}
+
+	post, err = http.Post(server.URL+"/api/v1/mcp/messages?session=unknown", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.Body.Close()
+	if post.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown session: status %d", post.StatusCode)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+)
+
+// mmdbMetadataMarker starts the metadata section at the end of a MaxMind DB file
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// errMMDBCorrupt is returned for reads outside the file or undecodable data
+var errMMDBCorrupt = errors.New("corrupt MaxMind DB")
+
+// mmdbReader reads a MaxMind DB (MMDB) file held in memory, such as the GeoLite2
+// Country, City and ASN databases. Only lookups of IPv4 addresses are supported
+type mmdbReader struct {
+	buf          []byte
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	databaseType string
+	dataStart    uint
+	ipv4Start    uint
+	ipv4Depth    int
+}
+
+// newMMDBReader parses the metadata of an MMDB file and locates its search tree
+func newMMDBReader(buf []byte) (*mmdbReader, error) {
+	at := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if at < 0 {
+		return nil, fmt.Errorf("not a MaxMind DB file: metadata not found")
+	}
+	meta := &mmdbDecoder{buf: buf[at+len(mmdbMetadataMarker):]}
+	value, _, err := meta.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MaxMind DB metadata: %v", err)
+	}
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid MaxMind DB metadata")
+	}
+	number := func(key string) uint {
+		n, _ := m[key].(uint64)
+		return uint(n)
+	}
+	r := &mmdbReader{
+		buf:        buf,
+		nodeCount:  number("node_count"),
+		recordSize: number("record_size"),
+		ipVersion:  number("ip_version"),
+	}
+	r.databaseType, _ = m["database_type"].(string)
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported MaxMind DB record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported MaxMind DB IP version %d", r.ipVersion)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+16 > uint(at) {
+		return nil, errMMDBCorrupt
+	}
+	r.dataStart = treeSize + 16
+
+	// IPv4 addresses live under ::/96 of IPv6 databases
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			if node, err = r.record(node, 0); err != nil {
+				return nil, err
+			}
+		}
+		r.ipv4Start, r.ipv4Depth = node, 96
+	}
+	return r, nil
+}
+
+// record reads the left (bit 0) or right (bit 1) record of a search tree node
+func (r *mmdbReader) record(node, bit uint) (uint, error) {
+	nodeBytes := r.recordSize / 4
+	offset := node * nodeBytes
+	if offset+nodeBytes > uint(len(r.buf)) {
+		return 0, errMMDBCorrupt
+	}
+	b := r.buf[offset : offset+nodeBytes]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:])), nil
+	}
+}
+
+// Lookup returns the record of the network containing ip, or nil when the address is
+// not in the database, together with the network the record applies to
+func (r *mmdbReader) Lookup(ip net.IP) (interface{}, *net.IPNet, error) {
+	ip = ip.To4()
+	if ip == nil {
+		return nil, nil, fmt.Errorf("not an IPv4 address")
+	}
+	address := ipToUint32(ip)
+	node, depth := r.ipv4Start, r.ipv4Depth
+	for i := 0; i < 32 && node < r.nodeCount; i++ {
+		var err error
+		if node, err = r.record(node, uint(address>>uint(31-i))&1); err != nil {
+			return nil, nil, err
+		}
+		depth++
+	}
+	if node == r.nodeCount {
+		return nil, nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, nil, errMMDBCorrupt
+	}
+	ones := max(depth-r.ipv4Depth, 0)
+	mask := net.CIDRMask(ones, 32)
+	network := &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+
+	d := &mmdbDecoder{buf: r.buf[r.dataStart:]}
+	value, _, err := d.decode(node - r.nodeCount - 16)
+	return value, network, err
+}
+
+// mmdbDecoder decodes values of the MMDB data section format
+type mmdbDecoder struct {
+	buf []byte
+}
+
+// MMDB data types
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// bytes returns n bytes at offset
+func (d *mmdbDecoder) bytes(offset, n uint) ([]byte, error) {
+	if offset+n > uint(len(d.buf)) || offset+n < offset {
+		return nil, errMMDBCorrupt
+	}
+	return d.buf[offset : offset+n], nil
+}
+
+// mmdbUnsigned decodes a big-endian integer of any length up to eight bytes
+func mmdbUnsigned(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+// maxMMDBNesting bounds the nesting of maps, arrays and pointers, so a corrupt file
+// with a pointer cycle fails instead of recursing forever
+const maxMMDBNesting = 32
+
+// decode decodes the value at offset, returning it and the offset after it. Maps
+// become map[string]interface{}, arrays []interface{}, integers uint64 or int64
+// (uint128 as *big.Int) and floats float64
+func (d *mmdbDecoder) decode(offset uint) (interface{}, uint, error) {
+	return d.decodeNested(offset, 0)
+}
+
+func (d *mmdbDecoder) decodeNested(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxMMDBNesting {
+		return nil, 0, errMMDBCorrupt
+	}
+	ctrl, err := d.bytes(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+	kind := uint(ctrl[0] >> 5)
+
+	if kind == mmdbPointer {
+		ss, vvv := uint(ctrl[0]>>3)&3, uint(ctrl[0]&7)
+		b, err := d.bytes(offset, ss+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		var target uint
+		switch ss {
+		case 0:
+			target = vvv<<8 | uint(b[0])
+		case 1:
+			target = vvv<<16 | uint(mmdbUnsigned(b)) + 2048
+		case 2:
+			target = vvv<<24 | uint(mmdbUnsigned(b)) + 526336
+		default:
+			target = uint(mmdbUnsigned(b))
+		}
+		value, _, err := d.decodeNested(target, depth+1)
+		return value, offset + ss + 1, err
+	}
+
+	if kind == mmdbExtended {
+		b, err := d.bytes(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		kind = 7 + uint(b[0])
+		offset++
+	}
+	size := uint(ctrl[0] & 0x1f)
+	if size >= 29 {
+		extra := size - 28
+		b, err := d.bytes(offset, extra)
+		if err != nil {
+			return nil, 0, err
+		}
+		size = []uint{29, 285, 65821}[extra-1] + uint(mmdbUnsigned(b))
+		offset += extra
+	}
+
+	switch kind {
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decodeNested(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errMMDBCorrupt
+			}
+			if m[k], offset, err = d.decodeNested(next, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]interface{}, 0, min(size, 1024))
+		for i := uint(0); i < size; i++ {
+			var value interface{}
+			if value, offset, err = d.decodeNested(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbContainer, mmdbEndMarker:
+		return nil, offset, nil
+	}
+
+	b, err := d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+	switch kind {
+	case mmdbString:
+		return string(b), offset, nil
+	case mmdbBytes:
+		return append([]byte(nil), b...), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		if size > 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return mmdbUnsigned(b), offset, nil
+	case mmdbInt32:
+		if size > 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return int64(int32(uint32(mmdbUnsigned(b)))), offset, nil
+	case mmdbUint128:
+		return new(big.Int).SetBytes(b), offset, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unknown data type %d", errMMDBCorrupt, kind)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// defaultNAT64Prefix is the Well-Known Prefix of RFC 6052
+var defaultNAT64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// nat64Prefix is the prefix NAT64 translations use when a request names none
+var nat64Prefix = defaultNAT64Prefix
+
+// configureNAT64 reads GO_SUBNET_CALCULATOR_NAT64_PREFIX, the NAT64 or 464XLAT prefix
+// of the network (default 64:ff9b::/96)
+func configureNAT64() error {
+	nat64Prefix = defaultNAT64Prefix
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_NAT64_PREFIX"); value != "" {
+		prefix, err := parseNAT64Prefix(value)
+		if err != nil {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_NAT64_PREFIX: %v", err)
+		}
+		nat64Prefix = prefix
+	}
+	recordSystemAudit("config.nat64", "", "prefix %s", nat64Prefix)
+	return nil
+}
+
+// parseNAT64Prefix parses a prefix of one of the lengths RFC 6052 embeds IPv4
+// addresses at: 32, 40, 48, 56, 64 or 96 bits. Bits 64 to 71 are reserved and must
+// be zero
+func parseNAT64Prefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil || !prefix.Addr().Is6() || prefix.Addr().Is4In6() {
+		return netip.Prefix{}, fmt.Errorf("invalid IPv6 prefix: %s", s)
+	}
+	switch prefix.Bits() {
+	case 32, 40, 48, 56, 64, 96:
+	default:
+		return netip.Prefix{}, fmt.Errorf("NAT64 prefix %s must be a /32, /40, /48, /56, /64 or /96", s)
+	}
+	prefix = prefix.Masked()
+	if prefix.Addr().As16()[8] != 0 {
+		return netip.Prefix{}, fmt.Errorf("NAT64 prefix %s must have bits 64 to 71 set to zero", s)
+	}
+	return prefix, nil
+}
+
+// nat64Positions are the bytes of an IPv6 address the four bytes of an IPv4 address
+// are embedded at after a prefix of bits/8 bytes, skipping the reserved byte 8
+func nat64Positions(bits int) [4]int {
+	var positions [4]int
+	pos := bits / 8
+	for i := range positions {
+		if pos == 8 {
+			pos++
+		}
+		positions[i] = pos
+		pos++
+	}
+	return positions
+}
+
+// embedIPv4 returns the IPv6 address of an IPv4 address behind a NAT64 prefix
+func embedIPv4(prefix netip.Prefix, v4 netip.Addr) netip.Addr {
+	b, a := prefix.Addr().As16(), v4.As4()
+	for i, pos := range nat64Positions(prefix.Bits()) {
+		b[pos] = a[i]
+	}
+	return netip.AddrFrom16(b)
+}
+
+// extractIPv4 returns the IPv4 address embedded in an IPv6 address behind a NAT64
+// prefix
+func extractIPv4(prefix netip.Prefix, v6 netip.Addr) (netip.Addr, error) {
+	if !prefix.Contains(v6.WithZone("")) {
+		return netip.Addr{}, fmt.Errorf("%s is not within the NAT64 prefix %s", v6, prefix)
+	}
+	b := v6.As16()
+	if b[8] != 0 {
+		return netip.Addr{}, fmt.Errorf("%s has bits 64 to 71 set, which RFC 6052 reserves", v6)
+	}
+	var a [4]byte
+	for i, pos := range nat64Positions(prefix.Bits()) {
+		a[i] = b[pos]
+	}
+	return netip.AddrFrom4(a), nil
+}
+
+// NAT64Request asks for the IPv6 representation of ipv4 or the IPv4 address embedded
+// in ipv6, with the configured prefix unless it names one
+type NAT64Request struct {
+	Prefix string `json:"prefix,omitempty"`
+	IPv4   string `json:"ipv4,omitempty"`
+	IPv6   string `json:"ipv6,omitempty"`
+}
+
+// NAT64Response is an IPv4 address and its IPv6 representation behind a prefix. A
+// /96 representation is also given in mixed notation, such as 64:ff9b::192.0.2.33
+type NAT64Response struct {
+	Prefix   string `json:"prefix"`
+	IPv4     string `json:"ipv4"`
+	IPv6     string `json:"ipv6"`
+	Expanded string `json:"ipv6_expanded"`
+	Mixed    string `json:"ipv6_mixed,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+// translateNAT64 converts between an IPv4 address and its NAT64 or 464XLAT IPv6
+// representation (RFC 6052), in the direction the request gives
+func translateNAT64(req NAT64Request) (*NAT64Response, error) {
+	req.IPv4, req.IPv6 = strings.TrimSpace(req.IPv4), strings.TrimSpace(req.IPv6)
+	if (req.IPv4 == "") == (req.IPv6 == "") {
+		return nil, fmt.Errorf("exactly one of ipv4 and ipv6 is required")
+	}
+	prefix := nat64Prefix
+	if strings.TrimSpace(req.Prefix) != "" {
+		var err error
+		if prefix, err = parseNAT64Prefix(req.Prefix); err != nil {
+			return nil, err
+		}
+	}
+
+	var v4, v6 netip.Addr
+	if req.IPv4 != "" {
+		addr, err := netip.ParseAddr(canonicalIP(req.IPv4))
+		if err != nil || !addr.Unmap().Is4() {
+			return nil, fmt.Errorf("invalid IPv4 address: %s", req.IPv4)
+		}
+		v4 = addr.Unmap()
+		v6 = embedIPv4(prefix, v4)
+	} else {
+		addr, err := parseIPv6Address(req.IPv6)
+		if err != nil {
+			return nil, err
+		}
+		v6 = addr.WithZone("")
+		if v4, err = extractIPv4(prefix, v6); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &NAT64Response{Prefix: prefix.String(), IPv4: v4.String(), IPv6: v6.String(), Expanded: v6.StringExpanded()}
+	// Mixed notation needs the prefix to end in zeros that compress to ::
+	if s := prefix.Addr().String(); prefix.Bits() == 96 && strings.HasSuffix(s, "::") {
+		resp.Mixed = s + v4.String()
+	}
+	if prefix == defaultNAT64Prefix && !isPublicIPv4(v4.AsSlice()) {
+		resp.Note = "RFC 6052 does not allow the Well-Known Prefix for non-global IPv4 addresses such as " + v4.String() + "; use a network-specific prefix"
+	}
+	return resp, nil
+}
+
+// nat64Handler serves /api/v1/ipv6/nat64; POST takes a JSON body, GET takes the
+// prefix, ipv4 and ipv6 query parameters
+func nat64Handler(w http.ResponseWriter, r *http.Request) {
+	var req NAT64Request
+
+	switch r.Method {
+	case http.MethodPost:
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+	case http.MethodGet:
+		query := r.URL.Query()
+		req = NAT64Request{Prefix: query.Get("prefix"), IPv4: query.Get("ipv4"), IPv6: query.Get("ipv6")}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	resp, err := translateNAT64(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
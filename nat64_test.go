@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTranslateNAT64(t *testing.T) {
+	// The examples of RFC 6052 section 2.4
+	for prefix, want := range map[string]string{
+		"2001:db8::/32":          "2001:db8:c000:221::",
+		"2001:db8:100::/40":      "2001:db8:1c0:2:21::",
+		"2001:db8:122::/48":      "2001:db8:122:c000:2:2100::",
+		"2001:db8:122:300::/56":  "2001:db8:122:3c0:0:221::",
+		"2001:db8:122:344::/64":  "2001:db8:122:344:c0:2:2100:0",
+		"2001:db8:122:344::/96":  "2001:db8:122:344::c000:221",
+		"2001:db8:122:344::1/96": "2001:db8:122:344::c000:221",
+	} {
+		resp, err := translateNAT64(NAT64Request{Prefix: prefix, IPv4: "192.0.2.33"})
+		if err != nil || resp.IPv6 != want {
+			t.Errorf("%s: 192.0.2.33 = %+v, %v, want %s", prefix, resp, err, want)
+			continue
+		}
+		back, err := translateNAT64(NAT64Request{Prefix: prefix, IPv6: want})
+		if err != nil || back.IPv4 != "192.0.2.33" {
+			t.Errorf("%s: %s = %+v, %v, want 192.0.2.33", prefix, want, back, err)
+		}
+	}
+
+	resp, err := translateNAT64(NAT64Request{IPv4: "198.51.100.7"})
+	if err != nil || resp.Prefix != "64:ff9b::/96" || resp.IPv6 != "64:ff9b::c633:6407" || resp.Mixed != "64:ff9b::198.51.100.7" ||
+		resp.Expanded != "0064:ff9b:0000:0000:0000:0000:c633:6407" || resp.Note == "" {
+		t.Errorf("198.51.100.7 = %+v, %v", resp, err)
+	}
+	if resp, err := translateNAT64(NAT64Request{IPv6: "64:ff9b::8.8.8.8"}); err != nil || resp.IPv4 != "8.8.8.8" || resp.Note != "" {
+		t.Errorf("64:ff9b::8.8.8.8 = %+v, %v", resp, err)
+	}
+
+	for _, req := range []NAT64Request{
+		{},
+		{IPv4: "192.0.2.1", IPv6: "64:ff9b::c000:201"},
+		{IPv4: "bogus"},
+		{IPv4: "2001:db8::1"},
+		{IPv6: "192.0.2.1"},
+		{IPv6: "2001:db8::c000:201"},
+		{Prefix: "2001:db8::/33", IPv4: "192.0.2.1"},
+		{Prefix: "2001:db8:0:0:100::/96", IPv4: "192.0.2.1"},
+		{Prefix: "10.0.0.0/8", IPv4: "192.0.2.1"},
+		{Prefix: "2001:db8::/64", IPv6: "2001:db8::100:c000:201:0"},
+	} {
+		if resp, err := translateNAT64(req); err == nil {
+			t.Errorf("translateNAT64(%+v) = %+v, want an error", req, resp)
+		}
+	}
+}
+
+func TestConfigureNAT64(t *testing.T) {
+	t.Cleanup(func() { nat64Prefix = defaultNAT64Prefix })
+	withTestAudit(t)
+
+	t.Setenv("GO_SUBNET_CALCULATOR_NAT64_PREFIX", "2001:db8:64::/96")
+	if err := configureNAT64(); err != nil || nat64Prefix.String() != "2001:db8:64::/96" {
+		t.Fatalf("configureNAT64() = %v, prefix %s", err, nat64Prefix)
+	}
+	rr := httptest.NewRecorder()
+	nat64Handler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ipv6/nat64?ipv4=10.1.2.3", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"ipv6":"2001:db8:64::a01:203"`) || strings.Contains(rr.Body.String(), "note") {
+		t.Errorf("GET with the configured prefix: status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	t.Setenv("GO_SUBNET_CALCULATOR_NAT64_PREFIX", "2001:db8::/60")
+	if err := configureNAT64(); err == nil {
+		t.Error("configureNAT64() accepted a /60")
+	}
+}
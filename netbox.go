@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// netboxTimeout bounds every request to the NetBox API
+const netboxTimeout = 30 * time.Second
+
+// netboxPageSize is the page size used when listing NetBox prefixes
+const netboxPageSize = 1000
+
+// errNetBox wraps every failure talking to NetBox so it can be reported as 502
+var errNetBox = errors.New("NetBox request failed")
+
+// NetBox prefix statuses used for IPAM pools and allocations
+const (
+	netboxPoolStatus       = "container"
+	netboxAllocationStatus = "active"
+)
+
+// netboxPrefix is the subset of a NetBox IPAM prefix this application reads and writes
+type netboxPrefix struct {
+	ID          int64  `json:"id,omitempty"`
+	Prefix      string `json:"prefix"`
+	Status      string `json:"status"`
+	Description string `json:"description"`
+	VRF         bool   `json:"-"`
+}
+
+// UnmarshalJSON reads the nested status and VRF objects of the NetBox API
+func (p *netboxPrefix) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ID          int64           `json:"id"`
+		Prefix      string          `json:"prefix"`
+		Status      json.RawMessage `json:"status"`
+		Description string          `json:"description"`
+		VRF         json.RawMessage `json:"vrf"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	p.ID, p.Prefix, p.Description = raw.ID, raw.Prefix, raw.Description
+	p.VRF = len(raw.VRF) > 0 && string(raw.VRF) != "null"
+
+	// status is {"value": "active", "label": "Active"} on reads and a plain string on writes
+	var status struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(raw.Status, &status); err == nil {
+		p.Status = status.Value
+	} else {
+		json.Unmarshal(raw.Status, &p.Status)
+	}
+	return nil
+}
+
+// netboxClient talks to the NetBox REST API with a token
+type netboxClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// newNetBoxClient reads GO_SUBNET_CALCULATOR_NETBOX_URL and the
+// GO_SUBNET_CALCULATOR_NETBOX_TOKEN secret
+func newNetBoxClient() (*netboxClient, error) {
+	baseURL := strings.TrimRight(os.Getenv("GO_SUBNET_CALCULATOR_NETBOX_URL"), "/")
+	if baseURL == "" {
+		return nil, fmt.Errorf("NetBox is not configured, set GO_SUBNET_CALCULATOR_NETBOX_URL")
+	}
+	token, err := loadSecret("GO_SUBNET_CALCULATOR_NETBOX_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, fmt.Errorf("GO_SUBNET_CALCULATOR_NETBOX_TOKEN is required")
+	}
+	return &netboxClient{baseURL: baseURL, token: token, client: &http.Client{Timeout: netboxTimeout}}, nil
+}
+
+// do sends a request to NetBox and decodes the JSON response into out when it is not nil
+func (c *netboxClient) do(method, target string, body, out interface{}) error {
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		target = c.baseURL + target
+	}
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, target, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errNetBox, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errNetBox, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: %s %s: %s: %s", errNetBox, method, req.URL.Path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%w: invalid response: %v", errNetBox, err)
+	}
+	return nil
+}
+
+// listPrefixes returns every IPv4 prefix in the global table, following NetBox pagination
+func (c *netboxClient) listPrefixes() ([]netboxPrefix, error) {
+	var prefixes []netboxPrefix
+	next := fmt.Sprintf("/api/ipam/prefixes/?family=4&limit=%d", netboxPageSize)
+	for next != "" {
+		var page struct {
+			Next    string         `json:"next"`
+			Results []netboxPrefix `json:"results"`
+		}
+		if err := c.do(http.MethodGet, next, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, p := range page.Results {
+			if !p.VRF {
+				prefixes = append(prefixes, p)
+			}
+		}
+		next = page.Next
+	}
+	return prefixes, nil
+}
+
+func (c *netboxClient) createPrefix(p netboxPrefix) error {
+	return c.do(http.MethodPost, "/api/ipam/prefixes/", p, nil)
+}
+
+func (c *netboxClient) updateDescription(id int64, description string) error {
+	return c.do(http.MethodPatch, fmt.Sprintf("/api/ipam/prefixes/%d/", id), map[string]string{"description": description}, nil)
+}
+
+// NetBoxChange is a prefix created or updated by a sync
+type NetBoxChange struct {
+	Prefix      string `json:"prefix"`
+	Kind        string `json:"kind"`
+	Pool        string `json:"pool,omitempty"`
+	Description string `json:"description,omitempty"`
+	NetBoxID    int64  `json:"netbox_id,omitempty"`
+}
+
+// NetBoxConflict is a prefix where NetBox and the IPAM disagree and nothing was changed
+type NetBoxConflict struct {
+	Prefix string `json:"prefix"`
+	Reason string `json:"reason"`
+}
+
+// NetBoxSyncResult reports what a push or pull changed, or would change in a dry run
+type NetBoxSyncResult struct {
+	Direction string           `json:"direction"`
+	DryRun    bool             `json:"dry_run"`
+	Created   []NetBoxChange   `json:"created"`
+	Updated   []NetBoxChange   `json:"updated"`
+	Conflicts []NetBoxConflict `json:"conflicts"`
+	Unchanged int              `json:"unchanged"`
+	Skipped   int              `json:"skipped"`
+}
+
+func (r *NetBoxSyncResult) conflict(prefix, format string, args ...interface{}) {
+	r.Conflicts = append(r.Conflicts, NetBoxConflict{Prefix: prefix, Reason: fmt.Sprintf(format, args...)})
+}
+
+// netboxPush makes NetBox agree with the IPAM: pools become container prefixes and
+// allocations active prefixes. Missing prefixes are created and descriptions updated;
+// status mismatches and NetBox prefixes inside a pool that the IPAM does not know are
+// reported as conflicts
+func netboxPush(m *IPAM, c *netboxClient, dryRun bool) (*NetBoxSyncResult, error) {
+	result := &NetBoxSyncResult{Direction: "push", DryRun: dryRun}
+	existing, err := c.listPrefixes()
+	if err != nil {
+		return nil, err
+	}
+	byPrefix := make(map[string]netboxPrefix, len(existing))
+	for _, p := range existing {
+		if network, err := parseIPv4Prefix(p.Prefix); err == nil && network.String() == p.Prefix {
+			byPrefix[p.Prefix] = p
+		}
+	}
+
+	pools, err := m.Pools()
+	if err != nil {
+		return nil, err
+	}
+	var desired []netboxPrefix
+	poolNets, allocationNets := newPrefixIndex(), newPrefixIndex()
+	poolOf := map[string]string{}
+	for _, pool := range pools {
+		description := pool.Description
+		if description == "" {
+			description = pool.Name
+		}
+		desired = append(desired, netboxPrefix{Prefix: pool.Prefix, Status: netboxPoolStatus, Description: description})
+		if n, err := parseIPv4Prefix(pool.Prefix); err == nil {
+			poolNets.InsertPrefix(n, n)
+		}
+		allocations, err := m.Allocations(pool.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range allocations {
+			desired = append(desired, netboxPrefix{Prefix: a.Prefix, Status: netboxAllocationStatus, Description: a.Description})
+			poolOf[a.Prefix] = pool.Prefix
+			if n, err := parseIPv4Prefix(a.Prefix); err == nil {
+				allocationNets.InsertPrefix(n, n)
+			}
+		}
+	}
+
+	known := map[string]bool{}
+	for _, want := range desired {
+		known[want.Prefix] = true
+		change := NetBoxChange{Prefix: want.Prefix, Kind: want.Status, Pool: poolOf[want.Prefix], Description: want.Description}
+		got, ok := byPrefix[want.Prefix]
+		switch {
+		case !ok:
+			if !dryRun {
+				if err := c.createPrefix(want); err != nil {
+					result.conflict(want.Prefix, "create failed: %v", err)
+					continue
+				}
+			}
+			result.Created = append(result.Created, change)
+		case got.Status != want.Status:
+			result.conflict(want.Prefix, "NetBox status is %q, IPAM expects %q", got.Status, want.Status)
+		case got.Description != want.Description:
+			change.NetBoxID = got.ID
+			if !dryRun {
+				if err := c.updateDescription(got.ID, want.Description); err != nil {
+					result.conflict(want.Prefix, "update failed: %v", err)
+					continue
+				}
+			}
+			result.Updated = append(result.Updated, change)
+		default:
+			result.Unchanged++
+		}
+	}
+
+	for _, p := range existing {
+		network, err := parseIPv4Prefix(p.Prefix)
+		if err != nil || known[p.Prefix] {
+			continue
+		}
+		if containingPrefix(poolNets, network) != nil && containingPrefix(allocationNets, network) == nil {
+			result.conflict(p.Prefix, "exists in NetBox (%s) but is not allocated in the IPAM", p.Status)
+		}
+	}
+	return result, nil
+}
+
+// netboxPull seeds the IPAM from NetBox: container prefixes become pools and the
+// prefixes inside them allocations. Prefixes outside every pool are skipped and
+// overlaps with existing IPAM data are reported as conflicts
+func netboxPull(m *IPAM, c *netboxClient, dryRun bool) (*NetBoxSyncResult, error) {
+	result := &NetBoxSyncResult{Direction: "pull", DryRun: dryRun}
+	existing, err := c.listPrefixes()
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		network *net.IPNet
+		prefix  netboxPrefix
+	}
+	var candidates []candidate
+	for _, p := range existing {
+		network, err := parseIPv4Prefix(p.Prefix)
+		if err != nil || p.Status == "deprecated" {
+			result.Skipped++
+			continue
+		}
+		candidates = append(candidates, candidate{network, p})
+	}
+	// parents before children so pools exist before their allocations are planned
+	sort.SliceStable(candidates, func(i, j int) bool {
+		oi, _ := candidates[i].network.Mask.Size()
+		oj, _ := candidates[j].network.Mask.Size()
+		if oi != oj {
+			return oi < oj
+		}
+		return ipToUint32(candidates[i].network.IP) < ipToUint32(candidates[j].network.IP)
+	})
+
+	poolNets, poolIDs, allocated, err := ipamPrefixIndexes(m)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cand := range candidates {
+		prefix, network := cand.network.String(), cand.network
+		change := NetBoxChange{Prefix: prefix, Kind: cand.prefix.Status, Description: cand.prefix.Description, NetBoxID: cand.prefix.ID}
+
+		if cand.prefix.Status == netboxPoolStatus {
+			if _, ok := poolIDs[prefix]; ok {
+				result.Unchanged++
+				continue
+			}
+			if other := overlappingPrefix(poolNets, network); other != nil {
+				result.conflict(prefix, "overlaps IPAM pool %s", other)
+				continue
+			}
+			var id int64
+			if !dryRun {
+				name := cand.prefix.Description
+				if name == "" {
+					name = prefix
+				}
+				pool, err := m.CreatePool(PoolRequest{Name: name, Prefix: prefix, Description: cand.prefix.Description})
+				if err != nil {
+					result.conflict(prefix, "%v", err)
+					continue
+				}
+				id = pool.ID
+			}
+			poolNets.InsertPrefix(network, network)
+			poolIDs[prefix] = id
+			allocated[prefix] = newPrefixIndex()
+			result.Created = append(result.Created, change)
+			continue
+		}
+
+		pool := containingPrefix(poolNets, network)
+		if pool == nil {
+			result.Skipped++
+			continue
+		}
+		change.Pool = pool.String()
+		if pool.String() == prefix {
+			result.conflict(prefix, "is a pool in the IPAM but %q in NetBox", cand.prefix.Status)
+			continue
+		}
+		siblings := allocated[pool.String()]
+		if other := overlappingPrefix(siblings, network); other != nil {
+			if other.String() == prefix {
+				result.Unchanged++
+			} else {
+				result.conflict(prefix, "overlaps IPAM allocation %s", other)
+			}
+			continue
+		}
+		if !dryRun {
+			if _, err := m.Allocate(poolIDs[pool.String()], AllocationRequest{Prefix: prefix, Description: cand.prefix.Description}); err != nil {
+				result.conflict(prefix, "%v", err)
+				continue
+			}
+		}
+		siblings.InsertPrefix(network, network)
+		result.Created = append(result.Created, change)
+	}
+	return result, nil
+}
+
+// prefixIndex is an interval index of prefixes, each stored as its own value
+type prefixIndex = cidrset.Index[*net.IPNet]
+
+// newPrefixIndex indexes the given prefixes
+func newPrefixIndex(prefixes ...*net.IPNet) *prefixIndex {
+	index := cidrset.NewIndex[*net.IPNet]()
+	for _, p := range prefixes {
+		index.InsertPrefix(p, p)
+	}
+	return index
+}
+
+// containingPrefix returns the least specific prefix in the index that contains network
+func containingPrefix(index *prefixIndex, network *net.IPNet) *net.IPNet {
+	first := cidrset.PrefixToRange(network).First
+	for _, e := range index.Overlapping(cidrset.Range{First: first, Last: first}) {
+		if prefixContains(e.Value, network) {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+// overlappingPrefix returns a prefix in the index that overlaps network
+func overlappingPrefix(index *prefixIndex, network *net.IPNet) *net.IPNet {
+	if e, ok := index.OverlapPrefix(network); ok {
+		return e.Value
+	}
+	return nil
+}
+
+// ipamPrefixIndexes indexes the pool prefixes of the IPAM and, by pool prefix, the
+// allocations of each pool, and maps the pool prefixes to their ids
+func ipamPrefixIndexes(m *IPAM) (*prefixIndex, map[string]int64, map[string]*prefixIndex, error) {
+	pools, err := m.Pools()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	poolNets := newPrefixIndex()
+	poolIDs := map[string]int64{}
+	allocated := map[string]*prefixIndex{}
+	for _, pool := range pools {
+		n, err := parseIPv4Prefix(pool.Prefix)
+		if err != nil {
+			continue
+		}
+		poolNets.InsertPrefix(n, n)
+		poolIDs[n.String()] = pool.ID
+		allocations, err := m.Allocations(pool.ID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		allocated[n.String()] = newPrefixIndex()
+		for _, a := range allocations {
+			if an, err := parseIPv4Prefix(a.Prefix); err == nil {
+				allocated[n.String()].InsertPrefix(an, an)
+			}
+		}
+	}
+	return poolNets, poolIDs, allocated, nil
+}
+
+// ipamNetBoxHandler serves POST /api/v1/ipam/netbox/{direction} where direction is push
+// (IPAM to NetBox) or pull (NetBox to IPAM); ?dry_run=true reports without changing anything
+func ipamNetBoxHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	// a sync covers the whole IPAM, so it is not left to a single tenant
+	if err := requestPrincipal(r).checkGlobal(RoleAdmin); err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	sync := map[string]func(*IPAM, *netboxClient, bool) (*NetBoxSyncResult, error){
+		"push": netboxPush,
+		"pull": netboxPull,
+	}[r.PathValue("direction")]
+	if sync == nil {
+		writeJSONError(w, http.StatusNotFound, "direction must be push or pull")
+		return
+	}
+
+	client, err := newNetBoxClient()
+	if err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "dry_run must be true or false")
+			return
+		}
+	}
+
+	result, err := sync(ipamService, client, dryRun)
+	if errors.Is(err, errNetBox) {
+		writeJSONError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	if !dryRun {
+		recordAudit(r, "netbox."+result.Direction, os.Getenv("GO_SUBNET_CALCULATOR_NETBOX_URL"), "%d created, %d updated, %d conflicts",
+			len(result.Created), len(result.Updated), len(result.Conflicts))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeNetBox is an in-memory NetBox prefix API serving two results per page
+type fakeNetBox struct {
+	mu       sync.Mutex
+	prefixes []map[string]interface{}
+	requests []string
+}
+
+func (f *fakeNetBox) add(prefix, status, description string, vrf interface{}) {
+	f.prefixes = append(f.prefixes, map[string]interface{}{
+		"id":          len(f.prefixes) + 1,
+		"prefix":      prefix,
+		"status":      map[string]string{"value": status, "label": strings.ToUpper(status[:1]) + status[1:]},
+		"description": description,
+		"vrf":         vrf,
+	})
+}
+
+func (f *fakeNetBox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if r.Header.Get("Authorization") != "Token secret" {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"detail": "Invalid token"}`)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/ipam/prefixes/":
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		end := min(offset+2, len(f.prefixes))
+		page := map[string]interface{}{"count": len(f.prefixes), "results": f.prefixes[offset:end], "next": nil}
+		if end < len(f.prefixes) {
+			page["next"] = fmt.Sprintf("http://%s/api/ipam/prefixes/?family=4&limit=2&offset=%d", r.Host, end)
+		}
+		json.NewEncoder(w).Encode(page)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/ipam/prefixes/":
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		f.add(body["prefix"], body["status"], body["description"], nil)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPatch:
+		id, _ := strconv.Atoi(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/ipam/prefixes/"), "/"))
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		f.prefixes[id-1]["description"] = body["description"]
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeNetBox) count(request string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, r := range f.requests {
+		if r == request {
+			n++
+		}
+	}
+	return n
+}
+
+// withFakeNetBox starts a fake NetBox and points the client configuration at it
+func withFakeNetBox(t *testing.T) (*fakeNetBox, *netboxClient) {
+	t.Helper()
+	fake := &fakeNetBox{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	t.Setenv("GO_SUBNET_CALCULATOR_NETBOX_URL", server.URL+"/")
+	t.Setenv("GO_SUBNET_CALCULATOR_NETBOX_TOKEN", "secret")
+	client, err := newNetBoxClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, client
+}
+
+func TestNewNetBoxClient(t *testing.T) {
+	t.Setenv("GO_SUBNET_CALCULATOR_NETBOX_URL", "")
+	if _, err := newNetBoxClient(); err == nil {
+		t.Error("newNetBoxClient() without a URL should fail")
+	}
+	t.Setenv("GO_SUBNET_CALCULATOR_NETBOX_URL", "https://netbox.example.com/")
+	t.Setenv("GO_SUBNET_CALCULATOR_NETBOX_TOKEN", "")
+	if _, err := newNetBoxClient(); err == nil {
+		t.Error("newNetBoxClient() without a token should fail")
+	}
+	t.Setenv("GO_SUBNET_CALCULATOR_NETBOX_TOKEN", "abc")
+	c, err := newNetBoxClient()
+	if err != nil || c.baseURL != "https://netbox.example.com" {
+		t.Errorf("newNetBoxClient() = %+v, %v", c, err)
+	}
+}
+
+func TestNetBoxListPrefixes(t *testing.T) {
+	fake, client := withFakeNetBox(t)
+	fake.add("10.0.0.0/16", "container", "dc1", nil)
+	fake.add("10.0.1.0/24", "active", "web", nil)
+	fake.add("10.0.2.0/24", "active", "other vrf", map[string]int{"id": 3})
+	fake.add("10.0.3.0/24", "reserved", "", nil)
+
+	prefixes, err := client.listPrefixes()
+	if err != nil {
+		t.Fatalf("listPrefixes() unexpected error: %v", err)
+	}
+	if len(prefixes) != 3 {
+		t.Fatalf("listPrefixes() = %+v, want 3 global prefixes across pages", prefixes)
+	}
+	if prefixes[0].Status != "container" || prefixes[1].Description != "web" || prefixes[2].Prefix != "10.0.3.0/24" {
+		t.Errorf("listPrefixes() = %+v", prefixes)
+	}
+	if got := fake.count("GET /api/ipam/prefixes/"); got != 2 {
+		t.Errorf("listPrefixes() made %d requests, want 2 pages", got)
+	}
+
+	client.token = "wrong"
+	if _, err := client.listPrefixes(); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("listPrefixes() with a bad token = %v, want a 403 error", err)
+	}
+}
+
+func TestNetBoxPush(t *testing.T) {
+	fake, client := withFakeNetBox(t)
+	m := newIPAM(newMemoryIPAMStore())
+	pool, _ := m.CreatePool(PoolRequest{Name: "dc1", Prefix: "10.0.0.0/16"})
+	m.Allocate(pool.ID, AllocationRequest{Prefix: "10.0.1.0/24", Description: "web"})
+	m.Allocate(pool.ID, AllocationRequest{Prefix: "10.0.2.0/24", Description: "db"})
+	m.Allocate(pool.ID, AllocationRequest{Prefix: "10.0.3.0/24", Description: "mgmt"})
+
+	fake.add("10.0.1.0/24", "active", "old name", nil)
+	fake.add("10.0.2.0/24", "reserved", "db", nil)
+	fake.add("10.0.9.0/24", "active", "unknown", nil)
+	fake.add("10.0.1.0/26", "active", "inside an allocation", nil)
+	fake.add("192.168.0.0/24", "active", "outside every pool", nil)
+
+	dry, err := netboxPush(m, client, true)
+	if err != nil {
+		t.Fatalf("netboxPush() unexpected error: %v", err)
+	}
+	if len(dry.Created) != 2 || dry.Created[0].Prefix != "10.0.0.0/16" || dry.Created[0].Kind != "container" || dry.Created[1].Prefix != "10.0.3.0/24" {
+		t.Errorf("dry run created = %+v", dry.Created)
+	}
+	if len(dry.Updated) != 1 || dry.Updated[0].Description != "web" || dry.Updated[0].NetBoxID != 1 {
+		t.Errorf("dry run updated = %+v", dry.Updated)
+	}
+	if len(dry.Conflicts) != 2 || dry.Conflicts[0].Prefix != "10.0.2.0/24" || dry.Conflicts[1].Prefix != "10.0.9.0/24" {
+		t.Errorf("dry run conflicts = %+v", dry.Conflicts)
+	}
+	if fake.count("POST /api/ipam/prefixes/") != 0 || fake.count("PATCH /api/ipam/prefixes/1/") != 0 {
+		t.Error("dry run must not change NetBox")
+	}
+
+	applied, err := netboxPush(m, client, false)
+	if err != nil || applied.DryRun || len(applied.Created) != 2 || len(applied.Updated) != 1 {
+		t.Fatalf("netboxPush() = %+v, %v", applied, err)
+	}
+	if fake.count("POST /api/ipam/prefixes/") != 2 || fake.count("PATCH /api/ipam/prefixes/1/") != 1 {
+		t.Errorf("requests = %v", fake.requests)
+	}
+
+	again, _ := netboxPush(m, client, false)
+	if len(again.Created) != 0 || len(again.Updated) != 0 || again.Unchanged != 3 {
+		t.Errorf("second push = %+v, want only unchanged prefixes and the conflicts", again)
+	}
+}
+
+func TestNetBoxPull(t *testing.T) {
+	fake, client := withFakeNetBox(t)
+	fake.add("10.1.0.0/16", "container", "campus", nil)
+	fake.add("10.1.1.0/24", "active", "wifi", nil)
+	fake.add("10.1.1.0/26", "active", "wifi ap", nil)
+	fake.add("10.1.2.0/24", "deprecated", "old", nil)
+	fake.add("172.16.0.0/24", "active", "no pool", nil)
+	fake.add("10.2.0.0/16", "container", "", nil)
+	fake.add("10.2.0.0/24", "container", "nested", nil)
+	fake.add("10.2.5.0/24", "reserved", "", nil)
+
+	m := newIPAM(newMemoryIPAMStore())
+	dry, err := netboxPull(m, client, true)
+	if err != nil {
+		t.Fatalf("netboxPull() unexpected error: %v", err)
+	}
+	var created []string
+	for _, c := range dry.Created {
+		created = append(created, c.Prefix)
+	}
+	if got := strings.Join(created, " "); got != "10.1.0.0/16 10.2.0.0/16 10.1.1.0/24 10.2.5.0/24" {
+		t.Errorf("dry run created = %s", got)
+	}
+	if len(dry.Conflicts) != 2 || dry.Conflicts[0].Prefix != "10.2.0.0/24" || dry.Conflicts[1].Prefix != "10.1.1.0/26" {
+		t.Errorf("dry run conflicts = %+v", dry.Conflicts)
+	}
+	if dry.Skipped != 2 {
+		t.Errorf("dry run skipped = %d, want the deprecated and the pool-less prefix", dry.Skipped)
+	}
+	if pools, _ := m.Pools(); len(pools) != 0 {
+		t.Fatalf("dry run created pools: %+v", pools)
+	}
+
+	if _, err := netboxPull(m, client, false); err != nil {
+		t.Fatal(err)
+	}
+	pools, _ := m.Pools()
+	if len(pools) != 2 || pools[0].Name != "campus" || pools[1].Name != "10.2.0.0/16" || pools[0].Allocations != 1 {
+		t.Fatalf("pools after pull = %+v", pools)
+	}
+	allocations, _ := m.Allocations(pools[0].ID)
+	if allocations[0].Prefix != "10.1.1.0/24" || allocations[0].Description != "wifi" {
+		t.Errorf("allocations after pull = %+v", allocations)
+	}
+
+	again, _ := netboxPull(m, client, false)
+	if len(again.Created) != 0 || again.Unchanged != 4 {
+		t.Errorf("second pull = %+v, want everything unchanged", again)
+	}
+}
+
+func TestIPAMNetBoxHandler(t *testing.T) {
+	fake, _ := withFakeNetBox(t)
+	fake.add("10.9.0.0/16", "container", "lab", nil)
+	withTestIPAM(t)
+
+	tests := []struct {
+		method, target string
+		wantStatus     int
+	}{
+		{http.MethodGet, "/api/v1/ipam/netbox/pull", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/v1/ipam/netbox/sideways", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/ipam/netbox/pull?dry_run=maybe", http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/ipam/netbox/pull?dry_run=true", http.StatusOK},
+		{http.MethodPost, "/api/v1/ipam/netbox/pull", http.StatusOK},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/ipam/netbox/{direction}", ipamNetBoxHandler)
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.target, nil))
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s %s status = %d, want %d: %s", tt.method, tt.target, rr.Code, tt.wantStatus, rr.Body)
+		}
+	}
+	if pools, _ := ipamService.Pools(); len(pools) != 1 || pools[0].Name != "lab" {
+		t.Errorf("pools after pull = %+v", pools)
+	}
+
+	t.Setenv("GO_SUBNET_CALCULATOR_NETBOX_TOKEN", "wrong")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ipam/netbox/push", nil))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("push with a rejected token status = %d, want 502", rr.Code)
+	}
+
+	t.Setenv("GO_SUBNET_CALCULATOR_NETBOX_URL", "")
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ipam/netbox/push", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("push without configuration status = %d, want 503", rr.Code)
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcTimeout bounds every request to the identity provider
+const oidcTimeout = 10 * time.Second
+
+// oidcClockSkew is the tolerance when checking ID token expiry
+const oidcClockSkew = time.Minute
+
+// oidcProvider signs users in with the OpenID Connect authorization code flow (with
+// PKCE). Discovery and signing keys are fetched from the issuer on first use and cached
+type oidcProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	client       *http.Client
+
+	mu     sync.Mutex
+	config *oidcConfiguration
+	keys   map[string]*rsa.PublicKey
+}
+
+// oidcConfiguration is the part of the discovery document the login flow needs
+type oidcConfiguration struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcClaims are the ID token claims that are checked or used as the user name
+type oidcClaims struct {
+	Issuer            string       `json:"iss"`
+	Subject           string       `json:"sub"`
+	Audience          oidcAudience `json:"aud"`
+	Expiry            int64        `json:"exp"`
+	Nonce             string       `json:"nonce"`
+	PreferredUsername string       `json:"preferred_username"`
+	Email             string       `json:"email"`
+}
+
+// username prefers preferred_username, then email, then the subject
+func (c *oidcClaims) username() string {
+	for _, name := range []string{c.PreferredUsername, c.Email} {
+		if name != "" {
+			return name
+		}
+	}
+	return c.Subject
+}
+
+// oidcAudience accepts the aud claim as a single string or a list
+type oidcAudience []string
+
+func (a *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = oidcAudience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("aud must be a string or a list of strings")
+	}
+	*a = list
+	return nil
+}
+
+// newOIDCProvider reads GO_SUBNET_CALCULATOR_OIDC_ISSUER, _CLIENT_ID, _REDIRECT_URL and
+// the GO_SUBNET_CALCULATOR_OIDC_CLIENT_SECRET secret
+func newOIDCProvider() (*oidcProvider, error) {
+	p := &oidcProvider{
+		issuer:      os.Getenv("GO_SUBNET_CALCULATOR_OIDC_ISSUER"),
+		clientID:    os.Getenv("GO_SUBNET_CALCULATOR_OIDC_CLIENT_ID"),
+		redirectURL: os.Getenv("GO_SUBNET_CALCULATOR_OIDC_REDIRECT_URL"),
+		client:      &http.Client{Timeout: oidcTimeout},
+		keys:        map[string]*rsa.PublicKey{},
+	}
+	if p.issuer == "" || p.clientID == "" || p.redirectURL == "" {
+		return nil, fmt.Errorf("GO_SUBNET_CALCULATOR_OIDC_ISSUER, GO_SUBNET_CALCULATOR_OIDC_CLIENT_ID and GO_SUBNET_CALCULATOR_OIDC_REDIRECT_URL are required for OIDC login")
+	}
+	for name, value := range map[string]string{"issuer": p.issuer, "redirect URL": p.redirectURL} {
+		if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("OIDC %s must be an http or https URL, got %q", name, value)
+		}
+	}
+	secret, err := loadSecret("GO_SUBNET_CALCULATOR_OIDC_CLIENT_SECRET")
+	if err != nil {
+		return nil, err
+	}
+	p.clientSecret = secret
+	return p, nil
+}
+
+// getJSON fetches a JSON document from the identity provider
+func (p *oidcProvider) getJSON(target string, v interface{}) error {
+	resp, err := p.client.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", target, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// discover loads the issuer's discovery document once
+func (p *oidcProvider) discover() (*oidcConfiguration, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.config != nil {
+		return p.config, nil
+	}
+	var c oidcConfiguration
+	if err := p.getJSON(strings.TrimSuffix(p.issuer, "/")+"/.well-known/openid-configuration", &c); err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %w", err)
+	}
+	if c.Issuer != p.issuer {
+		return nil, fmt.Errorf("OIDC discovery: issuer %q does not match the configured %q", c.Issuer, p.issuer)
+	}
+	if c.AuthorizationEndpoint == "" || c.TokenEndpoint == "" || c.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery: authorization, token or JWKS endpoint missing")
+	}
+	p.config = &c
+	return &c, nil
+}
+
+// pkceChallenge is the S256 code challenge for a verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authCodeURL returns the identity provider URL that starts a login
+func (p *oidcProvider) authCodeURL(state, nonce, verifier string) (string, error) {
+	c, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.clientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {"openid profile email"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {pkceChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(c.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return c.AuthorizationEndpoint + separator + q.Encode(), nil
+}
+
+// exchange redeems an authorization code for an ID token
+func (p *oidcProvider) exchange(code, verifier string) (string, error) {
+	c, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest(http.MethodPost, c.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("OIDC token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("OIDC token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("OIDC token request: %s %s %s", resp.Status, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", fmt.Errorf("OIDC token response has no id_token")
+	}
+	return token.IDToken, nil
+}
+
+// signingKey returns the RSA key with the given id, refreshing the JWKS once when it
+// is unknown so that key rotation at the provider is picked up
+func (p *oidcProvider) signingKey(kid string) (*rsa.PublicKey, error) {
+	c, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(c.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("OIDC signing keys: %w", err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("ID token signed with unknown key %q", kid)
+}
+
+// decodeJWTSegment decodes one base64url part of a JWT into v
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifyIDToken checks the RS256 signature, issuer, audience, expiry and nonce of an
+// ID token and returns its claims
+func (p *oidcProvider) verifyIDToken(raw, nonce string) (*oidcClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed ID token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed ID token header: %v", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported ID token algorithm %q", header.Alg)
+	}
+	key, err := p.signingKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("invalid ID token signature")
+	}
+
+	var claims oidcClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed ID token claims: %v", err)
+	}
+	if claims.Issuer != p.issuer {
+		return nil, fmt.Errorf("ID token issued by %q, want %q", claims.Issuer, p.issuer)
+	}
+	audience := false
+	for _, aud := range claims.Audience {
+		audience = audience || aud == p.clientID
+	}
+	if !audience {
+		return nil, fmt.Errorf("ID token is not intended for client %q", p.clientID)
+	}
+	if time.Now().Add(-oidcClockSkew).Unix() >= claims.Expiry {
+		return nil, fmt.Errorf("ID token expired")
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("ID token nonce does not match the login")
+	}
+	if claims.username() == "" {
+		return nil, fmt.Errorf("ID token has no subject")
+	}
+	return &claims, nil
+}
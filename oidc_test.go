@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeIdP is a minimal OpenID provider. The test copies the nonce and PKCE challenge
+// of a login into it before the callback, as the browser round trip would
+type fakeIdP struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	nonce     string
+	challenge string
+	claims    map[string]interface{}
+	jwksCalls int
+}
+
+func newFakeIdP(t *testing.T) (*fakeIdP, *oidcProvider) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.jwksCalls++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "ipam" || secret != "s3cret" || r.FormValue("code") != "good-code" || pkceChallenge(r.FormValue("code_verifier")) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := map[string]interface{}{
+			"iss": idp.URL, "sub": "u-123", "aud": "ipam", "exp": time.Now().Add(time.Hour).Unix(),
+			"nonce": idp.nonce, "preferred_username": "alice",
+		}
+		for k, v := range idp.claims {
+			claims[k] = v
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t, "RS256", claims)})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	t.Setenv("GO_SUBNET_CALCULATOR_OIDC_ISSUER", idp.URL)
+	t.Setenv("GO_SUBNET_CALCULATOR_OIDC_CLIENT_ID", "ipam")
+	t.Setenv("GO_SUBNET_CALCULATOR_OIDC_CLIENT_SECRET", "s3cret")
+	t.Setenv("GO_SUBNET_CALCULATOR_OIDC_REDIRECT_URL", "https://ipam.example.org/auth/callback")
+	provider, err := newOIDCProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idp, provider
+}
+
+// sign returns a JWT with the given claims signed by the provider key
+func (idp *fakeIdP) sign(t *testing.T, alg string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": "k1"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// authorize records the nonce and challenge of an authorization URL
+func (idp *fakeIdP) authorize(t *testing.T, target string) url.Values {
+	t.Helper()
+	u, err := url.Parse(target)
+	if err != nil || !strings.HasPrefix(target, idp.URL+"/authorize?") {
+		t.Fatalf("authorization URL = %q", target)
+	}
+	q := u.Query()
+	idp.nonce, idp.challenge = q.Get("nonce"), q.Get("code_challenge")
+	return q
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	idp, p := newFakeIdP(t)
+	target, err := p.authCodeURL("state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := idp.authorize(t, target)
+	want := map[string]string{
+		"response_type": "code", "client_id": "ipam", "redirect_uri": "https://ipam.example.org/auth/callback",
+		"state": "state-1", "nonce": "nonce-1", "code_challenge": pkceChallenge("verifier-1"), "code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+	if !strings.Contains(q.Get("scope"), "openid") {
+		t.Errorf("scope = %q", q.Get("scope"))
+	}
+}
+
+func TestOIDCExchangeAndVerify(t *testing.T) {
+	idp, p := newFakeIdP(t)
+	idp.nonce, idp.challenge = "nonce-1", pkceChallenge("verifier-1")
+
+	token, err := p.exchange("good-code", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.verifyIDToken(token, "nonce-1")
+	if err != nil || claims.username() != "alice" {
+		t.Fatalf("verifyIDToken() = %+v, %v", claims, err)
+	}
+	if _, err := p.exchange("good-code", "other-verifier"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("exchange with a wrong verifier = %v", err)
+	}
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{"iss": idp.URL, "sub": "u-1", "aud": []string{"other", "ipam"}, "exp": time.Now().Add(time.Hour).Unix(), "nonce": "n"}
+	}
+	if claims, err := p.verifyIDToken(idp.sign(t, "RS256", valid()), "n"); err != nil || claims.username() != "u-1" {
+		t.Errorf("token with an audience list = %+v, %v", claims, err)
+	}
+
+	tests := []struct {
+		name   string
+		alg    string
+		change func(map[string]interface{})
+		want   string
+	}{
+		{"wrong issuer", "RS256", func(c map[string]interface{}) { c["iss"] = "https://evil.example" }, "issued by"},
+		{"wrong audience", "RS256", func(c map[string]interface{}) { c["aud"] = "other" }, "not intended"},
+		{"expired", "RS256", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "expired"},
+		{"replayed nonce", "RS256", func(c map[string]interface{}) { c["nonce"] = "old" }, "nonce"},
+		{"algorithm", "HS256", func(c map[string]interface{}) {}, "algorithm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.change(claims)
+			if _, err := p.verifyIDToken(idp.sign(t, tt.alg, claims), "n"); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("verifyIDToken() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	token = idp.sign(t, "RS256", valid())
+	tampered := token[:strings.LastIndex(token, ".")] + "." + base64.RawURLEncoding.EncodeToString([]byte("forged"))
+	if _, err := p.verifyIDToken(tampered, "n"); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("tampered token error = %v", err)
+	}
+	if _, err := p.verifyIDToken("not-a-jwt", "n"); err == nil {
+		t.Error("expected an error for a malformed token")
+	}
+	if idp.jwksCalls != 1 {
+		t.Errorf("JWKS fetched %d times, want 1 (keys are cached)", idp.jwksCalls)
+	}
+}
+
+func TestNewOIDCProvider(t *testing.T) {
+	t.Setenv("GO_SUBNET_CALCULATOR_OIDC_ISSUER", "https://idp.example.org")
+	t.Setenv("GO_SUBNET_CALCULATOR_OIDC_CLIENT_ID", "ipam")
+	t.Setenv("GO_SUBNET_CALCULATOR_OIDC_REDIRECT_URL", "ipam.example.org/auth/callback")
+	if _, err := newOIDCProvider(); err == nil || !strings.Contains(err.Error(), "redirect URL") {
+		t.Errorf("relative redirect URL error = %v", err)
+	}
+	t.Setenv("GO_SUBNET_CALCULATOR_OIDC_CLIENT_ID", "")
+	if _, err := newOIDCProvider(); err == nil {
+		t.Error("expected an error without a client id")
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// planColumns are the CSV and Markdown columns of an address plan
+var planColumns = []string{
+	"name", "prefix", "purpose", "vlan", "vlan_name", "subnet_mask", "gateway",
+	"dhcp_start", "dhcp_end", "broadcast_address", "usable_hosts",
+}
+
+// PlanSubnet is one row of an address plan. Name, Purpose, the VLAN ID and name, Gateway
+// and the DHCP range are the editable columns; the mask, broadcast address and host
+// count are calculated from the prefix
+type PlanSubnet struct {
+	Name        string `json:"name,omitempty"`
+	Prefix      string `json:"prefix"`
+	Purpose     string `json:"purpose,omitempty"`
+	VLAN        int    `json:"vlan,omitempty"`
+	VLANName    string `json:"vlan_name,omitempty"`
+	Gateway     string `json:"gateway,omitempty"`
+	DHCPStart   string `json:"dhcp_start,omitempty"`
+	DHCPEnd     string `json:"dhcp_end,omitempty"`
+	SubnetMask  string `json:"subnet_mask"`
+	Broadcast   string `json:"broadcast_address"`
+	UsableHosts uint64 `json:"usable_hosts"`
+}
+
+// PlanRequest is the JSON body of POST /api/v1/plan. Subnets are the rows of a plan
+// being edited; Prefixes, such as the result of a split, are drafted into further rows.
+// The response of /api/v1/deaggregate can be sent as it is
+type PlanRequest struct {
+	Title    string       `json:"title,omitempty"`
+	Prefix   string       `json:"prefix,omitempty"`
+	Prefixes []string     `json:"prefixes,omitempty"`
+	Subnets  []PlanSubnet `json:"subnets,omitempty"`
+}
+
+// AddressPlan is a validated address plan document
+type AddressPlan struct {
+	Title   string       `json:"title"`
+	Subnets []PlanSubnet `json:"subnets"`
+}
+
+// draftPlanSubnet fills in a new row for a prefix: the gateway on the first usable
+// address and the DHCP range on the rest, as the DHCP generators place them. Prefixes
+// too small for both are left without
+func draftPlanSubnet(network *net.IPNet) PlanSubnet {
+	subnet := PlanSubnet{Prefix: network.String()}
+	if planned, err := planDHCPSubnets([]*net.IPNet{network}, generatorOptions{}); err == nil {
+		subnet.Gateway = planned[0].router.String()
+		subnet.DHCPStart, subnet.DHCPEnd = planned[0].poolStart.String(), planned[0].poolEnd.String()
+	}
+	return subnet
+}
+
+// planHostAddress parses an optional address column, which must be a usable host
+// address of the subnet
+func planHostAddress(network *net.IPNet, column, value string) (uint32, bool, error) {
+	if value == "" {
+		return 0, false, nil
+	}
+	ip := net.ParseIP(value).To4()
+	if ip == nil {
+		return 0, false, fmt.Errorf("%s: invalid %s: %s", network, column, value)
+	}
+	first, last := usableRange(network)
+	if n := ipToUint32(ip); network.Contains(ip) && n >= first && n <= last {
+		return n, true, nil
+	}
+	return 0, false, fmt.Errorf("%s: %s %s is not a usable host address of the subnet", network, column, value)
+}
+
+// checkPlanSubnet normalizes a row and validates its editable columns
+func checkPlanSubnet(subnet PlanSubnet) (PlanSubnet, *net.IPNet, error) {
+	network, err := parseIPv4Prefix(strings.TrimSpace(subnet.Prefix))
+	if err != nil {
+		return subnet, nil, err
+	}
+	subnet.Prefix = network.String()
+	subnet.Name, subnet.Purpose, subnet.VLANName = strings.TrimSpace(subnet.Name), strings.TrimSpace(subnet.Purpose), strings.TrimSpace(subnet.VLANName)
+	subnet.Gateway, subnet.DHCPStart, subnet.DHCPEnd = strings.TrimSpace(subnet.Gateway), strings.TrimSpace(subnet.DHCPStart), strings.TrimSpace(subnet.DHCPEnd)
+
+	gateway, hasGateway, err := planHostAddress(network, "gateway", subnet.Gateway)
+	if err != nil {
+		return subnet, nil, err
+	}
+	start, hasStart, err := planHostAddress(network, "dhcp_start", subnet.DHCPStart)
+	if err != nil {
+		return subnet, nil, err
+	}
+	end, hasEnd, err := planHostAddress(network, "dhcp_end", subnet.DHCPEnd)
+	if err != nil {
+		return subnet, nil, err
+	}
+	if hasStart != hasEnd {
+		return subnet, nil, fmt.Errorf("%s: dhcp_start and dhcp_end must be given together", network)
+	}
+	if hasStart && start > end {
+		return subnet, nil, fmt.Errorf("%s: DHCP range %s - %s is not ascending", network, subnet.DHCPStart, subnet.DHCPEnd)
+	}
+	if hasStart && hasGateway && gateway >= start && gateway <= end {
+		return subnet, nil, fmt.Errorf("%s: DHCP range %s - %s includes the gateway %s", network, subnet.DHCPStart, subnet.DHCPEnd, subnet.Gateway)
+	}
+
+	row := prefixRow("", network)
+	subnet.SubnetMask, subnet.Broadcast, subnet.UsableHosts = row.Mask, row.Broadcast, row.UsableHosts
+	return subnet, network, nil
+}
+
+// buildAddressPlan validates the rows of a request, drafts rows for its prefixes and
+// checks that no two subnets of the plan overlap or share a VLAN
+func buildAddressPlan(req PlanRequest) (*AddressPlan, error) {
+	if len(req.Subnets)+len(req.Prefixes) == 0 {
+		return nil, fmt.Errorf("at least one subnet or prefix is required")
+	}
+	if len(req.Subnets)+len(req.Prefixes) > maxPrefixListLen {
+		return nil, fmt.Errorf("at most %d subnets are allowed", maxPrefixListLen)
+	}
+
+	plan := &AddressPlan{Title: strings.TrimSpace(req.Title), Subnets: make([]PlanSubnet, 0, len(req.Subnets)+len(req.Prefixes))}
+	if plan.Title == "" {
+		plan.Title = "Address plan"
+		if prefix := strings.TrimSpace(req.Prefix); prefix != "" {
+			plan.Title = "Address plan for " + prefix
+		}
+	}
+	drafted, err := parsePrefixList(req.Prefixes)
+	if err != nil {
+		return nil, err
+	}
+	rows := req.Subnets
+	for _, network := range drafted {
+		rows = append(rows, draftPlanSubnet(network))
+	}
+
+	networks := make([]*net.IPNet, 0, len(rows))
+	for _, row := range rows {
+		subnet, network, err := checkPlanSubnet(row)
+		if err != nil {
+			return nil, err
+		}
+		plan.Subnets = append(plan.Subnets, subnet)
+		networks = append(networks, network)
+	}
+	if err := checkVLANs(networks, plan.vlans()); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(networks, func(i, j int) bool {
+		return ipToUint32(networks[i].IP) < ipToUint32(networks[j].IP)
+	})
+	for i := 1; i < len(networks); i++ {
+		if cidrset.PrefixToRange(networks[i]).First <= cidrset.PrefixToRange(networks[i-1]).Last {
+			return nil, fmt.Errorf("%s overlaps %s", networks[i], networks[i-1])
+		}
+	}
+	return plan, nil
+}
+
+// networks returns the prefixes of the plan in its order
+func (plan *AddressPlan) networks() []*net.IPNet {
+	networks := make([]*net.IPNet, len(plan.Subnets))
+	for i, s := range plan.Subnets {
+		networks[i], _ = parseIPv4Prefix(s.Prefix)
+	}
+	return networks
+}
+
+// vlans returns the VLANs of the plan's subnets in its order
+func (plan *AddressPlan) vlans() []subnetVLAN {
+	vlans := make([]subnetVLAN, len(plan.Subnets))
+	for i, s := range plan.Subnets {
+		vlans[i] = subnetVLAN{ID: s.VLAN, Name: s.VLANName}
+	}
+	return vlans
+}
+
+// fields returns the row in the order of planColumns
+func (s PlanSubnet) fields() []string {
+	vlan := ""
+	if s.VLAN != 0 {
+		vlan = strconv.Itoa(s.VLAN)
+	}
+	return []string{
+		s.Name, s.Prefix, s.Purpose, vlan, s.VLANName, s.SubnetMask, s.Gateway,
+		s.DHCPStart, s.DHCPEnd, s.Broadcast, strconv.FormatUint(s.UsableHosts, 10),
+	}
+}
+
+// writeAddressPlan sends a plan as JSON, as a CSV download, as a Markdown report, as
+// a standalone HTML document or through a config generator, which gets the VLANs of
+// the subnets along with the query parameters as options
+func writeAddressPlan(w http.ResponseWriter, r *http.Request, plan *AddressPlan, format string) {
+	if g, ok := lookupConfigGenerator(format); ok {
+		opts := generatorOptions{}
+		for key, values := range r.URL.Query() {
+			opts[key] = values[0]
+		}
+		vlanOptions(opts, plan.vlans())
+		config, err := g.Generate(plan.networks(), opts)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if g.Filename != "" {
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, g.Filename))
+		}
+		fmt.Fprint(w, config)
+		return
+	}
+
+	switch format {
+	case "json":
+		writeJSON(w, http.StatusOK, plan)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="address-plan.csv"`)
+		writer := csv.NewWriter(w)
+		writer.Write(planColumns)
+		for _, s := range plan.Subnets {
+			writer.Write(s.fields())
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			log.Printf("Address plan CSV encoding error: %v", err)
+		}
+	case "markdown":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		fmt.Fprintf(w, "## %s\n\n", markdownCell(plan.Title))
+		fields := make([][]string, 0, len(plan.Subnets))
+		for _, s := range plan.Subnets {
+			fields = append(fields, s.fields())
+		}
+		writeMarkdownTable(w, planColumns, fields)
+	case "html":
+		tmpl, err := loadTemplate("plan.html")
+		if err != nil {
+			logRequestf(r.Context(), "Template loading error: %v", err)
+			http.Error(w, "Template loading error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if err := tmpl.ExecuteTemplate(w, "document", plan); err != nil {
+			logRequestf(r.Context(), "Template execution error: %v", err)
+		}
+	default:
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("unsupported format %q, use json, html, markdown, csv or a config generator", format))
+	}
+}
+
+// planHandler serves POST /api/v1/plan as JSON or, with ?format=html, markdown or csv,
+// the plan as a document; the name of a config generator renders its configuration
+func planHandler(w http.ResponseWriter, r *http.Request) {
+	var req PlanRequest
+	// the response of a split or of /api/v1/deaggregate is accepted as it is
+	if !decodeJSONPost(w, r, &req, allowUnknownFields) {
+		return
+	}
+	plan, err := buildAddressPlan(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeAddressPlan(w, r, plan, responseFormat(r, "json"))
+}
+
+// PlanPage is the data of the /plan page
+type PlanPage struct {
+	Title    string
+	Prefixes string
+	Subnets  []PlanSubnet
+	Error    string
+}
+
+// planFormRequest reads the /plan form: the title, the prefixes to draft and the
+// columns of the rows already in the table, one value per row. Every row is read even
+// when one of them is invalid, so the page can show the table again
+func planFormRequest(r *http.Request) (PlanRequest, error) {
+	req := PlanRequest{Title: r.FormValue("title"), Prefixes: parsePrefixListQuery(r.FormValue("prefixes"))}
+	var err error
+	column := func(name string, i int) string {
+		if values := r.PostForm[name]; i < len(values) {
+			return values[i]
+		}
+		return ""
+	}
+	for i := range r.PostForm["prefix"] {
+		subnet := PlanSubnet{
+			Name:      column("name", i),
+			Prefix:    column("prefix", i),
+			Purpose:   column("purpose", i),
+			VLANName:  column("vlan_name", i),
+			Gateway:   column("gateway", i),
+			DHCPStart: column("dhcp_start", i),
+			DHCPEnd:   column("dhcp_end", i),
+		}
+		if vlan := strings.TrimSpace(column("vlan", i)); vlan != "" {
+			n, convErr := strconv.Atoi(vlan)
+			if convErr != nil && err == nil {
+				err = fmt.Errorf("%s: invalid VLAN: %s", subnet.Prefix, vlan)
+			}
+			subnet.VLAN = n
+		}
+		req.Subnets = append(req.Subnets, subnet)
+	}
+	return req, err
+}
+
+// planPageHandler serves the /plan page. Pasted prefixes are drafted into an editable
+// table; the export buttons download the edited plan as HTML, Markdown or CSV
+func planPageHandler(w http.ResponseWriter, r *http.Request) {
+	if !parseFormBody(w, r) {
+		return
+	}
+	page := &PlanPage{}
+	if r.Method == http.MethodPost {
+		req, err := planFormRequest(r)
+		page.Title, page.Prefixes, page.Subnets = req.Title, r.FormValue("prefixes"), req.Subnets
+		var plan *AddressPlan
+		if err == nil {
+			plan, err = buildAddressPlan(req)
+		}
+		switch format := r.FormValue("format"); {
+		case err != nil:
+			page.Error = err.Error()
+		case format != "":
+			writeAddressPlan(w, r, plan, format)
+			return
+		default:
+			page.Title, page.Prefixes, page.Subnets = plan.Title, "", plan.Subnets
+		}
+	}
+
+	tmpl, err := loadTemplate("plan.html")
+	if err != nil {
+		logRequestf(r.Context(), "Template loading error: %v", err)
+		http.Error(w, "Template loading error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if page.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := tmpl.Execute(w, page); err != nil {
+		logRequestf(r.Context(), "Template execution error: %v", err)
+	}
+}
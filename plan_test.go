@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestBuildAddressPlan(t *testing.T) {
+	plan, err := buildAddressPlan(PlanRequest{
+		Prefix:   "10.0.0.0/23",
+		Prefixes: []string{"10.0.1.0/25", "10.0.1.128/32"},
+		Subnets:  []PlanSubnet{{Name: " users ", Prefix: "10.0.0.0/24", Purpose: "Office", VLAN: 10, Gateway: "10.0.0.254", DHCPStart: "10.0.0.100", DHCPEnd: "10.0.0.199"}},
+	})
+	if err != nil {
+		t.Fatalf("buildAddressPlan() error = %v", err)
+	}
+	want := []PlanSubnet{
+		{Name: "users", Prefix: "10.0.0.0/24", Purpose: "Office", VLAN: 10, Gateway: "10.0.0.254", DHCPStart: "10.0.0.100", DHCPEnd: "10.0.0.199", SubnetMask: "255.255.255.0", Broadcast: "10.0.0.255", UsableHosts: 254},
+		{Prefix: "10.0.1.0/25", Gateway: "10.0.1.1", DHCPStart: "10.0.1.2", DHCPEnd: "10.0.1.126", SubnetMask: "255.255.255.128", Broadcast: "10.0.1.127", UsableHosts: 126},
+		{Prefix: "10.0.1.128/32", SubnetMask: "255.255.255.255", Broadcast: "10.0.1.128"},
+	}
+	if plan.Title != "Address plan for 10.0.0.0/23" || len(plan.Subnets) != len(want) {
+		t.Fatalf("buildAddressPlan() = %+v", plan)
+	}
+	for i := range want {
+		if plan.Subnets[i] != want[i] {
+			t.Errorf("subnet %d = %+v, want %+v", i, plan.Subnets[i], want[i])
+		}
+	}
+
+	for _, req := range []PlanRequest{
+		{},
+		{Prefixes: []string{"bogus"}},
+		{Prefixes: []string{"10.0.0.0/24", "10.0.0.128/25"}},
+		{Subnets: []PlanSubnet{{Prefix: "10.0.0.0/24", VLAN: 4095}}},
+		{Subnets: []PlanSubnet{{Prefix: "10.0.0.0/24", VLANName: "users"}}},
+		{Subnets: []PlanSubnet{{Prefix: "10.0.0.0/24", VLAN: 10}, {Prefix: "10.0.1.0/24", VLAN: 10}}},
+		{Subnets: []PlanSubnet{{Prefix: "10.0.0.0/24", VLAN: 10, VLANName: "users"}, {Prefix: "10.0.1.0/24", VLAN: 20, VLANName: "Users"}}},
+		{Subnets: []PlanSubnet{{Prefix: "10.0.0.0/24", Gateway: "10.0.0.0"}}},
+		{Subnets: []PlanSubnet{{Prefix: "10.0.0.0/24", Gateway: "10.0.1.1"}}},
+		{Subnets: []PlanSubnet{{Prefix: "10.0.0.0/24", DHCPStart: "10.0.0.10"}}},
+		{Subnets: []PlanSubnet{{Prefix: "10.0.0.0/24", DHCPStart: "10.0.0.20", DHCPEnd: "10.0.0.10"}}},
+		{Subnets: []PlanSubnet{{Prefix: "10.0.0.0/24", Gateway: "10.0.0.1", DHCPStart: "10.0.0.1", DHCPEnd: "10.0.0.10"}}},
+	} {
+		if plan, err := buildAddressPlan(req); err == nil {
+			t.Errorf("buildAddressPlan(%+v) = %+v, want an error", req, plan)
+		}
+	}
+}
+
+func TestPlanHandler(t *testing.T) {
+	post := func(query, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		planHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/plan"+query, strings.NewReader(body)))
+		return rr
+	}
+
+	// The response of a split is accepted as it is
+	rr := post("", `{"prefix":"10.0.0.0/24","prefixes":["10.0.0.0/25","10.0.0.128/25"],"count":2}`)
+	var plan AddressPlan
+	if err := json.Unmarshal(rr.Body.Bytes(), &plan); err != nil || rr.Code != http.StatusOK || len(plan.Subnets) != 2 || plan.Subnets[1].Gateway != "10.0.0.129" {
+		t.Errorf("POST: status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	body := `{"title":"Branch <1>","subnets":[{"name":"voice","prefix":"10.0.0.0/25","purpose":"Phones | printers","vlan":20}]}`
+	if rr := post("?format=csv", body); rr.Code != http.StatusOK ||
+		rr.Body.String() != "name,prefix,purpose,vlan,vlan_name,subnet_mask,gateway,dhcp_start,dhcp_end,broadcast_address,usable_hosts\nvoice,10.0.0.0/25,Phones | printers,20,,255.255.255.128,,,,10.0.0.127,126\n" {
+		t.Errorf("CSV: status %d: %q", rr.Code, rr.Body.String())
+	}
+	if rr := post("?format=markdown", body); rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "## Branch <1>\n") || !strings.Contains(rr.Body.String(), `Phones \| printers`) {
+		t.Errorf("Markdown: status %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := post("?format=html", body); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "<h1>Branch &lt;1&gt;</h1>") || !strings.Contains(rr.Body.String(), "<td>20</td>") {
+		t.Errorf("HTML: status %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := post("?format=cisco-interface", `{"subnets":[{"prefix":"10.0.0.0/25","vlan":20,"vlan_name":"voice"},{"prefix":"10.0.0.128/25"}]}`); rr.Code != http.StatusOK ||
+		rr.Body.String() != "interface GigabitEthernet0/0\n ip address 10.0.0.129 255.255.255.128\n no shutdown\n!\nvlan 20\n name voice\n!\ninterface Vlan20\n description voice\n ip address 10.0.0.1 255.255.255.128\n no shutdown\n!\n" {
+		t.Errorf("cisco-interface: status %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := post("?format=svg", body); rr.Code != http.StatusBadRequest {
+		t.Errorf("SVG: status %d", rr.Code)
+	}
+	if rr := post("", `{"prefixes":["10.0.0.0/24","10.0.0.0/25"]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("overlapping prefixes: status %d", rr.Code)
+	}
+}
+
+func TestPlanPage(t *testing.T) {
+	submit := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/plan", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		planPageHandler(rr, req)
+		return rr
+	}
+
+	rr := httptest.NewRecorder()
+	planPageHandler(rr, httptest.NewRequest(http.MethodGet, "/plan", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Draft Plan") {
+		t.Fatalf("GET /plan = %d", rr.Code)
+	}
+
+	rr = submit(url.Values{"prefixes": {"192.168.0.0/26\n192.168.0.64/26"}})
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `name="gateway" value="192.168.0.65"`) {
+		t.Errorf("drafting: status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	edited := url.Values{
+		"title":      {"Lab"},
+		"prefix":     {"192.168.0.0/26", "192.168.0.64/26"},
+		"name":       {"servers", "clients"},
+		"purpose":    {"", "Wi-Fi"},
+		"vlan":       {"", "30"},
+		"vlan_name":  {"", "wifi"},
+		"gateway":    {"192.168.0.1", ""},
+		"dhcp_start": {"", "192.168.0.70"},
+		"dhcp_end":   {"", "192.168.0.126"},
+		"format":     {"csv"},
+	}
+	rr = submit(edited)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "clients,192.168.0.64/26,Wi-Fi,30,wifi,255.255.255.192,,192.168.0.70,192.168.0.126,") {
+		t.Errorf("CSV export: status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	edited.Set("vlan", "ten")
+	if rr = submit(edited); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `value="clients"`) {
+		t.Errorf("invalid VLAN: status %d: %s", rr.Code, rr.Body.String())
+	}
+}
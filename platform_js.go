@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"syscall/js"
+)
+
+// The WebAssembly build runs in the browser instead of serving it: main hands the
+// calculation engine to JavaScript and subnet.js calls it when the API is out of
+// reach. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o subnet-calculator.wasm .
+
+// serveJS sets globalThis.subnetCalculator and blocks, since the functions must
+// outlive main
+func serveJS() {
+	js.Global().Set("subnetCalculator", js.ValueOf(map[string]interface{}{
+		"version":   version,
+		"calculate": js.FuncOf(jsCalculate),
+	}))
+	select {}
+}
+
+// jsCalculate is subnetCalculator.calculate(ip, mask, cloud, explain). It returns the
+// JSON that POST /api/v1/calculate would answer, without the lookups that need the
+// network: a SubnetResult, or an object with an error
+func jsCalculate(this js.Value, args []js.Value) interface{} {
+	arg := func(i int) js.Value {
+		if i < len(args) {
+			return args[i]
+		}
+		return js.Undefined()
+	}
+	text := func(v js.Value) string {
+		if v.Type() != js.TypeString {
+			return ""
+		}
+		return strings.TrimSpace(v.String())
+	}
+	req := CalculateRequest{Cloud: text(arg(2)), Explain: arg(3).Truthy()}
+	var note string
+	req.IP, req.Mask, note = normalizeInput(text(arg(0)), text(arg(1)))
+
+	var body interface{}
+	if req.IP == "" || req.Mask == "" {
+		body = ErrorResponse{Error: "ip and mask are required"}
+	} else if result, err := calculateCloudSubnet(req.IP, req.Mask, req.Cloud); err != nil {
+		body = ErrorResponse{Error: err.Error()}
+	} else {
+		result.IPAddress, result.SubnetMask, result.Normalization = req.IP, req.Mask, note
+		if req.Explain {
+			result.Explanation, _ = explainSubnet(req.IP, req.Mask, result)
+		}
+		result.Integers = integerFormsOf(req.IP, req.Mask)
+		result.SpecialPurpose = specialPurposeOf(req.IP, req.Mask)
+		body = result
+	}
+	data, _ := json.Marshal(body)
+	return string(data)
+}
+
+// reloadOnHangup does nothing: the browser sends no signals
+func reloadOnHangup() {}
@@ -0,0 +1,19 @@
+//go:build !js
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reloadOnHangup reloads the data files whenever the process receives SIGHUP
+func reloadOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go watchHangup(hangup)
+}
+
+// serveJS is only part of the WebAssembly build; see platform_js.go
+func serveJS() {}
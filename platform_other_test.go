@@ -0,0 +1,30 @@
+//go:build !js
+
+package main
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestWatchHangup(t *testing.T) {
+	audit := withTestAudit(t)
+	withTestOrigins(t, nil)
+	withTestReputation(t, &fakeDNSBLResolver{}, nil, "192.0.2.0/24\n")
+	os.WriteFile(reputation.Load().files[0].name, []byte("192.0.2.0/24\n198.51.100.0/24\n"), 0o644)
+
+	signals := make(chan os.Signal, 1)
+	signals <- syscall.SIGHUP
+	close(signals)
+	watchHangup(signals)
+
+	if len(reputation.Load().files[0].prefixes) != 2 {
+		t.Errorf("blocklist not reloaded: %v", reputation.Load().files[0].prefixes)
+	}
+	entries, _ := audit.List(AuditFilter{Action: "admin.reload", Limit: 10})
+	if len(entries) != 1 || entries[0].Actor != "system" || entries[0].Target != "SIGHUP" || !strings.Contains(entries[0].Details, "blocklists ok") {
+		t.Errorf("audit = %+v", entries)
+	}
+}
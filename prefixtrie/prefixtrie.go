@@ -0,0 +1,220 @@
+// Package prefixtrie implements a binary trie over IPv4 prefixes for
+// longest-prefix matching, the structure behind the calculator's routing
+// table lookups.
+//
+// Every prefix stored in a Trie carries a value of type V, such as a next hop
+// or a route record. Prefixes are normalized to their network address, so
+// 10.1.2.3/16 and 10.1.0.0/16 name the same entry. A Trie is not safe for
+// concurrent use while it is being modified.
+//
+//	t := prefixtrie.New[string]()
+//	t.Load("core", "10.0.0.0/8")
+//	t.Load("edge", "10.1.0.0/16", "10.2.0.0/16")
+//	if e, ok := t.Lookup(net.ParseIP("10.1.2.3")); ok {
+//		fmt.Println(e.Prefix, e.Value) // 10.1.0.0/16 edge
+//	}
+package prefixtrie
+
+import (
+	"encoding/binary"
+	"fmt"
+	"iter"
+	"net"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// Entry is a prefix stored in a Trie together with its value
+type Entry[V any] struct {
+	Prefix *net.IPNet
+	Value  V
+}
+
+// Trie maps IPv4 prefixes to values. The zero value is an empty trie ready to use
+type Trie[V any] struct {
+	root node[V]
+	size int
+}
+
+type node[V any] struct {
+	children [2]*node[V]
+	value    V
+	set      bool
+}
+
+// New returns an empty trie
+func New[V any]() *Trie[V] {
+	return &Trie[V]{}
+}
+
+// Load parses prefixes in CIDR notation and inserts each with value. Nothing is
+// inserted when any of them is invalid
+func (t *Trie[V]) Load(value V, cidrs ...string) error {
+	prefixes := make([]*net.IPNet, 0, len(cidrs))
+	for i, s := range cidrs {
+		p, err := cidrset.ParsePrefix(s)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		prefixes = append(prefixes, p)
+	}
+	for _, p := range prefixes {
+		t.Insert(p, value)
+	}
+	return nil
+}
+
+// Len returns the number of prefixes in the trie
+func (t *Trie[V]) Len() int {
+	return t.size
+}
+
+// Insert stores value under prefix, replacing any value already stored there. It
+// reports whether the prefix is new to the trie, and panics when prefix is not IPv4
+func (t *Trie[V]) Insert(prefix *net.IPNet, value V) bool {
+	addr, ones := key(prefix)
+	n := &t.root
+	for i := 0; i < ones; i++ {
+		bit := bitAt(addr, i)
+		if n.children[bit] == nil {
+			n.children[bit] = &node[V]{}
+		}
+		n = n.children[bit]
+	}
+	added := !n.set
+	if added {
+		t.size++
+	}
+	n.value, n.set = value, true
+	return added
+}
+
+// Delete removes prefix from the trie and reports whether it was present. Less and
+// more specific prefixes are kept
+func (t *Trie[V]) Delete(prefix *net.IPNet) bool {
+	addr, ones := key(prefix)
+	path := make([]*node[V], 0, ones+1)
+	n := &t.root
+	for i := 0; i < ones && n != nil; i++ {
+		path = append(path, n)
+		n = n.children[bitAt(addr, i)]
+	}
+	if n == nil || !n.set {
+		return false
+	}
+	var zero V
+	n.value, n.set = zero, false
+	t.size--
+
+	// Prune the branch of nodes that no longer lead to a prefix
+	for i := len(path) - 1; i >= 0; i-- {
+		if n.set || n.children[0] != nil || n.children[1] != nil {
+			break
+		}
+		path[i].children[bitAt(addr, i)] = nil
+		n = path[i]
+	}
+	return true
+}
+
+// Get returns the value stored under exactly prefix
+func (t *Trie[V]) Get(prefix *net.IPNet) (V, bool) {
+	addr, ones := key(prefix)
+	n := &t.root
+	for i := 0; i < ones && n != nil; i++ {
+		n = n.children[bitAt(addr, i)]
+	}
+	if n == nil || !n.set {
+		var zero V
+		return zero, false
+	}
+	return n.value, true
+}
+
+// Matches returns every entry whose prefix contains ip, from least to most specific
+func (t *Trie[V]) Matches(ip net.IP) []Entry[V] {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return nil
+	}
+	addr := binary.BigEndian.Uint32(ip4)
+
+	var found []Entry[V]
+	n := &t.root
+	for i := 0; n != nil; i++ {
+		if n.set {
+			found = append(found, Entry[V]{Prefix: prefixOf(addr, i), Value: n.value})
+		}
+		if i == 32 {
+			break
+		}
+		n = n.children[bitAt(addr, i)]
+	}
+	return found
+}
+
+// Lookup returns the longest-prefix match for ip
+func (t *Trie[V]) Lookup(ip net.IP) (Entry[V], bool) {
+	found := t.Matches(ip)
+	if len(found) == 0 {
+		return Entry[V]{}, false
+	}
+	return found[len(found)-1], true
+}
+
+// All iterates over the entries in address order, each prefix before the more
+// specific prefixes inside it
+func (t *Trie[V]) All() iter.Seq2[*net.IPNet, V] {
+	return func(yield func(*net.IPNet, V) bool) {
+		t.root.walk(0, 0, yield)
+	}
+}
+
+// Entries returns the entries in the order of All
+func (t *Trie[V]) Entries() []Entry[V] {
+	entries := make([]Entry[V], 0, t.size)
+	for p, v := range t.All() {
+		entries = append(entries, Entry[V]{Prefix: p, Value: v})
+	}
+	return entries
+}
+
+// walk visits the entries below n, whose prefix is addr/depth, depth first
+func (n *node[V]) walk(addr uint32, depth int, yield func(*net.IPNet, V) bool) bool {
+	if n.set && !yield(prefixOf(addr, depth), n.value) {
+		return false
+	}
+	for bit, child := range n.children {
+		if child == nil {
+			continue
+		}
+		if !child.walk(addr|uint32(bit)<<uint(31-depth), depth+1, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// key returns the network address and length of an IPv4 prefix. An IPv4-mapped IPv6
+// prefix such as ::ffff:10.0.0.0/104 is not one: its length counts 128 bits
+func key(prefix *net.IPNet) (uint32, int) {
+	ones, bits := prefix.Mask.Size()
+	ip := prefix.IP.To4()
+	if ip == nil || bits != 32 {
+		panic(fmt.Sprintf("prefixtrie: not an IPv4 prefix: %s", prefix))
+	}
+	return binary.BigEndian.Uint32(ip.Mask(prefix.Mask)), ones
+}
+
+// bitAt returns bit i of addr, counting from the most significant
+func bitAt(addr uint32, i int) uint32 {
+	return (addr >> uint(31-i)) & 1
+}
+
+// prefixOf builds the prefix of the given length containing addr
+func prefixOf(addr uint32, ones int) *net.IPNet {
+	mask := net.CIDRMask(ones, 32)
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, addr)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
@@ -0,0 +1,149 @@
+package prefixtrie
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+func mustPrefix(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	p, err := cidrset.ParsePrefix(s)
+	if err != nil {
+		t.Fatalf("ParsePrefix(%s) unexpected error: %v", s, err)
+	}
+	return p
+}
+
+func entryStrings[V any](entries []Entry[V]) []string {
+	out := []string{}
+	for _, e := range entries {
+		out = append(out, e.Prefix.String())
+	}
+	return out
+}
+
+func TestLookup(t *testing.T) {
+	trie := New[string]()
+	if err := trie.Load("default", "0.0.0.0/0"); err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	if err := trie.Load("core", "10.0.0.0/8", "10.1.2.3/32"); err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	trie.Insert(mustPrefix(t, "10.1.0.0/16"), "site")
+
+	tests := []struct {
+		ip      string
+		winner  string
+		value   string
+		matches []string
+	}{
+		{"10.1.2.3", "10.1.2.3/32", "core", []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "10.1.2.3/32"}},
+		{"10.1.9.9", "10.1.0.0/16", "site", []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16"}},
+		{"192.0.2.1", "0.0.0.0/0", "default", []string{"0.0.0.0/0"}},
+	}
+	for _, tt := range tests {
+		e, ok := trie.Lookup(net.ParseIP(tt.ip))
+		if !ok || e.Prefix.String() != tt.winner || e.Value != tt.value {
+			t.Errorf("Lookup(%s) = %v %s, %v, want %s %s", tt.ip, e.Prefix, e.Value, ok, tt.winner, tt.value)
+		}
+		if got := entryStrings(trie.Matches(net.ParseIP(tt.ip))); !reflect.DeepEqual(got, tt.matches) {
+			t.Errorf("Matches(%s) = %v, want %v", tt.ip, got, tt.matches)
+		}
+	}
+
+	if _, ok := trie.Lookup(net.ParseIP("2001:db8::1")); ok {
+		t.Error("Lookup() of an IPv6 address matched")
+	}
+	if _, ok := New[int]().Lookup(net.ParseIP("10.0.0.1")); ok {
+		t.Error("Lookup() in an empty trie matched")
+	}
+}
+
+func TestInsertGetDelete(t *testing.T) {
+	var trie Trie[int]
+	if !trie.Insert(mustPrefix(t, "10.0.0.0/8"), 1) || trie.Insert(mustPrefix(t, "10.9.9.9/8"), 2) {
+		t.Error("Insert() did not report the new and replaced prefix")
+	}
+	trie.Insert(mustPrefix(t, "10.0.0.0/24"), 3)
+	if trie.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", trie.Len())
+	}
+	if v, ok := trie.Get(mustPrefix(t, "10.0.0.0/8")); !ok || v != 2 {
+		t.Errorf("Get(10.0.0.0/8) = %d, %v, want 2", v, ok)
+	}
+	if _, ok := trie.Get(mustPrefix(t, "10.0.0.0/16")); ok {
+		t.Error("Get() of an intermediate node found a value")
+	}
+
+	if trie.Delete(mustPrefix(t, "10.0.0.0/16")) {
+		t.Error("Delete() of a missing prefix reported success")
+	}
+	if !trie.Delete(mustPrefix(t, "10.0.0.0/24")) || trie.Len() != 1 {
+		t.Errorf("Delete(10.0.0.0/24) failed, Len() = %d", trie.Len())
+	}
+	n := &trie.root
+	for i := 0; i < 8; i++ {
+		n = n.children[bitAt(0x0a000000, i)]
+	}
+	if n.children[0] != nil || n.children[1] != nil {
+		t.Error("Delete() left the branch below 10.0.0.0/8 behind")
+	}
+	if e, ok := trie.Lookup(net.ParseIP("10.0.0.1")); !ok || e.Value != 2 {
+		t.Errorf("Lookup() after Delete() = %+v, %v", e, ok)
+	}
+	if !trie.Delete(mustPrefix(t, "10.0.0.0/8")) || trie.Len() != 0 || trie.root.children[0] != nil {
+		t.Error("Delete(10.0.0.0/8) did not empty the trie")
+	}
+}
+
+func TestAll(t *testing.T) {
+	trie := New[bool]()
+	if err := trie.Load(true, "192.168.0.0/16", "10.1.0.0/16", "10.0.0.0/8", "0.0.0.0/0", "10.0.0.0/9"); err != nil {
+		t.Fatalf("Load() unexpected error: %v", err)
+	}
+	want := []string{"0.0.0.0/0", "10.0.0.0/8", "10.0.0.0/9", "10.1.0.0/16", "192.168.0.0/16"}
+	if got := entryStrings(trie.Entries()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries() = %v, want %v", got, want)
+	}
+
+	var first []string
+	for p := range trie.All() {
+		first = append(first, p.String())
+		if len(first) == 2 {
+			break
+		}
+	}
+	if !reflect.DeepEqual(first, want[:2]) {
+		t.Errorf("All() with break = %v, want %v", first, want[:2])
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	trie := New[int]()
+	if err := trie.Load(1, "10.0.0.0/8", "bogus"); err == nil || err.Error() != "entry 2: invalid prefix: bogus" {
+		t.Errorf("Load() error = %v, want entry 2 error", err)
+	}
+	if trie.Len() != 0 {
+		t.Errorf("Load() with an invalid prefix inserted %d prefixes", trie.Len())
+	}
+}
+
+func TestMappedPrefix(t *testing.T) {
+	trie := New[int]()
+	if err := trie.Load(1, "::ffff:10.0.0.0/104"); err == nil || trie.Len() != 0 {
+		t.Errorf("Load() with an IPv4-mapped prefix = %v, %d prefixes", err, trie.Len())
+	}
+
+	_, mapped, _ := net.ParseCIDR("::ffff:10.0.0.0/104")
+	mapped.IP = mapped.IP.To4()
+	defer func() {
+		if recover() == nil {
+			t.Error("Insert() with an IPv4-mapped prefix did not panic")
+		}
+	}()
+	trie.Insert(mapped, 1)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+const (
+	defaultPTRWorkers = 16
+	maxPTRWorkers     = 256
+	defaultPTRTimeout = 2 * time.Second
+	// maxPTRHosts bounds the addresses resolved by one request, a /22
+	maxPTRHosts = 1024
+)
+
+// PTRRequest asks for the PTR records of addresses. With Prefix alone the boundary
+// hosts are resolved: the network, first and last host and broadcast address; All
+// resolves every address of the prefix instead. Addresses lists hosts explicitly
+type PTRRequest struct {
+	Prefix    string   `json:"prefix,omitempty"`
+	All       bool     `json:"all,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// PTRResult is the reverse DNS of one address. Names is empty when the address has
+// no PTR record; Error is set when the lookup failed or timed out
+type PTRResult struct {
+	Address string   `json:"address"`
+	Names   []string `json:"names"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// PTRResponse lists the results in the order of the addresses
+type PTRResponse struct {
+	Prefix   string      `json:"prefix,omitempty"`
+	Results  []PTRResult `json:"results"`
+	Count    int         `json:"count"`
+	Resolved int         `json:"resolved"`
+	Errors   int         `json:"errors"`
+}
+
+// ptrResolver looks up PTR records; *net.Resolver implements it
+type ptrResolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// ptrLookups resolves addresses with a bounded number of concurrent lookups, each
+// limited by a timeout
+type ptrLookups struct {
+	resolver ptrResolver
+	workers  int
+	timeout  time.Duration
+}
+
+var ptr = &ptrLookups{resolver: net.DefaultResolver, workers: defaultPTRWorkers, timeout: defaultPTRTimeout}
+
+// configurePTR reads GO_SUBNET_CALCULATOR_PTR_WORKERS, GO_SUBNET_CALCULATOR_PTR_TIMEOUT
+// and GO_SUBNET_CALCULATOR_DNS_SERVER, a host:port to query instead of the system
+// resolver
+func configurePTR() error {
+	p := &ptrLookups{resolver: net.DefaultResolver, workers: defaultPTRWorkers, timeout: defaultPTRTimeout}
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_PTR_WORKERS"); value != "" {
+		var err error
+		if p.workers, err = strconv.Atoi(value); err != nil || p.workers < 1 || p.workers > maxPTRWorkers {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_PTR_WORKERS must be between 1 and %d", maxPTRWorkers)
+		}
+	}
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_PTR_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 || d > time.Minute {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_PTR_TIMEOUT must be a duration of at most 1m, got %q", value)
+		}
+		p.timeout = d
+	}
+	server := os.Getenv("GO_SUBNET_CALCULATOR_DNS_SERVER")
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		p.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	ptr = p
+	recordSystemAudit("config.ptr", server, "%d workers, timeout %s", p.workers, p.timeout)
+	return nil
+}
+
+// Resolve looks up every address, calling progress as lookups finish. A canceled
+// context stops the lookups that have not started
+func (p *ptrLookups) Resolve(ctx context.Context, addresses []string, progress func(done, total int)) (*PTRResponse, error) {
+	resp := &PTRResponse{Results: make([]PTRResult, len(addresses)), Count: len(addresses)}
+	indexes := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	done := 0
+	for w := 0; w < min(p.workers, len(addresses)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				resp.Results[i] = p.lookup(ctx, addresses[i])
+				mu.Lock()
+				done++
+				progress(done, len(addresses))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range addresses {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, res := range resp.Results {
+		if res.Error != "" {
+			resp.Errors++
+		} else if len(res.Names) > 0 {
+			resp.Resolved++
+		}
+	}
+	return resp, nil
+}
+
+// lookup resolves one address within the timeout. An address without a PTR record
+// is not an error
+func (p *ptrLookups) lookup(ctx context.Context, address string) PTRResult {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	res := PTRResult{Address: address, Names: []string{}}
+	names, err := p.resolver.LookupAddr(ctx, address)
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+	case err != nil:
+		res.Error = err.Error()
+	default:
+		for _, name := range names {
+			res.Names = append(res.Names, strings.TrimSuffix(name, "."))
+		}
+	}
+	return res
+}
+
+// ptrAddresses returns the addresses a request asks for, checking that explicit
+// addresses are valid and inside the prefix when one is given
+func ptrAddresses(req PTRRequest) ([]string, error) {
+	var network *net.IPNet
+	if req.Prefix != "" {
+		var err error
+		if network, err = parseIPv4Prefix(req.Prefix); err != nil {
+			return nil, err
+		}
+	}
+	if len(req.Addresses) > 0 {
+		if len(req.Addresses) > maxPTRHosts {
+			return nil, fmt.Errorf("at most %d addresses can be resolved at once", maxPTRHosts)
+		}
+		addresses := make([]string, 0, len(req.Addresses))
+		for _, a := range req.Addresses {
+			ip := net.ParseIP(strings.TrimSpace(a)).To4()
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address: %s", a)
+			}
+			if network != nil && !network.Contains(ip) {
+				return nil, fmt.Errorf("%s is not in %s", ip, network)
+			}
+			addresses = append(addresses, ip.String())
+		}
+		return addresses, nil
+	}
+	if network == nil {
+		return nil, fmt.Errorf("prefix or addresses is required")
+	}
+
+	r := cidrset.PrefixToRange(network)
+	var hosts []uint32
+	if req.All {
+		if r.Size() > maxPTRHosts {
+			return nil, fmt.Errorf("%s has %d addresses; all resolves at most %d", network, r.Size(), maxPTRHosts)
+		}
+		for n := uint64(r.First); n <= uint64(r.Last); n++ {
+			hosts = append(hosts, uint32(n))
+		}
+	} else {
+		first, last := usableRange(network)
+		hosts = []uint32{r.First, first, last, r.Last}
+	}
+	addresses := make([]string, 0, len(hosts))
+	seen := map[uint32]bool{}
+	for _, h := range hosts {
+		if !seen[h] {
+			seen[h] = true
+			addresses = append(addresses, uint32ToIP(h).String())
+		}
+	}
+	return addresses, nil
+}
+
+// ptrHandler serves /api/v1/ptr; POST takes a JSON body, GET takes prefix, all and a
+// comma-separated addresses parameter. ?async=true runs the lookups as a job
+func ptrHandler(w http.ResponseWriter, r *http.Request) {
+	var req PTRRequest
+	switch r.Method {
+	case http.MethodPost:
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+	case http.MethodGet:
+		query := r.URL.Query()
+		req.Prefix = query.Get("prefix")
+		req.All, _ = strconv.ParseBool(query.Get("all"))
+		if addresses := query.Get("addresses"); addresses != "" {
+			req.Addresses = strings.Split(addresses, ",")
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	async, ok := asyncRequested(w, r)
+	if !ok {
+		return
+	}
+	addresses, err := ptrAddresses(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	prefix := ""
+	if req.Prefix != "" {
+		network, _ := parseIPv4Prefix(req.Prefix)
+		prefix = network.String()
+	}
+	lookups := ptr
+	resolve := func(ctx context.Context, progress func(done, total int)) (*PTRResponse, error) {
+		resp, err := lookups.Resolve(ctx, addresses, progress)
+		if err != nil {
+			return nil, err
+		}
+		resp.Prefix = prefix
+		return resp, nil
+	}
+	if async {
+		submitJob(w, r, "ptr", len(addresses), func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+			resp, err := resolve(ctx, progress)
+			if err != nil {
+				return nil, err
+			}
+			return resp, nil
+		})
+		return
+	}
+	resp, err := resolve(r.Context(), func(done, total int) {})
+	if err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakePTRResolver answers from a map, reports unknown addresses as not found, and
+// never answers for slow ones. It records the highest number of concurrent lookups
+type fakePTRResolver struct {
+	names   map[string][]string
+	slow    map[string]bool
+	active  int32
+	highest int32
+}
+
+func (f *fakePTRResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	active := atomic.AddInt32(&f.active, 1)
+	defer atomic.AddInt32(&f.active, -1)
+	for {
+		highest := atomic.LoadInt32(&f.highest)
+		if active <= highest || atomic.CompareAndSwapInt32(&f.highest, highest, active) {
+			break
+		}
+	}
+	if f.slow[addr] {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	time.Sleep(time.Millisecond)
+	if names, ok := f.names[addr]; ok {
+		return names, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+}
+
+// withTestPTR resolves with fake through the given number of workers
+func withTestPTR(t *testing.T, fake *fakePTRResolver, workers int) {
+	t.Helper()
+	previous := ptr
+	ptr = &ptrLookups{resolver: fake, workers: workers, timeout: 50 * time.Millisecond}
+	t.Cleanup(func() { ptr = previous })
+}
+
+func TestPTRAddresses(t *testing.T) {
+	tests := []struct {
+		req  PTRRequest
+		want string
+	}{
+		{PTRRequest{Prefix: "192.0.2.77/24"}, "192.0.2.0 192.0.2.1 192.0.2.254 192.0.2.255"},
+		{PTRRequest{Prefix: "192.0.2.0/31"}, "192.0.2.0 192.0.2.1"},
+		{PTRRequest{Prefix: "192.0.2.8/30", All: true}, "192.0.2.8 192.0.2.9 192.0.2.10 192.0.2.11"},
+		{PTRRequest{Prefix: "192.0.2.0/24", Addresses: []string{" 192.0.2.10", "192.0.2.20"}}, "192.0.2.10 192.0.2.20"},
+	}
+	for _, tt := range tests {
+		got, err := ptrAddresses(tt.req)
+		if err != nil || strings.Join(got, " ") != tt.want {
+			t.Errorf("ptrAddresses(%+v) = %v, %v; want %s", tt.req, got, err, tt.want)
+		}
+	}
+
+	for _, req := range []PTRRequest{
+		{},
+		{Prefix: "10.0.0.0/16", All: true},
+		{Prefix: "10.0.0.0/24", Addresses: []string{"10.0.1.1"}},
+		{Addresses: []string{"not-an-ip"}},
+	} {
+		if _, err := ptrAddresses(req); err == nil {
+			t.Errorf("ptrAddresses(%+v) expected an error", req)
+		}
+	}
+}
+
+func TestPTRResolve(t *testing.T) {
+	fake := &fakePTRResolver{
+		names: map[string][]string{"192.0.2.1": {"gw.example.net."}, "192.0.2.9": {"a.example.net.", "b.example.net."}},
+		slow:  map[string]bool{"192.0.2.5": true},
+	}
+	withTestPTR(t, fake, 4)
+
+	addresses := make([]string, 0, 64)
+	for i := 0; i < 64; i++ {
+		addresses = append(addresses, fmt.Sprintf("192.0.2.%d", i))
+	}
+	var calls int32
+	resp, err := ptr.Resolve(context.Background(), addresses, func(done, total int) { atomic.AddInt32(&calls, 1) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Count != 64 || resp.Resolved != 2 || resp.Errors != 1 || calls != 64 {
+		t.Errorf("count %d, resolved %d, errors %d, progress calls %d; want 64, 2, 1, 64", resp.Count, resp.Resolved, resp.Errors, calls)
+	}
+	if got := resp.Results[9]; got.Address != "192.0.2.9" || strings.Join(got.Names, ",") != "a.example.net,b.example.net" {
+		t.Errorf("result 9 = %+v", got)
+	}
+	if got := resp.Results[5]; !strings.Contains(got.Error, "deadline exceeded") {
+		t.Errorf("slow lookup = %+v, want a timeout", got)
+	}
+	if got := resp.Results[3]; got.Error != "" || len(got.Names) != 0 {
+		t.Errorf("missing PTR = %+v, want no names and no error", got)
+	}
+	if fake.highest > 4 {
+		t.Errorf("%d concurrent lookups, want at most 4 workers", fake.highest)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ptr.Resolve(ctx, addresses, func(done, total int) {}); err == nil {
+		t.Error("expected an error for a canceled context")
+	}
+}
+
+func TestPTRHandler(t *testing.T) {
+	withTestPTR(t, &fakePTRResolver{names: map[string][]string{"198.51.100.1": {"router.example.org."}}}, 2)
+
+	rr := httptest.NewRecorder()
+	ptrHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ptr?prefix=198.51.100.0/24", nil))
+	var resp PTRResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v (%s)", err, rr.Body.String())
+	}
+	if resp.Prefix != "198.51.100.0/24" || resp.Count != 4 || resp.Results[1].Names[0] != "router.example.org" {
+		t.Errorf("GET ptr = %+v", resp)
+	}
+
+	withTestJobs(t, 1)
+	rr = httptest.NewRecorder()
+	ptrHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ptr?async=true", strings.NewReader(`{"prefix":"198.51.100.0/28","all":true}`)))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("async status = %d, want 202 (body: %s)", rr.Code, rr.Body.String())
+	}
+	var job Job
+	json.Unmarshal(rr.Body.Bytes(), &job)
+	if j := waitForJob(t, job.ID); j.Status != "succeeded" || j.Total != 16 || j.Done != 16 {
+		t.Errorf("job = %+v", j)
+	}
+
+	rr = httptest.NewRecorder()
+	ptrHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ptr?prefix=10.0.0.0/8&all=true", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("all for a /8 status = %d, want 400", rr.Code)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	mathrand "math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// quizTTL is how long an unanswered question and an idle score are kept
+	quizTTL = 24 * time.Hour
+	// quizPlayerCookie identifies anonymous players so their score survives between questions
+	quizPlayerCookie = "quiz_player"
+	// minQuizPrefix and maxQuizPrefix bound the prefix lengths of questions; /31 and /32
+	// have no host range to ask about
+	minQuizPrefix, maxQuizPrefix = 8, 30
+)
+
+// errQuizAnswered is returned for a second answer to the same question
+var errQuizAnswered = errors.New("question already answered")
+
+// quizFields are the values a question asks for, in the order they are graded
+var quizFields = []string{"network", "broadcast", "first_host", "last_host", "usable_hosts"}
+
+// QuizQuestion asks for the subnet values of an address and mask. The mask is given in
+// prefix or dotted notation at random, to practise both
+type QuizQuestion struct {
+	ID     string   `json:"id"`
+	IP     string   `json:"ip"`
+	Mask   string   `json:"mask"`
+	Fields []string `json:"fields"`
+
+	player   string
+	created  time.Time
+	answered bool
+}
+
+// QuizScore counts the answers of a player. A question counts as correct when every
+// field was right
+type QuizScore struct {
+	Asked   int `json:"asked"`
+	Correct int `json:"correct"`
+	Wrong   int `json:"wrong"`
+	Streak  int `json:"streak"`
+	Best    int `json:"best_streak"`
+
+	seen time.Time
+}
+
+// QuizFieldGrade is the grade of one answered field
+type QuizFieldGrade struct {
+	Field    string `json:"field"`
+	Answer   string `json:"answer"`
+	Expected string `json:"expected"`
+	Correct  bool   `json:"correct"`
+}
+
+// QuizGrade is the outcome of an answer, with the player's updated score
+type QuizGrade struct {
+	Question *QuizQuestion    `json:"question"`
+	Correct  bool             `json:"correct"`
+	Fields   []QuizFieldGrade `json:"fields"`
+	Score    QuizScore        `json:"score"`
+}
+
+// quizBook keeps the open questions and the scores of players in memory
+type quizBook struct {
+	mu        sync.Mutex
+	questions map[string]*QuizQuestion
+	scores    map[string]*QuizScore
+}
+
+func newQuizBook() *quizBook {
+	return &quizBook{questions: map[string]*QuizQuestion{}, scores: map[string]*QuizScore{}}
+}
+
+// prune drops old questions and idle players; the caller holds b.mu
+func (b *quizBook) prune(now time.Time) {
+	for id, q := range b.questions {
+		if now.Sub(q.created) > quizTTL {
+			delete(b.questions, id)
+		}
+	}
+	for player, s := range b.scores {
+		if now.Sub(s.seen) > quizTTL {
+			delete(b.scores, player)
+		}
+	}
+}
+
+// score returns the score of a player, creating it; the caller holds b.mu
+func (b *quizBook) score(player string, now time.Time) *QuizScore {
+	s, ok := b.scores[player]
+	if !ok {
+		s = &QuizScore{}
+		b.scores[player] = s
+	}
+	s.seen = now
+	return s
+}
+
+// Ask draws a new question for player
+func (b *quizBook) Ask(player string) (*QuizQuestion, QuizScore, error) {
+	id, err := newShareCode()
+	if err != nil {
+		return nil, QuizScore{}, err
+	}
+	q := randomQuizQuestion()
+	q.ID, q.player = id, player
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.prune(now)
+	q.created = now
+	b.questions[id] = q
+	s := b.score(player, now)
+	s.Asked++
+	copied := *q
+	return &copied, *s, nil
+}
+
+// Score returns the current score of player
+func (b *quizBook) Score(player string) QuizScore {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return *b.score(player, time.Now())
+}
+
+// Answer grades the answers to a question of player. Questions of other players are
+// not found, and each question can be answered once
+func (b *quizBook) Answer(player, id string, answers map[string]string) (*QuizGrade, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q, ok := b.questions[id]
+	if !ok || q.player != player {
+		return nil, errIPAMNotFound
+	}
+	if q.answered {
+		return nil, errQuizAnswered
+	}
+	grade, err := gradeQuizAnswers(q, answers)
+	if err != nil {
+		return nil, err
+	}
+	q.answered = true
+
+	s := b.score(player, time.Now())
+	if grade.Correct {
+		s.Correct++
+		s.Streak++
+		s.Best = max(s.Best, s.Streak)
+	} else {
+		s.Wrong++
+		s.Streak = 0
+	}
+	grade.Score = *s
+	return grade, nil
+}
+
+// randomQuizQuestion draws a random address from 1.0.0.0 to 222.255.255.255 and a
+// prefix between minQuizPrefix and maxQuizPrefix
+func randomQuizQuestion() *QuizQuestion {
+	ip := uint32ToIP(1<<24 + mathrand.Uint32N(222<<24))
+	prefix := minQuizPrefix + mathrand.IntN(maxQuizPrefix-minQuizPrefix+1)
+	mask := "/" + strconv.Itoa(prefix)
+	if mathrand.IntN(2) == 0 {
+		mask = net.IP(net.CIDRMask(prefix, 32)).String()
+	}
+	return &QuizQuestion{IP: ip.String(), Mask: mask, Fields: quizFields}
+}
+
+// gradeQuizAnswers checks every field against the calculation of the question.
+// Addresses are compared as addresses, so leading zeros and spaces do not matter
+func gradeQuizAnswers(q *QuizQuestion, answers map[string]string) (*QuizGrade, error) {
+	result, err := calculateSubnet(q.IP, q.Mask)
+	if err != nil {
+		return nil, err
+	}
+	expected := map[string]string{
+		"network":      result.NetworkAddress,
+		"broadcast":    result.BroadcastAddress,
+		"first_host":   result.MinHostAddress,
+		"last_host":    result.MaxHostAddress,
+		"usable_hosts": result.UsableHosts,
+	}
+	copied := *q
+	grade := &QuizGrade{Question: &copied, Correct: true}
+	for _, field := range quizFields {
+		answer := strings.TrimSpace(answers[field])
+		correct := answer == expected[field]
+		if ip := parseQuizAddress(answer); ip != nil && field != "usable_hosts" {
+			correct = ip.Equal(net.ParseIP(expected[field]))
+		} else if field == "usable_hosts" {
+			n, err := strconv.ParseUint(strings.ReplaceAll(answer, ",", ""), 10, 64)
+			correct = err == nil && strconv.FormatUint(n, 10) == expected[field]
+		}
+		grade.Correct = grade.Correct && correct
+		grade.Fields = append(grade.Fields, QuizFieldGrade{Field: field, Answer: answer, Expected: expected[field], Correct: correct})
+	}
+	return grade, nil
+}
+
+// parseQuizAddress parses a dotted address, allowing leading zeros in its octets
+func parseQuizAddress(s string) net.IP {
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 {
+		return nil
+	}
+	ip := make(net.IP, 4)
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 8)
+		if err != nil {
+			return nil
+		}
+		ip[i] = byte(n)
+	}
+	return ip
+}
+
+// quiz holds the questions and scores behind /quiz and /api/v1/quiz
+var quiz = newQuizBook()
+
+// quizPlayer returns who a quiz request plays as: the signed-in user or API key, or
+// for anonymous callers a random player id kept in a cookie
+func quizPlayer(w http.ResponseWriter, r *http.Request) (string, error) {
+	if actor := requestActor(r); actor != "anonymous" {
+		return actor, nil
+	}
+	if cookie, err := r.Cookie(quizPlayerCookie); err == nil && cookie.Value != "" {
+		return "player:" + cookie.Value, nil
+	}
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	id := base64.RawURLEncoding.EncodeToString(random)
+	http.SetCookie(w, &http.Cookie{
+		Name:     quizPlayerCookie,
+		Value:    id,
+		Path:     sitePath("/"),
+		MaxAge:   int(quizTTL / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return "player:" + id, nil
+}
+
+// quizHandler serves /api/v1/quiz: GET returns the caller's score and POST draws a
+// new question
+func quizHandler(w http.ResponseWriter, r *http.Request) {
+	player, err := quizPlayer(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, quiz.Score(player))
+	case http.MethodPost:
+		q, score, err := quiz.Ask(player)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusCreated, struct {
+			*QuizQuestion
+			Score QuizScore `json:"score"`
+		}{q, score})
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// quizAnswerHandler serves POST /api/v1/quiz/{id}, grading the answers to a question
+// given as a JSON object of field names and values
+func quizAnswerHandler(w http.ResponseWriter, r *http.Request) {
+	var answers map[string]string
+	if !decodeJSONPost(w, r, &answers) {
+		return
+	}
+	player, err := quizPlayer(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	grade, err := quiz.Answer(player, r.PathValue("id"), answers)
+	if errors.Is(err, errQuizAnswered) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, grade)
+}
+
+// QuizPage is the data behind the /quiz page: the question to answer, and the grade of
+// the previous answer if there was one
+type QuizPage struct {
+	Question *QuizQuestion
+	Grade    *QuizGrade
+	Score    QuizScore
+	Error    string
+}
+
+// quizPageHandler serves the /quiz page. A GET draws a question; a POST grades the
+// answer and shows the solution with a button for the next question
+func quizPageHandler(w http.ResponseWriter, r *http.Request) {
+	if !parseFormBody(w, r) {
+		return
+	}
+	tmpl, err := loadTemplate("quiz.html")
+	if err != nil {
+		logRequestf(r.Context(), "Template loading error: %v", err)
+		http.Error(w, "Template loading error", http.StatusInternalServerError)
+		return
+	}
+	player, err := quizPlayer(w, r)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	page := &QuizPage{}
+	if r.Method == http.MethodPost && r.FormValue("id") != "" {
+		answers := map[string]string{}
+		for _, field := range quizFields {
+			answers[field] = r.FormValue(field)
+		}
+		if page.Grade, err = quiz.Answer(player, r.FormValue("id"), answers); err != nil {
+			page.Error = fmt.Sprintf("This question cannot be graded: %v", err)
+		} else {
+			page.Score = page.Grade.Score
+		}
+	}
+	if page.Grade == nil {
+		if page.Question, page.Score, err = quiz.Ask(player); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := tmpl.Execute(w, page); err != nil {
+		logRequestf(r.Context(), "Template execution error: %v", err)
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// withTestQuiz gives a test an empty quiz book
+func withTestQuiz(t *testing.T) *quizBook {
+	t.Helper()
+	previous := quiz
+	quiz = newQuizBook()
+	t.Cleanup(func() { quiz = previous })
+	return quiz
+}
+
+func TestRandomQuizQuestion(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		q := randomQuizQuestion()
+		result, err := calculateSubnet(q.IP, q.Mask)
+		if err != nil {
+			t.Fatalf("question %s %s: %v", q.IP, q.Mask, err)
+		}
+		mask, _ := parseSubnetMask(q.Mask)
+		if ones, _ := mask.Size(); ones < minQuizPrefix || ones > maxQuizPrefix || result.MinHostAddress == "N/A" {
+			t.Errorf("question %s %s is out of range", q.IP, q.Mask)
+		}
+		if first := parseQuizAddress(q.IP)[0]; first < 1 || first > 222 {
+			t.Errorf("address %s is not unicast", q.IP)
+		}
+	}
+}
+
+func TestQuizBook(t *testing.T) {
+	b := newQuizBook()
+	q, score, err := b.Ask("alice")
+	if err != nil || score.Asked != 1 {
+		t.Fatalf("Ask() = %+v, %+v, %v", q, score, err)
+	}
+	q.IP, q.Mask = "192.168.1.100", "255.255.255.192"
+	b.questions[q.ID].IP, b.questions[q.ID].Mask = q.IP, q.Mask
+
+	if _, err := b.Answer("bob", q.ID, nil); err != errIPAMNotFound {
+		t.Errorf("answer by another player: %v", err)
+	}
+	grade, err := b.Answer("alice", q.ID, map[string]string{
+		"network": " 192.168.001.064 ", "broadcast": "192.168.1.127", "first_host": "192.168.1.65",
+		"last_host": "192.168.1.126", "usable_hosts": "62",
+	})
+	if err != nil || !grade.Correct || grade.Score.Correct != 1 || grade.Score.Streak != 1 {
+		t.Fatalf("Answer() = %+v, %v", grade, err)
+	}
+	if _, err := b.Answer("alice", q.ID, nil); err != errQuizAnswered {
+		t.Errorf("second answer: %v", err)
+	}
+
+	q, _, _ = b.Ask("alice")
+	b.questions[q.ID].IP, b.questions[q.ID].Mask = "172.16.5.4", "/16"
+	grade, _ = b.Answer("alice", q.ID, map[string]string{"network": "10.0.0.0"})
+	if grade.Correct || grade.Score.Wrong != 1 || grade.Score.Streak != 0 || grade.Score.Best != 1 || grade.Score.Asked != 2 {
+		t.Errorf("wrong answer = %+v", grade)
+	}
+	for _, f := range grade.Fields {
+		if f.Correct || f.Expected == "" {
+			t.Errorf("field %+v", f)
+		}
+	}
+}
+
+func TestQuizAPI(t *testing.T) {
+	withTestQuiz(t)
+
+	call := func(h http.HandlerFunc, method, target, cookie, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: quizPlayerCookie, Value: cookie})
+		}
+		req.SetPathValue("id", strings.TrimPrefix(target, "/api/v1/quiz/"))
+		rr := httptest.NewRecorder()
+		h(rr, req)
+		return rr
+	}
+
+	rr := call(quizHandler, http.MethodPost, "/api/v1/quiz", "", "")
+	var q QuizQuestion
+	if err := json.NewDecoder(rr.Body).Decode(&q); err != nil || rr.Code != http.StatusCreated || q.ID == "" || len(q.Fields) != len(quizFields) {
+		t.Fatalf("new question = %d %+v %v", rr.Code, q, err)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != quizPlayerCookie {
+		t.Fatalf("cookies = %+v", cookies)
+	}
+	player := cookies[0].Value
+
+	result, _ := calculateSubnet(q.IP, q.Mask)
+	answer, _ := json.Marshal(map[string]string{
+		"network": result.NetworkAddress, "broadcast": result.BroadcastAddress,
+		"first_host": result.MinHostAddress, "last_host": result.MaxHostAddress, "usable_hosts": result.UsableHosts,
+	})
+	if rr := call(quizAnswerHandler, http.MethodPost, "/api/v1/quiz/"+q.ID, "someone-else", string(answer)); rr.Code != http.StatusNotFound {
+		t.Errorf("answer by another player = %d, want 404", rr.Code)
+	}
+	rr = call(quizAnswerHandler, http.MethodPost, "/api/v1/quiz/"+q.ID, player, string(answer))
+	var grade QuizGrade
+	if err := json.NewDecoder(rr.Body).Decode(&grade); err != nil || !grade.Correct || grade.Score.Correct != 1 {
+		t.Fatalf("grade = %d %+v %v", rr.Code, grade, err)
+	}
+	if rr := call(quizAnswerHandler, http.MethodPost, "/api/v1/quiz/"+q.ID, player, string(answer)); rr.Code != http.StatusConflict {
+		t.Errorf("second answer = %d, want 409", rr.Code)
+	}
+
+	var score QuizScore
+	json.NewDecoder(call(quizHandler, http.MethodGet, "/api/v1/quiz", player, "").Body).Decode(&score)
+	if score.Asked != 1 || score.Correct != 1 {
+		t.Errorf("score = %+v", score)
+	}
+}
+
+func TestQuizPage(t *testing.T) {
+	withTestQuiz(t)
+
+	rr := httptest.NewRecorder()
+	quizPageHandler(rr, httptest.NewRequest(http.MethodGet, "/quiz", nil))
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, `name="usable_hosts"`) {
+		t.Fatalf("page = %d:\n%s", rr.Code, body)
+	}
+	cookie := rr.Result().Cookies()[0]
+	var q *QuizQuestion
+	for _, question := range quiz.questions {
+		q = question
+	}
+
+	form := url.Values{"id": {q.ID}, "network": {"1.2.3.4"}}
+	req := httptest.NewRequest(http.MethodPost, "/quiz", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	rr = httptest.NewRecorder()
+	quizPageHandler(rr, req)
+	body = rr.Body.String()
+	if !strings.Contains(body, "Not quite.") || !strings.Contains(body, "you answered 1.2.3.4") || !strings.Contains(body, "Next Question") {
+		t.Errorf("graded page:\n%s", body)
+	}
+	if !strings.Contains(body, "Score: 0 of 1 correct") {
+		t.Errorf("score missing:\n%s", body)
+	}
+}
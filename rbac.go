@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// errForbidden is returned when a principal's role is too low for an action
+var errForbidden = errors.New("forbidden")
+
+// Role is a permission level within a tenant; each role includes the ones below it
+type Role string
+
+const (
+	// RoleViewer reads pools, allocations and alerts
+	RoleViewer Role = "viewer"
+	// RoleOperator also allocates, updates and releases blocks
+	RoleOperator Role = "operator"
+	// RoleAdmin also creates, changes and deletes pools and imports address plans
+	RoleAdmin Role = "admin"
+)
+
+var roleRank = map[Role]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// includes reports whether r grants at least the permissions of other
+func (r Role) includes(other Role) bool {
+	return roleRank[r] >= roleRank[other]
+}
+
+func parseRole(value string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(value)))
+	if _, ok := roleRank[role]; !ok {
+		return "", fmt.Errorf("role must be viewer, operator or admin, got %q", value)
+	}
+	return role, nil
+}
+
+// defaultTenant owns pools created without a tenant, including those from before
+// tenants existed; allTenants grants a role in every tenant
+const (
+	defaultTenant = "default"
+	allTenants    = "*"
+)
+
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// validTenant checks a tenant name; allowAll also accepts "*"
+func validTenant(tenant string, allowAll bool) error {
+	if tenantPattern.MatchString(tenant) || (allowAll && tenant == allTenants) {
+		return nil
+	}
+	return fmt.Errorf("tenant must be 1-63 lowercase letters, digits, - or _, got %q", tenant)
+}
+
+// Principal is who a request acts as: the audit actor with a role in one tenant or,
+// with Tenant "*", in all of them
+type Principal struct {
+	Name   string `json:"name"`
+	Tenant string `json:"tenant"`
+	Role   Role   `json:"role"`
+}
+
+// anonymousPrincipal is used while authentication is off, so every caller can do
+// everything as before tenants and roles existed
+var anonymousPrincipal = Principal{Name: "anonymous", Tenant: allTenants, Role: RoleAdmin}
+
+// unauthenticatedPrincipal is used for API callers without credentials once web login
+// or API keys are configured: it sees no tenant and has no role
+var unauthenticatedPrincipal = Principal{Name: "anonymous"}
+
+// global reports whether the principal's role applies to every tenant
+func (p *Principal) global() bool {
+	return p.Tenant == allTenants
+}
+
+// homeTenant is where the principal's new pools go when no tenant is given
+func (p *Principal) homeTenant() string {
+	if p.global() {
+		return defaultTenant
+	}
+	return p.Tenant
+}
+
+// sees reports whether objects of a tenant are visible to the principal
+func (p *Principal) sees(tenant string) bool {
+	return p.global() || p.Tenant == tenant
+}
+
+// check returns errIPAMNotFound for objects of a tenant the principal cannot see, so
+// other tenants' pools are not revealed, and errForbidden when the role is too low
+func (p *Principal) check(tenant string, role Role) error {
+	if !p.sees(tenant) {
+		return errIPAMNotFound
+	}
+	if !p.Role.includes(role) {
+		return fmt.Errorf("%w: %s role required", errForbidden, role)
+	}
+	return nil
+}
+
+// checkTarget is check for a tenant named in a request rather than found on an
+// object, so a tenant the principal cannot see is forbidden instead of missing
+func (p *Principal) checkTarget(tenant string, role Role) error {
+	if !p.sees(tenant) {
+		return fmt.Errorf("%w: no access to tenant %q", errForbidden, tenant)
+	}
+	return p.check(tenant, role)
+}
+
+// checkGlobal allows actions that span every tenant, such as NetBox sync
+func (p *Principal) checkGlobal(role Role) error {
+	if !p.global() || !p.Role.includes(role) {
+		return fmt.Errorf("%w: %s role in all tenants required", errForbidden, role)
+	}
+	return nil
+}
+
+// principalContextKey carries the principal of an authenticated request
+type principalContextKey struct{}
+
+// withPrincipal returns a request acting as p; p.Name becomes the audit actor
+func withPrincipal(r *http.Request, p *Principal) *http.Request {
+	r = withActor(r, p.Name)
+	return r.WithContext(context.WithValue(r.Context(), principalContextKey{}, p))
+}
+
+// requestPrincipal returns the principal of a request, or the anonymous global admin.
+// API callers without credentials get no role instead once authentication is
+// configured, so a user does not gain access by dropping their session or key
+func requestPrincipal(r *http.Request) *Principal {
+	if p, ok := r.Context().Value(principalContextKey{}).(*Principal); ok {
+		return p
+	}
+	p := anonymousPrincipal
+	if strings.HasPrefix(r.URL.Path, "/api/") && authConfigured() {
+		p = unauthenticatedPrincipal
+	}
+	return &p
+}
+
+// authConfigured reports whether web login is on or any API key exists. The keys are
+// looked up each time, as the apikeys command may add them while the server runs
+func authConfigured() bool {
+	if webAuthMode() != "" {
+		return true
+	}
+	keys, err := apiKeyStore.ListKeys()
+	return err != nil || len(keys) > 0
+}
+
+// userRoles maps web UI users to their tenant and role; "*" matches any other user.
+// Set from GO_SUBNET_CALCULATOR_USER_ROLES by configureRBAC
+var userRoles = map[string]Principal{}
+
+// parseUserRoles reads comma-separated user=role[@tenant] entries, such as
+// "alice=admin@*, bob=operator@netops, *=viewer"
+func parseUserRoles(value string) (map[string]Principal, error) {
+	roles := map[string]Principal{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		user, grant, ok := strings.Cut(entry, "=")
+		user = strings.TrimSpace(user)
+		if !ok || user == "" {
+			return nil, fmt.Errorf("user role %q must look like user=role[@tenant]", entry)
+		}
+		roleName, tenant, _ := strings.Cut(grant, "@")
+		role, err := parseRole(roleName)
+		if err != nil {
+			return nil, fmt.Errorf("user %q: %v", user, err)
+		}
+		if tenant = strings.TrimSpace(tenant); tenant == "" {
+			tenant = defaultTenant
+		}
+		if err := validTenant(tenant, true); err != nil {
+			return nil, fmt.Errorf("user %q: %v", user, err)
+		}
+		roles[user] = Principal{Tenant: tenant, Role: role}
+	}
+	return roles, nil
+}
+
+// configureRBAC reads GO_SUBNET_CALCULATOR_USER_ROLES
+func configureRBAC() error {
+	roles, err := parseUserRoles(os.Getenv("GO_SUBNET_CALCULATOR_USER_ROLES"))
+	if err != nil {
+		return fmt.Errorf("GO_SUBNET_CALCULATOR_USER_ROLES: %v", err)
+	}
+	userRoles = roles
+	recordSystemAudit("config.rbac", "", "%d user role mappings", len(roles))
+	return nil
+}
+
+// userPrincipal returns the principal of a signed-in web UI user. Users without a
+// mapping and without a "*" entry are viewers in the default tenant
+func userPrincipal(user string) *Principal {
+	grant, ok := userRoles[user]
+	if !ok {
+		if grant, ok = userRoles["*"]; !ok {
+			grant = Principal{Tenant: defaultTenant, Role: RoleViewer}
+		}
+	}
+	return &Principal{Name: "user:" + user, Tenant: grant.Tenant, Role: grant.Role}
+}
+
+// WhoAmI is the principal a request acts with, the address it came from and the
+// calculation of the client's network
+type WhoAmI struct {
+	*Principal
+	Address      string        `json:"address"`
+	Network      *SubnetResult `json:"network,omitempty"`
+	NetworkError string        `json:"network_error,omitempty"`
+}
+
+// whoamiHandler serves GET /api/v1/whoami with the principal of the request and the
+// network of the client, calculated with the mask query parameter or a /24
+func whoamiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	mask := strings.TrimSpace(r.URL.Query().Get("mask"))
+	if mask == "" {
+		mask = defaultClientMask
+	} else if _, err := parseSubnetMask(mask); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := WhoAmI{Principal: requestPrincipal(r), Address: clientAddress(r)}
+	result, err := calculateSubnet(resp.Address, mask)
+	if err != nil {
+		// IPv6 clients still learn who they are
+		resp.NetworkError = err.Error()
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	result.IPAddress = resp.Address
+	result.SubnetMask = mask
+	result.SpecialPurpose = specialPurposeOf(resp.Address, mask)
+	result.Registration = lookupRegistration(r.Context(), resp.Address)
+	result.Location = lookupGeoLocation(resp.Address)
+	result.Origin = lookupOrigin(r.Context(), resp.Address, mask)
+	result.Reputation = checkReputation(r.Context(), resp.Address)
+	resp.Network = result
+	writeJSON(w, http.StatusOK, resp)
+}
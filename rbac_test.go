@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// withTestUserRoles sets the web UI role mappings for a test
+func withTestUserRoles(t *testing.T, value string) {
+	t.Helper()
+	roles, err := parseUserRoles(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := userRoles
+	userRoles = roles
+	t.Cleanup(func() { userRoles = previous })
+}
+
+func TestParseUserRoles(t *testing.T) {
+	roles, err := parseUserRoles(" alice=admin@*, bob=Operator@netops ,carol=viewer,, *=viewer@lab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Principal{
+		"alice": {Tenant: allTenants, Role: RoleAdmin},
+		"bob":   {Tenant: "netops", Role: RoleOperator},
+		"carol": {Tenant: defaultTenant, Role: RoleViewer},
+		"*":     {Tenant: "lab", Role: RoleViewer},
+	}
+	if len(roles) != len(want) {
+		t.Fatalf("parseUserRoles() = %+v", roles)
+	}
+	for user, p := range want {
+		if roles[user] != p {
+			t.Errorf("%s = %+v, want %+v", user, roles[user], p)
+		}
+	}
+
+	for _, bad := range []string{"alice", "=admin", "alice=root", "alice=admin@Net Ops"} {
+		if _, err := parseUserRoles(bad); err == nil {
+			t.Errorf("parseUserRoles(%q) expected error", bad)
+		}
+	}
+}
+
+func TestUserPrincipal(t *testing.T) {
+	withTestUserRoles(t, "alice=admin@*")
+	if p := userPrincipal("alice"); *p != (Principal{Name: "user:alice", Tenant: allTenants, Role: RoleAdmin}) {
+		t.Errorf("alice = %+v", p)
+	}
+	if p := userPrincipal("bob"); p.Tenant != defaultTenant || p.Role != RoleViewer {
+		t.Errorf("unmapped user = %+v, want viewer in the default tenant", p)
+	}
+	withTestUserRoles(t, "*=operator@lab")
+	if p := userPrincipal("bob"); p.Tenant != "lab" || p.Role != RoleOperator {
+		t.Errorf("wildcard user = %+v", p)
+	}
+}
+
+func TestPrincipalChecks(t *testing.T) {
+	operator := &Principal{Tenant: "netops", Role: RoleOperator}
+	global := &Principal{Tenant: allTenants, Role: RoleViewer}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"own tenant", operator.check("netops", RoleViewer), nil},
+		{"role too low", operator.check("netops", RoleAdmin), errForbidden},
+		{"other tenant is hidden", operator.check("web", RoleViewer), errIPAMNotFound},
+		{"other tenant as target", operator.checkTarget("web", RoleViewer), errForbidden},
+		{"global viewer reads", global.check("web", RoleViewer), nil},
+		{"global viewer writes", global.check("web", RoleOperator), errForbidden},
+		{"tenant admin is not global", (&Principal{Tenant: "netops", Role: RoleAdmin}).checkGlobal(RoleAdmin), errForbidden},
+		{"anonymous is global admin", requestPrincipal(httptest.NewRequest(http.MethodGet, "/", nil)).checkGlobal(RoleAdmin), nil},
+	}
+	for _, tt := range tests {
+		if tt.want == nil && tt.err != nil || tt.want != nil && !errors.Is(tt.err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, tt.err, tt.want)
+		}
+	}
+	if operator.homeTenant() != "netops" || global.homeTenant() != defaultTenant {
+		t.Errorf("home tenants = %q, %q", operator.homeTenant(), global.homeTenant())
+	}
+}
+
+// rbacServer wires the IPAM API behind requireAPIKey with API keys required
+func rbacServer(t *testing.T) http.Handler {
+	t.Helper()
+	withTestAPIKeys(t, true, "")
+	withTestAudit(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/ipam/pools", ipamPoolsHandler)
+	mux.HandleFunc("/api/v1/ipam/pools/{id}", ipamPoolHandler)
+	mux.HandleFunc("/api/v1/ipam/pools/{id}/allocations", ipamPoolAllocationsHandler)
+	mux.HandleFunc("/api/v1/ipam/allocations/{id}", ipamAllocationHandler)
+	mux.HandleFunc("/api/v1/ipam/import", ipamImportHandler)
+	mux.HandleFunc("/api/v1/ipam/alerts", ipamAlertsHandler)
+	mux.HandleFunc("/api/v1/audit", auditHandler)
+	mux.HandleFunc("/api/v1/whoami", whoamiHandler)
+	return requireAPIKey(mux)
+}
+
+func apiCall(handler http.Handler, token, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTenantIsolation(t *testing.T) {
+	withTestIPAM(t)
+	withTestAlerts(t, []float64{50}, "")
+	h := rbacServer(t)
+	_, root, _ := createAPIKey("automation", "*", "admin")
+	_, operator, _ := createAPIKey("netops ci", "netops", "operator")
+	_, viewer, _ := createAPIKey("netops dashboard", "netops", "viewer")
+	_, tenantAdmin, _ := createAPIKey("netops lead", "netops", "admin")
+
+	rr := apiCall(h, root, http.MethodPost, "/api/v1/ipam/pools", `{"name":"netops","prefix":"10.0.0.0/16","tenant":"netops"}`)
+	var netops IPAMPool
+	if err := json.NewDecoder(rr.Body).Decode(&netops); err != nil || rr.Code != http.StatusCreated || netops.Tenant != "netops" {
+		t.Fatalf("create netops pool = %d %+v", rr.Code, netops)
+	}
+	rr = apiCall(h, root, http.MethodPost, "/api/v1/ipam/pools", `{"name":"web","prefix":"10.1.0.0/16"}`)
+	var web IPAMPool
+	if err := json.NewDecoder(rr.Body).Decode(&web); err != nil || web.Tenant != defaultTenant {
+		t.Fatalf("create web pool = %d %+v", rr.Code, web)
+	}
+	if rr = apiCall(h, root, http.MethodPost, "/api/v1/ipam/pools", `{"name":"overlap","prefix":"10.1.0.0/24","tenant":"netops"}`); rr.Code != http.StatusConflict {
+		t.Errorf("pools overlapping across tenants = %d, want 409", rr.Code)
+	}
+
+	var pools []IPAMPool
+	rr = apiCall(h, viewer, http.MethodGet, "/api/v1/ipam/pools", "")
+	if err := json.NewDecoder(rr.Body).Decode(&pools); err != nil || len(pools) != 1 || pools[0].ID != netops.ID {
+		t.Errorf("viewer pools = %+v", pools)
+	}
+	rr = apiCall(h, root, http.MethodGet, "/api/v1/ipam/pools?tenant=default", "")
+	if err := json.NewDecoder(rr.Body).Decode(&pools); err != nil || len(pools) != 1 || pools[0].ID != web.ID {
+		t.Errorf("pools filtered by tenant = %+v", pools)
+	}
+
+	webPath := "/api/v1/ipam/pools/" + strconv.FormatInt(web.ID, 10)
+	netopsPath := "/api/v1/ipam/pools/" + strconv.FormatInt(netops.ID, 10)
+	tests := []struct {
+		name, token, method, target, body string
+		want                              int
+	}{
+		{"other tenant's pool is hidden", operator, http.MethodGet, webPath, "", http.StatusNotFound},
+		{"other tenant's allocations are hidden", operator, http.MethodPost, webPath + "/allocations", `{"size":24}`, http.StatusNotFound},
+		{"viewer reads", viewer, http.MethodGet, netopsPath + "/allocations", "", http.StatusOK},
+		{"viewer cannot allocate", viewer, http.MethodPost, netopsPath + "/allocations", `{"size":24}`, http.StatusForbidden},
+		{"operator allocates", operator, http.MethodPost, netopsPath + "/allocations", `{"size":24}`, http.StatusCreated},
+		{"operator cannot create pools", operator, http.MethodPost, "/api/v1/ipam/pools", `{"name":"x","prefix":"10.2.0.0/16"}`, http.StatusForbidden},
+		{"operator cannot delete pools", operator, http.MethodDelete, netopsPath, "", http.StatusForbidden},
+		{"tenant admin creates in own tenant", tenantAdmin, http.MethodPost, "/api/v1/ipam/pools", `{"name":"lab","prefix":"10.3.0.0/16"}`, http.StatusCreated},
+		{"tenant admin cannot create elsewhere", tenantAdmin, http.MethodPost, "/api/v1/ipam/pools", `{"name":"x","prefix":"10.4.0.0/16","tenant":"web"}`, http.StatusForbidden},
+		{"tenant admin cannot move pools away", tenantAdmin, http.MethodPut, netopsPath, `{"tenant":"web"}`, http.StatusForbidden},
+		{"tenant admin imports into own tenant", tenantAdmin, http.MethodPost, "/api/v1/ipam/import?dry_run=true", "prefix\n10.5.0.0/16\n", http.StatusOK},
+		{"tenant admin cannot import elsewhere", tenantAdmin, http.MethodPost, "/api/v1/ipam/import?tenant=web", "prefix\n10.5.0.0/16\n", http.StatusForbidden},
+		{"tenant admin cannot read the audit log", tenantAdmin, http.MethodGet, "/api/v1/audit", "", http.StatusForbidden},
+		{"global admin reads the audit log", root, http.MethodGet, "/api/v1/audit", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := apiCall(h, tt.token, tt.method, tt.target, tt.body); rr.Code != tt.want {
+				t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.target, rr.Code, tt.want, rr.Body)
+			}
+		})
+	}
+
+	if pool, _ := ipamService.Pool(netops.ID); pool.Tenant != "netops" {
+		t.Errorf("pool moved to %q by a tenant admin", pool.Tenant)
+	}
+	rr = apiCall(h, root, http.MethodPost, webPath+"/allocations", `{"size":17}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("allocate web = %d: %s", rr.Code, rr.Body)
+	}
+	var alerts IPAMAlertsResponse
+	rr = apiCall(h, viewer, http.MethodGet, "/api/v1/ipam/alerts", "")
+	if err := json.NewDecoder(rr.Body).Decode(&alerts); err != nil || len(alerts.Alerts) != 0 {
+		t.Errorf("viewer sees alerts of other tenants: %+v", alerts.Alerts)
+	}
+	rr = apiCall(h, root, http.MethodGet, "/api/v1/ipam/alerts", "")
+	if err := json.NewDecoder(rr.Body).Decode(&alerts); err != nil || len(alerts.Alerts) != 1 || alerts.Alerts[0].Tenant != defaultTenant {
+		t.Errorf("global admin alerts = %+v", alerts.Alerts)
+	}
+
+	var p Principal
+	rr = apiCall(h, operator, http.MethodGet, "/api/v1/whoami", "")
+	if err := json.NewDecoder(rr.Body).Decode(&p); err != nil || p.Name != "apikey:netops ci" || p.Tenant != "netops" || p.Role != RoleOperator {
+		t.Errorf("whoami = %d %+v", rr.Code, p)
+	}
+}
+
+func TestAnonymousAPICallers(t *testing.T) {
+	withTestIPAM(t)
+	withTestAudit(t)
+	withTestAPIKeys(t, false, "")
+	withTestWebAuth(t, nil, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/ipam/pools", ipamPoolsHandler)
+	mux.HandleFunc("/api/v1/audit", auditHandler)
+	h := requireLogin(requireAPIKey(mux))
+	anonymous := func(method, target, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rr
+	}
+
+	// Without any authentication anonymous callers keep full access
+	if rr := anonymous(http.MethodPost, "/api/v1/ipam/pools", `{"name":"lab","prefix":"10.0.0.0/16"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("anonymous create without auth = %d: %s", rr.Code, rr.Body)
+	}
+
+	// With web login on, dropping the session cookie must not make a viewer an admin
+	withTestWebAuth(t, nil, &ldapDirectory{address: "127.0.0.1:1", userDN: "{username}"})
+	withTestUserRoles(t, "*=viewer")
+	if rr := anonymous(http.MethodPost, "/api/v1/ipam/pools", `{"name":"x","prefix":"10.1.0.0/16"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("anonymous create with web login = %d, want 403", rr.Code)
+	}
+	if rr := anonymous(http.MethodGet, "/api/v1/audit", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("anonymous audit with web login = %d, want 403", rr.Code)
+	}
+	var pools []IPAMPool
+	if rr := anonymous(http.MethodGet, "/api/v1/ipam/pools", ""); json.NewDecoder(rr.Body).Decode(&pools) != nil || len(pools) != 0 {
+		t.Errorf("anonymous pools with web login = %d %+v", rr.Code, pools)
+	}
+
+	// An API key alone restricts anonymous callers too
+	withTestWebAuth(t, nil, nil)
+	createAPIKey("dashboard", defaultTenant, "viewer")
+	if rr := anonymous(http.MethodPost, "/api/v1/ipam/pools", `{"name":"x","prefix":"10.1.0.0/16"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("anonymous create with an API key = %d, want 403", rr.Code)
+	}
+}
+
+func TestIPAMPageRoles(t *testing.T) {
+	withTestIPAM(t)
+	withTestAudit(t)
+	withTestAPIKeys(t, false, "")
+	ipamService.CreatePool(PoolRequest{Name: "netops", Prefix: "10.0.0.0/16", Tenant: "netops"})
+	ipamService.CreatePool(PoolRequest{Name: "web", Prefix: "10.1.0.0/16"})
+
+	page := func(p *Principal, form url.Values) *httptest.ResponseRecorder {
+		method := http.MethodGet
+		var req *http.Request
+		if form != nil {
+			method = http.MethodPost
+			req = httptest.NewRequest(method, "/ipam", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest(method, "/ipam", nil)
+		}
+		rr := httptest.NewRecorder()
+		ipamPageHandler(rr, withPrincipal(req, p))
+		return rr
+	}
+
+	viewer := &Principal{Name: "user:bob", Tenant: "netops", Role: RoleViewer}
+	body := page(viewer, nil).Body.String()
+	if !strings.Contains(body, "netops") || strings.Contains(body, "10.1.0.0/16") {
+		t.Errorf("viewer page must list only its tenant's pools:\n%s", body)
+	}
+	if strings.Contains(body, "create-pool") || strings.Contains(body, "Tenant:") {
+		t.Error("viewer page must not offer pool management")
+	}
+	if body := page(viewer, url.Values{"action": {"create-pool"}, "name": {"x"}, "prefix": {"10.2.0.0/16"}}).Body.String(); !strings.Contains(body, "forbidden") {
+		t.Errorf("viewer create-pool must fail:\n%s", body)
+	}
+
+	admin := &Principal{Name: "user:alice", Tenant: allTenants, Role: RoleAdmin}
+	if body := page(admin, nil).Body.String(); !strings.Contains(body, "create-pool") || !strings.Contains(body, "10.1.0.0/16") {
+		t.Error("global admin page must show every pool and the create form")
+	}
+	if rr := page(admin, url.Values{"action": {"create-pool"}, "name": {"lab"}, "prefix": {"10.2.0.0/16"}, "tenant": {"lab"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("admin create-pool = %d: %s", rr.Code, rr.Body)
+	}
+	pools, _ := ipamService.Pools()
+	if len(pools) != 3 || pools[2].Tenant != "lab" {
+		t.Errorf("pools = %+v", pools)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+const (
+	defaultRDAPTimeout  = 5 * time.Second
+	defaultRDAPCacheTTL = 24 * time.Hour
+	// maxRDAPCacheEntries bounds the cached netblocks; the one expiring first is dropped
+	maxRDAPCacheEntries = 1024
+	// maxRDAPResponseBytes bounds the RDAP answers that are read
+	maxRDAPResponseBytes = 1 << 20
+)
+
+// rdapServers names the regional registries by the whois server they announce in port43
+var rdapServers = map[string]string{
+	"whois.afrinic.net": "AFRINIC",
+	"whois.apnic.net":   "APNIC",
+	"whois.arin.net":    "ARIN",
+	"whois.lacnic.net":  "LACNIC",
+	"whois.ripe.net":    "RIPE NCC",
+}
+
+// Registration is the RDAP record of the netblock a public address belongs to. Error
+// is set instead when the lookup failed; the calculation is shown either way
+type Registration struct {
+	RIR      string   `json:"rir,omitempty"`
+	Handle   string   `json:"handle,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Org      string   `json:"org,omitempty"`
+	Country  string   `json:"country,omitempty"`
+	Start    string   `json:"start_address,omitempty"`
+	End      string   `json:"end_address,omitempty"`
+	Prefixes []string `json:"prefixes,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// rdapEntity is an entity of an RDAP response, with its contact card in jCard form
+type rdapEntity struct {
+	Roles    []string          `json:"roles"`
+	VCard    []json.RawMessage `json:"vcardArray"`
+	Entities []rdapEntity      `json:"entities"`
+}
+
+// name returns the fn (formatted name) of the entity's contact card
+func (e rdapEntity) name() string {
+	if len(e.VCard) < 2 {
+		return ""
+	}
+	var properties [][]interface{}
+	if err := json.Unmarshal(e.VCard[1], &properties); err != nil {
+		return ""
+	}
+	for _, p := range properties {
+		if len(p) == 4 && p[0] == "fn" {
+			if s, ok := p[3].(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// rdapNetwork is the part of an RDAP IP network response that is shown
+type rdapNetwork struct {
+	Handle       string       `json:"handle"`
+	StartAddress string       `json:"startAddress"`
+	EndAddress   string       `json:"endAddress"`
+	Name         string       `json:"name"`
+	Country      string       `json:"country"`
+	Port43       string       `json:"port43"`
+	Entities     []rdapEntity `json:"entities"`
+}
+
+// registration converts the response, taking the organisation from the registrant
+// entity and the netblock as the prefixes between the start and end address
+func (n *rdapNetwork) registration() (*Registration, cidrset.Range, error) {
+	start, end := net.ParseIP(n.StartAddress).To4(), net.ParseIP(n.EndAddress).To4()
+	if start == nil || end == nil || ipToUint32(start) > ipToUint32(end) {
+		return nil, cidrset.Range{}, fmt.Errorf("RDAP response has no IPv4 netblock")
+	}
+	block := cidrset.Range{First: ipToUint32(start), Last: ipToUint32(end)}
+	reg := &Registration{
+		RIR:      n.Port43,
+		Handle:   n.Handle,
+		Name:     n.Name,
+		Country:  n.Country,
+		Start:    start.String(),
+		End:      end.String(),
+		Prefixes: prefixStrings(cidrset.RangeToPrefixes(block)),
+	}
+	if rir, ok := rdapServers[strings.ToLower(n.Port43)]; ok {
+		reg.RIR = rir
+	}
+	var find func(entities []rdapEntity) string
+	find = func(entities []rdapEntity) string {
+		for _, e := range entities {
+			for _, role := range e.Roles {
+				if role == "registrant" && e.name() != "" {
+					return e.name()
+				}
+			}
+			if name := find(e.Entities); name != "" {
+				return name
+			}
+		}
+		return ""
+	}
+	reg.Org = find(n.Entities)
+	return reg, block, nil
+}
+
+type rdapCacheEntry struct {
+	registration *Registration
+	expires      time.Time
+}
+
+// rdapClient looks up addresses at an RDAP service and caches the netblocks it
+// answers with, so further addresses in the same block are not looked up again
+type rdapClient struct {
+	baseURL string
+	timeout time.Duration
+	ttl     time.Duration
+	client  *http.Client
+
+	mu    sync.Mutex
+	cache map[cidrset.Range]rdapCacheEntry
+}
+
+func newRDAPClient(baseURL string, timeout, ttl time.Duration) *rdapClient {
+	return &rdapClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		timeout: timeout,
+		ttl:     ttl,
+		client:  &http.Client{},
+		cache:   map[cidrset.Range]rdapCacheEntry{},
+	}
+}
+
+// rdap is nil unless RDAP lookups are enabled with GO_SUBNET_CALCULATOR_RDAP_URL
+var rdap *rdapClient
+
+// configureRDAP reads GO_SUBNET_CALCULATOR_RDAP_URL, the RDAP service to query such as
+// https://rdap.org, and the optional GO_SUBNET_CALCULATOR_RDAP_TIMEOUT and
+// GO_SUBNET_CALCULATOR_RDAP_CACHE_TTL. Lookups are off when no URL is set
+func configureRDAP() error {
+	rdap = nil
+	baseURL := os.Getenv("GO_SUBNET_CALCULATOR_RDAP_URL")
+	if baseURL == "" {
+		recordSystemAudit("config.rdap", "", "RDAP lookups disabled")
+		return nil
+	}
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		return fmt.Errorf("GO_SUBNET_CALCULATOR_RDAP_URL must be an http or https URL")
+	}
+	timeout := defaultRDAPTimeout
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_RDAP_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 || d > time.Minute {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_RDAP_TIMEOUT must be a duration of at most 1m, got %q", value)
+		}
+		timeout = d
+	}
+	ttl := defaultRDAPCacheTTL
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_RDAP_CACHE_TTL"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Minute {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_RDAP_CACHE_TTL must be a duration of at least 1m, got %q", value)
+		}
+		ttl = d
+	}
+	rdap = newRDAPClient(baseURL, timeout, ttl)
+	recordSystemAudit("config.rdap", baseURL, "RDAP lookups enabled, timeout %s, cache %s", timeout, ttl)
+	return nil
+}
+
+// cached returns the cached registration of the netblock containing ip
+func (c *rdapClient) cached(ip uint32, now time.Time) *Registration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for block, entry := range c.cache {
+		if block.First <= ip && ip <= block.Last && now.Before(entry.expires) {
+			return entry.registration
+		}
+	}
+	return nil
+}
+
+// store caches a registration, making room by dropping expired entries and then the
+// entry expiring first
+func (c *rdapClient) store(block cidrset.Range, reg *Registration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= maxRDAPCacheEntries {
+		var oldest cidrset.Range
+		var oldestExpiry time.Time
+		for b, entry := range c.cache {
+			if !now.Before(entry.expires) {
+				delete(c.cache, b)
+			} else if oldestExpiry.IsZero() || entry.expires.Before(oldestExpiry) {
+				oldest, oldestExpiry = b, entry.expires
+			}
+		}
+		if len(c.cache) >= maxRDAPCacheEntries {
+			delete(c.cache, oldest)
+		}
+	}
+	c.cache[block] = rdapCacheEntry{registration: reg, expires: now.Add(c.ttl)}
+}
+
+// Lookup returns the registration of the netblock containing ip, from the cache or
+// from the RDAP service within the configured timeout
+func (c *rdapClient) Lookup(ctx context.Context, ip net.IP) (*Registration, error) {
+	now := time.Now()
+	if reg := c.cached(ipToUint32(ip), now); reg != nil {
+		return reg, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/ip/"+ip.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("RDAP lookup failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("RDAP lookup failed: %s", resp.Status)
+	}
+	var network rdapNetwork
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxRDAPResponseBytes)).Decode(&network); err != nil {
+		return nil, fmt.Errorf("invalid RDAP response: %v", err)
+	}
+	reg, block, err := network.registration()
+	if err != nil {
+		return nil, err
+	}
+	c.store(block, reg, now)
+	return reg, nil
+}
+
+// lookupRegistration returns the registration of a public address when RDAP lookups
+// are enabled, or nil. A failed lookup is logged and returned as the Error of the
+// registration
+func lookupRegistration(ctx context.Context, address string) *Registration {
+	ip := net.ParseIP(address)
+	if rdap == nil || !isPublicIPv4(ip) {
+		return nil
+	}
+	ctx, span := startSpan(ctx, "rdap.lookup", spanKindClient)
+	reg, err := rdap.Lookup(ctx, ip.To4())
+	span.End(err)
+	if err != nil {
+		logRequestf(ctx, "RDAP lookup of %s failed: %v", address, err)
+		return &Registration{Error: err.Error()}
+	}
+	return reg
+}
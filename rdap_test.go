@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+const sampleRDAPNetwork = `{
+  "objectClassName": "ip network",
+  "handle": "NET-8-8-8-0-1",
+  "startAddress": "8.8.8.0",
+  "endAddress": "8.8.8.255",
+  "name": "GOGL",
+  "port43": "whois.arin.net",
+  "entities": [
+    {"roles": ["abuse"], "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Abuse"]]]},
+    {"roles": ["registrant"], "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Google LLC"]]]}
+  ]
+}`
+
+// withTestRDAP enables RDAP lookups against a test server answering with body, and
+// returns the number of requests it received
+func withTestRDAP(t *testing.T, timeout time.Duration, body string) *int32 {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if !strings.HasPrefix(r.URL.Path, "/ip/") {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/ip/9.9.9.9" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "application/rdap+json")
+		w.Write([]byte(body))
+	}))
+	previous := rdap
+	rdap = newRDAPClient(server.URL, timeout, time.Hour)
+	t.Cleanup(func() {
+		rdap = previous
+		server.Close()
+	})
+	return &requests
+}
+
+func TestRDAPLookup(t *testing.T) {
+	requests := withTestRDAP(t, time.Second, sampleRDAPNetwork)
+
+	reg := lookupRegistration(context.Background(), "8.8.8.8")
+	if reg == nil || reg.Error != "" {
+		t.Fatalf("lookupRegistration() = %+v", reg)
+	}
+	if reg.RIR != "ARIN" || reg.Org != "Google LLC" || reg.Handle != "NET-8-8-8-0-1" || strings.Join(reg.Prefixes, ",") != "8.8.8.0/24" {
+		t.Errorf("registration = %+v", reg)
+	}
+
+	// another address of the same netblock comes from the cache
+	if again := lookupRegistration(context.Background(), "8.8.8.4"); again != reg || atomic.LoadInt32(requests) != 1 {
+		t.Errorf("second lookup made %d requests, want 1 (cached)", atomic.LoadInt32(requests))
+	}
+
+	for _, private := range []string{"10.1.2.3", "192.168.1.1", "100.64.0.1", "127.0.0.1", "240.0.0.1"} {
+		if reg := lookupRegistration(context.Background(), private); reg != nil {
+			t.Errorf("lookupRegistration(%s) = %+v, want nil for a non-public address", private, reg)
+		}
+	}
+}
+
+func TestRDAPLookupErrors(t *testing.T) {
+	withTestRDAP(t, 50*time.Millisecond, `{"handle": "broken"}`)
+	if reg := lookupRegistration(context.Background(), "1.1.1.1"); reg == nil || !strings.Contains(reg.Error, "no IPv4 netblock") {
+		t.Errorf("invalid response registration = %+v", reg)
+	}
+	if reg := lookupRegistration(context.Background(), "9.9.9.9"); reg == nil || !strings.Contains(reg.Error, "deadline exceeded") {
+		t.Errorf("slow response registration = %+v", reg)
+	}
+
+	rdap = nil
+	if reg := lookupRegistration(context.Background(), "8.8.8.8"); reg != nil {
+		t.Errorf("disabled lookup = %+v, want nil", reg)
+	}
+}
+
+func TestRDAPCacheEviction(t *testing.T) {
+	c := newRDAPClient("http://rdap.invalid", time.Second, time.Hour)
+	now := time.Now()
+	for i := 0; i < maxRDAPCacheEntries+10; i++ {
+		ip := ipToUint32(net.IPv4(1, 0, 0, 0)) + uint32(i)<<8
+		c.store(cidrset.Range{First: ip, Last: ip + 255}, &Registration{Handle: "n"}, now.Add(time.Duration(i)*time.Second))
+	}
+	if len(c.cache) != maxRDAPCacheEntries {
+		t.Errorf("cache holds %d entries, want %d", len(c.cache), maxRDAPCacheEntries)
+	}
+	if c.cached(ipToUint32(net.IPv4(1, 0, 0, 1)), now) != nil {
+		t.Error("the entry expiring first was not evicted")
+	}
+}
+
+func TestCalculateHandlerRegistration(t *testing.T) {
+	withTestRDAP(t, time.Second, sampleRDAPNetwork)
+	rr := httptest.NewRecorder()
+	calculateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=8.8.8.8&mask=/24", nil))
+	var result SubnetResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if result.Registration == nil || result.Registration.RIR != "ARIN" {
+		t.Errorf("registration = %+v", result.Registration)
+	}
+}
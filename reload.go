@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// reloadMu lets one reload run at a time
+var reloadMu sync.Mutex
+
+// ReloadResponse reports what a reload re-read; a component that failed keeps the
+// version loaded before
+type ReloadResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+// reloadGeoIP re-reads the configured GeoIP databases
+func reloadGeoIP() ComponentHealth {
+	dbs := geoIP
+	if dbs == nil {
+		return ComponentHealth{Status: componentDisabled}
+	}
+	for _, db := range []*geoDatabase{dbs.location, dbs.asn} {
+		if db == nil {
+			continue
+		}
+		if err := db.reload(); err != nil {
+			return ComponentHealth{Status: componentFailed, Error: err.Error()}
+		}
+	}
+	return checkGeoIP()
+}
+
+// reloadASN re-reads the ip2asn table; Team Cymru lookups have nothing to reload
+func reloadASN() ComponentHealth {
+	table, ok := loadOrigins().(*ip2asnTable)
+	if !ok {
+		return checkASN()
+	}
+	fresh, err := loadIP2ASN(table.path)
+	if err != nil {
+		return ComponentHealth{Status: componentFailed, Error: err.Error()}
+	}
+	storeOrigins(fresh)
+	return checkASN()
+}
+
+// reloadBlocklists re-reads the blocklist files of the reputation checks
+func reloadBlocklists() ComponentHealth {
+	current := reputation.Load()
+	if current == nil || len(current.files) == 0 {
+		return ComponentHealth{Status: componentDisabled}
+	}
+	fresh := *current
+	fresh.files = make([]*blocklistFile, len(current.files))
+	entries := 0
+	for i, list := range current.files {
+		loaded, err := loadBlocklist(list.name)
+		if err != nil {
+			return ComponentHealth{Status: componentFailed, Error: err.Error()}
+		}
+		fresh.files[i] = loaded
+		entries += len(loaded.prefixes)
+	}
+	reputation.Store(&fresh)
+	return ComponentHealth{Status: componentOK, Details: fmt.Sprintf("%d files, %d entries", len(fresh.files), entries)}
+}
+
+// reloadData checks the templates, which are read from disk on every render, and
+// re-reads the external data files and the config file
+func reloadData() *ReloadResponse {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	resp := &ReloadResponse{
+		Status: "reloaded",
+		Components: map[string]ComponentHealth{
+			"templates":  checkTemplates(),
+			"geoip":      reloadGeoIP(),
+			"asn":        reloadASN(),
+			"blocklists": reloadBlocklists(),
+			"settings":   reloadSettings(),
+		},
+	}
+	for _, c := range resp.Components {
+		if c.Status == componentFailed {
+			resp.Status = "failed"
+		}
+	}
+	return resp
+}
+
+// summary lists the state of every component for the audit log
+func (resp *ReloadResponse) summary() string {
+	var parts []string
+	for name, c := range resp.Components {
+		part := name + " " + c.Status
+		if c.Error != "" {
+			part += ": " + c.Error
+		}
+		parts = append(parts, part)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// watchHangup runs a reload for every signal until signals is closed. Connections
+// are served throughout, since only the loaded data is swapped
+func watchHangup(signals <-chan os.Signal) {
+	for range signals {
+		resp := reloadData()
+		log.Printf("SIGHUP: data %s", resp.Status)
+		recordSystemAudit("admin.reload", "SIGHUP", "%s", resp.summary())
+	}
+}
+
+// reloadHandler serves POST /api/v1/admin/reload
+func reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	resp := reloadData()
+	recordAudit(r, "admin.reload", "", "%s", resp.summary())
+	if resp.Status != "reloaded" {
+		writeJSON(w, http.StatusInternalServerError, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
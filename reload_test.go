@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReloadHandler(t *testing.T) {
+	audit := withTestAudit(t)
+	withTestSettings(t, currentSettings())
+	withTestAPIKeys(t, false, "admin-secret")
+	withTestGeoIP(t)
+	withTestReputation(t, &fakeDNSBLResolver{}, nil, "192.0.2.0/24\n")
+	asnPath := filepath.Join(t.TempDir(), "ip2asn-v4.tsv")
+	os.WriteFile(asnPath, []byte("1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n"), 0o644)
+	table, err := loadIP2ASN(asnPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withTestOrigins(t, table)
+	h := requireAPIKey(http.HandlerFunc(reloadHandler))
+	reload := func(token string) (*httptest.ResponseRecorder, ReloadResponse) {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/admin/reload", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		var resp ReloadResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr, resp
+	}
+
+	if rr, _ := reload("wrong"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("reload with a wrong token = %d", rr.Code)
+	}
+
+	os.WriteFile(asnPath, []byte("1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n1.0.4.0\t1.0.7.255\t38803\tAU\tWPL\n"), 0o644)
+	os.WriteFile(reputation.Load().files[0].name, []byte("192.0.2.0/24\n198.51.100.7\n"), 0o644)
+	rr, resp := reload("admin-secret")
+	if rr.Code != http.StatusOK || resp.Status != "reloaded" {
+		t.Fatalf("reload = %d %s", rr.Code, rr.Body.String())
+	}
+	if c := resp.Components["asn"]; c.Details != "ip2asn, 2 ranges" || len(loadOrigins().(*ip2asnTable).entries) != 2 {
+		t.Errorf("asn = %+v", c)
+	}
+	if c := resp.Components["blocklists"]; c.Details != "1 files, 2 entries" || reputation.Load().files[0].match(net.ParseIP("198.51.100.7")) == nil {
+		t.Errorf("blocklists = %+v", c)
+	}
+	if c := resp.Components["templates"]; c.Status != componentOK {
+		t.Errorf("templates = %+v", c)
+	}
+	if c := resp.Components["geoip"]; c.Status != componentOK {
+		t.Errorf("geoip = %+v", c)
+	}
+	if entries, _ := audit.List(AuditFilter{Action: "admin.reload", Limit: 10}); len(entries) != 1 || entries[0].Action != "admin.reload" || !strings.Contains(entries[0].Details, "asn ok") {
+		t.Errorf("audit = %+v", entries)
+	}
+
+	// Requests keep reading the data while a reload swaps it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			checkReputation(context.Background(), "198.51.100.7")
+			lookupOrigin(context.Background(), "1.0.4.1", "/24")
+		}
+	}()
+	reload("admin-secret")
+	<-done
+
+	os.WriteFile(asnPath, []byte("1.0.0.0\tnot-an-address\t13335\tUS\tX\n"), 0o644)
+	rr, resp = reload("admin-secret")
+	if rr.Code != http.StatusInternalServerError || resp.Status != "failed" || resp.Components["asn"].Status != componentFailed {
+		t.Errorf("failed reload = %d %s", rr.Code, rr.Body.String())
+	}
+	if len(loadOrigins().(*ip2asnTable).entries) != 2 {
+		t.Error("a failed reload replaced the loaded ip2asn table")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+const defaultDNSBLTimeout = 2 * time.Second
+
+// Reputation reports the blocklists an address is listed on. Checked is the number
+// of lists consulted; lists that could not be queried are reported in Errors
+type Reputation struct {
+	Listed  bool            `json:"listed"`
+	Hits    []ReputationHit `json:"hits"`
+	Checked int             `json:"checked"`
+	Errors  []string        `json:"errors,omitempty"`
+}
+
+// ReputationHit is a listing of an address: Entry is the DNSBL return code or the
+// blocklist file entry that matched, Reason the TXT record of a DNSBL when it has one
+type ReputationHit struct {
+	List   string `json:"list"`
+	Entry  string `json:"entry"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// dnsblResolver looks up the A and TXT records of DNSBL zones; *net.Resolver
+// implements it
+type dnsblResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// blocklistFile is a local list of addresses and prefixes, one per line
+type blocklistFile struct {
+	name     string
+	set      *cidrset.Set
+	prefixes []*net.IPNet
+}
+
+// loadBlocklist reads a blocklist file. Everything after # or ; on a line is a
+// comment, and only the first field of a line is used, so FireHOL and Spamhaus DROP
+// style lists load as they are. IPv6 entries are skipped
+func loadBlocklist(path string) (*blocklistFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	list := &blocklistFile{name: path}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexAny(text, "#;"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		entry := fields[0]
+		if strings.Contains(entry, ":") {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			entry += "/32"
+		}
+		prefix, err := cidrset.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, line, err)
+		}
+		list.prefixes = append(list.prefixes, prefix)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	list.set = cidrset.New(list.prefixes...)
+	return list, nil
+}
+
+// match returns the entry of the list holding ip, or nil
+func (b *blocklistFile) match(ip net.IP) *net.IPNet {
+	if !b.set.Contains(ip) {
+		return nil
+	}
+	for _, p := range b.prefixes {
+		if p.Contains(ip) {
+			return p
+		}
+	}
+	return nil
+}
+
+// reputationChecks are the configured DNSBL zones and blocklist files
+type reputationChecks struct {
+	resolver dnsblResolver
+	timeout  time.Duration
+	zones    []string
+	files    []*blocklistFile
+}
+
+// reputation holds the checks, nil unless DNSBLs or blocklist files are configured.
+// A reload swaps it while requests are served
+var reputation atomic.Pointer[reputationChecks]
+
+// configureReputation reads GO_SUBNET_CALCULATOR_DNSBL, a comma-separated list of
+// DNSBL zones, GO_SUBNET_CALCULATOR_BLOCKLISTS, a comma-separated list of blocklist
+// files, and GO_SUBNET_CALCULATOR_DNSBL_TIMEOUT. DNSBLs are queried through the
+// resolver of configurePTR, so it runs first
+func configureReputation() error {
+	reputation.Store(nil)
+	c := &reputationChecks{timeout: defaultDNSBLTimeout}
+	for _, zone := range strings.Split(os.Getenv("GO_SUBNET_CALCULATOR_DNSBL"), ",") {
+		if zone = strings.Trim(strings.TrimSpace(zone), "."); zone != "" {
+			c.zones = append(c.zones, zone)
+		}
+	}
+	for _, path := range strings.Split(os.Getenv("GO_SUBNET_CALCULATOR_BLOCKLISTS"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		list, err := loadBlocklist(path)
+		if err != nil {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_BLOCKLISTS: %v", err)
+		}
+		c.files = append(c.files, list)
+		recordSystemAudit("config.reputation", path, "loaded %d blocklist entries", len(list.prefixes))
+	}
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_DNSBL_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 || d > time.Minute {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_DNSBL_TIMEOUT must be a duration of at most 1m, got %q", value)
+		}
+		c.timeout = d
+	}
+	if len(c.zones) == 0 && len(c.files) == 0 {
+		recordSystemAudit("config.reputation", "", "reputation checks disabled")
+		return nil
+	}
+	resolver, ok := ptr.resolver.(dnsblResolver)
+	if !ok {
+		resolver = net.DefaultResolver
+	}
+	c.resolver = resolver
+	reputation.Store(c)
+	if len(c.zones) > 0 {
+		recordSystemAudit("config.reputation", strings.Join(c.zones, ","), "DNSBL checks, timeout %s", c.timeout)
+	}
+	return nil
+}
+
+// Check consults every list. DNSBLs are queried concurrently and only for public
+// addresses, which are the only ones they list
+func (c *reputationChecks) Check(ctx context.Context, ip net.IP) *Reputation {
+	rep := &Reputation{Hits: []ReputationHit{}}
+	for _, list := range c.files {
+		rep.Checked++
+		if entry := list.match(ip); entry != nil {
+			rep.Hits = append(rep.Hits, ReputationHit{List: list.name, Entry: entry.String()})
+		}
+	}
+	if isPublicIPv4(ip) && len(c.zones) > 0 {
+		ctx, cancel := context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+		hits := make([]*ReputationHit, len(c.zones))
+		errs := make([]error, len(c.zones))
+		var wg sync.WaitGroup
+		for i, zone := range c.zones {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				hits[i], errs[i] = c.queryDNSBL(ctx, zone, ip)
+			}()
+		}
+		wg.Wait()
+		for i, zone := range c.zones {
+			rep.Checked++
+			switch {
+			case errs[i] != nil:
+				rep.Errors = append(rep.Errors, fmt.Sprintf("%s: %v", zone, errs[i]))
+			case hits[i] != nil:
+				rep.Hits = append(rep.Hits, *hits[i])
+			}
+		}
+	}
+	rep.Listed = len(rep.Hits) > 0
+	return rep
+}
+
+// queryDNSBL looks ip up in a DNSBL zone. A name that does not exist means the
+// address is not listed. Answers outside 127.0.0.0/8 are errors, and so are those in
+// 127.255.255.0/24, which lists such as Spamhaus use to refuse queries from public
+// resolvers
+func (c *reputationChecks) queryDNSBL(ctx context.Context, zone string, ip net.IP) (*ReputationHit, error) {
+	ip = ip.To4()
+	name := fmt.Sprintf("%d.%d.%d.%d.%s", ip[3], ip[2], ip[1], ip[0], zone)
+	addrs, err := c.resolver.LookupHost(ctx, name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	hit := &ReputationHit{List: zone}
+	for _, a := range addrs {
+		code := net.ParseIP(a).To4()
+		if code != nil && code[0] == 127 && code[1] == 255 && code[2] == 255 {
+			return nil, fmt.Errorf("query refused (%s)", a)
+		}
+		if code != nil && code[0] == 127 {
+			hit.Entry = a
+			break
+		}
+	}
+	if hit.Entry == "" {
+		return nil, fmt.Errorf("unexpected answer %s", strings.Join(addrs, ", "))
+	}
+	if reasons, err := c.resolver.LookupTXT(ctx, name); err == nil {
+		hit.Reason = strings.Join(reasons, " ")
+	}
+	return hit, nil
+}
+
+// checkReputation returns the blocklist hits of an address when reputation checks
+// are configured, or nil
+func checkReputation(ctx context.Context, address string) *Reputation {
+	ip := net.ParseIP(address).To4()
+	checks := reputation.Load()
+	if checks == nil || ip == nil {
+		return nil
+	}
+	ctx, span := startSpan(ctx, "reputation.check", spanKindClient)
+	result := checks.Check(ctx, ip)
+	span.Set("reputation.listed", result.Listed)
+	span.End(nil)
+	return result
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeDNSBLResolver answers A and TXT lookups from maps and reports other names as
+// not found, except names of the failing zone
+type fakeDNSBLResolver struct {
+	hosts map[string][]string
+	txt   map[string][]string
+}
+
+func (f *fakeDNSBLResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := f.hosts[host]; ok {
+		return addrs, nil
+	}
+	if filepath.Ext(host) == ".broken" {
+		return nil, &net.DNSError{Err: "server misbehaving", Name: host}
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (f *fakeDNSBLResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return f.txt[name], nil
+}
+
+// withTestReputation checks the given DNSBL zones through resolver and the blocklist
+// file written with content
+func withTestReputation(t *testing.T, resolver dnsblResolver, zones []string, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "blocklist.netset")
+	os.WriteFile(path, []byte(content), 0o644)
+	list, err := loadBlocklist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := reputation.Load()
+	reputation.Store(&reputationChecks{resolver: resolver, timeout: defaultDNSBLTimeout, zones: zones, files: []*blocklistFile{list}})
+	t.Cleanup(func() { reputation.Store(previous) })
+}
+
+func TestReputationCheck(t *testing.T) {
+	withTestReputation(t, &fakeDNSBLResolver{
+		hosts: map[string][]string{
+			"2.0.0.127.zen.example":   {"127.0.0.2", "127.0.0.4"},
+			"9.9.9.9.refused.example": {"127.255.255.254"},
+			"9.9.9.9.odd.example":     {"10.0.0.1"},
+		},
+		txt: map[string][]string{"2.0.0.127.zen.example": {"https://zen.example/query/ip/127.0.0.2"}},
+	}, []string{"zen.example", "refused.example", "odd.example", "failing.broken"}, "# FireHOL style\n1.2.3.0/24 ; drop list SBL1\n10.9.8.7\n2001:db8::/32\n")
+
+	rep := checkReputation(context.Background(), "1.2.3.4")
+	if !rep.Listed || len(rep.Hits) != 1 || rep.Hits[0].Entry != "1.2.3.0/24" || rep.Checked != 5 || len(rep.Errors) != 1 {
+		t.Errorf("checkReputation(1.2.3.4) = %+v", rep)
+	}
+	// private addresses are only matched against local files
+	if rep := checkReputation(context.Background(), "10.9.8.7"); !rep.Listed || rep.Checked != 1 {
+		t.Errorf("checkReputation(10.9.8.7) = %+v", rep)
+	}
+	if rep := checkReputation(context.Background(), "9.9.9.9"); rep.Listed || len(rep.Errors) != 3 {
+		t.Errorf("checkReputation(9.9.9.9) = %+v, want a refusal, an unexpected answer and a failure", rep)
+	}
+
+	hit, err := reputation.Load().queryDNSBL(context.Background(), "zen.example", net.ParseIP("127.0.0.2"))
+	if err != nil || hit == nil || hit.Entry != "127.0.0.2" || hit.Reason == "" {
+		t.Errorf("queryDNSBL = %+v, %v", hit, err)
+	}
+
+	rr := httptest.NewRecorder()
+	calculateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=1.2.3.99&mask=/24", nil))
+	var result SubnetResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || result.Reputation == nil || !result.Reputation.Listed {
+		t.Errorf("calculate reputation = %+v, %v", result.Reputation, err)
+	}
+}
+
+func TestConfigureReputation(t *testing.T) {
+	withTestAudit(t)
+	previous := reputation.Load()
+	t.Cleanup(func() { reputation.Store(previous) })
+
+	if err := configureReputation(); err != nil || reputation.Load() != nil {
+		t.Errorf("unconfigured = %+v, %v; want disabled", reputation.Load(), err)
+	}
+	t.Setenv("GO_SUBNET_CALCULATOR_DNSBL", " zen.example. , bl.example")
+	if err := configureReputation(); err != nil || len(reputation.Load().zones) != 2 || reputation.Load().zones[0] != "zen.example" {
+		t.Errorf("DNSBL zones = %+v, %v", reputation.Load(), err)
+	}
+
+	path := filepath.Join(t.TempDir(), "bad.txt")
+	os.WriteFile(path, []byte("not-a-prefix\n"), 0o644)
+	t.Setenv("GO_SUBNET_CALCULATOR_BLOCKLISTS", path)
+	if err := configureReputation(); err == nil {
+		t.Error("expected an error for an invalid blocklist entry")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength bounds IDs taken from clients, which end up in every log line
+	maxRequestIDLength = 128
+)
+
+type requestIDKey struct{}
+
+// validRequestID accepts IDs of printable ASCII without spaces, so a client cannot
+// break up log lines with one
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns 128 random bits in hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// withRequestID gives every request an ID: the client's X-Request-ID when it sends a
+// valid one, a random one otherwise. The ID is returned in the X-Request-ID response
+// header, in JSON error responses and in the log lines of the request
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestID returns the ID of the request ctx belongs to, or ""
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logRequestf logs a line of the request ctx belongs to, prefixed with its ID
+func logRequestf(ctx context.Context, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if id := requestID(ctx); id != "" {
+		message = "[" + id + "] " + message
+	}
+	log.Print(message)
+}
+
+// logInfof is logRequestf for informational lines, which are dropped at log level warn
+func logInfof(ctx context.Context, format string, args ...interface{}) {
+	if currentSettings().LogLevel == "warn" {
+		return
+	}
+	logRequestf(ctx, format, args...)
+}
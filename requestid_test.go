@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithRequestID(t *testing.T) {
+	var logged bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(previous) })
+	h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logRequestf(r.Context(), "handling %s", r.URL.Path)
+		writeJSONError(w, http.StatusBadRequest, "ip and mask are required")
+	}))
+	call := func(id string) (*httptest.ResponseRecorder, ErrorResponse) {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/calculate", nil)
+		if id != "" {
+			r.Header.Set("X-Request-ID", id)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		var resp ErrorResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr, resp
+	}
+
+	rr, resp := call("")
+	generated := rr.Header().Get("X-Request-ID")
+	if len(generated) != 32 || resp.RequestID != generated || !strings.Contains(logged.String(), "["+generated+"] handling /api/v1/calculate") {
+		t.Errorf("generated ID %q, error response %+v, log %q", generated, resp, logged.String())
+	}
+	if rr, _ := call(""); rr.Header().Get("X-Request-ID") == generated {
+		t.Error("two requests got the same ID")
+	}
+	if rr, resp := call("lb-7f3a.42"); rr.Header().Get("X-Request-ID") != "lb-7f3a.42" || resp.RequestID != "lb-7f3a.42" {
+		t.Errorf("client ID not kept: %v %+v", rr.Header(), resp)
+	}
+	for _, id := range []string{"two words", "line\nbreak", strings.Repeat("x", maxRequestIDLength+1)} {
+		if rr, _ := call(id); rr.Header().Get("X-Request-ID") == id || len(rr.Header().Get("X-Request-ID")) != 32 {
+			t.Errorf("invalid ID %q was accepted", id)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// RouteAnalysisRequest holds a routing table to analyze; Format is detected when empty
+type RouteAnalysisRequest struct {
+	Table  string `json:"table"`
+	Format string `json:"format,omitempty"`
+}
+
+// SummaryOpportunity is a set of routes with the same next hop that can be replaced by one summary.
+// Safe is false when a route with another next hop already uses the summary prefix or sits
+// between the summary and a component, in which case installing the summary would change forwarding
+type SummaryOpportunity struct {
+	Summary    string   `json:"summary"`
+	NextHop    string   `json:"next_hop"`
+	Components []string `json:"components"`
+	Safe       bool     `json:"safe"`
+}
+
+// RouteOverlap describes a route that lies inside a less specific route
+type RouteOverlap struct {
+	Prefix           string `json:"prefix"`
+	NextHop          string `json:"next_hop"`
+	CoveredBy        string `json:"covered_by"`
+	CoveredByNextHop string `json:"covered_by_next_hop"`
+	Redundant        bool   `json:"redundant"`
+}
+
+// RouteReport is the outcome of a routing table analysis
+type RouteReport struct {
+	Format           string               `json:"format"`
+	Routes           int                  `json:"routes"`
+	UniquePrefixes   int                  `json:"unique_prefixes"`
+	Duplicates       []string             `json:"duplicates"`
+	DefaultRoute     *Route               `json:"default_route,omitempty"`
+	Summaries        []SummaryOpportunity `json:"summaries"`
+	Overlaps         []RouteOverlap       `json:"overlaps"`
+	CoveredByDefault []*Route             `json:"covered_by_default"`
+	SummarizedSize   int                  `json:"summarized_size"`
+}
+
+// analyzeRoutes builds a report of summarization opportunities, overlaps and
+// routes made redundant by the default route
+func analyzeRoutes(routes []*Route, format string) (*RouteReport, error) {
+	trie, err := buildRouteTrie(routes)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RouteReport{
+		Format:           format,
+		Routes:           len(routes),
+		UniquePrefixes:   trie.Len(),
+		Duplicates:       []string{},
+		Summaries:        []SummaryOpportunity{},
+		Overlaps:         []RouteOverlap{},
+		CoveredByDefault: []*Route{},
+	}
+
+	// Only the route that won in the trie is analyzed for each prefix
+	seen := map[string]bool{}
+	var unique []*Route
+	networks := map[*Route]*net.IPNet{}
+	for _, route := range routes {
+		if seen[route.Prefix] {
+			report.Duplicates = append(report.Duplicates, route.Prefix)
+			continue
+		}
+		seen[route.Prefix] = true
+		network, _ := parseIPv4Prefix(route.Prefix)
+		for _, r := range matchingRoutes(trie, network.IP) {
+			if r.Prefix == route.Prefix {
+				unique = append(unique, r)
+				networks[r] = network
+			}
+		}
+	}
+	if d := lookupRoute(trie, net.IPv4zero); d != nil && d.Prefix == "0.0.0.0/0" {
+		report.DefaultRoute = d
+	}
+
+	for _, route := range unique {
+		parent := coveringRoute(trie, networks[route])
+		if parent == nil {
+			continue
+		}
+		redundant := parent.NextHop == route.NextHop
+		report.Overlaps = append(report.Overlaps, RouteOverlap{
+			Prefix:           route.Prefix,
+			NextHop:          route.NextHop,
+			CoveredBy:        parent.Prefix,
+			CoveredByNextHop: parent.NextHop,
+			Redundant:        redundant,
+		})
+		if redundant && parent == report.DefaultRoute {
+			report.CoveredByDefault = append(report.CoveredByDefault, route)
+		}
+	}
+
+	// Group by next hop and aggregate each group exactly
+	groups := map[string][]*Route{}
+	var hops []string
+	for _, route := range unique {
+		if _, ok := groups[route.NextHop]; !ok {
+			hops = append(hops, route.NextHop)
+		}
+		groups[route.NextHop] = append(groups[route.NextHop], route)
+	}
+	sort.Strings(hops)
+
+	for _, hop := range hops {
+		group := groups[hop]
+		members := make([]*net.IPNet, len(group))
+		for i, route := range group {
+			members[i] = networks[route]
+		}
+		summaries := cidrset.New(members...).Prefixes()
+		report.SummarizedSize += len(summaries)
+
+		for _, summary := range summaries {
+			var components []*Route
+			for _, route := range group {
+				if prefixContains(summary, networks[route]) {
+					components = append(components, route)
+				}
+			}
+			if len(components) < 2 || components[0].Prefix == summary.String() {
+				continue
+			}
+
+			opportunity := SummaryOpportunity{Summary: summary.String(), NextHop: hop, Safe: true}
+			summaryLen, _ := summary.Mask.Size()
+			for _, component := range components {
+				opportunity.Components = append(opportunity.Components, component.Prefix)
+				for _, r := range matchingRoutes(trie, networks[component].IP) {
+					length, _ := networks[r].Mask.Size()
+					componentLen, _ := networks[component].Mask.Size()
+					if r.NextHop != hop && length >= summaryLen && length < componentLen {
+						opportunity.Safe = false
+					}
+				}
+			}
+			report.Summaries = append(report.Summaries, opportunity)
+		}
+	}
+
+	return report, nil
+}
+
+// coveringRoute returns the most specific route strictly less specific than network, if any
+func coveringRoute(trie *routeTrie, network *net.IPNet) *Route {
+	ones, _ := network.Mask.Size()
+	var parent *Route
+	for _, r := range matchingRoutes(trie, network.IP) {
+		if p, _ := parseIPv4Prefix(r.Prefix); p != nil {
+			if length, _ := p.Mask.Size(); length < ones {
+				parent = r
+			}
+		}
+	}
+	return parent
+}
+
+// routeAnalysisHandler serves POST /api/v1/routes/analyze; with ?async=true the analysis of
+// a large table runs as a job
+func routeAnalysisHandler(w http.ResponseWriter, r *http.Request) {
+	var req RouteAnalysisRequest
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+
+	async, ok := asyncRequested(w, r)
+	if !ok {
+		return
+	}
+	routes, format, err := parseRoutes(req.Table, req.Format)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if async {
+		submitJob(w, r, "routes", 0, func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+			return analyzeRoutes(routes, format)
+		})
+		return
+	}
+	report, err := analyzeRoutes(routes, format)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeRoutes(t *testing.T) {
+	table := `0.0.0.0/0 via 192.0.2.1
+10.0.0.0/24 via 192.0.2.2
+10.0.1.0/24 via 192.0.2.2
+10.0.2.0/24 via 192.0.2.2
+10.0.3.0/24 via 192.0.2.2
+10.0.2.0/25 via 192.0.2.2
+172.16.0.0/24 via 192.0.2.1
+192.168.0.0/24 via 192.0.2.3
+192.168.1.0/24 via 192.0.2.3
+192.168.0.0/23 via 192.0.2.9
+192.168.0.0/24 via 192.0.2.3
+`
+	routes, format, err := parseRoutes(table, "")
+	if err != nil {
+		t.Fatalf("parseRoutes() unexpected error: %v", err)
+	}
+	report, err := analyzeRoutes(routes, format)
+	if err != nil {
+		t.Fatalf("analyzeRoutes() unexpected error: %v", err)
+	}
+
+	if report.Format != "flat" || report.Routes != 11 || report.UniquePrefixes != 10 {
+		t.Errorf("counts = %s/%d/%d, want flat/11/10", report.Format, report.Routes, report.UniquePrefixes)
+	}
+	if !reflect.DeepEqual(report.Duplicates, []string{"192.168.0.0/24"}) {
+		t.Errorf("duplicates = %v", report.Duplicates)
+	}
+	if report.DefaultRoute == nil || report.DefaultRoute.NextHop != "192.0.2.1" {
+		t.Errorf("default route = %+v", report.DefaultRoute)
+	}
+
+	summaries := map[string]SummaryOpportunity{}
+	for _, s := range report.Summaries {
+		summaries[s.Summary] = s
+	}
+	if s, ok := summaries["10.0.0.0/22"]; !ok || len(s.Components) != 5 || !s.Safe {
+		t.Errorf("10.0.0.0/22 summary = %+v, want 5 safe components", s)
+	}
+	if s, ok := summaries["192.168.0.0/23"]; !ok || s.Safe {
+		t.Errorf("192.168.0.0/23 summary = %+v, want unsafe (shadowed by a route to 192.0.2.9)", s)
+	}
+
+	overlaps := map[string]RouteOverlap{}
+	for _, o := range report.Overlaps {
+		overlaps[o.Prefix] = o
+	}
+	if o := overlaps["10.0.2.0/25"]; o.CoveredBy != "10.0.2.0/24" || !o.Redundant {
+		t.Errorf("10.0.2.0/25 overlap = %+v, want redundant under 10.0.2.0/24", o)
+	}
+	if o := overlaps["192.168.0.0/24"]; o.CoveredBy != "192.168.0.0/23" || o.Redundant {
+		t.Errorf("192.168.0.0/24 overlap = %+v, want non-redundant under 192.168.0.0/23", o)
+	}
+
+	if len(report.CoveredByDefault) != 1 || report.CoveredByDefault[0].Prefix != "172.16.0.0/24" {
+		t.Errorf("covered by default = %+v, want 172.16.0.0/24", report.CoveredByDefault)
+	}
+}
+
+func TestRouteAnalysisHandler(t *testing.T) {
+	body, _ := json.Marshal(RouteAnalysisRequest{Table: ciscoRouteSample})
+	rr := httptest.NewRecorder()
+	routeAnalysisHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/routes/analyze", strings.NewReader(string(body))))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body: %s)", rr.Code, http.StatusOK, rr.Body.String())
+	}
+	var report RouteReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if report.Format != "cisco" || report.Routes != 7 {
+		t.Errorf("report = %+v", report)
+	}
+	found := false
+	for _, s := range report.Summaries {
+		if s.Summary == "172.16.1.0/24" || s.Summary == "172.16.2.0/23" {
+			found = true
+		}
+	}
+	if found {
+		t.Errorf("172.16.1.0/24 and 172.16.2.0/24 are not aligned and cannot be summarized: %+v", report.Summaries)
+	}
+
+	for _, body := range []string{`{"table":"10.0.0.0/8 a","format":"junos"}`, `{"table":"garbage/99 x","format":"flat"}`} {
+		rr := httptest.NewRecorder()
+		routeAnalysisHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/routes/analyze", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("body %s: status = %d, want %d", body, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
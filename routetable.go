@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// routeParsers maps a routing table format name to its parser
+var routeParsers = map[string]func(table string) ([]*Route, error){
+	"flat":  parseFlatRoutes,
+	"cisco": parseCiscoRoutes,
+	"bird":  parseBIRDRoutes,
+}
+
+var (
+	ciscoRouteLine    = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9*+%]*(?:\s[A-Za-z0-9]{1,2}\*?)?)\s+(\d{1,3}(?:\.\d{1,3}){3})(/\d{1,2})?\s*(.*)$`)
+	ciscoSubnetHeader = regexp.MustCompile(`^(\d{1,3}(?:\.\d{1,3}){3})(/\d{1,2})?\s+is\s+(variably\s+)?subnetted`)
+	ciscoMultipath    = regexp.MustCompile(`^\[\d+/\d+\]\s+via\s+([^,\s]+)`)
+	ciscoVia          = regexp.MustCompile(`via\s+([^,\s]+)`)
+	birdRouteLine     = regexp.MustCompile(`^(\d{1,3}(?:\.\d{1,3}){3}/\d{1,2})\s+(.*)$`)
+	birdProtocol      = regexp.MustCompile(`\[(\w+)`)
+)
+
+// parseRoutes parses a routing table in the given format, detecting the format when
+// empty, and returns the routes together with the format that was used
+func parseRoutes(table, format string) ([]*Route, string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = detectRouteFormat(table)
+	}
+	parser, ok := routeParsers[format]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported routing table format: %s", format)
+	}
+	routes, err := parser(table)
+	return routes, format, err
+}
+
+// detectRouteFormat guesses the format of a pasted routing table
+func detectRouteFormat(table string) string {
+	scanner := bufio.NewScanner(strings.NewReader(table))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "Gateway of last resort"), strings.HasPrefix(line, "Codes:"):
+			return "cisco"
+		case strings.HasPrefix(line, "Table ") && strings.HasSuffix(line, ":"), strings.HasPrefix(line, "BIRD "):
+			return "bird"
+		case birdRouteLine.MatchString(line) && birdProtocol.MatchString(line):
+			return "bird"
+		case ciscoRouteLine.MatchString(line) && !birdRouteLine.MatchString(line):
+			return "cisco"
+		}
+	}
+	return "flat"
+}
+
+// parseFlatRoutes reads "prefix next-hop" lines; "via" between the two is optional,
+// blank lines and lines starting with # are ignored
+func parseFlatRoutes(table string) ([]*Route, error) {
+	var routes []*Route
+	scanner := bufio.NewScanner(strings.NewReader(table))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) > 1 && strings.EqualFold(fields[1], "via") {
+			fields = append(fields[:1], fields[2:]...)
+		}
+		network, err := parseIPv4Prefix(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+
+		nextHop := ""
+		if len(fields) > 1 {
+			nextHop = strings.Join(fields[1:], " ")
+		}
+		routes = append(routes, &Route{Prefix: network.String(), NextHop: nextHop, Line: lineNo})
+	}
+	return routes, scanner.Err()
+}
+
+// classfulPrefixLen returns the historic class A/B/C mask length of an address
+func classfulPrefixLen(ip net.IP) int {
+	switch first := ip.To4()[0]; {
+	case first < 128:
+		return 8
+	case first < 192:
+		return 16
+	default:
+		return 24
+	}
+}
+
+// parseCiscoRoutes reads IOS "show ip route" output. Legend lines are skipped, masks
+// missing under "is subnetted" headers are filled in and ECMP continuation lines are
+// folded into the preceding route
+func parseCiscoRoutes(table string) ([]*Route, error) {
+	var routes []*Route
+	var last *Route
+	subnetMask := 0
+	scanner := bufio.NewScanner(strings.NewReader(table))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "Codes:") || strings.HasPrefix(line, "Gateway of last resort") ||
+			strings.Contains(line, " - ") && !ciscoVia.MatchString(line) {
+			continue
+		}
+
+		if m := ciscoSubnetHeader.FindStringSubmatch(line); m != nil {
+			subnetMask = 0
+			if m[3] == "" && m[2] != "" {
+				subnetMask, _ = strconv.Atoi(m[2][1:])
+			}
+			continue
+		}
+
+		if m := ciscoMultipath.FindStringSubmatch(line); m != nil && last != nil {
+			last.NextHop += "," + m[1]
+			continue
+		}
+
+		m := ciscoRouteLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		prefix := m[2] + m[3]
+		if m[3] == "" {
+			length := subnetMask
+			if length == 0 {
+				length = classfulPrefixLen(net.ParseIP(m[2]))
+			}
+			prefix = m[2] + "/" + strconv.Itoa(length)
+		}
+		network, err := parseIPv4Prefix(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+
+		rest := m[4]
+		nextHop := ""
+		switch {
+		case ciscoVia.MatchString(rest):
+			nextHop = ciscoVia.FindStringSubmatch(rest)[1]
+		case strings.Contains(rest, "directly connected"):
+			nextHop = "connected " + lastField(rest)
+		default:
+			nextHop = lastField(rest)
+		}
+
+		last = &Route{Prefix: network.String(), NextHop: nextHop, Protocol: strings.TrimSuffix(strings.Fields(m[1])[0], "*"), Line: lineNo}
+		routes = append(routes, last)
+	}
+	return routes, scanner.Err()
+}
+
+// parseBIRDRoutes reads BIRD 1.x and 2.x "show route" output. Only the first route
+// listed for a prefix is kept; multipath "via" lines are folded into it
+func parseBIRDRoutes(table string) ([]*Route, error) {
+	var routes []*Route
+	var last *Route
+	scanner := bufio.NewScanner(strings.NewReader(table))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+
+		if m := birdRouteLine.FindStringSubmatch(line); m != nil && !strings.HasPrefix(raw, " ") && !strings.HasPrefix(raw, "\t") {
+			network, err := parseIPv4Prefix(m[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			last = &Route{Prefix: network.String(), NextHop: birdNextHop(m[2]), Line: lineNo}
+			if p := birdProtocol.FindStringSubmatch(m[2]); p != nil {
+				last.Protocol = p[1]
+			}
+			routes = append(routes, last)
+			continue
+		}
+
+		// Indented lines either add a next hop to the current route (BIRD 2 and multipath)
+		// or describe an alternative, non-best route (which carries its own protocol)
+		if birdProtocol.MatchString(line) {
+			last = nil
+			continue
+		}
+		if last == nil {
+			continue
+		}
+		if hop := birdNextHop(line); hop != "" {
+			if last.NextHop == "" {
+				last.NextHop = hop
+			} else {
+				last.NextHop += "," + hop
+			}
+		}
+	}
+	return routes, scanner.Err()
+}
+
+// birdNextHop extracts the gateway, interface or route type from the rest of a BIRD line
+func birdNextHop(rest string) string {
+	fields := strings.Fields(rest)
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "via":
+			return fields[i+1]
+		case "dev":
+			return "dev " + fields[i+1]
+		}
+	}
+	for _, kind := range []string{"blackhole", "unreachable", "prohibit"} {
+		if strings.Contains(rest, kind) {
+			return kind
+		}
+	}
+	return ""
+}
+
+// lastField returns the last comma- or space-separated token of s
+func lastField(s string) string {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+// routeFormats lists the supported routing table format names
+func routeFormats() []string {
+	names := make([]string, 0, len(routeParsers))
+	for name := range routeParsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+)
+
+const ciscoRouteSample = `Codes: L - local, C - connected, S - static, R - RIP, M - mobile, B - BGP
+       D - EIGRP, EX - EIGRP external, O - OSPF, IA - OSPF inter area
+       N1 - OSPF NSSA external type 1, N2 - OSPF NSSA external type 2
+
+Gateway of last resort is 192.0.2.1 to network 0.0.0.0
+
+S*    0.0.0.0/0 [1/0] via 192.0.2.1
+      10.0.0.0/8 is variably subnetted, 4 subnets, 2 masks
+C        10.1.1.0/24 is directly connected, GigabitEthernet0/1
+L        10.1.1.1/32 is directly connected, GigabitEthernet0/1
+O IA     10.2.0.0/16 [110/2] via 10.1.1.2, 00:01:02, GigabitEthernet0/1
+                     [110/2] via 10.1.1.3, 00:01:02, GigabitEthernet0/1
+O E2     10.3.0.0/16 [110/20] via 10.1.1.2, 00:01:02, GigabitEthernet0/1
+      172.16.0.0/24 is subnetted, 2 subnets
+B        172.16.1.0 [20/0] via 198.51.100.1, 1d02h
+B        172.16.2.0 [20/0] via 198.51.100.1, 1d02h
+`
+
+const birdRouteSample = `BIRD 2.0.7 ready.
+Table master4:
+0.0.0.0/0            unicast [static1 2024-01-01] * (200)
+	via 192.0.2.1 on eth0
+10.0.0.0/24          unicast [ospf1 2024-01-01] * I (150/20) [10.0.0.1]
+	via 192.0.2.2 on eth1
+	via 192.0.2.3 on eth2
+10.0.1.0/24          unicast [bgp1 2024-01-01] * (100) [AS65001i]
+	via 192.0.2.2 on eth1
+                     unicast [bgp2 2024-01-01] (100) [AS65002i]
+	via 192.0.2.9 on eth3
+192.168.1.0/24       unicast [direct1 2024-01-01] * (240)
+	dev eth0
+203.0.113.0/24       blackhole [static2 2024-01-01] * (200)
+`
+
+func TestDetectRouteFormat(t *testing.T) {
+	tests := map[string]string{
+		ciscoRouteSample:                      "cisco",
+		birdRouteSample:                       "bird",
+		"10.0.0.0/8 via 192.0.2.1":            "flat",
+		"O    10.0.0.0/8 [110/2] via 1.1.1.1": "cisco",
+		"10.0.0.0/8 via 192.0.2.1 on eth0 [bgp1 12:00:00] * (100)": "bird",
+	}
+	for table, expected := range tests {
+		if got := detectRouteFormat(table); got != expected {
+			t.Errorf("detectRouteFormat(%q) = %s, want %s", table, got, expected)
+		}
+	}
+}
+
+func TestParseCiscoRoutes(t *testing.T) {
+	routes, err := parseCiscoRoutes(ciscoRouteSample)
+	if err != nil {
+		t.Fatalf("parseCiscoRoutes() unexpected error: %v", err)
+	}
+
+	expected := []Route{
+		{Prefix: "0.0.0.0/0", NextHop: "192.0.2.1", Protocol: "S"},
+		{Prefix: "10.1.1.0/24", NextHop: "connected GigabitEthernet0/1", Protocol: "C"},
+		{Prefix: "10.1.1.1/32", NextHop: "connected GigabitEthernet0/1", Protocol: "L"},
+		{Prefix: "10.2.0.0/16", NextHop: "10.1.1.2,10.1.1.3", Protocol: "O"},
+		{Prefix: "10.3.0.0/16", NextHop: "10.1.1.2", Protocol: "O"},
+		{Prefix: "172.16.1.0/24", NextHop: "198.51.100.1", Protocol: "B"},
+		{Prefix: "172.16.2.0/24", NextHop: "198.51.100.1", Protocol: "B"},
+	}
+	if len(routes) != len(expected) {
+		t.Fatalf("parseCiscoRoutes() returned %d routes, want %d: %+v", len(routes), len(expected), routes)
+	}
+	for i, want := range expected {
+		got := routes[i]
+		if got.Prefix != want.Prefix || got.NextHop != want.NextHop || got.Protocol != want.Protocol {
+			t.Errorf("route %d = %+v, want %+v", i, *got, want)
+		}
+	}
+}
+
+func TestParseBIRDRoutes(t *testing.T) {
+	routes, err := parseBIRDRoutes(birdRouteSample)
+	if err != nil {
+		t.Fatalf("parseBIRDRoutes() unexpected error: %v", err)
+	}
+
+	expected := []Route{
+		{Prefix: "0.0.0.0/0", NextHop: "192.0.2.1", Protocol: "static1"},
+		{Prefix: "10.0.0.0/24", NextHop: "192.0.2.2,192.0.2.3", Protocol: "ospf1"},
+		{Prefix: "10.0.1.0/24", NextHop: "192.0.2.2", Protocol: "bgp1"},
+		{Prefix: "192.168.1.0/24", NextHop: "dev eth0", Protocol: "direct1"},
+		{Prefix: "203.0.113.0/24", NextHop: "blackhole", Protocol: "static2"},
+	}
+	if len(routes) != len(expected) {
+		t.Fatalf("parseBIRDRoutes() returned %d routes, want %d: %+v", len(routes), len(expected), routes)
+	}
+	for i, want := range expected {
+		got := routes[i]
+		if got.Prefix != want.Prefix || got.NextHop != want.NextHop || got.Protocol != want.Protocol {
+			t.Errorf("route %d = %+v, want %+v", i, *got, want)
+		}
+	}
+}
+
+func TestParseRoutesUnknownFormat(t *testing.T) {
+	if _, _, err := parseRoutes("10.0.0.0/8 x", "junos"); err == nil {
+		t.Error("parseRoutes() with unknown format expected error, got nil")
+	}
+	if len(routeFormats()) != 3 {
+		t.Errorf("routeFormats() = %v", routeFormats())
+	}
+}
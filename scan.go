@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+const (
+	defaultScanRate    = 50
+	maxScanRate        = 1000
+	defaultScanTimeout = time.Second
+	scanWorkers        = 32
+	// maxScanHosts bounds the hosts probed by one scan, a /22
+	maxScanHosts = 1024
+	maxScanPorts = 16
+
+	scanTCP  = "tcp"
+	scanICMP = "icmp"
+)
+
+var defaultScanPorts = []int{22, 80, 443}
+
+// ScanRequest asks for the hosts of a prefix that respond to TCP connects on Ports
+// (the configured ports when empty) or to ICMP echo
+type ScanRequest struct {
+	Prefix string `json:"prefix"`
+	Method string `json:"method,omitempty"`
+	Ports  []int  `json:"ports,omitempty"`
+}
+
+// ScanHost is a responding host and the probe it answered: icmp, or tcp/port for an
+// accepted or refused connection, since a refusal also comes from a live host
+type ScanHost struct {
+	Address string  `json:"address"`
+	Via     string  `json:"via"`
+	RTT     float64 `json:"rtt_ms"`
+}
+
+// ScanResponse lists the responding hosts in address order
+type ScanResponse struct {
+	Prefix     string     `json:"prefix"`
+	Method     string     `json:"method"`
+	Ports      []int      `json:"ports,omitempty"`
+	Probed     int        `json:"probed"`
+	Responding int        `json:"responding"`
+	Hosts      []ScanHost `json:"hosts"`
+}
+
+// rateLimiter spaces events evenly at a number per second, shared by every scan
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond int) *rateLimiter {
+	return &rateLimiter{interval: time.Second / time.Duration(perSecond)}
+}
+
+// Wait blocks until the next event may happen or ctx is done
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	at := time.Now()
+	if l.next.After(at) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hostProber probes one host, returning the probe it answered or "" when it did not
+// respond. An error means the scan cannot go on, such as a missing privilege
+type hostProber func(ctx context.Context, ip net.IP, method string, ports []int) (string, error)
+
+// hostScanner probes the hosts of allowed prefixes at a limited rate
+type hostScanner struct {
+	allowed *cidrset.Set
+	ports   []int
+	timeout time.Duration
+	rate    int
+	limiter *rateLimiter
+	probe   hostProber
+}
+
+// newHostScan builds the scanner from GO_SUBNET_CALCULATOR_SCAN, which enables
+// scanning, GO_SUBNET_CALCULATOR_SCAN_ALLOWED (the prefixes that may be scanned, RFC
+// 1918 space by default), GO_SUBNET_CALCULATOR_SCAN_PORTS, GO_SUBNET_CALCULATOR_SCAN_RATE
+// (probes per second over all scans) and GO_SUBNET_CALCULATOR_SCAN_TIMEOUT, as looked
+// up by setting. It returns nil while scanning is off
+func newHostScan(setting func(string) string) (*hostScanner, error) {
+	enabled := false
+	if value := setting("GO_SUBNET_CALCULATOR_SCAN"); value != "" {
+		var err error
+		if enabled, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("GO_SUBNET_CALCULATOR_SCAN must be true or false")
+		}
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	s := &hostScanner{ports: defaultScanPorts, timeout: defaultScanTimeout, rate: defaultScanRate}
+	s.probe = s.probeHost
+	allowed := "10.0.0.0/8,172.16.0.0/12,192.168.0.0/16"
+	if value := setting("GO_SUBNET_CALCULATOR_SCAN_ALLOWED"); value != "" {
+		allowed = value
+	}
+	var err error
+	if s.allowed, err = cidrset.Parse(strings.Split(allowed, ",")...); err != nil {
+		return nil, fmt.Errorf("GO_SUBNET_CALCULATOR_SCAN_ALLOWED: %v", err)
+	}
+	if value := setting("GO_SUBNET_CALCULATOR_SCAN_PORTS"); value != "" {
+		if s.ports, err = parseScanPorts(strings.Split(value, ",")); err != nil {
+			return nil, fmt.Errorf("GO_SUBNET_CALCULATOR_SCAN_PORTS: %v", err)
+		}
+	}
+	if value := setting("GO_SUBNET_CALCULATOR_SCAN_RATE"); value != "" {
+		if s.rate, err = strconv.Atoi(value); err != nil || s.rate < 1 || s.rate > maxScanRate {
+			return nil, fmt.Errorf("GO_SUBNET_CALCULATOR_SCAN_RATE must be between 1 and %d", maxScanRate)
+		}
+	}
+	s.limiter = newRateLimiter(s.rate)
+	if value := setting("GO_SUBNET_CALCULATOR_SCAN_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 || d > 10*time.Second {
+			return nil, fmt.Errorf("GO_SUBNET_CALCULATOR_SCAN_TIMEOUT must be a duration of at most 10s, got %q", value)
+		}
+		s.timeout = d
+	}
+	return s, nil
+}
+
+// parseScanPorts parses TCP port numbers
+func parseScanPorts(values []string) ([]int, error) {
+	if len(values) > maxScanPorts {
+		return nil, fmt.Errorf("at most %d ports can be probed", maxScanPorts)
+	}
+	ports := make([]int, 0, len(values))
+	for _, v := range values {
+		port, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port: %s", v)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// probeHost answers with the first port accepting or refusing a connection, or with
+// an ICMP echo reply
+func (s *hostScanner) probeHost(ctx context.Context, ip net.IP, method string, ports []int) (string, error) {
+	if method == scanICMP {
+		return s.icmpEcho(ctx, ip)
+	}
+	for _, port := range ports {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return "", err
+		}
+		dialCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		var d net.Dialer
+		conn, err := d.DialContext(dialCtx, "tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+		cancel()
+		if err == nil {
+			conn.Close()
+		}
+		if err == nil || errors.Is(err, syscall.ECONNREFUSED) {
+			return fmt.Sprintf("tcp/%d", port), nil
+		}
+	}
+	return "", ctx.Err()
+}
+
+// icmpEcho sends one echo request over a raw socket, which needs root or
+// CAP_NET_RAW, and waits for the reply
+func (s *hostScanner) icmpEcho(ctx context.Context, ip net.IP) (string, error) {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return "", err
+	}
+	conn, err := net.Dial("ip4:icmp", ip.String())
+	if err != nil {
+		return "", fmt.Errorf("ICMP needs a raw socket: %v", err)
+	}
+	defer conn.Close()
+	id, seq := uint16(os.Getpid()), uint16(ipToUint32(ip))
+	msg := []byte{8, 0, 0, 0, byte(id >> 8), byte(id), byte(seq >> 8), byte(seq)}
+	binary.BigEndian.PutUint16(msg[2:], icmpChecksum(msg))
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(msg); err != nil {
+		return "", nil
+	}
+	reply := make([]byte, 1500)
+	for {
+		n, err := conn.Read(reply)
+		if err != nil {
+			return "", nil
+		}
+		if n >= 8 && reply[0] == 0 && binary.BigEndian.Uint16(reply[4:]) == id && binary.BigEndian.Uint16(reply[6:]) == seq {
+			return scanICMP, nil
+		}
+	}
+}
+
+// icmpChecksum is the internet checksum of RFC 1071
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// scanHosts returns the addresses a scan of network probes: its usable hosts
+func scanHosts(network *net.IPNet) ([]net.IP, error) {
+	first, last := usableRange(network)
+	if uint64(last)-uint64(first)+1 > maxScanHosts {
+		return nil, fmt.Errorf("%s has more than %d hosts to scan", network, maxScanHosts)
+	}
+	hosts := make([]net.IP, 0, last-first+1)
+	for n := uint64(first); n <= uint64(last); n++ {
+		hosts = append(hosts, uint32ToIP(uint32(n)))
+	}
+	return hosts, nil
+}
+
+// Scan probes every host with a pool of workers, calling progress as probes finish
+func (s *hostScanner) Scan(ctx context.Context, req ScanRequest, hosts []net.IP, progress func(done, total int)) (*ScanResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]*ScanHost, len(hosts))
+	indexes := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var scanErr error
+	done := 0
+	for w := 0; w < min(scanWorkers, len(hosts)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				start := time.Now()
+				via, err := s.probe(ctx, hosts[i], req.Method, req.Ports)
+				mu.Lock()
+				if err != nil && scanErr == nil && ctx.Err() == nil {
+					scanErr = err
+					cancel()
+				}
+				if via != "" {
+					results[i] = &ScanHost{Address: hosts[i].String(), Via: via, RTT: float64(time.Since(start).Microseconds()) / 1000}
+				}
+				done++
+				progress(done, len(hosts))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range hosts {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if scanErr != nil {
+		return nil, scanErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	resp := &ScanResponse{Method: req.Method, Probed: len(hosts), Hosts: []ScanHost{}}
+	if req.Method == scanTCP {
+		resp.Ports = req.Ports
+	}
+	for _, h := range results {
+		if h != nil {
+			resp.Hosts = append(resp.Hosts, *h)
+		}
+	}
+	resp.Responding = len(resp.Hosts)
+	return resp, nil
+}
+
+// scanHandler serves POST /api/v1/scan. Scans always run as background jobs, need the
+// operator role in all tenants and are limited to the allowed prefixes
+func scanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	s := currentSettings().Scan
+	if s == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "host scanning is disabled; set GO_SUBNET_CALCULATOR_SCAN=true to enable it")
+		return
+	}
+	if err := requestPrincipal(r).checkGlobal(RoleOperator); err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	var req ScanRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	network, err := parseIPv4Prefix(req.Prefix)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !s.allowed.ContainsPrefix(network) {
+		writeIPAMError(w, fmt.Errorf("%w: %s is outside the prefixes allowed for scanning", errForbidden, network))
+		return
+	}
+	switch req.Method {
+	case "":
+		req.Method = scanTCP
+	case scanTCP, scanICMP:
+	default:
+		writeJSONError(w, http.StatusBadRequest, "method must be tcp or icmp")
+		return
+	}
+	if len(req.Ports) == 0 {
+		req.Ports = s.ports
+	}
+	if len(req.Ports) > maxScanPorts {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("at most %d ports can be probed", maxScanPorts))
+		return
+	}
+	for _, port := range req.Ports {
+		if port < 1 || port > 65535 {
+			writeJSONError(w, http.StatusBadRequest, "invalid port: "+strconv.Itoa(port))
+			return
+		}
+	}
+	hosts, err := scanHosts(network)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	recordAudit(r, "scan.start", network.String(), "%s scan of %d hosts", req.Method, len(hosts))
+	submitJob(w, r, "scan", len(hosts), func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+		resp, err := s.Scan(ctx, req, hosts, progress)
+		if err != nil {
+			return nil, err
+		}
+		resp.Prefix = network.String()
+		return resp, nil
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// withTestScan enables scanning of allowed with the given prober; nil probes for real
+func withTestScan(t *testing.T, allowed string, probe hostProber) *hostScanner {
+	t.Helper()
+	set, err := cidrset.Parse(allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &hostScanner{allowed: set, ports: defaultScanPorts, timeout: 200 * time.Millisecond, limiter: newRateLimiter(maxScanRate), probe: probe}
+	if probe == nil {
+		s.probe = s.probeHost
+	}
+	withTestSettings(t, &Settings{LogLevel: "info", Scan: s})
+	return s
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(100)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("6 events at 100/s took %s, want at least 50ms", elapsed)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l.next = time.Now().Add(time.Hour)
+	if err := l.Wait(ctx); err == nil {
+		t.Error("expected an error for a canceled context")
+	}
+}
+
+func TestScanTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+	s := withTestScan(t, "127.0.0.0/8", nil)
+
+	network, _ := parseIPv4Prefix("127.0.0.0/30")
+	hosts, _ := scanHosts(network)
+	resp, err := s.Scan(context.Background(), ScanRequest{Method: scanTCP, Ports: []int{port}}, hosts, func(done, total int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Probed != 2 || resp.Responding != 2 || resp.Hosts[0].Via != "tcp/"+strconv.Itoa(port) {
+		t.Errorf("scan = %+v, want both loopback hosts through tcp/%d", resp, port)
+	}
+}
+
+func TestScanHandler(t *testing.T) {
+	withTestAudit(t)
+	withTestJobs(t, 1)
+	post := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		scanHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/scan", strings.NewReader(body)))
+		return rr
+	}
+
+	withTestSettings(t, &Settings{LogLevel: "info"})
+	if rr := post(`{"prefix":"10.0.0.0/24"}`); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("disabled scan status = %d, want 503", rr.Code)
+	}
+
+	withTestScan(t, "10.0.0.0/8", func(ctx context.Context, ip net.IP, method string, ports []int) (string, error) {
+		if ip[3]%50 == 1 {
+			return method, nil
+		}
+		return "", nil
+	})
+	rr := post(`{"prefix":"10.1.2.0/24","method":"icmp"}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("scan status = %d, want 202 (body: %s)", rr.Code, rr.Body.String())
+	}
+	var job Job
+	json.Unmarshal(rr.Body.Bytes(), &job)
+	j := waitForJob(t, job.ID)
+	data, _ := json.Marshal(j.Result)
+	var resp ScanResponse
+	json.Unmarshal(data, &resp)
+	if j.Status != "succeeded" || j.Total != 254 || resp.Prefix != "10.1.2.0/24" || resp.Responding != 6 || resp.Hosts[0].Address != "10.1.2.1" {
+		t.Errorf("job = %+v, result %+v", j, resp)
+	}
+
+	for body, want := range map[string]int{
+		`{"prefix":"192.168.0.0/24"}`:             http.StatusForbidden,
+		`{"prefix":"10.0.0.0/16"}`:                http.StatusBadRequest,
+		`{"prefix":"10.0.0.0/24","method":"udp"}`: http.StatusBadRequest,
+		`{"prefix":"10.0.0.0/24","ports":[0]}`:    http.StatusBadRequest,
+	} {
+		if rr := post(body); rr.Code != want {
+			t.Errorf("POST %s status = %d, want %d", body, rr.Code, want)
+		}
+	}
+
+	withTestScan(t, "10.0.0.0/8", func(ctx context.Context, ip net.IP, method string, ports []int) (string, error) {
+		return "", errors.New("ICMP needs a raw socket")
+	})
+	json.Unmarshal(post(`{"prefix":"10.0.0.0/28","method":"icmp"}`).Body.Bytes(), &job)
+	if j := waitForJob(t, job.ID); j.Status != "failed" || !strings.Contains(j.Error, "raw socket") {
+		t.Errorf("failing scan job = %+v", j)
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretProvider resolves a secret reference to its plaintext value.
+// References are written as "<scheme>://<path>[#field]" in the environment,
+// for example GO_SUBNET_CALCULATOR_DB_PASSWORD=vault://secret/data/subnet#db_password
+type SecretProvider interface {
+	GetSecret(ctx context.Context, path, field string) (string, error)
+}
+
+var (
+	secretProvidersMu sync.RWMutex
+	secretProviders   = map[string]SecretProvider{}
+)
+
+// secretTimeout bounds every call to an external secret manager
+const secretTimeout = 10 * time.Second
+
+// registerSecretProvider makes a provider available under the given reference scheme
+func registerSecretProvider(scheme string, provider SecretProvider) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[scheme] = provider
+}
+
+func init() {
+	registerSecretProvider("vault", &vaultProvider{})
+	registerSecretProvider("aws-sm", &awsSecretsManagerProvider{})
+	registerSecretProvider("gcp-sm", &gcpSecretManagerProvider{})
+}
+
+// loadSecret reads a sensitive setting from the environment. The value is taken from
+// NAME, or from the file named by NAME_FILE (Docker/Kubernetes secrets), and if it is a
+// provider reference such as vault://... it is resolved through the registered provider.
+// An unset secret yields an empty string and no error.
+func loadSecret(name string) (string, error) {
+	if os.Getenv(name) != "" && os.Getenv(name+"_FILE") != "" {
+		return "", fmt.Errorf("both %s and %s_FILE are set", name, name)
+	}
+	value, err := envOrFile(name)
+	if err != nil {
+		return "", err
+	}
+
+	scheme, ref, ok := strings.Cut(value, "://")
+	if !ok {
+		return value, nil
+	}
+
+	secretProvidersMu.RLock()
+	provider, registered := secretProviders[scheme]
+	secretProvidersMu.RUnlock()
+	if !registered {
+		// Not a secret reference, e.g. a URL-shaped DSN
+		return value, nil
+	}
+
+	path, field, _ := strings.Cut(ref, "#")
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	secret, err := provider.GetSecret(ctx, path, field)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s from %s: %v", name, scheme, err)
+	}
+	return secret, nil
+}
+
+// envOrFile returns the value of an environment variable, honoring the NAME_FILE convention
+func envOrFile(name string) (string, error) {
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s_FILE: %v", name, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return os.Getenv(name), nil
+}
+
+// extractSecretField returns the whole secret, or one field of it when the secret is a JSON object
+func extractSecretField(secret, field string) (string, error) {
+	if field == "" {
+		return secret, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, cannot select field %q", field)
+	}
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("field %q not found in secret", field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// doSecretRequest performs an HTTP request and returns the body of a 2xx response
+func doSecretRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return body, nil
+}
+
+// vaultProvider reads secrets from a HashiCorp Vault KV engine (v1 or v2).
+// Configured through VAULT_ADDR and VAULT_TOKEN (or VAULT_TOKEN_FILE)
+type vaultProvider struct {
+	client *http.Client
+}
+
+func (p *vaultProvider) GetSecret(ctx context.Context, path, field string) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	token, err := envOrFile("VAULT_TOKEN")
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	body, err := doSecretRequest(p.client, req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("invalid Vault response: %v", err)
+	}
+
+	// KV v2 nests the secret under data.data
+	data := resp.Data
+	if nested, ok := data["data"]; ok {
+		var inner map[string]json.RawMessage
+		if err := json.Unmarshal(nested, &inner); err == nil {
+			data = inner
+		}
+	}
+
+	if field == "" {
+		if len(data) != 1 {
+			return "", fmt.Errorf("secret has %d fields, select one with #field", len(data))
+		}
+		for _, v := range data {
+			return rawJSONString(v), nil
+		}
+	}
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("field %q not found in secret", field)
+	}
+	return rawJSONString(value), nil
+}
+
+// rawJSONString unquotes a JSON string value, or returns other JSON values verbatim
+func rawJSONString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// awsSecretsManagerProvider reads secrets from AWS Secrets Manager using SigV4-signed requests.
+// Credentials come from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN,
+// the region from AWS_REGION or AWS_DEFAULT_REGION
+type awsSecretsManagerProvider struct {
+	client   *http.Client
+	endpoint string
+	now      func() time.Time
+}
+
+func (p *awsSecretsManagerProvider) GetSecret(ctx context.Context, path, field string) (string, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey, err := envOrFile("AWS_SECRET_ACCESS_KEY")
+	if err != nil {
+		return "", err
+	}
+	if region == "" || accessKey == "" || secretKey == "" {
+		return "", fmt.Errorf("AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+
+	endpoint := p.endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + region + ".amazonaws.com/"
+	}
+	payload, _ := json.Marshal(map[string]string{"SecretId": path})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	now := time.Now
+	if p.now != nil {
+		now = p.now
+	}
+	signAWSRequest(req, payload, accessKey, secretKey, region, "secretsmanager", now().UTC())
+
+	body, err := doSecretRequest(p.client, req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("invalid Secrets Manager response: %v", err)
+	}
+	return extractSecretField(resp.SecretString, field)
+}
+
+// signAWSRequest adds an AWS Signature Version 4 Authorization header to the request
+func signAWSRequest(req *http.Request, payload []byte, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date", "x-amz-target"}
+	if req.Header.Get("X-Amz-Security-Token") != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonicalPath := req.URL.EscapedPath()
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := dateStamp + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), dateStamp)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// gcpSecretManagerProvider reads secrets from Google Cloud Secret Manager. The path is
+// "projects/<project>/secrets/<name>[/versions/<version>]". The access token is taken from
+// GOOGLE_OAUTH_ACCESS_TOKEN (or its _FILE variant) or fetched from the metadata server
+type gcpSecretManagerProvider struct {
+	client      *http.Client
+	endpoint    string
+	metadataURL string
+}
+
+func (p *gcpSecretManagerProvider) GetSecret(ctx context.Context, path, field string) (string, error) {
+	path = strings.Trim(path, "/")
+	if !strings.Contains(path, "/versions/") {
+		path += "/versions/latest"
+	}
+
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := p.endpoint
+	if endpoint == "" {
+		endpoint = "https://secretmanager.googleapis.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/v1/"+path+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	body, err := doSecretRequest(p.client, req)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("invalid Secret Manager response: %v", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("invalid Secret Manager payload: %v", err)
+	}
+	return extractSecretField(string(data), field)
+}
+
+// accessToken returns an OAuth2 token for the Secret Manager API
+func (p *gcpSecretManagerProvider) accessToken(ctx context.Context) (string, error) {
+	token, err := envOrFile("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if err != nil || token != "" {
+		return token, err
+	}
+
+	metadataURL := p.metadataURL
+	if metadataURL == "" {
+		metadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	body, err := doSecretRequest(p.client, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch access token from metadata server: %v", err)
+	}
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.AccessToken == "" {
+		return "", fmt.Errorf("invalid metadata server token response")
+	}
+	return resp.AccessToken, nil
+}
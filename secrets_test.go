@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type staticSecretProvider map[string]string
+
+func (p staticSecretProvider) GetSecret(ctx context.Context, path, field string) (string, error) {
+	return extractSecretField(p[path], field)
+}
+
+func TestLoadSecretFromEnvAndFile(t *testing.T) {
+	t.Setenv("TEST_SECRET_PLAIN", "plain-value")
+	if got, err := loadSecret("TEST_SECRET_PLAIN"); err != nil || got != "plain-value" {
+		t.Errorf("loadSecret() = %q, %v; want plain-value", got, err)
+	}
+
+	file := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(file, []byte("file-value\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SECRET_FROM_FILE_FILE", file)
+	if got, err := loadSecret("TEST_SECRET_FROM_FILE"); err != nil || got != "file-value" {
+		t.Errorf("loadSecret() from file = %q, %v; want file-value", got, err)
+	}
+
+	t.Setenv("TEST_SECRET_BOTH", "x")
+	t.Setenv("TEST_SECRET_BOTH_FILE", file)
+	if _, err := loadSecret("TEST_SECRET_BOTH"); err == nil {
+		t.Error("loadSecret() with both NAME and NAME_FILE expected error, got nil")
+	}
+
+	t.Setenv("TEST_SECRET_MISSING_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err := loadSecret("TEST_SECRET_MISSING"); err == nil {
+		t.Error("loadSecret() with unreadable file expected error, got nil")
+	}
+
+	if got, err := loadSecret("TEST_SECRET_UNSET"); err != nil || got != "" {
+		t.Errorf("loadSecret() unset = %q, %v; want empty", got, err)
+	}
+}
+
+func TestLoadSecretProviderReference(t *testing.T) {
+	registerSecretProvider("test", staticSecretProvider{"app/db": `{"password":"s3cret"}`})
+
+	t.Setenv("TEST_SECRET_REF", "test://app/db#password")
+	if got, err := loadSecret("TEST_SECRET_REF"); err != nil || got != "s3cret" {
+		t.Errorf("loadSecret() = %q, %v; want s3cret", got, err)
+	}
+
+	t.Setenv("TEST_SECRET_REF_BAD", "test://app/db#missing")
+	if _, err := loadSecret("TEST_SECRET_REF_BAD"); err == nil {
+		t.Error("loadSecret() with missing field expected error, got nil")
+	}
+
+	// URL-shaped values with unknown schemes are returned verbatim
+	t.Setenv("TEST_SECRET_DSN", "postgres://user:pass@db/subnets")
+	if got, _ := loadSecret("TEST_SECRET_DSN"); got != "postgres://user:pass@db/subnets" {
+		t.Errorf("loadSecret() = %q, want DSN unchanged", got)
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/subnet":
+			w.Write([]byte(`{"data":{"data":{"api_key":"kv2-key","db_password":"kv2-pass"}}}`))
+		case "/v1/kv/subnet":
+			w.Write([]byte(`{"data":{"api_key":"kv1-key"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	provider := &vaultProvider{}
+
+	tests := []struct {
+		path, field, expected string
+		wantErr               bool
+	}{
+		{"secret/data/subnet", "db_password", "kv2-pass", false},
+		{"kv/subnet", "api_key", "kv1-key", false},
+		{"kv/subnet", "", "kv1-key", false},
+		{"secret/data/subnet", "", "", true},
+		{"secret/data/missing", "api_key", "", true},
+	}
+	for _, tt := range tests {
+		got, err := provider.GetSecret(context.Background(), tt.path, tt.field)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("GetSecret(%s#%s) expected error, got nil", tt.path, tt.field)
+			}
+			continue
+		}
+		if err != nil || got != tt.expected {
+			t.Errorf("GetSecret(%s#%s) = %q, %v; want %q", tt.path, tt.field, got, err, tt.expected)
+		}
+	}
+}
+
+func TestAWSSecretsManagerProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDTEST/20240101/eu-west-1/secretsmanager/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"SecretString":"{\"smtp_password\":\"mail-pass\"}"}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	provider := &awsSecretsManagerProvider{
+		endpoint: server.URL + "/",
+		now:      func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) },
+	}
+
+	got, err := provider.GetSecret(context.Background(), "subnet/prod", "smtp_password")
+	if err != nil || got != "mail-pass" {
+		t.Errorf("GetSecret() = %q, %v; want mail-pass", got, err)
+	}
+
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	if _, err := provider.GetSecret(context.Background(), "subnet/prod", ""); err == nil {
+		t.Error("GetSecret() without region expected error, got nil")
+	}
+}
+
+func TestSignAWSRequestIsDeterministic(t *testing.T) {
+	sign := func() string {
+		req, _ := http.NewRequest(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", nil)
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+		signAWSRequest(req, []byte(`{}`), "AKID", "secret", "us-east-1", "secretsmanager", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		return req.Header.Get("Authorization")
+	}
+	if first, second := sign(), sign(); first != second || !strings.Contains(first, "Signature=") {
+		t.Errorf("signAWSRequest() produced %q and %q", first, second)
+	}
+}
+
+func TestGCPSecretManagerProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"access_token":"gcp-token"}`))
+		case "/v1/projects/p1/secrets/api-key/versions/latest:access":
+			if r.Header.Get("Authorization") != "Bearer gcp-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			data := base64.StdEncoding.EncodeToString([]byte("gcp-secret"))
+			w.Write([]byte(`{"payload":{"data":"` + data + `"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "")
+	provider := &gcpSecretManagerProvider{endpoint: server.URL, metadataURL: server.URL + "/token"}
+
+	got, err := provider.GetSecret(context.Background(), "projects/p1/secrets/api-key", "")
+	if err != nil || got != "gcp-secret" {
+		t.Errorf("GetSecret() = %q, %v; want gcp-secret", got, err)
+	}
+
+	if _, err := provider.GetSecret(context.Background(), "projects/p1/secrets/missing", ""); err == nil {
+		t.Error("GetSecret() for missing secret expected error, got nil")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SelfTestCheck is a single named startup check
+type SelfTestCheck struct {
+	Name string
+	Run  func() error
+}
+
+// SelfTestResult is the outcome of one startup check
+type SelfTestResult struct {
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// SelfTestReport is the outcome of the whole startup self-test, served by /ready
+type SelfTestReport struct {
+	Passed    bool             `json:"passed"`
+	Timestamp time.Time        `json:"timestamp"`
+	Checks    []SelfTestResult `json:"checks"`
+}
+
+var (
+	selfTestMu     sync.Mutex
+	selfTestChecks = []SelfTestCheck{
+		{Name: "calculation vectors", Run: checkCalculationVectors},
+		{Name: "cidr vectors", Run: checkCIDRVectors},
+		{Name: "template rendering", Run: checkTemplateRendering},
+	}
+
+	// selfTestReport holds the latest report; nil until the self-test has run
+	selfTestReport atomic.Pointer[SelfTestReport]
+)
+
+// registerSelfTestCheck adds a check to the startup self-test, e.g. for a storage backend
+func registerSelfTestCheck(name string, run func() error) {
+	selfTestMu.Lock()
+	defer selfTestMu.Unlock()
+	selfTestChecks = append(selfTestChecks, SelfTestCheck{Name: name, Run: run})
+}
+
+// calculationVector is a known-good input/output pair for calculateSubnet
+type calculationVector struct {
+	ip, mask                             string
+	network, broadcast, minHost, maxHost string
+	usableHosts                          string
+}
+
+var calculationVectors = []calculationVector{
+	{"192.168.1.100", "/24", "192.168.1.0", "192.168.1.255", "192.168.1.1", "192.168.1.254", "254"},
+	{"10.5.10.20", "255.255.0.0", "10.5.0.0", "10.5.255.255", "10.5.0.1", "10.5.255.254", "65534"},
+	{"172.16.0.50", "255.255.255.192", "172.16.0.0", "172.16.0.63", "172.16.0.1", "172.16.0.62", "62"},
+	{"192.168.1.5", "/30", "192.168.1.4", "192.168.1.7", "192.168.1.5", "192.168.1.6", "2"},
+	{"192.168.1.1", "/31", "192.168.1.0", "192.168.1.1", "N/A", "N/A", "0"},
+	{"203.0.113.10", "/32", "203.0.113.10", "203.0.113.10", "N/A", "N/A", "0"},
+	{"8.8.8.8", "/0", "0.0.0.0", "255.255.255.255", "0.0.0.1", "255.255.255.254", "4294967294"},
+}
+
+// checkCalculationVectors runs calculateSubnet against the built-in vector set
+func checkCalculationVectors() error {
+	for _, v := range calculationVectors {
+		result, err := calculateSubnet(v.ip, v.mask)
+		if err != nil {
+			return fmt.Errorf("%s %s: %v", v.ip, v.mask, err)
+		}
+		got := []string{result.NetworkAddress, result.BroadcastAddress, result.MinHostAddress, result.MaxHostAddress, result.UsableHosts}
+		want := []string{v.network, v.broadcast, v.minHost, v.maxHost, v.usableHosts}
+		for i := range want {
+			if got[i] != want[i] {
+				return fmt.Errorf("%s %s: got %v, want %v", v.ip, v.mask, got, want)
+			}
+		}
+	}
+	return nil
+}
+
+// checkCIDRVectors exercises the prefix arithmetic used by the deaggregation and free-space endpoints
+func checkCIDRVectors() error {
+	_, free, err := subtractPrefixes("10.0.0.0/8", []string{"10.1.0.0/16"})
+	if err != nil {
+		return err
+	}
+	if len(free) != 8 || free[0].String() != "10.0.0.0/16" || free[7].String() != "10.128.0.0/9" {
+		return fmt.Errorf("10.0.0.0/8 minus 10.1.0.0/16: got %v", prefixStrings(free))
+	}
+	return nil
+}
+
+// checkTemplateRendering parses and executes every page template with sample data; a
+// page without sample data fails the check, so a new page cannot go untested
+func checkTemplateRendering() error {
+	sample, err := calculateSubnet("192.168.1.100", "/24")
+	if err != nil {
+		return err
+	}
+	saved := &Calculation{ID: 1, Name: "sample", IP: sample.IPAddress, Mask: "/24", Network: sample.NetworkAddress}
+	sample.Owner, sample.Saved, sample.Recent = "user:sample", []*Calculation{saved}, []*Calculation{saved}
+	sample.Share = shareURL("sample")
+	sample.Theme, sample.Themes = defaultTheme.Name, themes
+	sample.Explain = true
+	sample.Location = &GeoLocation{Network: "192.168.0.0/16", CountryCode: "DE", Country: "Germany", City: "Berlin", ASN: 64512, ASOrg: "sample"}
+	sample.SpecialPurpose = specialPurposeOf(sample.IPAddress, "/24")
+	sample.Reputation = &Reputation{Listed: true, Hits: []ReputationHit{{List: "sample.example", Entry: "127.0.0.2", Reason: "sample"}}, Checked: 2, Errors: []string{"other.example: timeout"}}
+	sample.Origin = &BGPOrigin{ASN: 64512, ASName: "sample", Prefix: "192.168.0.0/16", Country: "DE", Registry: "ripencc", MoreSpecific: true}
+	sample.Registration = &Registration{RIR: "RIPE NCC", Org: "sample", Start: "192.168.0.0", End: "192.168.255.255", Prefixes: []string{"192.168.0.0/16"}}
+	if sample.Explanation, err = explainSubnet("192.168.1.100", "/24", sample); err != nil {
+		return err
+	}
+	plan, err := buildAddressPlan(PlanRequest{Title: "sample", Prefixes: []string{"10.0.0.0/24", "10.0.1.0/30"}})
+	if err != nil {
+		return err
+	}
+	plan.Subnets[0].Name, plan.Subnets[0].Purpose, plan.Subnets[0].VLAN, plan.Subnets[0].VLANName = "users", "sample", 10, "users"
+	sites, err := planSites(SitePlanRequest{Supernet: "10.0.0.0/16", Names: []string{"hq", "branch"}, Subnets: []SiteSubnetClass{{Name: "users", Hosts: 100, VLAN: 10}, {Name: "mgmt", Length: 28}}, SpareSites: 1})
+	if err != nil {
+		return err
+	}
+	samples := map[string]interface{}{
+		"index.html":      sample,
+		"cheatsheet.html": buildCheatsheet(),
+		"lpm.html":        &LPMResult{},
+		"batch.html":      &BatchPage{MaxItems: maxBatchItems, MaxBytes: maxBatchUploadBytes >> 10, Error: "sample"},
+		"quiz.html":       &QuizPage{Question: &QuizQuestion{ID: "sample", IP: "192.168.1.100", Mask: "/24"}, Grade: &QuizGrade{Question: &QuizQuestion{IP: "192.168.1.100", Mask: "/24"}, Fields: []QuizFieldGrade{{Field: "network", Expected: "192.168.1.0"}}}, Error: "sample"},
+		"login.html":      &LoginPage{Provider: "ldap", Error: "sample"},
+		"ipam.html": &IPAMPage{
+			Pools:      []*IPAMPool{{ID: 1, Name: "sample", Prefix: "10.0.0.0/16", Size: 65536}},
+			Thresholds: defaultUtilizationThresholds,
+			Alerts:     []UtilizationAlert{{PoolID: 1, Pool: "sample", Threshold: 80, State: "raised", Utilization: 85}},
+			Selected:   &IPAMPool{ID: 1, Name: "sample", Prefix: "10.0.0.0/16"},
+			Discovery: &DiscoveryResult{Target: "192.0.2.1:161", DryRun: true, Missing: 1, Subnets: []*DiscoveredSubnet{
+				{Interface: "Gi0/1", Address: "10.0.1.1", Mask: "255.255.255.0", Prefix: "10.0.1.0/24", Pool: "10.0.0.0/16", Status: discoveryMissing},
+			}},
+			DiscoverReq: DiscoveryRequest{Target: "192.0.2.1"},
+			Tenant:      defaultTenant,
+			Global:      true,
+			CanOperate:  true,
+			CanAdmin:    true,
+		},
+		"sites.html": &SitesPage{Supernet: "10.0.0.0/16", Names: "hq\nbranch", Subnets: "users,100,1,10\nmgmt,/28", Growth: "100", SpareSites: "1", Plan: sites, Error: "sample"},
+		"plan.html":  &PlanPage{Title: plan.Title, Prefixes: "10.0.2.0/24", Subnets: plan.Subnets, Error: "sample"},
+	}
+	for _, file := range pageTemplates {
+		data, ok := samples[file]
+		if !ok {
+			return fmt.Errorf("no sample data to render %s with", file)
+		}
+		tmpl, err := loadTemplate(file)
+		if err != nil {
+			return err
+		}
+		if err := tmpl.Execute(io.Discard, data); err != nil {
+			return fmt.Errorf("failed to render %s: %v", file, err)
+		}
+	}
+	// The plan export is a template of its own inside plan.html
+	tmpl, err := loadTemplate("plan.html")
+	if err != nil {
+		return err
+	}
+	if err := tmpl.ExecuteTemplate(io.Discard, "document", plan); err != nil {
+		return fmt.Errorf("failed to render the plan.html document: %v", err)
+	}
+	for _, theme := range themes {
+		tmpl, page, err := loadTheme(theme)
+		if err != nil {
+			return err
+		}
+		if err := tmpl.ExecuteTemplate(io.Discard, page, sample); err != nil {
+			return fmt.Errorf("failed to render theme %s: %v", theme.Name, err)
+		}
+	}
+	return nil
+}
+
+// runSelfTest runs every registered check, logs a report and publishes it for /ready
+func runSelfTest() *SelfTestReport {
+	selfTestMu.Lock()
+	checks := make([]SelfTestCheck, len(selfTestChecks))
+	copy(checks, selfTestChecks)
+	selfTestMu.Unlock()
+
+	report := &SelfTestReport{Passed: true, Timestamp: time.Now()}
+	for _, check := range checks {
+		start := time.Now()
+		err := check.Run()
+		result := SelfTestResult{Name: check.Name, Passed: err == nil, Duration: time.Since(start).String()}
+		if err != nil {
+			result.Error = err.Error()
+			report.Passed = false
+			log.Printf("Self-test FAIL: %s (%s): %v", check.Name, result.Duration, err)
+		} else {
+			logInfof(context.Background(), "Self-test ok: %s (%s)", check.Name, result.Duration)
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	if report.Passed {
+		log.Printf("Self-test passed: %d checks", len(report.Checks))
+	} else {
+		log.Printf("Self-test failed: readiness will report unavailable")
+	}
+
+	selfTestReport.Store(report)
+	return report
+}
+
+// readyHandler reports readiness; it fails until the startup self-test has passed
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+
+	report := selfTestReport.Load()
+	if report == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "self-test has not completed")
+		return
+	}
+	if !report.Passed {
+		writeJSON(w, http.StatusServiceUnavailable, report)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// requireReady refuses traffic with 503 while the self-test has not passed,
+// leaving the liveness and readiness probes and the version reachable
+func requireReady(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" && r.URL.Path != "/ready" && r.URL.Path != "/version" {
+			if report := selfTestReport.Load(); report == nil || !report.Passed {
+				http.Error(w, "Service unavailable: startup self-test failed", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSelfTestChecksPass(t *testing.T) {
+	for _, check := range selfTestChecks {
+		if err := check.Run(); err != nil {
+			t.Errorf("self-test check %q failed: %v", check.Name, err)
+		}
+	}
+}
+
+func TestPageTemplates(t *testing.T) {
+	files, err := filepath.Glob("*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := map[string]bool{}
+	for _, file := range pageTemplates {
+		listed[file] = true
+	}
+	for _, theme := range themes {
+		listed[theme.File] = true
+	}
+	for _, file := range files {
+		if !listed[file] {
+			t.Errorf("%s is neither in pageTemplates nor a theme, so health checks and the self-test skip it", file)
+		}
+	}
+
+	original := pageTemplates
+	defer func() { pageTemplates = original }()
+	pageTemplates = append(slices.Clone(original), "new.html")
+	if err := checkTemplateRendering(); err == nil || !strings.Contains(err.Error(), "new.html") {
+		t.Errorf("page without sample data: %v", err)
+	}
+}
+
+func TestCheckCalculationVectorsDetectsMismatch(t *testing.T) {
+	original := calculationVectors
+	defer func() { calculationVectors = original }()
+
+	calculationVectors = []calculationVector{{"192.168.1.100", "/24", "192.168.1.0", "192.168.1.255", "192.168.1.1", "192.168.1.254", "255"}}
+	if err := checkCalculationVectors(); err == nil {
+		t.Error("checkCalculationVectors() expected error for wrong vector, got nil")
+	}
+}
+
+func TestRunSelfTestAndReadiness(t *testing.T) {
+	defer suppressLogs()()
+	originalChecks := selfTestChecks
+	originalReport := selfTestReport.Load()
+	defer func() {
+		selfTestChecks = originalChecks
+		selfTestReport.Store(originalReport)
+	}()
+
+	selfTestReport.Store(nil)
+	rr := httptest.NewRecorder()
+	readyHandler(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("/ready before self-test = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+
+	if report := runSelfTest(); !report.Passed {
+		t.Fatalf("runSelfTest() failed: %+v", report)
+	}
+	rr = httptest.NewRecorder()
+	readyHandler(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("/ready after passing self-test = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	registerSelfTestCheck("always fails", func() error { return errors.New("boom") })
+	report := runSelfTest()
+	if report.Passed {
+		t.Fatal("runSelfTest() passed despite failing check")
+	}
+
+	rr = httptest.NewRecorder()
+	readyHandler(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("/ready after failing self-test = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	var body SelfTestReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON report: %v", err)
+	}
+	last := body.Checks[len(body.Checks)-1]
+	if last.Name != "always fails" || last.Passed || last.Error != "boom" {
+		t.Errorf("last check = %+v, want failing 'always fails'", last)
+	}
+}
+
+func TestRequireReady(t *testing.T) {
+	originalReport := selfTestReport.Load()
+	defer selfTestReport.Store(originalReport)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	wrapped := requireReady(next)
+
+	tests := []struct {
+		name       string
+		passed     bool
+		path       string
+		wantStatus int
+	}{
+		{"ready serves traffic", true, "/", http.StatusOK},
+		{"failed refuses traffic", false, "/", http.StatusServiceUnavailable},
+		{"failed keeps health", false, "/health", http.StatusOK},
+		{"failed keeps ready", false, "/ready", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selfTestReport.Store(&SelfTestReport{Passed: tt.passed})
+			rr := httptest.NewRecorder()
+			wrapped.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// AggregateRequest lists prefixes to be summarized
+type AggregateRequest struct {
+	Prefixes []string `json:"prefixes"`
+}
+
+// AggregateResponse holds the minimal prefix list covering exactly the input
+type AggregateResponse struct {
+	InputCount int      `json:"input_count"`
+	Prefixes   []string `json:"prefixes"`
+	Count      int      `json:"count"`
+	Addresses  uint64   `json:"addresses"`
+}
+
+// OverlapRequest holds the two prefix collections to compare
+type OverlapRequest struct {
+	A []string `json:"a"`
+	B []string `json:"b"`
+}
+
+// OverlapResponse reports the set relationship between two prefix collections
+type OverlapResponse struct {
+	Overlaps     bool     `json:"overlaps"`
+	Intersection []string `json:"intersection"`
+	AOnly        []string `json:"a_only"`
+	BOnly        []string `json:"b_only"`
+	Union        []string `json:"union"`
+}
+
+// SummaryCheckRequest holds a proposed summary route and the prefixes it should stand for
+type SummaryCheckRequest struct {
+	Summary  string   `json:"summary"`
+	Prefixes []string `json:"prefixes"`
+}
+
+// SummaryCheckResponse reports how well a summary route covers its component prefixes:
+// Extra is the space the summary adds (over-summarization) and Missing the component
+// space it leaves out
+type SummaryCheckResponse struct {
+	Summary          string   `json:"summary"`
+	Exact            bool     `json:"exact"`
+	Extra            []string `json:"extra"`
+	ExtraAddresses   uint64   `json:"extra_addresses"`
+	Missing          []string `json:"missing"`
+	MissingAddresses uint64   `json:"missing_addresses"`
+}
+
+// aggregateHandler serves POST /api/v1/aggregate
+func aggregateHandler(w http.ResponseWriter, r *http.Request) {
+	var req AggregateRequest
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+
+	set, err := cidrset.Parse(req.Prefixes...)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if isPrefixListFormat(responseFormat(r, "json")) {
+		writePrefixList(w, r, "", set.Prefixes())
+		return
+	}
+	writeJSON(w, http.StatusOK, newAggregateResponse(len(req.Prefixes), set))
+}
+
+// newAggregateResponse describes the summary of inputCount prefixes
+func newAggregateResponse(inputCount int, set *cidrset.Set) AggregateResponse {
+	prefixes := set.Prefixes()
+	return AggregateResponse{
+		InputCount: inputCount,
+		Prefixes:   prefixStrings(prefixes),
+		Count:      len(prefixes),
+		Addresses:  set.Size(),
+	}
+}
+
+// overlapHandler serves POST /api/v1/overlap
+func overlapHandler(w http.ResponseWriter, r *http.Request) {
+	var req OverlapRequest
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+
+	resp, err := compareOverlap(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// compareOverlap works out the set relationship of the two collections
+func compareOverlap(req OverlapRequest) (*OverlapResponse, error) {
+	a, err := cidrset.Parse(req.A...)
+	if err != nil {
+		return nil, err
+	}
+	b, err := cidrset.Parse(req.B...)
+	if err != nil {
+		return nil, err
+	}
+
+	intersection := a.Intersect(b)
+	return &OverlapResponse{
+		Overlaps:     !intersection.IsEmpty(),
+		Intersection: prefixStrings(intersection.Prefixes()),
+		AOnly:        prefixStrings(a.Difference(b).Prefixes()),
+		BOnly:        prefixStrings(b.Difference(a).Prefixes()),
+		Union:        prefixStrings(a.Union(b).Prefixes()),
+	}, nil
+}
+
+// summaryCheckHandler serves POST /api/v1/summary/check
+func summaryCheckHandler(w http.ResponseWriter, r *http.Request) {
+	var req SummaryCheckRequest
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+
+	resp, err := checkSummary(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// checkSummary compares the space of a summary route with that of its components
+func checkSummary(req SummaryCheckRequest) (*SummaryCheckResponse, error) {
+	if req.Summary == "" {
+		return nil, fmt.Errorf("summary is required")
+	}
+	if len(req.Prefixes) == 0 {
+		return nil, fmt.Errorf("prefixes are required")
+	}
+	summary, err := cidrset.ParsePrefix(req.Summary)
+	if err != nil {
+		return nil, err
+	}
+	components, err := cidrset.Parse(req.Prefixes...)
+	if err != nil {
+		return nil, err
+	}
+
+	summarySet := cidrset.New(summary)
+	extra := summarySet.Difference(components)
+	missing := components.Difference(summarySet)
+	return &SummaryCheckResponse{
+		Summary:          summary.String(),
+		Exact:            extra.IsEmpty() && missing.IsEmpty(),
+		Extra:            prefixStrings(extra.Prefixes()),
+		ExtraAddresses:   extra.Size(),
+		Missing:          prefixStrings(missing.Prefixes()),
+		MissingAddresses: missing.Size(),
+	}, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAggregateHandler(t *testing.T) {
+	body := `{"prefixes":["10.0.0.0/24","10.0.1.0/24","10.0.2.0/24","10.0.3.0/25","10.0.0.64/26"]}`
+	rr := httptest.NewRecorder()
+	aggregateHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/aggregate", strings.NewReader(body)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var resp AggregateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	expected := []string{"10.0.0.0/23", "10.0.2.0/24", "10.0.3.0/25"}
+	if !reflect.DeepEqual(resp.Prefixes, expected) || resp.InputCount != 5 || resp.Addresses != 896 {
+		t.Errorf("aggregate = %+v, want %v", resp, expected)
+	}
+
+	rr = httptest.NewRecorder()
+	aggregateHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/aggregate", strings.NewReader(`{"prefixes":["x"]}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid prefix status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestOverlapHandler(t *testing.T) {
+	body := `{"a":["10.0.0.0/24"],"b":["10.0.0.128/25","192.168.0.0/24"]}`
+	rr := httptest.NewRecorder()
+	overlapHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/overlap", strings.NewReader(body)))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var resp OverlapResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	if !resp.Overlaps {
+		t.Error("overlaps = false, want true")
+	}
+	if !reflect.DeepEqual(resp.Intersection, []string{"10.0.0.128/25"}) ||
+		!reflect.DeepEqual(resp.AOnly, []string{"10.0.0.0/25"}) ||
+		!reflect.DeepEqual(resp.BOnly, []string{"192.168.0.0/24"}) {
+		t.Errorf("overlap = %+v", resp)
+	}
+
+	for _, tt := range []struct {
+		method string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, `{"a":["bad"]}`, http.StatusBadRequest},
+		{http.MethodPost, `{"b":["bad"]}`, http.StatusBadRequest},
+	} {
+		rr := httptest.NewRecorder()
+		overlapHandler(rr, httptest.NewRequest(tt.method, "/api/v1/overlap", strings.NewReader(tt.body)))
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.body, rr.Code, tt.status)
+		}
+	}
+}
+
+func TestSummaryCheckHandler(t *testing.T) {
+	check := func(body string) (int, SummaryCheckResponse) {
+		rr := httptest.NewRecorder()
+		summaryCheckHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/summary/check", strings.NewReader(body)))
+		var resp SummaryCheckResponse
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON response: %v", err)
+			}
+		}
+		return rr.Code, resp
+	}
+
+	code, resp := check(`{"summary":"10.0.0.0/22","prefixes":["10.0.0.0/24","10.0.1.0/24","10.0.2.0/23"]}`)
+	if code != http.StatusOK || !resp.Exact || len(resp.Extra) != 0 || len(resp.Missing) != 0 {
+		t.Errorf("exact summary: status %d, %+v", code, resp)
+	}
+
+	code, resp = check(`{"summary":"10.0.0.1/22","prefixes":["10.0.0.0/24","10.0.2.0/24","10.0.4.0/25"]}`)
+	if code != http.StatusOK || resp.Exact || resp.Summary != "10.0.0.0/22" ||
+		!reflect.DeepEqual(resp.Extra, []string{"10.0.1.0/24", "10.0.3.0/24"}) || resp.ExtraAddresses != 512 ||
+		!reflect.DeepEqual(resp.Missing, []string{"10.0.4.0/25"}) || resp.MissingAddresses != 128 {
+		t.Errorf("inexact summary: status %d, %+v", code, resp)
+	}
+
+	for _, body := range []string{
+		`{"prefixes":["10.0.0.0/24"]}`,
+		`{"summary":"10.0.0.0/22"}`,
+		`{"summary":"bad","prefixes":["10.0.0.0/24"]}`,
+		`{"summary":"10.0.0.0/22","prefixes":["bad"]}`,
+	} {
+		if code, _ := check(body); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", body, code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// reloadableSettings are the variables the config file may set; they are read again
+// on every reload
+var reloadableSettings = map[string]bool{
+	"GO_SUBNET_CALCULATOR_LOG_LEVEL":      true,
+	"GO_SUBNET_CALCULATOR_SCAN":           true,
+	"GO_SUBNET_CALCULATOR_SCAN_ALLOWED":   true,
+	"GO_SUBNET_CALCULATOR_SCAN_PORTS":     true,
+	"GO_SUBNET_CALCULATOR_SCAN_RATE":      true,
+	"GO_SUBNET_CALCULATOR_SCAN_TIMEOUT":   true,
+	"GO_SUBNET_CALCULATOR_PREFILL_CLIENT": true,
+}
+
+// Settings is the configuration that can change while the server runs. Handlers read
+// it through currentSettings and a reload swaps it whole, so a request sees either the
+// old or the new settings, never a mix
+type Settings struct {
+	// LogLevel is "info" or "warn"; warn drops the informational lines
+	LogLevel string
+	// Scan is nil while host scanning is off
+	Scan *hostScanner
+	// PrefillClient puts the visitor's own address into the calculator form
+	PrefillClient bool
+}
+
+// settings holds the current Settings, nil until configureSettings ran
+var settings atomic.Pointer[Settings]
+
+// defaultSettings apply before configureSettings ran
+var defaultSettings = &Settings{LogLevel: "info"}
+
+// currentSettings returns the settings in effect
+func currentSettings() *Settings {
+	if s := settings.Load(); s != nil {
+		return s
+	}
+	return defaultSettings
+}
+
+// readSettingsFile reads GO_SUBNET_CALCULATOR_CONFIG_FILE, lines of NAME=value with
+// blank lines and # comments allowed. It returns nil when no file is configured
+func readSettingsFile() (map[string]string, error) {
+	path := os.Getenv("GO_SUBNET_CALCULATOR_CONFIG_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("GO_SUBNET_CALCULATOR_CONFIG_FILE: %v", err)
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(text, "=")
+		name = strings.TrimSpace(name)
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: want NAME=value", path, line)
+		}
+		if !reloadableSettings[name] {
+			return nil, fmt.Errorf("%s:%d: %s cannot be set in the config file", path, line, name)
+		}
+		values[name] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("GO_SUBNET_CALCULATOR_CONFIG_FILE: %v", err)
+	}
+	return values, nil
+}
+
+// loadSettings builds the settings from the config file, falling back to the
+// environment for the variables the file does not set
+func loadSettings() (*Settings, error) {
+	values, err := readSettingsFile()
+	if err != nil {
+		return nil, err
+	}
+	setting := func(name string) string {
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return os.Getenv(name)
+	}
+
+	s := &Settings{LogLevel: "info"}
+	if value := setting("GO_SUBNET_CALCULATOR_LOG_LEVEL"); value != "" {
+		if value != "info" && value != "warn" {
+			return nil, fmt.Errorf("GO_SUBNET_CALCULATOR_LOG_LEVEL must be info or warn")
+		}
+		s.LogLevel = value
+	}
+	if s.Scan, err = newHostScan(setting); err != nil {
+		return nil, err
+	}
+	if s.PrefillClient, err = prefillSetting(setting); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// configureSettings loads the reloadable settings at startup
+func configureSettings() error {
+	s, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	settings.Store(s)
+	s.record()
+	return nil
+}
+
+// reloadSettings re-reads the config file; on error the settings loaded before stay
+// in effect
+func reloadSettings() ComponentHealth {
+	s, err := loadSettings()
+	if err != nil {
+		return ComponentHealth{Status: componentFailed, Error: err.Error()}
+	}
+	settings.Store(s)
+	s.record()
+	return ComponentHealth{Status: componentOK, Details: s.summary()}
+}
+
+// record writes the settings to the audit log
+func (s *Settings) record() {
+	recordSystemAudit("config.log_level", "", "log level %s", s.LogLevel)
+	if s.Scan == nil {
+		recordSystemAudit("config.scan", "", "host scanning disabled")
+	} else {
+		var allowed []string
+		for _, p := range s.Scan.allowed.Prefixes() {
+			allowed = append(allowed, p.String())
+		}
+		recordSystemAudit("config.scan", strings.Join(allowed, ","), "host scanning enabled, %d probes/s, ports %v", s.Scan.rate, s.Scan.ports)
+	}
+	recordSystemAudit("config.prefill", "", "prefill client address %t", s.PrefillClient)
+}
+
+// summary describes the settings for a reload report
+func (s *Settings) summary() string {
+	scan := "off"
+	if s.Scan != nil {
+		scan = fmt.Sprintf("%d probes/s", s.Scan.rate)
+	}
+	return fmt.Sprintf("log level %s, scanning %s, prefill %t", s.LogLevel, scan, s.PrefillClient)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withTestSettings puts s in effect for the test
+func withTestSettings(t *testing.T, s *Settings) {
+	t.Helper()
+	previous := settings.Swap(s)
+	t.Cleanup(func() { settings.Store(previous) })
+}
+
+func TestReloadSettings(t *testing.T) {
+	audit := withTestAudit(t)
+	withTestSettings(t, nil)
+	path := filepath.Join(t.TempDir(), "settings.conf")
+	t.Setenv("GO_SUBNET_CALCULATOR_CONFIG_FILE", path)
+	t.Setenv("GO_SUBNET_CALCULATOR_SCAN", "true")
+	t.Setenv("GO_SUBNET_CALCULATOR_SCAN_RATE", "20")
+	t.Setenv("GO_SUBNET_CALCULATOR_PREFILL_CLIENT", "")
+	os.WriteFile(path, []byte("# set by the test\n\nGO_SUBNET_CALCULATOR_SCAN_RATE = 100\n"), 0o644)
+	if err := configureSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if s := currentSettings(); s.Scan == nil || s.Scan.rate != 100 || s.PrefillClient || s.LogLevel != "info" {
+		t.Fatalf("settings = %+v, want scanning at 100 probes/s from the file", s)
+	}
+
+	scan := currentSettings().Scan
+	os.WriteFile(path, []byte("GO_SUBNET_CALCULATOR_SCAN=false\nGO_SUBNET_CALCULATOR_PREFILL_CLIENT=true\nGO_SUBNET_CALCULATOR_LOG_LEVEL=warn\n"), 0o644)
+	if c := reloadSettings(); c.Status != componentOK || c.Details != "log level warn, scanning off, prefill true" {
+		t.Fatalf("reload = %+v", c)
+	}
+	if s := currentSettings(); s.Scan != nil || !s.PrefillClient {
+		t.Errorf("settings after reload = %+v", s)
+	}
+	if scan.rate != 100 {
+		t.Error("reload changed the settings a request already holds")
+	}
+	if entries, _ := audit.List(AuditFilter{Action: "config.scan", Limit: 10}); len(entries) != 2 || entries[0].Details != "host scanning disabled" {
+		t.Errorf("config.scan audit entries = %+v", entries)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	recordSystemAudit("test.quiet", "", "not logged")
+	logRequestf(context.Background(), "still logged")
+	if strings.Contains(buf.String(), "not logged") || !strings.Contains(buf.String(), "still logged") {
+		t.Errorf("log at level warn = %q", buf.String())
+	}
+
+	for name, content := range map[string]string{
+		"unknown name": "GO_SUBNET_CALCULATOR_ADDR=:9090\n",
+		"no value":     "GO_SUBNET_CALCULATOR_SCAN\n",
+		"bad level":    "GO_SUBNET_CALCULATOR_LOG_LEVEL=debug\n",
+		"bad rate":     "GO_SUBNET_CALCULATOR_SCAN=true\nGO_SUBNET_CALCULATOR_SCAN_RATE=0\n",
+	} {
+		os.WriteFile(path, []byte(content), 0o644)
+		before := currentSettings()
+		if c := reloadSettings(); c.Status != componentFailed || c.Error == "" {
+			t.Errorf("%s: reload = %+v, want failed", name, c)
+		}
+		if currentSettings() != before {
+			t.Errorf("%s: a failed reload replaced the settings", name)
+		}
+	}
+}
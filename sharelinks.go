@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ShareLink is a short link to a calculation. Only the inputs are stored; the result
+// is calculated again whenever the link is opened
+type ShareLink struct {
+	Code      string    `json:"code"`
+	URL       string    `json:"url"`
+	IP        string    `json:"ip"`
+	Mask      string    `json:"mask"`
+	Cloud     string    `json:"cloud,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ShareLinkStore persists share links. GetShareLink returns errIPAMNotFound for
+// unknown codes
+type ShareLinkStore interface {
+	GetShareLink(code string) (*ShareLink, error)
+	CreateShareLink(l *ShareLink) error
+}
+
+// memoryShareLinkStore keeps share links in memory; they are lost on restart
+type memoryShareLinkStore struct {
+	mu    sync.RWMutex
+	links map[string]*ShareLink
+}
+
+func newMemoryShareLinkStore() *memoryShareLinkStore {
+	return &memoryShareLinkStore{links: map[string]*ShareLink{}}
+}
+
+func (s *memoryShareLinkStore) GetShareLink(code string) (*ShareLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	l, ok := s.links[code]
+	if !ok {
+		return nil, errIPAMNotFound
+	}
+	copied := *l
+	return &copied, nil
+}
+
+func (s *memoryShareLinkStore) CreateShareLink(l *ShareLink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[l.Code]; ok {
+		return fmt.Errorf("share code %s is taken", l.Code)
+	}
+	l.CreatedAt = time.Now().UTC()
+	copied := *l
+	s.links[l.Code] = &copied
+	return nil
+}
+
+// shareLinkStore holds the share links; configureStorage switches it to the database
+// so links survive restarts
+var shareLinkStore ShareLinkStore = newMemoryShareLinkStore()
+
+// shareCodeAttempts bounds the retries when a random code is already taken
+const shareCodeAttempts = 5
+
+// newShareCode returns 48 random bits as eight base64url characters
+func newShareCode() (string, error) {
+	random := make([]byte, 6)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// shareURL is the path a share code is served under
+func shareURL(code string) string {
+	return sitePath("/s/" + code)
+}
+
+// createShareLink validates a calculation and stores a short link to it
+func createShareLink(ip, mask, cloud string) (*ShareLink, error) {
+	ip, mask, _ = normalizeInput(ip, mask)
+	cloud = strings.ToLower(strings.TrimSpace(cloud))
+	if ip == "" || mask == "" {
+		return nil, fmt.Errorf("ip and mask are required")
+	}
+	if _, err := calculateCloudSubnet(ip, mask, cloud); err != nil {
+		return nil, err
+	}
+
+	var err error
+	for attempt := 0; attempt < shareCodeAttempts; attempt++ {
+		var code string
+		if code, err = newShareCode(); err != nil {
+			return nil, err
+		}
+		if _, taken := shareLinkStore.GetShareLink(code); taken == nil {
+			continue
+		}
+		l := &ShareLink{Code: code, IP: ip, Mask: mask, Cloud: cloud}
+		if err = shareLinkStore.CreateShareLink(l); err == nil {
+			l.URL = shareURL(code)
+			return l, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("no free share code after %d attempts", shareCodeAttempts)
+	}
+	return nil, err
+}
+
+// sharedResult calculates the result behind a share link
+func sharedResult(l *ShareLink) (*SubnetResult, error) {
+	result, err := calculateCloudSubnet(l.IP, l.Mask, l.Cloud)
+	if err != nil {
+		return nil, err
+	}
+	result.IPAddress, result.SubnetMask = l.IP, l.Mask
+	return result, nil
+}
+
+// shareHandler serves POST /api/v1/share, which takes the body of /api/v1/calculate
+// and returns a short link to the result
+func shareHandler(w http.ResponseWriter, r *http.Request) {
+	var req CalculateRequest
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	l, err := createShareLink(req.IP, req.Mask, req.Cloud)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, l)
+}
+
+// sharedPageHandler serves GET /s/{code}: the calculator page showing the shared
+// result, or the result as JSON, CSV or Markdown with ?format= or the Accept header
+func sharedPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format := responseFormat(r, "html")
+
+	l, err := shareLinkStore.GetShareLink(r.PathValue("code"))
+	if err == nil {
+		l.URL = shareURL(l.Code)
+	}
+	var result *SubnetResult
+	if err == nil {
+		result, err = sharedResult(l)
+	}
+	if err != nil {
+		status, message := http.StatusInternalServerError, err.Error()
+		if err == errIPAMNotFound {
+			status, message = http.StatusNotFound, "share link not found"
+		}
+		if format == "json" {
+			writeJSONError(w, status, message)
+		} else {
+			http.Error(w, message, status)
+		}
+		return
+	}
+	switch format {
+	case "json":
+		writeJSON(w, http.StatusOK, result)
+		return
+	case "csv":
+		writeSubnetCSV(w, "subnet-"+l.Code+".csv", []SubnetRow{resultRow("", result)})
+		return
+	case "markdown":
+		writeResultMarkdown(w, result)
+		return
+	}
+
+	result.Generators, result.Providers, result.Share = listConfigGenerators(), cloudProviders, l.URL
+	renderMainPage(w, r, result)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func init() {
+	registerMigration(sqlMigration{
+		Version: 8,
+		Name:    "create share links",
+		Up: []string{
+			`CREATE TABLE share_links (
+				code TEXT PRIMARY KEY,
+				ip TEXT NOT NULL,
+				mask TEXT NOT NULL,
+				cloud TEXT NOT NULL DEFAULT '',
+				created_at TEXT NOT NULL
+			)`,
+		},
+	})
+}
+
+// sqlShareLinkStore keeps share links in a SQL database
+type sqlShareLinkStore struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+func newSQLShareLinkStore(db *sql.DB, dialect sqlDialect) *sqlShareLinkStore {
+	return &sqlShareLinkStore{db: db, dialect: dialect}
+}
+
+func (s *sqlShareLinkStore) GetShareLink(code string) (*ShareLink, error) {
+	var l ShareLink
+	var created string
+	err := s.db.QueryRow(s.dialect.rebind("SELECT code, ip, mask, cloud, created_at FROM share_links WHERE code = ?"), code).
+		Scan(&l.Code, &l.IP, &l.Mask, &l.Cloud, &created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errIPAMNotFound
+		}
+		return nil, err
+	}
+	l.CreatedAt, _ = time.Parse(time.RFC3339Nano, created)
+	return &l, nil
+}
+
+func (s *sqlShareLinkStore) CreateShareLink(l *ShareLink) error {
+	l.CreatedAt = time.Now().UTC()
+	_, err := s.db.Exec(s.dialect.rebind("INSERT INTO share_links (code, ip, mask, cloud, created_at) VALUES (?, ?, ?, ?, ?)"),
+		l.Code, l.IP, l.Mask, l.Cloud, sqlTime(l.CreatedAt))
+	return err
+}
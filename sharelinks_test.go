@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// withTestShareLinks gives a test an empty share link store
+func withTestShareLinks(t *testing.T) *memoryShareLinkStore {
+	t.Helper()
+	previous := shareLinkStore
+	store := newMemoryShareLinkStore()
+	shareLinkStore = store
+	t.Cleanup(func() { shareLinkStore = previous })
+	return store
+}
+
+func TestCreateShareLink(t *testing.T) {
+	withTestShareLinks(t)
+
+	l, err := createShareLink(" 10.0.1.77 ", "/24", "AWS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Code) != 8 || l.URL != "/s/"+l.Code || l.IP != "10.0.1.77" || l.Cloud != "aws" {
+		t.Errorf("link = %+v", l)
+	}
+	other, _ := createShareLink("10.0.1.77", "/24", "aws")
+	if other.Code == l.Code {
+		t.Error("two links got the same code")
+	}
+
+	for _, in := range [][3]string{{"", "/24", ""}, {"300.1.1.1", "/24", ""}, {"10.0.0.1", "/8", "aws"}} {
+		if _, err := createShareLink(in[0], in[1], in[2]); err == nil {
+			t.Errorf("createShareLink(%v) expected an error", in)
+		}
+	}
+}
+
+func TestShareLinkHandlers(t *testing.T) {
+	withTestShareLinks(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/share", shareHandler)
+	mux.HandleFunc("/s/{code}", sharedPageHandler)
+
+	call := func(method, target, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if len(header) == 2 {
+			req.Header.Set(header[0], header[1])
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := call(http.MethodPost, "/api/v1/share", `{"ip":"172.16.5.9","mask":"/29","cloud":"gcp"}`)
+	var l ShareLink
+	if err := json.NewDecoder(rr.Body).Decode(&l); err != nil || rr.Code != http.StatusCreated || l.URL == "" {
+		t.Fatalf("share = %d %+v", rr.Code, l)
+	}
+	if rr := call(http.MethodPost, "/api/v1/share", `{"ip":"172.16.5.9"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("share without mask = %d, want 400", rr.Code)
+	}
+	if rr := call(http.MethodGet, "/api/v1/share", ""); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET share = %d, want 405", rr.Code)
+	}
+
+	rr = call(http.MethodGet, l.URL+"?format=json", "")
+	var result SubnetResult
+	if err := json.NewDecoder(rr.Body).Decode(&result); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("shared JSON = %d %v", rr.Code, err)
+	}
+	if result.IPAddress != "172.16.5.9" || result.NetworkAddress != "172.16.5.8" || result.UsableHosts != "4" || result.Cloud != "gcp" {
+		t.Errorf("shared result = %+v", result)
+	}
+	if rr := call(http.MethodGet, l.URL, "", "Accept", "application/json"); !strings.Contains(rr.Header().Get("Content-Type"), "json") {
+		t.Errorf("Accept: application/json got %s", rr.Header().Get("Content-Type"))
+	}
+
+	rr = call(http.MethodGet, l.URL, "")
+	if body := rr.Body.String(); rr.Code != http.StatusOK || !strings.Contains(body, "172.16.5.8") || !strings.Contains(body, l.URL) {
+		t.Errorf("shared page = %d:\n%s", rr.Code, body)
+	}
+	if rr := call(http.MethodGet, "/s/missing?format=json", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown code = %d, want 404", rr.Code)
+	}
+	if rr := call(http.MethodGet, "/s/missing", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown code page = %d, want 404", rr.Code)
+	}
+}
+
+func TestMainPageShare(t *testing.T) {
+	withTestShareLinks(t)
+	form := url.Values{"action": {"share"}, "ip": {"192.168.1.100"}, "mask": {"/24"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	location := rr.Header().Get("Location")
+	if rr.Code != http.StatusSeeOther || !strings.HasPrefix(location, "/s/") {
+		t.Fatalf("share = %d to %q", rr.Code, location)
+	}
+	if _, err := shareLinkStore.GetShareLink(strings.TrimPrefix(location, "/s/")); err != nil {
+		t.Errorf("shared link was not stored: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"ip": {"192.168.1.100"}, "mask": {"/24"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if !strings.Contains(rr.Body.String(), `name="action" value="share"`) {
+		t.Error("result page must offer a share link")
+	}
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+const (
+	defaultSiteGrowth = 100
+	maxSiteGrowth     = 1000
+	maxSites          = 4096
+	maxSiteSubnets    = 256
+)
+
+// SiteSubnetClass is a kind of subnet every site gets Count of, sized for Hosts usable
+// addresses or given as a prefix Length
+type SiteSubnetClass struct {
+	Name   string `json:"name"`
+	Hosts  int    `json:"hosts,omitempty"`
+	Length int    `json:"length,omitempty"`
+	Count  int    `json:"count,omitempty"`
+	VLAN   int    `json:"vlan,omitempty"`
+}
+
+// SitePlanRequest is the JSON body of POST /api/v1/sites/plan: Sites (or one site per
+// entry of Names) carved out of Supernet, or out of the free space of the IPAM pool
+// PoolID, each with the subnets of Subnets. Growth is the room left in every site
+// block for later subnets, in percent of the planned ones (default 100), and
+// SpareSites reserves blocks for sites added later. Commit records the site blocks
+// as allocations of the pool
+type SitePlanRequest struct {
+	Supernet   string            `json:"supernet,omitempty"`
+	PoolID     int64             `json:"pool_id,omitempty"`
+	Sites      int               `json:"sites,omitempty"`
+	Names      []string          `json:"names,omitempty"`
+	Subnets    []SiteSubnetClass `json:"subnets"`
+	Growth     *int              `json:"growth,omitempty"`
+	SpareSites int               `json:"spare_sites,omitempty"`
+	Commit     bool              `json:"commit,omitempty"`
+}
+
+// PlannedSiteSubnet is one subnet of a site
+type PlannedSiteSubnet struct {
+	Name        string `json:"name"`
+	Prefix      string `json:"prefix"`
+	VLAN        int    `json:"vlan,omitempty"`
+	UsableHosts uint64 `json:"usable_hosts"`
+}
+
+// PlannedSite is the block of a site, its subnets and the space left for growth
+type PlannedSite struct {
+	Name    string              `json:"name"`
+	Block   string              `json:"block"`
+	Subnets []PlannedSiteSubnet `json:"subnets"`
+	Growth  []string            `json:"growth"`
+}
+
+// SitePlanResponse is a hierarchical allocation: equally sized site blocks, every site
+// laid out the same way, the spare blocks for future sites and the free rest of the
+// supernet
+type SitePlanResponse struct {
+	Supernet    string            `json:"supernet"`
+	SiteLength  int               `json:"site_length"`
+	Sites       []PlannedSite     `json:"sites"`
+	Spare       []string          `json:"spare,omitempty"`
+	Free        []string          `json:"free"`
+	Allocations []*IPAMAllocation `json:"allocations,omitempty"`
+}
+
+// siteSubnet is a subnet of the per-site layout, before it is placed in a site block
+type siteSubnet struct {
+	name   string
+	length int
+	vlan   int
+}
+
+// hostsPrefixLength returns the longest prefix length with at least hosts usable addresses
+func hostsPrefixLength(hosts int) int {
+	for length := 30; length > 0; length-- {
+		if usableHostCount(length) >= uint64(hosts) {
+			return length
+		}
+	}
+	return 0
+}
+
+// siteLayout sizes the subnet classes and orders them largest first, which packs them
+// into a site block without gaps
+func siteLayout(classes []SiteSubnetClass) ([]siteSubnet, error) {
+	if len(classes) == 0 {
+		return nil, fmt.Errorf("at least one subnet class is required")
+	}
+	var layout []siteSubnet
+	names := map[string]bool{}
+	for _, c := range classes {
+		c.Name = strings.TrimSpace(c.Name)
+		if !dnsmasqTag.MatchString(c.Name) {
+			return nil, fmt.Errorf("invalid subnet class name %q, use letters, digits, '-' and '_'", c.Name)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("subnet class %s is given twice", c.Name)
+		}
+		names[c.Name] = true
+		if err := validVLAN(c.VLAN); err != nil {
+			return nil, fmt.Errorf("%s: %v", c.Name, err)
+		}
+		length := c.Length
+		switch {
+		case (c.Hosts == 0) == (c.Length == 0):
+			return nil, fmt.Errorf("%s: exactly one of hosts and length is required", c.Name)
+		case c.Hosts < 0 || c.Hosts > 1<<24:
+			return nil, fmt.Errorf("%s: hosts must be between 1 and %d", c.Name, 1<<24)
+		case c.Hosts > 0:
+			length = hostsPrefixLength(c.Hosts)
+		case c.Length < 8 || c.Length > 32:
+			return nil, fmt.Errorf("%s: length must be between /8 and /32", c.Name)
+		}
+		count := c.Count
+		if count == 0 {
+			count = 1
+		}
+		if count < 0 || len(layout)+count > maxSiteSubnets {
+			return nil, fmt.Errorf("a site may have at most %d subnets", maxSiteSubnets)
+		}
+		for i := 1; i <= count; i++ {
+			name := c.Name
+			if count > 1 {
+				name = fmt.Sprintf("%s-%d", c.Name, i)
+			}
+			layout = append(layout, siteSubnet{name: name, length: length, vlan: c.VLAN})
+		}
+	}
+	sort.SliceStable(layout, func(i, j int) bool { return layout[i].length < layout[j].length })
+	return layout, nil
+}
+
+// siteNames returns the names of the sites: the given names, or site1 to siteN
+func siteNames(req SitePlanRequest) ([]string, error) {
+	if len(req.Names) == 0 {
+		if req.Sites < 1 || req.Sites > maxSites {
+			return nil, fmt.Errorf("sites must be between 1 and %d", maxSites)
+		}
+		names := make([]string, req.Sites)
+		for i := range names {
+			names[i] = fmt.Sprintf("site%d", i+1)
+		}
+		return names, nil
+	}
+	if req.Sites != 0 && req.Sites != len(req.Names) {
+		return nil, fmt.Errorf("got %d names for %d sites", len(req.Names), req.Sites)
+	}
+	if len(req.Names) > maxSites {
+		return nil, fmt.Errorf("at most %d sites are allowed", maxSites)
+	}
+	seen := map[string]bool{}
+	names := make([]string, len(req.Names))
+	for i, name := range req.Names {
+		name = strings.TrimSpace(name)
+		if !dnsmasqTag.MatchString(name) {
+			return nil, fmt.Errorf("invalid site name %q, use letters, digits, '-' and '_'", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("site %s is given twice", name)
+		}
+		seen[name] = true
+		names[i] = name
+	}
+	return names, nil
+}
+
+// siteSpace returns the supernet of a request and its free space: the whole supernet,
+// or the pool of PoolID without its allocations
+func siteSpace(req SitePlanRequest) (*net.IPNet, *cidrset.Set, error) {
+	if (req.Supernet == "") == (req.PoolID == 0) {
+		return nil, nil, fmt.Errorf("exactly one of supernet and pool_id is required")
+	}
+	if req.Supernet != "" {
+		supernet, err := parseIPv4Prefix(req.Supernet)
+		if err != nil {
+			return nil, nil, err
+		}
+		return supernet, cidrset.New(supernet), nil
+	}
+
+	pool, err := ipamService.Pool(req.PoolID)
+	if err != nil {
+		return nil, nil, err
+	}
+	supernet, err := parseIPv4Prefix(pool.Prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	allocations, err := ipamService.Allocations(req.PoolID)
+	if err != nil {
+		return nil, nil, err
+	}
+	used := make([]*net.IPNet, 0, len(allocations))
+	for _, a := range allocations {
+		if n, err := parseIPv4Prefix(a.Prefix); err == nil {
+			used = append(used, n)
+		}
+	}
+	return supernet, cidrset.New(supernet).Difference(cidrset.New(used...)), nil
+}
+
+// planSites sizes one block for the subnets of a site plus the growth room, carves a
+// block per site and spare site from the lowest free space, and lays every site out
+// the same way so that a subnet sits at the same offset in every site block
+func planSites(req SitePlanRequest) (*SitePlanResponse, error) {
+	names, err := siteNames(req)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := siteLayout(req.Subnets)
+	if err != nil {
+		return nil, err
+	}
+	growth := defaultSiteGrowth
+	if req.Growth != nil {
+		growth = *req.Growth
+	}
+	if growth < 0 || growth > maxSiteGrowth {
+		return nil, fmt.Errorf("growth must be between 0 and %d percent", maxSiteGrowth)
+	}
+	if req.SpareSites < 0 || len(names)+req.SpareSites > maxSites {
+		return nil, fmt.Errorf("spare_sites must be between 0 and %d minus the number of sites", maxSites)
+	}
+	supernet, free, err := siteSpace(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var needed uint64
+	for _, s := range layout {
+		needed += uint64(1) << uint(32-s.length)
+	}
+	needed = (needed*uint64(100+growth) + 99) / 100
+	siteLength := 32 - bits.Len64(needed-1)
+	superLength, _ := supernet.Mask.Size()
+	if siteLength < superLength {
+		return nil, fmt.Errorf("a site needs a /%d with %d%% growth, more than the whole %s", siteLength, growth, supernet)
+	}
+
+	count := len(names) + req.SpareSites
+	blocks := make([]netip.Prefix, 0, count)
+	for _, p := range free.Prefixes() {
+		if block := netipPrefix(p); block.Bits() <= siteLength && len(blocks) < count {
+			blocks = append(blocks, subnetsOf(block, siteLength, count-len(blocks))...)
+		}
+	}
+	if len(blocks) < count {
+		return nil, fmt.Errorf("%w: %s has room for %d /%d site blocks, %d are needed", errIPAMConflict, supernet, len(blocks), siteLength, count)
+	}
+
+	resp := &SitePlanResponse{Supernet: supernet.String(), SiteLength: siteLength}
+	var planned []*net.IPNet
+	for i, name := range names {
+		block := blocks[i]
+		site := PlannedSite{Name: name, Block: block.String()}
+		offset := addrToUint32(block.Addr())
+		var used []*net.IPNet
+		for _, s := range layout {
+			subnet := netip.PrefixFrom(uint32ToAddr(offset), s.length)
+			offset += uint32(1) << uint(32-s.length)
+			site.Subnets = append(site.Subnets, PlannedSiteSubnet{Name: s.name, Prefix: subnet.String(), VLAN: s.vlan, UsableHosts: usableHostCount(s.length)})
+			used = append(used, ipNet(subnet))
+		}
+		site.Growth = prefixStrings(excludePrefixes(ipNet(block), used))
+		resp.Sites = append(resp.Sites, site)
+		planned = append(planned, ipNet(block))
+	}
+	for _, block := range blocks[len(names):] {
+		resp.Spare = append(resp.Spare, block.String())
+		planned = append(planned, ipNet(block))
+	}
+	resp.Free = prefixStrings(free.Difference(cidrset.New(planned...)).Prefixes())
+	return resp, nil
+}
+
+// commitSites records the site blocks as allocations of the pool. When one of them
+// fails, the ones already recorded are released again
+func commitSites(r *http.Request, poolID int64, resp *SitePlanResponse) error {
+	for _, site := range resp.Sites {
+		allocation, err := ipamService.Allocate(poolID, AllocationRequest{Prefix: site.Block, Description: "site " + site.Name})
+		if err != nil {
+			for _, a := range resp.Allocations {
+				ipamService.Release(a.ID)
+			}
+			resp.Allocations = nil
+			return err
+		}
+		recordAudit(r, "allocation.create", allocationTarget(allocation), "pool %d, description %q", allocation.PoolID, allocation.Description)
+		resp.Allocations = append(resp.Allocations, allocation)
+	}
+	return nil
+}
+
+// siteRows converts a site plan to export rows named site/subnet
+func siteRows(resp *SitePlanResponse) []SubnetRow {
+	var rows []SubnetRow
+	for _, site := range resp.Sites {
+		for _, s := range site.Subnets {
+			_, subnet, _ := net.ParseCIDR(s.Prefix)
+			rows = append(rows, prefixRow(site.Name+"/"+s.Name, subnet))
+		}
+	}
+	return rows
+}
+
+// writeSitePlan sends a site plan as JSON or, as csv, xlsx, markdown, svg or dot, the
+// planned subnets as a download, report or diagram
+func writeSitePlan(w http.ResponseWriter, resp *SitePlanResponse, format string) {
+	switch format {
+	case "csv":
+		writeSubnetCSV(w, "site-plan.csv", siteRows(resp))
+	case "xlsx":
+		writeXLSXDownload(w, "site-plan.xlsx", subnetSheets(siteRows(resp)))
+	case "markdown":
+		writeSubnetMarkdown(w, "Site plan for "+resp.Supernet, siteRows(resp))
+	case "svg", "dot":
+		supernet, _ := parseIPv4Prefix(resp.Supernet)
+		writeSubnetDiagram(w, format, supernet, siteRows(resp))
+	case "json":
+		writeJSON(w, http.StatusOK, resp)
+	default:
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("unsupported format %q, use json, csv, xlsx, markdown, svg or dot", format))
+	}
+}
+
+// sitePlanHandler serves POST /api/v1/sites/plan as JSON or, with ?format=, an export
+// of the planned subnets. Planning in a pool needs viewer
+// access to it and committing the plan operator access
+func sitePlanHandler(w http.ResponseWriter, r *http.Request) {
+	var req SitePlanRequest
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+	if req.Commit && req.PoolID == 0 {
+		writeJSONError(w, http.StatusBadRequest, "commit needs a pool_id")
+		return
+	}
+	if req.PoolID != 0 {
+		role := RoleViewer
+		if req.Commit {
+			role = RoleOperator
+		}
+		if err := authorizePool(r, req.PoolID, role); err != nil {
+			writeIPAMError(w, err)
+			return
+		}
+	}
+
+	resp, err := planSites(req)
+	if err == nil && req.Commit {
+		err = commitSites(r, req.PoolID, resp)
+	}
+	if err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	writeSitePlan(w, resp, responseFormat(r, "json"))
+}
+
+// SitesPage is the data of the /sites page
+type SitesPage struct {
+	Supernet   string
+	Names      string
+	Subnets    string
+	Growth     string
+	SpareSites string
+	Plan       *SitePlanResponse
+	Error      string
+}
+
+// parseSiteClasses reads the subnet classes of the /sites form, one per line as
+// name,hosts[,count[,vlan]] where hosts may also be a prefix length such as /26
+func parseSiteClasses(text string) ([]SiteSubnetClass, error) {
+	var classes []SiteSubnetClass
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) < 2 || len(fields) > 4 {
+			return nil, fmt.Errorf("invalid subnet class %q, use name,hosts[,count[,vlan]]", line)
+		}
+		numbers := make([]int, 4)
+		for i, field := range fields[1:] {
+			field = strings.TrimSpace(field)
+			if i == 0 && strings.HasPrefix(field, "/") {
+				field, numbers[0] = field[1:], -1
+			}
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid subnet class %q, use name,hosts[,count[,vlan]]", line)
+			}
+			numbers[i+1] = n
+		}
+		c := SiteSubnetClass{Name: strings.TrimSpace(fields[0]), Hosts: numbers[1], Count: numbers[2], VLAN: numbers[3]}
+		if numbers[0] == -1 {
+			c.Hosts, c.Length = 0, numbers[1]
+		}
+		classes = append(classes, c)
+	}
+	return classes, nil
+}
+
+// sitesPageHandler serves the /sites planning wizard. The export buttons download the
+// plan in the format they name
+func sitesPageHandler(w http.ResponseWriter, r *http.Request) {
+	if !parseFormBody(w, r) {
+		return
+	}
+	page := &SitesPage{Growth: strconv.Itoa(defaultSiteGrowth), SpareSites: "0"}
+	if r.Method == http.MethodPost {
+		page.Supernet, page.Names, page.Subnets = r.FormValue("supernet"), r.FormValue("names"), r.FormValue("subnets")
+		page.Growth, page.SpareSites = r.FormValue("growth"), r.FormValue("spare_sites")
+
+		req := SitePlanRequest{Supernet: strings.TrimSpace(page.Supernet), Names: parsePrefixListQuery(page.Names)}
+		if len(req.Names) == 1 {
+			if n, err := strconv.Atoi(req.Names[0]); err == nil {
+				req.Sites, req.Names = n, nil
+			}
+		}
+		growth, err := strconv.Atoi(strings.TrimSpace(page.Growth))
+		if err != nil {
+			err = fmt.Errorf("invalid growth: %s", page.Growth)
+		}
+		req.Growth = &growth
+		if err == nil {
+			if req.SpareSites, err = strconv.Atoi(strings.TrimSpace(page.SpareSites)); err != nil {
+				err = fmt.Errorf("invalid spare sites: %s", page.SpareSites)
+			}
+		}
+		if err == nil {
+			req.Subnets, err = parseSiteClasses(page.Subnets)
+		}
+		if err == nil {
+			page.Plan, err = planSites(req)
+		}
+		switch format := r.FormValue("format"); {
+		case err != nil:
+			page.Error = err.Error()
+		case format != "":
+			writeSitePlan(w, page.Plan, format)
+			return
+		}
+	}
+
+	tmpl, err := loadTemplate("sites.html")
+	if err != nil {
+		logRequestf(r.Context(), "Template loading error: %v", err)
+		http.Error(w, "Template loading error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if page.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := tmpl.Execute(w, page); err != nil {
+		logRequestf(r.Context(), "Template execution error: %v", err)
+	}
+}
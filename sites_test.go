@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanSites(t *testing.T) {
+	plan, err := planSites(SitePlanRequest{
+		Supernet:   "10.0.0.0/16",
+		Names:      []string{"hq", "branch"},
+		Subnets:    []SiteSubnetClass{{Name: "p2p", Length: 30, Count: 2}, {Name: "users", Hosts: 200, VLAN: 10}, {Name: "voice", Hosts: 100, VLAN: 20}},
+		SpareSites: 1,
+	})
+	if err != nil {
+		t.Fatalf("planSites() error = %v", err)
+	}
+	if plan.SiteLength != 22 || len(plan.Sites) != 2 || !reflect.DeepEqual(plan.Spare, []string{"10.0.8.0/22"}) || !reflect.DeepEqual(plan.Free, []string{"10.0.12.0/22", "10.0.16.0/20", "10.0.32.0/19", "10.0.64.0/18", "10.0.128.0/17"}) {
+		t.Fatalf("planSites() = %+v", plan)
+	}
+	want := PlannedSite{
+		Name:  "branch",
+		Block: "10.0.4.0/22",
+		Subnets: []PlannedSiteSubnet{
+			{Name: "users", Prefix: "10.0.4.0/24", VLAN: 10, UsableHosts: 254},
+			{Name: "voice", Prefix: "10.0.5.0/25", VLAN: 20, UsableHosts: 126},
+			{Name: "p2p-1", Prefix: "10.0.5.128/30", UsableHosts: 2},
+			{Name: "p2p-2", Prefix: "10.0.5.132/30", UsableHosts: 2},
+		},
+		Growth: []string{"10.0.5.136/29", "10.0.5.144/28", "10.0.5.160/27", "10.0.5.192/26", "10.0.6.0/23"},
+	}
+	if !reflect.DeepEqual(plan.Sites[1], want) {
+		t.Errorf("site = %+v, want %+v", plan.Sites[1], want)
+	}
+
+	none := 0
+	if plan, err := planSites(SitePlanRequest{Supernet: "192.168.0.0/24", Sites: 4, Growth: &none, Subnets: []SiteSubnetClass{{Name: "lan", Length: 26}}}); err != nil || plan.SiteLength != 26 || plan.Sites[3].Name != "site4" || len(plan.Free) != 0 {
+		t.Errorf("planSites() without growth = %+v, %v", plan, err)
+	}
+	if _, err := planSites(SitePlanRequest{Supernet: "192.168.0.0/24", Sites: 5, Subnets: []SiteSubnetClass{{Name: "lan", Length: 27}}}); !errors.Is(err, errIPAMConflict) {
+		t.Errorf("planSites() of too many sites error = %v, want a conflict", err)
+	}
+
+	lan := []SiteSubnetClass{{Name: "lan", Hosts: 10}}
+	for _, req := range []SitePlanRequest{
+		{Sites: 1, Subnets: lan},
+		{Supernet: "10.0.0.0/8", PoolID: 1, Sites: 1, Subnets: lan},
+		{Supernet: "bogus", Sites: 1, Subnets: lan},
+		{Supernet: "10.0.0.0/8", Subnets: lan},
+		{Supernet: "10.0.0.0/8", Sites: 2, Names: []string{"a"}, Subnets: lan},
+		{Supernet: "10.0.0.0/8", Names: []string{"a", "a"}, Subnets: lan},
+		{Supernet: "10.0.0.0/8", Names: []string{"a b"}, Subnets: lan},
+		{Supernet: "10.0.0.0/8", Sites: 1},
+		{Supernet: "10.0.0.0/8", Sites: 1, Subnets: []SiteSubnetClass{{Name: "lan"}}},
+		{Supernet: "10.0.0.0/8", Sites: 1, Subnets: []SiteSubnetClass{{Name: "lan", Hosts: 10, Length: 28}}},
+		{Supernet: "10.0.0.0/8", Sites: 1, Subnets: []SiteSubnetClass{{Name: "lan", Length: 33}}},
+		{Supernet: "10.0.0.0/8", Sites: 1, Subnets: []SiteSubnetClass{{Name: "lan", Hosts: 10, VLAN: 4095}}},
+		{Supernet: "10.0.0.0/8", Sites: 1, Subnets: []SiteSubnetClass{{Name: "lan", Hosts: 10}, {Name: "lan", Hosts: 20}}},
+		{Supernet: "10.0.0.0/24", Sites: 1, Subnets: []SiteSubnetClass{{Name: "lan", Hosts: 200}}},
+		{Supernet: "10.0.0.0/8", Sites: 1, SpareSites: -1, Subnets: lan},
+	} {
+		if plan, err := planSites(req); err == nil || errors.Is(err, errIPAMConflict) {
+			t.Errorf("planSites(%+v) = %+v, %v, want a validation error", req, plan, err)
+		}
+	}
+}
+
+func TestSitePlanHandler(t *testing.T) {
+	m := withTestIPAM(t)
+	pool, _ := m.CreatePool(PoolRequest{Name: "corp", Prefix: "10.0.0.0/20"})
+	if _, err := m.Allocate(pool.ID, AllocationRequest{Prefix: "10.0.0.0/22"}); err != nil {
+		t.Fatal(err)
+	}
+	post := func(query, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		sitePlanHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/sites/plan"+query, strings.NewReader(body)))
+		return rr
+	}
+
+	body := fmt.Sprintf(`{"pool_id":%d,"sites":2,"subnets":[{"name":"lan","hosts":250}],"commit":true}`, pool.ID)
+	rr := post("", body)
+	var plan SitePlanResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &plan); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("POST: status %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(plan.Sites) != 2 || plan.Sites[0].Block != "10.0.4.0/23" || len(plan.Allocations) != 2 || plan.Allocations[1].Prefix != "10.0.6.0/23" || plan.Allocations[1].Description != "site site2" {
+		t.Errorf("POST = %+v", plan)
+	}
+	if allocations, _ := m.Allocations(pool.ID); len(allocations) != 3 {
+		t.Errorf("pool has %d allocations after the commit, want 3", len(allocations))
+	}
+
+	if rr := post("", body); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"block":"10.0.8.0/23"`) {
+		t.Errorf("second commit: status %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := post("", strings.Replace(body, `"sites":2`, `"sites":3`, 1)); rr.Code != http.StatusConflict {
+		t.Errorf("exhausted pool: status %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := post("", `{"pool_id":999,"sites":1,"subnets":[{"name":"lan","hosts":10}]}`); rr.Code != http.StatusNotFound {
+		t.Errorf("unknown pool: status %d", rr.Code)
+	}
+	if rr := post("", `{"supernet":"10.0.0.0/16","sites":1,"subnets":[{"name":"lan","hosts":10}],"commit":true}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("commit without a pool: status %d", rr.Code)
+	}
+	if rr := post("?format=csv", `{"supernet":"10.0.0.0/16","names":["hq"],"subnets":[{"name":"lan","length":24}]}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "hq/lan,10.0.0.0/24,") {
+		t.Errorf("CSV: status %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := post("?format=pdf", `{"supernet":"10.0.0.0/16","sites":1,"subnets":[{"name":"lan","length":24}]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("unsupported format: status %d", rr.Code)
+	}
+}
+
+func TestSitesPage(t *testing.T) {
+	submit := func(form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/sites", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		sitesPageHandler(rr, req)
+		return rr
+	}
+
+	rr := httptest.NewRecorder()
+	sitesPageHandler(rr, httptest.NewRequest(http.MethodGet, "/sites", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Plan Sites") {
+		t.Fatalf("GET /sites = %d", rr.Code)
+	}
+
+	form := url.Values{"supernet": {"172.16.0.0/16"}, "names": {"3"}, "subnets": {"users,200,1,10\np2p,/30,2"}, "growth": {"100"}, "spare_sites": {"0"}}
+	if rr = submit(form); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "172.16.8.0/22") || !strings.Contains(rr.Body.String(), "site3") {
+		t.Errorf("planning: status %d: %s", rr.Code, rr.Body.String())
+	}
+	form.Set("format", "csv")
+	if rr = submit(form); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "site2/p2p-2,172.16.5.4/30,") {
+		t.Errorf("CSV export: status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	form.Del("format")
+	form.Set("subnets", "users,lots")
+	if rr = submit(form); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "users,lots") {
+		t.Errorf("invalid class: status %d: %s", rr.Code, rr.Body.String())
+	}
+}
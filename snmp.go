@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BER tags of the SNMP messages, values and PDUs used by the discovery
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berSequence    = 0x30
+	snmpIPAddress  = 0x40
+	snmpCounter32  = 0x41
+	snmpGauge32    = 0x42
+	snmpTimeTicks  = 0x43
+	snmpEndOfMIB   = 0x82
+
+	snmpGetNext  = 0xa1
+	snmpResponse = 0xa2
+
+	snmpVersion2c = 1
+	// maxSNMPRows stops walks of agents that return endless or looping tables
+	maxSNMPRows = 100000
+)
+
+var errSNMP = errors.New("SNMP request failed")
+
+// snmpValue is the tag and content of a variable binding's value
+type snmpValue struct {
+	tag  byte
+	data []byte
+}
+
+// Int returns an INTEGER, Counter32, Gauge32 or TimeTicks value
+func (v snmpValue) Int() int64 {
+	var n int64
+	if v.tag == berInteger && len(v.data) > 0 && v.data[0]&0x80 != 0 {
+		n = -1
+	}
+	for _, b := range v.data {
+		n = n<<8 | int64(b)
+	}
+	return n
+}
+
+// IP returns an IpAddress value, or nil for other values
+func (v snmpValue) IP() net.IP {
+	if v.tag != snmpIPAddress || len(v.data) != 4 {
+		return nil
+	}
+	return net.IP(v.data).To4()
+}
+
+// snmpVarBind is an object identifier in dotted notation and its value
+type snmpVarBind struct {
+	oid   string
+	value snmpValue
+}
+
+// berEncode wraps content in a tag and a definite length
+func berEncode(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	switch n := len(content); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
+
+// berInt encodes an INTEGER in the fewest two's complement bytes
+func berInt(n int64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(n))
+	i := 0
+	for i < 7 && (b[i] == 0 && b[i+1]&0x80 == 0 || b[i] == 0xff && b[i+1]&0x80 != 0) {
+		i++
+	}
+	return berEncode(berInteger, b[i:])
+}
+
+// encodeOID encodes a dotted object identifier such as 1.3.6.1.2.1
+func encodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID: %s", oid)
+	}
+	arcs := make([]uint64, len(parts))
+	for i, p := range parts {
+		var err error
+		if arcs[i], err = strconv.ParseUint(p, 10, 32); err != nil {
+			return nil, fmt.Errorf("invalid OID: %s", oid)
+		}
+	}
+	if arcs[0] > 2 || arcs[0] < 2 && arcs[1] >= 40 {
+		return nil, fmt.Errorf("invalid OID: %s", oid)
+	}
+	arcs = append([]uint64{arcs[0]*40 + arcs[1]}, arcs[2:]...)
+	var content []byte
+	for _, arc := range arcs {
+		var chunk []byte
+		for {
+			chunk = append([]byte{byte(arc & 0x7f)}, chunk...)
+			if arc >>= 7; arc == 0 {
+				break
+			}
+		}
+		for i := 0; i < len(chunk)-1; i++ {
+			chunk[i] |= 0x80
+		}
+		content = append(content, chunk...)
+	}
+	return berEncode(berOID, content), nil
+}
+
+// decodeOID returns the dotted form of encoded object identifier content
+func decodeOID(b []byte) (string, error) {
+	var arcs []string
+	var arc uint64
+	for i, c := range b {
+		arc = arc<<7 | uint64(c&0x7f)
+		if arc > 1<<32 {
+			return "", fmt.Errorf("%w: OID arc too large", errSNMP)
+		}
+		if c&0x80 != 0 {
+			if i == len(b)-1 {
+				return "", fmt.Errorf("%w: truncated OID", errSNMP)
+			}
+			continue
+		}
+		if arcs == nil {
+			first := min(arc/40, 2)
+			arcs = append(arcs, strconv.FormatUint(first, 10), strconv.FormatUint(arc-first*40, 10))
+		} else {
+			arcs = append(arcs, strconv.FormatUint(arc, 10))
+		}
+		arc = 0
+	}
+	if arcs == nil {
+		return "", fmt.Errorf("%w: empty OID", errSNMP)
+	}
+	return strings.Join(arcs, "."), nil
+}
+
+// berRead splits the first element off b
+func berRead(b []byte) (tag byte, content, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, fmt.Errorf("%w: truncated message", errSNMP)
+	}
+	tag, n, b := b[0], int(b[1]), b[2:]
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 3 || len(b) < size {
+			return 0, nil, nil, fmt.Errorf("%w: unsupported length", errSNMP)
+		}
+		n = 0
+		for _, c := range b[:size] {
+			n = n<<8 | int(c)
+		}
+		b = b[size:]
+	}
+	if len(b) < n {
+		return 0, nil, nil, fmt.Errorf("%w: truncated message", errSNMP)
+	}
+	return tag, b[:n], b[n:], nil
+}
+
+// encodeSNMPMessage builds an SNMPv2c message carrying a PDU of the given type
+func encodeSNMPMessage(community string, pduType byte, requestID int32, errorStatus int, varBinds []snmpVarBind) ([]byte, error) {
+	var list []byte
+	for _, vb := range varBinds {
+		oid, err := encodeOID(vb.oid)
+		if err != nil {
+			return nil, err
+		}
+		value := berEncode(berNull, nil)
+		if vb.value.tag != 0 {
+			value = berEncode(vb.value.tag, vb.value.data)
+		}
+		list = append(list, berEncode(berSequence, append(oid, value...))...)
+	}
+	pdu := append(berInt(int64(requestID)), berInt(int64(errorStatus))...)
+	pdu = append(pdu, berInt(0)...)
+	pdu = append(pdu, berEncode(berSequence, list)...)
+	msg := append(berInt(snmpVersion2c), berEncode(berOctetString, []byte(community))...)
+	return berEncode(berSequence, append(msg, berEncode(pduType, pdu)...)), nil
+}
+
+// snmpMessage is a decoded SNMPv2c message
+type snmpMessage struct {
+	community   string
+	pduType     byte
+	requestID   int32
+	errorStatus int
+	varBinds    []snmpVarBind
+}
+
+// decodeSNMPMessage parses an SNMPv2c message
+func decodeSNMPMessage(b []byte) (*snmpMessage, error) {
+	tag, body, _, err := berRead(b)
+	if err != nil {
+		return nil, err
+	}
+	if tag != berSequence {
+		return nil, fmt.Errorf("%w: not an SNMP message", errSNMP)
+	}
+	var fields [3]snmpValue
+	for i := range fields {
+		if fields[i].tag, fields[i].data, body, err = berRead(body); err != nil {
+			return nil, err
+		}
+	}
+	if fields[0].tag != berInteger || fields[0].Int() != snmpVersion2c || fields[1].tag != berOctetString {
+		return nil, fmt.Errorf("%w: not an SNMPv2c message", errSNMP)
+	}
+	msg := &snmpMessage{community: string(fields[1].data), pduType: fields[2].tag}
+
+	pdu := fields[2].data
+	var header [4]snmpValue
+	for i := range header {
+		if header[i].tag, header[i].data, pdu, err = berRead(pdu); err != nil {
+			return nil, err
+		}
+	}
+	if header[3].tag != berSequence {
+		return nil, fmt.Errorf("%w: malformed PDU", errSNMP)
+	}
+	msg.requestID, msg.errorStatus = int32(header[0].Int()), int(header[1].Int())
+	for list := header[3].data; len(list) > 0; {
+		var vb []byte
+		if tag, vb, list, err = berRead(list); err != nil {
+			return nil, err
+		}
+		var oidTag byte
+		var oid []byte
+		var value snmpValue
+		if oidTag, oid, vb, err = berRead(vb); err != nil {
+			return nil, err
+		}
+		if value.tag, value.data, _, err = berRead(vb); err != nil {
+			return nil, err
+		}
+		if tag != berSequence || oidTag != berOID {
+			return nil, fmt.Errorf("%w: malformed variable binding", errSNMP)
+		}
+		dotted, err := decodeOID(oid)
+		if err != nil {
+			return nil, err
+		}
+		msg.varBinds = append(msg.varBinds, snmpVarBind{oid: dotted, value: value})
+	}
+	return msg, nil
+}
+
+// compareOIDs orders dotted object identifiers arc by arc
+func compareOIDs(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, _ := strconv.ParseUint(as[i], 10, 64)
+		y, _ := strconv.ParseUint(bs[i], 10, 64)
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// snmpClient walks the MIB of one agent with SNMPv2c GetNext requests over UDP
+type snmpClient struct {
+	target    string
+	community string
+	timeout   time.Duration
+	retries   int
+}
+
+// getNext sends one request, retrying when no answer arrives within the timeout
+func (c *snmpClient) getNext(ctx context.Context, conn net.Conn, oid string) (snmpVarBind, error) {
+	requestID := rand.Int31()
+	request, err := encodeSNMPMessage(c.community, snmpGetNext, requestID, 0, []snmpVarBind{{oid: oid}})
+	if err != nil {
+		return snmpVarBind{}, err
+	}
+	buf := make([]byte, 65535)
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return snmpVarBind{}, err
+		}
+		if _, err := conn.Write(request); err != nil {
+			return snmpVarBind{}, fmt.Errorf("%w: %v", errSNMP, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(c.timeout))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break
+			}
+			msg, err := decodeSNMPMessage(buf[:n])
+			if err != nil || msg.pduType != snmpResponse || msg.requestID != requestID {
+				continue
+			}
+			if msg.errorStatus != 0 || len(msg.varBinds) != 1 {
+				return snmpVarBind{}, fmt.Errorf("%w: agent returned error status %d", errSNMP, msg.errorStatus)
+			}
+			return msg.varBinds[0], nil
+		}
+	}
+	return snmpVarBind{}, fmt.Errorf("%w: no response from %s (wrong community or unreachable agent)", errSNMP, c.target)
+}
+
+// walk calls fn for every object under root, in order
+func (c *snmpClient) walk(ctx context.Context, root string, fn func(vb snmpVarBind)) error {
+	conn, err := net.Dial("udp", c.target)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errSNMP, err)
+	}
+	defer conn.Close()
+	oid := root
+	for rows := 0; rows < maxSNMPRows; rows++ {
+		vb, err := c.getNext(ctx, conn, oid)
+		if err != nil {
+			return err
+		}
+		if vb.value.tag == snmpEndOfMIB || !strings.HasPrefix(vb.oid, root+".") {
+			return nil
+		}
+		if compareOIDs(vb.oid, oid) <= 0 {
+			return fmt.Errorf("%w: agent returned %s after %s", errSNMP, vb.oid, oid)
+		}
+		fn(vb)
+		oid = vb.oid
+	}
+	return fmt.Errorf("%w: more than %d objects under %s", errSNMP, maxSNMPRows, root)
+}
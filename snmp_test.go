@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"testing"
+)
+
+// fakeSNMPAgent answers GetNext requests from an object table over UDP
+type fakeSNMPAgent struct {
+	conn      net.PacketConn
+	community string
+	objects   map[string]snmpValue
+}
+
+// startFakeSNMPAgent serves objects on a loopback port until the test ends
+func startFakeSNMPAgent(t *testing.T, community string, objects map[string]snmpValue) *fakeSNMPAgent {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	agent := &fakeSNMPAgent{conn: conn, community: community, objects: objects}
+	go agent.serve()
+	return agent
+}
+
+func (a *fakeSNMPAgent) serve() {
+	oids := make([]string, 0, len(a.objects))
+	for oid := range a.objects {
+		oids = append(oids, oid)
+	}
+	sort.Slice(oids, func(i, j int) bool { return compareOIDs(oids[i], oids[j]) < 0 })
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req, err := decodeSNMPMessage(buf[:n])
+		// agents drop requests with a wrong community
+		if err != nil || req.community != a.community || req.pduType != snmpGetNext {
+			continue
+		}
+		next := snmpVarBind{oid: req.varBinds[0].oid, value: snmpValue{tag: snmpEndOfMIB}}
+		for _, oid := range oids {
+			if compareOIDs(oid, req.varBinds[0].oid) > 0 {
+				next = snmpVarBind{oid: oid, value: a.objects[oid]}
+				break
+			}
+		}
+		resp, _ := encodeSNMPMessage(req.community, snmpResponse, req.requestID, 0, []snmpVarBind{next})
+		a.conn.WriteTo(resp, addr)
+	}
+}
+
+func (a *fakeSNMPAgent) target() string {
+	return a.conn.LocalAddr().String()
+}
+
+func TestSNMPEncoding(t *testing.T) {
+	for _, oid := range []string{"1.3.6.1.2.1.4.20.1.2.10.0.1.1", "1.3.6.1.4.1.9.9.4294967295", "2.999.3"} {
+		encoded, err := encodeOID(oid)
+		if err != nil {
+			t.Fatalf("encodeOID(%s): %v", oid, err)
+		}
+		_, content, _, _ := berRead(encoded)
+		if got, err := decodeOID(content); err != nil || got != oid {
+			t.Errorf("decodeOID(encodeOID(%s)) = %s, %v", oid, got, err)
+		}
+	}
+	if encoded, _ := encodeOID("1.3.6.1"); !bytes.Equal(encoded, []byte{0x06, 0x03, 0x2b, 0x06, 0x01}) {
+		t.Errorf("encodeOID(1.3.6.1) = % x", encoded)
+	}
+	for _, oid := range []string{"1", "1.40", "3.1", "1.3.x"} {
+		if _, err := encodeOID(oid); err == nil {
+			t.Errorf("encodeOID(%s) expected an error", oid)
+		}
+	}
+	for _, n := range []int64{0, 127, 128, 255, 256, -1, -129, 2147483647} {
+		_, content, _, _ := berRead(berInt(n))
+		if got := (snmpValue{tag: berInteger, data: content}).Int(); got != n {
+			t.Errorf("berInt(%d) decodes to %d", n, got)
+		}
+	}
+
+	long := bytes.Repeat([]byte("x"), 300)
+	msg, err := encodeSNMPMessage("secret", snmpResponse, 42, 0, []snmpVarBind{
+		{oid: "1.3.6.1.2.1.1.5.0", value: snmpValue{tag: berOctetString, data: long}},
+		{oid: "1.3.6.1.2.1.4.20.1.3.10.0.1.1", value: snmpValue{tag: snmpIPAddress, data: []byte{255, 255, 255, 0}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodeSNMPMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.community != "secret" || decoded.requestID != 42 || len(decoded.varBinds) != 2 ||
+		!bytes.Equal(decoded.varBinds[0].value.data, long) || decoded.varBinds[1].value.IP().String() != "255.255.255.0" {
+		t.Errorf("decoded message = %+v", decoded)
+	}
+	for i := range msg {
+		if _, err := decodeSNMPMessage(msg[:i]); err == nil {
+			t.Fatalf("decoding %d of %d bytes expected an error", i, len(msg))
+		}
+	}
+}
+
+func TestCompareOIDs(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.3.6.1.2", "1.3.6.1.10", -1},
+		{"1.3.6.1.2.1", "1.3.6.1.2", 1},
+		{"1.3.6", "1.3.6", 0},
+	}
+	for _, tt := range tests {
+		if got := compareOIDs(tt.a, tt.b); got < 0 != (tt.want < 0) || got > 0 != (tt.want > 0) {
+			t.Errorf("compareOIDs(%s, %s) = %d, want sign of %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
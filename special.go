@@ -0,0 +1,176 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sort"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// SpecialPurposeBlock is an entry of the IANA IPv4 Special-Purpose Address Registry
+// (RFC 6890) or of the bogon list. Forwardable and Global are the registry columns;
+// Bogon marks blocks that should never appear as routes or sources on the internet
+type SpecialPurposeBlock struct {
+	Prefix      string `json:"prefix"`
+	Name        string `json:"name"`
+	RFC         string `json:"rfc"`
+	Forwardable bool   `json:"forwardable"`
+	Global      bool   `json:"global"`
+	Bogon       bool   `json:"bogon"`
+	Advice      string `json:"advice,omitempty"`
+}
+
+// specialPurposeBlocks follows the IANA registry, most general blocks first, plus
+// multicast which is not in the registry but is a bogon
+var specialPurposeBlocks = []SpecialPurposeBlock{
+	{"0.0.0.0/8", "This network", "RFC 791", false, false, true, "Only valid as a source during bootstrapping; never route it."},
+	{"0.0.0.0/32", "This host on this network", "RFC 1122", false, false, true, "The unspecified address; do not assign it."},
+	{"10.0.0.0/8", "Private-Use", "RFC 1918", true, false, true, "Private addressing; NAT it before it reaches the internet."},
+	{"100.64.0.0/10", "Shared Address Space", "RFC 6598", true, false, true, "Reserved for carrier-grade NAT; do not use it as customer address space."},
+	{"127.0.0.0/8", "Loopback", "RFC 1122", false, false, true, "Never leaves the host; do not assign it to interfaces."},
+	{"169.254.0.0/16", "Link Local", "RFC 3927", false, false, true, "Automatic addressing of one link; not routed."},
+	{"172.16.0.0/12", "Private-Use", "RFC 1918", true, false, true, "Private addressing; NAT it before it reaches the internet."},
+	{"192.0.0.0/24", "IETF Protocol Assignments", "RFC 6890", false, false, true, "Reserved for protocol assignments; do not use it for hosts."},
+	{"192.0.0.0/29", "IPv4 Service Continuity Prefix", "RFC 7335", true, false, true, "Reserved for DS-Lite and 464XLAT; do not use it for hosts."},
+	{"192.0.0.8/32", "IPv4 dummy address", "RFC 7600", false, false, true, "Only used as a source when no other address is available."},
+	{"192.0.0.9/32", "Port Control Protocol Anycast", "RFC 7723", true, true, false, ""},
+	{"192.0.0.10/32", "Traversal Using Relays around NAT Anycast", "RFC 8155", true, true, false, ""},
+	{"192.0.0.170/32", "NAT64/DNS64 Discovery", "RFC 8880", false, false, true, "Used to discover NAT64 prefixes; do not assign it."},
+	{"192.0.0.171/32", "NAT64/DNS64 Discovery", "RFC 8880", false, false, true, "Used to discover NAT64 prefixes; do not assign it."},
+	{"192.0.2.0/24", "Documentation (TEST-NET-1)", "RFC 5737", false, false, true, "Documentation range; don't route it or use it in production."},
+	{"192.31.196.0/24", "AS112-v4", "RFC 7535", true, true, false, ""},
+	{"192.52.193.0/24", "AMT", "RFC 7450", true, true, false, ""},
+	{"192.88.99.0/24", "Deprecated (6to4 Relay Anycast)", "RFC 7526", false, false, false, "6to4 relay anycast is deprecated; do not announce or use it."},
+	{"192.168.0.0/16", "Private-Use", "RFC 1918", true, false, true, "Private addressing; NAT it before it reaches the internet."},
+	{"192.175.48.0/24", "Direct Delegation AS112 Service", "RFC 7534", true, true, false, ""},
+	{"198.18.0.0/15", "Benchmarking", "RFC 2544", true, false, true, "Reserved for network benchmarks; don't route it or use it in production."},
+	{"198.51.100.0/24", "Documentation (TEST-NET-2)", "RFC 5737", false, false, true, "Documentation range; don't route it or use it in production."},
+	{"203.0.113.0/24", "Documentation (TEST-NET-3)", "RFC 5737", false, false, true, "Documentation range; don't route it or use it in production."},
+	{"224.0.0.0/4", "Multicast", "RFC 5771", true, false, true, "Multicast group addresses; they cannot be assigned to hosts or subnets."},
+	{"240.0.0.0/4", "Reserved", "RFC 1112", false, false, true, "Reserved for future use; most equipment will not route it."},
+	{"255.255.255.255/32", "Limited Broadcast", "RFC 919", false, false, true, "Never forwarded by routers; do not assign it."},
+}
+
+// Relations of a network to a special-purpose block
+const (
+	specialWithin   = "within"
+	specialContains = "contains"
+)
+
+// SpecialPurposeMatch is a special-purpose block overlapping a network. Relation is
+// within when the network is inside the block and contains when it spans the block
+type SpecialPurposeMatch struct {
+	SpecialPurposeBlock
+	Relation string `json:"relation"`
+}
+
+// specialPurposeRanges are the parsed blocks in the order of specialPurposeBlocks
+var specialPurposeRanges = func() []cidrset.Range {
+	ranges := make([]cidrset.Range, len(specialPurposeBlocks))
+	for i, b := range specialPurposeBlocks {
+		_, network, _ := net.ParseCIDR(b.Prefix)
+		ranges[i] = cidrset.PrefixToRange(network)
+	}
+	return ranges
+}()
+
+// specialPurposeMatches returns the blocks overlapping network: the blocks it is
+// within, the most specific first, then the blocks it contains
+func specialPurposeMatches(network *net.IPNet) []SpecialPurposeMatch {
+	r := cidrset.PrefixToRange(network)
+	var within, contains []int
+	for i, block := range specialPurposeRanges {
+		switch {
+		case block.First <= r.First && r.Last <= block.Last:
+			within = append(within, i)
+		case r.First <= block.First && block.Last <= r.Last:
+			contains = append(contains, i)
+		}
+	}
+	sort.SliceStable(within, func(a, b int) bool {
+		return specialPurposeRanges[within[a]].Size() < specialPurposeRanges[within[b]].Size()
+	})
+	var matches []SpecialPurposeMatch
+	for _, i := range within {
+		matches = append(matches, SpecialPurposeMatch{specialPurposeBlocks[i], specialWithin})
+	}
+	for _, i := range contains {
+		matches = append(matches, SpecialPurposeMatch{specialPurposeBlocks[i], specialContains})
+	}
+	return matches
+}
+
+// specialPurposeOf validates the network of a calculation, returning nil for an
+// invalid address or mask
+func specialPurposeOf(address, mask string) []SpecialPurposeMatch {
+	ip := net.ParseIP(address).To4()
+	subnetMask, err := parseSubnetMask(mask)
+	if ip == nil || err != nil {
+		return nil
+	}
+	return specialPurposeMatches(&net.IPNet{IP: ip.Mask(subnetMask), Mask: subnetMask})
+}
+
+// globallyReachable reports whether a network with the given matches is public: the
+// most specific block it is within decides, and it spans no special-purpose block
+func globallyReachable(matches []SpecialPurposeMatch) bool {
+	if len(matches) == 0 {
+		return true
+	}
+	return matches[0].Relation == specialWithin && matches[0].Global && matches[len(matches)-1].Relation == specialWithin
+}
+
+// isPublicIPv4 reports whether an address is globally reachable, so a registry or
+// routing table knows it
+func isPublicIPv4(ip net.IP) bool {
+	ip = ip.To4()
+	return ip != nil && globallyReachable(specialPurposeMatches(&net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}))
+}
+
+// specialPurposeHandler serves GET /api/v1/special-purpose: the whole registry, or
+// with prefix (or ip and mask) the blocks that network falls into or spans
+func specialPurposeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	query := r.URL.Query()
+	var network *net.IPNet
+	switch {
+	case query.Get("prefix") != "":
+		var err error
+		if network, err = parseIPv4Prefix(query.Get("prefix")); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	case query.Get("ip") != "":
+		ip := net.ParseIP(query.Get("ip")).To4()
+		if ip == nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid IP address: "+query.Get("ip"))
+			return
+		}
+		mask := net.CIDRMask(32, 32)
+		if query.Get("mask") != "" {
+			var err error
+			if mask, err = parseSubnetMask(query.Get("mask")); err != nil {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		network = &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	default:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"blocks": specialPurposeBlocks})
+		return
+	}
+	matches := specialPurposeMatches(network)
+	if matches == nil {
+		matches = []SpecialPurposeMatch{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"prefix":  network.String(),
+		"public":  globallyReachable(matches),
+		"matches": matches,
+	})
+}
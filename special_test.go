@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSpecialPurposeMatches(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"192.0.2.128/25", "within 192.0.2.0/24"},
+		{"192.0.0.0/24", "within 192.0.0.0/24, contains 192.0.0.0/29, contains 192.0.0.8/32, contains 192.0.0.9/32, contains 192.0.0.10/32, contains 192.0.0.170/32, contains 192.0.0.171/32"},
+		{"192.0.0.9/32", "within 192.0.0.9/32, within 192.0.0.0/24"},
+		{"0.0.0.0/0", ""},
+		{"8.8.8.0/24", ""},
+	}
+	for _, tt := range tests {
+		network, _ := parseIPv4Prefix(tt.prefix)
+		var got []string
+		for _, m := range specialPurposeMatches(network) {
+			got = append(got, m.Relation+" "+m.Prefix)
+		}
+		if tt.prefix == "0.0.0.0/0" {
+			if len(got) != len(specialPurposeBlocks) {
+				t.Errorf("0.0.0.0/0 contains %d blocks, want all %d", len(got), len(specialPurposeBlocks))
+			}
+			continue
+		}
+		if strings.Join(got, ", ") != tt.want {
+			t.Errorf("specialPurposeMatches(%s) = %s, want %s", tt.prefix, strings.Join(got, ", "), tt.want)
+		}
+	}
+}
+
+func TestIsPublicIPv4(t *testing.T) {
+	for address, want := range map[string]bool{
+		"8.8.8.8":         true,
+		"192.0.0.9":       true,
+		"192.31.196.1":    true,
+		"10.1.2.3":        false,
+		"100.64.0.1":      false,
+		"192.0.2.10":      false,
+		"198.51.100.7":    false,
+		"198.19.0.1":      false,
+		"224.0.0.5":       false,
+		"250.0.0.1":       false,
+		"255.255.255.255": false,
+	} {
+		if got := isPublicIPv4(net.ParseIP(address)); got != want {
+			t.Errorf("isPublicIPv4(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestSpecialPurposeHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	specialPurposeHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/special-purpose?ip=203.0.113.77&mask=/26", nil))
+	var resp struct {
+		Prefix  string
+		Public  bool
+		Matches []SpecialPurposeMatch
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v (%s)", err, rr.Body.String())
+	}
+	if resp.Prefix != "203.0.113.64/26" || resp.Public || len(resp.Matches) != 1 || !resp.Matches[0].Bogon || !strings.Contains(resp.Matches[0].Advice, "Documentation") {
+		t.Errorf("special-purpose = %+v", resp)
+	}
+
+	rr = httptest.NewRecorder()
+	calculateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=198.51.100.1&mask=/24", nil))
+	var result SubnetResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil || len(result.SpecialPurpose) != 1 || result.SpecialPurpose[0].Name != "Documentation (TEST-NET-2)" {
+		t.Errorf("calculate special_purpose = %+v, %v", result.SpecialPurpose, err)
+	}
+
+	rr = httptest.NewRecorder()
+	specialPurposeHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/special-purpose?prefix=bogus", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("invalid prefix status = %d, want 400", rr.Code)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// spoolMemory is how much of a spooled body is kept in memory; the rest goes to a
+// temporary file
+const spoolMemory = 1 << 20
+
+// spool holds a request body until it is processed, so a job waiting in the queue
+// keeps at most spoolMemory bytes of its input in memory however large it is. The
+// temporary file is removed as soon as it is created where the system allows it, so
+// a spool that is never closed is cleaned up with its file handle
+type spool struct {
+	limit   int // bytes kept in memory, spoolMemory when 0
+	mem     []byte
+	file    *os.File
+	size    int64
+	removed bool
+}
+
+// newSpool copies r into a spool
+func newSpool(r io.Reader) (*spool, error) {
+	s := &spool{}
+	if _, err := io.Copy(s, r); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write appends p, spilling to a temporary file once the memory limit is reached
+func (s *spool) Write(p []byte) (int, error) {
+	limit := s.limit
+	if limit == 0 {
+		limit = spoolMemory
+	}
+	if s.file == nil && len(s.mem)+len(p) <= limit {
+		s.mem = append(s.mem, p...)
+		return len(p), nil
+	}
+	if s.file == nil {
+		f, err := os.CreateTemp("", "go-subnet-calculator-spool-*")
+		if err != nil {
+			return 0, err
+		}
+		s.file, s.removed = f, os.Remove(f.Name()) == nil
+	}
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+// Reader reads the spooled data from the start
+func (s *spool) Reader() io.Reader {
+	if s.file == nil {
+		return bytes.NewReader(s.mem)
+	}
+	return io.MultiReader(bytes.NewReader(s.mem), io.NewSectionReader(s.file, 0, s.size))
+}
+
+// Close releases the temporary file
+func (s *spool) Close() error {
+	s.mem = nil
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	if !s.removed {
+		err = os.Remove(s.file.Name())
+	}
+	s.file = nil
+	return err
+}
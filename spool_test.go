@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSpool(t *testing.T) {
+	small, err := newSpool(strings.NewReader("prefix\n10.0.0.0/8\n"))
+	if err != nil || small.file != nil {
+		t.Fatalf("newSpool() = %v, file %v", err, small.file)
+	}
+	if data, _ := io.ReadAll(small.Reader()); string(data) != "prefix\n10.0.0.0/8\n" {
+		t.Errorf("small spool = %q", data)
+	}
+	small.Close()
+
+	input := bytes.Repeat([]byte("10.0.0.0/24,a description\n"), 3*spoolMemory/26)
+	large, err := newSpool(bytes.NewReader(input))
+	if err != nil || large.file == nil || len(large.mem) > spoolMemory {
+		t.Fatalf("newSpool() = %v, %d bytes in memory", err, len(large.mem))
+	}
+	for i := 0; i < 2; i++ {
+		if data, _ := io.ReadAll(large.Reader()); !bytes.Equal(data, input) {
+			t.Fatalf("read %d of the spilled spool returned %d bytes, want %d", i, len(data), len(input))
+		}
+	}
+	name := large.file.Name()
+	if err := large.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("the spool file is left behind: %v", err)
+	}
+}
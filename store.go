@@ -0,0 +1,196 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqlDialect holds the differences between the supported databases. Queries are
+// written with ? placeholders and rewritten by rebind where the database needs it
+type sqlDialect struct {
+	name       string
+	driver     string
+	defaultDSN string
+	// idColumn is the column definition of an auto-incrementing primary key
+	idColumn string
+	rebind   func(query string) string
+}
+
+var sqlDialects = map[string]sqlDialect{
+	"sqlite": {
+		name:       "sqlite",
+		driver:     "sqlite",
+		defaultDSN: "subnet-calculator.db",
+		idColumn:   "INTEGER PRIMARY KEY AUTOINCREMENT",
+		rebind:     func(query string) string { return query },
+	},
+	"postgres": {
+		name:     "postgres",
+		driver:   "postgres",
+		idColumn: "BIGSERIAL PRIMARY KEY",
+		rebind:   dollarPlaceholders,
+	},
+}
+
+// dollarPlaceholders rewrites ? placeholders as $1, $2, ... for PostgreSQL
+func dollarPlaceholders(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// sqlMigration is one schema change. The {{id}} token in Up is replaced with the
+// dialect's auto-incrementing primary key definition
+type sqlMigration struct {
+	Version int
+	Name    string
+	Up      []string
+}
+
+var sqlMigrations []sqlMigration
+
+// registerMigration adds a schema change; versions must be unique and are applied in order
+func registerMigration(m sqlMigration) {
+	for _, existing := range sqlMigrations {
+		if existing.Version == m.Version {
+			panic(fmt.Sprintf("duplicate migration version %d (%s and %s)", m.Version, existing.Name, m.Name))
+		}
+	}
+	sqlMigrations = append(sqlMigrations, m)
+	slices.SortFunc(sqlMigrations, func(a, b sqlMigration) int { return a.Version - b.Version })
+}
+
+// migrate applies every migration newer than the recorded schema version, each in its own transaction
+func migrate(db *sql.DB, dialect sqlDialect) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("creating schema_migrations: %v", err)
+	}
+
+	var current int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return fmt.Errorf("reading schema version: %v", err)
+	}
+
+	for _, m := range sqlMigrations {
+		if m.Version <= current {
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, stmt := range m.Up {
+			if _, err := tx.Exec(strings.ReplaceAll(stmt, "{{id}}", dialect.idColumn)); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d (%s): %v", m.Version, m.Name, err)
+			}
+		}
+		if _, err := tx.Exec(dialect.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+			m.Version, m.Name, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("recording migration %d: %v", m.Version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d (%s): %v", m.Version, m.Name, err)
+		}
+		log.Printf("Applied migration %d: %s", m.Version, m.Name)
+	}
+	return nil
+}
+
+// storageDB is the open database when persistent storage is configured, nil otherwise
+var storageDB *sql.DB
+
+// configureStorage opens the database selected by GO_SUBNET_CALCULATOR_DB_DRIVER
+// (sqlite by default, postgres or memory) and GO_SUBNET_CALCULATOR_DB_DSN, migrates it
+// and switches the stateful subsystems to it. SQLite is compiled in unless built with
+// the nosqlite tag and PostgreSQL with the postgres tag; a driver that is not compiled
+// in is a startup error rather than a silent switch to memory
+func configureStorage() error {
+	name := strings.ToLower(os.Getenv("GO_SUBNET_CALCULATOR_DB_DRIVER"))
+	if name == "" {
+		name = "sqlite"
+	}
+	if name == "memory" {
+		log.Printf("Storage: in-memory, data is lost on restart")
+		recordSystemAudit("config.storage", "memory", "in-memory storage selected")
+		return nil
+	}
+
+	dialect, ok := sqlDialects[name]
+	if !ok {
+		return fmt.Errorf("unknown database driver %q, must be sqlite, postgres or memory", name)
+	}
+	if !slices.Contains(sql.Drivers(), dialect.driver) {
+		if name == "sqlite" {
+			return fmt.Errorf("database driver sqlite is not compiled in; rebuild without -tags nosqlite or set GO_SUBNET_CALCULATOR_DB_DRIVER=memory")
+		}
+		return fmt.Errorf("database driver %q is not compiled in; rebuild with -tags %s", name, name)
+	}
+
+	dsn, err := loadSecret("GO_SUBNET_CALCULATOR_DB_DSN")
+	if err != nil {
+		return err
+	}
+	if dsn == "" {
+		if dialect.defaultDSN == "" {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_DB_DSN is required for %s", name)
+		}
+		dsn = dialect.defaultDSN
+	}
+
+	db, err := sql.Open(dialect.driver, dsn)
+	if err != nil {
+		return err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return fmt.Errorf("connecting to %s: %v", name, err)
+	}
+	if err := migrate(db, dialect); err != nil {
+		db.Close()
+		return err
+	}
+
+	storageDB = db
+	registerSelfTestCheck("storage", db.Ping)
+	ipamService = newIPAM(newSQLIPAMStore(db, dialect))
+	auditLog = newSQLAuditStore(db, dialect)
+	apiKeyStore = newSQLAPIKeyStore(db, dialect)
+	calculationStore = newSQLCalculationStore(db, dialect)
+	shareLinkStore = newSQLShareLinkStore(db, dialect)
+	log.Printf("Storage: %s", name)
+	recordSystemAudit("config.storage", name, "database storage opened and migrated")
+	return nil
+}
+
+// execOne runs a statement that must affect exactly one row, returning
+// errIPAMNotFound when it matched nothing
+func execOne(db *sql.DB, dialect sqlDialect, query string, args ...interface{}) error {
+	res, err := db.Exec(dialect.rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errIPAMNotFound
+	}
+	return nil
+}
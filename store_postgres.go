@@ -0,0 +1,6 @@
+//go:build postgres
+
+package main
+
+// The PostgreSQL driver registers itself as "postgres". Build with -tags postgres
+import _ "github.com/lib/pq"
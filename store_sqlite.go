@@ -0,0 +1,7 @@
+//go:build !js && !nosqlite
+
+package main
+
+// The pure-Go SQLite driver registers itself as "sqlite". It is compiled in by
+// default; build with -tags nosqlite to leave it out
+import _ "modernc.org/sqlite"
@@ -0,0 +1,58 @@
+//go:build !js && !nosqlite
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// withTestSQLite opens a SQLite database in a temporary directory as the storage of
+// every stateful subsystem, restoring them afterwards
+func withTestSQLite(t *testing.T) {
+	t.Helper()
+	withTestIPAM(t)
+	previousAudit, previousKeys := auditLog, apiKeyStore
+	previousCalculations, previousLinks := calculationStore, shareLinkStore
+	t.Cleanup(func() {
+		if storageDB != nil {
+			storageDB.Close()
+			storageDB = nil
+		}
+		auditLog, apiKeyStore = previousAudit, previousKeys
+		calculationStore, shareLinkStore = previousCalculations, previousLinks
+	})
+	t.Setenv("GO_SUBNET_CALCULATOR_DB_DRIVER", "")
+	t.Setenv("GO_SUBNET_CALCULATOR_DB_DSN", filepath.Join(t.TempDir(), "subnet-calculator.db"))
+	if err := configureStorage(); err != nil {
+		t.Fatalf("configureStorage() unexpected error: %v", err)
+	}
+	if storageDB == nil {
+		t.Fatal("configureStorage() did not open SQLite by default")
+	}
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	withTestSQLite(t)
+
+	pool, err := ipamService.CreatePool(PoolRequest{Name: "dc1", Prefix: "10.0.0.0/16"})
+	if err != nil {
+		t.Fatalf("CreatePool() unexpected error: %v", err)
+	}
+	a, err := ipamService.Allocate(pool.ID, AllocationRequest{Size: 24, Description: "web"})
+	if err != nil || a.Prefix != "10.0.0.0/24" {
+		t.Fatalf("Allocate() = %+v, %v", a, err)
+	}
+	if _, err := ipamService.Allocate(pool.ID, AllocationRequest{Prefix: "10.0.0.128/25"}); err == nil {
+		t.Error("Allocate() of an overlapping prefix succeeded")
+	}
+	if allocations, err := ipamService.Allocations(pool.ID); err != nil || len(allocations) != 1 {
+		t.Errorf("Allocations() = %+v, %v", allocations, err)
+	}
+	if err := ipamService.Release(a.ID); err != nil {
+		t.Errorf("Release() unexpected error: %v", err)
+	}
+	if entries, err := auditLog.List(AuditFilter{Limit: 10}); err != nil || len(entries) == 0 {
+		t.Errorf("audit entries = %+v, %v", entries, err)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingDriver is a minimal database/sql driver that records executed statements
+// and answers the schema-version query, enough to exercise migrate
+type recordingDriver struct {
+	mu         sync.Mutex
+	statements []string
+	version    int64
+	failOn     string
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return &recordingConn{d}, nil }
+
+// recordingDriver is its own connector so tests can use sql.OpenDB without registering it
+func (d *recordingDriver) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{d}, nil
+}
+func (d *recordingDriver) Driver() driver.Driver { return d }
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{c.d, query}, nil
+}
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return recordingTx{}, nil }
+
+type recordingTx struct{}
+
+func (recordingTx) Commit() error   { return nil }
+func (recordingTx) Rollback() error { return nil }
+
+type recordingStmt struct {
+	d     *recordingDriver
+	query string
+}
+
+func (s *recordingStmt) Close() error  { return nil }
+func (s *recordingStmt) NumInput() int { return -1 }
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if s.d.failOn != "" && strings.Contains(s.query, s.d.failOn) {
+		return nil, errors.New("boom")
+	}
+	s.d.statements = append(s.d.statements, s.query)
+	if strings.HasPrefix(s.query, "INSERT INTO schema_migrations") {
+		s.d.version = args[0].(int64)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	return &versionRows{version: s.d.version}, nil
+}
+
+type versionRows struct {
+	version int64
+	done    bool
+}
+
+func (r *versionRows) Columns() []string { return []string{"version"} }
+func (r *versionRows) Close() error      { return nil }
+func (r *versionRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.version
+	return nil
+}
+
+// openRecordingDB returns a database backed by a fresh recordingDriver
+func openRecordingDB(t *testing.T) (*sql.DB, *recordingDriver) {
+	t.Helper()
+	d := &recordingDriver{}
+	db := sql.OpenDB(d)
+	t.Cleanup(func() { db.Close() })
+	return db, d
+}
+
+// withMigrations replaces the registered migrations for the duration of a test
+func withMigrations(t *testing.T, migrations ...sqlMigration) {
+	t.Helper()
+	previous := sqlMigrations
+	sqlMigrations = nil
+	for _, m := range migrations {
+		registerMigration(m)
+	}
+	t.Cleanup(func() { sqlMigrations = previous })
+}
+
+func TestDollarPlaceholders(t *testing.T) {
+	got := dollarPlaceholders("UPDATE t SET a = ?, b = ? WHERE id = ?")
+	if want := "UPDATE t SET a = $1, b = $2 WHERE id = $3"; got != want {
+		t.Errorf("dollarPlaceholders() = %q, want %q", got, want)
+	}
+}
+
+func TestRegisterMigration(t *testing.T) {
+	withMigrations(t, sqlMigration{Version: 2, Name: "second"}, sqlMigration{Version: 1, Name: "first"})
+	if sqlMigrations[0].Version != 1 || sqlMigrations[1].Version != 2 {
+		t.Errorf("migrations not sorted by version: %+v", sqlMigrations)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registerMigration() with a duplicate version should panic")
+		}
+	}()
+	registerMigration(sqlMigration{Version: 2, Name: "again"})
+}
+
+func TestMigrate(t *testing.T) {
+	withMigrations(t,
+		sqlMigration{Version: 1, Name: "one", Up: []string{"CREATE TABLE a (id {{id}})"}},
+		sqlMigration{Version: 2, Name: "two", Up: []string{"CREATE TABLE b (id {{id}})", "CREATE INDEX b_id ON b (id)"}},
+	)
+	db, d := openRecordingDB(t)
+
+	if err := migrate(db, sqlDialects["postgres"]); err != nil {
+		t.Fatalf("migrate() unexpected error: %v", err)
+	}
+	want := []string{
+		"CREATE TABLE a (id BIGSERIAL PRIMARY KEY)",
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+		"CREATE TABLE b (id BIGSERIAL PRIMARY KEY)",
+		"CREATE INDEX b_id ON b (id)",
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+	}
+	got := d.statements[1:] // after CREATE TABLE IF NOT EXISTS schema_migrations
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("migrate() executed:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if d.version != 2 {
+		t.Errorf("recorded version = %d, want 2", d.version)
+	}
+
+	// A second run finds everything applied
+	d.statements = nil
+	if err := migrate(db, sqlDialects["postgres"]); err != nil || len(d.statements) != 1 {
+		t.Errorf("second migrate() = %v, executed %v; want only the schema_migrations check", err, d.statements)
+	}
+}
+
+func TestMigrateFailure(t *testing.T) {
+	withMigrations(t,
+		sqlMigration{Version: 1, Name: "one", Up: []string{"CREATE TABLE a (id {{id}})"}},
+		sqlMigration{Version: 2, Name: "broken", Up: []string{"CREATE TABLE broken (id {{id}})"}},
+	)
+	db, d := openRecordingDB(t)
+	d.failOn = "broken"
+
+	err := migrate(db, sqlDialects["sqlite"])
+	if err == nil || !strings.Contains(err.Error(), "migration 2 (broken)") {
+		t.Errorf("migrate() error = %v, want failure in migration 2", err)
+	}
+	if d.version != 1 {
+		t.Errorf("recorded version = %d, want 1", d.version)
+	}
+}
+
+func TestSQLMigrationsRegistered(t *testing.T) {
+	if len(sqlMigrations) == 0 || sqlMigrations[0].Version != 1 {
+		t.Fatalf("expected the IPAM schema as migration 1, got %+v", sqlMigrations)
+	}
+	for i := 1; i < len(sqlMigrations); i++ {
+		if sqlMigrations[i].Version <= sqlMigrations[i-1].Version {
+			t.Errorf("migration versions out of order: %d after %d", sqlMigrations[i].Version, sqlMigrations[i-1].Version)
+		}
+	}
+}
+
+func TestConfigureStorage(t *testing.T) {
+	tests := []struct {
+		driver  string
+		wantErr string
+	}{
+		{"memory", ""},
+		{"postgres", "not compiled in"},
+		{"oracle", "unknown database driver"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			t.Setenv("GO_SUBNET_CALCULATOR_DB_DRIVER", tt.driver)
+			withTestIPAM(t)
+			err := configureStorage()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("configureStorage() unexpected error: %v", err)
+				}
+				if storageDB != nil {
+					t.Error("configureStorage() opened a database for in-memory storage")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("configureStorage() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Client-side subnet calculation with the WebAssembly build of the calculator.
+//
+// Once the page has loaded, the engine is fetched in the background. While the
+// browser is offline the calculator form is answered by it instead of the server;
+// without the engine, for instance when the build was not deployed, the form posts
+// as usual. Other scripts can call calculateSubnet(ip, mask, cloud, explain), which
+// resolves to the JSON of POST /api/v1/calculate from the server when it can be
+// reached and from the engine otherwise.
+(function () {
+    "use strict";
+
+    var script = document.currentScript;
+    var base = (script && script.getAttribute("data-base")) || "";
+    var engine = null;
+
+    function loadScript(src) {
+        return new Promise(function (resolve, reject) {
+            var s = document.createElement("script");
+            s.src = src;
+            s.onload = resolve;
+            s.onerror = function () { reject(new Error("cannot load " + src)); };
+            document.head.appendChild(s);
+        });
+    }
+
+    function loadEngine() {
+        if (!window.WebAssembly || !window.fetch) {
+            return Promise.reject(new Error("WebAssembly is not supported"));
+        }
+        return loadScript(base + "/wasm/wasm_exec.js").then(function () {
+            return fetch(base + "/wasm/subnet-calculator.wasm");
+        }).then(function (resp) {
+            if (!resp.ok) {
+                throw new Error("the WebAssembly build is not available");
+            }
+            return resp.arrayBuffer();
+        }).then(function (bytes) {
+            var go = new Go();
+            return WebAssembly.instantiate(bytes, go.importObject).then(function (result) {
+                go.run(result.instance);
+                engine = globalThis.subnetCalculator;
+            });
+        });
+    }
+
+    function calculateLocally(ip, mask, cloud, explain) {
+        if (!engine) {
+            return Promise.reject(new Error("the calculator is offline"));
+        }
+        return Promise.resolve(JSON.parse(engine.calculate(ip, mask, cloud || "", !!explain)));
+    }
+
+    function calculateSubnet(ip, mask, cloud, explain) {
+        if (!navigator.onLine) {
+            return calculateLocally(ip, mask, cloud, explain);
+        }
+        return fetch(base + "/api/v1/calculate", {
+            method: "POST",
+            headers: {"Content-Type": "application/json"},
+            body: JSON.stringify({ip: ip, mask: mask, cloud: cloud || "", explain: !!explain})
+        }).then(function (resp) {
+            return resp.json();
+        }, function () {
+            return calculateLocally(ip, mask, cloud, explain);
+        });
+    }
+
+    function element(tag, className, text) {
+        var el = document.createElement(tag);
+        if (className) {
+            el.className = className;
+        }
+        if (text !== undefined) {
+            el.textContent = text;
+        }
+        return el;
+    }
+
+    function item(label, value, extra) {
+        var row = element("div", "result-item");
+        row.appendChild(element("span", "result-label", label));
+        row.appendChild(document.createTextNode(" "));
+        row.appendChild(element("span", "result-value", value));
+        if (extra) {
+            row.appendChild(document.createTextNode(" " + extra));
+        }
+        return row;
+    }
+
+    // render shows a result the way the results template of index.html does
+    function render(target, result) {
+        target.textContent = "";
+        if (result.error) {
+            var error = element("div", "error");
+            error.appendChild(element("strong", "", "Error:"));
+            error.appendChild(document.createTextNode(" " + result.error));
+            target.appendChild(error);
+            return;
+        }
+        var box = element("div", "result");
+        box.appendChild(element("h3", "", "Subnet Information:"));
+        if (result.normalization) {
+            box.appendChild(element("div", "result-item", result.normalization));
+        }
+        box.appendChild(item("Network Address:", result.network_address));
+        box.appendChild(item("Broadcast Address:", result.broadcast_address));
+        box.appendChild(item("Min Host Address:", result.min_host_address));
+        box.appendChild(item("Max Host Address:", result.max_host_address));
+        box.appendChild(item("Number of Usable Hosts:", result.usable_hosts));
+        (result.reserved || []).forEach(function (r) {
+            box.appendChild(item("Reserved:", r.address, r.purpose));
+        });
+        (result.notes || []).forEach(function (note) {
+            box.appendChild(element("div", "result-item", note));
+        });
+        if (result.integers) {
+            [["IP Address:", result.integers.ip_address],
+             ["Network Address:", result.integers.network_address],
+             ["Broadcast Address:", result.integers.broadcast_address]].forEach(function (row) {
+                box.appendChild(item(row[0] + " (integer)", String(row[1].decimal), "hex " + row[1].hex + ", octal " + row[1].octal));
+            });
+        }
+        box.appendChild(element("div", "result-item", "Calculated offline in the browser; lookups, saving and generated configs need the server."));
+        target.appendChild(box);
+    }
+
+    function answerOffline(event) {
+        var form = event.target;
+        var target = document.getElementById("results");
+        if (navigator.onLine || !engine || !target || !form.elements.ip || !form.elements.mask) {
+            return;
+        }
+        event.preventDefault();
+        var cloud = form.elements.cloud ? form.elements.cloud.value : "";
+        calculateLocally(form.elements.ip.value, form.elements.mask.value, cloud, false).then(function (result) {
+            render(target, result);
+        });
+    }
+
+    window.calculateSubnet = calculateSubnet;
+    window.addEventListener("load", function () {
+        var form = document.querySelector("form.calculator");
+        if (form) {
+            form.addEventListener("submit", answerOffline);
+        }
+        loadEngine().catch(function (err) {
+            if (window.console) {
+                console.info("Offline calculation unavailable: " + err.message);
+            }
+        });
+    });
+})();
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// SubtractRequest describes a network and the sub-blocks already in use within it
+type SubtractRequest struct {
+	Network string   `json:"network"`
+	Used    []string `json:"used"`
+}
+
+// SubtractResponse lists the free space left after removing the used sub-blocks
+type SubtractResponse struct {
+	Network       string   `json:"network"`
+	Free          []string `json:"free"`
+	FreeCount     int      `json:"free_count"`
+	FreeAddresses uint64   `json:"free_addresses"`
+	UsedAddresses uint64   `json:"used_addresses"`
+}
+
+// subtractPrefixes computes network minus every used sub-block
+func subtractPrefixes(networkStr string, usedStrs []string) (*net.IPNet, []*net.IPNet, error) {
+	network, err := parseIPv4Prefix(networkStr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	used, err := parsePrefixList(usedStrs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, block := range used {
+		if !prefixContains(network, block) {
+			return nil, nil, fmt.Errorf("used block %s is not inside %s", block, network)
+		}
+	}
+
+	return network, excludePrefixes(network, used), nil
+}
+
+// prefixAddressCount returns the total number of addresses covered by a list of prefixes
+func prefixAddressCount(prefixes []*net.IPNet) uint64 {
+	var total uint64
+	for _, p := range prefixes {
+		ones, _ := p.Mask.Size()
+		total += uint64(1) << uint(32-ones)
+	}
+	return total
+}
+
+// subtractHandler serves POST /api/v1/subtract and returns the free CIDRs of a network.
+// Unknown fields are refused, so a misspelt "used" does not return the whole network
+// as free
+func subtractHandler(w http.ResponseWriter, r *http.Request) {
+	var req SubtractRequest
+	if !decodeJSONPost(w, r, &req) {
+		return
+	}
+
+	network, free, err := subtractPrefixes(req.Network, req.Used)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if isPrefixListFormat(responseFormat(r, "json")) {
+		writePrefixList(w, r, network.String(), free)
+		return
+	}
+
+	freeAddresses := prefixAddressCount(free)
+	writeJSON(w, http.StatusOK, SubtractResponse{
+		Network:       network.String(),
+		Free:          prefixStrings(free),
+		FreeCount:     len(free),
+		FreeAddresses: freeAddresses,
+		UsedAddresses: prefixAddressCount([]*net.IPNet{network}) - freeAddresses,
+	})
+}
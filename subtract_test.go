@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSubtractPrefixes(t *testing.T) {
+	tests := []struct {
+		name     string
+		network  string
+		used     []string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "one used block",
+			network:  "192.168.0.0/24",
+			used:     []string{"192.168.0.64/26"},
+			expected: []string{"192.168.0.0/26", "192.168.0.128/25"},
+		},
+		{
+			name:     "nothing used",
+			network:  "10.0.0.0/30",
+			used:     nil,
+			expected: []string{"10.0.0.0/30"},
+		},
+		{
+			name:     "fully used",
+			network:  "10.0.0.0/30",
+			used:     []string{"10.0.0.0/31", "10.0.0.2/31"},
+			expected: []string{},
+		},
+		{
+			name:    "used block outside network",
+			network: "10.0.0.0/24",
+			used:    []string{"10.0.1.0/25"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid used block",
+			network: "10.0.0.0/24",
+			used:    []string{"nope"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, free, err := subtractPrefixes(tt.network, tt.used)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("subtractPrefixes() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("subtractPrefixes() unexpected error: %v", err)
+			}
+			if got := prefixStrings(free); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("subtractPrefixes() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSubtractHandler(t *testing.T) {
+	body := `{"network":"10.0.0.0/24","used":["10.0.0.0/26","10.0.0.128/27"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subtract", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	subtractHandler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	var resp SubtractResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON response: %v", err)
+	}
+	expected := []string{"10.0.0.64/26", "10.0.0.160/27", "10.0.0.192/26"}
+	if !reflect.DeepEqual(resp.Free, expected) {
+		t.Errorf("free = %v, want %v", resp.Free, expected)
+	}
+	if resp.FreeAddresses != 160 || resp.UsedAddresses != 96 {
+		t.Errorf("free/used addresses = %d/%d, want 160/96", resp.FreeAddresses, resp.UsedAddresses)
+	}
+}
+
+func TestSubtractHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+	}{
+		{"GET not allowed", http.MethodGet, "", http.StatusMethodNotAllowed},
+		{"invalid JSON", http.MethodPost, "{", http.StatusBadRequest},
+		{"invalid network", http.MethodPost, `{"network":"10.0.0.0"}`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, `{"network":"10.0.0.0/24","usd":["10.0.0.0/25"]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/subtract", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			subtractHandler(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
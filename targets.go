@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jurikolo/go-ip-subnet-calculator/cidrset"
+)
+
+// Scan target list formats: nmap reads CIDR blocks with -iL, masscan also takes
+// first-last ranges
+const (
+	targetsNmap    = "nmap"
+	targetsMasscan = "masscan"
+)
+
+// isTargetFormat reports whether format is a scan target list format
+func isTargetFormat(format string) bool {
+	return format == targetsNmap || format == targetsMasscan
+}
+
+// scanTargets returns the addresses of targets that are not excluded, one target per
+// entry: CIDR blocks for nmap and dash ranges for masscan. Single addresses are
+// written without a prefix length in both
+func scanTargets(targets, exclude []*net.IPNet, format string) []string {
+	set := cidrset.New(targets...).Difference(cidrset.New(exclude...))
+	var list []string
+	if format == targetsMasscan {
+		for _, r := range set.Ranges() {
+			if r.First == r.Last {
+				list = append(list, uint32ToIP(r.First).String())
+			} else {
+				list = append(list, fmt.Sprintf("%s-%s", uint32ToIP(r.First), uint32ToIP(r.Last)))
+			}
+		}
+		return list
+	}
+	for _, p := range set.Prefixes() {
+		if ones, _ := p.Mask.Size(); ones == 32 {
+			list = append(list, p.IP.String())
+		} else {
+			list = append(list, p.String())
+		}
+	}
+	return list
+}
+
+// scanExclusions reads what to keep out of a scan: the exclude list of addresses and
+// prefixes, and the allocations of the IPAM pool exclude_pool, narrowed by
+// exclude_match to those whose description contains it (such as "reserved"). Reading
+// a pool needs viewer access to it
+func scanExclusions(r *http.Request, values url.Values) ([]*net.IPNet, error) {
+	var exclude []*net.IPNet
+	for _, s := range parsePrefixListQuery(values.Get("exclude")) {
+		if !strings.Contains(s, "/") {
+			s += "/32"
+		}
+		p, err := parseIPv4Prefix(s)
+		if err != nil {
+			return nil, err
+		}
+		exclude = append(exclude, p)
+	}
+
+	pool := values.Get("exclude_pool")
+	if pool == "" {
+		if values.Get("exclude_match") != "" {
+			return nil, fmt.Errorf("exclude_match needs an exclude_pool")
+		}
+		return exclude, nil
+	}
+	poolID, err := strconv.ParseInt(pool, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: pool %s", errIPAMNotFound, pool)
+	}
+	if err := authorizePool(r, poolID, RoleViewer); err != nil {
+		return nil, err
+	}
+	allocations, err := ipamService.Allocations(poolID)
+	if err != nil {
+		return nil, err
+	}
+	match := strings.ToLower(values.Get("exclude_match"))
+	for _, a := range allocations {
+		if !strings.Contains(strings.ToLower(a.Description), match) {
+			continue
+		}
+		if p, err := parseIPv4Prefix(a.Prefix); err == nil {
+			exclude = append(exclude, p)
+		}
+	}
+	return exclude, nil
+}
+
+// writeScanTargets sends the targets left after the given exclusions and those of the
+// request as a target list file for nmap -iL or masscan -iL
+func writeScanTargets(w http.ResponseWriter, r *http.Request, values url.Values, format string, targets, exclude []*net.IPNet) {
+	requested, err := scanExclusions(r, values)
+	if err != nil {
+		writeIPAMError(w, err)
+		return
+	}
+	exclude = append(exclude, requested...)
+	if values.Get("exclude_pool") != "" {
+		// The pool changes, so caches must ask again every time
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-targets.txt"`, format))
+	for _, target := range scanTargets(targets, exclude, format) {
+		fmt.Fprintln(w, target)
+	}
+}
+
+// writeResultTargets sends the network of a calculation as scan targets, leaving out
+// the addresses its cloud provider reserves
+func writeResultTargets(w http.ResponseWriter, r *http.Request, values url.Values, format string, result *SubnetResult) {
+	mask, err := parseSubnetMask(result.SubnetMask)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	network := &net.IPNet{IP: net.ParseIP(result.NetworkAddress).To4(), Mask: mask}
+	var reserved []*net.IPNet
+	for _, a := range result.Reserved {
+		if ip := net.ParseIP(a.Address).To4(); ip != nil {
+			reserved = append(reserved, &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)})
+		}
+	}
+	writeScanTargets(w, r, values, format, []*net.IPNet{network}, reserved)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestScanTargets(t *testing.T) {
+	targets := mustParsePrefixes(t, "10.0.0.0/24", "10.0.1.0/24", "192.168.0.5/32")
+	exclude := mustParsePrefixes(t, "10.0.0.0/32", "10.0.1.128/25")
+
+	nmap := scanTargets(targets, exclude, targetsNmap)
+	want := []string{"10.0.0.1", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/29", "10.0.0.16/28", "10.0.0.32/27", "10.0.0.64/26", "10.0.0.128/25", "10.0.1.0/25", "192.168.0.5"}
+	if strings.Join(nmap, ",") != strings.Join(want, ",") {
+		t.Errorf("scanTargets(nmap) = %v, want %v", nmap, want)
+	}
+	masscan := scanTargets(targets, exclude, targetsMasscan)
+	want = []string{"10.0.0.1-10.0.1.127", "192.168.0.5"}
+	if strings.Join(masscan, ",") != strings.Join(want, ",") {
+		t.Errorf("scanTargets(masscan) = %v, want %v", masscan, want)
+	}
+	if got := scanTargets(targets, targets, targetsNmap); len(got) != 0 {
+		t.Errorf("scanTargets() of excluded targets = %v, want none", got)
+	}
+}
+
+func TestScanTargetExports(t *testing.T) {
+	m := withTestIPAM(t)
+	pool, _ := m.CreatePool(PoolRequest{Name: "lab", Prefix: "10.0.0.0/24"})
+	m.Allocate(pool.ID, AllocationRequest{Prefix: "10.0.0.0/26", Description: "Reserved for printers"})
+	m.Allocate(pool.ID, AllocationRequest{Prefix: "10.0.0.64/26", Description: "servers"})
+	get := func(h http.HandlerFunc, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+
+	rr := get(calculateHandler, fmt.Sprintf("/api/v1/calculate?ip=10.0.0.0&mask=/24&format=masscan&exclude=10.0.0.255&exclude_pool=%d&exclude_match=reserved", pool.ID))
+	if rr.Code != http.StatusOK || rr.Body.String() != "10.0.0.64-10.0.0.254\n" || rr.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("calculate masscan: status %d: %q", rr.Code, rr.Body.String())
+	}
+	if rr := get(calculateHandler, "/api/v1/calculate?ip=10.0.0.0&mask=/28&cloud=aws&format=nmap"); rr.Code != http.StatusOK || rr.Body.String() != "10.0.0.4/30\n10.0.0.8/30\n10.0.0.12/31\n10.0.0.14\n" {
+		t.Errorf("calculate nmap without the cloud reservations: status %d: %q", rr.Code, rr.Body.String())
+	}
+	if rr := get(deaggregateHandler, fmt.Sprintf("/api/v1/deaggregate?prefix=10.0.0.0/24&length=25&format=nmap&exclude_pool=%d", pool.ID)); rr.Code != http.StatusOK || rr.Body.String() != "10.0.0.128/25\n" {
+		t.Errorf("deaggregate nmap: status %d: %q", rr.Code, rr.Body.String())
+	}
+
+	for target, status := range map[string]int{
+		"/api/v1/calculate?ip=10.0.0.0&mask=/24&format=nmap&exclude=bogus":           http.StatusBadRequest,
+		"/api/v1/calculate?ip=10.0.0.0&mask=/24&format=nmap&exclude_match=reserved":  http.StatusBadRequest,
+		"/api/v1/calculate?ip=10.0.0.0&mask=/24&format=nmap&exclude_pool=999":        http.StatusNotFound,
+		"/api/v1/calculate?ip=10.0.0.0&mask=/24&format=masscan&exclude_pool=unknown": http.StatusNotFound,
+	} {
+		if rr := get(calculateHandler, target); rr.Code != status {
+			t.Errorf("GET %s: status %d, want %d", target, rr.Code, status)
+		}
+	}
+
+	form := url.Values{"ip": {"192.168.1.0"}, "mask": {"/30"}, "format": {"nmap"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != "192.168.1.0/30\n" {
+		t.Errorf("page nmap export: status %d: %q", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Theme is a look of the main page. Its template file is parsed together with
+// index.html, so it can reuse the form, results and calculations blocks and only lays
+// them out; a new theme is a new file and an entry in themes
+type Theme struct {
+	Name  string
+	Label string
+	File  string
+}
+
+var themes = []Theme{
+	{Name: "classic", Label: "Classic", File: "index.html"},
+	{Name: "compact", Label: "Compact", File: "theme-compact.html"},
+	{Name: "print", Label: "Print-friendly", File: "theme-print.html"},
+}
+
+// lookupTheme returns the theme with the given name
+func lookupTheme(name string) (Theme, bool) {
+	for _, t := range themes {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Theme{}, false
+}
+
+// defaultTheme is the theme of pages that do not ask for one
+var defaultTheme = themes[0]
+
+// configureTheme reads GO_SUBNET_CALCULATOR_THEME, the default theme of the main page
+func configureTheme() error {
+	theme := themes[0]
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_THEME"); value != "" {
+		var ok bool
+		if theme, ok = lookupTheme(strings.ToLower(value)); !ok {
+			names := make([]string, len(themes))
+			for i, t := range themes {
+				names[i] = t.Name
+			}
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_THEME must be one of %s, got %q", strings.Join(names, ", "), value)
+		}
+	}
+	defaultTheme = theme
+	recordSystemAudit("config.theme", "", "default theme %s", theme.Name)
+	return nil
+}
+
+// requestTheme returns the theme named by the theme parameter, or the default one
+func requestTheme(r *http.Request) Theme {
+	if theme, ok := lookupTheme(strings.ToLower(r.FormValue("theme"))); ok {
+		return theme
+	}
+	return defaultTheme
+}
+
+// loadTheme parses index.html and the file of a theme. The theme's page is the
+// template named "theme"; the classic theme is index.html itself
+func loadTheme(theme Theme) (*template.Template, string, error) {
+	tmpl, err := loadTemplate()
+	if err != nil || theme.File == "index.html" {
+		return tmpl, "subnet", err
+	}
+	data, err := os.ReadFile(theme.File)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %v", theme.File, err)
+	}
+	if _, err := tmpl.New("theme").Parse(string(data)); err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s: %v", theme.File, err)
+	}
+	return tmpl, "theme", nil
+}
+
+// renderMainPage renders a result with the theme of the request, or only its results
+// block for partial requests
+func renderMainPage(w http.ResponseWriter, r *http.Request, result *SubnetResult) {
+	theme := requestTheme(r)
+	result.Theme, result.Themes = theme.Name, themes
+	tmpl, page, err := loadTheme(theme)
+	if err != nil {
+		logRequestf(r.Context(), "Template loading error: %v", err)
+		http.Error(w, "Template loading error", http.StatusInternalServerError)
+		return
+	}
+	if partialRequested(r) {
+		page = "results"
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Header().Add("Vary", "HX-Request")
+	if err := tmpl.ExecuteTemplate(w, page, result); err != nil {
+		logRequestf(r.Context(), "Template execution error: %v", err)
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestThemes(t *testing.T) {
+	previous := defaultTheme
+	t.Cleanup(func() { defaultTheme = previous })
+
+	get := func(target string) string {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s = %d: %s", target, rr.Code, rr.Body)
+		}
+		return rr.Body.String()
+	}
+
+	for _, theme := range themes {
+		body := get("/?theme=" + theme.Name)
+		if !strings.Contains(body, `name="theme" value="`+theme.Name+`"`) || !strings.Contains(body, "<strong>"+theme.Label+"</strong>") {
+			t.Errorf("theme %s:\n%s", theme.Name, body)
+		}
+	}
+	if body := get("/?theme=unknown"); !strings.Contains(body, `name="theme" value="classic"`) {
+		t.Errorf("unknown theme should fall back to the default:\n%s", body)
+	}
+
+	form := url.Values{"ip": {"192.168.1.10"}, "mask": {"/24"}, "theme": {"print"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	if body := rr.Body.String(); !strings.Contains(body, "@media print") || !strings.Contains(body, "192.168.1.255") {
+		t.Errorf("print result:\n%s", body)
+	}
+}
+
+func TestConfigureTheme(t *testing.T) {
+	previous := defaultTheme
+	t.Cleanup(func() { defaultTheme = previous })
+	withTestAudit(t)
+
+	t.Setenv("GO_SUBNET_CALCULATOR_THEME", "Compact")
+	if err := configureTheme(); err != nil || defaultTheme.Name != "compact" {
+		t.Errorf("configureTheme() = %v, theme %s", err, defaultTheme.Name)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(rr.Body.String(), `name="theme" value="compact"`) {
+		t.Errorf("default theme not applied:\n%s", rr.Body)
+	}
+
+	t.Setenv("GO_SUBNET_CALCULATOR_THEME", "neon")
+	if err := configureTheme(); err == nil || !strings.Contains(err.Error(), "classic, compact, print") {
+		t.Errorf("configureTheme() with an unknown theme = %v", err)
+	}
+}
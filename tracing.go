@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP span kinds and status codes
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+
+	spanStatusError = 2
+
+	traceScope = "github.com/jurikolo/go-ip-subnet-calculator"
+	// traceExportInterval is how often ended spans are sent to the collector
+	traceExportInterval = 5 * time.Second
+	// maxPendingSpans bounds the spans waiting for export; more are dropped
+	maxPendingSpans = 4096
+)
+
+// span is an operation of a trace. A nil span is a no-op, so callers need not check
+// whether tracing is enabled
+type span struct {
+	tracer   *tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      error
+}
+
+// Set records an attribute of the operation
+func (s *span) Set(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.attrs[key] = value
+}
+
+// End finishes the span, marking it failed when err is not nil, and queues it for
+// export
+func (s *span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.end, s.err = time.Now(), err
+	s.tracer.enqueue(s)
+}
+
+// remoteParent is the trace context received from a caller
+type remoteParent struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+// parseTraceparent reads a W3C traceparent header
+func parseTraceparent(value string) (*remoteParent, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return nil, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return nil, false
+	}
+	var p remoteParent
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return nil, false
+	}
+	if _, err := hex.Decode(p.traceID[:], []byte(parts[1])); err != nil {
+		return nil, false
+	}
+	if _, err := hex.Decode(p.spanID[:], []byte(parts[2])); err != nil {
+		return nil, false
+	}
+	if p.traceID == [16]byte{} || p.spanID == [8]byte{} {
+		return nil, false
+	}
+	p.sampled = flags[0]&1 == 1
+	return &p, true
+}
+
+// tracer batches ended spans and exports them to an OTLP/HTTP collector as JSON
+type tracer struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+
+	mu      sync.Mutex
+	pending []*span
+	dropped int
+}
+
+// tracing is nil while tracing is off
+var tracing *tracer
+
+type spanContextKey struct{}
+
+// unsampledKey marks requests whose caller asked not to record the trace
+type unsampledKey struct{}
+
+// configureTracing enables tracing when OTEL_EXPORTER_OTLP_TRACES_ENDPOINT (the full
+// URL) or OTEL_EXPORTER_OTLP_ENDPOINT (a base URL, /v1/traces is appended) is set.
+// OTEL_EXPORTER_OTLP_HEADERS adds key=value headers such as an API token and
+// OTEL_SERVICE_NAME names the service
+func configureTracing() error {
+	tracing = nil
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimRight(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		recordSystemAudit("config.tracing", "", "tracing disabled")
+		return nil
+	}
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return fmt.Errorf("OTLP endpoint must be an http or https URL, got %q", endpoint)
+	}
+	t := &tracer{endpoint: endpoint, headers: map[string]string{}, service: "go-ip-subnet-calculator", client: &http.Client{Timeout: 10 * time.Second}}
+	if value := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"); value != "" {
+		for _, pair := range strings.Split(value, ",") {
+			key, val, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(key) == "" {
+				return fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS must be a list of key=value pairs")
+			}
+			t.headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+	}
+	if value := os.Getenv("OTEL_SERVICE_NAME"); value != "" {
+		t.service = value
+	}
+	tracing = t
+	go t.run()
+	recordSystemAudit("config.tracing", endpoint, "exporting spans of service %s", t.service)
+	return nil
+}
+
+// startSpan starts a span as a child of the span in ctx, or of a remote parent, or as
+// the root of a new trace. It returns nil while tracing is off or the trace is not
+// sampled
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *span) {
+	t := tracing
+	if t == nil || ctx.Value(unsampledKey{}) != nil {
+		return ctx, nil
+	}
+	s := &span{tracer: t, name: name, kind: kind, start: time.Now(), attrs: map[string]interface{}{}}
+	switch parent := ctx.Value(spanContextKey{}).(type) {
+	case *span:
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	case *remoteParent:
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	default:
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// withSpanOf returns ctx carrying the current span of from, so work that outlives a
+// request, like a background job, continues its trace
+func withSpanOf(ctx, from context.Context) context.Context {
+	if s, ok := from.Value(spanContextKey{}).(*span); ok {
+		return context.WithValue(ctx, spanContextKey{}, s)
+	}
+	return ctx
+}
+
+// traceRequests starts a server span for every request, continuing the trace of a
+// W3C traceparent header. Spans are named after the route of mux that serves the
+// request, such as "GET /api/v1/ipam/pools/{id}"
+func traceRequests(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tracing == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if parent, ok := parseTraceparent(r.Header.Get("Traceparent")); ok {
+			if !parent.sampled {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, unsampledKey{}, true)))
+				return
+			}
+			ctx = context.WithValue(ctx, spanContextKey{}, parent)
+		}
+		_, route := mux.Handler(r)
+		name := r.Method
+		if route != "" {
+			name = r.Method + " " + strings.TrimPrefix(route, r.Method+" ")
+		}
+		ctx, s := startSpan(ctx, name, spanKindServer)
+		s.Set("http.request.method", r.Method)
+		s.Set("url.path", r.URL.Path)
+		s.Set("http.route", route)
+		s.Set("client.address", clientAddress(r))
+		s.Set("user_agent.original", r.UserAgent())
+		if id := requestID(ctx); id != "" {
+			s.Set("http.request.id", id)
+		}
+		record := &responseRecord{ResponseWriter: w}
+		next.ServeHTTP(record, r.WithContext(ctx))
+		if record.status == 0 {
+			record.status = http.StatusOK
+		}
+		s.Set("http.response.status_code", record.status)
+		var err error
+		if record.status >= 500 {
+			err = fmt.Errorf("%d %s", record.status, http.StatusText(record.status))
+		}
+		s.End(err)
+	})
+}
+
+func (t *tracer) enqueue(s *span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.pending) >= maxPendingSpans {
+		t.dropped++
+		return
+	}
+	t.pending = append(t.pending, s)
+}
+
+func (t *tracer) run() {
+	for range time.Tick(traceExportInterval) {
+		if err := t.flush(); err != nil {
+			logRequestf(context.Background(), "Span export failed: %v", err)
+		}
+	}
+}
+
+// otlpValue is an OTLP AnyValue
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+func otlpAttr(key string, value interface{}) otlpAttribute {
+	var v otlpValue
+	switch x := value.(type) {
+	case int:
+		s := strconv.Itoa(x)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(x, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &x
+	case bool:
+		v.BoolValue = &x
+	default:
+		s := fmt.Sprint(x)
+		v.StringValue = &s
+	}
+	return otlpAttribute{Key: key, Value: v}
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+// otlpRequest is the JSON encoding of an OTLP ExportTraceServiceRequest
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// encode builds the export request for spans
+func (t *tracer) encode(spans []*span) otlpRequest {
+	var scope otlpScopeSpans
+	scope.Scope.Name = traceScope
+	for _, s := range spans {
+		out := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parentID != [8]byte{} {
+			out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for key, value := range s.attrs {
+			out.Attributes = append(out.Attributes, otlpAttr(key, value))
+		}
+		if s.err != nil {
+			out.Status = otlpStatus{Code: spanStatusError, Message: s.err.Error()}
+		}
+		scope.Spans = append(scope.Spans, out)
+	}
+	var resource otlpResourceSpans
+	resource.Resource.Attributes = []otlpAttribute{otlpAttr("service.name", t.service)}
+	resource.ScopeSpans = []otlpScopeSpans{scope}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{resource}}
+}
+
+// flush exports the pending spans
+func (t *tracer) flush() error {
+	t.mu.Lock()
+	spans, dropped := t.pending, t.dropped
+	t.pending, t.dropped = nil, 0
+	t.mu.Unlock()
+	if dropped > 0 {
+		logRequestf(context.Background(), "Dropped %d spans, the export queue was full", dropped)
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(t.encode(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
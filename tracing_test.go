@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// withTestTracing exports spans to a fake collector and returns the requests it got
+func withTestTracing(t *testing.T) (*tracer, *[]otlpRequest) {
+	t.Helper()
+	var received []otlpRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req otlpRequest
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Api-Key") != "secret" || json.Unmarshal(body, &req) != nil {
+			http.Error(w, "bad export", http.StatusBadRequest)
+			return
+		}
+		received = append(received, req)
+	}))
+	t.Cleanup(collector.Close)
+	previous := tracing
+	tr := &tracer{endpoint: collector.URL + "/v1/traces", headers: map[string]string{"Api-Key": "secret"}, service: "subnet-test", client: collector.Client()}
+	tracing = tr
+	t.Cleanup(func() { tracing = previous })
+	return tr, &received
+}
+
+func TestParseTraceparent(t *testing.T) {
+	p, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok || !p.sampled || p.traceID[0] != 0x4b || p.spanID[7] != 0xb7 {
+		t.Errorf("parseTraceparent = %+v, %v", p, ok)
+	}
+	if p, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"); !ok || p.sampled {
+		t.Errorf("unsampled parent = %+v, %v", p, ok)
+	}
+	for _, value := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, ok := parseTraceparent(value); ok {
+			t.Errorf("parseTraceparent(%q) accepted", value)
+		}
+	}
+}
+
+func TestTraceRequests(t *testing.T) {
+	tr, received := withTestTracing(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/calculate", calculateHandler)
+	h := withRequestID(traceRequests(mux, mux))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=10.1.2.3&mask=/24", nil)
+	r.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/calculate?ip=10.1.2.3&mask=/24", nil)
+	r.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if err := tr.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*received) != 1 || len((*received)[0].ResourceSpans) != 1 {
+		t.Fatalf("collector got %+v", *received)
+	}
+	rs := (*received)[0].ResourceSpans[0]
+	if attr := rs.Resource.Attributes[0]; attr.Key != "service.name" || *attr.Value.StringValue != "subnet-test" {
+		t.Errorf("resource = %+v", rs.Resource)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want the calculation and the request of the sampled trace", len(spans))
+	}
+	calc, server := spans[0], spans[1]
+	if server.Name != "GET /api/v1/calculate" || server.Kind != spanKindServer || server.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || server.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("server span = %+v", server)
+	}
+	if calc.Name != "subnet.calculate" || calc.TraceID != server.TraceID || calc.ParentSpanID != server.SpanID {
+		t.Errorf("calculation span = %+v, want a child of %s", calc, server.SpanID)
+	}
+	attrs := map[string]otlpValue{}
+	for _, a := range server.Attributes {
+		attrs[a.Key] = a.Value
+	}
+	if v := attrs["http.response.status_code"]; v.IntValue == nil || *v.IntValue != "200" {
+		t.Errorf("status attribute = %+v", v)
+	}
+	if v := attrs["http.request.id"]; v.StringValue == nil || len(*v.StringValue) != 32 {
+		t.Errorf("request ID attribute = %+v", v)
+	}
+}
+
+func TestTracedJob(t *testing.T) {
+	tr, received := withTestTracing(t)
+	withTestJobs(t, 1)
+	h := traceRequests(http.NewServeMux(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		submitJob(w, r, "ptr", 3, func(ctx context.Context, progress func(done, total int)) (interface{}, error) {
+			return nil, errors.New("resolver unreachable")
+		})
+	}))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ptr?async=true", nil))
+	var job Job
+	json.Unmarshal(rr.Body.Bytes(), &job)
+	waitForJob(t, job.ID)
+	tr.flush()
+
+	var server, run *otlpSpan
+	for _, req := range *received {
+		for i, s := range req.ResourceSpans[0].ScopeSpans[0].Spans {
+			switch s.Name {
+			case "POST":
+				server = &req.ResourceSpans[0].ScopeSpans[0].Spans[i]
+			case "job.ptr":
+				run = &req.ResourceSpans[0].ScopeSpans[0].Spans[i]
+			}
+		}
+	}
+	if server == nil || run == nil || run.ParentSpanID != server.SpanID || run.Status.Code != spanStatusError || !strings.Contains(run.Status.Message, "unreachable") {
+		t.Errorf("server span %+v, job span %+v", server, run)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Prefixes of the transition mechanisms that carry IPv4 endpoints in IPv6 addresses
+var (
+	sixToFourPrefix = netip.MustParsePrefix("2002::/16")
+	teredoPrefix    = netip.MustParsePrefix("2001::/32")
+)
+
+// SixToFourRequest asks for the 6to4 prefix of a public ipv4 address, or for the IPv4
+// address a 6to4 ipv6 address embeds
+type SixToFourRequest struct {
+	IPv4 string `json:"ipv4,omitempty"`
+	IPv6 string `json:"ipv6,omitempty"`
+}
+
+// SixToFourResponse is a public IPv4 address and the /48 6to4 prefix (RFC 3056)
+// derived from it. Address is the decoded IPv6 address, when one was given
+type SixToFourResponse struct {
+	IPv4    string `json:"ipv4"`
+	Prefix  string `json:"prefix"`
+	Address string `json:"ipv6,omitempty"`
+}
+
+// sixToFour converts between a public IPv4 address and its 6to4 prefix 2002:V4ADDR::/48,
+// in the direction the request gives
+func sixToFour(req SixToFourRequest) (*SixToFourResponse, error) {
+	req.IPv4, req.IPv6 = strings.TrimSpace(req.IPv4), strings.TrimSpace(req.IPv6)
+	if (req.IPv4 == "") == (req.IPv6 == "") {
+		return nil, fmt.Errorf("exactly one of ipv4 and ipv6 is required")
+	}
+
+	resp := &SixToFourResponse{}
+	var v4 netip.Addr
+	if req.IPv4 != "" {
+		addr, err := netip.ParseAddr(canonicalIP(req.IPv4))
+		if err != nil || !addr.Unmap().Is4() {
+			return nil, fmt.Errorf("invalid IPv4 address: %s", req.IPv4)
+		}
+		v4 = addr.Unmap()
+		if !isPublicIPv4(v4.AsSlice()) {
+			return nil, fmt.Errorf("6to4 needs a public IPv4 address, %s is not one", v4)
+		}
+	} else {
+		addr, err := parseIPv6Address(req.IPv6)
+		if err != nil {
+			return nil, err
+		}
+		if !sixToFourPrefix.Contains(addr.WithZone("")) {
+			return nil, fmt.Errorf("%s is not a 6to4 address: it is not within %s", addr, sixToFourPrefix)
+		}
+		b := addr.As16()
+		v4 = netip.AddrFrom4([4]byte(b[2:6]))
+		resp.Address = addr.String()
+	}
+
+	var b [16]byte
+	b[0], b[1] = 0x20, 0x02
+	a := v4.As4()
+	copy(b[2:6], a[:])
+	resp.IPv4 = v4.String()
+	resp.Prefix = netip.PrefixFrom(netip.AddrFrom16(b), 48).String()
+	return resp, nil
+}
+
+// TeredoResponse holds the endpoints a Teredo address (RFC 4380) embeds: the Teredo
+// server, and the public address and UDP port the client's NAT maps it to. Cone is
+// the cone NAT flag of the flags field
+type TeredoResponse struct {
+	Address    string `json:"address"`
+	Server     string `json:"server"`
+	Client     string `json:"client"`
+	ClientPort uint16 `json:"client_port"`
+	Flags      string `json:"flags"`
+	Cone       bool   `json:"cone"`
+}
+
+// decodeTeredo decodes a Teredo address, 2001:0:SERVER:FLAGS:PORT:CLIENT, whose port
+// and client address are stored with every bit inverted
+func decodeTeredo(address string) (*TeredoResponse, error) {
+	if strings.TrimSpace(address) == "" {
+		return nil, fmt.Errorf("address is required")
+	}
+	addr, err := parseIPv6Address(address)
+	if err != nil {
+		return nil, err
+	}
+	if !teredoPrefix.Contains(addr.WithZone("")) {
+		return nil, fmt.Errorf("%s is not a Teredo address: it is not within %s", addr, teredoPrefix)
+	}
+	b := addr.As16()
+	flags := binary.BigEndian.Uint16(b[8:10])
+	var client [4]byte
+	for i := range client {
+		client[i] = ^b[12+i]
+	}
+	return &TeredoResponse{
+		Address:    addr.String(),
+		Server:     netip.AddrFrom4([4]byte(b[4:8])).String(),
+		Client:     netip.AddrFrom4(client).String(),
+		ClientPort: ^binary.BigEndian.Uint16(b[10:12]),
+		Flags:      fmt.Sprintf("0x%04x", flags),
+		Cone:       flags&0x8000 != 0,
+	}, nil
+}
+
+// sixToFourHandler serves /api/v1/ipv6/6to4; POST takes a JSON body, GET takes the
+// ipv4 and ipv6 query parameters
+func sixToFourHandler(w http.ResponseWriter, r *http.Request) {
+	var req SixToFourRequest
+
+	switch r.Method {
+	case http.MethodPost:
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+	case http.MethodGet:
+		req.IPv4, req.IPv6 = r.URL.Query().Get("ipv4"), r.URL.Query().Get("ipv6")
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	resp, err := sixToFour(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// teredoHandler serves GET /api/v1/ipv6/teredo with the address query parameter
+func teredoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	resp, err := decodeTeredo(r.URL.Query().Get("address"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSixToFour(t *testing.T) {
+	resp, err := sixToFour(SixToFourRequest{IPv4: "8.8.4.4"})
+	if err != nil || *resp != (SixToFourResponse{IPv4: "8.8.4.4", Prefix: "2002:808:404::/48"}) {
+		t.Errorf("8.8.4.4 = %+v, %v", resp, err)
+	}
+	resp, err = sixToFour(SixToFourRequest{IPv6: "2002:c633:6401:1::1"})
+	if err != nil || *resp != (SixToFourResponse{IPv4: "198.51.100.1", Prefix: "2002:c633:6401::/48", Address: "2002:c633:6401:1::1"}) {
+		t.Errorf("2002:c633:6401:1::1 = %+v, %v", resp, err)
+	}
+
+	for _, req := range []SixToFourRequest{
+		{},
+		{IPv4: "8.8.8.8", IPv6: "2002:808:808::1"},
+		{IPv4: "10.0.0.1"},
+		{IPv4: "bogus"},
+		{IPv6: "2001:db8::1"},
+		{IPv6: "8.8.8.8"},
+	} {
+		if resp, err := sixToFour(req); err == nil {
+			t.Errorf("sixToFour(%+v) = %+v, want an error", req, resp)
+		}
+	}
+}
+
+func TestDecodeTeredo(t *testing.T) {
+	// The example of RFC 4380 section 4
+	resp, err := decodeTeredo("2001:0:4136:e378:8000:63bf:3fff:fdd2")
+	want := TeredoResponse{
+		Address:    "2001:0:4136:e378:8000:63bf:3fff:fdd2",
+		Server:     "65.54.227.120",
+		Client:     "192.0.2.45",
+		ClientPort: 40000,
+		Flags:      "0x8000",
+		Cone:       true,
+	}
+	if err != nil || *resp != want {
+		t.Errorf("decodeTeredo = %+v, %v, want %+v", resp, err, want)
+	}
+	if resp, err := decodeTeredo("2001::ffff:ffff"); err != nil || resp.Cone || resp.Client != "0.0.0.0" || resp.ClientPort != 65535 {
+		t.Errorf("decodeTeredo(2001::ffff:ffff) = %+v, %v", resp, err)
+	}
+	for _, address := range []string{"", "2001:db8::1", "2002::1", "192.0.2.1"} {
+		if resp, err := decodeTeredo(address); err == nil {
+			t.Errorf("decodeTeredo(%q) = %+v, want an error", address, resp)
+		}
+	}
+}
+
+func TestTunnelHandlers(t *testing.T) {
+	rr := httptest.NewRecorder()
+	sixToFourHandler(rr, httptest.NewRequest(http.MethodPost, "/api/v1/ipv6/6to4", strings.NewReader(`{"ipv4":"8.8.8.8"}`)))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"prefix":"2002:808:808::/48"`) {
+		t.Errorf("POST 6to4: status %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	teredoHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ipv6/teredo?address=2001:0:4136:e378:8000:63bf:3fff:fdd2", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"client":"192.0.2.45"`) {
+		t.Errorf("GET teredo: status %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	teredoHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ipv6/teredo?address=2002::1", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("GET teredo of a 6to4 address: status %d", rr.Code)
+	}
+}
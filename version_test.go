@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestVersionHandler(t *testing.T) {
+	previous := [3]string{version, commit, buildDate}
+	version, commit, buildDate = "2.3.4", "abc123", "2026-01-02T03:04:05Z"
+	t.Cleanup(func() { version, commit, buildDate = previous[0], previous[1], previous[2] })
+
+	rr := httptest.NewRecorder()
+	versionHandler(rr, httptest.NewRequest(http.MethodGet, "/version", nil))
+	var info VersionInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("GET /version = %d %q", rr.Code, rr.Body.String())
+	}
+	want := VersionInfo{Version: "2.3.4", Commit: "abc123", BuildDate: "2026-01-02T03:04:05Z", GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	if info != want {
+		t.Errorf("version = %+v, want %+v", info, want)
+	}
+
+	rr = httptest.NewRecorder()
+	healthHandler(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var health HealthResponse
+	json.Unmarshal(rr.Body.Bytes(), &health)
+	if health.Version != "2.3.4" {
+		t.Errorf("health version = %q, want the build version", health.Version)
+	}
+
+	rr = httptest.NewRecorder()
+	versionHandler(rr, httptest.NewRequest(http.MethodPost, "/version", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /version = %d", rr.Code)
+	}
+}
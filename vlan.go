@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	minVLANID      = 1
+	maxVLANID      = 4094
+	maxVLANNameLen = 32
+)
+
+// vlanNameExpr keeps VLAN names usable as switch VLAN names, interface names and
+// config comments on every supported platform
+var vlanNameExpr = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// subnetVLAN is the VLAN a planned subnet is carried in; the zero value means none
+type subnetVLAN struct {
+	ID   int
+	Name string
+}
+
+// label describes the VLAN for config comments, such as "VLAN 10 users"
+func (v subnetVLAN) label() string {
+	if v.Name == "" {
+		return fmt.Sprintf("VLAN %d", v.ID)
+	}
+	return fmt.Sprintf("VLAN %d %s", v.ID, v.Name)
+}
+
+// checkVLANs validates the VLANs of a set of subnets: IDs from 1 to 4094, names only
+// together with an ID, and every ID and name used by a single subnet
+func checkVLANs(networks []*net.IPNet, vlans []subnetVLAN) error {
+	ids := map[int]*net.IPNet{}
+	names := map[string]*net.IPNet{}
+	for i, v := range vlans {
+		network := networks[i]
+		if v.ID == 0 {
+			if v.Name != "" {
+				return fmt.Errorf("%s: VLAN name %s needs a VLAN ID", network, v.Name)
+			}
+			continue
+		}
+		if v.ID < minVLANID || v.ID > maxVLANID {
+			return fmt.Errorf("%s: VLAN %d is not between %d and %d", network, v.ID, minVLANID, maxVLANID)
+		}
+		if other, ok := ids[v.ID]; ok {
+			return fmt.Errorf("%s: VLAN %d is already used by %s", network, v.ID, other)
+		}
+		ids[v.ID] = network
+		if v.Name == "" {
+			continue
+		}
+		if len(v.Name) > maxVLANNameLen || !vlanNameExpr.MatchString(v.Name) {
+			return fmt.Errorf("%s: invalid VLAN name %q, use up to %d letters, digits, '-' and '_'", network, v.Name, maxVLANNameLen)
+		}
+		key := strings.ToLower(v.Name)
+		if other, ok := names[key]; ok {
+			return fmt.Errorf("%s: VLAN name %s is already used by %s", network, v.Name, other)
+		}
+		names[key] = network
+	}
+	return nil
+}
+
+// vlans reads the vlan and vlan_name options, comma-separated lists with one entry
+// per network in order; an empty entry leaves its network without a VLAN. It returns
+// nil when neither option is set
+func (o generatorOptions) vlans(networks []*net.IPNet) ([]subnetVLAN, error) {
+	ids, names := o.get("vlan", ""), o.get("vlan_name", "")
+	if ids == "" && names == "" {
+		return nil, nil
+	}
+	vlans := make([]subnetVLAN, len(networks))
+	for option, value := range map[string]string{"vlan": ids, "vlan_name": names} {
+		if value == "" {
+			continue
+		}
+		entries := strings.Split(value, ",")
+		if len(entries) != len(networks) {
+			return nil, fmt.Errorf("%s has %d entries for %d networks", option, len(entries), len(networks))
+		}
+		for i, entry := range entries {
+			entry = strings.TrimSpace(entry)
+			if option == "vlan_name" {
+				vlans[i].Name = entry
+				continue
+			}
+			if entry == "" {
+				continue
+			}
+			n, err := strconv.Atoi(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid vlan: %s", entry)
+			}
+			vlans[i].ID = n
+		}
+	}
+	if err := checkVLANs(networks, vlans); err != nil {
+		return nil, err
+	}
+	return vlans, nil
+}
+
+// vlanAt returns the VLAN of the i-th network, which has none when vlans is nil
+func vlanAt(vlans []subnetVLAN, i int) subnetVLAN {
+	if vlans == nil {
+		return subnetVLAN{}
+	}
+	return vlans[i]
+}
+
+// vlanOptions renders VLANs as the vlan and vlan_name generator options
+func vlanOptions(opts generatorOptions, vlans []subnetVLAN) {
+	ids, names := make([]string, len(vlans)), make([]string, len(vlans))
+	tagged := false
+	for i, v := range vlans {
+		if v.ID != 0 {
+			ids[i], names[i], tagged = strconv.Itoa(v.ID), v.Name, true
+		}
+	}
+	if tagged {
+		opts["vlan"], opts["vlan_name"] = strings.Join(ids, ","), strings.Join(names, ",")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeneratorOptionVLANs(t *testing.T) {
+	networks := mustParsePrefixes(t, "10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24")
+	vlans, err := generatorOptions{"vlan": "10, ,30", "vlan_name": "users,,"}.vlans(networks)
+	if err != nil || len(vlans) != 3 || vlans[0] != (subnetVLAN{10, "users"}) || vlans[1] != (subnetVLAN{}) || vlans[2] != (subnetVLAN{ID: 30}) {
+		t.Errorf("vlans() = %+v, %v", vlans, err)
+	}
+	if vlans, err := (generatorOptions{}).vlans(networks); vlans != nil || err != nil {
+		t.Errorf("vlans() without options = %+v, %v", vlans, err)
+	}
+
+	for _, opts := range []generatorOptions{
+		{"vlan": "10,20"},
+		{"vlan": "10,20,x"},
+		{"vlan": "10,20,4095"},
+		{"vlan": "10,20,10"},
+		{"vlan": "10,20,30", "vlan_name": "a,b,A"},
+		{"vlan": "10,20,30", "vlan_name": "a,b,c d"},
+		{"vlan": "10,20,30", "vlan_name": "a,b," + strings.Repeat("c", 33)},
+		{"vlan": "10,20,", "vlan_name": "a,b,c"},
+	} {
+		if vlans, err := opts.vlans(networks); err == nil {
+			t.Errorf("vlans(%v) = %+v, want an error", opts, vlans)
+		}
+	}
+}
+
+func TestGeneratorsWithVLANs(t *testing.T) {
+	networks := []string{"10.0.0.0/24", "10.0.1.0/24"}
+	opts := map[string]string{"vlan": "10,20", "vlan_name": "users,"}
+	for generator, want := range map[string][]string{
+		"isc-dhcpd":         {"# VLAN 10 users\nsubnet 10.0.0.0", "# VLAN 20\nsubnet 10.0.1.0"},
+		"kea":               {`"user-context": {` + "\n" + `        "vlan": 10,` + "\n" + `        "vlan-name": "users"`, `"vlan": 20` + "\n"},
+		"dnsmasq":           {"# VLAN 10 users\ndhcp-range=set:lan0,", "# VLAN 20\ndhcp-range=set:lan1,"},
+		"ansible-inventory": {"        vlan_id: 10\n        vlan_name: users\n", "        vlan_id: 20\n      hosts:"},
+		"terraform":         {"      vlan_id      = 10\n      vlan_name    = \"users\"\n", "      vlan_id      = 20\n    }"},
+		"iptables":          {`-s 10.0.0.0/24 -m comment --comment "VLAN 10 users" -j ACCEPT`, `-s 10.0.1.0/24 -m comment --comment "VLAN 20" -j ACCEPT`},
+		"nftables":          {"# 10.0.0.0/24: VLAN 10 users\n# 10.0.1.0/24: VLAN 20\nadd rule"},
+		"cisco-acl":         {" remark VLAN 10 users\n permit ip 10.0.0.0 0.0.0.255 any\n remark VLAN 20\n"},
+	} {
+		got, err := generateConfig(generator, GenerateRequest{Networks: networks, Options: opts})
+		if err != nil {
+			t.Errorf("%s: %v", generator, err)
+			continue
+		}
+		for _, w := range want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s does not contain %q:\n%s", generator, w, got)
+			}
+		}
+	}
+
+	got, err := generateConfig("terraform", GenerateRequest{Networks: networks, Options: map[string]string{"style": "aws_subnet", "vlan": "10,20", "vlan_name": "users,"}})
+	if err != nil || !strings.Contains(got, "    Name     = \"subnets-1\"\n    VLAN     = \"10\"\n    VLANName = \"users\"\n") || !strings.Contains(got, "    Name = \"subnets-2\"\n    VLAN = \"20\"\n") {
+		t.Errorf("terraform aws_subnet = %v:\n%s", err, got)
+	}
+	got, err = generateConfig("reverse-zone", GenerateRequest{Networks: networks[:1], Options: map[string]string{"vlan": "10", "vlan_name": "users", "serial": "1"}})
+	if err != nil || !strings.Contains(got, "; reverse zone for 10.0.0.0/24\n; VLAN 10 users\n") {
+		t.Errorf("reverse-zone = %v:\n%s", err, got)
+	}
+	if _, err := generateConfig("isc-dhcpd", GenerateRequest{Networks: networks, Options: map[string]string{"vlan": "10,10"}}); err == nil {
+		t.Error("isc-dhcpd accepted a VLAN used twice")
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import "net/http"
+
+// wasmFiles are the files of the client-side calculator with their content types,
+// served from the working directory like the templates: the WebAssembly build, the
+// support script of the Go toolchain that runs it and the bindings of the web UI
+var wasmFiles = map[string]string{
+	"subnet-calculator.wasm": "application/wasm",
+	"wasm_exec.js":           "text/javascript; charset=utf-8",
+	"subnet.js":              "text/javascript; charset=utf-8",
+}
+
+// wasmHandler serves /wasm/{file}. The WebAssembly build is optional: without it the
+// web UI keeps posting its form to the server
+func wasmHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("file")
+	contentType, ok := wasmFiles[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFile(w, r, name)
+}
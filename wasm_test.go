@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWasmHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/wasm/{file}", wasmHandler)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/wasm/subnet.js", nil))
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/javascript") || !strings.Contains(rr.Body.String(), "calculateSubnet") {
+		t.Errorf("subnet.js: status %d, type %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	// Only the files of the engine are served
+	for _, path := range []string{"/wasm/main.go", "/wasm/..%2Fgo.mod"} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", path, rr.Code)
+		}
+	}
+}
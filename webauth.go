@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionCookieName is the cookie that carries a web UI session
+const sessionCookieName = "gsc_session"
+
+// Lifetimes of a session and of an OIDC login waiting for the identity provider
+var (
+	defaultSessionTTL = 8 * time.Hour
+	pendingLoginTTL   = 10 * time.Minute
+)
+
+// webSession is a signed-in user of the web UI
+type webSession struct {
+	User    string
+	Expires time.Time
+}
+
+// pendingLogin remembers an OIDC login between the redirect to the identity provider
+// and the callback
+type pendingLogin struct {
+	Nonce    string
+	Verifier string
+	Next     string
+	Expires  time.Time
+}
+
+// sessionStore keeps sessions in memory; users sign in again after a restart
+type sessionStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*webSession
+	pending  map[string]*pendingLogin
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{ttl: ttl, sessions: map[string]*webSession{}, pending: map[string]*pendingLogin{}}
+}
+
+// randomToken returns 256 random bits, base64url encoded
+func randomToken() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// pruneLocked drops expired sessions and logins; s.mu must be held
+func (s *sessionStore) pruneLocked(now time.Time) {
+	for id, session := range s.sessions {
+		if !now.Before(session.Expires) {
+			delete(s.sessions, id)
+		}
+	}
+	for state, login := range s.pending {
+		if !now.Before(login.Expires) {
+			delete(s.pending, state)
+		}
+	}
+}
+
+// create starts a session and returns its id
+func (s *sessionStore) create(user string) (string, *webSession, error) {
+	id, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	session := &webSession{User: user, Expires: now.Add(s.ttl)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	s.sessions[id] = session
+	return id, session, nil
+}
+
+// get returns the session with the given id, or nil when it is unknown or expired
+func (s *sessionStore) get(id string) *webSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok || !time.Now().Before(session.Expires) {
+		return nil
+	}
+	c := *session
+	return &c
+}
+
+func (s *sessionStore) delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// begin records an OIDC login and returns its state parameter
+func (s *sessionStore) begin(next string) (string, *pendingLogin, error) {
+	var tokens [3]string
+	for i := range tokens {
+		token, err := randomToken()
+		if err != nil {
+			return "", nil, err
+		}
+		tokens[i] = token
+	}
+	now := time.Now()
+	login := &pendingLogin{Nonce: tokens[1], Verifier: tokens[2], Next: next, Expires: now.Add(pendingLoginTTL)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	s.pending[tokens[0]] = login
+	return tokens[0], login, nil
+}
+
+// finish returns and forgets the login for a state parameter; each state is used once
+func (s *sessionStore) finish(state string) *pendingLogin {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	login, ok := s.pending[state]
+	delete(s.pending, state)
+	if !ok || !time.Now().Before(login.Expires) {
+		return nil
+	}
+	return login
+}
+
+// At most one login provider is set, by configureWebAuth
+var (
+	oidcLogin   *oidcProvider
+	ldapLogin   *ldapDirectory
+	webSessions = newSessionStore(defaultSessionTTL)
+)
+
+// webAuthMode returns the configured login provider: "oidc", "ldap" or "" when the
+// web UI is open
+func webAuthMode() string {
+	switch {
+	case oidcLogin != nil:
+		return "oidc"
+	case ldapLogin != nil:
+		return "ldap"
+	}
+	return ""
+}
+
+// configureWebAuth reads GO_SUBNET_CALCULATOR_WEB_AUTH (off, oidc or ldap), the
+// provider settings and GO_SUBNET_CALCULATOR_SESSION_TTL
+func configureWebAuth() error {
+	ttl := defaultSessionTTL
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_SESSION_TTL"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Minute {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_SESSION_TTL must be a duration of at least 1m, got %q", value)
+		}
+		ttl = d
+	}
+
+	var oidc *oidcProvider
+	var ldap *ldapDirectory
+	var err error
+	switch mode := strings.ToLower(os.Getenv("GO_SUBNET_CALCULATOR_WEB_AUTH")); mode {
+	case "", "off":
+	case "oidc":
+		oidc, err = newOIDCProvider()
+	case "ldap":
+		ldap, err = newLDAPDirectory()
+	default:
+		return fmt.Errorf("GO_SUBNET_CALCULATOR_WEB_AUTH must be off, oidc or ldap, got %q", mode)
+	}
+	if err != nil {
+		return err
+	}
+	oidcLogin, ldapLogin, webSessions = oidc, ldap, newSessionStore(ttl)
+	mode := webAuthMode()
+	if mode == "" {
+		mode = "off"
+	}
+	recordSystemAudit("config.web_auth", "", "login %s, session lifetime %s", mode, ttl)
+	return nil
+}
+
+// sessionContextKey carries the session of a signed-in request
+type sessionContextKey struct{}
+
+// currentUser returns the signed-in user of a request, or "" when login is off
+func currentUser(r *http.Request) string {
+	if session, ok := r.Context().Value(sessionContextKey{}).(*webSession); ok {
+		return session.User
+	}
+	return ""
+}
+
+// requestSession returns the valid session named by the request cookie, if any
+func requestSession(r *http.Request) (string, *webSession) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return "", nil
+	}
+	return cookie.Value, webSessions.get(cookie.Value)
+}
+
+// loginExemptPaths stay reachable without a session
+var loginExemptPaths = map[string]bool{
+	"/login":         true,
+	"/logout":        true,
+	"/auth/callback": true,
+	"/health":        true,
+	"/ready":         true,
+	"/version":       true,
+}
+
+// requireLogin puts the web UI behind the configured login provider. The JSON API
+// under /api/ is left to requireAPIKey. Signed-in users act with the tenant and role
+// from GO_SUBNET_CALCULATOR_USER_ROLES and become the actor in the audit log
+func requireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if webAuthMode() == "" || strings.HasPrefix(r.URL.Path, "/api/") || loginExemptPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		_, session := requestSession(r)
+		if session == nil {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				http.Redirect(w, r, sitePath("/login?next="+url.QueryEscape(r.URL.RequestURI())), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "Login required", http.StatusUnauthorized)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, session))
+		next.ServeHTTP(w, withPrincipal(r, userPrincipal(session.User)))
+	})
+}
+
+// safeNext keeps post-login redirects on this site; the path is relative to basePath
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// setSessionCookie sets or, with an empty id, clears the session cookie
+func setSessionCookie(w http.ResponseWriter, r *http.Request, id string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    id,
+		Path:     sitePath("/"),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// startSession signs a user in and sends them on to the page they asked for
+func startSession(w http.ResponseWriter, r *http.Request, user, next string) {
+	id, session, err := webSessions.create(user)
+	if err != nil {
+		logRequestf(r.Context(), "Session creation failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	setSessionCookie(w, r, id, int(time.Until(session.Expires).Seconds()))
+	recordAudit(withActor(r, "user:"+user), "session.login", "", "via %s", webAuthMode())
+	http.Redirect(w, r, sitePath(safeNext(next)), http.StatusSeeOther)
+}
+
+// LoginPage is the data for login.html
+type LoginPage struct {
+	Provider string
+	Next     string
+	Error    string
+	Message  string
+}
+
+func renderLogin(w http.ResponseWriter, status int, page *LoginPage) {
+	tmpl, err := loadTemplate("login.html")
+	if err != nil {
+		log.Printf("Template loading error: %v", err)
+		http.Error(w, "Template loading error", http.StatusInternalServerError)
+		return
+	}
+	page.Provider = webAuthMode()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, page); err != nil {
+		log.Printf("Template execution error: %v", err)
+	}
+}
+
+// loginHandler serves /login. With OIDC it redirects to the identity provider; with
+// LDAP it shows the sign-in form and checks the submitted credentials
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if !parseFormBody(w, r) {
+		return
+	}
+	next := safeNext(r.FormValue("next"))
+	switch {
+	case oidcLogin != nil:
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		state, login, err := webSessions.begin(next)
+		var target string
+		if err == nil {
+			target, err = oidcLogin.authCodeURL(state, login.Nonce, login.Verifier)
+		}
+		if err != nil {
+			logRequestf(r.Context(), "OIDC login failed: %v", err)
+			renderLogin(w, http.StatusBadGateway, &LoginPage{Next: next, Error: "Single sign-on is unavailable, please try again later."})
+			return
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+	case ldapLogin != nil:
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			renderLogin(w, http.StatusOK, &LoginPage{Next: next})
+		case http.MethodPost:
+			username := strings.TrimSpace(r.FormValue("username"))
+			if err := ldapLogin.authenticate(username, r.FormValue("password")); err != nil {
+				logRequestf(r.Context(), "Login failed for %q: %v", username, err)
+				if errors.Is(err, errLoginFailed) {
+					renderLogin(w, http.StatusUnauthorized, &LoginPage{Next: next, Error: "Invalid username or password."})
+				} else {
+					renderLogin(w, http.StatusBadGateway, &LoginPage{Next: next, Error: "The directory server is unavailable, please try again later."})
+				}
+				return
+			}
+			startSession(w, r, username, next)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	default:
+		http.Redirect(w, r, sitePath(next), http.StatusSeeOther)
+	}
+}
+
+// oidcCallbackHandler serves /auth/callback, where the identity provider returns
+// after a login
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if oidcLogin == nil {
+		http.NotFound(w, r)
+		return
+	}
+	login := webSessions.finish(r.FormValue("state"))
+	if login == nil {
+		renderLogin(w, http.StatusBadRequest, &LoginPage{Error: "The login has expired, please sign in again."})
+		return
+	}
+	if reason := r.FormValue("error"); reason != "" {
+		logRequestf(r.Context(), "OIDC login refused: %s %s", reason, r.FormValue("error_description"))
+		renderLogin(w, http.StatusUnauthorized, &LoginPage{Next: login.Next, Error: "Sign-in was refused by the identity provider."})
+		return
+	}
+	idToken, err := oidcLogin.exchange(r.FormValue("code"), login.Verifier)
+	var claims *oidcClaims
+	if err == nil {
+		claims, err = oidcLogin.verifyIDToken(idToken, login.Nonce)
+	}
+	if err != nil {
+		logRequestf(r.Context(), "OIDC login failed: %v", err)
+		renderLogin(w, http.StatusUnauthorized, &LoginPage{Next: login.Next, Error: "Sign-in failed, please try again."})
+		return
+	}
+	startSession(w, r, claims.username(), login.Next)
+}
+
+// logoutHandler serves /logout: it ends the session and clears the cookie
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if id, session := requestSession(r); id != "" {
+		if session != nil {
+			recordAudit(withActor(r, "user:"+session.User), "session.logout", "", "")
+		}
+		webSessions.delete(id)
+	}
+	setSessionCookie(w, r, "", -1)
+	renderLogin(w, http.StatusOK, &LoginPage{Message: "You have been signed out."})
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withTestWebAuth sets the login providers and a fresh session store for a test
+func withTestWebAuth(t *testing.T, oidc *oidcProvider, ldap *ldapDirectory) {
+	t.Helper()
+	previousOIDC, previousLDAP, previousSessions := oidcLogin, ldapLogin, webSessions
+	oidcLogin, ldapLogin, webSessions = oidc, ldap, newSessionStore(time.Hour)
+	t.Cleanup(func() { oidcLogin, ldapLogin, webSessions = previousOIDC, previousLDAP, previousSessions })
+}
+
+// testServer wires the login routes and the IPAM page behind requireLogin
+func testServer() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ipam", ipamPageHandler)
+	mux.HandleFunc("/login", loginHandler)
+	mux.HandleFunc("/logout", logoutHandler)
+	mux.HandleFunc("/auth/callback", oidcCallbackHandler)
+	mux.HandleFunc("/health", healthHandler)
+	mux.HandleFunc("/api/v1/calculate", calculateHandler)
+	return requireLogin(requireAPIKey(mux))
+}
+
+func serve(handler http.Handler, method, target string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func sessionCookie(t *testing.T, rr *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == sessionCookieName {
+			return c
+		}
+	}
+	t.Fatalf("no session cookie in %v", rr.Header())
+	return nil
+}
+
+func TestSessionStore(t *testing.T) {
+	s := newSessionStore(time.Hour)
+	id, session, err := s.create("alice")
+	if err != nil || len(id) != 43 || session.User != "alice" {
+		t.Fatalf("create() = %q, %+v, %v", id, session, err)
+	}
+	if got := s.get(id); got == nil || got.User != "alice" {
+		t.Errorf("get() = %+v", got)
+	}
+	if s.get("unknown") != nil {
+		t.Error("get() of an unknown id should be nil")
+	}
+	s.sessions[id].Expires = time.Now().Add(-time.Second)
+	if s.get(id) != nil {
+		t.Error("get() of an expired session should be nil")
+	}
+	s.create("bob")
+	if _, ok := s.sessions[id]; ok {
+		t.Error("expired sessions should be pruned")
+	}
+
+	state, login, err := s.begin("/ipam")
+	if err != nil || login.Nonce == "" || login.Verifier == "" || login.Nonce == login.Verifier {
+		t.Fatalf("begin() = %q, %+v, %v", state, login, err)
+	}
+	if got := s.finish(state); got == nil || got.Next != "/ipam" {
+		t.Errorf("finish() = %+v", got)
+	}
+	if s.finish(state) != nil {
+		t.Error("a state must only be usable once")
+	}
+}
+
+func TestSafeNext(t *testing.T) {
+	tests := map[string]string{
+		"/ipam?pool=1":         "/ipam?pool=1",
+		"":                     "/",
+		"https://evil.example": "/",
+		"//evil.example":       "/",
+		`/\evil.example`:       "/",
+		"ipam":                 "/",
+	}
+	for in, want := range tests {
+		if got := safeNext(in); got != want {
+			t.Errorf("safeNext(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRequireLogin(t *testing.T) {
+	withTestIPAM(t)
+	withTestAPIKeys(t, false, "")
+	server := testServer()
+
+	withTestWebAuth(t, nil, nil)
+	if rr := serve(server, http.MethodGet, "/ipam", nil); rr.Code != http.StatusOK {
+		t.Errorf("login off: /ipam = %d", rr.Code)
+	}
+
+	withTestWebAuth(t, nil, &ldapDirectory{address: "127.0.0.1:1", userDN: "{username}"})
+	rr := serve(server, http.MethodGet, "/ipam?pool=2", nil)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/login?next=%2Fipam%3Fpool%3D2" {
+		t.Errorf("GET without a session = %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr = serve(server, http.MethodPost, "/ipam", url.Values{"action": {"create-pool"}}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("POST without a session = %d, want 401", rr.Code)
+	}
+	for _, path := range []string{"/health", "/login", "/api/v1/calculate?ip=10.0.0.1&mask=/24"} {
+		if rr = serve(server, http.MethodGet, path, nil); rr.Code != http.StatusOK {
+			t.Errorf("%s without a session = %d, want 200", path, rr.Code)
+		}
+	}
+	expired := &http.Cookie{Name: sessionCookieName, Value: "stale"}
+	if rr = serve(server, http.MethodGet, "/ipam", nil, expired); rr.Code != http.StatusSeeOther {
+		t.Errorf("unknown session = %d, want a redirect to /login", rr.Code)
+	}
+
+	var actor, user string
+	id, _, _ := webSessions.create("alice")
+	handler := requireLogin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, user = requestActor(r), currentUser(r)
+	}))
+	serve(handler, http.MethodGet, "/", nil, &http.Cookie{Name: sessionCookieName, Value: id})
+	if actor != "user:alice" || user != "alice" {
+		t.Errorf("signed-in request actor %q user %q", actor, user)
+	}
+}
+
+func TestLDAPLoginFlow(t *testing.T) {
+	withTestIPAM(t)
+	withTestAPIKeys(t, false, "")
+	store := withTestAudit(t)
+	address := fakeLDAP(t, func(dn, password string) int {
+		if dn == "uid=alice,dc=example,dc=org" && password == "correct" {
+			return ldapSuccess
+		}
+		return ldapInvalidCredentials
+	})
+	withTestWebAuth(t, nil, &ldapDirectory{address: address, userDN: "uid={username},dc=example,dc=org"})
+	withTestUserRoles(t, "alice=admin")
+	server := testServer()
+
+	rr := serve(server, http.MethodGet, "/login?next=/ipam", nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `name="password"`) || !strings.Contains(rr.Body.String(), `value="/ipam"`) {
+		t.Fatalf("login form = %d", rr.Code)
+	}
+	rr = serve(server, http.MethodPost, "/login", url.Values{"username": {"alice"}, "password": {"wrong"}, "next": {"/ipam"}})
+	if rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), "Invalid username or password") {
+		t.Errorf("wrong password = %d", rr.Code)
+	}
+
+	rr = serve(server, http.MethodPost, "/login", url.Values{"username": {"alice"}, "password": {"correct"}, "next": {"//evil.example"}})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/" {
+		t.Fatalf("login = %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+	cookie := sessionCookie(t, rr)
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge <= 0 {
+		t.Errorf("session cookie = %+v", cookie)
+	}
+
+	rr = serve(server, http.MethodPost, "/ipam", url.Values{"action": {"create-pool"}, "name": {"dc1"}, "prefix": {"10.0.0.0/16"}}, cookie)
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("create pool while signed in = %d", rr.Code)
+	}
+	if rr = serve(server, http.MethodGet, "/ipam", nil, cookie); !strings.Contains(rr.Body.String(), "Signed in as alice") {
+		t.Error("IPAM page should show the signed-in user")
+	}
+
+	rr = serve(server, http.MethodGet, "/logout", nil, cookie)
+	if rr.Code != http.StatusOK || sessionCookie(t, rr).MaxAge >= 0 || !strings.Contains(rr.Body.String(), "signed out") {
+		t.Errorf("logout = %d", rr.Code)
+	}
+	if rr = serve(server, http.MethodGet, "/ipam", nil, cookie); rr.Code != http.StatusSeeOther {
+		t.Errorf("session after logout = %d, want a redirect to /login", rr.Code)
+	}
+
+	list, _ := store.List(AuditFilter{Actor: "user:alice", Limit: 10})
+	var actions []string
+	for _, e := range list {
+		actions = append(actions, e.Action)
+	}
+	if strings.Join(actions, ",") != "session.logout,pool.create,session.login" {
+		t.Errorf("audit actions = %v", actions)
+	}
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	withTestIPAM(t)
+	withTestAudit(t)
+	idp, provider := newFakeIdP(t)
+	withTestWebAuth(t, provider, nil)
+	server := testServer()
+
+	rr := serve(server, http.MethodGet, "/login?next=/ipam", nil)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("login = %d: %s", rr.Code, rr.Body)
+	}
+	state := idp.authorize(t, rr.Header().Get("Location")).Get("state")
+
+	if rr = serve(server, http.MethodGet, "/auth/callback?code=good-code&state=forged", nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("callback with an unknown state = %d, want 400", rr.Code)
+	}
+	rr = serve(server, http.MethodGet, "/auth/callback?code=good-code&state="+state, nil)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/ipam" {
+		t.Fatalf("callback = %d %s: %s", rr.Code, rr.Header().Get("Location"), rr.Body)
+	}
+	cookie := sessionCookie(t, rr)
+	if rr = serve(server, http.MethodGet, "/ipam", nil, cookie); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Signed in as alice") {
+		t.Errorf("IPAM page after OIDC login = %d", rr.Code)
+	}
+	if rr = serve(server, http.MethodGet, "/auth/callback?code=good-code&state="+state, nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("replayed callback = %d, want 400", rr.Code)
+	}
+
+	rr = serve(server, http.MethodGet, "/login", nil)
+	state = idp.authorize(t, rr.Header().Get("Location")).Get("state")
+	if rr = serve(server, http.MethodGet, "/auth/callback?error=access_denied&state="+state, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("refused login = %d, want 401", rr.Code)
+	}
+
+	rr = serve(server, http.MethodGet, "/login", nil)
+	state = idp.authorize(t, rr.Header().Get("Location")).Get("state")
+	idp.claims = map[string]interface{}{"aud": "someone-else"}
+	if rr = serve(server, http.MethodGet, "/auth/callback?code=good-code&state="+state, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("token for another client = %d, want 401", rr.Code)
+	}
+}
+
+func TestConfigureWebAuth(t *testing.T) {
+	withTestWebAuth(t, nil, nil)
+	withTestAudit(t)
+
+	t.Setenv("GO_SUBNET_CALCULATOR_WEB_AUTH", "ldap")
+	t.Setenv("GO_SUBNET_CALCULATOR_LDAP_URL", "ldaps://ldap.example.org")
+	t.Setenv("GO_SUBNET_CALCULATOR_LDAP_USER_DN", "{username}@example.org")
+	t.Setenv("GO_SUBNET_CALCULATOR_SESSION_TTL", "30m")
+	if err := configureWebAuth(); err != nil || webAuthMode() != "ldap" || webSessions.ttl != 30*time.Minute {
+		t.Errorf("configureWebAuth() = %v, mode %q, ttl %s", err, webAuthMode(), webSessions.ttl)
+	}
+
+	for env, value := range map[string]string{"GO_SUBNET_CALCULATOR_SESSION_TTL": "10s", "GO_SUBNET_CALCULATOR_WEB_AUTH": "saml"} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if err := configureWebAuth(); err == nil {
+				t.Errorf("configureWebAuth() with %s=%s expected error", env, value)
+			}
+		})
+	}
+
+	t.Setenv("GO_SUBNET_CALCULATOR_WEB_AUTH", "off")
+	if err := configureWebAuth(); err != nil || webAuthMode() != "" {
+		t.Errorf("configureWebAuth() off = %v, mode %q", err, webAuthMode())
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// maxBatchWorkers bounds GO_SUBNET_CALCULATOR_BATCH_WORKERS
+const maxBatchWorkers = 256
+
+// batchPool runs the calculations of batches and address plan imports
+var batchPool = newWorkPool(defaultBatchWorkers(), 0)
+
+// workPool is a fixed set of workers shared by every batch and import, synchronous
+// or running as a job. A job runs at most perJob tasks at once, so a large one leaves
+// workers to the others, and submitting blocks while the job's share or the whole
+// pool is busy, so a job never reads its input faster than it is processed.
+// Single calculations never wait for the pool
+type workPool struct {
+	workers int
+	perJob  int
+	tasks   chan func()
+}
+
+// defaultBatchWorkers is the pool size when GO_SUBNET_CALCULATOR_BATCH_WORKERS is not
+// set: one worker per CPU, and at least two so an import leaves one to the batches
+func defaultBatchWorkers() int {
+	return max(2, runtime.GOMAXPROCS(0))
+}
+
+// newWorkPool starts a pool of workers; perJob defaults to half of them
+func newWorkPool(workers, perJob int) *workPool {
+	if perJob <= 0 {
+		perJob = max(1, workers/2)
+	}
+	p := &workPool{workers: workers, perJob: min(perJob, workers), tasks: make(chan func())}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+	return p
+}
+
+// Close stops the workers once the tasks already handed to them are done
+func (p *workPool) Close() {
+	close(p.tasks)
+}
+
+// workGroup is the share of the pool used by one job
+type workGroup struct {
+	pool  *workPool
+	ctx   context.Context
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+// group starts a job on the pool; its tasks stop being submitted once ctx is done
+func (p *workPool) group(ctx context.Context) *workGroup {
+	return &workGroup{pool: p, ctx: ctx, slots: make(chan struct{}, p.perJob)}
+}
+
+// Go hands task to a worker. It blocks while the job already runs perJob tasks or
+// every worker is busy, and returns the error of ctx without running task if ctx
+// is done first
+func (g *workGroup) Go(task func()) error {
+	select {
+	case g.slots <- struct{}{}:
+	case <-g.ctx.Done():
+		return g.ctx.Err()
+	}
+	g.wg.Add(1)
+	run := func() {
+		defer g.wg.Done()
+		defer func() { <-g.slots }()
+		task()
+	}
+	select {
+	case g.pool.tasks <- run:
+		return nil
+	case <-g.ctx.Done():
+		<-g.slots
+		g.wg.Done()
+		return g.ctx.Err()
+	}
+}
+
+// Wait waits for the tasks handed to workers
+func (g *workGroup) Wait() {
+	g.wg.Wait()
+}
+
+// run runs task on a worker of the pool and waits for it, for work that cannot be
+// split such as an import
+func (p *workPool) run(ctx context.Context, task func()) error {
+	g := p.group(ctx)
+	if err := g.Go(task); err != nil {
+		return err
+	}
+	g.Wait()
+	return nil
+}
+
+// configureWorkPool sizes the batch worker pool from GO_SUBNET_CALCULATOR_BATCH_WORKERS
+// (default the number of CPUs) and GO_SUBNET_CALCULATOR_BATCH_JOB_CONCURRENCY, how
+// many of them one batch or import may use (default half)
+func configureWorkPool() error {
+	workers, perJob := defaultBatchWorkers(), 0
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_BATCH_WORKERS"); value != "" {
+		var err error
+		if workers, err = strconv.Atoi(value); err != nil || workers < 1 || workers > maxBatchWorkers {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_BATCH_WORKERS must be between 1 and %d", maxBatchWorkers)
+		}
+	}
+	if value := os.Getenv("GO_SUBNET_CALCULATOR_BATCH_JOB_CONCURRENCY"); value != "" {
+		var err error
+		if perJob, err = strconv.Atoi(value); err != nil || perJob < 1 || perJob > workers {
+			return fmt.Errorf("GO_SUBNET_CALCULATOR_BATCH_JOB_CONCURRENCY must be between 1 and the %d batch workers", workers)
+		}
+	}
+	batchPool.Close()
+	batchPool = newWorkPool(workers, perJob)
+	recordSystemAudit("config.batch_workers", "", "%d workers, at most %d per batch or import", batchPool.workers, batchPool.perJob)
+	return nil
+}
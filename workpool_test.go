@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// withTestWorkPool replaces the batch worker pool for the duration of a test
+func withTestWorkPool(t *testing.T, workers, perJob int) *workPool {
+	t.Helper()
+	previous := batchPool
+	batchPool = newWorkPool(workers, perJob)
+	t.Cleanup(func() {
+		batchPool.Close()
+		batchPool = previous
+	})
+	return batchPool
+}
+
+func TestWorkPool(t *testing.T) {
+	pool := withTestWorkPool(t, 3, 2)
+	release := make(chan struct{})
+	var running, peak atomic.Int32
+	blocker := func() {
+		n := running.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		<-release
+		running.Add(-1)
+	}
+
+	// A large job holds its share of the workers and waits for more
+	big := pool.group(context.Background())
+	submitted := make(chan struct{})
+	go func() {
+		for i := 0; i < 6; i++ {
+			big.Go(blocker)
+		}
+		close(submitted)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for running.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-submitted:
+		t.Fatal("a job submitted more tasks than its share of the pool")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Another job still gets the remaining worker
+	done := make(chan struct{})
+	if err := pool.run(context.Background(), func() { close(done) }); err != nil {
+		t.Fatalf("run() = %v", err)
+	}
+	<-done
+
+	// A job waiting for a worker gives up when its context ends
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	waiting := pool.group(ctx)
+	waiting.Go(blocker)
+	if err := waiting.Go(blocker); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Go() on a busy pool = %v, want the context error", err)
+	}
+
+	close(release)
+	<-submitted
+	big.Wait()
+	waiting.Wait()
+	if peak.Load() > 3 {
+		t.Errorf("%d tasks ran at once on 3 workers", peak.Load())
+	}
+}
+
+func TestCalculateBatchJobWorkers(t *testing.T) {
+	withTestWorkPool(t, 4, 3)
+	items := make([]BatchItem, 1050)
+	for i := range items {
+		items[i] = BatchItem{Line: i + 1, IP: fmt.Sprintf("10.%d.%d.1", i/256, i%256), Mask: "/24"}
+	}
+	items[700].Mask = "/40"
+	last := 0
+	resp, err := calculateBatchJob(context.Background(), items, func(done, total int) { last = done })
+	if err != nil || resp.Count != 1050 || resp.Errors != 1 || last != 1050 {
+		t.Fatalf("calculateBatchJob() = %v, %d items, %d errors, progress %d", err, resp.Count, resp.Errors, last)
+	}
+	for i, res := range resp.Results {
+		if res.Line != i+1 || (i != 700 && res.Result.NetworkAddress != fmt.Sprintf("10.%d.%d.0", i/256, i%256)) {
+			t.Fatalf("result %d = %+v", i, res)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := calculateBatchJob(ctx, items, func(int, int) {}); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled calculateBatchJob() = %v", err)
+	}
+}
+
+func TestStreamBatchOrder(t *testing.T) {
+	withTestWorkPool(t, 4, 3)
+	var input strings.Builder
+	for i := 0; i < 1050; i++ {
+		fmt.Fprintf(&input, "{\"ip\":\"10.%d.%d.1\",\"mask\":\"/24\"}\n", i/256, i%256)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/batch", strings.NewReader(input.String()))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rr := httptest.NewRecorder()
+	batchHandler(rr, req)
+
+	decoder := json.NewDecoder(rr.Body)
+	n := 0
+	for ; decoder.More(); n++ {
+		var res BatchResult
+		if err := decoder.Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Line != n+1 || res.Result == nil {
+			t.Fatalf("result %d = %+v", n, res)
+		}
+	}
+	if n != 1050 {
+		t.Errorf("%d results, want 1050", n)
+	}
+}
+
+func TestConfigureWorkPool(t *testing.T) {
+	withTestWorkPool(t, 2, 1)
+	withTestAudit(t)
+
+	t.Setenv("GO_SUBNET_CALCULATOR_BATCH_WORKERS", "8")
+	if err := configureWorkPool(); err != nil || batchPool.workers != 8 || batchPool.perJob != 4 {
+		t.Errorf("configureWorkPool() = %v, %d workers, %d per job", err, batchPool.workers, batchPool.perJob)
+	}
+	t.Setenv("GO_SUBNET_CALCULATOR_BATCH_JOB_CONCURRENCY", "8")
+	if err := configureWorkPool(); err != nil || batchPool.perJob != 8 {
+		t.Errorf("configureWorkPool() = %v, %d per job", err, batchPool.perJob)
+	}
+	for name, value := range map[string]string{"GO_SUBNET_CALCULATOR_BATCH_WORKERS": "0", "GO_SUBNET_CALCULATOR_BATCH_JOB_CONCURRENCY": "9"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if err := configureWorkPool(); err == nil {
+				t.Errorf("%s=%s: expected an error", name, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxXLSXSheets bounds the per-subnet sheets of a workbook; larger plans only get
+// their summary sheet
+const maxXLSXSheets = 250
+
+// xlsxSheet is one worksheet: a bold, frozen header row followed by the rows. Cells
+// may be strings, integers or floats; floats are shown with two decimals
+type xlsxSheet struct {
+	Name   string
+	Header []string
+	Rows   [][]interface{}
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`%s</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles defines style 1 for header cells (bold on grey) and style 2 for floats
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>` +
+	`<fill><patternFill patternType="solid"><fgColor rgb="FFD9D9D9"/><bgColor indexed="64"/></patternFill></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/>` +
+	`<xf numFmtId="2" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`</styleSheet>`
+
+// xlsxColumn returns the column letters of a zero-based column index: A, B, ..., AA
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxEscape escapes text for XML element content and attributes
+func xlsxEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// xlsxSheetNames makes sheet names valid and unique: at most 31 characters and none
+// of the characters Excel rejects
+func xlsxSheetNames(sheets []xlsxSheet) []string {
+	replacer := strings.NewReplacer("/", "_", "\\", "_", "?", "_", "*", "_", "[", "(", "]", ")", ":", "_")
+	seen := map[string]bool{}
+	names := make([]string, len(sheets))
+	for i, s := range sheets {
+		base := strings.Trim(replacer.Replace(s.Name), "'")
+		if base == "" {
+			base = "Sheet" + strconv.Itoa(i+1)
+		}
+		if len(base) > 31 {
+			base = base[:31]
+		}
+		name := base
+		for n := 2; seen[strings.ToLower(name)]; n++ {
+			suffix := " (" + strconv.Itoa(n) + ")"
+			name = base[:min(len(base), 31-len(suffix))] + suffix
+		}
+		seen[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+// xlsxCell renders one cell at ref
+func xlsxCell(ref string, value interface{}, style int) string {
+	styleAttr := ""
+	if style != 0 {
+		styleAttr = ` s="` + strconv.Itoa(style) + `"`
+	}
+	switch v := value.(type) {
+	case int:
+		return `<c r="` + ref + `"` + styleAttr + `><v>` + strconv.Itoa(v) + `</v></c>`
+	case int64:
+		return `<c r="` + ref + `"` + styleAttr + `><v>` + strconv.FormatInt(v, 10) + `</v></c>`
+	case uint64:
+		return `<c r="` + ref + `"` + styleAttr + `><v>` + strconv.FormatUint(v, 10) + `</v></c>`
+	case float64:
+		if style == 0 {
+			styleAttr = ` s="2"`
+		}
+		return `<c r="` + ref + `"` + styleAttr + `><v>` + strconv.FormatFloat(v, 'f', -1, 64) + `</v></c>`
+	case time.Time:
+		value = v.Format(time.RFC3339)
+	}
+	return `<c r="` + ref + `" t="inlineStr"` + styleAttr + `><is><t xml:space="preserve">` + xlsxEscape(fmt.Sprint(value)) + `</t></is></c>`
+}
+
+// xlsxWorksheet renders a sheet with its columns sized to their content
+func xlsxWorksheet(s xlsxSheet) string {
+	widths := make([]int, len(s.Header))
+	for i, h := range s.Header {
+		widths[i] = len(h)
+	}
+	for _, row := range s.Rows {
+		for i, value := range row {
+			if i < len(widths) {
+				widths[i] = max(widths[i], len(fmt.Sprint(value)))
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(widths) > 0 {
+		b.WriteString("<cols>")
+		for i, width := range widths {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, min(width, 60)+2)
+		}
+		b.WriteString("</cols>")
+	}
+	b.WriteString("<sheetData>")
+	b.WriteString(`<row r="1">`)
+	for i, h := range s.Header {
+		b.WriteString(xlsxCell(xlsxColumn(i)+"1", h, 1))
+	}
+	b.WriteString("</row>")
+	for r, row := range s.Rows {
+		line := strconv.Itoa(r + 2)
+		b.WriteString(`<row r="` + line + `">`)
+		for i, value := range row {
+			b.WriteString(xlsxCell(xlsxColumn(i)+line, value, 0))
+		}
+		b.WriteString("</row>")
+	}
+	b.WriteString("</sheetData></worksheet>")
+	return b.String()
+}
+
+// writeXLSX writes sheets as an Office Open XML workbook
+func writeXLSX(out io.Writer, sheets []xlsxSheet) error {
+	names := xlsxSheetNames(sheets)
+	var overrides, entries, rels strings.Builder
+	for i, name := range names {
+		n := strconv.Itoa(i + 1)
+		overrides.WriteString(`<Override PartName="/xl/worksheets/sheet` + n + `.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`)
+		entries.WriteString(`<sheet name="` + xlsxEscape(name) + `" sheetId="` + n + `" r:id="rId` + n + `"/>`)
+		rels.WriteString(`<Relationship Id="rId` + n + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet` + n + `.xml"/>`)
+	}
+	stylesID := strconv.Itoa(len(names) + 1)
+	rels.WriteString(`<Relationship Id="rId` + stylesID + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", fmt.Sprintf(xlsxContentTypes, overrides.String())},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+			`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + entries.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + rels.String() + `</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for i, s := range sheets {
+		parts = append(parts, struct{ name, content string }{"xl/worksheets/sheet" + strconv.Itoa(i+1) + ".xml", xlsxWorksheet(s)})
+	}
+
+	zw := zip.NewWriter(out)
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeXLSXDownload sends sheets as an Excel download with the given file name
+func writeXLSXDownload(w http.ResponseWriter, filename string, sheets []xlsxSheet) {
+	var buf bytes.Buffer
+	if err := writeXLSX(&buf, sheets); err != nil {
+		log.Printf("XLSX encoding error: %v", err)
+		http.Error(w, "XLSX encoding error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readXLSX unpacks a workbook into its parts
+func readXLSX(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(content)
+	}
+	return parts
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(i); got != want {
+			t.Errorf("xlsxColumn(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
+
+func TestXLSXSheetNames(t *testing.T) {
+	sheets := []xlsxSheet{{Name: "10.0.0.0/24"}, {Name: "10.0.0.0/24"}, {Name: ""}, {Name: strings.Repeat("x", 40)}, {Name: "a[b]:c?"}}
+	want := []string{"10.0.0.0_24", "10.0.0.0_24 (2)", "Sheet3", strings.Repeat("x", 31), "a(b)_c_"}
+	if got := xlsxSheetNames(sheets); !reflect.DeepEqual(got, want) {
+		t.Errorf("names = %q, want %q", got, want)
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeXLSX(&buf, []xlsxSheet{
+		{Name: "Summary", Header: []string{"name", "hosts", "share"}, Rows: [][]interface{}{{"a & b", uint64(254), 12.5}}},
+		{Name: "10.0.0.0/24", Header: []string{"field"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := readXLSX(t, buf.Bytes())
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `name="10.0.0.0_24"`) {
+		t.Errorf("workbook = %s", parts["xl/workbook.xml"])
+	}
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{`<c r="A1" t="inlineStr" s="1">`, `a &amp; b`, `<c r="B2"><v>254</v></c>`, `<c r="C2" s="2"><v>12.5</v></c>`, `state="frozen"`} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet is missing %s:\n%s", want, sheet)
+		}
+	}
+}
+
+func TestXLSXExports(t *testing.T) {
+	withTestIPAM(t)
+	pool, err := ipamService.CreatePool(PoolRequest{Name: "lab/dc1", Prefix: "10.0.0.0/16"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipamService.Allocate(pool.ID, AllocationRequest{Size: 24, Description: "servers", VLAN: 10})
+
+	rr := httptest.NewRecorder()
+	ipamPoolsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/ipam/pools?format=xlsx", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Header().Get("Content-Type"), "spreadsheetml") {
+		t.Fatalf("pools report = %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	parts := readXLSX(t, rr.Body.Bytes())
+	if !strings.Contains(parts["xl/workbook.xml"], `name="Summary"`) || !strings.Contains(parts["xl/workbook.xml"], `name="lab_dc1"`) {
+		t.Errorf("workbook = %s", parts["xl/workbook.xml"])
+	}
+	if sheet := parts["xl/worksheets/sheet2.xml"]; !strings.Contains(sheet, "10.0.0.0/24") || !strings.Contains(sheet, "servers") {
+		t.Errorf("pool sheet = %s", sheet)
+	}
+
+	rr = httptest.NewRecorder()
+	ipamPageHandler(rr, httptest.NewRequest(http.MethodGet, "/ipam?format=xlsx", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Header().Get("Content-Disposition"), "ipam-report.xlsx") {
+		t.Errorf("page report = %d %s", rr.Code, rr.Header().Get("Content-Disposition"))
+	}
+
+	rr = httptest.NewRecorder()
+	deaggregateHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/deaggregate?prefix=10.0.0.0/24&length=26&format=xlsx", nil))
+	parts = readXLSX(t, rr.Body.Bytes())
+	if _, ok := parts["xl/worksheets/sheet5.xml"]; !ok || !strings.Contains(parts["xl/workbook.xml"], `name="10.0.0.192_26"`) {
+		t.Errorf("plan workbook = %s", parts["xl/workbook.xml"])
+	}
+	if got := subnetSheets(make([]SubnetRow, maxXLSXSheets+1)); len(got) != 1 {
+		t.Errorf("large plan got %d sheets, want only the summary", len(got))
+	}
+}